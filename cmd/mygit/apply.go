@@ -0,0 +1,607 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+	"github.com/codecrafters-io/git-starter-go/pkg/diff"
+	"github.com/codecrafters-io/git-starter-go/pkg/objects"
+)
+
+// filePatch is the change a patch makes to one file. A path is empty on
+// the side where the file does not exist, and the blob names come from the
+// "index" line, abbreviated as the patch has them.
+type filePatch struct {
+	oldPath, newPath string
+	oldMode, newMode string
+	oldSHA, newSHA   string
+	binary           bool
+	hunks            []patchHunk
+}
+
+// patchHunk is one "@@" section: the lines it expects at oldStart and
+// what replaces them, each keeping its "\n" unless the patch said there
+// was none.
+type patchHunk struct {
+	oldStart int
+	old, new []string
+	// trailing counts the context lines that end the hunk; without any it
+	// changes the end of the file.
+	trailing int
+}
+
+// path names the file a patch is about, for messages.
+func (patch *filePatch) path() string {
+	if patch.oldPath != "" {
+		return patch.oldPath
+	}
+	return patch.newPath
+}
+
+// patchedFile is what applying a patch to one file came to: its new
+// content and mode, or its removal, and with --3way the stages a
+// conflicted merge leaves in the index.
+type patchedFile struct {
+	patch    *filePatch
+	content  []byte
+	mode     string
+	removed  bool
+	conflict [3]*TreeFile
+}
+
+// apply applies patches, read from the files named or standard input, to
+// the worktree, or with --cached to the index only, or with --index to
+// both. --check only says whether they would apply. A file is changed
+// only when every hunk finds its preimage, at the line the patch says or
+// an offset from it; otherwise nothing at all is written. --3way first
+// merges the change into the file from the blob the patch's index line
+// names, leaving conflict markers and index stages when it cannot, and
+// goes back to applying the hunks directly when that blob is not here.
+func apply(args []string, stdin io.Reader, stderr io.Writer) error {
+	check, cached, index, threeWay, verbose := false, false, false, false, false
+	strip := 1
+	inputs := make([]string, 0, len(args))
+	for position := 0; position < len(args); position++ {
+		switch arg := args[position]; {
+		case arg == "--":
+			inputs = append(inputs, args[position+1:]...)
+			position = len(args)
+		case arg == "--check":
+			check = true
+		case arg == "--cached":
+			cached = true
+		case arg == "--index":
+			index = true
+		case arg == "-3" || arg == "--3way":
+			threeWay = true
+		case arg == "-v" || arg == "--verbose":
+			verbose = true
+		case strings.HasPrefix(arg, "-p") && len(arg) > 2:
+			value, err := strconv.Atoi(arg[2:])
+			if err != nil || value < 0 {
+				return failure.Usagef("error: switch `p' expects a numerical value")
+			}
+			strip = value
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			return failure.Usage("usage: git apply [--check] [--index | --cached] [-3 | --3way] [-v] [-p<n>] [<patch>...]")
+		default:
+			inputs = append(inputs, arg)
+		}
+	}
+	if threeWay && !cached {
+		// A three-way merge records its stages, so it needs the index.
+		index = true
+	}
+	if len(inputs) == 0 {
+		inputs = []string{"-"}
+	}
+
+	patches := make([]*filePatch, 0)
+	for _, input := range inputs {
+		var content []byte
+		var err error
+		if input == "-" {
+			content, err = io.ReadAll(stdin)
+		} else if content, err = os.ReadFile(input); err != nil {
+			return failure.Fatalf("fatal: can't open patch '%v': %v", input, errors.Unwrap(err))
+		}
+		if err != nil {
+			return err
+		}
+		parsed, err := parsePatch(content, strip)
+		if err != nil {
+			return err
+		}
+		patches = append(patches, parsed...)
+	}
+	if len(patches) == 0 {
+		return failure.Fatal("fatal: No valid patches in input (allow with \"--allow-empty\")")
+	}
+
+	entries, err := readIndex()
+	if err != nil {
+		return err
+	}
+	indexed := make(map[string]IndexEntry, len(entries))
+	for _, entry := range entries {
+		if entry.stage() == 0 {
+			indexed[entry.path] = entry
+		}
+	}
+
+	// Each failure is told as it is found, among what --3way says, and the
+	// rest are still checked.
+	results := make([]patchedFile, 0, len(patches))
+	failed := false
+	for _, patch := range patches {
+		if verbose {
+			fmt.Fprintf(stderr, "Checking patch %v...\n", patch.path())
+		}
+		result, err := applyFilePatch(patch, indexed, cached, index, threeWay, verbose, stderr)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			failed = true
+			continue
+		}
+		results = append(results, result)
+	}
+	if failed {
+		return errSilentFailure
+	}
+	if check {
+		return nil
+	}
+
+	conflicted := make([]string, 0)
+	for _, result := range results {
+		if err := writePatchedFile(result, indexed, cached, index); err != nil {
+			return err
+		}
+		if result.conflict[1] != nil || result.conflict[2] != nil {
+			conflicted = append(conflicted, result.patch.newPath)
+		}
+		if verbose {
+			fmt.Fprintf(stderr, "Applied patch %v cleanly.\n", result.patch.path())
+		}
+	}
+	if index || cached {
+		updated := make([]IndexEntry, 0, len(entries))
+		for _, entry := range entries {
+			if _, ok := indexed[entry.path]; entry.stage() != 0 && !ok {
+				updated = append(updated, entry)
+			}
+		}
+		for _, entry := range indexed {
+			updated = append(updated, entry)
+		}
+		for _, result := range results {
+			for stage, file := range result.conflict {
+				if file == nil {
+					continue
+				}
+				mode, err := strconv.ParseUint(file.mode, 8, 32)
+				if err != nil {
+					return fmt.Errorf("Invalid mode %v for %v", file.mode, result.patch.newPath)
+				}
+				updated = append(updated, IndexEntry{mode: uint32(mode), hash: file.hash, path: result.patch.newPath, flags: uint16(stage+1) << 12})
+			}
+		}
+		if err := writeIndex(updated); err != nil {
+			return err
+		}
+	}
+	if len(conflicted) > 0 {
+		sort.Strings(conflicted)
+		for _, path := range conflicted {
+			fmt.Fprintf(stderr, "U %v\n", path)
+		}
+		return errSilentFailure
+	}
+	return nil
+}
+
+// applyFilePatch works out what patch makes of its file, without writing
+// anything. verbose adds the preimage a failed hunk was looked for with.
+func applyFilePatch(patch *filePatch, indexed map[string]IndexEntry, cached bool, index bool, threeWay bool, verbose bool, stderr io.Writer) (patchedFile, error) {
+	path := patch.path()
+	if patch.binary {
+		return patchedFile{}, fmt.Errorf("error: cannot apply binary patch to '%v' without full index line\nerror: %v: patch does not apply", path, path)
+	}
+	result := patchedFile{patch: patch, mode: patch.newMode, removed: patch.newPath == ""}
+
+	// The preimage comes from the index, or the worktree, or both, which
+	// must then agree.
+	var current []byte
+	currentMode := ""
+	entry, inIndex := indexed[patch.oldPath]
+	if patch.oldPath != "" && (index || cached) {
+		if !inIndex {
+			return result, fmt.Errorf("error: %v: does not exist in index", path)
+		}
+		blob, err := repository.ReadBlob(hex.EncodeToString(entry.hash))
+		if err != nil {
+			return result, err
+		}
+		current, currentMode = blob.Data, treeFileFromIndex(entry).mode
+	}
+	if patch.oldPath != "" && !cached {
+		info, err := os.Lstat(patch.oldPath)
+		if err != nil {
+			return result, fmt.Errorf("error: %v: No such file or directory", path)
+		}
+		if index {
+			if modified, err := worktreeModified(entry); err != nil || modified {
+				return result, fmt.Errorf("error: %v: does not match index", path)
+			}
+		} else {
+			if current, err = os.ReadFile(patch.oldPath); err != nil {
+				return result, fmt.Errorf("error: %v: No such file or directory", path)
+			}
+			current = repository.CleanContent(current)
+			currentMode = "100644"
+			if info.Mode()&0111 != 0 {
+				currentMode = "100755"
+			}
+		}
+	}
+	if patch.oldPath == "" {
+		if _, ok := indexed[patch.newPath]; ok && (index || cached) {
+			return result, fmt.Errorf("error: %v: already exists in index", patch.newPath)
+		}
+		if _, err := os.Lstat(patch.newPath); err == nil && !cached {
+			return result, fmt.Errorf("error: %v: already exists in working directory", patch.newPath)
+		}
+	}
+	if result.mode == "" {
+		result.mode = currentMode
+	}
+	if result.mode == "" {
+		// A plain diff creating a file gives it no mode.
+		result.mode = "100644"
+	}
+
+	if threeWay && patch.oldPath != "" && patch.newPath != "" {
+		merged, ok, err := mergeFilePatch(patch, current, currentMode, &result, stderr)
+		if err != nil || ok {
+			return merged, err
+		}
+	} else if threeWay {
+		// Files created or removed have nothing to merge with.
+		fmt.Fprintf(stderr, "Falling back to direct application...\n")
+	}
+	lines, failed := applyHunks(diff.SplitLines(current), patch.hunks)
+	if failed != nil {
+		searched := ""
+		if verbose {
+			searched = "error: while searching for:\n" + strings.Join(failed.old, "") + "\n"
+		}
+		return result, fmt.Errorf("%verror: patch failed: %v:%v\nerror: %v: patch does not apply", searched, path, failed.oldStart, path)
+	}
+	if result.removed && len(lines) > 0 {
+		return result, fmt.Errorf("error: removal patch leaves file contents\nerror: %v: patch does not apply", path)
+	}
+	result.content = []byte(strings.Join(lines, ""))
+	return result, nil
+}
+
+// mergeFilePatch applies patch to the blob it was made against and merges
+// that with current, ours, reporting false when the blob is not here or
+// the patch does not apply to it either.
+func mergeFilePatch(patch *filePatch, current []byte, currentMode string, result *patchedFile, stderr io.Writer) (patchedFile, bool, error) {
+	path := patch.path()
+	baseSHA := ""
+	if len(patch.oldSHA) >= 4 {
+		if matches, err := repository.FindObjects(patch.oldSHA); err == nil && len(matches) == 1 {
+			baseSHA = matches[0]
+		}
+	}
+	var base *objects.Blob
+	if baseSHA != "" {
+		base, _ = repository.ReadBlob(baseSHA)
+	}
+	if base == nil {
+		fmt.Fprintf(stderr, "error: repository lacks the necessary blob to perform 3-way merge.\nFalling back to direct application...\n")
+		return *result, false, nil
+	}
+	baseLines := diff.SplitLines(base.Data)
+	theirs, failed := applyHunks(baseLines, patch.hunks)
+	if failed != nil {
+		fmt.Fprintf(stderr, "error: patch failed: %v:%v\nFalling back to direct application...\n", path, failed.oldStart)
+		return *result, false, nil
+	}
+	theirsContent := []byte(strings.Join(theirs, ""))
+	merged, conflicts := diff.Merge(baseLines, diff.SplitLines(current), theirs, "ours", "theirs")
+	result.content = merged
+	if conflicts == 0 {
+		fmt.Fprintf(stderr, "Applied patch to '%v' cleanly.\n", path)
+		return *result, true, nil
+	}
+	fmt.Fprintf(stderr, "Applied patch to '%v' with conflicts.\n", path)
+	baseHash, err := hex.DecodeString(baseSHA)
+	if err != nil {
+		return *result, false, err
+	}
+	oursHash, err := repository.WriteObject(objects.TypeBlob, current)
+	if err != nil {
+		return *result, false, err
+	}
+	theirsHash, err := repository.WriteObject(objects.TypeBlob, theirsContent)
+	if err != nil {
+		return *result, false, err
+	}
+	baseMode := patch.oldMode
+	if baseMode == "" {
+		baseMode = currentMode
+	}
+	result.conflict = [3]*TreeFile{
+		{mode: baseMode, hash: baseHash},
+		{mode: currentMode, hash: oursHash},
+		{mode: result.mode, hash: theirsHash},
+	}
+	return *result, true, nil
+}
+
+// applyHunks replaces each hunk's preimage in lines with its postimage. A
+// hunk is looked for where the patch puts it, shifted by how far earlier
+// hunks moved, and then ever further either side, but never before the
+// previous hunk. As in git, a hunk at the first line only matches at the
+// beginning of the file, and one with no trailing context only at its end.
+// It returns the first hunk that matched nowhere, or nil when all applied.
+func applyHunks(lines []string, hunks []patchHunk) ([]string, *patchHunk) {
+	result := make([]string, 0, len(lines))
+	position, offset := 0, 0
+	for index := range hunks {
+		hunk := &hunks[index]
+		expected := hunk.oldStart - 1 + offset
+		if len(hunk.old) == 0 {
+			expected = hunk.oldStart + offset
+		}
+		matches := func(at int) bool {
+			return at >= position && at+len(hunk.old) <= len(lines) && slicesEqual(lines[at:at+len(hunk.old)], hunk.old) &&
+				(hunk.oldStart > 1 || at == 0) && (hunk.trailing > 0 || at+len(hunk.old) == len(lines))
+		}
+		found := -1
+		for distance := 0; found < 0; distance++ {
+			before, after := expected-distance, expected+distance
+			if before < position && after+len(hunk.old) > len(lines) {
+				break
+			}
+			switch {
+			case matches(after):
+				found = after
+			case matches(before):
+				found = before
+			}
+		}
+		if found < 0 {
+			return nil, hunk
+		}
+		result = append(result, lines[position:found]...)
+		result = append(result, hunk.new...)
+		position = found + len(hunk.old)
+		offset = found - (expected - offset)
+	}
+	return append(result, lines[position:]...), nil
+}
+
+func slicesEqual(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for index := range a {
+		if a[index] != b[index] {
+			return false
+		}
+	}
+	return true
+}
+
+// writePatchedFile puts an applied patch's result in the worktree and, as
+// its entry in indexed, in the index, as the options ask.
+func writePatchedFile(result patchedFile, indexed map[string]IndexEntry, cached bool, index bool) error {
+	patch := result.patch
+	if patch.oldPath != "" && (result.removed || patch.oldPath != patch.newPath) {
+		delete(indexed, patch.oldPath)
+		if !cached {
+			if err := removeWorktreeFile(patch.oldPath); err != nil {
+				return err
+			}
+		}
+	}
+	if result.removed {
+		return nil
+	}
+	path := patch.newPath
+	hash, err := repository.WriteObject(objects.TypeBlob, result.content)
+	if err != nil {
+		return err
+	}
+	file := TreeFile{mode: result.mode, hash: hash}
+	if !cached {
+		if err := writeWorktreeFile(path, file); err != nil {
+			return err
+		}
+	}
+	if !index && !cached {
+		return nil
+	}
+	if result.conflict[1] != nil || result.conflict[2] != nil {
+		delete(indexed, path)
+		return nil
+	}
+	if cached {
+		mode, err := strconv.ParseUint(file.mode, 8, 32)
+		if err != nil {
+			return fmt.Errorf("Invalid mode %v for %v", file.mode, path)
+		}
+		indexed[path] = IndexEntry{mode: uint32(mode), hash: hash, path: path}
+		return nil
+	}
+	entry, err := indexEntryForTreeFile(path, file)
+	if err != nil {
+		return err
+	}
+	indexed[path] = entry
+	return nil
+}
+
+// parsePatch reads the file patches of a git or plain unified diff,
+// stripping strip leading components from the paths it names.
+func parsePatch(content []byte, strip int) ([]*filePatch, error) {
+	stripPath := func(name string) string {
+		name = strings.SplitN(name, "\t", 2)[0]
+		if name == "/dev/null" {
+			return ""
+		}
+		for count := 0; count < strip; count++ {
+			_, rest, found := strings.Cut(name, "/")
+			if !found {
+				break
+			}
+			name = rest
+		}
+		return name
+	}
+
+	patches := make([]*filePatch, 0)
+	var current *filePatch
+	lines := diff.SplitLines(content)
+	for number := 0; number < len(lines); number++ {
+		line := strings.TrimSuffix(lines[number], "\n")
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			current = &filePatch{}
+			patches = append(patches, current)
+			if names := strings.SplitN(strings.TrimPrefix(line, "diff --git "), " ", 2); len(names) == 2 {
+				current.oldPath, current.newPath = stripPath(names[0]), stripPath(names[1])
+			}
+		case strings.HasPrefix(line, "--- "):
+			if current == nil || len(current.hunks) > 0 {
+				current = &filePatch{}
+				patches = append(patches, current)
+			}
+			current.oldPath = stripPath(strings.TrimPrefix(line, "--- "))
+		case current == nil:
+			// Anything before the first file, such as a commit message.
+		case strings.HasPrefix(line, "+++ "):
+			current.newPath = stripPath(strings.TrimPrefix(line, "+++ "))
+		case strings.HasPrefix(line, "new file mode "):
+			current.oldPath, current.newMode = "", strings.TrimPrefix(line, "new file mode ")
+		case strings.HasPrefix(line, "deleted file mode "):
+			current.newPath, current.oldMode = "", strings.TrimPrefix(line, "deleted file mode ")
+		case strings.HasPrefix(line, "old mode "):
+			current.oldMode = strings.TrimPrefix(line, "old mode ")
+		case strings.HasPrefix(line, "new mode "):
+			current.newMode = strings.TrimPrefix(line, "new mode ")
+		case strings.HasPrefix(line, "rename from "):
+			current.oldPath = strings.TrimPrefix(line, "rename from ")
+		case strings.HasPrefix(line, "rename to "):
+			current.newPath = strings.TrimPrefix(line, "rename to ")
+		case strings.HasPrefix(line, "index "):
+			fields := strings.Fields(strings.TrimPrefix(line, "index "))
+			if old, new, found := strings.Cut(fields[0], ".."); found {
+				current.oldSHA, current.newSHA = old, new
+			}
+			if len(fields) > 1 && current.oldMode == "" && current.newMode == "" {
+				current.oldMode, current.newMode = fields[1], fields[1]
+			}
+		case strings.HasPrefix(line, "GIT binary patch") || strings.HasPrefix(line, "Binary files "):
+			current.binary = true
+		case strings.HasPrefix(line, "@@ "):
+			hunk, consumed, ok := parseHunk(lines[number:])
+			if !ok {
+				return nil, failure.Fatalf("fatal: corrupt patch at line %v", number+consumed+1)
+			}
+			current.hunks = append(current.hunks, hunk)
+			number += consumed - 1
+		}
+	}
+	for _, patch := range patches {
+		if patch.oldPath == "" && patch.newPath == "" {
+			return nil, failure.Fatal("fatal: git diff header lacks filename information")
+		}
+		if patch.newMode == "" {
+			patch.newMode = patch.oldMode
+		}
+	}
+	return patches, nil
+}
+
+// parseHunk reads the hunk whose "@@ -a,b +c,d @@" header starts lines,
+// and the "\ No newline at end of file" markers in it, returning how many
+// lines it took up. On failure that count is where it went wrong.
+func parseHunk(lines []string) (patchHunk, int, bool) {
+	var oldStart, oldCount, newStart, newCount int
+	header := strings.TrimSuffix(lines[0], "\n")
+	ranges := strings.Fields(header)
+	if len(ranges) < 3 || !strings.HasPrefix(ranges[1], "-") || !strings.HasPrefix(ranges[2], "+") {
+		return patchHunk{}, 0, false
+	}
+	parseRange := func(spec string, start *int, count *int) bool {
+		first, second, hasCount := strings.Cut(spec, ",")
+		*count = 1
+		var err error
+		if *start, err = strconv.Atoi(first); err != nil {
+			return false
+		}
+		if hasCount {
+			if *count, err = strconv.Atoi(second); err != nil {
+				return false
+			}
+		}
+		return true
+	}
+	if !parseRange(ranges[1][1:], &oldStart, &oldCount) || !parseRange(ranges[2][1:], &newStart, &newCount) {
+		return patchHunk{}, 0, false
+	}
+
+	hunk := patchHunk{oldStart: oldStart}
+	last := byte(0)
+	number := 1
+	for ; number < len(lines) && (oldCount > 0 || newCount > 0 || strings.HasPrefix(lines[number], "\\")); number++ {
+		line := lines[number]
+		if line == "\n" {
+			// Editors may strip the space of an empty context line.
+			line = " \n"
+		}
+		text := line[1:]
+		switch line[0] {
+		case ' ':
+			hunk.old, hunk.new = append(hunk.old, text), append(hunk.new, text)
+			oldCount, newCount = oldCount-1, newCount-1
+			hunk.trailing++
+		case '-':
+			hunk.old = append(hunk.old, text)
+			oldCount, hunk.trailing = oldCount-1, 0
+		case '+':
+			hunk.new = append(hunk.new, text)
+			newCount, hunk.trailing = newCount-1, 0
+		case '\\':
+			// The line before has no newline, on the side or sides it is on.
+			if last != '+' && len(hunk.old) > 0 {
+				hunk.old[len(hunk.old)-1] = strings.TrimSuffix(hunk.old[len(hunk.old)-1], "\n")
+			}
+			if last != '-' && len(hunk.new) > 0 {
+				hunk.new[len(hunk.new)-1] = strings.TrimSuffix(hunk.new[len(hunk.new)-1], "\n")
+			}
+			continue
+		default:
+			return patchHunk{}, number, false
+		}
+		if oldCount < 0 || newCount < 0 {
+			return patchHunk{}, number, false
+		}
+		last = line[0]
+	}
+	if oldCount > 0 || newCount > 0 {
+		return patchHunk{}, number, false
+	}
+	return hunk, number, true
+}
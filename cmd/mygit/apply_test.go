@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyThreeWay(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	commitFile(t, dir, "a.txt", "1\n2\n3\n4\n5\n6\n7\n8\n9\n", "base")
+	writeFile(t, dir, "a.txt", "1\n2\n3\n4\nfive\n6\n7\n8\n9\n")
+	patches := t.TempDir()
+	writeFile(t, patches, "five.patch", mygit(t, dir, "diff"))
+	writeFile(t, dir, "a.txt", "1\ntwo\n3\n4\n5\n6\n7\n8\n9\n")
+	writeFile(t, patches, "two.patch", mygit(t, dir, "diff"))
+	mygit(t, dir, "reset", "--hard")
+	// Change a line the patch has as context, so it no longer applies as
+	// it is.
+	commitFile(t, dir, "a.txt", "1\n2\nthree\n4\n5\n6\n7\n8\n9\n", "ours")
+
+	_, stderr, code := runIn(t, dir, "", "apply", filepath.Join(patches, "five.patch"))
+	if want := "error: patch failed: a.txt:2\nerror: a.txt: patch does not apply\n"; code != 1 || stderr != want {
+		t.Errorf("apply without --3way: exit %v, stderr %q, want %q", code, stderr, want)
+	}
+	_, stderr, code = runIn(t, dir, "", "apply", "--3way", filepath.Join(patches, "five.patch"))
+	if want := "Applied patch to 'a.txt' cleanly.\n"; code != 0 || stderr != want {
+		t.Errorf("apply --3way: exit %v, stderr %q, want %q", code, stderr, want)
+	}
+	content, _ := os.ReadFile(filepath.Join(dir, "a.txt"))
+	if want := "1\n2\nthree\n4\nfive\n6\n7\n8\n9\n"; string(content) != want {
+		t.Errorf("apply --3way merged %q, want %q", content, want)
+	}
+	if got := mygit(t, dir, "status", "--short"); got != "M  a.txt\n" {
+		t.Errorf("apply --3way left status %q, want the result staged", got)
+	}
+
+	mygit(t, dir, "reset", "--hard")
+	_, stderr, code = runIn(t, dir, "", "apply", "-3", filepath.Join(patches, "two.patch"))
+	if want := "Applied patch to 'a.txt' with conflicts.\nU a.txt\n"; code != 1 || stderr != want {
+		t.Errorf("conflicted apply --3way: exit %v, stderr %q, want %q", code, stderr, want)
+	}
+	content, _ = os.ReadFile(filepath.Join(dir, "a.txt"))
+	if want := "1\n<<<<<<< ours\n2\nthree\n=======\ntwo\n3\n>>>>>>> theirs\n4\n5\n6\n7\n8\n9\n"; string(content) != want {
+		t.Errorf("conflicted apply --3way wrote %q, want %q", content, want)
+	}
+	if got := mygit(t, dir, "status", "--short"); got != "UU a.txt\n" {
+		t.Errorf("conflicted apply --3way left status %q", got)
+	}
+}
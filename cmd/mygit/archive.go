@@ -0,0 +1,268 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+)
+
+// archiveEntry is one path archive writes: a directory, a file with its
+// contents, or a symlink with its target.
+type archiveEntry struct {
+	path    string
+	mode    string
+	content []byte
+}
+
+// archive writes the tree of a commit, tag or tree as a tar or zip stream,
+// straight from the object store. Every path is given prefix, a
+// commit's entries carry its committer date and its id, and files keep
+// their executable bit and symlinks their targets. Paths after the tree-ish
+// limit the archive to what is under them.
+func archive(args []string, stdout io.Writer) error {
+	format, prefix, output := "", "", ""
+	positional := make([]string, 0, 1)
+	for index := 0; index < len(args); index++ {
+		arg := args[index]
+		switch {
+		case arg == "--":
+			positional = append(positional, args[index+1:]...)
+			index = len(args)
+		case strings.HasPrefix(arg, "--format="):
+			format = strings.TrimPrefix(arg, "--format=")
+		case strings.HasPrefix(arg, "--prefix="):
+			prefix = strings.TrimPrefix(arg, "--prefix=")
+		case strings.HasPrefix(arg, "--output="):
+			output = strings.TrimPrefix(arg, "--output=")
+		case arg == "-o" && index+1 < len(args):
+			index++
+			output = args[index]
+		case arg == "-l" || arg == "--list":
+			fmt.Fprintln(stdout, "tar\nzip")
+			return nil
+		case strings.HasPrefix(arg, "-"):
+			return failure.Usage("usage: git archive [<options>] <tree-ish> [<path>...]")
+		default:
+			positional = append(positional, arg)
+		}
+	}
+	if len(positional) == 0 {
+		return failure.Usage("usage: git archive [<options>] <tree-ish> [<path>...]")
+	}
+	if format == "" {
+		format = "tar"
+		if strings.HasSuffix(output, ".zip") {
+			format = "zip"
+		}
+	}
+	if format != "tar" && format != "zip" {
+		return failure.Fatalf("fatal: Unknown archive format '%v'", format)
+	}
+
+	revision := positional[0]
+	sha, err := resolveRevision(revision)
+	if err != nil {
+		return failure.Fatalf("fatal: not a valid object name: %v", revision)
+	}
+	treeSHA, err := peelObject(sha, "tree")
+	if err != nil {
+		return failure.Fatalf("fatal: not a tree object: %v", sha)
+	}
+	// A commit dates its entries and is named in the archive; a bare tree
+	// is dated now.
+	modified, commitSHA := time.Now(), ""
+	if peeled, err := peelObject(sha, "commit"); err == nil {
+		commit, err := readCommit(peeled)
+		if err != nil {
+			return err
+		}
+		modified, commitSHA = parseSignature(commit.Committer).when, peeled
+	}
+	pathspecs := make([]string, 0, len(positional)-1)
+	for _, arg := range positional[1:] {
+		pathspec, err := worktreePath(arg)
+		if err != nil {
+			return err
+		}
+		pathspecs = append(pathspecs, pathspec)
+	}
+	entries, err := archiveEntries(treeSHA, pathspecs)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(prefix, "/") {
+		// A directory prefix is itself the first entry.
+		entries = append([]archiveEntry{{path: "", mode: "40000"}}, entries...)
+	}
+	for _, pathspec := range pathspecs {
+		found := false
+		for _, entry := range entries {
+			if matchesPathspecs(entry.path, []string{pathspec}) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return failure.Fatalf("fatal: pathspec '%v' did not match any files", pathspec)
+		}
+	}
+
+	if output != "" {
+		file, err := os.Create(output)
+		if err != nil {
+			return failure.Fatalf("fatal: could not create archive file '%v': %w", output, err)
+		}
+		defer file.Close()
+		stdout = file
+	}
+	writer := bufio.NewWriter(stdout)
+	if format == "zip" {
+		err = writeZipArchive(writer, entries, prefix, modified, commitSHA)
+	} else {
+		err = writeTarArchive(writer, entries, prefix, modified, commitSHA)
+	}
+	if err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+// archiveEntries lists everything under treeSHA in tree order, each
+// directory before what it holds, limited to the paths pathspecs name and
+// the directories leading to them. A submodule becomes an empty directory.
+func archiveEntries(treeSHA string, pathspecs []string) ([]archiveEntry, error) {
+	entries := make([]archiveEntry, 0)
+	var walk func(sha string, dir string) error
+	walk = func(sha string, dir string) error {
+		tree, err := repository.ReadTree(sha)
+		if err != nil {
+			return err
+		}
+		for _, treeEntry := range tree.Entries {
+			path := dir + treeEntry.Name
+			leading := false
+			for _, pathspec := range pathspecs {
+				leading = leading || strings.HasPrefix(pathspec, path+"/")
+			}
+			if !leading && !matchesPathspecs(path, pathspecs) {
+				continue
+			}
+			entrySHA := hex.EncodeToString(treeEntry.Hash)
+			switch treeEntry.Mode {
+			case "40000":
+				entries = append(entries, archiveEntry{path: path + "/", mode: treeEntry.Mode})
+				if err := walk(entrySHA, path+"/"); err != nil {
+					return err
+				}
+			case "160000":
+				entries = append(entries, archiveEntry{path: path + "/", mode: treeEntry.Mode})
+			default:
+				blob, err := repository.ReadBlob(entrySHA)
+				if err != nil {
+					return err
+				}
+				entries = append(entries, archiveEntry{path: path, mode: treeEntry.Mode, content: blob.Data})
+			}
+		}
+		return nil
+	}
+	return entries, walk(treeSHA, "")
+}
+
+// archivePermissions gives an entry the permissions git archive does, its
+// default tar.umask of 002 taken off.
+func archivePermissions(mode string) int64 {
+	switch mode {
+	case "40000", "160000", "100755":
+		return 0775
+	case "120000":
+		return 0777
+	default:
+		return 0664
+	}
+}
+
+// writeTarArchive writes entries as a tar stream owned by root whose pax
+// global header, like git's, names the commit.
+func writeTarArchive(w io.Writer, entries []archiveEntry, prefix string, modified time.Time, commitSHA string) error {
+	archive := tar.NewWriter(w)
+	if commitSHA != "" {
+		header := &tar.Header{
+			Typeflag:   tar.TypeXGlobalHeader,
+			Name:       "pax_global_header",
+			PAXRecords: map[string]string{"comment": commitSHA},
+		}
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+	}
+	for _, entry := range entries {
+		header := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     prefix + entry.path,
+			Mode:     archivePermissions(entry.mode),
+			ModTime:  modified,
+			Uname:    "root",
+			Gname:    "root",
+		}
+		switch entry.mode {
+		case "40000", "160000":
+			header.Typeflag = tar.TypeDir
+		case "120000":
+			header.Typeflag, header.Linkname = tar.TypeSymlink, string(entry.content)
+		default:
+			header.Size = int64(len(entry.content))
+		}
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeReg {
+			if _, err := archive.Write(entry.content); err != nil {
+				return err
+			}
+		}
+	}
+	return archive.Close()
+}
+
+// writeZipArchive writes entries as a zip file with Unix modes, files
+// deflated and symlinks stored as their targets. The commit is
+// named in the archive comment.
+func writeZipArchive(w io.Writer, entries []archiveEntry, prefix string, modified time.Time, commitSHA string) error {
+	archive := zip.NewWriter(w)
+	if commitSHA != "" {
+		if err := archive.SetComment(commitSHA); err != nil {
+			return err
+		}
+	}
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: prefix + entry.path, Method: zip.Store, Modified: modified}
+		switch entry.mode {
+		case "40000", "160000":
+			header.SetMode(os.ModeDir | os.FileMode(archivePermissions(entry.mode)))
+		case "120000":
+			header.SetMode(os.ModeSymlink | os.FileMode(archivePermissions(entry.mode)))
+		default:
+			header.SetMode(os.FileMode(archivePermissions(entry.mode)))
+			if len(entry.content) > 0 {
+				header.Method = zip.Deflate
+			}
+		}
+		file, err := archive.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if _, err := file.Write(entry.content); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
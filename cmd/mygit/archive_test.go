@@ -0,0 +1,101 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// tarListing describes each member of a tar archive, with the contents of
+// files and the comment git keeps the commit in.
+func tarListing(t *testing.T, archive []byte) string {
+	t.Helper()
+	var listing strings.Builder
+	reader := tar.NewReader(bytes.NewReader(archive))
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return listing.String()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(&listing, "%c %o %v %v %q %q %q\n", header.Typeflag, header.Mode&0777, header.ModTime.Unix(), header.Name, header.Linkname, content, header.PAXRecords["comment"])
+	}
+}
+
+func TestArchiveMatchesGit(t *testing.T) {
+	requireGit(t)
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	writeFile(t, dir, "a", "a\n")
+	writeFile(t, dir, "d/b", "b\n")
+	writeFile(t, dir, "run.sh", "#!/bin/sh\n")
+	if err := os.Chmod(filepath.Join(dir, "run.sh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	mygit(t, dir, "add", ".")
+	mygit(t, dir, "commit", "-m", "one")
+	mygit(t, dir, "tag", "-a", "-m", "tag", "v1")
+	archive := func(program string, args ...string) []byte {
+		t.Helper()
+		if program == "mygit" {
+			return []byte(mygit(t, dir, append([]string{"archive"}, args...)...))
+		}
+		return []byte(runGit(t, dir, append([]string{"archive"}, args...)...))
+	}
+
+	for _, args := range [][]string{
+		{"HEAD"},
+		{"--prefix=project/", "v1"},
+		{"HEAD", "d"},
+	} {
+		if got, want := tarListing(t, archive("mygit", args...)), tarListing(t, archive("git", args...)); got != want {
+			t.Errorf("mygit archive %v:\n%v\ngit:\n%v", strings.Join(args, " "), got, want)
+		}
+	}
+	// git reads the commit back out of the archive.
+	command := exec.Command("git", "get-tar-commit-id")
+	command.Stdin = bytes.NewReader(archive("mygit", "HEAD"))
+	if id, err := command.Output(); err != nil || string(id) != mygit(t, dir, "rev-parse", "HEAD") {
+		t.Errorf("git get-tar-commit-id = %q, %v", id, err)
+	}
+
+	// Zip modes differ by design, but the files, links and exec bits don't.
+	zipped := archive("mygit", "--format=zip", "HEAD")
+	reader, err := zip.NewReader(bytes.NewReader(zipped), int64(len(zipped)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got strings.Builder
+	for _, file := range reader.File {
+		contents, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(contents)
+		contents.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(&got, "%v %v %v %q\n", file.Name, file.Mode().Type() == os.ModeSymlink, file.Mode()&0100 != 0, content)
+	}
+	want := "a false false \"a\\n\"\nd/ false true \"\"\nd/b false false \"b\\n\"\nlink true true \"a\"\nrun.sh false true \"#!/bin/sh\\n\"\n"
+	if got.String() != want {
+		t.Errorf("mygit archive --format=zip:\n%v\nwant:\n%v", got.String(), want)
+	}
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+	"github.com/codecrafters-io/git-starter-go/pkg/diff"
+)
+
+// blameVersion is a file as one commit has it.
+type blameVersion struct {
+	sha   string
+	lines []string
+}
+
+// blameSuspect is a line of the blamed file not yet accounted for: its
+// number in the final file and in the version of the commit suspected.
+type blameSuspect struct {
+	final int
+	line  int
+}
+
+// blameOptions are the output choices of blame.
+type blameOptions struct {
+	long, suppress, email bool
+}
+
+// blame shows, for each line of a file, the commit that last changed it,
+// its author and date. Without a revision the worktree's file is blamed,
+// and lines not yet committed are shown as such. Renames are not followed:
+// a line is the doing of the oldest commit it can be traced back to with
+// the file at the same path.
+func blame(args []string, stdout io.Writer) error {
+	var options blameOptions
+	lineRange := ""
+	positional := make([]string, 0, 2)
+	revision, dashDash := "", false
+	for index := 0; index < len(args); index++ {
+		arg := args[index]
+		switch {
+		case arg == "--":
+			if len(positional) > 1 || len(args)-index != 2 {
+				return failure.Usage("usage: git blame [<options>] [<rev>] [--] <file>")
+			}
+			if len(positional) == 1 {
+				revision = positional[0]
+			}
+			positional, dashDash = args[index+1:], true
+			index = len(args)
+		case arg == "-l":
+			options.long = true
+		case arg == "-s":
+			options.suppress = true
+		case arg == "-e" || arg == "--show-email":
+			options.email = true
+		case arg == "-L" && index+1 < len(args):
+			index++
+			lineRange = args[index]
+		case strings.HasPrefix(arg, "-L"):
+			lineRange = strings.TrimPrefix(arg, "-L")
+		case strings.HasPrefix(arg, "-"):
+			return failure.Usage("usage: git blame [<options>] [<rev>] [--] <file>")
+		default:
+			positional = append(positional, arg)
+		}
+	}
+	if !dashDash && len(positional) == 2 {
+		revision, positional = positional[0], positional[1:]
+	}
+	if len(positional) != 1 {
+		return failure.Usage("usage: git blame [<options>] [<rev>] [--] <file>")
+	}
+	path, err := worktreePath(positional[0])
+	if err != nil {
+		return err
+	}
+
+	// The worktree's file is blamed starting from HEAD, a revision's from
+	// the revision.
+	startName := revision
+	if startName == "" {
+		startName = "HEAD"
+	}
+	startSHA, err := resolveRevision(startName)
+	if err == nil {
+		startSHA, err = peelObject(startSHA, "commit")
+	}
+	if err != nil {
+		if revision == "" {
+			return failure.Fatalf("fatal: no such path '%v' in HEAD", path)
+		}
+		return failure.Fatalf("fatal: bad revision '%v'", revision)
+	}
+	versions := make(map[string]*blameVersion)
+	start, err := blameFileVersion(startSHA, path, versions)
+	if err != nil {
+		return err
+	}
+	if start == nil {
+		if revision == "" {
+			return failure.Fatalf("fatal: no such path '%v' in HEAD", path)
+		}
+		return failure.Fatalf("fatal: no such path %v in %v", path, revision)
+	}
+	final, suspects := start.lines, make([]blameSuspect, 0, len(start.lines))
+	if revision == "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return failure.Fatalf("fatal: Cannot lstat '%v': %w", path, err)
+		}
+		final = diff.SplitLines(repository.CleanContent(content))
+		for _, op := range diff.Lines(start.lines, final) {
+			if op.Kind == diff.Equal {
+				suspects = append(suspects, blameSuspect{final: op.NewLine, line: op.OldLine})
+			}
+		}
+	} else {
+		for index := range final {
+			suspects = append(suspects, blameSuspect{final: index, line: index})
+		}
+	}
+	first, last, err := parseLineRange(lineRange, len(final), path)
+	if err != nil {
+		return err
+	}
+
+	owners, err := blameLines(startSHA, suspects, path, versions)
+	if err != nil {
+		return err
+	}
+	return writeBlame(final, owners, first, last, options, stdout)
+}
+
+// parseLineRange reads -L <start>,<end>, where end may be +<count> and
+// either may be left out, as the 0-based bounds of the lines to show.
+func parseLineRange(value string, count int, path string) (int, int, error) {
+	if value == "" {
+		return 0, count, nil
+	}
+	startValue, endValue, _ := strings.Cut(value, ",")
+	start, end := 1, count
+	if startValue != "" {
+		number, err := strconv.Atoi(startValue)
+		if err != nil || number < 1 {
+			return 0, 0, failure.Fatal("fatal: invalid -L argument")
+		}
+		start = number
+	}
+	if start > count {
+		return 0, 0, failure.Fatalf("fatal: file %v has only %v %v", path, count, plural(count, "line"))
+	}
+	if endValue != "" {
+		number, err := strconv.Atoi(strings.TrimPrefix(endValue, "+"))
+		if err != nil || number < 1 {
+			return 0, 0, failure.Fatal("fatal: invalid -L argument")
+		}
+		if strings.HasPrefix(endValue, "+") {
+			number += start - 1
+		}
+		end = number
+	}
+	if end < start {
+		start, end = end, start
+	}
+	return start - 1, min(end, count), nil
+}
+
+// blameFileVersion returns the file at path in a commit, nil when the
+// commit has no such file.
+func blameFileVersion(commitSHA string, path string, versions map[string]*blameVersion) (*blameVersion, error) {
+	if version, ok := versions[commitSHA]; ok {
+		return version, nil
+	}
+	var version *blameVersion
+	if sha, err := resolveTreePath(commitSHA, path); err == nil {
+		if currentType, err := objectType(sha); err != nil {
+			return nil, err
+		} else if currentType == "blob" {
+			blob, err := repository.ReadBlob(sha)
+			if err != nil {
+				return nil, err
+			}
+			version = &blameVersion{sha: sha, lines: diff.SplitLines(blob.Data)}
+		}
+	}
+	versions[commitSHA] = version
+	return version, nil
+}
+
+// blameLines finds the commit each suspect line of startSHA's version came
+// from, walking history newest first. A commit passes a line on to the
+// first parent whose version, diffed against its own, still has it, and
+// the lines none of its parents have are its own doing. A parent
+// with the very same blob takes every line. The result is indexed by final
+// line number; lines never suspected are left nil.
+func blameLines(startSHA string, suspects []blameSuspect, path string, versions map[string]*blameVersion) ([]*Commit, error) {
+	owners := make([]*Commit, 0)
+	pending := map[string][]blameSuspect{startSHA: suspects}
+	queue := make([]*Commit, 0)
+	push := func(sha string) error {
+		commit, err := readCommit(sha)
+		if err != nil {
+			return err
+		}
+		queue = append(queue, commit)
+		return nil
+	}
+	if err := push(startSHA); err != nil {
+		return nil, err
+	}
+	for len(queue) > 0 {
+		sort.SliceStable(queue, func(i, j int) bool {
+			return parseSignature(queue[i].Committer).when.After(parseSignature(queue[j].Committer).when)
+		})
+		commit := queue[0]
+		queue = queue[1:]
+		remaining := pending[commit.sha]
+		delete(pending, commit.sha)
+		version, err := blameFileVersion(commit.sha, path, versions)
+		if err != nil {
+			return nil, err
+		}
+
+		parents := make([]*blameVersion, len(commit.Parents))
+		for index, parent := range commit.Parents {
+			if parents[index], err = blameFileVersion(parent, path, versions); err != nil {
+				return nil, err
+			}
+		}
+		passed := make(map[string][]blameSuspect)
+		for index, parent := range parents {
+			if parent != nil && parent.sha == version.sha {
+				passed[commit.Parents[index]], remaining = remaining, nil
+				break
+			}
+		}
+		for index, parent := range parents {
+			if parent == nil || len(remaining) == 0 {
+				continue
+			}
+			lines := make(map[int]int)
+			for _, op := range diff.Lines(parent.lines, version.lines) {
+				if op.Kind == diff.Equal {
+					lines[op.NewLine] = op.OldLine
+				}
+			}
+			kept := make([]blameSuspect, 0, len(remaining))
+			for _, suspect := range remaining {
+				if line, ok := lines[suspect.line]; ok {
+					passed[commit.Parents[index]] = append(passed[commit.Parents[index]], blameSuspect{final: suspect.final, line: line})
+				} else {
+					kept = append(kept, suspect)
+				}
+			}
+			remaining = kept
+		}
+
+		for _, suspect := range remaining {
+			for len(owners) <= suspect.final {
+				owners = append(owners, nil)
+			}
+			owners[suspect.final] = commit
+		}
+		// A parent already queued has its share added to what its other
+		// children passed on.
+		for _, parent := range commit.Parents {
+			if len(passed[parent]) == 0 {
+				continue
+			}
+			if _, queued := pending[parent]; !queued {
+				if err := push(parent); err != nil {
+					return nil, err
+				}
+			}
+			pending[parent] = append(pending[parent], passed[parent]...)
+		}
+	}
+	return owners, nil
+}
+
+// writeBlame prints lines first to last as git blame does:
+// "<commit> (<author> <date> <line>) <text>", the author and line columns
+// as wide as the longest shown. A root commit's name is marked with "^";
+// lines owned by no commit are "Not Committed Yet".
+func writeBlame(lines []string, owners []*Commit, first int, last int, options blameOptions, stdout io.Writer) error {
+	width := 2 * repository.Algorithm.Size()
+	if !options.long {
+		// Names are a column wider than abbreviated, leaving room for "^",
+		// and all as long as the longest one that is unambiguous.
+		width = 8
+		seen := make(map[string]bool)
+		for _, commit := range owners[min(first, len(owners)):min(last, len(owners))] {
+			if commit == nil || seen[commit.sha] {
+				continue
+			}
+			seen[commit.sha] = true
+			abbreviated, err := abbreviateSHA(commit.sha, 7)
+			if err != nil {
+				return err
+			}
+			width = max(width, len(abbreviated)+1)
+		}
+	}
+
+	type blameRow struct {
+		name, author, date string
+	}
+	rows := make([]blameRow, 0, last-first)
+	authorWidth := 0
+	now := time.Now()
+	for index := first; index < last; index++ {
+		var commit *Commit
+		if index < len(owners) {
+			commit = owners[index]
+		}
+		row := blameRow{name: zeroSHA()[:width], author: "Not Committed Yet", date: now.Format("2006-01-02 15:04:05 -0700")}
+		if options.email {
+			row.author = "<not.committed.yet>"
+		}
+		if commit != nil {
+			author := parseSignature(commit.Author)
+			row.name, row.author, row.date = commit.sha[:width], author.name, author.when.Format("2006-01-02 15:04:05 -0700")
+			if len(commit.Parents) == 0 {
+				row.name = "^" + commit.sha[:width-1]
+			}
+			if options.email {
+				row.author = "<" + author.email + ">"
+			}
+		}
+		rows = append(rows, row)
+		authorWidth = max(authorWidth, utf8.RuneCountInString(row.author))
+	}
+
+	output := bufio.NewWriter(stdout)
+	numberWidth := len(strconv.Itoa(last))
+	for index, row := range rows {
+		line := lines[first+index]
+		if !strings.HasSuffix(line, "\n") {
+			line += "\n"
+		}
+		if options.suppress {
+			fmt.Fprintf(output, "%v %*d) %v", row.name, numberWidth, first+index+1, line)
+			continue
+		}
+		padding := strings.Repeat(" ", authorWidth-utf8.RuneCountInString(row.author))
+		fmt.Fprintf(output, "%v (%v%v %v %*d) %v", row.name, row.author, padding, row.date, numberWidth, first+index+1, line)
+	}
+	return output.Flush()
+}
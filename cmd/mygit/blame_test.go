@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestBlameMatchesGit(t *testing.T) {
+	requireGit(t)
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	// Each commit a day after the last, by a different author.
+	version := 0
+	commit := func(content string, author string) {
+		t.Helper()
+		version++
+		t.Setenv("GIT_AUTHOR_NAME", author)
+		t.Setenv("GIT_AUTHOR_EMAIL", strings.ToLower(author)+"@example.com")
+		t.Setenv("GIT_AUTHOR_DATE", strconv.Itoa(1700000000+86400*version)+" +0100")
+		commitFile(t, dir, "f", content, "version "+strconv.Itoa(version))
+	}
+	commit("one\ntwo\nthree\nfour\nfive\n", "Ann")
+	commit("one\n2\nthree\nfour\nfive\nsix\n", "Bob")
+	commit("zero\none\n2\nthree\nfive\nsix\n", "Cy")
+	commit("zero\none\n2\nthree\nfive\nsix\nseven\neight\nnine\nten\n", "Di")
+	writeFile(t, dir, "other", "other\n")
+	mygit(t, dir, "add", "other")
+	commit("zero\none\nTWO\nthree\nfive\nsix\nseven\neight\nnine\nten\n", "Ed")
+
+	for _, args := range [][]string{
+		{"f"},
+		{"-s", "f"},
+		{"-l", "f"},
+		{"-e", "f"},
+		{"-L", "3,5", "f"},
+		{"-L2,+3", "f"},
+		{"HEAD~2", "--", "f"},
+		{"-s", "HEAD~1", "f"},
+		{"other"},
+	} {
+		args = append([]string{"blame"}, args...)
+		if got, want := mygit(t, dir, args...), runGit(t, dir, args...); got != want {
+			t.Errorf("mygit %v:\n%v\ngit:\n%v", strings.Join(args, " "), got, want)
+		}
+	}
+
+	// Lines not committed yet are blamed on no commit.
+	writeFile(t, dir, "f", "zero\nnew\n")
+	if got, want := mygit(t, dir, "blame", "-s", "f"), runGit(t, dir, "blame", "-s", "f"); got != want {
+		t.Errorf("mygit blame of a modified file:\n%v\ngit:\n%v", got, want)
+	}
+	if _, stderr, code := runIn(t, dir, "", "blame", "nope"); code != 128 || !strings.Contains(stderr, "no such path 'nope' in HEAD") {
+		t.Errorf("blame of a missing file: exit %v\n%v", code, stderr)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+	"github.com/codecrafters-io/git-starter-go/pkg/objects"
+)
+
+const catFileUsage = "usage: cat-file (-t | -s | -e | -p | <type>) <object> | cat-file (--batch | --batch-check)[=<format>] [--follow-symlinks]"
+
+func catFile(args []string, stdin io.Reader, stdout io.Writer) error {
+	followSymlinks := slices.Contains(args, "--follow-symlinks")
+	if followSymlinks {
+		args = slices.DeleteFunc(slices.Clone(args), func(arg string) bool { return arg == "--follow-symlinks" })
+	}
+	if len(args) == 1 && strings.HasPrefix(args[0], "--batch") {
+		mode, format, _ := strings.Cut(args[0], "=")
+		switch {
+		case mode != "--batch" && mode != "--batch-check":
+			return failure.Usage(catFileUsage)
+		case format == "":
+			format = "%(objectname) %(objecttype) %(objectsize)"
+		}
+		return catFileBatch(stdin, stdout, format, mode == "--batch", followSymlinks)
+	}
+	if followSymlinks {
+		return failure.Fatal("fatal: '--follow-symlinks' requires a batch mode")
+	}
+	if len(args) != 2 {
+		return failure.Usage(catFileUsage)
+	}
+
+	option, name := args[0], args[1]
+	sha, err := resolveRevision(name)
+	if err != nil {
+		if option == "-e" {
+			return errSilentFailure
+		}
+		return failure.Fatalf("fatal: Not a valid object name %v", name)
+	}
+	objectType, size, reader, err := repository.OpenObject(sha)
+	if err != nil {
+		if option == "-e" {
+			return errSilentFailure
+		}
+		return failure.Fatalf("fatal: Not a valid object name %v", name)
+	}
+	// Peeling swaps the reader for the peeled object's, which is the one to
+	// close by then.
+	defer func() { reader.Close() }()
+
+	switch option {
+	case "-t":
+		fmt.Fprintln(stdout, objectType)
+	case "-s":
+		fmt.Fprintln(stdout, size)
+	case "-e":
+	case "-p":
+		if objectType == objects.TypeTree {
+			content, err := io.ReadAll(reader)
+			if err != nil {
+				return err
+			}
+			tree, err := objects.ParseTree(repository.Algorithm, content)
+			if err != nil {
+				return err
+			}
+			return printTree(tree, "", lsTreeOptions{}, stdout)
+		}
+		_, err = io.Copy(stdout, reader)
+		return err
+	case objects.TypeBlob, objects.TypeTree, objects.TypeCommit, objects.TypeTag:
+		if objectType != option {
+			if sha, err = peelObject(sha, option); err != nil {
+				return failure.Fatalf("fatal: git cat-file %v: bad file", name)
+			}
+			_, _, peeled, err := repository.OpenObject(sha)
+			if err != nil {
+				return err
+			}
+			reader.Close()
+			reader = peeled
+		}
+		_, err = io.Copy(stdout, reader)
+		return err
+	default:
+		return failure.Usage(catFileUsage)
+	}
+	return nil
+}
+
+// catFileBatch answers one object name per stdin line. Each line gets a
+// header in format, followed by the content when withContent is set; names
+// that do not resolve report "<name> missing". Output is flushed after every
+// object so the batch can be driven interactively. With followSymlinks a
+// <tree-ish>:<path> name is followed through the tree's symlinks, and one
+// that leads nowhere gets git's "<status> <size>" line and the name, or for
+// a link out of the tree, where it points.
+func catFileBatch(stdin io.Reader, stdout io.Writer, format string, withContent bool, followSymlinks bool) error {
+	scanner := bufio.NewScanner(stdin)
+	writer := bufio.NewWriter(stdout)
+	for scanner.Scan() {
+		line := scanner.Text()
+		name, rest, _ := strings.Cut(line, " ")
+		if !strings.Contains(format, "%(rest)") {
+			name = line
+		}
+		sha, err := resolveRevision(name)
+		if treeish, path, ok := cutTreePath(name); followSymlinks && ok && treeish != "" {
+			followed, followErr := followTreePath(treeish, path)
+			sha, err = followed.sha, followErr
+			switch {
+			case err != nil || followed.status == "":
+			case followed.status == "missing":
+				err = errors.New(followed.status)
+			default:
+				if followed.status == "symlink" {
+					fmt.Fprintf(writer, "symlink %v\n%v\n", len(followed.link), followed.link)
+				} else {
+					fmt.Fprintf(writer, "%v %v\n%v\n", followed.status, len(name), name)
+				}
+				if err := writer.Flush(); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		var objectType string
+		var size int64
+		var reader io.ReadCloser
+		if err == nil {
+			objectType, size, reader, err = repository.OpenObject(sha)
+		}
+		if err != nil {
+			fmt.Fprintf(writer, "%v missing\n", name)
+			if err := writer.Flush(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		header := strings.NewReplacer(
+			"%(objectname)", sha,
+			"%(objecttype)", objectType,
+			"%(objectsize)", fmt.Sprint(size),
+			"%(rest)", rest,
+		).Replace(format)
+		fmt.Fprintln(writer, header)
+		if withContent {
+			if _, err := io.Copy(writer, reader); err != nil {
+				reader.Close()
+				return err
+			}
+			writer.WriteString("\n")
+		}
+		reader.Close()
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCatFilePeelsToRequestedType(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	commit := commitFile(t, dir, "a", "a\n", "first")
+	mygit(t, dir, "tag", "-a", "-m", "v1", "v1")
+
+	tree := strings.TrimSpace(mygit(t, dir, "rev-parse", "HEAD^{tree}"))
+	if got, want := mygit(t, dir, "cat-file", "tree", "v1"), mygit(t, dir, "cat-file", "tree", tree); got != want {
+		t.Errorf("cat-file tree v1 = %q, want the tree %q", got, want)
+	}
+	if got := mygit(t, dir, "cat-file", "commit", "v1"); !strings.HasPrefix(got, "tree "+tree+"\n") {
+		t.Errorf("cat-file commit v1 = %q", got)
+	}
+	if _, stderr, code := runIn(t, dir, "", "cat-file", "tag", commit); code != 128 || !strings.Contains(stderr, "bad file") {
+		t.Errorf("cat-file tag <commit>: exit %v\n%v", code, stderr)
+	}
+}
+
+func TestCatFileBatch(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	commitFile(t, dir, "a", "hello\n", "first")
+
+	got := mygitInput(t, dir, "HEAD:a\nnope\n", "cat-file", "--batch-check")
+	want := "ce013625030ba8dba906f756967f9e9ca394464a blob 6\nnope missing\n"
+	if got != want {
+		t.Errorf("cat-file --batch-check:\n%v\nwant:\n%v", got, want)
+	}
+	got = mygitInput(t, dir, "HEAD:a\n", "cat-file", "--batch")
+	if want := "ce013625030ba8dba906f756967f9e9ca394464a blob 6\nhello\n\n"; got != want {
+		t.Errorf("cat-file --batch = %q, want %q", got, want)
+	}
+	if _, _, code := runIn(t, dir, "", "cat-file", "-e", "HEAD:nope"); code != 1 {
+		t.Errorf("cat-file -e of a missing object exited %v", code)
+	}
+}
+
+func TestCatFileBatchFollowSymlinks(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	writeFile(t, dir, "d/e/f", "hi\n")
+	writeFile(t, dir, "f", "top\n")
+	for link, target := range map[string]string{
+		"dl": "d/e", "out": "../x", "abs": "/etc/passwd", "dangle": "nope",
+		"l1": "l2", "l2": "l1", "nd": "f/x", "d/up": "../f", "d/e/way": "../../..",
+	} {
+		if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mygit(t, dir, "add", ".")
+	mygit(t, dir, "commit", "-m", "links")
+
+	input := "HEAD:dl/f\nHEAD:d/up\nHEAD:out\nHEAD:abs\nHEAD:d/e/way/x\nHEAD:dangle\nHEAD:dl/../f\nHEAD:l1\nHEAD:nd\nHEAD:f/g\nHEAD:nothere\n"
+	want := "45b983be36b73c0788dc9cbcb76cbb80fc7bb057 blob 3\n" +
+		"bf1a1fdefa3c7f4b0180a75a951e9574662a8bc8 blob 4\n" +
+		"symlink 4\n../x\n" +
+		"symlink 11\n/etc/passwd\n" +
+		"symlink 4\n../x\n" +
+		"dangling 11\nHEAD:dangle\n" +
+		"dangling 12\nHEAD:dl/../f\n" +
+		"loop 7\nHEAD:l1\n" +
+		"notdir 7\nHEAD:nd\n" +
+		"notdir 8\nHEAD:f/g\n" +
+		"HEAD:nothere missing\n"
+	if got := mygitInput(t, dir, input, "cat-file", "--batch-check", "--follow-symlinks"); got != want {
+		t.Errorf("cat-file --batch-check --follow-symlinks:\n%v\nwant:\n%v", got, want)
+	}
+	// Without the option the link itself is named.
+	if got := mygitInput(t, dir, "HEAD:dl\n", "cat-file", "--batch-check"); !strings.HasSuffix(got, " blob 3\n") {
+		t.Errorf("cat-file --batch-check of a symlink = %q", got)
+	}
+	if _, _, code := runIn(t, dir, "", "cat-file", "-p", "--follow-symlinks", "HEAD:dl"); code != 128 {
+		t.Errorf("--follow-symlinks outside a batch exited %v", code)
+	}
+}
+
+func TestCatFileReflogRevisionWithPath(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	commitFile(t, dir, "a", "old\n", "first")
+	commitFile(t, dir, "a", "new\n", "second")
+
+	if got := mygit(t, dir, "cat-file", "-p", "HEAD@{1}:a"); got != "old\n" {
+		t.Errorf("cat-file -p HEAD@{1}:a = %q", got)
+	}
+	// The colons in the date belong to the reflog selector, not the path.
+	future := time.Now().Add(time.Hour).Format("2006-01-02 15:04:05")
+	if got := mygit(t, dir, "cat-file", "-p", "HEAD@{"+future+"}:a"); got != "new\n" {
+		t.Errorf("cat-file -p HEAD@{%v}:a = %q", future, got)
+	}
+	got := mygitInput(t, dir, "HEAD@{1}:a\n", "cat-file", "--batch", "--follow-symlinks")
+	if want := "3367afdbbf91e638efe983616377c60477cc6612 blob 4\nold\n\n"; got != want {
+		t.Errorf("cat-file --batch --follow-symlinks = %q, want %q", got, want)
+	}
+}
+
+func TestLargeBlobRoundTrip(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	// Larger than any buffer, so reading and writing have to stream.
+	content := bytes.Repeat([]byte("0123456789abcdef\x00\xff"), 1<<20)
+	if err := os.WriteFile(filepath.Join(dir, "big"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	summer := sha1.New()
+	fmt.Fprintf(summer, "blob %v\x00", len(content))
+	summer.Write(content)
+	want := hex.EncodeToString(summer.Sum(nil))
+
+	if got := strings.TrimSpace(mygit(t, dir, "hash-object", "-w", "big")); got != want {
+		t.Fatalf("hash-object -w big = %v, want %v", got, want)
+	}
+	if got := mygit(t, dir, "cat-file", "-s", want); got != fmt.Sprintf("%v\n", len(content)) {
+		t.Errorf("cat-file -s = %q", got)
+	}
+	if got := mygit(t, dir, "cat-file", "blob", want); got != string(content) {
+		t.Errorf("cat-file blob gave %v bytes that differ from the %v written", len(got), len(content))
+	}
+	tree := strings.TrimSpace(mygit(t, dir, "write-tree"))
+	if got := mygit(t, dir, "ls-tree", tree); got != "100644 blob "+want+"\tbig\n" {
+		t.Errorf("ls-tree of the written tree = %q", got)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+)
+
+// checkIgnore prints each path that an ignore rule excludes, or with -v the
+// deciding rule for each path as "<source>:<line>:<pattern>\t<path>". Tracked
+// paths are never reported unless --no-index is given. It fails silently when
+// no path matched.
+func checkIgnore(args []string, stdout io.Writer) error {
+	verbose, quiet, nonMatching, noIndex := false, false, false, false
+	paths := make([]string, 0, len(args))
+	for index, arg := range args {
+		if arg == "--" {
+			paths = append(paths, args[index+1:]...)
+			break
+		}
+		switch arg {
+		case "-v", "--verbose":
+			verbose = true
+		case "-q", "--quiet":
+			quiet = true
+		case "-n", "--non-matching":
+			nonMatching = true
+		case "--no-index":
+			noIndex = true
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return failure.Usagef("error: unknown option `%v'", strings.TrimLeft(arg, "-"))
+			}
+			paths = append(paths, arg)
+		}
+	}
+	switch {
+	case len(paths) == 0:
+		return failure.Fatal("fatal: no path specified")
+	case quiet && len(paths) > 1:
+		return failure.Fatal("fatal: --quiet is only valid with a single pathname")
+	case quiet && verbose:
+		return failure.Fatal("fatal: cannot have both --quiet and --verbose")
+	case nonMatching && !verbose:
+		return failure.Fatal("fatal: --non-matching is only valid with --verbose")
+	}
+
+	ignores, err := repository.Ignores()
+	if err != nil {
+		return err
+	}
+	indexed := make(map[string]bool)
+	if !noIndex {
+		entries, err := readIndex()
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			indexed[entry.path] = true
+		}
+	}
+
+	matchedAny := false
+	for _, arg := range paths {
+		path, err := worktreePath(arg)
+		if err != nil {
+			return err
+		}
+		isDir := strings.HasSuffix(arg, "/")
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			isDir = true
+		}
+
+		pattern := ignores.Match(path, isDir)
+		if indexed[path] {
+			pattern = nil
+		}
+		if pattern != nil && (verbose || !pattern.Negated()) {
+			matchedAny = true
+		}
+		switch {
+		case quiet:
+		case verbose && pattern != nil:
+			fmt.Fprintf(stdout, "%v:%v:%v\t%v\n", pattern.Source, pattern.Line, pattern.Text, arg)
+		case verbose && nonMatching:
+			fmt.Fprintf(stdout, "::\t%v\n", arg)
+		case pattern != nil && !pattern.Negated():
+			fmt.Fprintln(stdout, arg)
+		}
+	}
+	if !matchedAny {
+		return errSilentFailure
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIgnoreRulesInCheckIgnoreAndWriteTree(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	writeFile(t, dir, ".gitignore", "*.log\n!keep.log\nbuild/\n/root-only\n**/deep/*.tmp\n")
+	writeFile(t, dir, "sub/.gitignore", "local\n")
+	writeFile(t, dir, ".git/info/exclude", "secret\n")
+	paths := []string{"a.log", "keep.log", "sub/build/x", "root-only", "sub/root-only", "sub/x/deep/a.tmp", "sub/local", "secret", "sub/secret", "ok"}
+	for _, path := range paths {
+		writeFile(t, dir, path, path+"\n")
+	}
+
+	want := "a.log\nsub/build/x\nroot-only\nsub/x/deep/a.tmp\nsub/local\nsecret\nsub/secret\n"
+	if got := mygit(t, dir, append([]string{"check-ignore"}, paths...)...); got != want {
+		t.Errorf("check-ignore:\n%v\nwant:\n%v", got, want)
+	}
+	want = ".gitignore:2:!keep.log\tkeep.log\nsub/.gitignore:1:local\tsub/local\n.git/info/exclude:1:secret\tsecret\n::\tok\n"
+	if got := mygit(t, dir, "check-ignore", "-v", "-n", "keep.log", "sub/local", "secret", "ok"); got != want {
+		t.Errorf("check-ignore -v -n:\n%v\nwant:\n%v", got, want)
+	}
+	if _, _, code := runIn(t, dir, "", "check-ignore", "ok"); code != 1 {
+		t.Errorf("check-ignore of a path nothing ignores exited %v", code)
+	}
+
+	tree := strings.TrimSpace(mygit(t, dir, "write-tree"))
+	want = ".gitignore\nkeep.log\nok\nsub/.gitignore\nsub/root-only\n"
+	if got := mygit(t, dir, "ls-tree", "-r", "--name-only", tree); got != want {
+		t.Errorf("write-tree stored:\n%v\nwant:\n%v", got, want)
+	}
+}
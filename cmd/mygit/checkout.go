@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+)
+
+func checkout(args []string, stderr io.Writer, isSwitch bool) error {
+	force, detach := false, false
+	targets := make([]string, 0, 1)
+	for _, arg := range args {
+		switch arg {
+		case "-f", "--force":
+			force = true
+		case "--detach", "-d":
+			detach = true
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return checkoutUsage(isSwitch)
+			}
+			targets = append(targets, arg)
+		}
+	}
+	if len(targets) != 1 {
+		return checkoutUsage(isSwitch)
+	}
+	target := targets[0]
+
+	branchRef := "refs/heads/" + target
+	commitSHA, err := repository.Refs.Read(branchRef)
+	onBranch := err == nil && !detach
+	if err != nil {
+		if isSwitch && !detach {
+			return failure.Fatalf("fatal: invalid reference: %v", target)
+		}
+		if commitSHA, err = resolveRevision(target); err == nil {
+			commitSHA, err = peelObject(commitSHA, "commit")
+		}
+		if err != nil {
+			return fmt.Errorf("error: pathspec '%v' did not match any file(s) known to git", target)
+		}
+	}
+	treeSHA, err := commitTreeSHA(commitSHA)
+	if err != nil {
+		return err
+	}
+
+	currentRef, currentIsSymref, err := readHeadSymref()
+	if err != nil {
+		return err
+	}
+	if onBranch && currentIsSymref && currentRef == branchRef {
+		fmt.Fprintf(stderr, "Already on '%v'\n", target)
+		return nil
+	}
+
+	headSHA, err := resolveHead()
+	if err != nil {
+		return err
+	}
+	if err := switchWorktree(treeSHA, force, "checkout"); err != nil {
+		return err
+	}
+
+	from := headSHA
+	if currentIsSymref {
+		from = strings.TrimPrefix(currentRef, "refs/heads/")
+	}
+	action := "checkout: moving from " + from + " to " + target
+	if onBranch {
+		if err := repository.Refs.Write("HEAD", "ref: "+branchRef); err != nil {
+			return err
+		}
+		if err := logRefUpdate("HEAD", headSHA, commitSHA, action); err != nil {
+			return err
+		}
+		fmt.Fprintf(stderr, "Switched to branch '%v'\n", target)
+		return nil
+	}
+	if err := repository.Refs.Write("HEAD", commitSHA); err != nil {
+		return err
+	}
+	if err := logRefUpdate("HEAD", headSHA, commitSHA, action); err != nil {
+		return err
+	}
+	commit, err := readCommit(commitSHA)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stderr, "HEAD is now at %v %v\n", commitSHA[:7], commit.subject())
+	return nil
+}
+
+func checkoutUsage(isSwitch bool) error {
+	if isSwitch {
+		return failure.Usage("usage: switch [-f] [--detach] <branch>")
+	}
+	return failure.Usage("usage: checkout [-f] [--detach] <branch|commit>")
+}
+
+// switchWorktree moves the index and working tree from the HEAD tree to
+// treeSHA. Paths that are identical in both trees keep any local changes;
+// paths that differ must be unmodified unless force is set, in which case all
+// tracked paths are reset to the target. operation, checkout or merge, names
+// what would overwrite local changes.
+func switchWorktree(treeSHA string, force bool, operation string) error {
+	headFiles, err := headTreeFiles()
+	if err != nil {
+		return err
+	}
+	targetFiles, err := flattenTree(treeSHA)
+	if err != nil {
+		return err
+	}
+	entries, err := readIndex()
+	if err != nil {
+		return err
+	}
+	indexed := make(map[string]IndexEntry, len(entries))
+	for _, entry := range entries {
+		indexed[entry.path] = entry
+	}
+
+	paths := make(map[string]bool)
+	for path := range headFiles {
+		paths[path] = true
+	}
+	for path := range targetFiles {
+		paths[path] = true
+	}
+	if force {
+		for path := range indexed {
+			paths[path] = true
+		}
+	}
+
+	changed := make([]string, 0)
+	dirty := make([]string, 0)
+	untracked := make([]string, 0)
+	for path := range paths {
+		headFile, inHead := headFiles[path]
+		targetFile, inTarget := targetFiles[path]
+		if !force && inHead == inTarget && sameTreeFile(headFile, targetFile) {
+			continue
+		}
+		entry, inIndex := indexed[path]
+		if !force && inIndex == inTarget && (!inIndex || sameTreeFile(treeFileFromIndex(entry), targetFile)) {
+			// The index already holds the target version; leave it and the
+			// working tree copy alone.
+			continue
+		}
+		changed = append(changed, path)
+		if force {
+			continue
+		}
+
+		if !inIndex {
+			if inTarget && untrackedInTheWay(path, indexed) {
+				untracked = append(untracked, path)
+			}
+			continue
+		}
+		if !inHead || !sameTreeFile(headFile, treeFileFromIndex(entry)) {
+			dirty = append(dirty, path)
+			continue
+		}
+		modified, err := worktreeModified(entry)
+		if err != nil {
+			return err
+		}
+		if modified {
+			dirty = append(dirty, path)
+		}
+	}
+	if err := updateWorktree(operation, dirty, untracked, changed, targetFiles, indexed); err != nil {
+		return err
+	}
+	updated := make([]IndexEntry, 0, len(indexed))
+	for _, entry := range indexed {
+		updated = append(updated, entry)
+	}
+	return writeIndex(updated)
+}
+
+// updateWorktree refuses to go on when dirty or untracked paths would be
+// overwritten, and otherwise writes the target version of each changed path
+// to the working tree and to the indexed entries, which the caller saves.
+func updateWorktree(operation string, dirty []string, untracked []string, changed []string, targetFiles map[string]TreeFile, indexed map[string]IndexEntry) error {
+	action := "switch branches"
+	if operation != "checkout" {
+		action = operation
+	}
+	if len(dirty) > 0 {
+		return overwriteError("Your local changes to the following files would be overwritten by "+operation, dirty,
+			"Please commit your changes or stash them before you "+action+".")
+	}
+	if len(untracked) > 0 {
+		return overwriteError("The following untracked working tree files would be overwritten by "+operation, untracked,
+			"Please move or remove them before you "+action+".")
+	}
+
+	// Removals go first, so a file replacing a directory, or a directory
+	// replacing a file, finds the way clear.
+	sort.Strings(changed)
+	for _, path := range changed {
+		if _, inTarget := targetFiles[path]; !inTarget {
+			delete(indexed, path)
+			if err := removeWorktreeFile(path); err != nil {
+				return err
+			}
+		}
+	}
+	for _, path := range changed {
+		targetFile, inTarget := targetFiles[path]
+		if !inTarget {
+			continue
+		}
+		if err := writeWorktreeFile(path, targetFile); err != nil {
+			return err
+		}
+		entry, err := indexEntryForTreeFile(path, targetFile)
+		if err != nil {
+			return err
+		}
+		indexed[path] = entry
+	}
+	return nil
+}
+
+// untrackedInTheWay reports whether writing a path not in the index would
+// overwrite something untracked: a file, or a directory holding anything
+// but tracked files, which go with it.
+func untrackedInTheWay(path string, indexed map[string]IndexEntry) bool {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return false
+	}
+	if !info.IsDir() {
+		return true
+	}
+	found := false
+	filepath.WalkDir(path, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() && indexed[name].path == "" {
+			found = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return found
+}
+
+func overwriteError(message string, paths []string, advice string) error {
+	sort.Strings(paths)
+	return fmt.Errorf("error: %v:\n\t%v\n%v\nAborting", message, strings.Join(paths, "\n\t"), advice)
+}
+
+func sameTreeFile(a TreeFile, b TreeFile) bool {
+	return a.mode == b.mode && bytes.Equal(a.hash, b.hash)
+}
+
+func treeFileFromIndex(entry IndexEntry) TreeFile {
+	return TreeFile{mode: strconv.FormatUint(uint64(entry.mode), 8), hash: entry.hash}
+}
+
+// worktreeModified reports whether the working tree copy of a tracked path no
+// longer matches its index entry.
+func worktreeModified(entry IndexEntry) (bool, error) {
+	info, err := os.Lstat(entry.path)
+	if err != nil {
+		return true, nil
+	}
+	if entry.mode != 0160000 && indexEntryMatchesStat(entry, info) && os.FileMode(entry.mode)&0111 == info.Mode()&0111 {
+		return false, nil
+	}
+	file, err := worktreeEntryFile(entry, info)
+	if err != nil {
+		return false, err
+	}
+	return !sameTreeFile(file, treeFileFromIndex(entry)), nil
+}
+
+// checkoutTreeFiles writes every file of a tree into the working tree and
+// records them in a fresh index, as after a clone.
+func checkoutTreeFiles(treeSHA string) error {
+	files, err := flattenTree(treeSHA)
+	if err != nil {
+		return err
+	}
+	entries := make([]IndexEntry, 0, len(files))
+	for path, file := range files {
+		if err := writeWorktreeFile(path, file); err != nil {
+			return err
+		}
+		entry, err := indexEntryForTreeFile(path, file)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+	}
+	return writeIndex(entries)
+}
+
+func indexEntryForTreeFile(path string, file TreeFile) (IndexEntry, error) {
+	mode, err := strconv.ParseUint(file.mode, 8, 32)
+	if err != nil {
+		return IndexEntry{}, fmt.Errorf("Invalid mode %v for %v", file.mode, path)
+	}
+	return statIndexEntry(path, uint32(mode), file.hash)
+}
+
+// writeWorktreeFile materializes a blob (or gitlink directory) at path with
+// the permissions implied by its tree mode.
+func writeWorktreeFile(path string, file TreeFile) error {
+	if err := makeParentDirs(path); err != nil {
+		return err
+	}
+	if info, err := os.Lstat(path); err == nil && (!info.IsDir() || file.mode != "160000") {
+		if err := os.RemoveAll(path); err != nil {
+			return fmt.Errorf("Failed to remove %v: %w", path, err)
+		}
+	}
+	if file.mode == "160000" {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			return fmt.Errorf("Failed to create directory %v: %w", path, err)
+		}
+		return nil
+	}
+
+	blob, err := repository.ReadBlob(hex.EncodeToString(file.hash))
+	if err != nil {
+		return err
+	}
+	if file.mode == "120000" {
+		if err := os.Symlink(string(blob.Data), path); err != nil {
+			return fmt.Errorf("Failed to create symlink %v: %w", path, err)
+		}
+		return nil
+	}
+	perm := os.FileMode(0644)
+	if file.mode == "100755" {
+		perm = 0755
+	}
+	if err := os.WriteFile(path, repository.SmudgeContent(blob.Data), perm); err != nil {
+		return fmt.Errorf("Failed to create file %v: %w", path, err)
+	}
+	return nil
+}
+
+// makeParentDirs creates the directories leading to path. A symlink in the
+// way is replaced by a directory rather than followed, so nothing is ever
+// written through a link to somewhere outside the worktree.
+func makeParentDirs(path string) error {
+	dir := filepath.Dir(path)
+	if dir == "." {
+		return nil
+	}
+	current := ""
+	for _, name := range strings.Split(dir, string(filepath.Separator)) {
+		current = filepath.Join(current, name)
+		info, err := os.Lstat(current)
+		if err == nil && info.IsDir() {
+			continue
+		}
+		if err == nil && info.Mode()&fs.ModeSymlink != 0 {
+			if err := os.Remove(current); err != nil {
+				return fmt.Errorf("Failed to remove %v: %w", current, err)
+			}
+		}
+		if err := os.Mkdir(current, 0755); err != nil {
+			return fmt.Errorf("Failed to create directory %v: %w", current, err)
+		}
+	}
+	return nil
+}
+
+// removeWorktreeFile deletes a tracked path and any parent directories it
+// leaves empty.
+func removeWorktreeFile(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Failed to remove %v: %w", path, err)
+	}
+	for dir := filepath.Dir(path); dir != "."; dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckoutRefusesUnsafePaths(t *testing.T) {
+	for _, name := range []string{".git", ".GIT", "..", ".", "a/b"} {
+		t.Run(name, func(t *testing.T) {
+			dir := filepath.Join(setupTest(t), "work")
+			if err := os.Mkdir(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			mygit(t, dir, "init")
+			head := commitFile(t, dir, "f", "one\n", "one")
+
+			hook := strings.TrimSpace(mygitInput(t, dir, "#!/bin/sh\necho PWNED\n", "hash-object", "-w", "--stdin"))
+			hooks := writeRawTree(t, dir, [3]string{"100755", "pre-commit", hook})
+			escape := writeRawTree(t, dir, [3]string{"40000", "hooks", hooks})
+			root := writeRawTree(t, dir, [3]string{"40000", name, escape}, [3]string{"100644", "f", hook})
+			evil := strings.TrimSpace(mygit(t, dir, "commit-tree", root, "-p", head, "-m", "evil"))
+			mygit(t, dir, "update-ref", "refs/heads/evil", evil)
+
+			_, stderr, code := runIn(t, dir, "", "checkout", "evil")
+			if code == 0 || !strings.Contains(stderr, "invalid path") {
+				t.Errorf("checkout exited %v: %q", code, stderr)
+			}
+			for _, path := range []string{".git/hooks/pre-commit", ".GIT/hooks/pre-commit", "../hooks/pre-commit", "hooks/pre-commit", "a/b/hooks/pre-commit"} {
+				if _, err := os.Lstat(filepath.Join(dir, path)); err == nil {
+					t.Errorf("checkout wrote %v", path)
+				}
+			}
+			if got := mygit(t, dir, "rev-parse", "HEAD"); got != head+"\n" {
+				t.Errorf("HEAD moved to %v", got)
+			}
+			if content, err := os.ReadFile(filepath.Join(dir, "f")); err != nil || string(content) != "one\n" {
+				t.Errorf("f = %q, %v", content, err)
+			}
+		})
+	}
+}
+
+func TestCheckoutDoesNotWriteThroughSymlinks(t *testing.T) {
+	dir := filepath.Join(setupTest(t), "work")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	mygit(t, dir, "init")
+	head := commitFile(t, dir, "f", "one\n", "one")
+
+	// A symlink and a directory of the same name, so the link is in place
+	// when the file under the directory is written.
+	link := strings.TrimSpace(mygitInput(t, dir, "..", "hash-object", "-w", "--stdin"))
+	blob := strings.TrimSpace(mygitInput(t, dir, "escaped\n", "hash-object", "-w", "--stdin"))
+	sub := writeRawTree(t, dir, [3]string{"100644", "x", blob})
+	root := writeRawTree(t, dir, [3]string{"120000", "a", link}, [3]string{"40000", "a", sub})
+	evil := strings.TrimSpace(mygit(t, dir, "commit-tree", root, "-p", head, "-m", "evil"))
+	mygit(t, dir, "update-ref", "refs/heads/evil", evil)
+
+	runIn(t, dir, "", "checkout", "evil")
+	if _, err := os.Lstat(filepath.Join(dir, "../x")); err == nil {
+		t.Error("checkout wrote through the symlink")
+	}
+}
+
+func TestCheckoutSwitchesBranchesWithModesAndSymlinks(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	commitFile(t, dir, "a", "a\n", "one")
+	mygit(t, dir, "branch", "other")
+	writeFile(t, dir, "run", "#!/bin/sh\n")
+	if err := os.Chmod(filepath.Join(dir, "run"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, dir, "d/x", "x\n")
+	mygit(t, dir, "add", ".")
+	mygit(t, dir, "commit", "-m", "two")
+
+	if _, stderr, code := runIn(t, dir, "", "checkout", "other"); code != 0 || stderr != "Switched to branch 'other'\n" {
+		t.Fatalf("checkout other: exit %v\n%v", code, stderr)
+	}
+	for _, name := range []string{"run", "link", "d"} {
+		if _, err := os.Lstat(filepath.Join(dir, name)); err == nil {
+			t.Errorf("%v is left after switching to a branch without it", name)
+		}
+	}
+
+	mygit(t, dir, "checkout", "main")
+	if info, err := os.Stat(filepath.Join(dir, "run")); err != nil || info.Mode().Perm()&0111 == 0 {
+		t.Errorf("run was not checked out executable: %v, %v", info, err)
+	}
+	if target, err := os.Readlink(filepath.Join(dir, "link")); err != nil || target != "a" {
+		t.Errorf("link was not checked out as a symlink to a: %q, %v", target, err)
+	}
+	if got := mygit(t, dir, "status", "-s"); got != "" {
+		t.Errorf("status after checkout:\n%v", got)
+	}
+
+	// A local change that the switch would overwrite stops it, unless forced.
+	commitFile(t, dir, "a", "b\n", "three")
+	writeFile(t, dir, "a", "dirty\n")
+	_, stderr, code := runIn(t, dir, "", "checkout", "other")
+	if code != 1 || !strings.Contains(stderr, "Your local changes to the following files would be overwritten by checkout:\n\ta\n") {
+		t.Errorf("checkout over a local change: exit %v\n%v", code, stderr)
+	}
+	if got := strings.TrimSpace(mygit(t, dir, "symbolic-ref", "HEAD")); got != "refs/heads/main" {
+		t.Errorf("the refused checkout moved HEAD to %v", got)
+	}
+	mygit(t, dir, "checkout", "-f", "other")
+	if content, err := os.ReadFile(filepath.Join(dir, "a")); err != nil || string(content) != "a\n" {
+		t.Errorf("a after checkout -f = %q, %v", content, err)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+	"github.com/codecrafters-io/git-starter-go/pkg/ignore"
+)
+
+// cleanMode says which files not in the index clean removes.
+type cleanMode int
+
+const (
+	cleanUntracked cleanMode = iota // those no ignore rule excludes
+	cleanAll                        // -x: ignored ones as well
+	cleanIgnored                    // -X: only ignored ones
+)
+
+// clean removes files the index does not track from the worktree, or with
+// -n lists what it would remove. Ignored files are left alone unless -x
+// takes them too, or -X takes only them, sparing new untracked source.
+// Untracked directories are only removed with -d, or when named; nested
+// repositories are never touched. clean.requireForce, true unless set,
+// makes it refuse to remove anything without -f.
+func clean(args []string, stdout io.Writer) error {
+	dryRun, force, directories, quiet := false, false, false, false
+	mode, modeFlag := cleanUntracked, ""
+	pathspecs := make([]string, 0, len(args))
+	for index := 0; index < len(args); index++ {
+		switch arg := args[index]; {
+		case arg == "--":
+			pathspecs = append(pathspecs, args[index+1:]...)
+			index = len(args)
+		case arg == "-n" || arg == "--dry-run":
+			dryRun = true
+		case arg == "-f" || arg == "--force":
+			force = true
+		case arg == "-d":
+			directories = true
+		case arg == "-q" || arg == "--quiet":
+			quiet = true
+		case arg == "-x" || arg == "-X":
+			if modeFlag != "" && modeFlag != arg {
+				return failure.Fatal("fatal: -x and -X cannot be used together")
+			}
+			mode, modeFlag = cleanAll, arg
+			if arg == "-X" {
+				mode = cleanIgnored
+			}
+		case strings.HasPrefix(arg, "-"):
+			return failure.Usage("usage: git clean [-d] [-f] [-n] [-q] [-x | -X] [--] [<pathspec>...]")
+		default:
+			pathspecs = append(pathspecs, arg)
+		}
+	}
+
+	cfg, err := repository.Config()
+	if err != nil {
+		return err
+	}
+	requireForce, _ := cfg.Get("clean.requireForce")
+	switch strings.ToLower(requireForce) {
+	case "false", "no", "off", "0":
+	default:
+		if !force && !dryRun {
+			return failure.Fatal("fatal: clean.requireForce defaults to true and neither -i, -n, nor -f given; refusing to clean")
+		}
+	}
+
+	entries, err := readIndex()
+	if err != nil {
+		return err
+	}
+	indexed := make(map[string]IndexEntry, len(entries))
+	for _, entry := range entries {
+		indexed[entry.path] = entry
+	}
+	roots := []string{"."}
+	if len(pathspecs) > 0 {
+		roots = roots[:0]
+		for _, arg := range pathspecs {
+			path, err := worktreePath(arg)
+			if err != nil {
+				return err
+			}
+			roots = append(roots, path)
+		}
+	} else if workTreePrefix != "" {
+		roots = []string{filepath.ToSlash(workTreePrefix)}
+	}
+	paths, err := cleanablePaths(roots, indexed, mode, directories)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		if dryRun {
+			fmt.Fprintf(stdout, "Would remove %v\n", displayPath(path))
+			continue
+		}
+		if err := os.RemoveAll(strings.TrimSuffix(path, "/")); err != nil {
+			return fmt.Errorf("warning: failed to remove %v: %w", displayPath(path), err)
+		}
+		if !quiet {
+			fmt.Fprintf(stdout, "Removing %v\n", displayPath(path))
+		}
+	}
+	return nil
+}
+
+// cleanablePaths lists what clean removes under roots: files, and with
+// directories whole untracked directories as "dir/" when everything in
+// them goes. A directory that would lose only part of its contents is
+// entered instead.
+func cleanablePaths(roots []string, indexed map[string]IndexEntry, mode cleanMode, directories bool) ([]string, error) {
+	ignores, err := repository.Ignores()
+	if err != nil {
+		return nil, err
+	}
+	trackedDirs := make(map[string]bool)
+	for path := range indexed {
+		for parent := filepath.Dir(path); parent != "."; parent = filepath.Dir(parent) {
+			trackedDirs[parent] = true
+		}
+	}
+	removes := func(path string, isDir bool) bool {
+		ignored := ignores.Ignored(path, isDir)
+		return mode == cleanAll || ignored == (mode == cleanIgnored)
+	}
+
+	found := make(map[string]bool)
+	for _, root := range roots {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && path == root {
+					return nil
+				}
+				return err
+			}
+			path = filepath.ToSlash(path)
+			if !d.IsDir() {
+				if _, ok := indexed[path]; !ok && removes(path, false) {
+					found[path] = true
+				}
+				return nil
+			}
+			switch {
+			case d.Name() == ".git":
+				return filepath.SkipDir
+			case path == "." || trackedDirs[path]:
+				return nil
+			}
+			if _, ok := indexed[path]; ok {
+				// A gitlink's files belong to its own repository.
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(path, ".git")); err == nil {
+				return filepath.SkipDir
+			}
+			// Under -X a directory holding nothing but ignored files counts
+			// as ignored itself.
+			whole := removes(path, true) && removesEverything(path, ignores, mode)
+			if mode == cleanIgnored && !whole {
+				whole = hasFiles(path) && removesEverything(path, ignores, mode)
+			}
+			switch {
+			case (directories || path == root) && whole:
+				found[path+"/"] = true
+				return filepath.SkipDir
+			case directories || path == root:
+				return nil
+			case mode == cleanIgnored && !whole:
+				// Only -X looks for ignored files in untracked directories
+				// it cannot remove.
+				return nil
+			}
+			return filepath.SkipDir
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	paths := make([]string, 0, len(found))
+	for path := range found {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// removesEverything reports whether clean in mode would take every file in
+// an untracked directory, and no nested repository is in the way.
+func removesEverything(dir string, ignores *ignore.Matcher, mode cleanMode) bool {
+	everything := true
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.Name() == ".git" {
+			everything = false
+			return filepath.SkipAll
+		}
+		if path == dir || mode == cleanAll {
+			return nil
+		}
+		if !d.IsDir() && ignores.Ignored(filepath.ToSlash(path), false) != (mode == cleanIgnored) {
+			everything = false
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return everything
+}
+
+func hasFiles(dir string) bool {
+	found := false
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			found = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return found
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCleanIgnoredOnly(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	commitFile(t, dir, ".gitignore", "*.o\nbuild/\n", "ignore build output")
+	writeFile(t, dir, "main.o", "object\n")
+	writeFile(t, dir, "build/out", "artifact\n")
+	writeFile(t, dir, "main.c", "int main;\n")
+
+	if _, stderr, code := runIn(t, dir, "", "clean", "-X"); code != 128 || stderr == "" {
+		t.Errorf("clean without -f: exit %v, stderr %q", code, stderr)
+	}
+	if got, want := mygit(t, dir, "clean", "-n", "-X", "-d"), "Would remove build/\nWould remove main.o\n"; got != want {
+		t.Errorf("clean -n -X -d: got %q, want %q", got, want)
+	}
+	if got, want := mygit(t, dir, "clean", "-f", "-X"), "Removing main.o\n"; got != want {
+		t.Errorf("clean -f -X: got %q, want %q", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "build", "out")); err != nil {
+		t.Error("clean -X without -d removed an ignored directory")
+	}
+	mygit(t, dir, "clean", "-f", "-X", "-d")
+	for name, kept := range map[string]bool{"main.o": false, "build": false, "main.c": true, ".gitignore": true} {
+		if _, err := os.Stat(filepath.Join(dir, name)); (err == nil) != kept {
+			t.Errorf("after clean -X -d, %v exists: %v", name, err == nil)
+		}
+	}
+	if got, want := mygit(t, dir, "clean", "-f"), "Removing main.c\n"; got != want {
+		t.Errorf("clean -f: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/atomicfile"
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+	"github.com/codecrafters-io/git-starter-go/internal/pack"
+	"github.com/codecrafters-io/git-starter-go/pkg/objects"
+)
+
+// clone copies a remote repository into a new directory and checks out its
+// default branch. With --depth only that branch is fetched, its history cut
+// the given number of commits down. Progress is shown on a terminal, or
+// with --progress, and never with -q. A clone that fails or is
+// interrupted before its branch is checked out leaves nothing behind.
+func clone(ctx context.Context, args []string, stderr io.Writer) (err error) {
+	depth := 0
+	quiet, forceProgress := false, false
+	positional := make([]string, 0, 2)
+	for index := 0; index < len(args); index++ {
+		arg := args[index]
+		value, isDepth := strings.CutPrefix(arg, "--depth=")
+		if arg == "--depth" && index+1 < len(args) {
+			index++
+			value, isDepth = args[index], true
+		}
+		switch {
+		case isDepth:
+			var err error
+			if depth, err = parseDepth(value); err != nil {
+				return err
+			}
+		case arg == "-q" || arg == "--quiet":
+			quiet = true
+		case arg == "--progress":
+			forceProgress = true
+		case strings.HasPrefix(arg, "-"):
+			return failure.Usage("usage: clone [-q] [--progress] [--depth <depth>] <url> [<directory>]")
+		default:
+			positional = append(positional, arg)
+		}
+	}
+	if len(positional) < 1 || len(positional) > 2 {
+		return failure.Usage("usage: clone [-q] [--progress] [--depth <depth>] <url> [<directory>]")
+	}
+	repoURL := strings.TrimSuffix(positional[0], "/")
+	// A repository on disk is remembered by its absolute path, which still
+	// works from inside the clone.
+	if localPath, ok := localRepositoryPath(repoURL); ok && localPath == repoURL {
+		if absolute, err := filepath.Abs(localPath); err == nil {
+			repoURL = absolute
+		}
+	}
+	// The directory is named after the last path component, which follows
+	// the ":" of an scp-like address that has no "/".
+	dir := strings.TrimSuffix(path.Base(repoURL), ".git")
+	if _, _, remotePath, ok := parseSSHURL(repoURL); ok {
+		dir = strings.TrimSuffix(path.Base(remotePath), ".git")
+	}
+	if len(positional) == 2 {
+		dir = positional[1]
+	}
+	entries, err := os.ReadDir(dir)
+	if err == nil && len(entries) > 0 {
+		return failure.Fatalf("fatal: destination path '%v' already exists and is not an empty directory.", dir)
+	}
+	existed := err == nil
+	if !quiet {
+		fmt.Fprintf(stderr, "Cloning into '%v'...\n", dir)
+	}
+	progress := progressOutput(stderr, quiet, forceProgress)
+
+	remote, err := openUploadPack(ctx, repoURL, []string{"HEAD", "refs/heads/", "refs/tags/"}, stderr)
+	if err != nil {
+		return err
+	}
+	defer remote.close()
+	refs := remote.refs
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("Failed to create directory %v: %w", dir, err)
+	}
+	absoluteDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	// Once the branch is written out the clone stands, even if checking it
+	// out fails. Until then a failure takes the directory away again, or
+	// empties it when it was there before. This runs after the deferred
+	// Chdir below has taken us out of it.
+	checkingOut := false
+	defer func() {
+		if err != nil && !checkingOut {
+			removeClone(absoluteDir, existed)
+		}
+	}()
+	previousDir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	if err := os.Chdir(dir); err != nil {
+		return err
+	}
+	defer os.Chdir(previousDir)
+
+	// The clone names its objects the way the remote does.
+	if err := initRepository([]string{"--object-format=" + remote.algorithm.Name()}, io.Discard); err != nil {
+		return err
+	}
+
+	if len(refs) == 0 {
+		fmt.Fprintln(stderr, "warning: You appear to have cloned an empty repository.")
+		branch := "main"
+		if strings.HasPrefix(remote.unbornHead, "refs/heads/") {
+			branch = strings.TrimPrefix(remote.unbornHead, "refs/heads/")
+			if err := repository.Refs.Write("HEAD", "ref: "+remote.unbornHead); err != nil {
+				return err
+			}
+		}
+		return writeCloneConfig(repoURL, branch, "+refs/heads/*:refs/remotes/origin/*")
+	}
+
+	headSHA := ""
+	for _, ref := range refs {
+		if ref.name == "HEAD" {
+			headSHA = ref.sha
+		}
+	}
+	defaultBranch := findDefaultBranch(refs, headSHA)
+	fetchRefspec := "+refs/heads/*:refs/remotes/origin/*"
+	if depth > 0 {
+		// A shallow clone is single-branch: it follows only the default
+		// branch, and only the tags that come along with it.
+		selected := make([]advertisedRef, 0, 2)
+		for _, ref := range refs {
+			if ref.name == "HEAD" || ref.name == "refs/heads/"+defaultBranch || strings.HasPrefix(ref.name, "refs/tags/") {
+				selected = append(selected, ref)
+			}
+		}
+		refs = selected
+		if defaultBranch != "" {
+			fetchRefspec = fmt.Sprintf("+refs/heads/%v:refs/remotes/origin/%v", defaultBranch, defaultBranch)
+		}
+	}
+
+	wants := make([]string, 0, len(refs))
+	seen := make(map[string]bool)
+	for _, ref := range refs {
+		if depth > 0 && strings.HasPrefix(ref.name, "refs/tags/") {
+			continue
+		}
+		if !seen[ref.sha] {
+			seen[ref.sha] = true
+			wants = append(wants, ref.sha)
+		}
+	}
+	response, err := remote.fetch(fetchRequest{wants: wants, depth: depth, progress: progress != nil}, stderr)
+	if err != nil {
+		return err
+	}
+	if _, err := unpackObjects(ctx, response.pack, progress); err != nil {
+		return err
+	}
+	if err := updateShallow(response); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		switch {
+		case strings.HasPrefix(ref.name, "refs/heads/"):
+			branch := strings.TrimPrefix(ref.name, "refs/heads/")
+			if err := repository.Refs.Write("refs/remotes/origin/"+branch, ref.sha); err != nil {
+				return err
+			}
+		case strings.HasPrefix(ref.name, "refs/tags/") && repository.HasObject(ref.sha):
+			if err := repository.Refs.Write(ref.name, ref.sha); err != nil {
+				return err
+			}
+		}
+	}
+	action := "clone: from " + repoURL
+	if defaultBranch == "" {
+		// Remote HEAD is detached; mirror that locally.
+		if err := writeRef("HEAD", headSHA, action); err != nil {
+			return err
+		}
+		defaultBranch = "main"
+	} else {
+		branchSHA := headSHA
+		for _, ref := range refs {
+			if ref.name == "refs/heads/"+defaultBranch {
+				branchSHA = ref.sha
+			}
+		}
+		headSHA = branchSHA
+		if err := repository.Refs.Write("refs/heads/"+defaultBranch, branchSHA); err != nil {
+			return err
+		}
+		if err := repository.Refs.Write("HEAD", "ref: refs/heads/"+defaultBranch); err != nil {
+			return err
+		}
+		if err := repository.Refs.Write("refs/remotes/origin/HEAD", "ref: refs/remotes/origin/"+defaultBranch); err != nil {
+			return err
+		}
+		for _, name := range []string{"refs/heads/" + defaultBranch, "HEAD", "refs/remotes/origin/HEAD"} {
+			if err := logRefUpdate(name, "", branchSHA, action); err != nil {
+				return err
+			}
+		}
+	}
+	if err := writeCloneConfig(repoURL, defaultBranch, fetchRefspec); err != nil {
+		return err
+	}
+
+	checkingOut = true
+	treeSHA, err := commitTreeSHA(headSHA)
+	if err == nil {
+		err = checkoutTreeFiles(treeSHA)
+	}
+	if err != nil {
+		return failure.Fatalf("%w\nfatal: unable to checkout working tree\n"+
+			"warning: Clone succeeded, but checkout failed.\n"+
+			"You can inspect what was checked out with 'git status'\n"+
+			"and retry with 'git restore --source=HEAD :/'", err)
+	}
+	return nil
+}
+
+// findDefaultBranch prefers the branch the remote says HEAD points at and
+// otherwise picks a branch whose tip matches the advertised HEAD.
+func findDefaultBranch(refs []advertisedRef, headSHA string) string {
+	for _, ref := range refs {
+		if ref.name == "HEAD" && strings.HasPrefix(ref.symref, "refs/heads/") {
+			return strings.TrimPrefix(ref.symref, "refs/heads/")
+		}
+	}
+	for _, candidate := range []string{"main", "master"} {
+		for _, ref := range refs {
+			if ref.name == "refs/heads/"+candidate && ref.sha == headSHA {
+				return candidate
+			}
+		}
+	}
+	for _, ref := range refs {
+		if strings.HasPrefix(ref.name, "refs/heads/") && ref.sha == headSHA {
+			return strings.TrimPrefix(ref.name, "refs/heads/")
+		}
+	}
+	return ""
+}
+
+func writeCloneConfig(repoURL string, branch string, fetchRefspec string) error {
+	config := "[core]\n\trepositoryformatversion = 0\n\tfilemode = true\n\tbare = false\n"
+	if repository.Algorithm != objects.SHA1 {
+		config = "[core]\n\trepositoryformatversion = 1\n\tfilemode = true\n\tbare = false\n"
+		config += fmt.Sprintf("[extensions]\n\tobjectformat = %v\n", repository.Algorithm.Name())
+	}
+	config += fmt.Sprintf("[remote \"origin\"]\n\turl = %v\n\tfetch = %v\n", repoURL, fetchRefspec)
+	config += fmt.Sprintf("[branch \"%v\"]\n\tremote = origin\n\tmerge = refs/heads/%v\n", branch, branch)
+	configPath := repository.Path("config")
+	if err := atomicfile.WriteFile(configPath, []byte(config), 0644); err != nil {
+		return fmt.Errorf("Failed to create file %v: %w", configPath, err)
+	}
+	return nil
+}
+
+// removeClone takes away what a failed clone made of dir: all of it, or
+// only what is in it when it was there before.
+func removeClone(dir string, existed bool) {
+	if !existed {
+		os.RemoveAll(dir)
+		return
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		os.RemoveAll(filepath.Join(dir, entry.Name()))
+	}
+}
+
+// unpackObjects decodes a packfile received from a remote and writes every
+// object it contains as a loose object. It returns the number of objects
+// written. A "Resolving deltas" meter goes to output, when there is one,
+// for a pack with deltas, and canceling ctx stops the parsing and writing.
+func unpackObjects(ctx context.Context, packData []byte, output io.Writer) (int, error) {
+	var meter *progress
+	entries, err := pack.ReadEntries(ctx, repository.Algorithm, packData, nil, func(done int, total int, size int64) {
+		if meter == nil {
+			meter = startProgress(output, "Resolving deltas", total)
+		}
+		meter.update(done, size)
+	})
+	if err != nil {
+		return 0, err
+	}
+	meter.stop()
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		if _, err := repository.WriteObject(entry.Object.Type, entry.Object.Content); err != nil {
+			return 0, err
+		}
+	}
+	return len(entries), nil
+}
+
+func commitTreeSHA(commitSHA string) (string, error) {
+	commit, err := repository.ReadCommit(commitSHA)
+	if err != nil {
+		return "", err
+	}
+	return commit.Tree, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCloneRefusesUnsafePaths(t *testing.T) {
+	base := setupTest(t)
+	source := filepath.Join(base, "source")
+	if err := os.Mkdir(source, 0755); err != nil {
+		t.Fatal(err)
+	}
+	mygit(t, source, "init")
+	hook := strings.TrimSpace(mygitInput(t, source, "#!/bin/sh\necho PWNED\n", "hash-object", "-w", "--stdin"))
+	hooks := writeRawTree(t, source, [3]string{"100755", "pre-commit", hook})
+	dotgit := writeRawTree(t, source, [3]string{"40000", "hooks", hooks})
+	root := writeRawTree(t, source, [3]string{"40000", ".git", dotgit}, [3]string{"100644", "f", hook})
+	evil := strings.TrimSpace(mygit(t, source, "commit-tree", root, "-m", "evil"))
+	mygit(t, source, "update-ref", "refs/heads/main", evil)
+
+	_, stderr, code := runIn(t, base, "", "clone", source, "clone")
+	if code == 0 || !strings.Contains(stderr, "error: invalid path '.git'") ||
+		!strings.Contains(stderr, "warning: Clone succeeded, but checkout failed.") {
+		t.Errorf("clone exited %v:\n%v", code, stderr)
+	}
+	if _, err := os.Lstat(filepath.Join(base, "clone/.git/hooks/pre-commit")); err == nil {
+		t.Error("clone installed the hook")
+	}
+	if _, err := os.Lstat(filepath.Join(base, "clone/f")); err == nil {
+		t.Error("clone checked out part of the tree")
+	}
+}
+
+func TestCloneReportsRemoteErrorsOnStderr(t *testing.T) {
+	dir := setupTest(t)
+	if err := os.Mkdir(filepath.Join(dir, "notrepo"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// The upload-pack run for a local clone says what is wrong on the
+	// clone's own stderr.
+	_, stderr, code := runIn(t, dir, "", "clone", "notrepo", "clone")
+	if code != 128 || !strings.Contains(stderr, "does not appear to be a git repository") {
+		t.Errorf("clone of a directory that is no repository: exit %v\n%v", code, stderr)
+	}
+}
+
+func TestCloneChecksOutAndTracksRemoteBranches(t *testing.T) {
+	base := setupTest(t)
+	source := filepath.Join(base, "source")
+	if err := os.Mkdir(source, 0755); err != nil {
+		t.Fatal(err)
+	}
+	mygit(t, source, "init")
+	first := commitFile(t, source, "d/b", "b\n", "first")
+	mygit(t, source, "branch", "feature")
+	second := commitFile(t, source, "a", "a\n", "second")
+
+	if _, stderr, code := runIn(t, base, "", "clone", source, "clone"); code != 0 || !strings.Contains(stderr, "Cloning into 'clone'...") {
+		t.Fatalf("clone exited %v:\n%v", code, stderr)
+	}
+	clone := filepath.Join(base, "clone")
+	for revision, want := range map[string]string{"HEAD": second, "origin/main": second, "origin/feature": first} {
+		if got := strings.TrimSpace(mygit(t, clone, "rev-parse", revision)); got != want {
+			t.Errorf("rev-parse %v = %v, want %v", revision, got, want)
+		}
+	}
+	if got := strings.TrimSpace(mygit(t, clone, "symbolic-ref", "HEAD")); got != "refs/heads/main" {
+		t.Errorf("HEAD of the clone is %v", got)
+	}
+	if got := strings.TrimSpace(mygit(t, clone, "config", "remote.origin.url")); got != source {
+		t.Errorf("remote.origin.url = %v", got)
+	}
+	for name, want := range map[string]string{"a": "a\n", "d/b": "b\n"} {
+		if got, err := os.ReadFile(filepath.Join(clone, name)); err != nil || string(got) != want {
+			t.Errorf("%v in the clone = %q, %v", name, got, err)
+		}
+	}
+	if got := mygit(t, clone, "status", "-s"); got != "" {
+		t.Errorf("status in a fresh clone:\n%v", got)
+	}
+}
+
+func TestShallowCloneAndDeepeningFetch(t *testing.T) {
+	base := setupTest(t)
+	source := filepath.Join(base, "source")
+	if err := os.Mkdir(source, 0755); err != nil {
+		t.Fatal(err)
+	}
+	mygit(t, source, "init")
+	commits := make([]string, 4)
+	for i := range commits {
+		commits[i] = commitFile(t, source, "f", strings.Repeat("x", i+1), "c"+strconv.Itoa(i))
+	}
+	mygit(t, base, "clone", "--depth", "2", source, "clone")
+	clone := filepath.Join(base, "clone")
+	shallow := func() string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(clone, ".git", "shallow"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	count := func(revision string) string {
+		t.Helper()
+		return strings.TrimSpace(mygit(t, clone, "rev-list", "--count", revision))
+	}
+
+	if got := shallow(); got != commits[2]+"\n" {
+		t.Errorf("shallow after clone --depth 2 = %q, want %v", got, commits[2])
+	}
+	if got := count("HEAD"); got != "2" {
+		t.Errorf("a clone of depth 2 has %v commits", got)
+	}
+	if _, err := os.Stat(filepath.Join(clone, ".git", "objects", commits[1][:2], commits[1][2:])); err == nil {
+		t.Errorf("the clone has the commit behind its boundary")
+	}
+
+	mygit(t, clone, "fetch", "--depth", "4")
+	if _, err := os.Stat(filepath.Join(clone, ".git", "shallow")); err == nil {
+		t.Errorf("deepening past the root left a shallow file:\n%v", shallow())
+	}
+	if got := count("origin/main"); got != "4" {
+		t.Errorf("after fetch --depth 4 origin/main has %v commits", got)
+	}
+	if got := strings.TrimSpace(mygit(t, clone, "cat-file", "-t", commits[0])); got != "commit" {
+		t.Errorf("the root commit is a %q after deepening", got)
+	}
+}
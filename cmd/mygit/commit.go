@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+	"github.com/codecrafters-io/git-starter-go/pkg/objects"
+)
+
+// commit records the index as a new commit on the current branch. Its
+// message is declared to be in the --encoding given, or else in
+// i18n.commitEncoding, and stored as given. Unless
+// -n or --no-verify is given, the pre-commit hook can refuse it first and
+// the commit-msg hook can edit or refuse its message; post-commit hears of
+// it afterwards.
+func commit(args []string, stdout io.Writer, stderr io.Writer) error {
+	messages := make([]string, 0, 1)
+	var signing commitSigning
+	noVerify := false
+	encoding, encodingGiven := "", false
+	for index := 0; index < len(args); index++ {
+		switch arg := args[index]; {
+		case signing.option(arg):
+		case strings.HasPrefix(arg, "--encoding="):
+			encoding, encodingGiven = strings.TrimPrefix(arg, "--encoding="), true
+		case arg == "-n" || arg == "--no-verify":
+			noVerify = true
+		case arg == "-m" && index+1 < len(args):
+			index++
+			messages = append(messages, args[index])
+		case strings.HasPrefix(arg, "-m"):
+			messages = append(messages, strings.TrimPrefix(arg, "-m"))
+		case strings.HasPrefix(arg, "--message="):
+			messages = append(messages, strings.TrimPrefix(arg, "--message="))
+		default:
+			return failure.Usage("usage: commit [-n] [-S[<keyid>]] [--encoding=<encoding>] -m <message>")
+		}
+	}
+	if !encodingGiven {
+		if cfg, err := repository.Config(); err == nil {
+			encoding, _ = cfg.Get("i18n.commitEncoding")
+		}
+	}
+	// UTF-8 is what a message without the header is taken to be in.
+	if strings.EqualFold(encoding, "utf-8") || strings.EqualFold(encoding, "utf8") {
+		encoding = ""
+	}
+	// A merge stopped by conflicts is concluded with MERGE_HEAD as a second
+	// parent, and its prepared message unless one is given.
+	mergeSHA, err := repository.Refs.Read("MERGE_HEAD")
+	merging := err == nil
+	if len(messages) == 0 && merging {
+		if prepared, err := os.ReadFile(repository.Path("MERGE_MSG")); err == nil {
+			messages = append(messages, stripCommentLines(string(prepared)))
+		}
+	}
+	if len(messages) == 0 {
+		return failure.Usage("usage: commit [-n] [-S[<keyid>]] [--encoding=<encoding>] -m <message>")
+	}
+	message := strings.TrimRight(strings.Join(messages, "\n\n"), "\n")
+
+	// The hooks are told which index is being committed, and, as no editor
+	// is involved, that there is none.
+	hookEnv := []string{"GIT_INDEX_FILE=" + repository.Path("index"), "GIT_EDITOR=:"}
+	if !noVerify {
+		if err := runHook("pre-commit", nil, nil, hookEnv, stderr); err != nil {
+			return err
+		}
+	}
+	entries, err := readIndex()
+	if err != nil {
+		return err
+	}
+	treeHash, err := writeTreeFromIndex(entries)
+	if err != nil {
+		return err
+	}
+	treeSHA := hex.EncodeToString(treeHash)
+
+	headRef, isSymref, err := readHeadSymref()
+	if err != nil {
+		return err
+	}
+	parentSHA, err := resolveHead()
+	if err != nil {
+		return err
+	}
+	parents := make([]string, 0, 1)
+	if parentSHA != "" {
+		parentTreeSHA, err := commitTreeSHA(parentSHA)
+		if err != nil {
+			return err
+		}
+		if parentTreeSHA == treeSHA && !merging {
+			// With nothing staged the status is shown instead, ending with
+			// whether there are unstaged changes or untracked files to add.
+			report, err := collectStatus()
+			if err != nil {
+				return err
+			}
+			printLongStatus(report, stdout)
+			return errSilentFailure
+		}
+		parents = append(parents, parentSHA)
+	}
+	if merging {
+		parents = append(parents, mergeSHA)
+	}
+
+	// commit-msg gets the message in COMMIT_EDITMSG, and what it leaves
+	// there is what is committed.
+	messagePath := repository.Path("COMMIT_EDITMSG")
+	if err := os.WriteFile(messagePath, []byte(message+"\n"), 0644); err != nil {
+		return failure.Fatalf("fatal: could not open '%v': %w", messagePath, err)
+	}
+	if !noVerify {
+		if err := runHook("commit-msg", []string{messagePath}, nil, hookEnv, stderr); err != nil {
+			return err
+		}
+		edited, err := os.ReadFile(messagePath)
+		if err != nil {
+			return failure.Fatalf("fatal: could not read commit message: %w", err)
+		}
+		message = strings.TrimRight(string(edited), "\n")
+	}
+	if strings.TrimSpace(message) == "" {
+		return errors.New("Aborting commit due to empty commit message.")
+	}
+
+	signKey, err := signing.commitKey()
+	if err != nil {
+		return err
+	}
+	hash, err := createCommitObject(treeSHA, parents, message+"\n", encoding, signKey)
+	if err != nil {
+		return err
+	}
+	commitSHA := hex.EncodeToString(hash)
+	subject := strings.SplitN(message, "\n", 2)[0]
+	action := "commit: " + subject
+	if len(parents) == 0 {
+		action = "commit (initial): " + subject
+	} else if merging {
+		action = "commit (merge): " + subject
+	}
+	if isSymref {
+		err = writeRef(headRef, commitSHA, action)
+	} else {
+		err = writeRef("HEAD", commitSHA, action)
+	}
+	if err != nil {
+		return err
+	}
+	if merging {
+		if err := clearMergeState(); err != nil {
+			return err
+		}
+	}
+	// How post-commit exits changes nothing.
+	runHook("post-commit", nil, nil, hookEnv, stderr)
+
+	branch := "detached HEAD"
+	if isSymref {
+		branch = strings.TrimPrefix(headRef, "refs/heads/")
+	}
+	if len(parents) == 0 {
+		branch += " (root-commit)"
+	}
+	fmt.Fprintf(stdout, "[%v %v] %v\n", branch, commitSHA[:7], subject)
+	return nil
+}
+
+// stripCommentLines drops the "#" lines git leaves in prepared messages.
+func stripCommentLines(message string) string {
+	kept := make([]string, 0)
+	for _, line := range strings.Split(message, "\n") {
+		if !strings.HasPrefix(line, "#") {
+			kept = append(kept, line)
+		}
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n"))
+}
+
+// writeTreeFromIndex builds tree objects for the stage-0 index entries and
+// returns the root tree hash. The index is sorted by full path, which already
+// yields git's tree order for each level.
+func writeTreeFromIndex(entries []IndexEntry) ([]byte, error) {
+	staged := make([]IndexEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.stage() != 0 {
+			return nil, fmt.Errorf("error: %v: unmerged path, cannot write tree", entry.path)
+		}
+		staged = append(staged, entry)
+	}
+	sortIndexEntries(staged)
+	return buildTree(staged, "")
+}
+
+func buildTree(entries []IndexEntry, prefix string) ([]byte, error) {
+	tree := &objects.Tree{Entries: make([]objects.TreeEntry, 0)}
+	for index := 0; index < len(entries); {
+		name := strings.TrimPrefix(entries[index].path, prefix)
+		dir, _, isNested := strings.Cut(name, "/")
+		if !isNested {
+			tree.Entries = append(tree.Entries, objects.TreeEntry{Mode: fmt.Sprintf("%o", entries[index].mode), Name: name, Hash: entries[index].hash})
+			index++
+			continue
+		}
+
+		subtreePrefix := prefix + dir + "/"
+		end := index
+		for end < len(entries) && strings.HasPrefix(entries[end].path, subtreePrefix) {
+			end++
+		}
+		hash, err := buildTree(entries[index:end], subtreePrefix)
+		if err != nil {
+			return nil, err
+		}
+		tree.Entries = append(tree.Entries, objects.TreeEntry{Mode: "40000", Name: dir, Hash: hash})
+		index = end
+	}
+	return repository.WriteObject(objects.TypeTree, tree.Encode())
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCommitAdvancesHeadFromTheIndex(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	writeFile(t, dir, "a", "a\n")
+	mygit(t, dir, "add", "a")
+	out := mygit(t, dir, "commit", "-m", "one")
+	first := strings.TrimSpace(mygit(t, dir, "rev-parse", "HEAD"))
+	if want := "[main (root-commit) " + first[:7] + "] one\n"; !strings.HasPrefix(out, want) {
+		t.Errorf("commit printed %q, want it to begin %q", out, want)
+	}
+
+	// Only what is staged is committed.
+	writeFile(t, dir, "a", "staged\n")
+	mygit(t, dir, "add", "a")
+	writeFile(t, dir, "a", "not staged\n")
+	mygit(t, dir, "commit", "-m", "two")
+	if got := mygit(t, dir, "cat-file", "-p", "HEAD:a"); got != "staged\n" {
+		t.Errorf("HEAD:a = %q", got)
+	}
+	if got := strings.TrimSpace(mygit(t, dir, "rev-parse", "HEAD~1")); got != first {
+		t.Errorf("HEAD~1 = %v, want the first commit %v", got, first)
+	}
+	commit := mygit(t, dir, "cat-file", "-p", "HEAD")
+	for _, want := range []string{"parent " + first + "\n", "author A U Thor <author@example.com> 1700000000 +0000\n", "\n\ntwo\n"} {
+		if !strings.Contains(commit, want) {
+			t.Errorf("commit lacks %q:\n%v", want, commit)
+		}
+	}
+	if got := mygit(t, dir, "reflog"); !strings.Contains(got, "HEAD@{0}: commit: two\n") || !strings.Contains(got, "HEAD@{1}: commit (initial): one\n") {
+		t.Errorf("reflog:\n%v", got)
+	}
+
+	mygit(t, dir, "add", "a")
+	mygit(t, dir, "commit", "-m", "three")
+	if stdout, _, code := runIn(t, dir, "", "commit", "-m", "empty"); code != 1 || !strings.Contains(stdout, "nothing to commit, working tree clean") {
+		t.Errorf("commit with nothing staged: exit %v\n%v", code, stdout)
+	}
+}
+
+func TestCommitOnDetachedHead(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	branch := commitFile(t, dir, "a", "a\n", "one")
+	mygit(t, dir, "checkout", "--detach", "HEAD")
+	writeFile(t, dir, "a", "b\n")
+	mygit(t, dir, "add", "a")
+	if out := mygit(t, dir, "commit", "-m", "two"); !strings.HasPrefix(out, "[detached HEAD ") {
+		t.Errorf("commit on a detached HEAD printed %q", out)
+	}
+	detached := strings.TrimSpace(mygit(t, dir, "rev-parse", "HEAD"))
+	if detached == branch {
+		t.Error("HEAD did not move")
+	}
+	if got := strings.TrimSpace(mygit(t, dir, "rev-parse", "main")); got != branch {
+		t.Errorf("main moved to %v with HEAD detached", got)
+	}
+}
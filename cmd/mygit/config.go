@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+	"github.com/codecrafters-io/git-starter-go/pkg/config"
+	"github.com/codecrafters-io/git-starter-go/pkg/repo"
+)
+
+// gitConfig reads and writes config values. Reads see every scope unless
+// --system, --global, --local or --file narrows them; writes go to the
+// repository's config by default. A name with no value reads it and a name
+// with one sets it.
+func gitConfig(args []string, stdout io.Writer) error {
+	scope, file, action := "", "", ""
+	positional := make([]string, 0, 2)
+	for index := 0; index < len(args); index++ {
+		switch arg := args[index]; arg {
+		case "--system", "--global", "--local":
+			scope = strings.TrimPrefix(arg, "--")
+		case "-f", "--file":
+			if index+1 >= len(args) {
+				return failure.Usagef("error: option `%v' requires a value", strings.TrimLeft(arg, "-"))
+			}
+			index++
+			scope, file = "file", args[index]
+		case "--get", "--get-all", "--set", "--add", "--unset", "--unset-all", "-l", "--list":
+			if action != "" {
+				return errors.New("error: only one action at a time")
+			}
+			action = strings.TrimPrefix(arg, "--")
+			if arg == "-l" {
+				action = "list"
+			}
+		default:
+			if strings.HasPrefix(arg, "--file=") {
+				scope, file = "file", strings.TrimPrefix(arg, "--file=")
+				continue
+			}
+			if strings.HasPrefix(arg, "-") {
+				return failure.Usagef("error: unknown option `%v'", strings.TrimLeft(arg, "-"))
+			}
+			positional = append(positional, arg)
+		}
+	}
+	if action == "" {
+		switch len(positional) {
+		case 1:
+			action = "get"
+		case 2:
+			action = "set"
+		default:
+			return failure.Usage("usage: config [--system | --global | --local | --file <file>] [--get | --get-all | --set | --add | --unset | --unset-all | --list] [<name> [<value>]]")
+		}
+	}
+	wantArgs := map[string]int{"get": 1, "get-all": 1, "set": 2, "add": 2, "unset": 1, "unset-all": 1, "list": 0}[action]
+	if len(positional) != wantArgs {
+		return fmt.Errorf("error: wrong number of arguments, should be %v", wantArgs)
+	}
+
+	paths, err := configPaths(scope, file, action == "get" || action == "get-all" || action == "list")
+	if err != nil {
+		return err
+	}
+	switch action {
+	case "get", "get-all", "list":
+		values, err := config.Load(paths...)
+		if err != nil {
+			return err
+		}
+		if action == "list" {
+			for _, entry := range values.Entries {
+				fmt.Fprintf(stdout, "%v=%v\n", entry.Name(), entry.Value)
+			}
+			return nil
+		}
+		if _, _, _, ok := config.SplitName(positional[0]); !ok {
+			return fmt.Errorf("error: key does not contain a section: %v", positional[0])
+		}
+		matches := values.GetAll(positional[0])
+		if len(matches) == 0 {
+			return errSilentFailure
+		}
+		if action == "get" {
+			matches = matches[len(matches)-1:]
+		}
+		for _, value := range matches {
+			fmt.Fprintln(stdout, value)
+		}
+		return nil
+	case "set":
+		return config.Set(paths[0], positional[0], positional[1])
+	case "add":
+		return config.Add(paths[0], positional[0], positional[1])
+	default:
+		err := config.Unset(paths[0], positional[0], action == "unset-all")
+		if errors.Is(err, config.ErrNotSet) {
+			return errSilentFailure
+		}
+		return err
+	}
+}
+
+// configPaths lists the files a config command reads, or for writes the one
+// file it changes, lowest precedence first.
+func configPaths(scope string, file string, reading bool) ([]string, error) {
+	inRepository := repo.IsGitDir(repository.GitDir)
+	switch scope {
+	case "file":
+		return []string{file}, nil
+	case "system":
+		if system := os.Getenv("GIT_CONFIG_SYSTEM"); system != "" {
+			return []string{system}, nil
+		}
+		return []string{"/etc/gitconfig"}, nil
+	case "global":
+		globals := config.GlobalPaths()
+		if len(globals) == 0 {
+			return nil, failure.Fatal("fatal: $HOME not set")
+		}
+		if reading {
+			return globals, nil
+		}
+		// Writes go to ~/.gitconfig, or to the XDG file when only it exists.
+		if len(globals) == 2 && !fileExists(globals[1]) && fileExists(globals[0]) {
+			return globals[:1], nil
+		}
+		return globals[len(globals)-1:], nil
+	case "local":
+		if !inRepository {
+			return nil, failure.Fatal("fatal: --local can only be used inside a git repository")
+		}
+		return []string{repository.Path("config")}, nil
+	}
+	if !reading {
+		if !inRepository {
+			return nil, failure.Fatal("fatal: not in a git directory")
+		}
+		return []string{repository.Path("config")}, nil
+	}
+	paths := make([]string, 0, 4)
+	if system := config.SystemPath(); system != "" {
+		paths = append(paths, system)
+	}
+	paths = append(paths, config.GlobalPaths()...)
+	if inRepository {
+		paths = append(paths, repository.Path("config"))
+	}
+	return paths, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
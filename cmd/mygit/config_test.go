@@ -0,0 +1,69 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigSetGetAndUnset(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	mygit(t, dir, "config", "core.Foo", "bar")
+	mygit(t, dir, "config", "sec.Sub.key", "a b")
+	mygit(t, dir, "config", "--add", "multi.v", "one")
+	mygit(t, dir, "config", "--add", "multi.v", "two")
+
+	for _, test := range []struct {
+		args []string
+		want string
+	}{
+		// Section and key names are case-insensitive, subsections are not.
+		{[]string{"config", "CORE.foo"}, "bar\n"},
+		{[]string{"config", "--get", "sec.Sub.KEY"}, "a b\n"},
+		{[]string{"config", "--get-all", "multi.v"}, "one\ntwo\n"},
+		{[]string{"config", "multi.v"}, "two\n"},
+	} {
+		if got := mygit(t, dir, test.args...); got != test.want {
+			t.Errorf("%v = %q, want %q", strings.Join(test.args, " "), got, test.want)
+		}
+	}
+	if _, _, code := runIn(t, dir, "", "config", "sec.sub.key"); code != 1 {
+		t.Errorf("config of a subsection in the wrong case exited %v", code)
+	}
+	if got := mygit(t, dir, "config", "-l"); !strings.HasSuffix(got, "core.foo=bar\nsec.Sub.key=a b\nmulti.v=one\nmulti.v=two\n") {
+		t.Errorf("config -l:\n%v", got)
+	}
+
+	mygit(t, dir, "config", "--unset", "sec.Sub.key")
+	mygit(t, dir, "config", "--unset-all", "multi.v")
+	for _, key := range []string{"sec.Sub.key", "multi.v", "nope.key"} {
+		if _, _, code := runIn(t, dir, "", "config", "--get", key); code != 1 {
+			t.Errorf("config --get %v exited %v", key, code)
+		}
+	}
+	if _, stderr, code := runIn(t, dir, "", "config", "nodot", "x"); code == 0 || !strings.Contains(stderr, "key does not contain a section: nodot") {
+		t.Errorf("config of a key with no section: exit %v\n%v", code, stderr)
+	}
+}
+
+func TestConfigFileReadableByGit(t *testing.T) {
+	requireGit(t)
+	dir := setupTest(t)
+	path := filepath.Join(dir, "file.config")
+	mygit(t, dir, "config", "-f", path, "a.b", "plain")
+	mygit(t, dir, "config", "-f", path, "a.sub.c", `quote " and \ backslash`)
+	mygit(t, dir, "config", "-f", path, "a.d", " padded ; # comment chars ")
+	if got, want := mygit(t, dir, "config", "-f", path, "-l"), runGit(t, dir, "config", "-f", path, "-l"); got != want {
+		t.Errorf("mygit config -l:\n%v\ngit config -l:\n%v", got, want)
+	}
+
+	runGit(t, dir, "config", "-f", path, "e.f", "from git")
+	runGit(t, dir, "config", "-f", path, "--bool", "e.flag", "yes")
+	if got := mygit(t, dir, "config", "-f", path, "e.f"); got != "from git\n" {
+		t.Errorf("e.f written by git = %q", got)
+	}
+	if got := mygit(t, dir, "config", "-f", path, "e.flag"); got != "true\n" {
+		t.Errorf("e.flag written by git = %q", got)
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+)
+
+// credential is a user name and password for a remote, in the terms git's
+// credential helpers use: protocol=https, host=example.com[:port] and, when
+// credential.useHttpPath is set, path=user/repo.git.
+type credential struct {
+	protocol string
+	host     string
+	path     string
+	username string
+	password string
+
+	helpers []string
+	// stderr takes what helpers and askpass programs print.
+	stderr io.Writer
+	// approved is set once the credential has been stored with the helpers.
+	approved bool
+}
+
+// newCredential describes the credential a remote URL needs. A user name
+// and password in the URL are taken as given; credential.username and
+// credential.helper come from the config.
+func newCredential(remoteURL *url.URL, stderr io.Writer) *credential {
+	c := &credential{protocol: remoteURL.Scheme, host: remoteURL.Host, stderr: stderr}
+	if remoteURL.User != nil {
+		c.username = remoteURL.User.Username()
+		c.password, _ = remoteURL.User.Password()
+	}
+	cfg, err := repository.Config()
+	if err != nil {
+		return c
+	}
+	if c.username == "" {
+		c.username, _ = cfg.Get("credential.username")
+	}
+	if useHTTPPath, _ := cfg.Get("credential.useHttpPath"); useHTTPPath == "true" {
+		c.path = strings.TrimPrefix(remoteURL.Path, "/")
+	}
+	for _, helper := range cfg.GetAll("credential.helper") {
+		// An empty value clears the helpers configured before it.
+		if helper == "" {
+			c.helpers = nil
+		} else {
+			c.helpers = append(c.helpers, helper)
+		}
+	}
+	return c
+}
+
+// fill asks each helper in turn until one supplies both a user name and a
+// password, then prompts for whatever is still missing.
+func (c *credential) fill() error {
+	for _, helper := range c.helpers {
+		if c.username != "" && c.password != "" {
+			break
+		}
+		if quit := c.runHelper(helper, "get"); quit {
+			break
+		}
+	}
+	if c.username == "" {
+		username, err := promptCredential(fmt.Sprintf("Username for '%v': ", c.description(false)), true, c.stderr)
+		if err != nil {
+			return err
+		}
+		c.username = username
+	}
+	if c.password == "" {
+		password, err := promptCredential(fmt.Sprintf("Password for '%v': ", c.description(true)), false, c.stderr)
+		if err != nil {
+			return err
+		}
+		c.password = password
+	}
+	return nil
+}
+
+// approve tells the helpers the credential worked, so they can store it.
+func (c *credential) approve() {
+	if c.approved || c.username == "" || c.password == "" {
+		return
+	}
+	c.approved = true
+	for _, helper := range c.helpers {
+		c.runHelper(helper, "store")
+	}
+}
+
+// reject tells the helpers the credential was refused, so they forget it.
+func (c *credential) reject() {
+	for _, helper := range c.helpers {
+		c.runHelper(helper, "erase")
+	}
+	c.password, c.approved = "", false
+}
+
+// runHelper runs helper with action, get, store or erase, passing the
+// credential on stdin. For get it takes up the attributes the helper prints
+// and reports whether it said quit=1. A helper that fails is skipped.
+func (c *credential) runHelper(helper string, action string) bool {
+	// A leading "!" starts a shell snippet, an absolute path is run as is
+	// and any other name is the git-credential-<name> command.
+	script := helper
+	switch {
+	case strings.HasPrefix(helper, "!"):
+		script = helper[1:]
+	case filepath.IsAbs(helper):
+	default:
+		script = "git credential-" + helper
+	}
+	command := exec.Command("sh", "-c", script+` "$@"`, script, action)
+	command.Stdin = strings.NewReader(c.encode())
+	command.Stderr = c.stderr
+	output, err := command.Output()
+	if err != nil || action != "get" {
+		return false
+	}
+
+	quit := false
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), "=")
+		if !found {
+			continue
+		}
+		switch key {
+		case "username":
+			c.username = value
+		case "password":
+			c.password = value
+		case "quit":
+			quit = value == "1" || value == "true"
+		}
+	}
+	return quit
+}
+
+// encode formats the credential as helper input, ending with a blank line.
+func (c *credential) encode() string {
+	var encoded strings.Builder
+	for _, attribute := range [][2]string{{"protocol", c.protocol}, {"host", c.host}, {"path", c.path}, {"username", c.username}, {"password", c.password}} {
+		if attribute[1] != "" {
+			fmt.Fprintf(&encoded, "%v=%v\n", attribute[0], attribute[1])
+		}
+	}
+	encoded.WriteString("\n")
+	return encoded.String()
+}
+
+// description is the URL prompts name, with the user name once it is known.
+func (c *credential) description(withUser bool) string {
+	description := c.protocol + "://"
+	if withUser && c.username != "" {
+		description += c.username + "@"
+	}
+	description += c.host
+	if c.path != "" {
+		description += "/" + c.path
+	}
+	return description
+}
+
+// promptCredential asks for a value through GIT_ASKPASS, core.askPass or
+// SSH_ASKPASS, whichever is set first, and otherwise on the terminal,
+// without echo for passwords. GIT_TERMINAL_PROMPT=0 rules out the terminal.
+// What an askpass program prints besides its answer goes to stderr.
+func promptCredential(prompt string, echo bool, stderr io.Writer) (string, error) {
+	askPass := os.Getenv("GIT_ASKPASS")
+	if askPass == "" {
+		if cfg, err := repository.Config(); err == nil {
+			askPass, _ = cfg.Get("core.askPass")
+		}
+	}
+	if askPass == "" {
+		askPass = os.Getenv("SSH_ASKPASS")
+	}
+	if askPass != "" {
+		command := exec.Command(askPass, prompt)
+		command.Stderr = stderr
+		output, err := command.Output()
+		if err != nil {
+			return "", fmt.Errorf("error: unable to read askpass response from '%v'\nfatal: could not read %v%w", askPass, prompt, err)
+		}
+		return strings.TrimRight(string(output), "\r\n"), nil
+	}
+
+	if value := os.Getenv("GIT_TERMINAL_PROMPT"); value == "0" || value == "false" {
+		return "", failure.Fatalf("fatal: could not read %vterminal prompts disabled", prompt)
+	}
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", failure.Fatalf("fatal: could not read %vNo such device or address", prompt)
+	}
+	defer tty.Close()
+	if !echo {
+		stty := func(mode string) {
+			command := exec.Command("stty", mode)
+			command.Stdin = tty
+			command.Run()
+		}
+		stty("-echo")
+		defer func() {
+			stty("echo")
+			fmt.Fprintln(tty)
+		}()
+	}
+	fmt.Fprint(tty, prompt)
+	line, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil && line == "" {
+		return "", failure.Fatalf("fatal: could not read %v%w", prompt, err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
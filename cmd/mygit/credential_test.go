@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// serveGitHTTP serves the repositories under root through git http-backend,
+// asking for user and whatever *password holds when it is set.
+func serveGitHTTP(t *testing.T, root string, user string, password *string) string {
+	t.Helper()
+	out, err := exec.Command("git", "--exec-path").Output()
+	if err != nil {
+		t.Skip("git has no exec path:", err)
+	}
+	backend := &cgi.Handler{
+		Path: filepath.Join(strings.TrimSpace(string(out)), "git-http-backend"),
+		Env:  []string{"GIT_PROJECT_ROOT=" + root, "GIT_HTTP_EXPORT_ALL=1", "REMOTE_USER=" + user},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if name, given, ok := r.BasicAuth(); *password != "" && (!ok || name != user || given != *password) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="git"`)
+			http.Error(w, "authentication required", http.StatusUnauthorized)
+			return
+		}
+		backend.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestHTTPCredentialsFromURLAskpassAndHelpers(t *testing.T) {
+	requireGit(t)
+	base := setupTest(t)
+	bare := filepath.Join(base, "repo.git")
+	runGit(t, base, "init", "-q", "--bare", "-b", "main", bare)
+	runGit(t, bare, "config", "http.receivepack", "true")
+	work := filepath.Join(base, "work")
+	mygit(t, base, "init", work)
+	first := commitFile(t, work, "a", "a\n", "one")
+	password := "token"
+	server := serveGitHTTP(t, base, "user", &password)
+	host := strings.TrimPrefix(server, "http://")
+	t.Setenv("GIT_TERMINAL_PROMPT", "0")
+
+	// Credentials in the URL are sent as they are.
+	withUser := "http://user:token@" + host + "/repo.git"
+	if _, stderr, code := runIn(t, work, "", "push", withUser, "main"); code != 0 {
+		t.Fatalf("push with credentials in the URL: exit %v\n%v", code, stderr)
+	}
+	if got := strings.TrimSpace(runGit(t, bare, "rev-parse", "main")); got != first {
+		t.Errorf("main after the push = %v, want %v", got, first)
+	}
+	anonymous := server + "/repo.git"
+	if _, stderr, code := runIn(t, base, "", "ls-remote", anonymous); code != 128 || !strings.Contains(stderr, "terminal prompts disabled") {
+		t.Errorf("ls-remote with no way to ask for credentials: exit %v\n%v", code, stderr)
+	}
+
+	// GIT_ASKPASS answers both prompts, and the helper is given what worked.
+	prompts, stored := filepath.Join(base, "prompts"), filepath.Join(base, "stored")
+	writeFile(t, base, "askpass", "#!/bin/sh\necho \"$1\" >>"+prompts+"\ncase \"$1\" in Username*) echo user ;; *) echo token ;; esac\n")
+	if err := os.Chmod(filepath.Join(base, "askpass"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GIT_ASKPASS", filepath.Join(base, "askpass"))
+	helper := "!f() { case $1 in get) cat " + stored + " 2>/dev/null ;; store) grep = >" + stored + " ;; erase) echo erased >>" + prompts + "; rm -f " + stored + " ;; esac; }; f"
+	mygit(t, base, "config", "--global", "credential.helper", helper)
+	if _, stderr, code := runIn(t, base, "", "clone", anonymous, "clone"); code != 0 {
+		t.Fatalf("clone answering askpass: exit %v\n%v", code, stderr)
+	}
+	if got, err := os.ReadFile(prompts); err != nil || string(got) != "Username for '"+server+"': \nPassword for 'http://user@"+host+"': \n" {
+		t.Errorf("askpass was asked:\n%s%v", got, err)
+	}
+	if got, err := os.ReadFile(stored); err != nil || string(got) != "protocol=http\nhost="+host+"\nusername=user\npassword=token\n" {
+		t.Errorf("the helper stored:\n%s%v", got, err)
+	}
+
+	// The stored credential is used without asking, and erased once refused.
+	os.Remove(prompts)
+	t.Setenv("GIT_ASKPASS", "")
+	os.Unsetenv("GIT_ASKPASS")
+	clone := filepath.Join(base, "clone")
+	if _, stderr, code := runIn(t, clone, "", "fetch"); code != 0 {
+		t.Errorf("fetch with a stored credential: exit %v\n%v", code, stderr)
+	}
+	password = "changed"
+	if _, stderr, code := runIn(t, clone, "", "fetch"); code != 128 || !strings.Contains(stderr, "Authentication failed for '"+anonymous+"/'") {
+		t.Errorf("fetch with a stale credential: exit %v\n%v", code, stderr)
+	}
+	if got, _ := os.ReadFile(prompts); string(got) != "erased\n" {
+		t.Errorf("the refused credential was not erased: %q", got)
+	}
+	if _, err := os.Stat(stored); err == nil {
+		t.Errorf("the helper still holds the refused credential")
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+)
+
+// daemon serves repositories over the git:// protocol. Each connection
+// opens with a "<service> <path>\0host=<host>\0" request, and the service,
+// run as a separate mygit, then talks to the client over the connection.
+// Like git daemon, it only serves repositories holding a
+// git-daemon-export-ok file unless --export-all is given, only those under
+// the directories listed when there are any, and serves receive-pack only
+// with --enable=receive-pack.
+func daemon(args []string, stderr io.Writer) error {
+	listen, port, basePath := "", "9418", ""
+	exportAll, receivePack := false, false
+	whitelist := make([]string, 0)
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "--listen="):
+			listen = strings.TrimPrefix(arg, "--listen=")
+		case strings.HasPrefix(arg, "--port="):
+			port = strings.TrimPrefix(arg, "--port=")
+			if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+				return failure.Fatalf("fatal: invalid port number '%v'", port)
+			}
+		case strings.HasPrefix(arg, "--base-path="):
+			basePath = strings.TrimPrefix(arg, "--base-path=")
+		case arg == "--export-all":
+			exportAll = true
+		case arg == "--enable=receive-pack":
+			receivePack = true
+		case strings.HasPrefix(arg, "-"):
+			return failure.Usage("usage: git daemon [--listen=<host>] [--port=<n>] [--base-path=<path>] [--export-all] [--enable=receive-pack] [<directory>...]")
+		default:
+			dir, err := filepath.Abs(arg)
+			if err != nil {
+				return err
+			}
+			whitelist = append(whitelist, dir)
+		}
+	}
+	program, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort(listen, port))
+	if err != nil {
+		return failure.Fatalf("fatal: unable to allocate any listen sockets on port %v: %w", port, err)
+	}
+	defer listener.Close()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			if err := serveDaemonConnection(conn.(*net.TCPConn), program, basePath, exportAll, receivePack, whitelist, stderr); err != nil {
+				fmt.Fprintf(stderr, "[%v] %v\n", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// serveDaemonConnection reads one client's request and, when the
+// repository may be served, runs the service with the connection as its
+// stdin and stdout and its stderr going to the daemon's. Refusals are sent
+// to the client as an ERR line.
+func serveDaemonConnection(conn *net.TCPConn, program string, basePath string, exportAll bool, receivePack bool, whitelist []string, stderr io.Writer) error {
+	// The request is read straight from the connection, so nothing the
+	// client sends after it is left behind in a buffer.
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	length, err := strconv.ParseUint(string(header), 16, 16)
+	if err != nil || length <= 4 {
+		return fmt.Errorf("Invalid pkt-line length %q", header)
+	}
+	line := make([]byte, length-4)
+	if _, err := io.ReadFull(conn, line); err != nil {
+		return err
+	}
+	request, _, _ := strings.Cut(strings.TrimSuffix(string(line), "\n"), "\x00")
+	service, path, _ := strings.Cut(request, " ")
+	refuse := func(message string) error {
+		io.WriteString(conn, pktLine("ERR "+message+"\n"))
+		return errors.New(message)
+	}
+
+	switch {
+	case service == "git-upload-pack":
+	case service == "git-receive-pack" && receivePack:
+	case service == "git-receive-pack":
+		return refuse("service not enabled: '" + strings.TrimPrefix(service, "git-") + "'")
+	default:
+		return refuse("unknown service: '" + service + "'")
+	}
+	if !strings.HasPrefix(path, "/") || slices.Contains(strings.Split(path, "/"), "..") {
+		return refuse("'" + path + "': not a valid path")
+	}
+	dir := path
+	if basePath != "" {
+		dir = filepath.Join(basePath, path)
+	}
+	gitDir, _, err := findRepository(dir)
+	if err == nil && !exportAll && !fileExists(filepath.Join(gitDir, "git-daemon-export-ok")) {
+		err = errors.New("not exported")
+	}
+	if err == nil && len(whitelist) > 0 && !slices.ContainsFunc(whitelist, func(dir string) bool {
+		relative, err := filepath.Rel(dir, gitDir)
+		return err == nil && relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator))
+	}) {
+		err = errors.New("not whitelisted")
+	}
+	if err != nil {
+		return refuse("access denied or repository not exported: " + path)
+	}
+
+	file, err := conn.File()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	command := exec.Command(program, strings.TrimPrefix(service, "git-"), dir)
+	command.Stdin, command.Stdout, command.Stderr = file, file, stderr
+	return command.Run()
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+	"github.com/codecrafters-io/git-starter-go/pkg/objects"
+)
+
+// describeName is a ref describe can name a commit after. prio ranks the
+// kinds: annotated tags 2, lightweight tags 1 and, with --all, other refs 0.
+type describeName struct {
+	path string
+	prio int
+	tag  *objects.Tag
+}
+
+// describeCandidate is a name found on the way back from the commit being
+// described. depth counts the commits walked that it does not reach, flag
+// marks those it does, and order is when it was found.
+type describeCandidate struct {
+	name  *describeName
+	depth int
+	flag  uint
+	order int
+}
+
+// describeOptions are the options of describe.
+type describeOptions struct {
+	tags, all, always, long, firstParent bool
+	abbrev, candidates                   int
+	patterns, excludes                   []string
+}
+
+// describeSeen marks a commit the walk has reached; the bits below it are
+// the candidates' flags.
+const describeSeen = 1 << 31
+
+// describe names commits after the nearest annotated tag they can reach:
+// the tag itself for a tagged commit and "<tag>-<n>-g<abbrev>" otherwise,
+// n counting the commits since the tag. --tags also uses lightweight tags
+// and --all any ref; --always falls back to an abbreviated name. With
+// --dirty, a worktree or index differing from HEAD adds "-dirty".
+func describe(args []string, stdout io.Writer, stderr io.Writer) error {
+	options := describeOptions{abbrev: 7, candidates: 10}
+	dirty, dirtyMark := false, ""
+	revisions := make([]string, 0, 1)
+	for index := 0; index < len(args); index++ {
+		arg := args[index]
+		switch {
+		case arg == "--tags":
+			options.tags = true
+		case arg == "--all":
+			options.all = true
+		case arg == "--always":
+			options.always = true
+		case arg == "--long":
+			options.long = true
+		case arg == "--first-parent":
+			options.firstParent = true
+		case arg == "--exact-match":
+			options.candidates = 0
+		case arg == "--dirty" || strings.HasPrefix(arg, "--dirty="):
+			dirty, dirtyMark = true, "-dirty"
+			if mark, ok := strings.CutPrefix(arg, "--dirty="); ok {
+				dirtyMark = mark
+			}
+		case strings.HasPrefix(arg, "--abbrev="):
+			value, err := strconv.Atoi(strings.TrimPrefix(arg, "--abbrev="))
+			if err != nil {
+				return failure.Usagef("error: option `abbrev' expects a numerical value")
+			}
+			options.abbrev = value
+		case strings.HasPrefix(arg, "--candidates="):
+			value, err := strconv.Atoi(strings.TrimPrefix(arg, "--candidates="))
+			if err != nil {
+				return failure.Usagef("error: option `candidates' expects a numerical value")
+			}
+			options.candidates = value
+		case arg == "--match" && index+1 < len(args):
+			index++
+			options.patterns = append(options.patterns, args[index])
+		case strings.HasPrefix(arg, "--match="):
+			options.patterns = append(options.patterns, strings.TrimPrefix(arg, "--match="))
+		case arg == "--exclude" && index+1 < len(args):
+			index++
+			options.excludes = append(options.excludes, args[index])
+		case strings.HasPrefix(arg, "--exclude="):
+			options.excludes = append(options.excludes, strings.TrimPrefix(arg, "--exclude="))
+		case strings.HasPrefix(arg, "-"):
+			return failure.Usage("usage: git describe [<options>] [<commit-ish>...]")
+		default:
+			revisions = append(revisions, arg)
+		}
+	}
+	if options.abbrev != 0 {
+		options.abbrev = min(max(options.abbrev, 4), 2*repository.Algorithm.Size())
+	}
+	// Each candidate needs a flag bit of its own.
+	options.candidates = min(max(options.candidates, 0), 30)
+	if dirty && len(revisions) > 0 {
+		return failure.Fatal("fatal: option '--dirty' and commit-ishes cannot be used together")
+	}
+	if len(revisions) == 0 {
+		revisions = append(revisions, "HEAD")
+	}
+
+	names, err := describeNames(options)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 && !options.always {
+		return failure.Fatal("fatal: No names found, cannot describe anything.")
+	}
+	suffix := ""
+	if dirty {
+		report, err := collectStatus()
+		if err != nil {
+			return err
+		}
+		if len(report.staged) > 0 || len(report.unstaged) > 0 || len(report.unmerged) > 0 {
+			suffix = dirtyMark
+		}
+	}
+	for _, revision := range revisions {
+		sha, err := resolveRevision(revision)
+		if err != nil {
+			return failure.Fatalf("fatal: Not a valid object name %v", revision)
+		}
+		commitSHA, err := peelObject(sha, "commit")
+		if err != nil {
+			return failure.Fatalf("fatal: %v is neither a commit nor blob", revision)
+		}
+		description, err := describeCommit(commitSHA, names, options, stderr)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, description+suffix)
+	}
+	return nil
+}
+
+// describeNames collects the refs describe may use, by the commit each one
+// leads to. Where several lead to the same commit the highest prio wins,
+// and between annotated tags the newest.
+func describeNames(options describeOptions) (map[string]*describeName, error) {
+	list, err := repository.Refs.List("refs/")
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]*describeName)
+	for _, ref := range list {
+		match, isTag := strings.CutPrefix(ref.Name, "refs/tags/")
+		if !isTag {
+			if !options.all {
+				continue
+			}
+			// With patterns, only branches and remote-tracking branches
+			// are matched along with tags.
+			heads, isHead := strings.CutPrefix(ref.Name, "refs/heads/")
+			remotes, isRemote := strings.CutPrefix(ref.Name, "refs/remotes/")
+			if len(options.patterns) > 0 || len(options.excludes) > 0 {
+				if !isHead && !isRemote {
+					continue
+				}
+			}
+			match = heads + remotes
+		}
+		if len(options.patterns) > 0 && !matchesAnyPattern(options.patterns, match) {
+			continue
+		}
+		if matchesAnyPattern(options.excludes, match) {
+			continue
+		}
+		if !repository.HasObject(ref.SHA) {
+			continue
+		}
+
+		name := &describeName{path: strings.TrimPrefix(ref.Name, "refs/tags/")}
+		if options.all {
+			name.path = strings.TrimPrefix(ref.Name, "refs/")
+		}
+		peeled, err := peelTags(ref.SHA)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case peeled != ref.SHA:
+			name.prio = 2
+			if name.tag, err = repository.ReadTag(ref.SHA); err != nil {
+				return nil, err
+			}
+		case isTag:
+			name.prio = 1
+		}
+		existing := names[peeled]
+		replace := existing == nil || existing.prio < name.prio
+		if existing != nil && existing.prio == 2 && name.prio == 2 {
+			replace = describeTagDate(existing.tag).Before(describeTagDate(name.tag))
+		}
+		if replace {
+			names[peeled] = name
+		}
+	}
+	return names, nil
+}
+
+// matchesAnyPattern reports whether name matches one of the glob patterns.
+func matchesAnyPattern(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// describeTagDate is when an annotated tag was made, the zero time when it
+// does not say.
+func describeTagDate(tag *objects.Tag) time.Time {
+	return parseSignature(tag.Tagger).when
+}
+
+// describeCommit names one commit. It walks back newest first,
+// noting up to options.candidates names as they turn up with how many
+// commits walked so far they cannot reach, until the walk is down to
+// history an annotated tag covers. The name reaching the most of it wins,
+// the first found on a tie.
+func describeCommit(sha string, names map[string]*describeName, options describeOptions, stderr io.Writer) (string, error) {
+	if name := names[sha]; name != nil && (options.tags || options.all || name.prio == 2) {
+		description, misnamed := describeNameString(name, options, stderr)
+		if misnamed || options.long {
+			suffix, err := describeSuffix(0, sha, options)
+			if err != nil {
+				return "", err
+			}
+			description += suffix
+		}
+		return description, nil
+	}
+	if options.candidates == 0 {
+		return "", failure.Fatalf("fatal: no tag exactly matches '%v'", sha)
+	}
+
+	walk := &describeWalk{flags: make(map[string]uint), commits: make(map[string]*Commit)}
+	walk.flags[sha] = describeSeen
+	if err := walk.insert(sha); err != nil {
+		return "", err
+	}
+
+	matches := make([]*describeCandidate, 0, options.candidates)
+	annotated, unannotated, seenCommits := 0, 0, 0
+	var gaveUpOn *Commit
+	for len(walk.list) > 0 && gaveUpOn == nil {
+		commit := walk.pop()
+		seenCommits++
+		if name := names[commit.sha]; name != nil {
+			switch {
+			case !options.tags && !options.all && name.prio < 2:
+				unannotated++
+			case len(matches) < options.candidates:
+				candidate := &describeCandidate{name: name, depth: seenCommits - 1, flag: 1 << len(matches), order: len(matches)}
+				matches = append(matches, candidate)
+				walk.flags[commit.sha] |= candidate.flag
+				if name.prio == 2 {
+					annotated++
+				}
+			default:
+				gaveUpOn = commit
+				continue
+			}
+		}
+		for _, candidate := range matches {
+			if walk.flags[commit.sha]&candidate.flag == 0 {
+				candidate.depth++
+			}
+		}
+		// Nothing left to walk that the annotated tags found do not cover.
+		if annotated > 0 && len(walk.list) == 0 {
+			break
+		}
+		if err := walk.parents(commit, options.firstParent); err != nil {
+			return "", err
+		}
+	}
+
+	if len(matches) == 0 {
+		if options.always {
+			return abbreviateSHA(sha, max(options.abbrev, 4))
+		}
+		if unannotated > 0 {
+			return "", failure.Fatalf("fatal: No annotated tags can describe '%v'.\nHowever, there were unannotated tags: try --tags.", sha)
+		}
+		return "", failure.Fatalf("fatal: No tags can describe '%v'.\nTry --always, or create some tags.", sha)
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].depth != matches[j].depth {
+			return matches[i].depth < matches[j].depth
+		}
+		return matches[i].order < matches[j].order
+	})
+	best := matches[0]
+	if gaveUpOn != nil {
+		if err := walk.insert(gaveUpOn.sha); err != nil {
+			return "", err
+		}
+	}
+	if err := walk.finishDepth(best, options.firstParent); err != nil {
+		return "", err
+	}
+
+	description, misnamed := describeNameString(best.name, options, stderr)
+	if misnamed || options.abbrev != 0 {
+		suffix, err := describeSuffix(best.depth, sha, options)
+		if err != nil {
+			return "", err
+		}
+		description += suffix
+	}
+	return description, nil
+}
+
+// describeNameString is how a name is written. An annotated tag goes by the
+// name it has inside; when its ref calls it something else there is a
+// warning, and, to tell it apart, the name is never left bare.
+func describeNameString(name *describeName, options describeOptions, stderr io.Writer) (string, bool) {
+	if name.tag == nil {
+		return name.path, false
+	}
+	misnamed := name.tag.Name != strings.TrimPrefix(name.path, "tags/")
+	if misnamed {
+		fmt.Fprintf(stderr, "warning: tag '%v' is externally known as '%v'\n", name.path, name.tag.Name)
+	}
+	if options.all {
+		return "tags/" + name.tag.Name, misnamed
+	}
+	return name.tag.Name, misnamed
+}
+
+// describeSuffix is the "-<depth>-g<abbrev>" following a name, the object
+// name in full when --abbrev=0 left it to be forced.
+func describeSuffix(depth int, sha string, options describeOptions) (string, error) {
+	abbreviated := sha
+	if options.abbrev != 0 {
+		var err error
+		if abbreviated, err = abbreviateSHA(sha, options.abbrev); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("-%v-g%v", depth, abbreviated), nil
+}
+
+// describeWalk is describe's walk back through history: the commits still
+// to visit, newest first, and the flags each commit reached has, from the
+// commits it was reached from.
+type describeWalk struct {
+	list    []*Commit
+	flags   map[string]uint
+	commits map[string]*Commit
+}
+
+// insert queues a commit after those at least as new.
+func (walk *describeWalk) insert(sha string) error {
+	commit := walk.commits[sha]
+	if commit == nil {
+		var err error
+		if commit, err = readCommit(sha); err != nil {
+			return err
+		}
+		walk.commits[sha] = commit
+	}
+	when := parseSignature(commit.Committer).when
+	position := sort.Search(len(walk.list), func(index int) bool {
+		return parseSignature(walk.list[index].Committer).when.Before(when)
+	})
+	walk.list = append(walk.list, nil)
+	copy(walk.list[position+1:], walk.list[position:])
+	walk.list[position] = commit
+	return nil
+}
+
+// pop takes the newest commit off the list.
+func (walk *describeWalk) pop() *Commit {
+	commit := walk.list[0]
+	walk.list = walk.list[1:]
+	return commit
+}
+
+// parents queues the parents of commit not yet reached, first or all, and
+// hands them its flags.
+func (walk *describeWalk) parents(commit *Commit, firstParent bool) error {
+	for _, parent := range commit.Parents {
+		if walk.flags[parent]&describeSeen == 0 {
+			walk.flags[parent] |= describeSeen
+			if err := walk.insert(parent); err != nil {
+				return err
+			}
+		}
+		walk.flags[parent] |= walk.flags[commit.sha]
+		if firstParent {
+			break
+		}
+	}
+	return nil
+}
+
+// finishDepth goes on walking to count every commit best does not reach,
+// stopping once all that is left to walk is history best reaches.
+func (walk *describeWalk) finishDepth(best *describeCandidate, firstParent bool) error {
+	for len(walk.list) > 0 {
+		commit := walk.pop()
+		if walk.flags[commit.sha]&best.flag != 0 {
+			covered := true
+			for _, queued := range walk.list {
+				if walk.flags[queued.sha]&best.flag == 0 {
+					covered = false
+					break
+				}
+			}
+			if covered {
+				return nil
+			}
+		} else {
+			best.depth++
+		}
+		if err := walk.parents(commit, firstParent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDescribeMatchesGit(t *testing.T) {
+	requireGit(t)
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	version := 0
+	commit := func() string {
+		t.Helper()
+		version++
+		t.Setenv("GIT_COMMITTER_DATE", strconv.Itoa(1700000000+100*version)+" +0000")
+		return commitFile(t, dir, "f"+strconv.Itoa(version), "x\n", "c"+strconv.Itoa(version))
+	}
+
+	// No tags yet.
+	if _, stderr, code := runIn(t, dir, "", "describe"); code != 128 || !strings.Contains(stderr, "fatal: No names found, cannot describe anything.") {
+		t.Errorf("describe with no tags: exit %v\n%v", code, stderr)
+	}
+	first := commit()
+	if got := mygit(t, dir, "describe", "--always"); got != first[:7]+"\n" {
+		t.Errorf("describe --always with no tags = %q", got)
+	}
+
+	mygit(t, dir, "tag", "-a", "-m", "v1", "v1.0")
+	commit()
+	mygit(t, dir, "tag", "light")
+	commit()
+	mygit(t, dir, "branch", "side")
+	commit()
+	mygit(t, dir, "tag", "-a", "-m", "rc", "v2.0-rc1")
+	mygit(t, dir, "checkout", "side")
+	commit()
+	mygit(t, dir, "tag", "-a", "-m", "side", "side-tag")
+	commit()
+	mygit(t, dir, "checkout", "main")
+	commit()
+	mygit(t, dir, "merge", "-m", "merge side", "side")
+
+	for _, args := range [][]string{
+		{},
+		{"--tags"},
+		{"--all"},
+		{"--long"},
+		{"--abbrev=4"},
+		{"--abbrev=0"},
+		{"--first-parent"},
+		{"--match", "v*"},
+		{"--match=v1*", "--long"},
+		{"--exclude", "*rc*"},
+		{"--candidates=1"},
+		{"--tags", "HEAD~1"},
+		{"v1.0"},
+		{"--exact-match", "v2.0-rc1"},
+		{"--tags", "side~1"},
+		{first},
+	} {
+		args = append([]string{"describe"}, args...)
+		if got, want := mygit(t, dir, args...), runGit(t, dir, args...); got != want {
+			t.Errorf("mygit %v:\n%v\ngit:\n%v", strings.Join(args, " "), got, want)
+		}
+	}
+
+	writeFile(t, dir, "f1", "changed\n")
+	if got, want := mygit(t, dir, "describe", "--dirty"), runGit(t, dir, "describe", "--dirty"); got != want {
+		t.Errorf("mygit describe --dirty = %q, git %q", got, want)
+	}
+	if got, want := mygit(t, dir, "describe", "--dirty=.mod"), runGit(t, dir, "describe", "--dirty=.mod"); got != want {
+		t.Errorf("mygit describe --dirty=.mod = %q, git %q", got, want)
+	}
+	if _, stderr, code := runIn(t, dir, "", "describe", "--exact-match", "HEAD"); code != 128 || !strings.Contains(stderr, "fatal: no tag exactly matches") {
+		t.Errorf("describe --exact-match of an untagged commit: exit %v\n%v", code, stderr)
+	}
+}
@@ -0,0 +1,565 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+	"github.com/codecrafters-io/git-starter-go/pkg/diff"
+)
+
+// DiffFile is one side of a file comparison. Worktree files are read from
+// disk; all others come from the object store.
+type DiffFile struct {
+	TreeFile
+	inWorktree bool
+}
+
+type diffOptions struct {
+	context    int
+	nameOnly   bool
+	nameStatus bool
+	quiet      bool
+	exitCode   bool
+	pathspecs  []string
+}
+
+// gitDiff compares the worktree with the index by default, the index with
+// HEAD (or a commit) with --cached, the worktree with a commit given one
+// revision, and two commits given two (or "A..B").
+func gitDiff(args []string, stdout io.Writer) error {
+	options := diffOptions{context: 3}
+	cached := false
+	revisions := make([]string, 0, 2)
+	for index := 0; index < len(args); index++ {
+		arg := args[index]
+		switch {
+		case arg == "--":
+			options.pathspecs = append(options.pathspecs, args[index+1:]...)
+			index = len(args)
+		case arg == "--cached" || arg == "--staged":
+			cached = true
+		case arg == "--name-only":
+			options.nameOnly = true
+		case arg == "--name-status":
+			options.nameStatus = true
+		case arg == "--exit-code":
+			options.exitCode = true
+		case arg == "--quiet":
+			options.quiet, options.exitCode = true, true
+		case strings.HasPrefix(arg, "-U") || strings.HasPrefix(arg, "--unified="):
+			value := strings.TrimPrefix(strings.TrimPrefix(arg, "-U"), "--unified=")
+			context, err := strconv.Atoi(value)
+			if err != nil || context < 0 {
+				return failure.Usagef("error: %v expects a non-negative integer value", arg)
+			}
+			options.context = context
+		case strings.HasPrefix(arg, "-"):
+			return failure.Usagef("error: invalid option: %v", arg)
+		case strings.Contains(arg, ".."):
+			from, to, _ := strings.Cut(arg, "..")
+			revisions = append(revisions, defaultRevision(from), defaultRevision(to))
+		default:
+			if _, err := resolveRevision(arg); err == nil {
+				revisions = append(revisions, arg)
+				continue
+			}
+			if path, err := worktreePath(arg); err == nil {
+				if _, err := os.Lstat(path); err == nil {
+					options.pathspecs = append(options.pathspecs, arg)
+					continue
+				}
+			}
+			return failure.Fatalf("fatal: ambiguous argument '%v': unknown revision or path not in the working tree.", arg)
+		}
+	}
+	for index, path := range options.pathspecs {
+		pathspec, err := worktreePath(path)
+		if err != nil {
+			return err
+		}
+		options.pathspecs[index] = pathspec
+	}
+
+	var oldFiles, newFiles map[string]DiffFile
+	var err error
+	switch {
+	case len(revisions) > 2 || cached && len(revisions) > 1:
+		return failure.Usage("usage: diff [--cached [<commit>]] [<commit> [<commit>]] [--] [<path>...]")
+	case len(revisions) == 2:
+		if oldFiles, err = revisionFiles(revisions[0]); err == nil {
+			newFiles, err = revisionFiles(revisions[1])
+		}
+	case cached:
+		if len(revisions) == 1 {
+			oldFiles, err = revisionFiles(revisions[0])
+		} else {
+			oldFiles, err = headDiffFiles()
+		}
+		if err == nil {
+			newFiles, err = indexDiffFiles()
+		}
+	default:
+		if repository.WorkTree == "" {
+			return failure.Fatal("fatal: this operation must be run in a work tree")
+		}
+		if len(revisions) == 1 {
+			oldFiles, err = revisionFiles(revisions[0])
+		} else {
+			oldFiles, err = indexDiffFiles()
+		}
+		if err == nil {
+			newFiles, err = worktreeDiffFiles()
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	changed, err := writeDiff(oldFiles, newFiles, options, stdout)
+	if err != nil {
+		return err
+	}
+	if changed && options.exitCode {
+		return errSilentFailure
+	}
+	return nil
+}
+
+func defaultRevision(revision string) string {
+	if revision == "" {
+		return "HEAD"
+	}
+	return revision
+}
+
+func treeDiffFiles(files map[string]TreeFile) map[string]DiffFile {
+	diffFiles := make(map[string]DiffFile, len(files))
+	for path, file := range files {
+		diffFiles[path] = DiffFile{TreeFile: file}
+	}
+	return diffFiles
+}
+
+func revisionFiles(revision string) (map[string]DiffFile, error) {
+	sha, err := resolveRevision(revision)
+	if err != nil {
+		return nil, failure.Fatalf("fatal: ambiguous argument '%v': unknown revision or path not in the working tree.", revision)
+	}
+	treeSHA, err := peelObject(sha, "tree")
+	if err != nil {
+		return nil, err
+	}
+	files, err := flattenTree(treeSHA)
+	if err != nil {
+		return nil, err
+	}
+	return treeDiffFiles(files), nil
+}
+
+func headDiffFiles() (map[string]DiffFile, error) {
+	files, err := headTreeFiles()
+	if err != nil {
+		return nil, err
+	}
+	return treeDiffFiles(files), nil
+}
+
+func indexDiffFiles() (map[string]DiffFile, error) {
+	entries, err := readIndex()
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]DiffFile, len(entries))
+	for _, entry := range entries {
+		if entry.stage() == 0 {
+			files[entry.path] = DiffFile{TreeFile: TreeFile{mode: fmt.Sprintf("%o", entry.mode), hash: entry.hash}}
+		}
+	}
+	return files, nil
+}
+
+// worktreeDiffFiles describes the tracked files as they are on disk. Files
+// whose stat data still matches the index keep the index's blob rather than
+// being rehashed.
+func worktreeDiffFiles() (map[string]DiffFile, error) {
+	entries, err := readIndex()
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]DiffFile, len(entries))
+	for _, entry := range entries {
+		if entry.stage() != 0 {
+			continue
+		}
+		info, err := os.Lstat(entry.path)
+		if err != nil {
+			continue
+		}
+		if entry.mode != 0160000 && indexEntryMatchesStat(entry, info) && fs.FileMode(entry.mode)&0111 == info.Mode()&0111 {
+			files[entry.path] = DiffFile{TreeFile: TreeFile{mode: fmt.Sprintf("%o", entry.mode), hash: entry.hash}}
+			continue
+		}
+		file, err := worktreeEntryFile(entry, info)
+		if err != nil {
+			return nil, err
+		}
+		files[entry.path] = DiffFile{TreeFile: file, inWorktree: true}
+	}
+	return files, nil
+}
+
+func matchesPathspecs(path string, pathspecs []string) bool {
+	if len(pathspecs) == 0 {
+		return true
+	}
+	for _, pathspec := range pathspecs {
+		if pathspec == "." || path == pathspec || strings.HasPrefix(path, pathspec+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// writeDiff prints the differences between two sets of files in path order
+// and reports whether there were any.
+func writeDiff(oldFiles, newFiles map[string]DiffFile, options diffOptions, stdout io.Writer) (bool, error) {
+	paths := make([]string, 0, len(newFiles))
+	for path := range oldFiles {
+		paths = append(paths, path)
+	}
+	for path := range newFiles {
+		if _, ok := oldFiles[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	changed := false
+	for _, path := range paths {
+		if !matchesPathspecs(path, options.pathspecs) {
+			continue
+		}
+		oldFile, inOld := oldFiles[path]
+		newFile, inNew := newFiles[path]
+		if inOld && inNew && oldFile.mode == newFile.mode && bytes.Equal(oldFile.hash, newFile.hash) {
+			continue
+		}
+		changed = true
+		switch {
+		case options.quiet:
+			return true, nil
+		case options.nameOnly:
+			fmt.Fprintln(stdout, quotePath(path, false))
+		case options.nameStatus:
+			status := "M"
+			if !inOld {
+				status = "A"
+			} else if !inNew {
+				status = "D"
+			}
+			fmt.Fprintf(stdout, "%v\t%v\n", status, quotePath(path, false))
+		default:
+			var oldPtr, newPtr *DiffFile
+			if inOld {
+				oldPtr = &oldFile
+			}
+			if inNew {
+				newPtr = &newFile
+			}
+			if err := writeFileDiff(path, oldPtr, newPtr, options.context, stdout); err != nil {
+				return changed, err
+			}
+		}
+	}
+	return changed, nil
+}
+
+// writeFileDiff prints the "diff --git" header and hunks for one path. A nil
+// side means the file does not exist there.
+func writeFileDiff(path string, oldFile, newFile *DiffFile, context int, stdout io.Writer) error {
+	var output bytes.Buffer
+	oldName, newName := diffPathName("a/", path), diffPathName("b/", path)
+	fmt.Fprintf(&output, "diff --git %v %v\n", oldName, newName)
+
+	oldHash, newHash := zeroSHA(), zeroSHA()
+	if oldFile != nil {
+		oldHash = hex.EncodeToString(oldFile.hash)
+	}
+	if newFile != nil {
+		newHash = hex.EncodeToString(newFile.hash)
+	}
+	modeSuffix := ""
+	switch {
+	case oldFile == nil:
+		fmt.Fprintf(&output, "new file mode %v\n", normalizeMode(newFile.mode))
+		oldName = "/dev/null"
+	case newFile == nil:
+		fmt.Fprintf(&output, "deleted file mode %v\n", normalizeMode(oldFile.mode))
+		newName = "/dev/null"
+	case oldFile.mode != newFile.mode:
+		fmt.Fprintf(&output, "old mode %v\nnew mode %v\n", normalizeMode(oldFile.mode), normalizeMode(newFile.mode))
+	default:
+		modeSuffix = " " + normalizeMode(newFile.mode)
+	}
+
+	if oldHash != newHash {
+		oldAbbrev, err := diffAbbrev(oldHash)
+		if err != nil {
+			return err
+		}
+		newAbbrev, err := diffAbbrev(newHash)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&output, "index %v..%v%v\n", oldAbbrev, newAbbrev, modeSuffix)
+
+		oldContent, err := diffContent(path, oldFile)
+		if err != nil {
+			return err
+		}
+		newContent, err := diffContent(path, newFile)
+		if err != nil {
+			return err
+		}
+		switch {
+		case diff.IsBinary(oldContent) || diff.IsBinary(newContent):
+			fmt.Fprintf(&output, "Binary files %v and %v differ\n", oldName, newName)
+		case len(oldContent) > 0 || len(newContent) > 0:
+			fmt.Fprintf(&output, "--- %v\n+++ %v\n", headerName(oldName), headerName(newName))
+			if err := diff.WriteUnified(&output, diff.SplitLines(oldContent), diff.SplitLines(newContent), context); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := stdout.Write(output.Bytes())
+	return err
+}
+
+// diffPathName prefixes a path with "a/" or "b/", quoting the result the
+// way git does when the path needs C-style escapes.
+func diffPathName(prefix string, path string) string {
+	quoted := quotePath(path, false)
+	if quoted == path {
+		return prefix + path
+	}
+	return `"` + prefix + strings.TrimPrefix(quoted, `"`)
+}
+
+// headerName terminates a "---" or "+++" name containing a space with a tab,
+// so the name's end is unambiguous.
+func headerName(name string) string {
+	if strings.Contains(name, " ") {
+		return name + "\t"
+	}
+	return name
+}
+
+func normalizeMode(mode string) string {
+	return fmt.Sprintf("%06s", mode)
+}
+
+// diffAbbrev shortens an object name for an "index" line; the all-zero name
+// of a missing side is shortened to the same length.
+func diffAbbrev(sha string) (string, error) {
+	if strings.Trim(sha, "0") == "" {
+		return sha[:7], nil
+	}
+	return abbreviateSHA(sha, 7)
+}
+
+// diffContent loads one side of a comparison: worktree files from disk,
+// gitlinks as git renders them, and everything else from its blob.
+func diffContent(path string, file *DiffFile) ([]byte, error) {
+	switch {
+	case file == nil:
+		return nil, nil
+	case file.mode == "160000":
+		return []byte(fmt.Sprintf("Subproject commit %x\n", file.hash)), nil
+	case file.inWorktree && file.mode == "120000":
+		target, err := os.Readlink(path)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading symlink %v: %w", path, err)
+		}
+		return []byte(target), nil
+	case file.inWorktree:
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading file %v: %w", path, err)
+		}
+		return repository.CleanContent(content), nil
+	}
+	blob, err := repository.ReadBlob(hex.EncodeToString(file.hash))
+	if err != nil {
+		return nil, err
+	}
+	return blob.Data, nil
+}
+
+// fileStat is one path's line of a diffstat.
+type fileStat struct {
+	path    string
+	added   int
+	deleted int
+	binary  bool
+	oldSize int
+	newSize int
+	oldMode string
+	newMode string
+	inOld   bool
+	inNew   bool
+}
+
+// writeDiffStat prints the diffstat and summary git shows after a merge:
+// a "path | count +++--" line per changed file, scaled to 80 columns, the
+// totals, and the files created, deleted or changing mode.
+func writeDiffStat(oldFiles, newFiles map[string]DiffFile, stdout io.Writer) error {
+	paths := make([]string, 0, len(newFiles))
+	for path := range oldFiles {
+		paths = append(paths, path)
+	}
+	for path := range newFiles {
+		if _, ok := oldFiles[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	stats := make([]fileStat, 0)
+	maxChange, maxName, insertions, deletions := 0, 0, 0, 0
+	for _, path := range paths {
+		oldFile, inOld := oldFiles[path]
+		newFile, inNew := newFiles[path]
+		if inOld && inNew && oldFile.mode == newFile.mode && bytes.Equal(oldFile.hash, newFile.hash) {
+			continue
+		}
+		stat := fileStat{path: quotePath(path, false), oldMode: oldFile.mode, newMode: newFile.mode, inOld: inOld, inNew: inNew}
+		var oldPtr, newPtr *DiffFile
+		if inOld {
+			oldPtr = &oldFile
+		}
+		if inNew {
+			newPtr = &newFile
+		}
+		oldContent, err := diffContent(path, oldPtr)
+		if err != nil {
+			return err
+		}
+		newContent, err := diffContent(path, newPtr)
+		if err != nil {
+			return err
+		}
+		if diff.IsBinary(oldContent) || diff.IsBinary(newContent) {
+			stat.binary, stat.oldSize, stat.newSize = true, len(oldContent), len(newContent)
+		} else {
+			for _, op := range diff.Lines(diff.SplitLines(oldContent), diff.SplitLines(newContent)) {
+				switch op.Kind {
+				case diff.Insert:
+					stat.added++
+				case diff.Delete:
+					stat.deleted++
+				}
+			}
+		}
+		insertions += stat.added
+		deletions += stat.deleted
+		maxChange = max(maxChange, stat.added+stat.deleted)
+		maxName = max(maxName, len(stat.path))
+		stats = append(stats, stat)
+	}
+	if len(stats) == 0 {
+		return nil
+	}
+
+	// The column widths follow git's show_stats for an 80 column line.
+	const width = 80
+	numberWidth := len(strconv.Itoa(maxChange))
+	for _, stat := range stats {
+		if stat.binary {
+			numberWidth = max(numberWidth, 3)
+		}
+	}
+	graphWidth, nameWidth := maxChange, maxName
+	if nameWidth+numberWidth+6+graphWidth > width {
+		if limit := width*3/8 - numberWidth - 6; graphWidth > limit {
+			graphWidth = max(limit, 6)
+		}
+		if nameWidth > width-numberWidth-6-graphWidth {
+			nameWidth = width - numberWidth - 6 - graphWidth
+		} else {
+			graphWidth = width - numberWidth - 6 - nameWidth
+		}
+	}
+	scale := func(count int) int {
+		if count == 0 {
+			return 0
+		}
+		return 1 + count*(graphWidth-1)/maxChange
+	}
+
+	var output bytes.Buffer
+	for _, stat := range stats {
+		name := stat.path
+		if len(name) > nameWidth {
+			name = "..." + name[len(name)-nameWidth+3:]
+		}
+		if stat.binary {
+			fmt.Fprintf(&output, " %-*v | %*v %v -> %v bytes\n", nameWidth, name, numberWidth, "Bin", stat.oldSize, stat.newSize)
+			continue
+		}
+		added, deleted := stat.added, stat.deleted
+		if graphWidth < maxChange {
+			total := scale(added + deleted)
+			if total < 2 && added > 0 && deleted > 0 {
+				total = 2
+			}
+			if added < deleted {
+				added = scale(added)
+				deleted = total - added
+			} else {
+				deleted = scale(deleted)
+				added = total - deleted
+			}
+		}
+		fmt.Fprintf(&output, " %-*v | %*v", nameWidth, name, numberWidth, stat.added+stat.deleted)
+		if added+deleted > 0 {
+			fmt.Fprintf(&output, " %v%v", strings.Repeat("+", added), strings.Repeat("-", deleted))
+		}
+		output.WriteString("\n")
+	}
+
+	plural := func(count int, word string) string {
+		if count == 1 {
+			return fmt.Sprintf("%v %v", count, word)
+		}
+		return fmt.Sprintf("%v %vs", count, word)
+	}
+	fmt.Fprintf(&output, " %v changed", plural(len(stats), "file"))
+	if insertions > 0 || deletions == 0 {
+		fmt.Fprintf(&output, ", %v(+)", plural(insertions, "insertion"))
+	}
+	if deletions > 0 || insertions == 0 {
+		fmt.Fprintf(&output, ", %v(-)", plural(deletions, "deletion"))
+	}
+	output.WriteString("\n")
+
+	for _, stat := range stats {
+		switch {
+		case !stat.inOld:
+			fmt.Fprintf(&output, " create mode %v %v\n", normalizeMode(stat.newMode), stat.path)
+		case !stat.inNew:
+			fmt.Fprintf(&output, " delete mode %v %v\n", normalizeMode(stat.oldMode), stat.path)
+		case stat.oldMode != stat.newMode:
+			fmt.Fprintf(&output, " mode change %v => %v %v\n", normalizeMode(stat.oldMode), normalizeMode(stat.newMode), stat.path)
+		}
+	}
+	_, err := stdout.Write(output.Bytes())
+	return err
+}
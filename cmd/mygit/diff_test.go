@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiffMatchesGit(t *testing.T) {
+	requireGit(t)
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	var long strings.Builder
+	for line := 1; line <= 40; line++ {
+		fmt.Fprintf(&long, "line %v\n", line)
+	}
+	writeFile(t, dir, "long", long.String())
+	writeFile(t, dir, "gone", "gone\n")
+	writeFile(t, dir, "noeol", "no newline")
+	writeFile(t, dir, "binary", "\x00\x01\x02")
+	mygit(t, dir, "add", ".")
+	mygit(t, dir, "commit", "-m", "one")
+
+	// Two hunks far apart, one near the end, a deletion, an addition, a
+	// file that gains its last newline and a changed binary file.
+	edited := strings.Replace(long.String(), "line 3\n", "line three\n", 1)
+	edited = strings.Replace(edited, "line 20\n", "", 1)
+	edited = strings.Replace(edited, "line 39\n", "line 39\ninserted\n", 1)
+	writeFile(t, dir, "long", edited)
+	if err := os.Remove(filepath.Join(dir, "gone")); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, dir, "noeol", "no newline\n")
+	writeFile(t, dir, "binary", "\x00\x01\x03")
+	writeFile(t, dir, "new", "new\n")
+
+	compare := func(args ...string) {
+		t.Helper()
+		if got, want := mygit(t, dir, args...), runGit(t, dir, args...); got != want {
+			t.Errorf("mygit %v:\n%v\ngit:\n%v", strings.Join(args, " "), got, want)
+		}
+	}
+	compare("diff")
+	compare("diff", "-U1")
+	compare("diff", "--name-status")
+	compare("diff", "long")
+
+	mygit(t, dir, "add", ".")
+	compare("diff", "--cached")
+	compare("diff", "--cached", "--name-only")
+	mygit(t, dir, "commit", "-m", "two")
+	compare("diff", "HEAD~1", "HEAD")
+	compare("diff", "HEAD~1..HEAD")
+
+	if _, _, code := runIn(t, dir, "", "diff", "--exit-code"); code != 0 {
+		t.Errorf("diff --exit-code with nothing changed exited %v", code)
+	}
+	writeFile(t, dir, "new", "changed\n")
+	if stdout, _, code := runIn(t, dir, "", "diff", "--quiet"); code != 1 || stdout != "" {
+		t.Errorf("diff --quiet with a change: exit %v\n%v", code, stdout)
+	}
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+	"github.com/codecrafters-io/git-starter-go/pkg/refs"
+)
+
+// refUpdate is one remote ref being copied into a local ref.
+type refUpdate struct {
+	remote string
+	local  string
+	sha    string
+	force  bool
+}
+
+// fetch downloads the objects a remote's refs need and updates the local
+// refs its refspecs map them to, refs/remotes/<remote>/* by default.
+// Annotated tags that point into the fetched history come along as well.
+// --depth cuts the fetched history, or deepens a shallow one, to that many
+// commits below each ref. Progress is shown on a terminal, or with
+// --progress, unless -q quiets the fetch. Once ctx is canceled no ref is
+// touched.
+func fetch(ctx context.Context, args []string, stderr io.Writer) error {
+	quiet, forceProgress := false, false
+	depth := 0
+	positional := make([]string, 0, 2)
+	for index := 0; index < len(args); index++ {
+		arg := args[index]
+		value, isDepth := strings.CutPrefix(arg, "--depth=")
+		if arg == "--depth" && index+1 < len(args) {
+			index++
+			value, isDepth = args[index], true
+		}
+		switch {
+		case isDepth:
+			var err error
+			if depth, err = parseDepth(value); err != nil {
+				return err
+			}
+		case arg == "-q" || arg == "--quiet":
+			quiet = true
+		case arg == "--progress":
+			forceProgress = true
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return failure.Usagef("error: unknown option `%v'", strings.TrimLeft(arg, "-"))
+			}
+			positional = append(positional, arg)
+		}
+	}
+	progress := progressOutput(stderr, quiet, forceProgress)
+	if quiet {
+		stderr = io.Discard
+	}
+
+	config, err := repository.Config()
+	if err != nil {
+		return err
+	}
+	remote := ""
+	if len(positional) > 0 {
+		remote = positional[0]
+	} else {
+		remote = "origin"
+		if headRef, isSymref, err := readHeadSymref(); err == nil && isSymref {
+			if configured, ok := config.Get("branch." + strings.TrimPrefix(headRef, "refs/heads/") + ".remote"); ok {
+				remote = configured
+			}
+		}
+	}
+	repoURL, ok := config.Get("remote." + remote + ".url")
+	specs := config.GetAll("remote." + remote + ".fetch")
+	if !ok {
+		if !isRemoteURL(remote) {
+			return failure.Fatalf("fatal: '%v' does not appear to be a git repository", remote)
+		}
+		// A bare URL fetches its HEAD into FETCH_HEAD only.
+		repoURL, specs = remote, []string{"HEAD"}
+	}
+	if len(positional) > 1 {
+		specs = positional[1:]
+	}
+	refspecs := make([]refs.Refspec, 0, len(specs))
+	for _, spec := range specs {
+		refspec, err := refs.ParseRefspec(spec)
+		if err != nil {
+			return err
+		}
+		refspecs = append(refspecs, refspec)
+	}
+	repoURL = strings.TrimSuffix(repoURL, "/")
+
+	// Protocol v2 servers only list the refs the refspecs can match, and the
+	// tags that may be followed.
+	prefixes := []string{"refs/tags/"}
+	for _, refspec := range refspecs {
+		prefix, _, _ := strings.Cut(refspec.Src, "*")
+		prefixes = append(prefixes, prefix)
+	}
+	connection, err := openUploadPack(ctx, repoURL, prefixes, stderr)
+	if err != nil {
+		return err
+	}
+	defer connection.close()
+	if err := checkObjectFormat(connection.algorithm); err != nil {
+		return err
+	}
+	advertised := connection.refs
+	updates := make([]refUpdate, 0, len(advertised))
+	for _, ref := range advertised {
+		for _, refspec := range refspecs {
+			if local, ok := refspec.Map(ref.name); ok {
+				updates = append(updates, refUpdate{remote: ref.name, local: local, sha: ref.sha, force: refspec.Force})
+				break
+			}
+		}
+	}
+
+	// Deepening has to ask for the tips we already have again.
+	wants := make([]string, 0, len(updates))
+	for _, update := range updates {
+		if (depth > 0 || !repository.HasObject(update.sha)) && !slices.Contains(wants, update.sha) {
+			wants = append(wants, update.sha)
+		}
+	}
+	if len(wants) > 0 {
+		haves, err := localTips()
+		if err != nil {
+			return err
+		}
+		shallow, err := repository.Shallow()
+		if err != nil {
+			return err
+		}
+		request := fetchRequest{wants: wants, haves: haves, depth: depth, progress: progress != nil}
+		for sha := range shallow {
+			request.shallow = append(request.shallow, sha)
+		}
+		slices.Sort(request.shallow)
+		response, err := connection.fetch(request, stderr)
+		if err != nil {
+			return err
+		}
+		if _, err := unpackObjects(ctx, response.pack, progress); err != nil {
+			return err
+		}
+		if err := updateShallow(response); err != nil {
+			return err
+		}
+	}
+
+	// Follow tags whose objects arrived with the pack (or were already here).
+	for _, ref := range advertised {
+		if !strings.HasPrefix(ref.name, "refs/tags/") || !repository.HasObject(ref.sha) {
+			continue
+		}
+		if _, err := repository.Refs.Read(ref.name); err == nil {
+			continue
+		}
+		followed := false
+		for _, update := range updates {
+			followed = followed || update.local == ref.name
+		}
+		if !followed {
+			updates = append(updates, refUpdate{remote: ref.name, local: ref.name, sha: ref.sha})
+		}
+	}
+
+	// The branch the current branch merges from is handled first
+	// when fetching from the remote it is configured with.
+	merge := ""
+	if headRef, isSymref, err := readHeadSymref(); err == nil && isSymref {
+		branchName := strings.TrimPrefix(headRef, "refs/heads/")
+		if branchRemote, _ := config.Get("branch." + branchName + ".remote"); branchRemote == remote {
+			merge, _ = config.Get("branch." + branchName + ".merge")
+		}
+	}
+	slices.SortStableFunc(updates, func(a, b refUpdate) int {
+		switch {
+		case a.remote == merge && b.remote != merge:
+			return -1
+		case b.remote == merge && a.remote != merge:
+			return 1
+		}
+		return 0
+	})
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	displayURL := strings.TrimSuffix(anonymizeURL(repoURL), ".git")
+	if err := writeFetchHead(displayURL, updates, merge); err != nil {
+		return err
+	}
+	return applyRefUpdates(displayURL, updates, strings.Join(append([]string{"fetch"}, args...), " "), stderr)
+}
+
+// parseDepth reads a --depth value, which must be a positive number.
+func parseDepth(value string) (int, error) {
+	depth, err := strconv.Atoi(value)
+	if err != nil || depth <= 0 {
+		return 0, failure.Fatalf("fatal: depth %v is not a positive number", value)
+	}
+	return depth, nil
+}
+
+// updateShallow records the shallow boundaries a fetch moved: commits the
+// server cut the history below and those whose parents it has now sent.
+func updateShallow(response *fetchResponse) error {
+	if len(response.shallow) == 0 && len(response.unshallow) == 0 {
+		return nil
+	}
+	shallow, err := repository.Shallow()
+	if err != nil {
+		return err
+	}
+	updated := maps.Clone(shallow)
+	for _, sha := range response.shallow {
+		updated[sha] = true
+	}
+	for _, sha := range response.unshallow {
+		delete(updated, sha)
+	}
+	return repository.WriteShallow(updated)
+}
+
+// localTips lists the distinct objects our refs point at, for "have" lines.
+func localTips() ([]string, error) {
+	list, err := repository.Refs.List("refs/")
+	if err != nil {
+		return nil, err
+	}
+	haves := make([]string, 0, len(list)+1)
+	if head, err := resolveHead(); err == nil && head != "" {
+		haves = append(haves, head)
+	}
+	for _, ref := range list {
+		if repository.HasObject(ref.SHA) && !slices.Contains(haves, ref.SHA) {
+			haves = append(haves, ref.SHA)
+		}
+	}
+	return haves, nil
+}
+
+// applyRefUpdates moves each local ref to its fetched value, printing one
+// line per change. Non-fast-forward updates without "+"
+// are refused. Reflog entries say what happened after the command line
+// given in reason.
+func applyRefUpdates(repoURL string, updates []refUpdate, reason string, stderr io.Writer) error {
+	width := 10
+	for _, update := range updates {
+		width = max(width, len(shortRefName(update.remote)))
+	}
+	printedHeader, rejected := false, false
+	report := func(flag byte, summary string, update refUpdate, suffix string) {
+		if !printedHeader {
+			fmt.Fprintf(stderr, "From %v\n", repoURL)
+			printedHeader = true
+		}
+		fmt.Fprintf(stderr, " %c %-17s %-*s -> %v%v\n", flag, summary, width, shortRefName(update.remote), shortRefName(update.local), suffix)
+	}
+
+	for _, update := range updates {
+		if update.local == "" {
+			continue
+		}
+		_, old, err := repository.Refs.Resolve(update.local)
+		if err != nil {
+			old = ""
+		}
+		if old == update.sha {
+			continue
+		}
+		action := "fast-forward"
+		switch {
+		case old == "":
+			kind := "[new branch]"
+			action = "storing head"
+			if strings.HasPrefix(update.local, "refs/tags/") {
+				kind, action = "[new tag]", "storing tag"
+			} else if !strings.HasPrefix(update.remote, "refs/heads/") {
+				kind, action = "[new ref]", "storing ref"
+			}
+			report('*', kind, update, "")
+		case strings.HasPrefix(update.local, "refs/tags/") && !update.force:
+			report('!', "[rejected]", update, "  (would clobber existing tag)")
+			rejected = true
+			continue
+		default:
+			fastForward, err := isAncestor(old, update.sha)
+			if err != nil {
+				fastForward = false
+			}
+			switch {
+			case fastForward:
+				report(' ', abbreviate(old)+".."+abbreviate(update.sha), update, "")
+			case update.force:
+				report('+', abbreviate(old)+"..."+abbreviate(update.sha), update, "  (forced update)")
+				action = "forced-update"
+			default:
+				report('!', "[rejected]", update, "  (non-fast-forward)")
+				rejected = true
+				continue
+			}
+		}
+		if err := writeRef(update.local, update.sha, reason+": "+action); err != nil {
+			return err
+		}
+	}
+	if rejected {
+		return errors.New("error: some local refs could not be updated")
+	}
+	return nil
+}
+
+func abbreviate(sha string) string {
+	short, err := abbreviateSHA(sha, 7)
+	if err != nil {
+		return sha[:7]
+	}
+	return short
+}
+
+// writeFetchHead records what was fetched in FETCH_HEAD. merge, the remote
+// branch the current branch is configured to merge, is listed first and
+// marked for merging; everything else is "not-for-merge".
+func writeFetchHead(repoURL string, updates []refUpdate, merge string) error {
+	var forMerge, notForMerge strings.Builder
+	for _, update := range updates {
+		description := ""
+		switch {
+		case update.remote == "HEAD":
+			description = repoURL
+		case strings.HasPrefix(update.remote, "refs/heads/"):
+			description = fmt.Sprintf("branch '%v' of %v", strings.TrimPrefix(update.remote, "refs/heads/"), repoURL)
+		case strings.HasPrefix(update.remote, "refs/tags/"):
+			description = fmt.Sprintf("tag '%v' of %v", strings.TrimPrefix(update.remote, "refs/tags/"), repoURL)
+		default:
+			description = fmt.Sprintf("'%v' of %v", update.remote, repoURL)
+		}
+		if update.remote == merge || update.remote == "HEAD" && update.local == "" {
+			fmt.Fprintf(&forMerge, "%v\t\t%v\n", update.sha, description)
+		} else {
+			fmt.Fprintf(&notForMerge, "%v\tnot-for-merge\t%v\n", update.sha, description)
+		}
+	}
+	fetchHeadPath := repository.Path("FETCH_HEAD")
+	if err := os.WriteFile(fetchHeadPath, []byte(forMerge.String()+notForMerge.String()), 0644); err != nil {
+		return fmt.Errorf("Failed to create file %v: %w", fetchHeadPath, err)
+	}
+	return nil
+}
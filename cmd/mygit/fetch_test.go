@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFetchIgnoresBrokenRefNames(t *testing.T) {
+	base := setupTest(t)
+	source := filepath.Join(base, "source")
+	if err := os.Mkdir(source, 0755); err != nil {
+		t.Fatal(err)
+	}
+	mygit(t, source, "init")
+	sha := commitFile(t, source, "f", "one\n", "one")
+	// Deep enough to lead out of a clone's git directory and its worktree.
+	broken := "refs/heads/../../../../../escaped"
+	writeFile(t, source, ".git/packed-refs", "# pack-refs with: sorted \n"+sha+" "+broken+"\n"+sha+" refs/tags/../../../../../tag\n")
+
+	mygit(t, base, "clone", source, "clone")
+	clone := filepath.Join(base, "clone")
+	mygit(t, clone, "fetch", "origin")
+	if listing := mygit(t, clone, "ls-remote", "origin"); strings.Contains(listing, "..") {
+		t.Errorf("ls-remote lists the broken refs:\n%v", listing)
+	}
+	for _, dir := range []string{base, clone, filepath.Join(clone, ".git")} {
+		for _, name := range []string{"escaped", "tag"} {
+			if _, err := os.Lstat(filepath.Join(dir, name)); err == nil {
+				t.Errorf("%v was written in %v", name, dir)
+			}
+		}
+	}
+	if got := mygit(t, clone, "rev-parse", "origin/main"); got != sha+"\n" {
+		t.Errorf("origin/main = %q", got)
+	}
+}
+
+func TestUpdateRefRefusesNamesOutsideRefs(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	sha := commitFile(t, dir, "f", "one\n", "one")
+	config := "[core]\n\tbare = false\n"
+	writeFile(t, dir, ".git/config", config)
+	if _, _, code := runIn(t, dir, "", "update-ref", "refs/heads/../../config", sha); code == 0 {
+		t.Error("update-ref of refs/heads/../../config succeeded")
+	}
+	if after, err := os.ReadFile(filepath.Join(dir, ".git/config")); err != nil || string(after) != config {
+		t.Errorf("config is now %q, %v", after, err)
+	}
+}
+
+func TestFetchUpdatesRemoteTrackingRefs(t *testing.T) {
+	base := setupTest(t)
+	source := filepath.Join(base, "source")
+	if err := os.Mkdir(source, 0755); err != nil {
+		t.Fatal(err)
+	}
+	mygit(t, source, "init")
+	first := commitFile(t, source, "a", "a\n", "one")
+	mygit(t, base, "clone", source, "clone")
+	clone := filepath.Join(base, "clone")
+
+	second := commitFile(t, source, "a", "b\n", "two")
+	mygit(t, source, "branch", "new")
+	mygit(t, source, "tag", "-a", "-m", "tag", "v1")
+	_, stderr, code := runIn(t, clone, "", "fetch")
+	want := "From " + source + "\n" +
+		"   " + first[:7] + ".." + second[:7] + "  main       -> origin/main\n" +
+		" * [new branch]      new        -> origin/new\n" +
+		" * [new tag]         v1         -> v1\n"
+	if code != 0 || stderr != want {
+		t.Errorf("fetch: exit %v\n%v\nwant:\n%v", code, stderr, want)
+	}
+	for revision, want := range map[string]string{"origin/main": second, "origin/new": second, "v1^{commit}": second} {
+		if got := strings.TrimSpace(mygit(t, clone, "rev-parse", revision)); got != want {
+			t.Errorf("%v after fetch = %v, want %v", revision, got, want)
+		}
+	}
+	if got := strings.TrimSpace(mygit(t, clone, "rev-parse", "main")); got != first {
+		t.Errorf("fetch moved the local main to %v", got)
+	}
+
+	// Rewritten history comes in as a forced update; nothing new is quiet.
+	mygit(t, source, "reset", "--hard", "HEAD~1")
+	forced := commitFile(t, source, "a", "c\n", "forced")
+	if _, stderr, _ := runIn(t, clone, "", "fetch", "origin"); !strings.Contains(stderr, " + "+second[:7]+"..."+forced[:7]+" main       -> origin/main  (forced update)\n") {
+		t.Errorf("fetch of a rewritten branch:\n%v", stderr)
+	}
+	if _, stderr, code := runIn(t, clone, "", "fetch"); code != 0 || stderr != "" {
+		t.Errorf("fetch with nothing new: exit %v\n%v", code, stderr)
+	}
+	if _, err := os.Stat(filepath.Join(clone, ".git", "FETCH_HEAD")); err != nil {
+		t.Errorf("fetch left no FETCH_HEAD: %v", err)
+	}
+}
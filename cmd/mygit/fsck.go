@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+	"github.com/codecrafters-io/git-starter-go/pkg/objects"
+)
+
+// fsckObject is what fsck knows about one object name: whether it is stored
+// and readable, what it points at, and how it can be reached.
+type fsckObject struct {
+	objectType string
+	links      []fsckLink
+	present    bool
+	reachable  bool
+	// used is set once another stored object points here.
+	used bool
+}
+
+type fsckLink struct {
+	sha        string
+	objectType string
+}
+
+// fsck verifies the object database. Each loose and packed object is rehashed
+// and its syntax checked, then everything reachable from the reflogs, refs,
+// HEAD and the index is walked, reporting objects that are missing. Stored
+// objects nothing reaches are listed as dangling when no other object points
+// at them, or all of them with --unreachable.
+func fsck(args []string, stdout io.Writer, stderr io.Writer) error {
+	unreachable, dangling, strict := false, true, false
+	for _, arg := range args {
+		switch arg {
+		case "--unreachable":
+			unreachable = true
+		case "--dangling":
+			dangling = true
+		case "--no-dangling":
+			dangling = false
+		case "--strict":
+			strict = true
+		default:
+			return failure.Usage("usage: git fsck [--unreachable] [--[no-]dangling] [--strict]")
+		}
+	}
+
+	shallow, err := repository.Shallow()
+	if err != nil {
+		return err
+	}
+	output := bufio.NewWriter(stdout)
+	defer output.Flush()
+	failed := false
+	known := make(map[string]*fsckObject)
+	lookup := func(sha string, objectType string) *fsckObject {
+		object, ok := known[sha]
+		if !ok {
+			object = &fsckObject{objectType: objectType}
+			known[sha] = object
+		}
+		return object
+	}
+	store := func(sha string, objectType string, content []byte) {
+		for _, problem := range objects.Check(repository.Algorithm, objectType, content, strict) {
+			level := "error"
+			if problem.Warning {
+				level = "warning"
+			} else {
+				failed = true
+			}
+			fmt.Fprintf(stderr, "%v in %v %v: %v: %v\n", level, objectType, sha, problem.ID, problem.Message)
+		}
+		object := lookup(sha, objectType)
+		object.objectType, object.present = objectType, true
+		object.links = fsckLinks(objectType, content)
+		if objectType == "commit" && shallow[sha] {
+			// The parents of a shallow commit were never fetched; only
+			// its tree (linked first) is here to check.
+			object.links = object.links[:min(1, len(object.links))]
+		}
+		for _, link := range object.links {
+			lookup(link.sha, link.objectType).used = true
+		}
+	}
+
+	looseObjects, err := repository.LooseObjects()
+	if err != nil {
+		return err
+	}
+	for _, sha := range looseObjects {
+		path := repository.Path("objects", sha[:2], sha[2:])
+		objectType, content, err := repository.ReadLooseObject(sha)
+		if err != nil {
+			fmt.Fprintf(stderr, "error: %v\nerror: %v: object corrupt or missing: %v\n", err, sha, path)
+			failed = true
+			continue
+		}
+		if actual := hex.EncodeToString(objects.Hash(repository.Algorithm, objectType, content)); actual != sha {
+			fmt.Fprintf(stderr, "error: %v: hash-path mismatch, found at: %v\n", actual, path)
+			failed = true
+			continue
+		}
+		store(sha, objectType, content)
+	}
+	packs, err := filepath.Glob(repository.Path("objects", "pack", "*.pack"))
+	if err != nil {
+		return err
+	}
+	for _, packPath := range packs {
+		base := strings.TrimSuffix(packPath, ".pack")
+		entries, err := verifyPackFile(base)
+		if err != nil {
+			fmt.Fprintf(stderr, "error: %v.pack: %v\n", base, err)
+			failed = true
+			continue
+		}
+		for _, entry := range entries {
+			if object, ok := known[entry.SHA]; !ok || !object.present {
+				store(entry.SHA, entry.Object.Type, entry.Object.Content)
+			}
+		}
+	}
+
+	// Roots are marked reachable up front and walked last-in first-out, as
+	// git does, so a missing object is reported as a broken link from the
+	// first walked object that needs it unless a root names it directly.
+	pending := make([]string, 0)
+	markRoot := func(sha string) {
+		object := lookup(sha, "blob")
+		if !object.reachable {
+			object.reachable = true
+			pending = append(pending, sha)
+		}
+	}
+	logs, err := repository.Refs.ListLogs()
+	if err != nil {
+		return err
+	}
+	for _, name := range logs {
+		entries, err := repository.Refs.ReadLog(name)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			for _, sha := range []string{entry.Old, entry.New} {
+				if sha == zeroSHA() {
+					continue
+				}
+				if object, ok := known[sha]; !ok || !object.present {
+					fmt.Fprintf(stderr, "error: %v: invalid reflog entry %v\n", name, sha)
+					failed = true
+					continue
+				}
+				markRoot(sha)
+			}
+		}
+	}
+	refs, err := repository.Refs.List("refs/")
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		if object, ok := known[ref.SHA]; !ok || !object.present {
+			fmt.Fprintf(stderr, "error: %v: invalid sha1 pointer %v\n", ref.Name, ref.SHA)
+			failed = true
+			continue
+		}
+		markRoot(ref.SHA)
+	}
+	headRef, isSymref, err := readHeadSymref()
+	if err != nil {
+		return err
+	}
+	if headSHA, err := resolveHead(); err != nil {
+		return err
+	} else if headSHA == "" && isSymref {
+		fmt.Fprintf(stderr, "notice: HEAD points to an unborn branch (%v)\n", strings.TrimPrefix(headRef, "refs/heads/"))
+	} else if object, ok := known[headSHA]; headSHA != "" && (!ok || !object.present) {
+		fmt.Fprintf(stderr, "error: HEAD: invalid sha1 pointer %v\n", headSHA)
+		failed = true
+	} else if headSHA != "" {
+		markRoot(headSHA)
+	}
+	if len(refs) == 0 && len(pending) == 0 {
+		fmt.Fprintln(stderr, "notice: No default references")
+	}
+	if repository.WorkTree != "" {
+		entries, err := readIndex()
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.mode != 0160000 {
+				markRoot(hex.EncodeToString(entry.hash))
+			}
+		}
+	}
+
+	for len(pending) > 0 {
+		sha := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		object := known[sha]
+		for _, link := range object.links {
+			target := known[link.sha]
+			if target.reachable {
+				continue
+			}
+			target.reachable = true
+			if !target.present {
+				fmt.Fprintf(output, "broken link from %7s %v\n              to %7s %v\n", object.objectType, sha, target.objectType, link.sha)
+				failed = true
+				continue
+			}
+			pending = append(pending, link.sha)
+		}
+	}
+
+	names := make([]string, 0, len(known))
+	for sha := range known {
+		names = append(names, sha)
+	}
+	sort.Strings(names)
+	for _, sha := range names {
+		switch object := known[sha]; {
+		case object.reachable && !object.present:
+			fmt.Fprintf(output, "missing %v %v\n", object.objectType, sha)
+			failed = true
+		case object.reachable || !object.present:
+		case unreachable:
+			fmt.Fprintf(output, "unreachable %v %v\n", object.objectType, sha)
+		case !object.used && dangling:
+			fmt.Fprintf(output, "dangling %v %v\n", object.objectType, sha)
+		}
+	}
+	if failed {
+		return errSilentFailure
+	}
+	return nil
+}
+
+// fsckLinks lists the objects an object points at: a commit's tree and
+// parents, a tree's blobs and subtrees, and a tag's target. Submodule
+// commits live in another repository and are left out, as is anything
+// that cannot be parsed.
+func fsckLinks(objectType string, content []byte) []fsckLink {
+	links := make([]fsckLink, 0)
+	switch objectType {
+	case "commit":
+		if commit, err := objects.ParseCommit(content); err == nil {
+			links = append(links, fsckLink{commit.Tree, "tree"})
+			for _, parent := range commit.Parents {
+				links = append(links, fsckLink{parent, "commit"})
+			}
+		}
+	case "tree":
+		if tree, err := objects.ParseTree(repository.Algorithm, content); err == nil {
+			for _, entry := range tree.Entries {
+				switch {
+				case entry.Mode == "160000":
+				case entry.IsTree():
+					links = append(links, fsckLink{hex.EncodeToString(entry.Hash), "tree"})
+				default:
+					links = append(links, fsckLink{hex.EncodeToString(entry.Hash), "blob"})
+				}
+			}
+		}
+	case "tag":
+		if tag, err := objects.ParseTag(content); err == nil {
+			links = append(links, fsckLink{tag.Object, tag.Type})
+		}
+	}
+	return links
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFsckReportsDanglingAndCorruptObjects(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	commitFile(t, dir, "a", "a\n", "one")
+	writeFile(t, dir, "b", "b\n")
+	mygit(t, dir, "add", "b")
+	fsck := func(args ...string) (string, string, int) {
+		t.Helper()
+		return runIn(t, dir, "", append([]string{"fsck"}, args...)...)
+	}
+	if stdout, stderr, code := fsck(); code != 0 || stdout+stderr != "" {
+		t.Errorf("fsck of a sound repository: exit %v\n%v%v", code, stdout, stderr)
+	}
+
+	// A blob only the index holds is reachable; one nothing holds dangles.
+	loose := strings.TrimSpace(mygitInput(t, dir, "c\n", "hash-object", "-w", "--stdin"))
+	if stdout, _, code := fsck(); code != 0 || stdout != "dangling blob "+loose+"\n" {
+		t.Errorf("fsck with a stray blob: exit %v\n%v", code, stdout)
+	}
+	if stdout, _, _ := fsck("--no-dangling"); stdout != "" {
+		t.Errorf("fsck --no-dangling:\n%v", stdout)
+	}
+
+	// Pointed at by a tree nothing reaches, it is unreachable but not
+	// dangling.
+	tree := writeRawTree(t, dir, [3]string{"100644", "c", loose})
+	if stdout, _, _ := fsck(); stdout != "dangling tree "+tree+"\n" {
+		t.Errorf("fsck with a stray tree:\n%v", stdout)
+	}
+	if stdout, _, _ := fsck("--unreachable"); !strings.Contains(stdout, "unreachable blob "+loose+"\n") || !strings.Contains(stdout, "unreachable tree "+tree+"\n") {
+		t.Errorf("fsck --unreachable:\n%v", stdout)
+	}
+
+	a := strings.TrimSpace(mygit(t, dir, "rev-parse", "HEAD:a"))
+	unsorted := writeRawTree(t, dir, [3]string{"100644", "z", a}, [3]string{"100644", "a", a})
+	if _, stderr, code := fsck(); code == 0 || !strings.Contains(stderr, "error in tree "+unsorted+": treeNotSorted: not properly sorted\n") {
+		t.Errorf("fsck with an unsorted tree: exit %v\n%v", code, stderr)
+	}
+	removeObject(t, dir, unsorted)
+
+	// Another object's content under this name, and a missing blob that
+	// HEAD and a ref need.
+	swapped, err := os.ReadFile(objectPath(dir, tree))
+	if err != nil {
+		t.Fatal(err)
+	}
+	removeObject(t, dir, loose)
+	if err := os.WriteFile(objectPath(dir, loose), swapped, 0444); err != nil {
+		t.Fatal(err)
+	}
+	if _, stderr, code := fsck(); code == 0 || !strings.Contains(stderr, "error: "+tree+": hash-path mismatch, found at: ") {
+		t.Errorf("fsck with a misnamed object: exit %v\n%v", code, stderr)
+	}
+	removeObject(t, dir, loose)
+	removeObject(t, dir, a)
+	writeFile(t, dir, ".git/refs/heads/bad", loose+"\n")
+	stdout, stderr, code := fsck()
+	if code == 0 || !strings.Contains(stdout, "missing blob "+a+"\n") || !strings.Contains(stderr, "error: refs/heads/bad: invalid sha1 pointer "+loose+"\n") {
+		t.Errorf("fsck with missing objects: exit %v\n%v%v", code, stdout, stderr)
+	}
+}
+
+// objectPath is where a loose object is stored.
+func objectPath(dir string, sha string) string {
+	return filepath.Join(dir, ".git", "objects", sha[:2], sha[2:])
+}
+
+func removeObject(t *testing.T, dir string, sha string) {
+	t.Helper()
+	if err := os.Remove(objectPath(dir, sha)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// hookPath returns the path of the hook called name, in core.hooksPath when
+// that is set and in the git directory's hooks otherwise, and whether there
+// is one to run. A hook that is not executable is passed over
+// with a hint, unless advice.ignoredHook turns that off.
+func hookPath(name string, stderr io.Writer) (string, bool, error) {
+	cfg, err := repository.Config()
+	if err != nil {
+		return "", false, err
+	}
+	path := repository.Path("hooks", name)
+	if hooksPath, ok := cfg.Get("core.hookspath"); ok {
+		path = filepath.Join(expandHome(hooksPath), name)
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return "", false, nil
+	}
+	if info.Mode()&0111 == 0 {
+		if advice, ok := cfg.Get("advice.ignoredhook"); !ok || advice != "false" {
+			fmt.Fprintf(stderr, "hint: The '%v' hook was ignored because it's not set as executable.\nhint: You can disable this warning with `git config advice.ignoredHook false`.\n", path)
+		}
+		return "", false, nil
+	}
+	return path, true, nil
+}
+
+// runHook runs the hook called name, if there is one, with args, input on
+// its stdin and env added to its environment. It runs at the top
+// of the worktree, or in the git directory of a bare repository, and all it
+// prints goes to stderr. A hook that exits non-zero fails with
+// errSilentFailure, having said why itself.
+func runHook(name string, args []string, input []byte, env []string, stderr io.Writer) error {
+	path, ok, err := hookPath(name, stderr)
+	if err != nil || !ok {
+		return err
+	}
+	command := exec.Command(path, args...)
+	if repository.WorkTree == "" {
+		command.Dir = repository.GitDir
+		if absolute, err := filepath.Abs(path); err == nil {
+			command.Path = absolute
+		}
+	}
+	command.Env = append(os.Environ(), env...)
+	command.Stdin, command.Stdout, command.Stderr = bytes.NewReader(input), stderr, stderr
+	if err := command.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return errSilentFailure
+		}
+		return fmt.Errorf("error: cannot run %v: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeHook installs an executable shell script as the hook called name.
+func writeHook(t *testing.T, hooks string, name string, script string) {
+	t.Helper()
+	path := filepath.Join(hooks, name)
+	if err := os.MkdirAll(hooks, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCommitHooks(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	first := commitFile(t, dir, "f", "1\n", "one")
+	hooks := filepath.Join(dir, ".git", "hooks")
+	head := func() string {
+		t.Helper()
+		return strings.TrimSpace(mygit(t, dir, "rev-parse", "HEAD"))
+	}
+
+	// A failing pre-commit stops the commit, unless told not to verify.
+	writeHook(t, hooks, "pre-commit", "echo 'not today' >&2\nexit 1\n")
+	writeFile(t, dir, "f", "2\n")
+	mygit(t, dir, "add", "f")
+	if _, stderr, code := runIn(t, dir, "", "commit", "-m", "two"); code != 1 || stderr != "not today\n" {
+		t.Errorf("commit with a failing pre-commit: exit %v\n%v", code, stderr)
+	}
+	if got := head(); got != first {
+		t.Errorf("the blocked commit moved HEAD to %v", got)
+	}
+	mygit(t, dir, "commit", "--no-verify", "-m", "two")
+	if got := mygit(t, dir, "log", "-n", "1", "--oneline"); !strings.HasSuffix(got, " two\n") {
+		t.Errorf("commit --no-verify made %q", got)
+	}
+	os.Remove(filepath.Join(hooks, "pre-commit"))
+
+	// commit-msg can rewrite the message, and post-commit runs after.
+	writeHook(t, hooks, "commit-msg", "echo 'Signed-off-by: Hook' >>\"$1\"\n")
+	writeHook(t, hooks, "post-commit", "touch post-commit.out\nexit 3\n")
+	commit := commitFile(t, dir, "f", "3\n", "three")
+	if got := mygit(t, dir, "cat-file", "-p", commit); !strings.HasSuffix(got, "\nthree\nSigned-off-by: Hook\n") {
+		t.Errorf("the committed message after commit-msg:\n%v", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "post-commit.out")); err != nil {
+		t.Errorf("post-commit did not run at the top of the worktree: %v", err)
+	}
+	writeHook(t, hooks, "commit-msg", "grep -q JIRA- \"$1\"\n")
+	writeFile(t, dir, "f", "4\n")
+	mygit(t, dir, "add", "f")
+	if _, _, code := runIn(t, dir, "", "commit", "-m", "no ticket"); code != 1 || head() != commit {
+		t.Errorf("commit rejected by commit-msg: exit %v, HEAD %v", code, head())
+	}
+
+	// A hook that isn't executable is passed over, with a hint.
+	if err := os.Chmod(filepath.Join(hooks, "commit-msg"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, stderr, code := runIn(t, dir, "", "commit", "-m", "no ticket"); code != 0 || !strings.Contains(stderr, "hook was ignored because it's not set as executable") {
+		t.Errorf("commit with a non-executable commit-msg: exit %v\n%v", code, stderr)
+	}
+
+	// core.hooksPath moves where hooks are looked for.
+	elsewhere := filepath.Join(dir, "elsewhere")
+	writeHook(t, elsewhere, "pre-commit", "exit 1\n")
+	mygit(t, dir, "config", "core.hooksPath", elsewhere)
+	writeFile(t, dir, "f", "5\n")
+	mygit(t, dir, "add", "f")
+	if _, _, code := runIn(t, dir, "", "commit", "-m", "five"); code != 1 {
+		t.Errorf("commit with a failing pre-commit in core.hooksPath exited %v", code)
+	}
+}
+
+func TestPrePushHook(t *testing.T) {
+	base := setupTest(t)
+	bare, work := filepath.Join(base, "bare.git"), filepath.Join(base, "work")
+	mygit(t, base, "init", "--bare", bare)
+	mygit(t, base, "init", work)
+	commit := commitFile(t, work, "f", "f\n", "one")
+	mygit(t, work, "remote", "add", "origin", bare)
+	writeHook(t, filepath.Join(work, ".git", "hooks"), "pre-push", "echo \"$@\" >pre-push.out\ncat >>pre-push.out\nexit 1\n")
+
+	if _, _, code := runIn(t, work, "", "push", "origin", "main"); code != 1 {
+		t.Errorf("push with a failing pre-push exited %v", code)
+	}
+	got, err := os.ReadFile(filepath.Join(work, "pre-push.out"))
+	if want := "origin " + bare + "\nrefs/heads/main " + commit + " refs/heads/main " + zeroSHA() + "\n"; err != nil || string(got) != want {
+		t.Errorf("pre-push was given:\n%s%v\nwant:\n%v", got, err, want)
+	}
+	if _, _, code := runIn(t, bare, "", "rev-parse", "--verify", "-q", "main"); code == 0 {
+		t.Errorf("the blocked push created main")
+	}
+	if _, stderr, code := runIn(t, work, "", "push", "--no-verify", "origin", "main"); code != 0 {
+		t.Errorf("push --no-verify: exit %v\n%v", code, stderr)
+	}
+	if got := strings.TrimSpace(mygit(t, bare, "rev-parse", "main")); got != commit {
+		t.Errorf("main after push --no-verify = %v, want %v", got, commit)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+)
+
+// authorIdentity returns the "Name <email> <unix-seconds> <+hhmm>" line that
+// records who wrote a new commit.
+func authorIdentity() (string, error) {
+	return identity("AUTHOR", "author")
+}
+
+// committerIdentity returns the identity line of whoever creates a commit or
+// tag now.
+func committerIdentity() (string, error) {
+	return identity("COMMITTER", "committer")
+}
+
+// identity builds an identity line. The name and email come from
+// GIT_<ROLE>_NAME and GIT_<ROLE>_EMAIL, then <role>.name and <role>.email,
+// then user.name and user.email, falling back to the account name and
+// user@hostname. GIT_<ROLE>_DATE overrides the current time.
+func identity(envRole string, configRole string) (string, error) {
+	config, err := repository.Config()
+	if err != nil {
+		return "", err
+	}
+	lookup := func(envName string, configNames ...string) string {
+		if value := os.Getenv(envName); value != "" {
+			return value
+		}
+		for _, configName := range configNames {
+			if value, ok := config.Get(configName); ok {
+				return value
+			}
+		}
+		return ""
+	}
+
+	name := lookup("GIT_"+envRole+"_NAME", configRole+".name", "user.name")
+	email := lookup("GIT_"+envRole+"_EMAIL", configRole+".email", "user.email")
+	if email == "" {
+		email = os.Getenv("EMAIL")
+	}
+	if name == "" || email == "" {
+		account, hostname := "", "localhost"
+		if current, err := user.Current(); err == nil {
+			account = current.Username
+			if name == "" {
+				name, _, _ = strings.Cut(current.Name, ",")
+			}
+		}
+		if name == "" {
+			name = account
+		}
+		if host, err := os.Hostname(); err == nil && host != "" {
+			hostname = host
+		}
+		if email == "" && account != "" {
+			email = account + "@" + hostname
+		}
+	}
+	name, email = cleanIdent(name), cleanIdent(email)
+	if name == "" {
+		return "", failure.Fatalf("fatal: empty ident name (for <%v>) not allowed", email)
+	}
+
+	when := time.Now()
+	if date := os.Getenv("GIT_" + envRole + "_DATE"); date != "" {
+		if when, err = parseIdentDate(date); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%v <%v> %v %v", name, email, when.Unix(), when.Format("-0700")), nil
+}
+
+// cleanIdent drops the characters that would break an identity line and
+// trims the punctuation git strips from either end.
+func cleanIdent(value string) string {
+	value = strings.Map(func(r rune) rune {
+		if r == '<' || r == '>' || r == '\n' {
+			return -1
+		}
+		return r
+	}, value)
+	return strings.Trim(value, " .,:;\"'\\\t")
+}
+
+var identDateLayouts = []string{
+	time.RFC1123Z,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	time.RFC3339,
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	gitDateLayout,
+}
+
+// parseIdentDate accepts the date formats git takes in GIT_AUTHOR_DATE and
+// GIT_COMMITTER_DATE: git's internal "<unix-seconds> <+hhmm>" (optionally
+// prefixed with "@"), RFC 2822, ISO 8601 and git's own log format. Dates
+// without a zone are in local time.
+func parseIdentDate(date string) (time.Time, error) {
+	fields := strings.Fields(strings.TrimPrefix(date, "@"))
+	if len(fields) >= 1 && len(fields) <= 2 {
+		if seconds, err := strconv.ParseInt(fields[0], 10, 64); err == nil && (len(fields) == 1 || strings.HasPrefix(date, "@") || len(fields[0]) > 8) {
+			when := time.Unix(seconds, 0).UTC()
+			if len(fields) == 2 {
+				when = when.In(parseTimezone(fields[1]))
+			}
+			return when, nil
+		}
+	}
+	for _, layout := range identDateLayouts {
+		if when, err := time.ParseInLocation(layout, date, time.Local); err == nil {
+			return when, nil
+		}
+	}
+	return time.Time{}, failure.Fatalf("fatal: invalid date format: %v", date)
+}
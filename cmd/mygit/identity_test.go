@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestIdentityFromEnvironmentAndConfig(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	for _, name := range []string{"GIT_AUTHOR_NAME", "GIT_AUTHOR_EMAIL", "GIT_COMMITTER_NAME", "GIT_COMMITTER_EMAIL", "EMAIL"} {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+	writeFile(t, dir, ".git/config", "[user]\n\tname = Con Fig\n\temail = <config@example.com>.\n[committer]\n\tname = Com Mitter\n")
+	commits := 0
+	headers := func() string {
+		t.Helper()
+		commits++
+		commit := commitFile(t, dir, "f", strings.Repeat("x", commits), "c")
+		raw := mygit(t, dir, "cat-file", "-p", commit)
+		start := strings.Index(raw, "author ")
+		return raw[start : strings.Index(raw, "\n\n")+1]
+	}
+
+	// <role>.name wins over user.name, and the email loses its brackets and
+	// trailing dot.
+	want := "author Con Fig <config@example.com> 1700000000 +0000\ncommitter Com Mitter <config@example.com> 1700000000 +0000\n"
+	if got := headers(); got != want {
+		t.Errorf("identities from config:\n%v\nwant:\n%v", got, want)
+	}
+
+	t.Setenv("GIT_AUTHOR_NAME", "En Viron")
+	t.Setenv("GIT_COMMITTER_EMAIL", "env@example.com")
+	t.Setenv("GIT_COMMITTER_DATE", "2023-11-14T22:13:20+0100")
+	want = "author En Viron <config@example.com> 1700000000 +0000\ncommitter Com Mitter <env@example.com> 1699996400 +0100\n"
+	if got := headers(); got != want {
+		t.Errorf("identities with the environment set:\n%v\nwant:\n%v", got, want)
+	}
+
+	t.Setenv("GIT_COMMITTER_DATE", "not a date")
+	if _, stderr, code := runIn(t, dir, "", "commit-tree", strings.TrimSpace(mygit(t, dir, "write-tree")), "-m", "x"); code != 128 || !strings.Contains(stderr, "invalid date format: not a date") {
+		t.Errorf("commit-tree with a bad date: exit %v\n%v", code, stderr)
+	}
+}
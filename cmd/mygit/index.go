@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/atomicfile"
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+	"github.com/codecrafters-io/git-starter-go/pkg/repo"
+)
+
+// IndexEntry is one staged path in .git/index (version 2 layout).
+type IndexEntry struct {
+	ctimeSeconds uint32
+	ctimeNanos   uint32
+	mtimeSeconds uint32
+	mtimeNanos   uint32
+	dev          uint32
+	ino          uint32
+	mode         uint32
+	uid          uint32
+	gid          uint32
+	size         uint32
+	hash         []byte
+	flags        uint16
+	path         string
+}
+
+func (entry IndexEntry) stage() int {
+	return int(entry.flags>>12) & 0x3
+}
+
+// readIndex loads the index file from the git directory. A missing index is treated as empty.
+func readIndex() ([]IndexEntry, error) {
+	indexPath := repository.Path("index")
+	data, err := os.ReadFile(indexPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []IndexEntry{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading file %v: %w", indexPath, err)
+	}
+	// Object names, and the checksum at the end, are as long as the
+	// repository's hash makes them.
+	size := repository.Algorithm.Size()
+	if len(data) < 12+size || string(data[:4]) != "DIRC" {
+		return nil, errors.New("Invalid index file signature")
+	}
+	checksum := repository.Algorithm.New()
+	checksum.Write(data[:len(data)-size])
+	if !bytes.Equal(checksum.Sum(nil), data[len(data)-size:]) {
+		return nil, errors.New("Index file checksum mismatch")
+	}
+	if version := binary.BigEndian.Uint32(data[4:8]); version != 2 && version != 3 {
+		return nil, fmt.Errorf("Unsupported index version %v", version)
+	}
+	count := int(binary.BigEndian.Uint32(data[8:12]))
+
+	entries := make([]IndexEntry, 0, count)
+	body := data[12 : len(data)-size]
+	for i := 0; i < count; i++ {
+		if len(body) < 42+size {
+			return nil, errors.New("Truncated index entry")
+		}
+		fields := make([]uint32, 10)
+		for j := range fields {
+			fields[j] = binary.BigEndian.Uint32(body[j*4:])
+		}
+		entry := IndexEntry{
+			ctimeSeconds: fields[0],
+			ctimeNanos:   fields[1],
+			mtimeSeconds: fields[2],
+			mtimeNanos:   fields[3],
+			dev:          fields[4],
+			ino:          fields[5],
+			mode:         fields[6],
+			uid:          fields[7],
+			gid:          fields[8],
+			size:         fields[9],
+			hash:         append([]byte(nil), body[40:40+size]...),
+			flags:        binary.BigEndian.Uint16(body[40+size : 42+size]),
+		}
+		headerLength := 42 + size
+		if entry.flags&0x4000 != 0 {
+			// Extended flags (version 3) follow the regular flags.
+			headerLength += 2
+		}
+		nulIndex := bytes.IndexByte(body[headerLength:], 0)
+		if nulIndex < 0 {
+			return nil, errors.New("Unterminated index entry path")
+		}
+		entry.path = string(body[headerLength : headerLength+nulIndex])
+		entryLength := (headerLength + nulIndex + 8) &^ 7
+		if entryLength > len(body) {
+			return nil, errors.New("Truncated index entry")
+		}
+		entries = append(entries, entry)
+		body = body[entryLength:]
+	}
+	return entries, nil
+}
+
+// writeIndex stores entries as a version 2 index, sorted the way git expects.
+func writeIndex(entries []IndexEntry) error {
+	sortIndexEntries(entries)
+
+	var buffer bytes.Buffer
+	buffer.WriteString("DIRC")
+	binary.Write(&buffer, binary.BigEndian, uint32(2))
+	binary.Write(&buffer, binary.BigEndian, uint32(len(entries)))
+	for _, entry := range entries {
+		for _, field := range []uint32{
+			entry.ctimeSeconds, entry.ctimeNanos, entry.mtimeSeconds, entry.mtimeNanos,
+			entry.dev, entry.ino, entry.mode, entry.uid, entry.gid, entry.size,
+		} {
+			binary.Write(&buffer, binary.BigEndian, field)
+		}
+		buffer.Write(entry.hash)
+		nameLength := len(entry.path)
+		if nameLength > 0xfff {
+			nameLength = 0xfff
+		}
+		flags := entry.flags&0x3000 | uint16(nameLength)
+		binary.Write(&buffer, binary.BigEndian, flags)
+		buffer.WriteString(entry.path)
+		padding := 8 - (42+len(entry.hash)+len(entry.path))%8
+		buffer.Write(make([]byte, padding))
+	}
+	checksum := repository.Algorithm.New()
+	checksum.Write(buffer.Bytes())
+	buffer.Write(checksum.Sum(nil))
+
+	// The index is replaced through index.lock so a command
+	// that is interrupted or finds another at work leaves the old one.
+	indexPath := repository.Path("index")
+	err := atomicfile.WriteFile(indexPath, buffer.Bytes(), 0644)
+	var locked *atomicfile.LockedError
+	if errors.As(err, &locked) {
+		return failure.Fatalf("fatal: %w", err)
+	} else if err != nil {
+		return fmt.Errorf("Failed to create file %v: %w", indexPath, err)
+	}
+	return nil
+}
+
+func sortIndexEntries(entries []IndexEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].path != entries[j].path {
+			return entries[i].path < entries[j].path
+		}
+		return entries[i].stage() < entries[j].stage()
+	})
+}
+
+// newIndexEntry stats a working tree file and stores its blob.
+func newIndexEntry(path string) (IndexEntry, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return IndexEntry{}, fmt.Errorf("Error reading file %v: %w", path, err)
+	}
+
+	var hash []byte
+	mode := uint32(0100644)
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return IndexEntry{}, fmt.Errorf("Error reading symlink %v: %w", path, err)
+		}
+		if hash, err = repository.WriteObject("blob", []byte(target)); err != nil {
+			return IndexEntry{}, err
+		}
+		mode = 0120000
+	default:
+		if hash, err = repository.WriteBlobFile(path); err != nil {
+			return IndexEntry{}, err
+		}
+		if info.Mode()&0111 != 0 {
+			mode = 0100755
+		}
+	}
+	return indexEntryFromStat(path, info, mode, hash), nil
+}
+
+// newGitlinkEntry records the nested repository at path as a gitlink to the
+// commit it has checked out.
+func newGitlinkEntry(path string) (IndexEntry, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return IndexEntry{}, fmt.Errorf("Error reading file %v: %w", path, err)
+	}
+	hash, err := repo.SubmoduleHead(path)
+	if err != nil {
+		return IndexEntry{}, err
+	}
+	return indexEntryFromStat(path, info, 0160000, hash), nil
+}
+
+// statIndexEntry records a file that already matches a known blob, such as
+// one just written by checkout, without rehashing it.
+func statIndexEntry(path string, mode uint32, hash []byte) (IndexEntry, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return IndexEntry{}, fmt.Errorf("Error reading file %v: %w", path, err)
+	}
+	return indexEntryFromStat(path, info, mode, hash), nil
+}
+
+func indexEntryFromStat(path string, info fs.FileInfo, mode uint32, hash []byte) IndexEntry {
+	mtime := info.ModTime()
+	entry := IndexEntry{
+		mtimeSeconds: uint32(mtime.Unix()),
+		mtimeNanos:   uint32(mtime.Nanosecond()),
+		mode:         mode,
+		size:         uint32(info.Size()),
+		hash:         hash,
+		path:         filepath.ToSlash(filepath.Clean(path)),
+	}
+	setStatData(&entry, info)
+	return entry
+}
+
+func add(args []string) error {
+	force := false
+	pathspecs := make([]string, 0, len(args))
+	for index, arg := range args {
+		if arg == "--" {
+			pathspecs = append(pathspecs, args[index+1:]...)
+			break
+		}
+		switch arg {
+		case "-f", "--force":
+			force = true
+		default:
+			if strings.HasPrefix(arg, "-") && arg != "-" {
+				return failure.Usagef("error: unknown option `%v'", strings.TrimLeft(arg, "-"))
+			}
+			pathspecs = append(pathspecs, arg)
+		}
+	}
+	if len(pathspecs) == 0 {
+		return errors.New("Nothing specified, nothing added.")
+	}
+	ignores, err := repository.Ignores()
+	if err != nil {
+		return err
+	}
+	entries, err := readIndex()
+	if err != nil {
+		return err
+	}
+	// Entries are kept by path and stage, so a conflicted path keeps all of
+	// its stages until it is itself added.
+	type stagedPath struct {
+		path  string
+		stage int
+	}
+	entriesByPath := make(map[stagedPath]IndexEntry, len(entries))
+	for _, entry := range entries {
+		entriesByPath[stagedPath{entry.path, entry.stage()}] = entry
+	}
+	stageEntry := func(entry IndexEntry) {
+		for stage := 1; stage <= 3; stage++ {
+			delete(entriesByPath, stagedPath{entry.path, stage})
+		}
+		entriesByPath[stagedPath{entry.path, 0}] = entry
+	}
+
+	// tracked reports whether anything at or below path is in the index;
+	// tracked paths are updated even when an ignore rule matches them. The
+	// paths are sorted once, so each question is a binary search.
+	trackedPaths := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		trackedPaths = append(trackedPaths, entry.path)
+	}
+	slices.Sort(trackedPaths)
+	tracked := func(path string) bool {
+		if path == "." {
+			return len(trackedPaths) > 0
+		}
+		if _, found := slices.BinarySearch(trackedPaths, path); found {
+			return true
+		}
+		index, _ := slices.BinarySearch(trackedPaths, path+"/")
+		return index < len(trackedPaths) && strings.HasPrefix(trackedPaths[index], path+"/")
+	}
+	ignoredArgs := make([]string, 0)
+	for _, arg := range pathspecs {
+		pathspec, err := worktreePath(arg)
+		if err != nil {
+			return err
+		}
+		info, statErr := os.Lstat(pathspec)
+		if statErr != nil {
+			// A tracked path that disappeared from disk stages its removal.
+			removed := false
+			for key := range entriesByPath {
+				if key.path == pathspec || pathspec == "." || strings.HasPrefix(key.path, pathspec+"/") {
+					delete(entriesByPath, key)
+					removed = true
+				}
+			}
+			if !removed {
+				return failure.Fatalf("fatal: pathspec '%v' did not match any files", arg)
+			}
+			continue
+		}
+
+		if !force && pathspec != "." && ignores.Ignored(pathspec, info.IsDir()) && !tracked(pathspec) {
+			ignoredArgs = append(ignoredArgs, arg)
+			continue
+		}
+
+		if !info.IsDir() {
+			entry, err := newIndexEntry(pathspec)
+			if err != nil {
+				return err
+			}
+			stageEntry(entry)
+			continue
+		}
+
+		seen := make(map[string]bool)
+		err = filepath.WalkDir(pathspec, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			slashPath := filepath.ToSlash(path)
+			ignored := !force && slashPath != pathspec && ignores.Ignored(slashPath, d.IsDir()) && !tracked(slashPath)
+			if d.IsDir() {
+				if d.Name() == ".git" || ignored {
+					return filepath.SkipDir
+				}
+				// A nested repository is staged as a gitlink to the commit
+				// it has checked out, not file by file.
+				if path != "." && repo.IsSubmodule(path) {
+					entry, err := newGitlinkEntry(path)
+					if err != nil {
+						return err
+					}
+					stageEntry(entry)
+					seen[entry.path] = true
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if ignored {
+				return nil
+			}
+			entry, err := newIndexEntry(path)
+			if err != nil {
+				return err
+			}
+			stageEntry(entry)
+			seen[entry.path] = true
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for key := range entriesByPath {
+			if (pathspec == "." || strings.HasPrefix(key.path, pathspec+"/")) && !seen[key.path] {
+				delete(entriesByPath, key)
+			}
+		}
+	}
+
+	updated := make([]IndexEntry, 0, len(entriesByPath))
+	for _, entry := range entriesByPath {
+		updated = append(updated, entry)
+	}
+	if err := writeIndex(updated); err != nil {
+		return err
+	}
+	if len(ignoredArgs) > 0 {
+		return fmt.Errorf("The following paths are ignored by one of your .gitignore files:\n%v\nhint: Use -f if you really want to add them.\nhint: Turn this message off by running\nhint: \"git config advice.addIgnoredFile false\"", strings.Join(ignoredArgs, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAddStagesNestedRepositoryAsGitlink(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	writeFile(t, dir, "a", "a\n")
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	mygit(t, sub, "init")
+	subHead := commitFile(t, sub, "s", "s\n", "s")
+
+	mygit(t, dir, "add", ".")
+	mygit(t, dir, "commit", "-m", "outer")
+	want := "100644 blob 78981922613b2afb6025042ff6bd878ac1994e85\ta\n160000 commit " + subHead + "\tsub\n"
+	if got := mygit(t, dir, "ls-tree", "-r", "HEAD"); got != want {
+		t.Errorf("ls-tree -r HEAD:\n%v\nwant:\n%v", got, want)
+	}
+	// The commit matches what write-tree makes of the worktree.
+	if tree, head := mygit(t, dir, "write-tree"), mygit(t, dir, "rev-parse", "HEAD^{tree}"); tree != head {
+		t.Errorf("write-tree = %v, HEAD^{tree} = %v", tree, head)
+	}
+
+	// Naming the nested repository stages its new HEAD.
+	subHead = commitFile(t, sub, "s", "t\n", "t")
+	mygit(t, dir, "add", "sub")
+	mygit(t, dir, "commit", "-m", "bump")
+	if got := mygit(t, dir, "rev-parse", "HEAD:sub"); strings.TrimSpace(got) != subHead {
+		t.Errorf("HEAD:sub = %v, want %v", got, subHead)
+	}
+}
+
+func TestAddUpdatesTrackedIgnoredPaths(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	writeFile(t, dir, ".gitignore", "logs/\n")
+	writeFile(t, dir, "logs-old", "old\n")
+	writeFile(t, dir, "logs/keep", "one\n")
+	mygit(t, dir, "add", ".gitignore", "logs-old")
+	mygit(t, dir, "add", "-f", "logs/keep")
+	mygit(t, dir, "commit", "-m", "one")
+
+	// logs/keep is tracked, so it is updated though ignored; logs/new is not.
+	writeFile(t, dir, "logs/keep", "two\n")
+	writeFile(t, dir, "logs/new", "new\n")
+	mygit(t, dir, "add", ".")
+	mygit(t, dir, "commit", "-m", "two")
+	if got := mygit(t, dir, "cat-file", "-p", "HEAD:logs/keep"); got != "two\n" {
+		t.Errorf("logs/keep = %q", got)
+	}
+	if _, _, code := runIn(t, dir, "", "cat-file", "-e", "HEAD:logs/new"); code == 0 {
+		t.Error("the ignored logs/new was added")
+	}
+	if _, stderr, code := runIn(t, dir, "", "add", "logs/new"); code == 0 || !strings.Contains(stderr, "ignored by one of your .gitignore files") {
+		t.Errorf("add logs/new: exit %v, %q", code, stderr)
+	}
+}
+
+func TestIndexReadableByGit(t *testing.T) {
+	requireGit(t)
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	writeFile(t, dir, "a", "a\n")
+	writeFile(t, dir, "d/e/f", "f\n")
+	writeFile(t, dir, "run", "#!/bin/sh\n")
+	if err := os.Chmod(filepath.Join(dir, "run"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	mygit(t, dir, "add", ".")
+
+	want := "100644 78981922613b2afb6025042ff6bd878ac1994e85 0\ta\n" +
+		"100644 6a69f92020f5df77af6e8813ff1232493383b708 0\td/e/f\n" +
+		"120000 2e65efe2a145dda7ee51d1741299f848e5bf752e 0\tlink\n" +
+		"100755 1a2485251c33a70432394c93fb89330ef214bfc9 0\trun\n"
+	if got := runGit(t, dir, "ls-files", "--stage"); got != want {
+		t.Errorf("git ls-files --stage of mygit's index:\n%v\nwant:\n%v", got, want)
+	}
+	// The cached stat data matches, so git sees nothing modified without
+	// rehashing.
+	if got := runGit(t, dir, "diff-files", "--name-only"); got != "" {
+		t.Errorf("git diff-files lists %q as changed", got)
+	}
+
+	// And mygit reads the index git writes.
+	mygit(t, dir, "commit", "-m", "one")
+	writeFile(t, dir, "a", "changed\n")
+	runGit(t, dir, "add", "a")
+	runGit(t, dir, "rm", "-q", "--cached", "run")
+	if got := mygit(t, dir, "status", "-s"); got != "M  a\nD  run\n?? run\n" {
+		t.Errorf("status -s after git add and rm:\n%v", got)
+	}
+}
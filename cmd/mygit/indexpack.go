@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/atomicfile"
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+	"github.com/codecrafters-io/git-starter-go/internal/pack"
+	"github.com/codecrafters-io/git-starter-go/pkg/repo"
+)
+
+// indexPack checks a pack and writes the .idx for it, next to the pack or
+// at the -o path, printing the pack's sha. With --stdin the pack is read
+// from stdin and stored in the repository unless a pack file is named.
+func indexPack(args []string, stdin io.Reader, stdout io.Writer) error {
+	fromStdin := false
+	indexPath, packPath := "", ""
+	for index := 0; index < len(args); index++ {
+		switch arg := args[index]; {
+		case arg == "--stdin":
+			fromStdin = true
+		case arg == "-v":
+		case arg == "-o":
+			if index+1 >= len(args) {
+				return failure.Fatal("fatal: -o requires a file name")
+			}
+			index++
+			indexPath = cwdPath(args[index])
+		case strings.HasPrefix(arg, "-") || packPath != "":
+			return failure.Usage("usage: git index-pack [-v] [-o <index-file>] [--stdin] <pack-file>")
+		default:
+			packPath = cwdPath(arg)
+		}
+	}
+	if packPath == "" && !fromStdin {
+		return failure.Usage("usage: git index-pack [-v] [-o <index-file>] [--stdin] <pack-file>")
+	}
+	if indexPath == "" && packPath != "" {
+		if !strings.HasSuffix(packPath, ".pack") {
+			return failure.Fatalf("fatal: packfile name '%v' does not end with '.pack'", packPath)
+		}
+		indexPath = strings.TrimSuffix(packPath, ".pack") + ".idx"
+	}
+
+	var data []byte
+	var err error
+	if fromStdin {
+		data, err = io.ReadAll(stdin)
+	} else {
+		data, err = os.ReadFile(packPath)
+	}
+	if err != nil {
+		return failure.Fatalf("fatal: cannot read packfile: %w", err)
+	}
+	entries, err := pack.ReadEntries(context.Background(), repository.Algorithm, data, nil, nil)
+	if errors.Is(err, pack.ErrDeltaBaseMissing) {
+		return failure.Fatal("fatal: pack has unresolved deltas")
+	} else if err != nil {
+		return failure.Fatalf("fatal: %w", err)
+	}
+	indexEntries := make([]pack.IndexEntry, 0, len(entries))
+	for _, e := range entries {
+		indexEntries = append(indexEntries, e.IndexEntry())
+	}
+	checksum := data[len(data)-repository.Algorithm.Size():]
+
+	if fromStdin && packPath == "" {
+		// Keep the pack alongside the repository's others.
+		if !repo.IsGitDir(repository.GitDir) {
+			return failure.Fatal("fatal: --stdin requires a git repository")
+		}
+		dir := repository.Path("objects", "pack")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("Failed to create directory %v: %w", dir, err)
+		}
+		temp, err := atomicfile.CreateTemp(dir, "tmp_pack_")
+		if err != nil {
+			return fmt.Errorf("Failed to create temporary file in %v: %w", dir, err)
+		}
+		defer temp.Abort()
+		if _, err := temp.Write(data); err != nil {
+			return fmt.Errorf("Failed to write %v: %w", temp.Name(), err)
+		}
+		name, err := installPack(filepath.Join(dir, "pack"), temp, indexEntries, checksum)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "pack\t%v\n", name)
+		return nil
+	}
+
+	if fromStdin {
+		if err := replaceFile(packPath, data); err != nil {
+			return err
+		}
+	}
+	var index strings.Builder
+	if err := pack.WriteIndex(repository.Algorithm, &index, indexEntries, checksum); err != nil {
+		return err
+	}
+	if err := replaceFile(indexPath, []byte(index.String())); err != nil {
+		return err
+	}
+	if fromStdin {
+		fmt.Fprintf(stdout, "pack\t%x\n", checksum)
+	} else {
+		fmt.Fprintf(stdout, "%x\n", checksum)
+	}
+	return nil
+}
+
+// verifyPack checks each pack against its .idx. -v lists every object as
+// "<sha> <type> <size> <size-in-pack> <offset> [<depth> <base>]" followed
+// by a histogram of delta chain lengths; -s prints only the histogram.
+func verifyPack(args []string, stdout io.Writer, stderr io.Writer) error {
+	verbose, statsOnly := false, false
+	paths := make([]string, 0, len(args))
+	for _, arg := range args {
+		switch arg {
+		case "-v", "--verbose":
+			verbose = true
+		case "-s", "--stat-only":
+			statsOnly = true
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return failure.Usagef("error: unknown option `%v'", strings.TrimLeft(arg, "-"))
+			}
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) == 0 {
+		return failure.Usage("usage: git verify-pack [-v | --verbose] [-s | --stat-only] <pack>...")
+	}
+
+	output := bufio.NewWriter(stdout)
+	defer output.Flush()
+	failed := false
+	for _, path := range paths {
+		base := strings.TrimSuffix(strings.TrimSuffix(path, ".idx"), ".pack")
+		entries, err := verifyPackFile(cwdPath(base))
+		if err != nil {
+			output.Flush()
+			fmt.Fprintf(stderr, "error: %v.pack: %v\n", base, err)
+			failed = true
+			continue
+		}
+		if !verbose && !statsOnly {
+			continue
+		}
+
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Offset < entries[j].Offset })
+		chains := make(map[int]int)
+		maxDepth := 0
+		for _, e := range entries {
+			chains[e.Depth]++
+			maxDepth = max(maxDepth, e.Depth)
+			if statsOnly {
+				continue
+			}
+			fmt.Fprintf(output, "%v %-6v %v %v %v", e.SHA, e.Object.Type, e.StoredSize, e.PackedSize, e.Offset)
+			if e.Depth > 0 {
+				fmt.Fprintf(output, " %v %v", e.Depth, e.Base)
+			}
+			fmt.Fprintln(output)
+		}
+		fmt.Fprintf(output, "non delta: %v %v\n", chains[0], plural(chains[0], "object"))
+		for depth := 1; depth <= maxDepth; depth++ {
+			if chains[depth] > 0 {
+				fmt.Fprintf(output, "chain length = %v: %v %v\n", depth, chains[depth], plural(chains[depth], "object"))
+			}
+		}
+		if verbose {
+			fmt.Fprintf(output, "%v.pack: ok\n", base)
+		}
+	}
+	if failed {
+		return errSilentFailure
+	}
+	return nil
+}
+
+func verifyPackFile(base string) ([]*pack.Entry, error) {
+	packData, err := os.ReadFile(base + ".pack")
+	if err != nil {
+		return nil, fmt.Errorf("Error reading file %v.pack: %w", base, err)
+	}
+	indexData, err := os.ReadFile(base + ".idx")
+	if err != nil {
+		return nil, fmt.Errorf("Error reading file %v.idx: %w", base, err)
+	}
+	return pack.Verify(repository.Algorithm, packData, indexData)
+}
+
+// cwdPath maps a file argument given relative to the original working
+// directory onto the current one, which is the top of the worktree.
+func cwdPath(arg string) string {
+	if filepath.IsAbs(arg) {
+		return arg
+	}
+	return filepath.Join(workTreePrefix, arg)
+}
+
+func plural(count int, noun string) string {
+	if count == 1 {
+		return noun
+	}
+	return noun + "s"
+}
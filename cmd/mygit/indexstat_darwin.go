@@ -0,0 +1,19 @@
+package main
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// setStatData fills in the stat data git compares a file against besides
+// its mtime and size: ctime, device, inode and owner.
+func setStatData(entry *IndexEntry, info fs.FileInfo) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		entry.ctimeSeconds, entry.ctimeNanos = entry.mtimeSeconds, entry.mtimeNanos
+		return
+	}
+	entry.ctimeSeconds, entry.ctimeNanos = uint32(stat.Ctimespec.Sec), uint32(stat.Ctimespec.Nsec)
+	entry.dev, entry.ino = uint32(stat.Dev), uint32(stat.Ino)
+	entry.uid, entry.gid = stat.Uid, stat.Gid
+}
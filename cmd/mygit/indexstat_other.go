@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package main
+
+import "io/fs"
+
+// setStatData stands in the mtime for the ctime where there is no portable
+// way to read the rest of a file's stat data; those fields stay 0.
+func setStatData(entry *IndexEntry, info fs.FileInfo) {
+	entry.ctimeSeconds, entry.ctimeNanos = entry.mtimeSeconds, entry.mtimeNanos
+}
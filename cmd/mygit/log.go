@@ -0,0 +1,257 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+	"github.com/codecrafters-io/git-starter-go/pkg/objects"
+)
+
+// Commit is a parsed commit object together with its name.
+type Commit struct {
+	sha string
+	*objects.Commit
+}
+
+// Signature is a parsed "Name <email> <unix-seconds> <+hhmm>" identity line.
+type Signature struct {
+	name  string
+	email string
+	when  time.Time
+}
+
+func readCommit(sha string) (*Commit, error) {
+	commit, err := repository.ReadCommit(sha)
+	if err != nil {
+		return nil, err
+	}
+	return &Commit{sha: sha, Commit: commit}, nil
+}
+
+// displayMessage returns the commit message decoded for UTF-8 output, honoring
+// the encoding header for the Latin-1 family and passing others through. A
+// Latin-1 message is always decoded, even when its bytes happen to be valid
+// UTF-8 too, since the header says what they are.
+func (commit *Commit) displayMessage() string {
+	switch strings.ToLower(commit.Encoding) {
+	case "iso-8859-1", "iso8859-1", "latin1", "latin-1":
+		runes := make([]rune, 0, len(commit.Message))
+		for i := 0; i < len(commit.Message); i++ {
+			runes = append(runes, rune(commit.Message[i]))
+		}
+		return string(runes)
+	default:
+		return commit.Message
+	}
+}
+
+func (commit *Commit) subject() string {
+	return strings.SplitN(strings.TrimLeft(commit.displayMessage(), "\n"), "\n", 2)[0]
+}
+
+func parseSignature(value string) Signature {
+	signature := Signature{}
+	nameEnd := strings.Index(value, " <")
+	emailEnd := strings.LastIndex(value, ">")
+	if nameEnd < 0 || emailEnd < nameEnd {
+		signature.name = value
+		return signature
+	}
+	signature.name = value[:nameEnd]
+	signature.email = value[nameEnd+2 : emailEnd]
+	fields := strings.Fields(value[emailEnd+1:])
+	if len(fields) == 2 {
+		seconds, _ := strconv.ParseInt(fields[0], 10, 64)
+		signature.when = time.Unix(seconds, 0).In(parseTimezone(fields[1]))
+	}
+	return signature
+}
+
+func parseTimezone(offset string) *time.Location {
+	if len(offset) != 5 {
+		return time.UTC
+	}
+	hours, _ := strconv.Atoi(offset[1:3])
+	minutes, _ := strconv.Atoi(offset[3:5])
+	seconds := hours*3600 + minutes*60
+	if offset[0] == '-' {
+		seconds = -seconds
+	}
+	return time.FixedZone(offset, seconds)
+}
+
+// walkCommits visits commits reachable from the starting points newest first
+// by committer date, the default git log ordering. visit returns false to stop.
+func walkCommits(starts []string, visit func(*Commit) bool) error {
+	seen := make(map[string]bool)
+	queue := make([]*Commit, 0)
+	push := func(sha string) error {
+		if seen[sha] {
+			return nil
+		}
+		seen[sha] = true
+		commit, err := readCommit(sha)
+		if err != nil {
+			return err
+		}
+		queue = append(queue, commit)
+		return nil
+	}
+	for _, sha := range starts {
+		if err := push(sha); err != nil {
+			return err
+		}
+	}
+
+	for len(queue) > 0 {
+		sort.SliceStable(queue, func(i, j int) bool {
+			return parseSignature(queue[i].Committer).when.After(parseSignature(queue[j].Committer).when)
+		})
+		commit := queue[0]
+		queue = queue[1:]
+		if !visit(commit) {
+			return nil
+		}
+		for _, parent := range commit.Parents {
+			if err := push(parent); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// walkParents visits the commits reachable from the starting points,
+// nearest first, knowing only their names, which lets the commit-graph
+// answer in place of reading each commit. visit returns false to stop.
+func walkParents(starts []string, visit func(sha string) bool) error {
+	seen := make(map[string]bool)
+	queue := make([]string, 0, len(starts))
+	for _, sha := range starts {
+		if !seen[sha] {
+			seen[sha] = true
+			queue = append(queue, sha)
+		}
+	}
+	for len(queue) > 0 {
+		sha := queue[0]
+		queue = queue[1:]
+		if !visit(sha) {
+			return nil
+		}
+		parents, err := repository.CommitParents(sha)
+		if err != nil {
+			return err
+		}
+		for _, parent := range parents {
+			if !seen[parent] {
+				seen[parent] = true
+				queue = append(queue, parent)
+			}
+		}
+	}
+	return nil
+}
+
+const gitDateLayout = "Mon Jan 2 15:04:05 2006 -0700"
+
+func showLog(args []string, stdout io.Writer) error {
+	oneline := false
+	maxCount := -1
+	starts := make([]string, 0)
+	for index := 0; index < len(args); index++ {
+		arg := args[index]
+		switch {
+		case arg == "--oneline":
+			oneline = true
+		case arg == "-n" && index+1 < len(args):
+			index++
+			count, err := strconv.Atoi(args[index])
+			if err != nil {
+				return failure.Usagef("invalid count %q", args[index])
+			}
+			maxCount = count
+		case strings.HasPrefix(arg, "--max-count="), strings.HasPrefix(arg, "-n"), len(arg) > 1 && arg[0] == '-' && arg[1] >= '0' && arg[1] <= '9':
+			value := strings.TrimLeft(strings.TrimPrefix(strings.TrimPrefix(arg, "--max-count="), "-n"), "-")
+			count, err := strconv.Atoi(value)
+			if err != nil {
+				return failure.Usagef("invalid count %q", arg)
+			}
+			maxCount = count
+		case strings.HasPrefix(arg, "-"):
+			return failure.Usagef("usage: log [--oneline] [-n <count>] [<commit>]")
+		default:
+			sha, err := resolveRevision(arg)
+			if err != nil {
+				return failure.Fatalf("fatal: ambiguous argument '%v': unknown revision or path not in the working tree.\nUse '--' to separate paths from revisions, like this:\n'git <command> [<revision>...] -- [<file>...]'", arg)
+			}
+			if sha, err = peelObject(sha, "commit"); err != nil {
+				return err
+			}
+			starts = append(starts, sha)
+		}
+	}
+	if len(starts) == 0 {
+		headSHA, err := resolveHead()
+		if err != nil {
+			return err
+		}
+		if headSHA == "" {
+			headRef, _, _ := readHeadSymref()
+			return failure.Fatalf("fatal: your current branch '%v' does not have any commits yet", strings.TrimPrefix(headRef, "refs/heads/"))
+		}
+		starts = append(starts, headSHA)
+	}
+	if maxCount == 0 {
+		return nil
+	}
+
+	shown := 0
+	var writeErr error
+	err := walkCommits(starts, func(commit *Commit) bool {
+		if oneline {
+			_, writeErr = fmt.Fprintf(stdout, "%v %v\n", commit.sha[:7], commit.subject())
+		} else {
+			writeErr = printCommit(commit, shown > 0, stdout)
+		}
+		shown++
+		return writeErr == nil && (maxCount < 0 || shown < maxCount)
+	})
+	if err != nil {
+		return err
+	}
+	if writeErr != nil && !errors.Is(writeErr, io.ErrClosedPipe) {
+		return writeErr
+	}
+	return nil
+}
+
+// printCommit writes a commit in git's medium pretty format.
+func printCommit(commit *Commit, separate bool, stdout io.Writer) error {
+	var output strings.Builder
+	if separate {
+		output.WriteString("\n")
+	}
+	fmt.Fprintf(&output, "commit %v\n", commit.sha)
+	if len(commit.Parents) > 1 {
+		abbreviated := make([]string, 0, len(commit.Parents))
+		for _, parent := range commit.Parents {
+			abbreviated = append(abbreviated, parent[:7])
+		}
+		fmt.Fprintf(&output, "Merge: %v\n", strings.Join(abbreviated, " "))
+	}
+	author := parseSignature(commit.Author)
+	fmt.Fprintf(&output, "Author: %v <%v>\n", author.name, author.email)
+	fmt.Fprintf(&output, "Date:   %v\n\n", author.when.Format(gitDateLayout))
+	for _, line := range strings.Split(strings.TrimRight(commit.displayMessage(), "\n"), "\n") {
+		fmt.Fprintf(&output, "    %v\n", line)
+	}
+	_, err := io.WriteString(stdout, output.String())
+	return err
+}
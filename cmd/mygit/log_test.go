@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLogStopsAtShallowAndGraftBoundaries(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	first := commitFile(t, dir, "a.txt", "one\n", "first")
+	second := commitFile(t, dir, "a.txt", "two\n", "second")
+	third := commitFile(t, dir, "a.txt", "three\n", "third")
+	subjects := func() string {
+		t.Helper()
+		subjects := make([]string, 0, 3)
+		for _, line := range strings.Split(strings.TrimSpace(mygit(t, dir, "log", "--oneline")), "\n") {
+			subjects = append(subjects, line[strings.Index(line, " ")+1:])
+		}
+		return strings.Join(subjects, " ")
+	}
+
+	writeFile(t, dir, ".git/info/grafts", "# skip the second commit\n"+third+" "+first+"\n")
+	if got, want := subjects(), "third first"; got != want {
+		t.Errorf("log with a graft: got %q, want %q", got, want)
+	}
+	os.Remove(filepath.Join(dir, ".git", "info", "grafts"))
+
+	// The boundary's parent is missing, as after a shallow clone.
+	writeFile(t, dir, ".git/shallow", second+"\n")
+	if err := os.Remove(filepath.Join(dir, ".git", "objects", first[:2], first[2:])); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := subjects(), "third second"; got != want {
+		t.Errorf("log in a shallow repository: got %q, want %q", got, want)
+	}
+}
+
+func TestCommitGraphFallsBackWhenCorrupt(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	base := commitFile(t, dir, "a.txt", "base\n", "base")
+	middle := commitFile(t, dir, "a.txt", "middle\n", "middle")
+	tip := commitFile(t, dir, "a.txt", "tip\n", "tip")
+	mygit(t, dir, "branch", "side", base)
+	mygit(t, dir, "checkout", "side")
+	side := commitFile(t, dir, "b.txt", "side\n", "side")
+	command := exec.Command("git", "commit-graph", "write", "--reachable")
+	var stderr bytes.Buffer
+	command.Dir, command.Stderr = dir, &stderr
+	if err := command.Run(); err != nil {
+		t.Fatalf("git commit-graph write: %v\n%v", err, stderr.String())
+	}
+
+	// With the middle commit's object gone, only the graph knows its parent.
+	middlePath := filepath.Join(dir, ".git", "objects", middle[:2], middle[2:])
+	middleObject, err := os.ReadFile(middlePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(middlePath)
+	if got := mygit(t, dir, "merge-base", tip, side); got != base+"\n" {
+		t.Errorf("merge-base through the commit-graph: got %q, want %v", got, base)
+	}
+	writeFile(t, dir, ".git/objects/"+middle[:2]+"/"+middle[2:], string(middleObject))
+
+	// Damage the last byte before the checksum, which then no longer
+	// matches, so the graph is not believed.
+	graphPath := filepath.Join(dir, ".git", "objects", "info", "commit-graph")
+	graph, err := os.ReadFile(graphPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Chmod(graphPath, 0644)
+	graph[len(graph)-len(middle)/2-1] ^= 0xff
+	if err := os.WriteFile(graphPath, graph, 0644); err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderrText, code := runIn(t, dir, "", "merge-base", tip, side)
+	if code != 0 || stdout != base+"\n" {
+		t.Errorf("merge-base with a corrupt commit-graph: exit %v, got %q, want %v\n%v", code, stdout, base, stderrText)
+	}
+	if !strings.Contains(stderrText, "commit-graph checksum mismatch") {
+		t.Errorf("no warning about the corrupt commit-graph: %q", stderrText)
+	}
+}
+
+func TestLogMatchesGitAcrossMerges(t *testing.T) {
+	requireGit(t)
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	commitAt := func(name string, when int, parents ...string) string {
+		t.Helper()
+		date := strconv.Itoa(when) + " +0100"
+		t.Setenv("GIT_AUTHOR_DATE", date)
+		t.Setenv("GIT_COMMITTER_DATE", date)
+		writeFile(t, dir, name, name+"\n")
+		mygit(t, dir, "add", name)
+		tree := strings.TrimSpace(mygit(t, dir, "write-tree"))
+		args := []string{"commit-tree", tree, "-m", name + "\n\nbody of " + name}
+		for _, parent := range parents {
+			args = append(args, "-p", parent)
+		}
+		return strings.TrimSpace(mygit(t, dir, args...))
+	}
+	root := commitAt("root", 1700000000)
+	left := commitAt("left", 1700000300, root)
+	right := commitAt("right", 1700000100, root)
+	rightAgain := commitAt("right-again", 1700000200, right)
+	merge := commitAt("merge", 1700000400, left, rightAgain)
+	mygit(t, dir, "update-ref", "refs/heads/main", merge)
+
+	for _, args := range [][]string{{"log"}, {"log", "--oneline"}, {"log", "-n", "3"}, {"log", "--oneline", rightAgain}} {
+		if got, want := mygit(t, dir, args...), runGit(t, dir, args...); got != want {
+			t.Errorf("mygit %v:\n%v\ngit %v:\n%v", strings.Join(args, " "), got, strings.Join(args, " "), want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+)
+
+// lsRemote lists the refs a remote advertises as "<sha>\t<name>" lines,
+// annotated tags followed by what they peel to. Patterns keep the refs whose
+// name ends in a matching path component sequence. Without a repository
+// argument the current branch's remote, or origin, is listed.
+func lsRemote(ctx context.Context, args []string, stdout io.Writer, stderr io.Writer) error {
+	heads, tags, refsOnly, quiet, symrefs := false, false, false, false, false
+	positional := make([]string, 0, 1)
+	for _, arg := range args {
+		switch arg {
+		case "-h", "--heads":
+			heads = true
+		case "-t", "--tags":
+			tags = true
+		case "--refs":
+			refsOnly = true
+		case "-q", "--quiet":
+			quiet = true
+		case "--symref":
+			symrefs = true
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return failure.Usage("usage: git ls-remote [--heads] [--tags] [--refs] [-q | --quiet] [--symref] [<repository> [<refs>...]]")
+			}
+			positional = append(positional, arg)
+		}
+	}
+
+	remote, patterns := "", []string(nil)
+	if len(positional) > 0 {
+		remote, patterns = positional[0], positional[1:]
+	}
+	repoURL := remote
+	if remote == "" || !isRemoteURL(remote) {
+		cfg, err := repository.Config()
+		if err != nil {
+			return err
+		}
+		if remote == "" {
+			remote = "origin"
+			if headRef, isSymref, err := readHeadSymref(); err == nil && isSymref {
+				if configured, ok := cfg.Get("branch." + strings.TrimPrefix(headRef, "refs/heads/") + ".remote"); ok {
+					remote = configured
+				}
+			}
+		}
+		configured, ok := cfg.Get("remote." + remote + ".url")
+		if !ok {
+			if len(positional) == 0 {
+				return failure.Fatal("fatal: No remote configured to list refs from.")
+			}
+			return failure.Fatalf("fatal: '%v' does not appear to be a git repository", remote)
+		}
+		repoURL = configured
+		if len(positional) == 0 && !quiet {
+			fmt.Fprintf(stderr, "From %v\n", repoURL)
+		}
+	}
+
+	prefixes := make([]string, 0, 2)
+	if heads {
+		prefixes = append(prefixes, "refs/heads/")
+	}
+	if tags {
+		prefixes = append(prefixes, "refs/tags/")
+	}
+	connection, err := openUploadPack(ctx, strings.TrimSuffix(repoURL, "/"), prefixes, stderr)
+	if err != nil {
+		return err
+	}
+	defer connection.close()
+
+	output := bufio.NewWriter(stdout)
+	defer output.Flush()
+	for _, ref := range connection.refs {
+		if len(prefixes) > 0 && !hasAnyPrefix(ref.name, prefixes) {
+			continue
+		}
+		if refsOnly && !strings.HasPrefix(ref.name, "refs/") {
+			continue
+		}
+		if len(patterns) > 0 && !tailMatch(ref.name, patterns) {
+			continue
+		}
+		if symrefs && ref.symref != "" {
+			fmt.Fprintf(output, "ref: %v\t%v\n", ref.symref, ref.name)
+		}
+		fmt.Fprintf(output, "%v\t%v\n", ref.sha, ref.name)
+		if ref.peeled != "" && !refsOnly {
+			fmt.Fprintf(output, "%v\t%v^{}\n", ref.peeled, ref.name)
+		}
+	}
+	return nil
+}
+
+func hasAnyPrefix(name string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// tailMatch reports whether a pattern matches name or its tail after a "/",
+// so "main" matches refs/heads/main and "v1.*" matches refs/tags/v1.0.
+func tailMatch(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		for tail := name; ; {
+			if matched, _ := path.Match(pattern, tail); matched {
+				return true
+			}
+			_, rest, found := strings.Cut(tail, "/")
+			if !found {
+				break
+			}
+			tail = rest
+		}
+	}
+	return false
+}
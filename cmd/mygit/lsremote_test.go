@@ -0,0 +1,38 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLsRemoteMatchesGit(t *testing.T) {
+	requireGit(t)
+	base := setupTest(t)
+	source := filepath.Join(base, "source")
+	mygit(t, base, "init", source)
+	commitFile(t, source, "a", "a\n", "one")
+	mygit(t, source, "branch", "feature")
+	mygit(t, source, "tag", "-a", "-m", "tag", "v1")
+	mygit(t, source, "tag", "light")
+	mygit(t, base, "clone", source, "clone")
+	clone := filepath.Join(base, "clone")
+
+	for _, args := range [][]string{
+		{source},
+		{"--heads", source},
+		{"--tags", source},
+		{"--refs", source},
+		{"--symref", source, "HEAD"},
+		{source, "main", "refs/tags/*"},
+		{"origin"},
+	} {
+		args = append([]string{"ls-remote"}, args...)
+		if got, want := mygit(t, clone, args...), runGit(t, clone, args...); got != want {
+			t.Errorf("mygit %v:\n%v\ngit:\n%v", strings.Join(args, " "), got, want)
+		}
+	}
+	if _, stderr, code := runIn(t, base, "", "ls-remote", filepath.Join(base, "missing")); code != 128 || !strings.Contains(stderr, "does not appear to be a git repository") {
+		t.Errorf("ls-remote of a missing repository: exit %v\n%v", code, stderr)
+	}
+}
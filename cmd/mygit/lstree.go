@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+	"github.com/codecrafters-io/git-starter-go/pkg/objects"
+)
+
+type lsTreeOptions struct {
+	recursive  bool
+	showTrees  bool
+	onlyTrees  bool
+	long       bool
+	nameOnly   bool
+	objectOnly bool
+}
+
+func lsTree(args []string, stdout io.Writer) error {
+	options := lsTreeOptions{}
+	positional := make([]string, 0, 1)
+	for _, arg := range args {
+		switch arg {
+		case "-r":
+			options.recursive = true
+		case "-t":
+			options.showTrees = true
+		case "-d":
+			options.onlyTrees = true
+		case "-l", "--long":
+			options.long = true
+		case "--name-only", "--name-status":
+			options.nameOnly = true
+		case "--object-only":
+			options.objectOnly = true
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return failure.Usage("usage: ls-tree [-d] [-r] [-t] [-l] [--name-only | --object-only] <tree-ish>")
+			}
+			positional = append(positional, arg)
+		}
+	}
+	if len(positional) != 1 {
+		return failure.Usage("usage: ls-tree [-d] [-r] [-t] [-l] [--name-only | --object-only] <tree-ish>")
+	}
+
+	treeSHA, err := resolveRevision(positional[0])
+	if err != nil {
+		return failure.Fatalf("fatal: Not a valid object name %v", positional[0])
+	}
+	if treeSHA, err = peelObject(treeSHA, objects.TypeTree); err != nil {
+		return failure.Fatal("fatal: not a tree object")
+	}
+	tree, err := repository.ReadTree(treeSHA)
+	if err != nil {
+		return err
+	}
+	return printTree(tree, "", options, stdout)
+}
+
+// printTree writes tree entries in ls-tree format, "<mode> <type> <sha>\t<path>"
+// by default, descending into subtrees when options.recursive is set.
+func printTree(tree *objects.Tree, prefix string, options lsTreeOptions, stdout io.Writer) error {
+	for _, entry := range tree.Entries {
+		path := prefix + entry.Name
+		sha := hex.EncodeToString(entry.Hash)
+		descend := entry.IsTree() && options.recursive
+		show := !options.onlyTrees
+		if entry.IsTree() {
+			show = !descend || options.showTrees || options.onlyTrees
+		}
+
+		if show {
+			var line string
+			switch {
+			case options.nameOnly:
+				line = quotePath(path, false)
+			case options.objectOnly:
+				line = sha
+			case options.long:
+				size := "-"
+				if treeEntryType(entry) == objects.TypeBlob {
+					_, blobSize, reader, err := repository.OpenObject(sha)
+					if err != nil {
+						return err
+					}
+					reader.Close()
+					size = fmt.Sprint(blobSize)
+				}
+				line = fmt.Sprintf("%06s %v %v %7s\t%v", entry.Mode, treeEntryType(entry), sha, size, quotePath(path, false))
+			default:
+				line = fmt.Sprintf("%06s %v %v\t%v", entry.Mode, treeEntryType(entry), sha, quotePath(path, false))
+			}
+			if _, err := fmt.Fprintln(stdout, line); err != nil {
+				return err
+			}
+		}
+
+		if descend {
+			subtree, err := repository.ReadTree(sha)
+			if err != nil {
+				return err
+			}
+			if err := printTree(subtree, path+"/", options, stdout); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// treeEntryType returns the type of object a tree entry points at.
+func treeEntryType(entry objects.TreeEntry) string {
+	switch entry.Mode {
+	case "40000":
+		return objects.TypeTree
+	case "160000":
+		return objects.TypeCommit
+	default:
+		return objects.TypeBlob
+	}
+}
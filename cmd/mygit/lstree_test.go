@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLsTreeMatchesGit(t *testing.T) {
+	requireGit(t)
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	writeFile(t, dir, "a", "a\n")
+	writeFile(t, dir, "d/e/f", "f\n")
+	writeFile(t, dir, "d/g", strings.Repeat("g", 1000))
+	writeFile(t, dir, "run", "#!/bin/sh\n")
+	if err := os.Chmod(filepath.Join(dir, "run"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	mygit(t, dir, "add", ".")
+	mygit(t, dir, "commit", "-m", "one")
+
+	for _, args := range [][]string{
+		{"ls-tree", "HEAD"},
+		{"ls-tree", "-r", "HEAD"},
+		{"ls-tree", "-r", "-t", "HEAD"},
+		{"ls-tree", "-d", "HEAD"},
+		{"ls-tree", "-r", "-l", "HEAD"},
+		{"ls-tree", "--name-only", "-r", "HEAD"},
+		{"ls-tree", "HEAD:d"},
+	} {
+		if got, want := mygit(t, dir, args...), runGit(t, dir, args...); got != want {
+			t.Errorf("mygit %v:\n%v\ngit:\n%v", strings.Join(args, " "), got, want)
+		}
+	}
+}
@@ -2,231 +2,790 @@ package main
 
 import (
 	"bytes"
-	"compress/zlib"
-	"crypto/sha1"
+	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"regexp"
-	"sort"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+	"github.com/codecrafters-io/git-starter-go/pkg/objects"
+	"github.com/codecrafters-io/git-starter-go/pkg/repo"
 )
 
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "usage: mygit <command> [<args>...]\n")
-		os.Exit(1)
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes a single mygit command and returns its exit code. main is a
+// thin wrapper around it so commands can be driven in-process, with the
+// working directory selecting the repository.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if _, ok := stderr.(*os.File); !ok {
+		// A service or hook we start copies its stderr in from another
+		// goroutine while the command goes on writing its own.
+		stderr = &lockedWriter{w: stderr}
+	}
+	if len(args) < 1 {
+		fmt.Fprintf(stderr, "usage: mygit <command> [<args>...]\n")
+		return 1
 	}
 
-	switch command := os.Args[1]; command {
+	replaceObjects := os.Getenv("GIT_NO_REPLACE_OBJECTS") == ""
+	noPager, paginate := false, false
+	for ; len(args) > 0 && strings.HasPrefix(args[0], "-"); args = args[1:] {
+		switch args[0] {
+		case "--no-replace-objects":
+			replaceObjects = false
+		case "-P", "--no-pager":
+			noPager = true
+		case "-p", "--paginate":
+			paginate = true
+		default:
+			fmt.Fprintf(stderr, "unknown option: %v\nusage: mygit [--no-pager] [--paginate] [--no-replace-objects] <command> [<args>...]\n", args[0])
+			return 129
+		}
+	}
+	if len(args) < 1 {
+		fmt.Fprintf(stderr, "usage: mygit <command> [<args>...]\n")
+		return 1
+	}
+
+	repository, workTreePrefix = repo.Open(".git", ""), ""
+	switch args[0] {
 	case "init":
-		initRepository()
-	case "cat-file":
-		if len(os.Args) < 4 {
-			fmt.Fprintf(os.Stderr, "usage: cat-file -p <blob_sha>\n")
-			os.Exit(1)
+		if envGitDir := os.Getenv("GIT_DIR"); envGitDir != "" {
+			repository = repo.Open(envGitDir, "")
 		}
-		catFile(os.Args[3])
-	case "hash-object":
-		if len(os.Args) < 4 {
-			fmt.Fprintf(os.Stderr, "usage: hash-object <filename>\n")
-			os.Exit(1)
+	case "clone", "upload-pack", "receive-pack", "daemon":
+		// These create or find their repositories themselves.
+	case "hash-object", "config", "index-pack", "verify-pack", "ls-remote":
+		// Hashing without -w, reading or writing global config, working on
+		// pack files named by path and listing a remote by URL need no
+		// repository.
+		if err := setupRepository(); err != nil {
+			repository, workTreePrefix = repo.Open(".git", ""), ""
 		}
-		hashObject(os.Args[3])
-	case "ls-tree":
-		if len(os.Args) < 4 {
-			fmt.Fprintf(os.Stderr, "usage: ls-tree <tree_sha>\n")
-			os.Exit(1)
+	default:
+		if err := setupRepository(); err != nil {
+			fmt.Fprintln(stderr, err)
+			return failure.ExitCode(err)
 		}
-		lsTree(os.Args[3])
+		if workTreeCommands[args[0]] && repository.WorkTree == "" {
+			fmt.Fprintf(stderr, "fatal: this operation must be run in a work tree\n")
+			return 128
+		}
+	}
+	repository.ReplaceObjects, repository.Warnings = replaceObjects, stderr
+
+	if pager := pagerFor(args[0], paginate, stdout); pager != "" && !noPager {
+		output, wait, err := startPager(pager, stdout, stderr)
+		if err != nil {
+			fmt.Fprintf(stderr, "fatal: unable to execute pager '%v'\n", pager)
+			return 128
+		}
+		stdout = output
+		defer wait()
+	}
+
+	// Commands that talk to a remote stop cleanly when interrupted.
+	ctx := context.Background()
+	if networkCommands[args[0]] {
+		var stop context.CancelFunc
+		ctx, stop = interruptContext()
+		defer stop()
+	}
+
+	var err error
+	switch command := args[0]; command {
+	case "init":
+		err = initRepository(args[1:], stdout)
+	case "cat-file":
+		err = catFile(args[1:], stdin, stdout)
+	case "hash-object":
+		err = hashObject(args[1:], stdin, stdout)
+	case "ls-tree":
+		err = lsTree(args[1:], stdout)
 	case "write-tree":
-		writeTree()
+		err = writeTree(stdout)
 	case "commit-tree":
-		commitTree()
+		err = commitTree(args[1:], stdin, stdout, stderr)
+	case "rev-parse":
+		err = revParse(args[1:], stdout)
+	case "replace":
+		err = replace(args[1:], stdout, stderr)
+	case "clone":
+		err = clone(ctx, args[1:], stderr)
+	case "fetch":
+		err = fetch(ctx, args[1:], stderr)
+	case "push":
+		err = push(ctx, args[1:], stdout, stderr)
+	case "upload-pack":
+		err = uploadPackServer(args[1:], stdin, stdout)
+	case "receive-pack":
+		err = receivePackServer(args[1:], stdin, stdout, stderr)
+	case "daemon":
+		err = daemon(args[1:], stderr)
+	case "ls-remote":
+		err = lsRemote(ctx, args[1:], stdout, stderr)
+	case "remote":
+		err = remoteCommand(ctx, args[1:], stdout, stderr)
+	case "pack-objects":
+		err = packObjects(args[1:], stdin, stdout)
+	case "gc":
+		err = gc(args[1:])
+	case "index-pack":
+		err = indexPack(args[1:], stdin, stdout)
+	case "verify-pack":
+		err = verifyPack(args[1:], stdout, stderr)
+	case "fsck":
+		err = fsck(args[1:], stdout, stderr)
+	case "add":
+		err = add(args[1:])
+	case "rm":
+		err = rm(args[1:], stdout)
+	case "mv":
+		err = mv(args[1:], stdout)
+	case "clean":
+		err = clean(args[1:], stdout)
+	case "apply":
+		err = apply(args[1:], stdin, stderr)
+	case "commit":
+		err = commit(args[1:], stdout, stderr)
+	case "status":
+		err = status(args[1:], stdout)
+	case "log":
+		err = showLog(args[1:], stdout)
+	case "show":
+		err = show(args[1:], stdout)
+	case "blame":
+		err = blame(args[1:], stdout)
+	case "describe":
+		err = describe(args[1:], stdout, stderr)
+	case "archive":
+		err = archive(args[1:], stdout)
+	case "merge":
+		err = merge(args[1:], stdout, stderr)
+	case "reset":
+		err = reset(args[1:], stdout)
+	case "merge-base":
+		err = mergeBase(args[1:], stdout)
+	case "rev-list":
+		err = revList(args[1:], stdout)
+	case "reflog":
+		err = reflog(args[1:], stdout)
+	case "checkout":
+		err = checkout(args[1:], stderr, false)
+	case "switch":
+		err = checkout(args[1:], stderr, true)
+	case "branch":
+		err = branch(args[1:], stdout)
+	case "update-ref":
+		err = updateRef(args[1:])
+	case "symbolic-ref":
+		err = symbolicRef(args[1:], stdout)
+	case "verify-commit":
+		err = verifyCommit(args[1:], stdout, stderr)
+	case "verify-tag":
+		err = verifyTag(args[1:], stdout, stderr)
+	case "tag":
+		err = tag(args[1:], stdout)
+	case "check-ignore":
+		err = checkIgnore(args[1:], stdout)
+	case "config":
+		err = gitConfig(args[1:], stdout)
+	case "diff":
+		err = gitDiff(args[1:], stdout)
 	default:
-		fmt.Fprintf(os.Stderr, "Unknown command %s\n", command)
-		os.Exit(1)
+		err = fmt.Errorf("Unknown command %s", command)
 	}
-}
 
-func initRepository() {
-	for _, dir := range []string{".git", ".git/objects", ".git/refs"} {
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			fmt.Fprintf(os.Stderr, "Error creating directory: %s\n", err)
+	if err != nil {
+		// Like git killed by the signal, an interrupted command exits with
+		// 128 plus its number and says nothing of what the interruption
+		// broke.
+		var stopped interruption
+		if errors.As(context.Cause(ctx), &stopped) {
+			return 128 + int(stopped.signal)
 		}
+		if !errors.Is(err, errSilentFailure) {
+			fmt.Fprintln(stderr, err)
+		}
+		return failure.ExitCode(err)
 	}
-	headFileContents := []byte("ref: refs/heads/main\n")
-	if err := os.WriteFile(".git/HEAD", headFileContents, 0644); err != nil {
-		fmt.Fprintf(os.Stderr, "Error writing file: %s\n", err)
-	}
-	fmt.Println("Initialized git directory")
+	return 0
 }
 
-func catFile(blobSHA string) {
-	blobPath := filepath.Join(".git/objects", blobSHA[:2], blobSHA[2:])
-	content := readAndDecompressFile(blobPath)
-	blobContent := strings.SplitN(content, "\x00", 2)[1]
-	fmt.Print(blobContent)
+// lockedWriter serializes the writes to w.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
 }
 
-func hashObject(filename string) {
-	fileBytes, err := os.ReadFile(filename)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading file %v: %v", filename, err.Error())
-		os.Exit(1)
-	}
-	hash := createObject("blob", fileBytes)
-	fmt.Println(hex.EncodeToString(hash))
+func (writer *lockedWriter) Write(p []byte) (int, error) {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+	return writer.w.Write(p)
 }
 
-func lsTree(treeSHA string) {
-	treeFilePath := filepath.Join(".git/objects", treeSHA[:2], treeSHA[2:])
-	content := readAndDecompressFile(treeFilePath)
-	modes := []string{"100644", "100755", "120000", "40000"}
-	re := regexp.MustCompile(`[\x00\s]`)
-	contentParts := re.Split(content, -1)
+// errSilentFailure makes a command exit non-zero without printing anything,
+// as for a failed existence check.
+var errSilentFailure = errors.New("silent failure")
 
-	filesAndDirs := make([]string, 0)
-	for index := 0; index < len(contentParts); index++ {
-		for _, mode := range modes {
-			if strings.Contains(contentParts[index], mode) {
-				filesAndDirs = append(filesAndDirs, contentParts[index+1])
-			}
-		}
-	}
-	fmt.Println(strings.Join(filesAndDirs, "\n"))
+// networkCommands lists the commands that talk to a remote, which are given
+// a context the first Ctrl-C cancels.
+var networkCommands = map[string]bool{
+	"clone": true, "fetch": true, "push": true, "ls-remote": true, "remote": true,
 }
 
-func writeTree() {
-	treeObjectHash := createTreeObjects(".")
-	fmt.Println(hex.EncodeToString(treeObjectHash))
+// interruption is why a command's context was canceled: the signal asking
+// it to stop.
+type interruption struct {
+	signal syscall.Signal
 }
 
-type HashedEntry struct {
-	mode string
-	name string
-	hash []byte
+func (stopped interruption) Error() string {
+	return "interrupted by " + stopped.signal.String()
 }
 
-func createTreeObjects(path string) []byte {
-	hashedEntries := make([]HashedEntry, 0)
-	entries, _ := os.ReadDir(path)
+// interruptContext returns a context that the first SIGINT or SIGTERM
+// cancels, so a command can stop what it is doing and clean up after
+// itself. Only that first signal is caught; another kills us as usual.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case received := <-signals:
+			signal.Stop(signals)
+			cancel(interruption{received.(syscall.Signal)})
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel(nil)
+	}
+}
 
-	sort.Slice(entries, func(i, j int) bool {
-		return strings.ToLower(entries[i].Name()) < strings.ToLower(entries[j].Name())
-	})
+// workTreeCommands lists the commands that need a worktree, not just a git directory.
+var workTreeCommands = map[string]bool{
+	"add": true, "commit": true, "status": true, "checkout": true, "switch": true,
+	"merge": true, "rm": true, "mv": true, "clean": true,
+}
 
-	for _, entry := range entries {
-		entryPath := filepath.Join(path, entry.Name())
-		if entry.IsDir() {
-			if entry.Name() == ".git" {
-				continue
-			}
-			he := HashedEntry{
-				name: entry.Name(),
-				mode: "40000",
-				hash: createTreeObjects(entryPath),
-			}
-			hashedEntries = append(hashedEntries, he)
-		} else {
-			he := HashedEntry{
-				name: entry.Name(),
-				mode: "100644",
-				hash: createFileBlobObject(entryPath),
-			}
-			hashedEntries = append(hashedEntries, he)
+// initRepository creates a repository in the working directory or the one
+// named, which --bare makes the git directory itself, with no worktree.
+// GIT_DIR, when set, names the git directory instead. --object-format, or
+// else GIT_DEFAULT_HASH, picks the hash a new repository names its objects
+// with; an existing one cannot change it.
+func initRepository(args []string, stdout io.Writer) error {
+	bare, dir, format := false, "", os.Getenv("GIT_DEFAULT_HASH")
+	for _, arg := range args {
+		switch {
+		case arg == "--bare":
+			bare = true
+		case strings.HasPrefix(arg, "--object-format="):
+			format = strings.TrimPrefix(arg, "--object-format=")
+		case strings.HasPrefix(arg, "-") || dir != "":
+			return failure.Usage("usage: init [--bare] [--object-format=<format>] [<directory>]")
+		default:
+			dir = arg
+		}
+	}
+	algorithm := objects.SHA1
+	if format != "" {
+		named, err := objects.AlgorithmNamed(format)
+		if err != nil {
+			return failure.Fatalf("fatal: unknown hash algorithm '%v'", format)
+		}
+		algorithm = named
+	}
+	workTree, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	gitDir := repository.GitDir
+	if bare {
+		if os.Getenv("GIT_DIR") == "" {
+			gitDir = workTree
 		}
+		workTree = ""
+	} else if dir != "" && os.Getenv("GIT_DIR") == "" {
+		gitDir = filepath.Join(workTree, ".git")
 	}
+	if repo.IsGitDir(gitDir) && format != "" && repo.Open(gitDir, workTree).Algorithm != algorithm {
+		return failure.Fatal("fatal: attempt to reinitialize repository with different hash")
+	}
+	initialized, err := repo.Init(gitDir, workTree, algorithm)
+	if err != nil {
+		return err
+	}
+	initialized.ReplaceObjects = repository.ReplaceObjects
+	repository = initialized
+	fmt.Fprintln(stdout, "Initialized git directory")
+	return nil
+}
 
-	treeObjectContent := ""
-	for _, he := range hashedEntries {
-		treeObjectContent += fmt.Sprintf("%v %v\x00%v", he.mode, he.name, string(he.hash))
+func hashObject(args []string, stdin io.Reader, stdout io.Writer) error {
+	write, fromStdin := false, false
+	objectType := objects.TypeBlob
+	paths := make([]string, 0, 1)
+	for index := 0; index < len(args); index++ {
+		switch arg := args[index]; {
+		case arg == "--":
+			paths = append(paths, args[index+1:]...)
+			index = len(args)
+		case arg == "-w":
+			write = true
+		case arg == "--stdin":
+			fromStdin = true
+		case arg == "-t" && index+1 < len(args):
+			index++
+			objectType = args[index]
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			return failure.Usage("usage: hash-object [-t <type>] [-w] [--stdin] [--] <file>...")
+		default:
+			paths = append(paths, arg)
+		}
+	}
+	if !fromStdin && len(paths) == 0 {
+		return failure.Usage("usage: hash-object [-t <type>] [-w] [--stdin] [--] <file>...")
+	}
+	switch objectType {
+	case objects.TypeBlob, objects.TypeTree, objects.TypeCommit, objects.TypeTag:
+	default:
+		return failure.Fatalf("fatal: invalid object type \"%v\"", objectType)
+	}
+	if write && !repo.IsGitDir(repository.GitDir) {
+		return failure.Fatal("fatal: not a git repository (or any of the parent directories): .git")
 	}
 
-	return createObject("tree", []byte(treeObjectContent))
+	if fromStdin {
+		content, err := io.ReadAll(stdin)
+		if err != nil {
+			return fmt.Errorf("Error reading stdin: %w", err)
+		}
+		if err := hashObjectContent(objectType, int64(len(content)), bytes.NewReader(content), write, stdout); err != nil {
+			return err
+		}
+	}
+	for _, filename := range paths {
+		if !filepath.IsAbs(filename) {
+			filename = filepath.Join(workTreePrefix, filename)
+		}
+		file, err := os.Open(filename)
+		if err != nil {
+			return failure.Fatalf("fatal: could not open '%v' for reading: %w", filename, err)
+		}
+		info, err := file.Stat()
+		if err == nil {
+			err = hashObjectContent(objectType, info.Size(), file, write, stdout)
+		}
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func createFileBlobObject(fp string) []byte {
-	fileBytes, err := os.ReadFile(fp)
+// hashObjectContent prints the name of size bytes from r as an objectType
+// object, storing it when write is set. Blobs are streamed; other types are
+// read whole so their format can be checked first.
+func hashObjectContent(objectType string, size int64, r io.Reader, write bool, stdout io.Writer) error {
+	if objectType != objects.TypeBlob {
+		content, err := io.ReadAll(io.LimitReader(r, size))
+		if err != nil {
+			return err
+		}
+		switch objectType {
+		case objects.TypeTree:
+			_, err = objects.ParseTree(repository.Algorithm, content)
+		case objects.TypeCommit:
+			_, err = objects.ParseCommit(content)
+		case objects.TypeTag:
+			_, err = objects.ParseTag(content)
+		}
+		if err != nil {
+			return failure.Fatalf("fatal: corrupt %v: %w", objectType, err)
+		}
+		size, r = int64(len(content)), bytes.NewReader(content)
+	}
+
+	var hash []byte
+	var err error
+	if write {
+		hash, err = repository.WriteObjectFromReader(objectType, size, r)
+	} else {
+		hash, err = objects.HashReader(repository.Algorithm, objectType, size, r)
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading file %v: %v", fp, err.Error())
-		os.Exit(1)
+		return err
 	}
-	return createObject("blob", fileBytes)
+	fmt.Fprintln(stdout, hex.EncodeToString(hash))
+	return nil
 }
 
-func createObject(objectType string, content []byte) []byte {
-	objectContent := fmt.Sprintf("%s %d\x00%s", objectType, len(content), content)
-	hash := sha1.Sum([]byte(objectContent))
-	compressedContent := compressContent([]byte(objectContent))
-	writeObject(hash[:], compressedContent)
-	return hash[:]
+// writeTree stores the worktree as a tree. Files whose index entries still
+// match them are taken to hold the blobs staged for them, which spares
+// reading every file again on each run; the index is only a shortcut here,
+// so one that cannot be read is passed over.
+func writeTree(stdout io.Writer) error {
+	var known repo.KnownBlob
+	if entries, err := readIndex(); err == nil {
+		staged := make(map[string]IndexEntry, len(entries))
+		for _, entry := range entries {
+			if entry.stage() == 0 {
+				staged[entry.path] = entry
+			}
+		}
+		known = func(path string, info fs.FileInfo) []byte {
+			entry, ok := staged[path]
+			executable := info.Mode()&0111 != 0
+			if !ok || entry.mode&0170000 != 0100000 || (entry.mode == 0100755) != executable || !indexEntryMatchesStat(entry, info) {
+				return nil
+			}
+			return entry.hash
+		}
+	}
+	treeObjectHash, err := repository.WriteTree(".", known)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, hex.EncodeToString(treeObjectHash))
+	return nil
 }
 
-func compressContent(content []byte) []byte {
-	var buffer bytes.Buffer
-	writer := zlib.NewWriter(&buffer)
-	writer.Write(content)
-	writer.Close()
-	return buffer.Bytes()
-}
+// commitTree writes a commit for a tree. Parents come from repeatable -p
+// options, so root and merge commits can be made. Each -m or -F adds a
+// paragraph to the message; without either the message is read from stdin
+// as is.
+func commitTree(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	treeArgs := make([]string, 0, 1)
+	parents := make([]string, 0, 1)
+	encoding := ""
+	var signing commitSigning
+	var message strings.Builder
+	messageGiven := false
+	addParagraph := func(paragraph string) {
+		if message.Len() > 0 {
+			message.WriteString("\n")
+		}
+		message.WriteString(paragraph)
+		if !strings.HasSuffix(paragraph, "\n") {
+			message.WriteString("\n")
+		}
+		messageGiven = true
+	}
 
-func writeObject(hash []byte, content []byte) {
-	objectsDir := ".git/objects"
-	hashString := hex.EncodeToString(hash)
-	objectFileDir := filepath.Join(objectsDir, hashString[:2])
-	objectFilePath := filepath.Join(objectFileDir, hashString[2:])
+	for index := 0; index < len(args); index++ {
+		arg := args[index]
+		switch {
+		case arg == "-p" || arg == "-m" || arg == "-F":
+			if index+1 >= len(args) {
+				return failure.Usagef("error: switch `%v' requires a value", arg[1:])
+			}
+			index++
+			value := args[index]
+			switch arg {
+			case "-p":
+				parentSHA, err := resolveRevision(value)
+				if err != nil {
+					return failure.Fatalf("fatal: not a valid object name %v", value)
+				}
+				if objectType, err := objectType(parentSHA); err != nil || objectType != "commit" {
+					return failure.Fatalf("fatal: %v is not a valid 'commit' object", parentSHA)
+				}
+				if slices.Contains(parents, parentSHA) {
+					fmt.Fprintf(stderr, "error: duplicate parent %v ignored\n", parentSHA)
+					continue
+				}
+				parents = append(parents, parentSHA)
+			case "-m":
+				addParagraph(value)
+			case "-F":
+				var content []byte
+				var err error
+				if value == "-" {
+					content, err = io.ReadAll(stdin)
+				} else {
+					content, err = os.ReadFile(value)
+				}
+				if err != nil {
+					return failure.Fatalf("fatal: could not read log file '%v': %w", value, err)
+				}
+				addParagraph(string(content))
+			}
+		case strings.HasPrefix(arg, "--encoding="):
+			encoding = strings.TrimPrefix(arg, "--encoding=")
+		case signing.option(arg):
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			return failure.Usagef("error: unknown option `%v'", strings.TrimLeft(arg, "-"))
+		default:
+			treeArgs = append(treeArgs, arg)
+		}
+	}
+	if len(treeArgs) != 1 {
+		return failure.Fatal("fatal: must give exactly one tree")
+	}
+	treeSHA, err := resolveRevision(treeArgs[0])
+	if err != nil {
+		return failure.Fatalf("fatal: not a valid object name %v", treeArgs[0])
+	}
+	// Unlike most commands commit-tree takes no tag or commit for a tree.
+	if objectType, err := objectType(treeSHA); err != nil || objectType != "tree" {
+		return failure.Fatalf("fatal: %v is not a valid 'tree' object", treeSHA)
+	}
 
-	if err := os.MkdirAll(objectFileDir, 0755); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to create directory %v: %v", objectFileDir, err.Error())
-		os.Exit(1)
+	if !messageGiven {
+		content, err := io.ReadAll(stdin)
+		if err != nil {
+			return err
+		}
+		message.Write(content)
 	}
 
-	if err := os.WriteFile(objectFilePath, content, 0644); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to create file %v: %v", objectFilePath, err.Error())
-		os.Exit(1)
+	signKey, err := signing.commitKey()
+	if err != nil {
+		return err
+	}
+	hash, err := createCommitObject(treeSHA, parents, message.String(), encoding, signKey)
+	if err != nil {
+		return err
 	}
+	fmt.Fprintln(stdout, hex.EncodeToString(hash))
+	return nil
 }
 
-func readAndDecompressFile(filePath string) string {
-	fileBytes, err := os.ReadFile(filePath)
+// createCommitObject writes a commit pointing at treeSHA with the given
+// parents. The message is stored as given, so it normally ends in a newline.
+// A signKey, when given, signs the commit.
+func createCommitObject(treeSHA string, parents []string, message string, encoding string, signKey string) ([]byte, error) {
+	author, err := authorIdentity()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading file: %v", filePath)
-		os.Exit(1)
+		return nil, err
 	}
-
-	bytesReader := bytes.NewReader(fileBytes)
-	zlibReader, err := zlib.NewReader(bytesReader)
+	committer, err := committerIdentity()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating new zlib reader: %v", err)
-		os.Exit(1)
+		return nil, err
+	}
+	commit := &objects.Commit{
+		Tree:      treeSHA,
+		Parents:   parents,
+		Author:    author,
+		Committer: committer,
+		Encoding:  encoding,
+		Message:   message,
+	}
+	content := commit.Encode()
+	if signKey != "" {
+		if content, err = signCommitObject(content, signKey); err != nil {
+			return nil, failure.Fatalf("%w\nfatal: failed to write commit object", err)
+		}
 	}
-	defer zlibReader.Close()
+	return repository.WriteObject(objects.TypeCommit, content)
+}
+
+// isBareRepository follows core.bare. Without it a git directory is bare
+// when it has no worktree and is not named .git.
+func isBareRepository() bool {
+	if cfg, err := repository.Config(); err == nil {
+		value, _ := cfg.Get("core.bare")
+		switch strings.ToLower(value) {
+		case "true", "yes", "on", "1":
+			return true
+		case "false", "no", "off", "0":
+			return false
+		}
+	}
+	return repository.WorkTree == "" && filepath.Base(absoluteGitDir()) != ".git"
+}
 
-	decompressedBytes, _ := io.ReadAll(zlibReader)
-	return string(decompressedBytes)
+func revParse(args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return failure.Usage("usage: rev-parse [--verify] [--short[=<n>]] <revision>... | --abbrev-ref <ref> | --is-inside-work-tree | --is-bare-repository | --show-toplevel")
+	}
+	verify, quiet, short := false, false, 0
+	revisions := make([]string, 0, 1)
+	for index := 0; index < len(args); index++ {
+		switch arg := args[index]; arg {
+		case "--abbrev-ref":
+			if index+1 >= len(args) {
+				return failure.Usage("usage: rev-parse --abbrev-ref <ref>")
+			}
+			index++
+			if err := revParseAbbrevRef(args[index], stdout); err != nil {
+				return err
+			}
+		case "--is-inside-work-tree", "--is-bare-repository", "--show-toplevel":
+			switch arg {
+			case "--is-inside-work-tree":
+				fmt.Fprintln(stdout, repository.WorkTree != "")
+			case "--is-bare-repository":
+				fmt.Fprintln(stdout, isBareRepository())
+			case "--show-toplevel":
+				if repository.WorkTree == "" {
+					return failure.Fatal("fatal: this operation must be run in a work tree")
+				}
+				fmt.Fprintln(stdout, repository.WorkTree)
+			}
+		case "--verify":
+			verify = true
+		case "-q", "--quiet":
+			quiet = true
+		case "--short":
+			short = 7
+		default:
+			if strings.HasPrefix(arg, "--short=") {
+				length, err := strconv.Atoi(strings.TrimPrefix(arg, "--short="))
+				if err != nil || length < 4 {
+					length = 4
+				}
+				short = length
+				continue
+			}
+			if strings.HasPrefix(arg, "-") {
+				return fmt.Errorf("unknown rev-parse option %v", arg)
+			}
+			revisions = append(revisions, arg)
+		}
+	}
+	if len(revisions) > 0 || verify {
+		return revParseRevisions(revisions, verify, quiet, short, stdout)
+	}
+	return nil
 }
 
-func commitTree() {
-	treeSHA := os.Args[2]
-	parentCommitSHA := os.Args[4]
-	commitMessage := os.Args[6]
-	author := "John Doe <john@example.com> 1631234567 -0700"
-	committer := "Jane Smith <jane@example.com> 1631234789 -0700"
+func revParseAbbrevRef(name string, stdout io.Writer) error {
+	if name != "HEAD" {
+		fmt.Fprintln(stdout, strings.TrimPrefix(strings.TrimPrefix(name, "refs/heads/"), "refs/tags/"))
+		return nil
+	}
+	ref, isSymref, err := readHeadSymref()
+	if err != nil {
+		return err
+	}
+	if !isSymref {
+		fmt.Fprintln(stdout, "HEAD")
+		return nil
+	}
+	fmt.Fprintln(stdout, strings.TrimPrefix(ref, "refs/heads/"))
+	return nil
+}
 
-	content := fmt.Sprintf("tree %v\n", treeSHA)
-	content += fmt.Sprintf("parent %v\n", parentCommitSHA)
-	content += fmt.Sprintf("author %v\n", author)
-	content += fmt.Sprintf("committer %v\n", committer)
-	content += "\n" + commitMessage + "\n"
+// replace records, lists (-l, with an optional glob) or deletes (-d)
+// replacements in refs/replace. Objects are named as revisions, and an
+// object is only replaced by one of the same type unless -f is given, which
+// also lets an existing replacement be overwritten. Replacements are not
+// followed while doing any of this.
+func replace(args []string, stdout io.Writer, stderr io.Writer) error {
+	repository.ReplaceObjects = false
+	list, remove, force := false, false, false
+	positional := make([]string, 0, 2)
+	for _, arg := range args {
+		switch arg {
+		case "-l", "--list":
+			list = true
+		case "-d", "--delete":
+			remove = true
+		case "-f", "--force":
+			force = true
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return failure.Usagef("error: unknown option `%v'", strings.TrimLeft(arg, "-"))
+			}
+			positional = append(positional, arg)
+		}
+	}
 
-	header := fmt.Sprintf("commit %v\x00", len([]byte(content)))
-	payload := header + content
+	switch {
+	case list || (len(positional) == 0 && !remove):
+		if remove || len(positional) > 1 {
+			return failure.Usage("usage: replace -l [<pattern>]")
+		}
+		replaceRefs, err := repository.Refs.List("refs/replace/")
+		if err != nil {
+			return err
+		}
+		for _, ref := range replaceRefs {
+			name := strings.TrimPrefix(ref.Name, "refs/replace/")
+			if len(positional) == 1 {
+				if matched, _ := filepath.Match(positional[0], name); !matched {
+					continue
+				}
+			}
+			fmt.Fprintln(stdout, name)
+		}
+		return nil
+	case remove:
+		if len(positional) == 0 {
+			return failure.Usage("usage: replace -d <object>...")
+		}
+		failed := false
+		for _, name := range positional {
+			sha, err := resolveRevision(name)
+			if err != nil {
+				fmt.Fprintf(stderr, "error: failed to resolve '%v' as a valid ref\n", name)
+				failed = true
+				continue
+			}
+			if err := repository.Refs.Delete("refs/replace/" + sha); err != nil {
+				fmt.Fprintf(stderr, "error: replace ref '%v' not found\n", sha)
+				failed = true
+				continue
+			}
+			fmt.Fprintf(stdout, "Deleted replace ref '%v'\n", sha)
+		}
+		if failed {
+			return errSilentFailure
+		}
+		return nil
+	case len(positional) != 2:
+		return failure.Usage("usage: replace [-f] <object> <replacement>")
+	}
 
-	hash := sha1.Sum([]byte(payload))
-	compressedContent := compressContent([]byte(payload))
-	writeObject(hash[:], compressedContent)
-	fmt.Println(hex.EncodeToString(hash[:]))
+	var shas [2]string
+	for index, name := range positional {
+		sha, err := resolveRevision(name)
+		if err != nil {
+			return fmt.Errorf("error: failed to resolve '%v' as a valid ref", name)
+		}
+		shas[index] = sha
+	}
+	object, replacement := shas[0], shas[1]
+	ref := "refs/replace/" + object
+	if _, err := repository.Refs.Read(ref); err == nil && !force {
+		return fmt.Errorf("error: replace ref '%v' already exists", ref)
+	}
+	if !force {
+		objectKind, err := objectType(object)
+		if err != nil {
+			return err
+		}
+		replacementKind, err := objectType(replacement)
+		if err != nil {
+			return err
+		}
+		if objectKind != replacementKind {
+			return fmt.Errorf("error: Objects must be of the same type.\n"+
+				"'%v' points to a replaced object of type '%v'\n"+
+				"while '%v' points to a replacement object of type '%v'.",
+				positional[0], objectKind, positional[1], replacementKind)
+		}
+	}
+	if object == replacement {
+		return fmt.Errorf("error: new object is the same as the old one: '%v'", object)
+	}
+	return repository.Refs.Write(ref, replacement)
 }
@@ -0,0 +1,564 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain lets the test binary stand in for mygit when a command runs it as
+// a subprocess, as the local transport does for upload-pack and
+// receive-pack, so mygit itself need not be installed.
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-test.") {
+		main()
+	}
+	os.Exit(m.Run())
+}
+
+// setupTest gives a test a fresh directory to work in, with a home of its
+// own and fixed identities, so nothing outside it affects the commands run.
+func setupTest(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	for _, name := range []string{"GIT_DIR", "GIT_WORK_TREE", "GIT_INDEX_FILE", "GIT_OBJECT_DIRECTORY"} {
+		// Setenv restores the variable afterwards; it is unset meanwhile.
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+	for _, role := range []string{"AUTHOR", "COMMITTER"} {
+		t.Setenv("GIT_"+role+"_NAME", "A U Thor")
+		t.Setenv("GIT_"+role+"_EMAIL", "author@example.com")
+		t.Setenv("GIT_"+role+"_DATE", "1700000000 +0000")
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(cwd) })
+	return dir
+}
+
+// runIn runs a mygit command in dir as the binary would, with stdin as its
+// input, and returns what it printed and its exit code.
+func runIn(t *testing.T, dir string, stdin string, args ...string) (string, string, int) {
+	t.Helper()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return stdout.String(), stderr.String(), code
+}
+
+// mygit runs a command in dir and returns its output, failing the test
+// unless it succeeds.
+func mygit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	stdout, stderr, code := runIn(t, dir, "", args...)
+	if code != 0 {
+		t.Fatalf("mygit %v: exit %v\n%v", strings.Join(args, " "), code, stderr)
+	}
+	return stdout
+}
+
+// mygitInput runs a command in dir with stdin as its input and returns its
+// output, failing the test unless it succeeds.
+func mygitInput(t *testing.T, dir string, stdin string, args ...string) string {
+	t.Helper()
+	stdout, stderr, code := runIn(t, dir, stdin, args...)
+	if code != 0 {
+		t.Fatalf("mygit %v: exit %v\n%v", strings.Join(args, " "), code, stderr)
+	}
+	return stdout
+}
+
+// writeFile writes content to name under dir, making its directories.
+func writeFile(t *testing.T, dir string, name string, content string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// requireGit skips a test that checks mygit against git when git is not
+// installed.
+func requireGit(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+}
+
+// runGit runs git in dir and returns its output, failing the test unless it
+// succeeds.
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	var stderr bytes.Buffer
+	command := exec.Command("git", args...)
+	command.Dir, command.Stderr = dir, &stderr
+	out, err := command.Output()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%v", strings.Join(args, " "), err, stderr.String())
+	}
+	return string(out)
+}
+
+// writeRawTree stores a tree of (mode, name, hash) entries exactly as given,
+// unsorted and unchecked, for building trees no well-behaved writer makes.
+func writeRawTree(t *testing.T, dir string, entries ...[3]string) string {
+	t.Helper()
+	var tree bytes.Buffer
+	for _, entry := range entries {
+		hash, err := hex.DecodeString(entry[2])
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree.WriteString(entry[0] + " " + entry[1] + "\x00")
+		tree.Write(hash)
+	}
+	return strings.TrimSpace(mygitInput(t, dir, tree.String(), "hash-object", "-t", "tree", "-w", "--stdin"))
+}
+
+func TestHashObjectCatFile(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	writeFile(t, dir, "hello.txt", "hello\n")
+
+	sha := strings.TrimSpace(mygit(t, dir, "hash-object", "-w", "hello.txt"))
+	if sha != "ce013625030ba8dba906f756967f9e9ca394464a" {
+		t.Fatalf("hash-object -w = %v", sha)
+	}
+	if got := mygit(t, dir, "cat-file", "-t", sha); got != "blob\n" {
+		t.Errorf("cat-file -t = %q", got)
+	}
+	if got := mygit(t, dir, "cat-file", "-s", sha); got != "6\n" {
+		t.Errorf("cat-file -s = %q", got)
+	}
+	if got := mygit(t, dir, "cat-file", "-p", sha); got != "hello\n" {
+		t.Errorf("cat-file -p = %q", got)
+	}
+	if _, _, code := runIn(t, dir, "", "cat-file", "-p", "0000000000000000000000000000000000000000"); code != 128 {
+		t.Errorf("cat-file -p of a missing object exited %v", code)
+	}
+}
+
+// commitFile writes and commits one file, returning the new commit's name.
+func commitFile(t *testing.T, dir string, name string, content string, message string) string {
+	t.Helper()
+	writeFile(t, dir, name, content)
+	mygit(t, dir, "add", name)
+	mygit(t, dir, "commit", "-m", message)
+	return strings.TrimSpace(mygit(t, dir, "rev-parse", "HEAD"))
+}
+
+func TestRevParseAbbrevRef(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	sha := commitFile(t, dir, "f", "one\n", "one")
+
+	if got := mygit(t, dir, "rev-parse", "--abbrev-ref", "HEAD"); got != "main\n" {
+		t.Errorf("on a branch: %q", got)
+	}
+	writeFile(t, dir, ".git/HEAD", sha+"\n")
+	if got := mygit(t, dir, "rev-parse", "--abbrev-ref", "HEAD"); got != "HEAD\n" {
+		t.Errorf("detached: %q", got)
+	}
+}
+
+func TestCommitTreeEncoding(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	writeFile(t, dir, "f", "one\n")
+	mygit(t, dir, "add", "f")
+	tree := strings.TrimSpace(mygit(t, dir, "write-tree"))
+
+	// "café" in Latin-1, which is not valid UTF-8.
+	sha := strings.TrimSpace(mygit(t, dir, "commit-tree", tree, "--encoding=ISO-8859-1", "-m", "caf\xe9"))
+	raw := mygit(t, dir, "cat-file", "-p", sha)
+	if !strings.Contains(raw, "\nencoding ISO-8859-1\n\ncaf\xe9\n") {
+		t.Errorf("commit object:\n%q", raw)
+	}
+	if got := mygit(t, dir, "log", sha); !strings.HasSuffix(got, "\n\n    café\n") {
+		t.Errorf("log does not decode the message:\n%q", got)
+	}
+}
+
+func TestCommitTreeParentsAndMessages(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	first := commitFile(t, dir, "f", "one\n", "one")
+	second := commitFile(t, dir, "f", "two\n", "two")
+	tree := strings.TrimSpace(mygit(t, dir, "rev-parse", "HEAD^{tree}"))
+	writeFile(t, dir, "message", "from a file\n")
+
+	for _, test := range []struct {
+		args    []string
+		stdin   string
+		message string
+	}{
+		{[]string{"-m", "one", "-m", "two"}, "", "one\n\ntwo\n"},
+		{nil, "from stdin\n", "from stdin\n"},
+		{[]string{"-F", "message", "-m", "after"}, "", "from a file\n\nafter\n"},
+		{[]string{"-F", "-"}, "dash\n", "dash\n"},
+	} {
+		sha := strings.TrimSpace(mygitInput(t, dir, test.stdin, append([]string{"commit-tree", tree, "-p", first, "-p", second}, test.args...)...))
+		raw := mygit(t, dir, "cat-file", "-p", sha)
+		if want := "tree " + tree + "\nparent " + first + "\nparent " + second + "\n"; !strings.HasPrefix(raw, want) {
+			t.Errorf("commit-tree %v made:\n%v", test.args, raw)
+		}
+		if !strings.HasSuffix(raw, "+0000\n\n"+test.message) {
+			t.Errorf("commit-tree %v gave the message:\n%v\nwant:\n%v", test.args, raw, test.message)
+		}
+	}
+
+	_, stderr, code := runIn(t, dir, "", "commit-tree", tree, "-p", first, "-p", first, "-m", "dup")
+	if code != 0 || stderr != "error: duplicate parent "+first+" ignored\n" {
+		t.Errorf("commit-tree with a duplicate parent: exit %v\n%v", code, stderr)
+	}
+	for _, args := range [][]string{{"HEAD", "-m", "x"}, {tree, "-p", tree, "-m", "x"}, {tree, "-p", "nope", "-m", "x"}} {
+		if _, _, code := runIn(t, dir, "", append([]string{"commit-tree"}, args...)...); code != 128 {
+			t.Errorf("commit-tree %v exited %v", args, code)
+		}
+	}
+}
+
+func TestCommitEncoding(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	writeFile(t, dir, "f", "one\n")
+	mygit(t, dir, "add", "f")
+	mygit(t, dir, "commit", "--encoding=ISO-8859-1", "-m", "caf\xe9")
+	if raw := mygit(t, dir, "cat-file", "-p", "HEAD"); !strings.Contains(raw, "\nencoding ISO-8859-1\n\ncaf\xe9\n") {
+		t.Errorf("commit --encoding:\n%q", raw)
+	}
+
+	// Latin-1 bytes that also read as UTF-8 are still decoded as Latin-1.
+	writeFile(t, dir, ".git/config", "[i18n]\n\tcommitEncoding = ISO-8859-1\n")
+	commitFile(t, dir, "f", "two\n", "\xc3\xa9")
+	if raw := mygit(t, dir, "cat-file", "-p", "HEAD"); !strings.Contains(raw, "\nencoding ISO-8859-1\n") {
+		t.Errorf("commit with i18n.commitEncoding:\n%q", raw)
+	}
+	var subjects []string
+	for _, line := range strings.Split(strings.TrimSuffix(mygit(t, dir, "log", "--oneline"), "\n"), "\n") {
+		_, subject, _ := strings.Cut(line, " ")
+		subjects = append(subjects, subject)
+	}
+	if got := strings.Join(subjects, ","); got != "\u00c3\u00a9,café" {
+		t.Errorf("log --oneline subjects: %q", got)
+	}
+
+	// A UTF-8 message needs no header.
+	writeFile(t, dir, ".git/config", "[i18n]\n\tcommitEncoding = UTF-8\n")
+	commitFile(t, dir, "f", "three\n", "utf")
+	if raw := mygit(t, dir, "cat-file", "-p", "HEAD"); strings.Contains(raw, "\nencoding ") {
+		t.Errorf("commit in UTF-8:\n%q", raw)
+	}
+}
+
+func TestLsTreeObjectOnly(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	writeFile(t, dir, "a", "a\n")
+	writeFile(t, dir, "dir/b", "b\n")
+	writeFile(t, dir, "dir/sub/c", "c\n")
+	mygit(t, dir, "add", ".")
+	tree := strings.TrimSpace(mygit(t, dir, "write-tree"))
+
+	for _, test := range []struct {
+		flags []string
+		lines int
+	}{
+		{nil, 2},
+		{[]string{"-r"}, 3},
+	} {
+		want := ""
+		listing := mygit(t, dir, append(append([]string{"ls-tree"}, test.flags...), tree)...)
+		for _, line := range strings.Split(strings.TrimSuffix(listing, "\n"), "\n") {
+			want += strings.Fields(line)[2] + "\n"
+		}
+		got := mygit(t, dir, append(append([]string{"ls-tree", "--object-only"}, test.flags...), tree)...)
+		if got != want || strings.Count(got, "\n") != test.lines {
+			t.Errorf("ls-tree --object-only %v:\n%v\nwant %v lines:\n%v", test.flags, got, test.lines, want)
+		}
+	}
+}
+
+func TestLogFollowsReplacement(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	first := commitFile(t, dir, "f", "one\n", "one")
+	commitFile(t, dir, "f", "two\n", "two")
+	tree := strings.TrimSpace(mygit(t, dir, "rev-parse", first+"^{tree}"))
+	replacement := strings.TrimSpace(mygit(t, dir, "commit-tree", tree, "-m", "replacement"))
+
+	mygit(t, dir, "replace", first, replacement)
+	subjects := func(args ...string) string {
+		var out []string
+		for _, line := range strings.Split(strings.TrimSuffix(mygit(t, dir, args...), "\n"), "\n") {
+			_, subject, _ := strings.Cut(line, " ")
+			out = append(out, subject)
+		}
+		return strings.Join(out, ",")
+	}
+	if got := subjects("log", "--oneline"); got != "two,replacement" {
+		t.Errorf("log with the replacement: %v", got)
+	}
+	if got := subjects("--no-replace-objects", "log", "--oneline"); got != "two,one" {
+		t.Errorf("log --no-replace-objects: %v", got)
+	}
+}
+
+func TestReplaceRefs(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	first := commitFile(t, dir, "f", "one\n", "one")
+	second := commitFile(t, dir, "f", "two\n", "two")
+
+	// Objects are named as revisions, and must be of the same type.
+	_, stderr, code := runIn(t, dir, "", "replace", "HEAD", "HEAD^{tree}")
+	if code == 0 || !strings.Contains(stderr, "error: Objects must be of the same type.") {
+		t.Errorf("replacing a commit with a tree: exit %v, %q", code, stderr)
+	}
+	mygit(t, dir, "replace", "HEAD~1", "HEAD")
+	if _, stderr, code := runIn(t, dir, "", "replace", "HEAD~1", "HEAD"); code == 0 || !strings.Contains(stderr, "already exists") {
+		t.Errorf("replacing again: exit %v, %q", code, stderr)
+	}
+	if got := mygit(t, dir, "replace", "-l"); got != first+"\n" {
+		t.Errorf("replace -l = %q", got)
+	}
+
+	// Packed replacements are listed, followed and deleted too.
+	refsDir := filepath.Join(dir, ".git/refs/replace")
+	if err := os.RemoveAll(refsDir); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, dir, ".git/packed-refs", "# pack-refs with: sorted \n"+second+" refs/heads/main\n"+second+" refs/replace/"+first+"\n")
+	if got := mygit(t, dir, "replace", "-l", first[:2]+"*"); got != first+"\n" {
+		t.Errorf("replace -l of a packed replacement = %q", got)
+	}
+	if got := mygit(t, dir, "cat-file", "-p", first); !strings.HasSuffix(got, "\ntwo\n") {
+		t.Errorf("a packed replacement is not followed:\n%v", got)
+	}
+	if got := mygit(t, dir, "replace", "-d", first); got != "Deleted replace ref '"+first+"'\n" {
+		t.Errorf("replace -d = %q", got)
+	}
+	if got := mygit(t, dir, "replace", "-l"); got != "" {
+		t.Errorf("replace -l after deleting = %q", got)
+	}
+	if _, _, code := runIn(t, dir, "", "replace", "-d", first); code == 0 {
+		t.Error("deleting a missing replacement succeeded")
+	}
+}
+
+func TestRevParseRepositoryKind(t *testing.T) {
+	dir := setupTest(t)
+	work, bare, outside := filepath.Join(dir, "work"), filepath.Join(dir, "bare.git"), filepath.Join(dir, "outside")
+	for _, path := range []string{work, outside} {
+		if err := os.Mkdir(path, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mygit(t, work, "init")
+	mygit(t, dir, "init", "--bare", bare)
+
+	for _, test := range []struct {
+		dir         string
+		inside      string
+		bare        string
+		description string
+	}{
+		{work, "true", "false", "worktree"},
+		{filepath.Join(work, ".git"), "false", "false", "git directory of a worktree"},
+		{bare, "false", "true", "bare repository"},
+	} {
+		if got := mygit(t, test.dir, "rev-parse", "--is-inside-work-tree"); got != test.inside+"\n" {
+			t.Errorf("%v: --is-inside-work-tree = %q", test.description, got)
+		}
+		if got := mygit(t, test.dir, "rev-parse", "--is-bare-repository"); got != test.bare+"\n" {
+			t.Errorf("%v: --is-bare-repository = %q", test.description, got)
+		}
+	}
+	// core.bare wins over the layout either way.
+	writeFile(t, work, ".git/config", "[core]\n\tbare = yes\n")
+	if got := mygit(t, work, "rev-parse", "--is-bare-repository"); got != "true\n" {
+		t.Errorf("worktree with core.bare set: --is-bare-repository = %q", got)
+	}
+	writeFile(t, bare, "config", "[core]\n\tbare = false\n")
+	if got := mygit(t, bare, "rev-parse", "--is-bare-repository"); got != "false\n" {
+		t.Errorf("bare layout with core.bare false: --is-bare-repository = %q", got)
+	}
+	writeFile(t, work, ".git/config", "")
+
+	resolved, err := filepath.EvalSymlinks(work)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mygit(t, work, "rev-parse", "--show-toplevel"); got != resolved+"\n" && got != work+"\n" {
+		t.Errorf("--show-toplevel = %q, want %v", got, work)
+	}
+
+	for parent := outside; parent != filepath.Dir(parent); parent = filepath.Dir(parent) {
+		if _, err := os.Stat(filepath.Join(parent, ".git")); err == nil {
+			t.Skipf("%v is inside the repository at %v", outside, parent)
+		}
+	}
+	for _, flag := range []string{"--is-inside-work-tree", "--is-bare-repository"} {
+		_, stderr, code := runIn(t, outside, "", "rev-parse", flag)
+		if code != 128 || !strings.HasPrefix(stderr, "fatal: not a git repository") {
+			t.Errorf("%v outside a repository: exit %v, %q", flag, code, stderr)
+		}
+	}
+}
+
+func TestHashObjectDashFilename(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	writeFile(t, dir, "-w", "hello\n")
+
+	if got := mygit(t, dir, "hash-object", "--", "-w"); got != "ce013625030ba8dba906f756967f9e9ca394464a\n" {
+		t.Errorf("hash-object -- -w = %q", got)
+	}
+	// The file was only hashed, -w being its name rather than the option.
+	if _, err := os.Stat(filepath.Join(dir, ".git/objects/ce/013625030ba8dba906f756967f9e9ca394464a")); err == nil {
+		t.Error("hash-object -- -w wrote the object")
+	}
+}
+
+func TestHashObjectStdinWriteAndType(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	objectPath := filepath.Join(dir, ".git/objects/ce/013625030ba8dba906f756967f9e9ca394464a")
+
+	if got := mygitInput(t, dir, "hello\n", "hash-object", "--stdin"); got != "ce013625030ba8dba906f756967f9e9ca394464a\n" {
+		t.Errorf("hash-object --stdin = %q", got)
+	}
+	if _, err := os.Stat(objectPath); err == nil {
+		t.Error("hash-object without -w wrote the object")
+	}
+	mygitInput(t, dir, "hello\n", "hash-object", "-w", "--stdin")
+	if _, err := os.Stat(objectPath); err != nil {
+		t.Errorf("hash-object -w --stdin did not write the object: %v", err)
+	}
+
+	writeFile(t, dir, "one", "one\n")
+	writeFile(t, dir, "two", "two\n")
+	if got, want := mygit(t, dir, "hash-object", "one", "two"), "5626abf0f72e58d7a153368ba57db4c673c0e171\nf719efd430d52bcfc8566a43b2eb655688d38871\n"; got != want {
+		t.Errorf("hash-object one two = %q, want %q", got, want)
+	}
+
+	commit := "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\nauthor A <a@example.com> 1 +0000\ncommitter A <a@example.com> 1 +0000\n\nempty\n"
+	sha := strings.TrimSpace(mygitInput(t, dir, commit, "hash-object", "-t", "commit", "--stdin"))
+	if got := mygitInput(t, dir, commit, "hash-object", "-t", "blob", "--stdin"); got == sha+"\n" {
+		t.Error("the type did not change the hash")
+	}
+	for _, test := range []struct{ objectType, content, stderr string }{
+		{"bogus", "x", "fatal: invalid object type \"bogus\""},
+		{"tag", "hi\n", "fatal: corrupt tag"},
+		{"tree", "junk", "fatal: corrupt tree"},
+	} {
+		if _, stderr, code := runIn(t, dir, test.content, "hash-object", "-t", test.objectType, "--stdin"); code != 128 || !strings.HasPrefix(stderr, test.stderr) {
+			t.Errorf("hash-object -t %v of %q: exit %v\n%v", test.objectType, test.content, code, stderr)
+		}
+	}
+}
+
+func TestRefFileLineEndings(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	sha := commitFile(t, dir, "f", "one\n", "one")
+
+	writeFile(t, dir, ".git/refs/heads/bare", sha)
+	writeFile(t, dir, ".git/refs/heads/crlf", sha+"\r\n")
+	writeFile(t, dir, ".git/refs/tags/crlf", sha+"\r\n")
+	for _, name := range []string{"bare", "crlf", "refs/heads/crlf", "tags/crlf"} {
+		if got := mygit(t, dir, "rev-parse", name); got != sha+"\n" {
+			t.Errorf("rev-parse %v = %q", name, got)
+		}
+	}
+	writeFile(t, dir, ".git/HEAD", "ref: refs/heads/crlf\r\n")
+	if got := mygit(t, dir, "rev-parse", "--abbrev-ref", "HEAD"); got != "crlf\n" {
+		t.Errorf("HEAD with CRLF names %q", got)
+	}
+
+	// Refs are written back with a single newline.
+	mygit(t, dir, "update-ref", "refs/heads/bare", sha)
+	if content, err := os.ReadFile(filepath.Join(dir, ".git/refs/heads/bare")); err != nil || string(content) != sha+"\n" {
+		t.Errorf("refs/heads/bare = %q, %v", content, err)
+	}
+}
+
+// TestWriteTreeOrderMatchesGit checks that the worktree, which is what
+// write-tree stores, gets the tree git makes of the same files once they are
+// staged, down to the order of the entries.
+func TestWriteTreeOrderMatchesGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	// Names that sort differently byte-wise, case-insensitively and with
+	// directories taken as ending in "/".
+	for _, name := range []string{
+		"bar", "Bar", "bar.c", "bar-", "bar0", "b", "ba",
+		"foo/x", "foo.txt", "foo-bar", "foo0", "FOO/y",
+		"sub/dir/z", "sub/dir.c", "sub/dir-", "sub/Dir/a",
+	} {
+		writeFile(t, dir, name, name+"\n")
+	}
+	if err := os.Chmod(filepath.Join(dir, "bar.c"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	got := mygit(t, dir, "write-tree")
+
+	var stderr bytes.Buffer
+	command := exec.Command("sh", "-c", "git add . && git write-tree")
+	command.Dir, command.Stderr = dir, &stderr
+	want, err := command.Output()
+	if err != nil {
+		t.Fatalf("git add and write-tree: %v\n%v", err, stderr.String())
+	}
+	if got != string(want) {
+		t.Errorf("write-tree of the worktree = %v, git write-tree of the same files staged = %s", got, want)
+	}
+}
+
+func TestWriteTreeRecordsModes(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	writeFile(t, dir, "plain", "plain\n")
+	writeFile(t, dir, "run", "#!/bin/sh\n")
+	if err := os.Chmod(filepath.Join(dir, "run"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("plain", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	mygit(t, sub, "init")
+	subHead := commitFile(t, sub, "s", "s\n", "s")
+
+	tree := strings.TrimSpace(mygit(t, dir, "write-tree"))
+	link := strings.TrimSpace(mygitInput(t, dir, "plain", "hash-object", "--stdin"))
+	want := "120000 blob " + link + "\tlink\n" +
+		"100644 blob b9bca019c83a65e6d717d0b6da86215f45dde1b3\tplain\n" +
+		"100755 blob 1a2485251c33a70432394c93fb89330ef214bfc9\trun\n" +
+		"160000 commit " + subHead + "\tsub\n"
+	if got := mygit(t, dir, "ls-tree", tree); got != want {
+		t.Errorf("ls-tree of write-tree:\n%v\nwant:\n%v", got, want)
+	}
+}
@@ -0,0 +1,689 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+	"github.com/codecrafters-io/git-starter-go/pkg/diff"
+)
+
+// merge joins the history of another commit into the current branch. When
+// HEAD is an ancestor of it the branch is fast-forwarded; otherwise the trees
+// are merged against the merge base, or the merge of several, and unless
+// paths conflict committed with both commits as parents. Conflicts are left in the working tree with
+// markers and in the index as stages 1 to 3, and MERGE_HEAD records the
+// merge for the commit that concludes it.
+func merge(args []string, stdout io.Writer, stderr io.Writer) error {
+	noFF, ffOnly := false, false
+	message := ""
+	var signing commitSigning
+	targets := make([]string, 0, 1)
+	for index := 0; index < len(args); index++ {
+		switch arg := args[index]; {
+		case signing.option(arg):
+		case arg == "--no-ff":
+			noFF, ffOnly = true, false
+		case arg == "--ff-only":
+			noFF, ffOnly = false, true
+		case arg == "--ff":
+			noFF, ffOnly = false, false
+		case arg == "--abort" && len(args) == 1:
+			return abortMerge()
+		case arg == "-m" && index+1 < len(args):
+			index++
+			message = args[index]
+		case strings.HasPrefix(arg, "--message="):
+			message = strings.TrimPrefix(arg, "--message=")
+		case strings.HasPrefix(arg, "-m") && len(arg) > 2:
+			message = strings.TrimPrefix(arg, "-m")
+		case strings.HasPrefix(arg, "-"):
+			return failure.Usage("usage: merge [--no-ff | --ff-only] [-S[<keyid>]] [-m <message>] <commit>")
+		default:
+			targets = append(targets, arg)
+		}
+	}
+	if len(targets) != 1 {
+		return failure.Usage("usage: merge [--no-ff | --ff-only] [-S[<keyid>]] [-m <message>] <commit>")
+	}
+	name := targets[0]
+
+	theirsSHA, err := resolveRevision(name)
+	if err == nil {
+		theirsSHA, err = peelObject(theirsSHA, "commit")
+	}
+	if err != nil {
+		return fmt.Errorf("merge: %v - not something we can merge", name)
+	}
+	entries, err := readIndex()
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.stage() != 0 {
+			return errors.New("error: Merging is not possible because you have unmerged files.\nhint: Fix them up in the work tree, and then use 'git add/rm <file>'\nhint: as appropriate to mark resolution and make a commit.\nfatal: Exiting because of an unresolved conflict.")
+		}
+	}
+	if _, err := repository.Refs.Read("MERGE_HEAD"); err == nil {
+		return failure.Fatal("fatal: You have not concluded your merge (MERGE_HEAD exists).\nPlease, commit your changes before you merge.")
+	}
+
+	headRef, isSymref, err := readHeadSymref()
+	if err != nil {
+		return err
+	}
+	headSHA, err := resolveHead()
+	if err != nil {
+		return err
+	}
+	updateHead := func(commitSHA string, action string) error {
+		if isSymref {
+			return writeRef(headRef, commitSHA, action)
+		}
+		return writeRef("HEAD", commitSHA, action)
+	}
+	theirsTreeSHA, err := commitTreeSHA(theirsSHA)
+	if err != nil {
+		return err
+	}
+	if headSHA == "" {
+		// An unborn branch simply takes on the other history.
+		if err := switchWorktree(theirsTreeSHA, false, "merge"); err != nil {
+			return err
+		}
+		return updateHead(theirsSHA, "initial pull")
+	}
+
+	bases, err := mergeBases(headSHA, theirsSHA)
+	if err != nil {
+		return err
+	}
+	switch {
+	case slices.Contains(bases, theirsSHA):
+		fmt.Fprintln(stdout, "Already up to date.")
+		return nil
+	case slices.Contains(bases, headSHA) && !noFF:
+		from, err := abbreviateSHA(headSHA, 7)
+		if err != nil {
+			return err
+		}
+		to, err := abbreviateSHA(theirsSHA, 7)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Updating %v..%v\n", from, to)
+		headFiles, err := headTreeFiles()
+		if err != nil {
+			return err
+		}
+		if err := switchWorktree(theirsTreeSHA, false, "merge"); err != nil {
+			return err
+		}
+		if err := repository.Refs.Write("ORIG_HEAD", headSHA); err != nil {
+			return err
+		}
+		if err := updateHead(theirsSHA, "merge "+name+": Fast-forward"); err != nil {
+			return err
+		}
+		theirsFiles, err := flattenTree(theirsTreeSHA)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, "Fast-forward")
+		return writeDiffStat(treeDiffFiles(headFiles), treeDiffFiles(theirsFiles), stdout)
+	case ffOnly:
+		return failure.Fatal("fatal: Not possible to fast-forward, aborting.")
+	case len(bases) == 0:
+		return failure.Fatal("fatal: refusing to merge unrelated histories")
+	}
+	if message == "" {
+		message = mergeMessage(name, headRef, isSymref)
+	}
+
+	// A criss-cross history has several merge bases, which are merged into
+	// a virtual one first.
+	baseFiles, err := mergedBaseFiles(bases)
+	if err != nil {
+		return err
+	}
+	oursFiles, err := headTreeFiles()
+	if err != nil {
+		return err
+	}
+	theirsFiles, err := flattenTree(theirsTreeSHA)
+	if err != nil {
+		return err
+	}
+
+	// Like git's ort strategy we need the index to match HEAD, so nothing
+	// staged can be lost when the index is rewritten.
+	indexed := make(map[string]IndexEntry, len(entries))
+	staged := make([]string, 0)
+	for _, entry := range entries {
+		indexed[entry.path] = entry
+		if file, ok := oursFiles[entry.path]; !ok || !sameTreeFile(file, treeFileFromIndex(entry)) {
+			staged = append(staged, entry.path)
+		}
+	}
+	for path := range oursFiles {
+		if _, ok := indexed[path]; !ok {
+			staged = append(staged, path)
+		}
+	}
+	if len(staged) > 0 {
+		return overwriteError("Your local changes to the following files would be overwritten by merge", staged,
+			"Please commit your changes or stash them before you merge.")
+	}
+
+	merged, err := mergeTrees(baseFiles, oursFiles, theirsFiles, "HEAD", name, stdout, stderr)
+	if err != nil {
+		return err
+	}
+	targetFiles := make(map[string]TreeFile, len(merged))
+	changed, dirty, untracked := make([]string, 0), make([]string, 0), make([]string, 0)
+	conflicts := make([]string, 0)
+	for path, result := range merged {
+		if result.present {
+			targetFiles[path] = result.file
+		}
+		if result.conflict {
+			conflicts = append(conflicts, path)
+		}
+		oursFile, inOurs := oursFiles[path]
+		if inOurs == result.present && (!inOurs || sameTreeFile(oursFile, result.file)) {
+			continue
+		}
+		changed = append(changed, path)
+		if !inOurs {
+			if untrackedInTheWay(path, indexed) {
+				untracked = append(untracked, path)
+			}
+			continue
+		}
+		modified, err := worktreeModified(indexed[path])
+		if err != nil {
+			return err
+		}
+		if modified {
+			dirty = append(dirty, path)
+		}
+	}
+	if err := updateWorktree("merge", dirty, untracked, changed, targetFiles, indexed); err != nil {
+		return err
+	}
+
+	updated := make([]IndexEntry, 0, len(indexed))
+	sort.Strings(conflicts)
+	for _, path := range conflicts {
+		delete(indexed, path)
+		for stage, file := range merged[path].stages {
+			if file == nil {
+				continue
+			}
+			mode, err := strconv.ParseUint(file.mode, 8, 32)
+			if err != nil {
+				return fmt.Errorf("Invalid mode %v for %v", file.mode, path)
+			}
+			updated = append(updated, IndexEntry{mode: uint32(mode), hash: file.hash, path: path, flags: uint16(stage+1) << 12})
+		}
+	}
+	for _, entry := range indexed {
+		updated = append(updated, entry)
+	}
+	if err := writeIndex(updated); err != nil {
+		return err
+	}
+	if err := repository.Refs.Write("ORIG_HEAD", headSHA); err != nil {
+		return err
+	}
+
+	if len(conflicts) > 0 {
+		if err := repository.Refs.Write("MERGE_HEAD", theirsSHA); err != nil {
+			return err
+		}
+		mergeMsg := message + "\n\n# Conflicts:\n"
+		for _, path := range conflicts {
+			mergeMsg += "#\t" + path + "\n"
+		}
+		for file, content := range map[string]string{"MERGE_MSG": mergeMsg, "MERGE_MODE": ""} {
+			if err := os.WriteFile(repository.Path(file), []byte(content), 0644); err != nil {
+				return fmt.Errorf("Failed to create file %v: %w", repository.Path(file), err)
+			}
+		}
+		fmt.Fprintln(stdout, "Automatic merge failed; fix conflicts and then commit the result.")
+		return errSilentFailure
+	}
+
+	treeHash, err := writeTreeFromIndex(updated)
+	if err != nil {
+		return err
+	}
+	signKey, err := signing.commitKey()
+	if err != nil {
+		return err
+	}
+	commitHash, err := createCommitObject(hex.EncodeToString(treeHash), []string{headSHA, theirsSHA}, message+"\n", "", signKey)
+	if err != nil {
+		return err
+	}
+	if err := updateHead(hex.EncodeToString(commitHash), "merge "+name+": Merge made by the 'ort' strategy."); err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, "Merge made by the 'ort' strategy.")
+	return writeDiffStat(treeDiffFiles(oursFiles), treeDiffFiles(targetFiles), stdout)
+}
+
+// abortMerge goes back to before a merge that stopped with conflicts,
+// resetting the paths it touched to HEAD. Local changes to other paths stay.
+func abortMerge() error {
+	if _, err := repository.Refs.Read("MERGE_HEAD"); err != nil {
+		return failure.Fatal("fatal: There is no merge to abort (MERGE_HEAD missing).")
+	}
+	headFiles, err := headTreeFiles()
+	if err != nil {
+		return err
+	}
+	entries, err := readIndex()
+	if err != nil {
+		return err
+	}
+	// The merge started from an index matching HEAD, so whatever differs from
+	// HEAD now is its doing.
+	indexed := make(map[string]IndexEntry, len(entries))
+	touched := make(map[string]bool)
+	for _, entry := range entries {
+		indexed[entry.path] = entry
+		if file, ok := headFiles[entry.path]; entry.stage() != 0 || !ok || !sameTreeFile(file, treeFileFromIndex(entry)) {
+			touched[entry.path] = true
+		}
+	}
+	for path := range headFiles {
+		if _, ok := indexed[path]; !ok {
+			touched[path] = true
+		}
+	}
+	changed := make([]string, 0, len(touched))
+	for path := range touched {
+		changed = append(changed, path)
+	}
+	if err := updateWorktree("merge", nil, nil, changed, headFiles, indexed); err != nil {
+		return err
+	}
+	updated := make([]IndexEntry, 0, len(indexed))
+	for _, entry := range indexed {
+		updated = append(updated, entry)
+	}
+	if err := writeIndex(updated); err != nil {
+		return err
+	}
+	return clearMergeState()
+}
+
+// clearMergeState removes the files recording a merge in progress.
+func clearMergeState() error {
+	for _, name := range []string{"MERGE_HEAD", "MERGE_MSG", "MERGE_MODE"} {
+		if err := os.Remove(repository.Path(name)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("Failed to remove %v: %w", repository.Path(name), err)
+		}
+	}
+	return nil
+}
+
+// mergeMessage is the default merge commit message, naming what was merged
+// in the way git's fmt-merge-msg does.
+func mergeMessage(name string, headRef string, isSymref bool) string {
+	message := fmt.Sprintf("Merge commit '%v'", name)
+	for _, kind := range [][2]string{{"refs/heads/", "branch"}, {"refs/remotes/", "remote-tracking branch"}, {"refs/tags/", "tag"}} {
+		if _, err := repository.Refs.Read(kind[0] + name); err == nil {
+			message = fmt.Sprintf("Merge %v '%v'", kind[1], name)
+			break
+		}
+	}
+	// As with merge.suppressDest unset, merges into main and master do not
+	// name the branch they went into.
+	switch branch := strings.TrimPrefix(headRef, "refs/heads/"); {
+	case !isSymref:
+		message += " into HEAD"
+	case branch != "main" && branch != "master":
+		message += " into " + branch
+	}
+	return message
+}
+
+// mergeBase prints the best common ancestor of the first commit and the
+// others, or with --all every one of them, newest first. --is-ancestor
+// instead reports through the exit status whether the first commit is an
+// ancestor of the second.
+func mergeBase(args []string, stdout io.Writer) error {
+	all, isAncestorMode := false, false
+	revisions := make([]string, 0, 2)
+	for _, arg := range args {
+		switch arg {
+		case "-a", "--all":
+			all = true
+		case "--is-ancestor":
+			isAncestorMode = true
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return failure.Usage("usage: merge-base [-a | --all] <commit> <commit>...\n   or: merge-base --is-ancestor <commit> <commit>")
+			}
+			revisions = append(revisions, arg)
+		}
+	}
+	if len(revisions) < 2 || isAncestorMode && (all || len(revisions) != 2) {
+		return failure.Usage("usage: merge-base [-a | --all] <commit> <commit>...\n   or: merge-base --is-ancestor <commit> <commit>")
+	}
+	commits := make([]string, 0, len(revisions))
+	for _, revision := range revisions {
+		sha, err := resolveRevision(revision)
+		if err == nil {
+			sha, err = peelObject(sha, "commit")
+		}
+		if err != nil {
+			return failure.Fatalf("fatal: Not a valid object name %v", revision)
+		}
+		commits = append(commits, sha)
+	}
+
+	if isAncestorMode {
+		found, err := isAncestor(commits[0], commits[1])
+		if err != nil {
+			return err
+		}
+		if !found {
+			return errSilentFailure
+		}
+		return nil
+	}
+	bases, err := mergeBases(commits[0], commits[1:]...)
+	if err != nil {
+		return err
+	}
+	if len(bases) == 0 {
+		return errSilentFailure
+	}
+	if !all {
+		bases = bases[:1]
+	}
+	for _, base := range bases {
+		fmt.Fprintln(stdout, base)
+	}
+	return nil
+}
+
+// mergeBases finds the best common ancestors of one commit and any of the
+// others: the commits reachable from both that are not ancestors of another
+// such commit. In a criss-cross history there are several; they come newest
+// first by committer date.
+func mergeBases(one string, others ...string) ([]string, error) {
+	reachable := make(map[string]bool)
+	err := walkParents([]string{one}, func(sha string) bool {
+		reachable[sha] = true
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Walk back from the others, stopping at the first commits one reaches.
+	candidates := make([]*Commit, 0, 1)
+	seen := make(map[string]bool)
+	queue := make([]string, 0, len(others))
+	for _, other := range others {
+		if !seen[other] {
+			seen[other] = true
+			queue = append(queue, other)
+		}
+	}
+	for len(queue) > 0 {
+		commit, err := readCommit(queue[0])
+		if err != nil {
+			return nil, err
+		}
+		queue = queue[1:]
+		if reachable[commit.sha] {
+			candidates = append(candidates, commit)
+			continue
+		}
+		for _, parent := range commit.Parents {
+			if !seen[parent] {
+				seen[parent] = true
+				queue = append(queue, parent)
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return parseSignature(candidates[i].Committer).when.After(parseSignature(candidates[j].Committer).when)
+	})
+
+	bases := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		redundant := false
+		for _, other := range candidates {
+			if other == candidate || redundant {
+				continue
+			}
+			if redundant, err = isAncestor(candidate.sha, other.sha); err != nil {
+				return nil, err
+			}
+		}
+		if !redundant {
+			bases = append(bases, candidate.sha)
+		}
+	}
+	return bases, nil
+}
+
+// mergedBaseFiles is the tree to merge against: the one merge base, or the
+// merge of several, each merged in turn against their own merge bases the
+// same way. Conflicts in a virtual base are kept with their markers, as
+// git's recursive merge does, so they conflict again should both sides
+// have left them alone.
+func mergedBaseFiles(bases []string) (map[string]TreeFile, error) {
+	treeSHA, err := commitTreeSHA(bases[0])
+	if err != nil {
+		return nil, err
+	}
+	files, err := flattenTree(treeSHA)
+	if err != nil {
+		return nil, err
+	}
+	for index, next := range bases[1:] {
+		// The virtual commit so far has bases[:index+1] as its parents.
+		innerBases, err := mergeBases(next, bases[:index+1]...)
+		if err != nil {
+			return nil, err
+		}
+		innerFiles := map[string]TreeFile{}
+		if len(innerBases) > 0 {
+			if innerFiles, err = mergedBaseFiles(innerBases); err != nil {
+				return nil, err
+			}
+		}
+		nextTreeSHA, err := commitTreeSHA(next)
+		if err != nil {
+			return nil, err
+		}
+		nextFiles, err := flattenTree(nextTreeSHA)
+		if err != nil {
+			return nil, err
+		}
+		merged, err := mergeTrees(innerFiles, files, nextFiles, "Temporary merge branch 1", "Temporary merge branch 2", io.Discard, io.Discard)
+		if err != nil {
+			return nil, err
+		}
+		files = make(map[string]TreeFile, len(merged))
+		for path, result := range merged {
+			if result.present {
+				files[path] = result.file
+			}
+		}
+	}
+	return files, nil
+}
+
+// mergedPath is the outcome of merging one path: the version to leave in the
+// working tree, unless both sides agree it is gone, and for a conflict the
+// base, ours and theirs versions to record as index stages 1 to 3.
+type mergedPath struct {
+	file     TreeFile
+	present  bool
+	conflict bool
+	stages   [3]*TreeFile
+}
+
+// mergeTrees merges each path of three flattened trees. A path only one side
+// changed takes that side's version; when both changed a file its lines are
+// merged, and anything else both sides changed differently conflicts. A
+// file left where the other side has a directory conflicts too, and is
+// moved aside to <path>~<label> of the side it came from.
+func mergeTrees(base, ours, theirs map[string]TreeFile, oursLabel string, theirsLabel string, stdout io.Writer, stderr io.Writer) (map[string]mergedPath, error) {
+	paths := make([]string, 0, len(ours)+len(theirs))
+	for _, files := range []map[string]TreeFile{base, ours, theirs} {
+		for path := range files {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	paths = slices.Compact(paths)
+
+	same := func(a TreeFile, inA bool, b TreeFile, inB bool) bool {
+		return inA == inB && (!inA || sameTreeFile(a, b))
+	}
+	merged := make(map[string]mergedPath, len(paths))
+	for _, path := range paths {
+		baseFile, inBase := base[path]
+		oursFile, inOurs := ours[path]
+		theirsFile, inTheirs := theirs[path]
+		switch {
+		case same(oursFile, inOurs, theirsFile, inTheirs), same(baseFile, inBase, theirsFile, inTheirs):
+			merged[path] = mergedPath{file: oursFile, present: inOurs}
+			continue
+		case same(baseFile, inBase, oursFile, inOurs):
+			merged[path] = mergedPath{file: theirsFile, present: inTheirs}
+			continue
+		}
+
+		result := mergedPath{conflict: true}
+		for stage, version := range []struct {
+			file    TreeFile
+			present bool
+		}{{baseFile, inBase}, {oursFile, inOurs}, {theirsFile, inTheirs}} {
+			if version.present {
+				file := version.file
+				result.stages[stage] = &file
+			}
+		}
+		switch {
+		case !inOurs:
+			fmt.Fprintf(stdout, "CONFLICT (modify/delete): %v deleted in %v and modified in %v.  Version %v of %v left in tree.\n",
+				path, oursLabel, theirsLabel, theirsLabel, path)
+			result.file, result.present = theirsFile, true
+		case !inTheirs:
+			fmt.Fprintf(stdout, "CONFLICT (modify/delete): %v deleted in %v and modified in %v.  Version %v of %v left in tree.\n",
+				path, theirsLabel, oursLabel, oursLabel, path)
+			result.file, result.present = oursFile, true
+		default:
+			file, conflict, err := mergeFiles(path, baseFile, inBase, oursFile, theirsFile, oursLabel, theirsLabel, stdout, stderr)
+			if err != nil {
+				return nil, err
+			}
+			result.file, result.present, result.conflict = file, true, conflict
+		}
+		merged[path] = result
+	}
+
+	// paths is sorted, so a directory's files follow the file in its way.
+	for index, path := range paths {
+		result := merged[path]
+		if !result.present {
+			continue
+		}
+		inTheWay := false
+		for _, other := range paths[index+1:] {
+			if !strings.HasPrefix(other, path+"/") && other > path+"/" {
+				break
+			}
+			if strings.HasPrefix(other, path+"/") && merged[other].present {
+				inTheWay = true
+				break
+			}
+		}
+		if !inTheWay {
+			continue
+		}
+		label, stage := theirsLabel, 2
+		if oursFile, inOurs := ours[path]; inOurs && sameTreeFile(oursFile, result.file) {
+			label, stage = oursLabel, 1
+		}
+		moved := path + "~" + strings.ReplaceAll(label, "/", "_")
+		fmt.Fprintf(stdout, "CONFLICT (file/directory): directory in the way of %v from %v; moving it to %v instead.\n", path, label, moved)
+		if !result.conflict {
+			file := result.file
+			result.stages = [3]*TreeFile{}
+			result.stages[stage] = &file
+			result.conflict = true
+		}
+		merged[moved] = result
+		merged[path] = mergedPath{}
+	}
+	return merged, nil
+}
+
+// mergeFiles merges a path both sides changed, returning the version for the
+// working tree, with conflict markers if the line merge left any, and
+// whether it conflicted. Symlinks, submodules and binary files cannot be
+// merged by line, so ours is kept.
+func mergeFiles(path string, baseFile TreeFile, inBase bool, oursFile TreeFile, theirsFile TreeFile, oursLabel string, theirsLabel string, stdout io.Writer, stderr io.Writer) (TreeFile, bool, error) {
+	mergeable := func(mode string) bool { return mode == "100644" || mode == "100755" }
+	mode := oursFile.mode
+	if inBase && oursFile.mode == baseFile.mode {
+		mode = theirsFile.mode
+	}
+	if slices.Equal(oursFile.hash, theirsFile.hash) {
+		// Only the modes differ.
+		return TreeFile{mode: mode, hash: oursFile.hash}, false, nil
+	}
+	kind := "content"
+	if !inBase {
+		kind = "add/add"
+	}
+	fmt.Fprintf(stdout, "Auto-merging %v\n", path)
+	if !mergeable(oursFile.mode) || !mergeable(theirsFile.mode) {
+		fmt.Fprintf(stdout, "CONFLICT (%v): Merge conflict in %v\n", kind, path)
+		return oursFile, true, nil
+	}
+
+	contents := make([][]byte, 3)
+	for index, file := range []TreeFile{baseFile, oursFile, theirsFile} {
+		if index == 0 && !inBase {
+			continue
+		}
+		blob, err := repository.ReadBlob(hex.EncodeToString(file.hash))
+		if err != nil {
+			return TreeFile{}, false, err
+		}
+		contents[index] = blob.Data
+	}
+	if diff.IsBinary(contents[0]) || diff.IsBinary(contents[1]) || diff.IsBinary(contents[2]) {
+		fmt.Fprintf(stderr, "warning: Cannot merge binary files: %v (%v vs. %v)\n", path, oursLabel, theirsLabel)
+		fmt.Fprintf(stdout, "CONFLICT (%v): Merge conflict in %v\n", kind, path)
+		return TreeFile{mode: mode, hash: oursFile.hash}, true, nil
+	}
+	content, conflicts := diff.Merge(diff.SplitLines(contents[0]), diff.SplitLines(contents[1]), diff.SplitLines(contents[2]), oursLabel, theirsLabel)
+	hash, err := repository.WriteObject("blob", content)
+	if err != nil {
+		return TreeFile{}, false, err
+	}
+	if conflicts > 0 {
+		fmt.Fprintf(stdout, "CONFLICT (%v): Merge conflict in %v\n", kind, path)
+	}
+	return TreeFile{mode: mode, hash: hash}, conflicts > 0, nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMergeConflictOutput(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	commitFile(t, dir, "f", "1\n2\n3\n", "base")
+	mygit(t, dir, "branch", "side")
+	mygit(t, dir, "checkout", "side")
+	commitFile(t, dir, "f", "1\nside\n3\n", "side")
+	mygit(t, dir, "checkout", "main")
+	commitFile(t, dir, "f", "1\nmain\n3\n", "main")
+
+	stdout, _, code := runIn(t, dir, "", "merge", "side")
+	want := "Auto-merging f\nCONFLICT (content): Merge conflict in f\nAutomatic merge failed; fix conflicts and then commit the result.\n"
+	if code != 1 || stdout != want {
+		t.Errorf("merge side: exit %v\n%v\nwant:\n%v", code, stdout, want)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "f"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "1\n<<<<<<< HEAD\nmain\n=======\nside\n>>>>>>> side\n3\n"; string(content) != want {
+		t.Errorf("f after the conflict:\n%v\nwant:\n%v", string(content), want)
+	}
+	if got := mygit(t, dir, "status", "--short"); got != "UU f\n" {
+		t.Errorf("status --short = %q", got)
+	}
+	mygit(t, dir, "merge", "--abort")
+	if got := mygit(t, dir, "status", "--short"); got != "" {
+		t.Errorf("status --short after --abort = %q", got)
+	}
+}
+
+func TestMergeCrissCrossMergesBases(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	commitFile(t, dir, "g", "x\n", "base")
+	mygit(t, dir, "branch", "side")
+	a := commitFile(t, dir, "g", "a\n", "a")
+	mygit(t, dir, "checkout", "side")
+	// The later of the two merge bases is the one a single-base merge
+	// would pick.
+	t.Setenv("GIT_COMMITTER_DATE", "1700000100 +0000")
+	commitFile(t, dir, "h", "h\n", "b")
+	mygit(t, dir, "merge", "-m", "take a", a)
+	commitFile(t, dir, "g", "x\n", "back to x")
+	mygit(t, dir, "checkout", "main")
+	mygit(t, dir, "merge", "-m", "take b", "side~2")
+
+	// The virtual base has g as a, which side turned back into x.
+	if got := mygit(t, dir, "merge-base", "--all", "main", "side"); len(strings.Fields(got)) != 2 {
+		t.Fatalf("merge-base --all = %q, want two bases", got)
+	}
+	mygit(t, dir, "merge", "-m", "criss-cross", "side")
+	if got := mygit(t, dir, "cat-file", "-p", "HEAD:g"); got != "x\n" {
+		t.Errorf("g after the criss-cross merge = %q, want x", got)
+	}
+}
+
+func TestMergeFileDirectoryConflict(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	commitFile(t, dir, "x", "x\n", "base")
+	mygit(t, dir, "branch", "side")
+	mygit(t, dir, "checkout", "side")
+	commitFile(t, dir, "a/b", "b\n", "directory")
+	mygit(t, dir, "checkout", "main")
+	commitFile(t, dir, "a", "file\n", "file")
+
+	stdout, _, code := runIn(t, dir, "", "merge", "side")
+	if code != 1 || !strings.HasPrefix(stdout, "CONFLICT (file/directory): directory in the way of a from HEAD; moving it to a~HEAD instead.\n") {
+		t.Errorf("merge side: exit %v\n%v", code, stdout)
+	}
+	for name, want := range map[string]string{"a/b": "b\n", "a~HEAD": "file\n"} {
+		if content, err := os.ReadFile(filepath.Join(dir, name)); err != nil || string(content) != want {
+			t.Errorf("%v = %q, %v; want %q", name, content, err, want)
+		}
+	}
+	if got, want := mygit(t, dir, "status", "--short"), "D  a\nA  a/b\nAU a~HEAD\n"; got != want {
+		t.Errorf("status --short:\n%v\nwant:\n%v", got, want)
+	}
+
+	mygit(t, dir, "merge", "--abort")
+	if content, err := os.ReadFile(filepath.Join(dir, "a")); err != nil || string(content) != "file\n" {
+		t.Errorf("a after --abort = %q, %v", content, err)
+	}
+	if got := mygit(t, dir, "status", "--short"); got != "" {
+		t.Errorf("status --short after --abort = %q", got)
+	}
+	// Checking out the other side swaps the file for the directory.
+	mygit(t, dir, "checkout", "side")
+	mygit(t, dir, "checkout", "main")
+	if got := mygit(t, dir, "status", "--short"); got != "" {
+		t.Errorf("status --short after switching back = %q", got)
+	}
+}
+
+func TestMergeBaseMatchesGit(t *testing.T) {
+	requireGit(t)
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	tree := strings.TrimSpace(mygit(t, dir, "write-tree"))
+	date := 1700000000
+	commit := func(message string, parents ...string) string {
+		t.Helper()
+		date += 100
+		t.Setenv("GIT_COMMITTER_DATE", strconv.Itoa(date)+" +0000")
+		args := []string{"commit-tree", tree, "-m", message}
+		for _, parent := range parents {
+			args = append(args, "-p", parent)
+		}
+		return strings.TrimSpace(mygit(t, dir, args...))
+	}
+
+	// A criss-cross: each side merges the other's first commit, so both
+	// are best common ancestors of the tips.
+	root := commit("root")
+	a := commit("a", root)
+	b := commit("b", root)
+	left := commit("left", commit("merge b", a, b))
+	right := commit("right", commit("merge a", b, a))
+	third := commit("third", a)
+	unrelated := commit("unrelated")
+
+	for _, args := range [][]string{
+		{left, right},
+		{"--all", left, right},
+		{"-a", right, left},
+		{left, right, third},
+		{"--all", left, right, third},
+		{a, left},
+		{root, b},
+	} {
+		args = append([]string{"merge-base"}, args...)
+		if got, want := mygit(t, dir, args...), runGit(t, dir, args...); got != want {
+			t.Errorf("mygit %v:\n%v\ngit:\n%v", strings.Join(args, " "), got, want)
+		}
+	}
+	for _, test := range []struct {
+		args []string
+		code int
+	}{
+		{[]string{"merge-base", left, unrelated}, 1},
+		{[]string{"merge-base", "--is-ancestor", root, left}, 0},
+		{[]string{"merge-base", "--is-ancestor", left, root}, 1},
+		{[]string{"merge-base", "--is-ancestor", left, left}, 0},
+		{[]string{"merge-base", left}, 129},
+		{[]string{"merge-base", left, "nope"}, 128},
+	} {
+		if stdout, _, code := runIn(t, dir, "", test.args...); code != test.code || stdout != "" {
+			t.Errorf("%v: exit %v, want %v\n%v", strings.Join(test.args, " "), code, test.code, stdout)
+		}
+	}
+}
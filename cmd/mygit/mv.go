@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+)
+
+// move is one rename mv makes, from a tracked file or directory.
+type move struct {
+	source      string
+	destination string
+}
+
+// mv renames tracked files and directories, on disk and in the index. Given
+// several sources, or a destination that is a directory, each source moves
+// into it. Every move is checked before any is made, and when one fails
+// those already made are undone, so the worktree and the index never
+// disagree. -f lets a file overwrite another, -k skips the moves that would
+// fail instead of refusing them all.
+func mv(args []string, stdout io.Writer) error {
+	force, skipErrors, dryRun, verbose := false, false, false, false
+	paths := make([]string, 0, len(args))
+	for index := 0; index < len(args); index++ {
+		switch arg := args[index]; {
+		case arg == "--":
+			paths = append(paths, args[index+1:]...)
+			index = len(args)
+		case arg == "-f" || arg == "--force":
+			force = true
+		case arg == "-k":
+			skipErrors = true
+		case arg == "-n" || arg == "--dry-run":
+			dryRun, verbose = true, true
+		case arg == "-v" || arg == "--verbose":
+			verbose = true
+		case strings.HasPrefix(arg, "-"):
+			return failure.Usage("usage: git mv [<options>] <source>... <destination>")
+		default:
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) < 2 {
+		return failure.Usage("usage: git mv [<options>] <source>... <destination>")
+	}
+	for index, arg := range paths {
+		worktreeArg, err := worktreePath(arg)
+		if err != nil {
+			return err
+		}
+		paths[index] = worktreeArg
+	}
+	sources, target := paths[:len(paths)-1], paths[len(paths)-1]
+	targetInfo, err := os.Lstat(target)
+	intoDirectory := err == nil && targetInfo.IsDir()
+	if len(sources) > 1 && !intoDirectory {
+		return failure.Fatalf("fatal: destination '%v' is not a directory", target)
+	}
+
+	entries, err := readIndex()
+	if err != nil {
+		return err
+	}
+	indexed := make(map[string]IndexEntry, len(entries))
+	for _, entry := range entries {
+		indexed[entry.path] = entry
+	}
+	tracked := func(dir string) bool {
+		for _, entry := range entries {
+			if dir == "." || strings.HasPrefix(entry.path, dir+"/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	moves := make([]move, 0, len(sources))
+	targets := make(map[string]string)
+	for _, source := range sources {
+		destination := target
+		if intoDirectory {
+			destination = path.Join(target, path.Base(source))
+		}
+		if dryRun {
+			fmt.Fprintf(stdout, "Checking rename of '%v' to '%v'\n", source, destination)
+		}
+		info, err := os.Lstat(source)
+		problem := ""
+		switch {
+		case err != nil:
+			problem = "bad source"
+		case source == destination || strings.HasPrefix(destination, source+"/"):
+			problem = "can not move directory into itself"
+		case info.IsDir() && !tracked(source):
+			problem = "source directory is empty"
+		case !info.IsDir() && indexed[source].hash == nil:
+			problem = "not under version control"
+		case !info.IsDir() && indexed[source].stage() != 0:
+			problem = "conflicted"
+		case targets[destination] != "":
+			problem = "multiple sources for the same target"
+		}
+		if destinationInfo, err := os.Lstat(destination); problem == "" && (err == nil || indexed[destination].hash != nil) {
+			switch {
+			case !force:
+				problem = "destination exists"
+			case info.IsDir() || (err == nil && destinationInfo.IsDir()):
+				problem = "Cannot overwrite"
+			case verbose:
+				fmt.Fprintf(stdout, "warning: overwriting '%v'\n", destination)
+			}
+		}
+		if problem != "" {
+			if skipErrors {
+				continue
+			}
+			return failure.Fatalf("fatal: %v, source=%v, destination=%v", problem, source, destination)
+		}
+		targets[destination] = source
+		moves = append(moves, move{source: source, destination: destination})
+	}
+
+	for _, move := range moves {
+		if verbose {
+			fmt.Fprintf(stdout, "Renaming %v to %v\n", move.source, move.destination)
+		}
+	}
+	if dryRun || len(moves) == 0 {
+		return nil
+	}
+	undo := func(made []move) {
+		for index := len(made) - 1; index >= 0; index-- {
+			os.Rename(made[index].destination, made[index].source)
+		}
+	}
+	for index, move := range moves {
+		if err := os.Rename(move.source, move.destination); err != nil {
+			undo(moves[:index])
+			return failure.Fatalf("fatal: renaming '%v' failed: %w", move.source, errors.Unwrap(err))
+		}
+	}
+
+	renamed := make([]IndexEntry, 0, len(entries))
+	for _, entry := range entries {
+		if targets[entry.path] != "" {
+			// Overwritten by a file moved onto it.
+			continue
+		}
+		for _, move := range moves {
+			if entry.path == move.source || strings.HasPrefix(entry.path, move.source+"/") {
+				entry.path = move.destination + strings.TrimPrefix(entry.path, move.source)
+				break
+			}
+		}
+		renamed = append(renamed, entry)
+	}
+	if err := writeIndex(renamed); err != nil {
+		undo(moves)
+		return err
+	}
+	return nil
+}
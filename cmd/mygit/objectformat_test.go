@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSHA256RepositoriesMatchGit(t *testing.T) {
+	requireGit(t)
+	base := setupTest(t)
+	ours, theirs := filepath.Join(base, "ours"), filepath.Join(base, "theirs")
+	mygit(t, base, "init", "--object-format=sha256", ours)
+	runGit(t, base, "init", "-q", "-b", "main", "--object-format=sha256", theirs)
+	for _, dir := range []string{ours, theirs} {
+		writeFile(t, dir, "a", "a\n")
+		writeFile(t, dir, "d/b", "b\n")
+		runGit(t, dir, "add", ".")
+	}
+	mygit(t, ours, "commit", "-m", "one")
+	runGit(t, theirs, "commit", "-q", "-m", "one")
+
+	// The same content hashes to the same 64-digit names.
+	head := strings.TrimSpace(mygit(t, ours, "rev-parse", "HEAD"))
+	if want := strings.TrimSpace(runGit(t, theirs, "rev-parse", "HEAD")); head != want || len(head) != 64 {
+		t.Errorf("HEAD = %v, git made %v", head, want)
+	}
+	if got := runGit(t, ours, "rev-parse", "--show-object-format"); got != "sha256\n" {
+		t.Errorf("git sees the object format as %q", got)
+	}
+	for _, args := range [][]string{
+		{"cat-file", "-p", "HEAD"},
+		{"ls-tree", "-r", "HEAD"},
+		{"log", "--oneline"},
+		{"rev-parse", "HEAD:d/b", "HEAD^{tree}"},
+	} {
+		if got, want := mygit(t, theirs, args...), runGit(t, theirs, args...); got != want {
+			t.Errorf("mygit %v in git's repository:\n%v\ngit:\n%v", strings.Join(args, " "), got, want)
+		}
+	}
+
+	// Packs and clones keep the format.
+	mygit(t, ours, "tag", "-a", "-m", "tag", "v1")
+	mygit(t, ours, "gc")
+	if got := runGit(t, ours, "fsck", "--strict"); got != "" {
+		t.Errorf("git fsck after gc:\n%v", got)
+	}
+	packs, err := filepath.Glob(filepath.Join(ours, ".git", "objects", "pack", "*.idx"))
+	if err != nil || len(packs) != 1 {
+		t.Fatalf("gc made packs %v, %v", packs, err)
+	}
+	runGit(t, ours, "verify-pack", packs[0])
+	mygit(t, base, "clone", ours, "clone")
+	clone := filepath.Join(base, "clone")
+	if got := runGit(t, clone, "rev-parse", "--show-object-format", "HEAD"); got != "sha256\n"+head+"\n" {
+		t.Errorf("the clone has format and HEAD:\n%v", got)
+	}
+	if got, err := os.ReadFile(filepath.Join(clone, "d", "b")); err != nil || string(got) != "b\n" {
+		t.Errorf("d/b in the clone = %q, %v", got, err)
+	}
+	if _, stderr, code := runIn(t, base, "", "init", "--object-format=md5", "bad"); code != 128 || !strings.Contains(stderr, "unknown hash algorithm 'md5'") {
+		t.Errorf("init with an unknown format: exit %v\n%v", code, stderr)
+	}
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/internal/atomicfile"
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+	"github.com/codecrafters-io/git-starter-go/internal/pack"
+)
+
+// packObjects writes the objects named on stdin to a pack, either as
+// <base-name>-<sha>.pack and .idx, printing the sha, or to stdout. With
+// --revs the input lists revisions instead, "^" marking ones to exclude, and
+// everything reachable from them is packed; --all adds every ref.
+func packObjects(args []string, stdin io.Reader, stdout io.Writer) error {
+	toStdout, revs, all := false, false, false
+	baseName := ""
+	for _, arg := range args {
+		switch arg {
+		case "--stdout":
+			toStdout = true
+		case "--revs":
+			revs = true
+		case "--all":
+			revs, all = true, true
+		case "-q", "--quiet":
+		default:
+			if strings.HasPrefix(arg, "-") || baseName != "" {
+				return failure.Usage("usage: git pack-objects [<options>] [< <ref-list> | < <object-list>]")
+			}
+			baseName = arg
+		}
+	}
+	if toStdout == (baseName != "") {
+		return failure.Usage("usage: git pack-objects [<options>] [< <ref-list> | < <object-list>]")
+	}
+
+	include, exclude := make([]string, 0), make([]string, 0)
+	if all {
+		tips, err := localTips()
+		if err != nil {
+			return err
+		}
+		include = append(include, tips...)
+	}
+	scanner := bufio.NewScanner(stdin)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		if !revs {
+			// "<sha> <path>" lines from rev-list --objects name each object.
+			sha, _, _ := strings.Cut(line, " ")
+			if _, err := hex.DecodeString(sha); err != nil || len(sha) != len(zeroSHA()) {
+				return failure.Fatalf("fatal: expected object ID, got garbage:\n %v", line)
+			}
+			include = append(include, sha)
+			continue
+		}
+		revision, excluded := strings.CutPrefix(line, "^")
+		sha, err := resolveRevision(revision)
+		if err != nil {
+			return failure.Fatalf("fatal: bad revision '%v'", line)
+		}
+		if excluded {
+			exclude = append(exclude, sha)
+		} else {
+			include = append(include, sha)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	shas := include
+	if revs {
+		defer storedObjects()()
+		seen := make(map[string]bool)
+		if err := walkObjects(exclude, seen, nil); err != nil {
+			return err
+		}
+		shas = make([]string, 0)
+		err := walkObjects(include, seen, func(sha string, objectType string, content []byte) {
+			shas = append(shas, sha)
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		shas = uniqueNames(shas)
+	}
+
+	if toStdout {
+		_, _, err := writePack(stdout, shas)
+		return err
+	}
+	name, err := writePackFiles(cwdPath(baseName), shas)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, name)
+	return nil
+}
+
+// gc packs the loose refs, expires old reflog entries and repacks what is
+// still reachable into a single new pack, removing the packs and loose
+// objects it replaced. Reachability is worked out once, from the refs,
+// and serves the reflog expiry; walking on from the reflog entries that
+// are kept and the index then gives the objects to pack. An unreachable
+// object survives as it is until it is older than --prune, two weeks by
+// default, or gc.pruneExpire.
+func gc(args []string) error {
+	now := time.Now()
+	cfg, err := repository.Config()
+	if err != nil {
+		return err
+	}
+	expiry := func(name string, fallback string) (time.Time, error) {
+		value, ok := cfg.Get(name)
+		if !ok {
+			value = fallback
+		}
+		return parseExpiry(value, now)
+	}
+	pruneBefore, err := expiry("gc.pruneExpire", "2.weeks.ago")
+	if err != nil {
+		return err
+	}
+	for _, arg := range args {
+		switch value, isPrune := strings.CutPrefix(arg, "--prune="); {
+		case arg == "-q" || arg == "--quiet":
+		case arg == "--prune":
+		case arg == "--no-prune":
+			pruneBefore = time.Time{}
+		case isPrune:
+			if pruneBefore, err = parseExpiry(value, now); err != nil {
+				return err
+			}
+		default:
+			return failure.Usagef("error: unknown option `%v'", strings.TrimLeft(arg, "-"))
+		}
+	}
+	reflogBefore, err := expiry("gc.reflogExpire", "90.days.ago")
+	if err != nil {
+		return err
+	}
+	unreachableBefore, err := expiry("gc.reflogExpireUnreachable", "30.days.ago")
+	if err != nil {
+		return err
+	}
+
+	if err := repository.Refs.PackAll(); err != nil {
+		return err
+	}
+
+	defer storedObjects()()
+	refs, err := repository.Refs.List("refs/")
+	if err != nil {
+		return err
+	}
+	roots := make([]string, 0, len(refs)+1)
+	for _, ref := range refs {
+		roots = append(roots, ref.SHA)
+	}
+	if headSHA, err := resolveHead(); err != nil {
+		return err
+	} else if headSHA != "" {
+		roots = append(roots, headSHA)
+	}
+	reachable := make(map[string]bool)
+	if err := walkObjects(roots, reachable, nil); err != nil {
+		return err
+	}
+
+	// Entries go once they are older than gc.reflogExpire, or than
+	// gc.reflogExpireUnreachable when no ref reaches them any more.
+	roots = roots[:0]
+	logs, err := repository.Refs.ListLogs()
+	if err != nil {
+		return err
+	}
+	for _, name := range logs {
+		entries, err := repository.Refs.ReadLog(name)
+		if err != nil {
+			return err
+		}
+		kept := entries[:0:0]
+		for _, entry := range entries {
+			when := parseSignature(entry.Identity).when
+			if when.Before(reflogBefore) || !reachable[entry.New] && when.Before(unreachableBefore) {
+				continue
+			}
+			kept = append(kept, entry)
+			for _, sha := range []string{entry.Old, entry.New} {
+				if sha != zeroSHA() && repository.HasObject(sha) {
+					roots = append(roots, sha)
+				}
+			}
+		}
+		if len(kept) < len(entries) {
+			if err := repository.Refs.WriteLog(name, kept); err != nil {
+				return err
+			}
+		}
+	}
+	if repository.WorkTree != "" {
+		entries, err := readIndex()
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.mode != 0160000 {
+				roots = append(roots, hex.EncodeToString(entry.hash))
+			}
+		}
+	}
+	if err := walkObjects(roots, reachable, nil); err != nil {
+		return err
+	}
+
+	loose, err := repository.LooseObjects()
+	if err != nil {
+		return err
+	}
+	oldPacks, _ := filepath.Glob(repository.Path("objects/pack/*.pack"))
+	keep := make([]string, 0, len(reachable))
+	for sha := range reachable {
+		keep = append(keep, sha)
+	}
+	// Unreachable objects in a pack still recent enough to keep go into the
+	// new pack, since they cannot be left where they are.
+	for _, oldPack := range oldPacks {
+		if info, err := os.Stat(oldPack); err != nil || !info.ModTime().After(pruneBefore) {
+			continue
+		}
+		index, err := pack.ReadIndex(repository.Algorithm, strings.TrimSuffix(oldPack, ".pack")+".idx")
+		if err != nil {
+			return err
+		}
+		for _, sha := range index.SHAs() {
+			if !reachable[sha] {
+				keep = append(keep, sha)
+			}
+		}
+	}
+	sort.Strings(keep)
+	keep = slices.Compact(keep)
+
+	// A pack identical to the new one is left in place.
+	newPack := ""
+	if len(keep) > 0 {
+		name, err := writePackFiles(repository.Path("objects/pack/pack"), keep)
+		if err != nil {
+			return err
+		}
+		newPack = repository.Path("objects/pack/pack-" + name + ".pack")
+	}
+	repository.ClosePacks()
+	for _, oldPack := range oldPacks {
+		if oldPack == newPack {
+			continue
+		}
+		base := strings.TrimSuffix(oldPack, ".pack")
+		for _, path := range []string{oldPack, base + ".idx", base + ".rev", base + ".bitmap"} {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("Failed to remove %v: %w", path, err)
+			}
+		}
+	}
+	// Loose objects that are now packed go, and so do unreachable ones
+	// past the prune date.
+	packed := make(map[string]bool, len(keep))
+	if newPack != "" {
+		for _, sha := range keep {
+			packed[sha] = true
+		}
+	}
+	for _, sha := range loose {
+		objectPath := repository.Path("objects", sha[:2], sha[2:])
+		if !packed[sha] {
+			if info, err := os.Stat(objectPath); err != nil || info.ModTime().After(pruneBefore) {
+				continue
+			}
+		}
+		if err := os.Remove(objectPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("Failed to remove %v: %w", objectPath, err)
+		}
+		os.Remove(filepath.Dir(objectPath))
+	}
+	return nil
+}
+
+// parseExpiry reads an expiry date as gc's options and config give it:
+// "now", "never", "<n>.<unit>.ago" or an absolute date. Never is the zero
+// time, before which nothing is.
+func parseExpiry(value string, now time.Time) (time.Time, error) {
+	switch value {
+	case "now", "all":
+		return now, nil
+	case "never", "false":
+		return time.Time{}, nil
+	}
+	fields := strings.FieldsFunc(value, func(r rune) bool { return r == '.' || r == ' ' })
+	if len(fields) == 3 && fields[2] == "ago" {
+		count, err := strconv.Atoi(fields[0])
+		unit := strings.TrimSuffix(fields[1], "s")
+		durations := map[string]time.Duration{"second": time.Second, "minute": time.Minute, "hour": time.Hour, "day": 24 * time.Hour, "week": 7 * 24 * time.Hour}
+		switch {
+		case err != nil:
+		case unit == "month":
+			return now.AddDate(0, -count, 0), nil
+		case unit == "year":
+			return now.AddDate(-count, 0, 0), nil
+		case durations[unit] != 0:
+			return now.Add(-time.Duration(count) * durations[unit]), nil
+		}
+	}
+	return parseIdentDate(value)
+}
+
+// writePackFiles packs the named objects into <basePath>-<sha>.pack with its
+// .idx alongside and returns the pack's sha.
+func writePackFiles(basePath string, shas []string) (string, error) {
+	dir := filepath.Dir(basePath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("Failed to create directory %v: %w", dir, err)
+	}
+	packFile, err := atomicfile.CreateTemp(dir, "tmp_pack_")
+	if err != nil {
+		return "", fmt.Errorf("Failed to create temporary file in %v: %w", dir, err)
+	}
+	defer packFile.Abort()
+	buffered := bufio.NewWriter(packFile)
+	entries, checksum, err := writePack(buffered, shas)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		return "", fmt.Errorf("Failed to write %v: %w", packFile.Name(), err)
+	}
+	return installPack(basePath, packFile, entries, checksum)
+}
+
+// installPack writes the index for the pack in packFile and commits both
+// to <basePath>-<sha>.pack and .idx, the index first so readers never see a
+// pack without one. It returns the pack's sha.
+func installPack(basePath string, packFile *atomicfile.File, entries []pack.IndexEntry, checksum []byte) (string, error) {
+	name := hex.EncodeToString(checksum)
+	packPath, indexPath := basePath+"-"+name+".pack", basePath+"-"+name+".idx"
+	if _, err := os.Stat(packPath); err == nil {
+		// An identical pack is already in place.
+		return name, nil
+	}
+	var index bytes.Buffer
+	if err := pack.WriteIndex(repository.Algorithm, &index, entries, checksum); err != nil {
+		return "", err
+	}
+	if err := replaceFile(indexPath, index.Bytes()); err != nil {
+		return "", err
+	}
+	if err := packFile.Commit(packPath, 0444); err != nil {
+		return "", fmt.Errorf("Failed to create file %v: %w", packPath, err)
+	}
+	return name, nil
+}
+
+// replaceFile writes a read-only file through a temporary file committed
+// over path, so it is replaced whole even when the old copy is read-only.
+func replaceFile(path string, content []byte) error {
+	temp, err := atomicfile.CreateTemp(filepath.Dir(path), "tmp_idx_")
+	if err != nil {
+		return fmt.Errorf("Failed to create temporary file in %v: %w", filepath.Dir(path), err)
+	}
+	defer temp.Abort()
+	_, err = temp.Write(content)
+	if err == nil {
+		err = temp.Commit(path, 0444)
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to create file %v: %w", path, err)
+	}
+	return nil
+}
+
+// writePack streams the named objects, read as stored, into a pack on w.
+func writePack(w io.Writer, shas []string) ([]pack.IndexEntry, []byte, error) {
+	defer storedObjects()()
+	writer, err := pack.NewWriter(repository.Algorithm, w, len(shas))
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, sha := range shas {
+		objectType, content, err := repository.ReadObject(sha)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := writer.Add(&pack.Object{Type: objectType, Content: content}); err != nil {
+			return nil, nil, err
+		}
+	}
+	checksum, err := writer.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	return writer.Entries(), checksum, nil
+}
+
+// storedObjects turns off refs/replace substitution until the returned
+// function is called, so objects leaving the repository are copied as
+// stored rather than as the local view shows them.
+func storedObjects() func() {
+	replaceObjects := repository.ReplaceObjects
+	repository.ReplaceObjects = false
+	return func() { repository.ReplaceObjects = replaceObjects }
+}
+
+func uniqueNames(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	unique := make([]string, 0, len(names))
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			unique = append(unique, name)
+		}
+	}
+	return unique
+}
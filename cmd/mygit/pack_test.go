@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/internal/pack"
+)
+
+func TestGCPacksRefsExpiresReflogsAndPrunes(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	// setupTest's date is long past, so these reflog entries have expired.
+	commitFile(t, dir, "a", "a\n", "old")
+	t.Setenv("GIT_COMMITTER_DATE", fmt.Sprintf("%v +0000", time.Now().Unix()))
+	head := commitFile(t, dir, "a", "b\n", "new")
+	mygit(t, dir, "tag", "v1")
+	dangling := strings.TrimSpace(mygitInput(t, dir, "dangling\n", "hash-object", "-w", "--stdin"))
+
+	// An earlier pack, with the files git keeps alongside one.
+	mygit(t, dir, "gc")
+	oldPacks, _ := filepath.Glob(filepath.Join(dir, ".git/objects/pack/*.pack"))
+	if len(oldPacks) != 1 {
+		t.Fatalf("packs after the first gc: %v", oldPacks)
+	}
+	oldBase := strings.TrimSuffix(oldPacks[0], ".pack")
+	for _, suffix := range []string{".rev", ".bitmap"} {
+		writeFile(t, dir, strings.TrimPrefix(oldBase, dir+"/")+suffix, "")
+	}
+	commitFile(t, dir, "c", "c\n", "third")
+
+	mygit(t, dir, "gc")
+	if loose, _ := filepath.Glob(filepath.Join(dir, ".git/refs/*/*")); len(loose) != 0 {
+		t.Errorf("loose refs after gc: %v", loose)
+	}
+	packedRefs, err := os.ReadFile(filepath.Join(dir, ".git/packed-refs"))
+	if err != nil || !strings.Contains(string(packedRefs), head+" refs/tags/v1\n") {
+		t.Errorf("packed-refs = %q, %v", packedRefs, err)
+	}
+	if got := mygit(t, dir, "rev-parse", "v1"); got != head+"\n" {
+		t.Errorf("rev-parse v1 = %q, want %v", got, head)
+	}
+	reflog := mygit(t, dir, "reflog")
+	if strings.Contains(reflog, "old") || !strings.Contains(reflog, "third") || !strings.Contains(reflog, "new") {
+		t.Errorf("reflog after gc:\n%v", reflog)
+	}
+	for _, suffix := range []string{".pack", ".idx", ".rev", ".bitmap"} {
+		if _, err := os.Stat(oldBase + suffix); err == nil {
+			t.Errorf("%v of the old pack is still there", suffix)
+		}
+	}
+	// The unreachable blob is too recent to prune and stays loose.
+	looseObjects := func() []string {
+		paths, _ := filepath.Glob(filepath.Join(dir, ".git/objects/??/*"))
+		return paths
+	}
+	if loose := looseObjects(); len(loose) != 1 || !strings.HasSuffix(loose[0], dangling[2:]) {
+		t.Errorf("loose objects after gc: %v", loose)
+	}
+
+	mygit(t, dir, "gc", "--prune=now")
+	if _, _, code := runIn(t, dir, "", "cat-file", "-e", dangling); code == 0 {
+		t.Errorf("dangling blob %v survived gc --prune=now", dangling)
+	}
+	if loose := looseObjects(); len(loose) != 0 {
+		t.Errorf("loose objects after gc --prune=now: %v", loose)
+	}
+	if got := mygit(t, dir, "log", "--oneline"); len(strings.Split(strings.TrimSpace(got), "\n")) != 3 {
+		t.Errorf("log after gc:\n%v", got)
+	}
+	mygit(t, dir, "fsck")
+}
+
+func TestReadsDeltifiedGitPacks(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	var content strings.Builder
+	for line := 0; line < 200; line++ {
+		fmt.Fprintf(&content, "line %v of a file long enough to be worth a delta\n", line)
+	}
+	versions := make([]string, 0, 20)
+	for version := 0; version < 20; version++ {
+		// Each version edits the last, so git packs them as a chain of deltas.
+		text := strings.Replace(content.String(), fmt.Sprintf("line %v ", version*10), fmt.Sprintf("edit %v ", version), 1)
+		content.Reset()
+		content.WriteString(text)
+		commitFile(t, dir, "file.txt", text, fmt.Sprintf("version %v", version))
+		versions = append(versions, text)
+	}
+	command := exec.Command("git", "repack", "-adf", "--depth=50")
+	var stderr bytes.Buffer
+	command.Dir, command.Stderr = dir, &stderr
+	if err := command.Run(); err != nil {
+		t.Fatalf("git repack: %v\n%v", err, stderr.String())
+	}
+	verify, _ := filepath.Glob(filepath.Join(dir, ".git/objects/pack/*.idx"))
+	if len(verify) != 1 || !strings.Contains(mygit(t, dir, "verify-pack", "-v", verify[0]), "chain length") {
+		t.Fatalf("git repack left no deltified pack: %v", verify)
+	}
+
+	// Newest first, then again, so bases come from the cache the second time.
+	for round := 0; round < 2; round++ {
+		for version := range versions {
+			revision := fmt.Sprintf("HEAD~%v:file.txt", len(versions)-1-version)
+			if got := mygit(t, dir, "cat-file", "-p", revision); got != versions[version] {
+				t.Fatalf("cat-file -p %v differs from what was committed", revision)
+			}
+		}
+	}
+}
+
+func TestApplyDeltaRefusesOversizedResults(t *testing.T) {
+	base := []byte("base")
+	// A delta from the 4-byte base declaring a 2^62-byte result from one
+	// copy of the base.
+	delta := []byte{4, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x40, 0x90, 4}
+	if _, err := pack.ApplyDelta(base, delta); err == nil {
+		t.Error("a delta declaring a far larger result than it makes applied")
+	}
+	// One whose copies make more than it declares.
+	if _, err := pack.ApplyDelta(base, []byte{4, 4, 0x90, 4, 0x90, 4}); err == nil {
+		t.Error("a delta making more than its declared result applied")
+	}
+	if got, err := pack.ApplyDelta(base, []byte{4, 8, 0x90, 4, 0x90, 4}); err != nil || string(got) != "basebase" {
+		t.Errorf("a delta copying its base twice made %q, %v", got, err)
+	}
+}
+
+func TestPacksWrittenReadByGit(t *testing.T) {
+	requireGit(t)
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	for version := 0; version < 5; version++ {
+		commitFile(t, dir, fmt.Sprintf("dir/file%v", version%2), strings.Repeat(fmt.Sprintf("version %v\n", version), 100), fmt.Sprintf("commit %v", version))
+	}
+	objects := runGit(t, dir, "rev-list", "--objects", "--all")
+	mygit(t, dir, "gc")
+
+	packs, _ := filepath.Glob(filepath.Join(dir, ".git/objects/pack/*.pack"))
+	if len(packs) != 1 {
+		t.Fatalf("packs after gc: %v", packs)
+	}
+	// git checks the pack's checksums and the index's offsets and CRCs.
+	runGit(t, dir, "verify-pack", strings.TrimSuffix(packs[0], ".pack")+".idx")
+	runGit(t, dir, "fsck", "--full", "--strict")
+	if got := runGit(t, dir, "rev-list", "--objects", "--all"); got != objects {
+		t.Errorf("git lists other objects after gc:\n%v\nwant:\n%v", got, objects)
+	}
+
+	// pack-objects writes the objects it is given, and git indexes the
+	// pack the same way.
+	tree := strings.TrimSpace(mygit(t, dir, "rev-parse", "HEAD^{tree}"))
+	base := filepath.Join(t.TempDir(), "pack")
+	sha := strings.TrimSpace(mygitInput(t, dir, tree+"\n", "pack-objects", base))
+	ours, err := os.ReadFile(base + "-" + sha + ".idx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, dir, "index-pack", "-o", base+"-git.idx", base+"-"+sha+".pack")
+	theirs, err := os.ReadFile(base + "-git.idx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(ours) != string(theirs) {
+		t.Error("git index-pack makes a different index of the pack-objects pack")
+	}
+}
+
+func TestIndexPackAndVerifyPackMatchGit(t *testing.T) {
+	requireGit(t)
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	var content strings.Builder
+	for version := 0; version < 10; version++ {
+		fmt.Fprintf(&content, "line added in version %v\n", version)
+		commitFile(t, dir, "file", strings.Repeat(content.String(), 20), fmt.Sprintf("version %v", version))
+	}
+	runGit(t, dir, "repack", "-adf")
+	packs, _ := filepath.Glob(filepath.Join(dir, ".git/objects/pack/*.pack"))
+	if len(packs) != 1 {
+		t.Fatalf("packs after git repack: %v", packs)
+	}
+	index := strings.TrimSuffix(packs[0], ".pack") + ".idx"
+	if got, want := mygit(t, dir, "verify-pack", "-v", index), runGit(t, dir, "verify-pack", "-v", index); got != want {
+		t.Errorf("mygit verify-pack -v:\n%v\ngit verify-pack -v:\n%v", got, want)
+	}
+
+	// index-pack rebuilds the index git wrote, byte for byte.
+	copied := filepath.Join(t.TempDir(), "copy.pack")
+	data, err := os.ReadFile(packs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(copied, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	mygit(t, dir, "index-pack", copied)
+	ours, err := os.ReadFile(strings.TrimSuffix(copied, ".pack") + ".idx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	theirs, err := os.ReadFile(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(ours) != string(theirs) {
+		t.Error("index-pack wrote a different index from git's")
+	}
+
+	// A flipped byte in the middle of the pack is caught.
+	data[len(data)/2] ^= 0xff
+	if err := os.WriteFile(copied, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, code := runIn(t, dir, "", "verify-pack", strings.TrimSuffix(copied, ".pack")+".idx"); code == 0 {
+		t.Error("verify-pack passed a corrupt pack")
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// pagedCommands are the commands whose output goes through a pager when
+// stdout is a terminal, as in git.
+var pagedCommands = map[string]bool{
+	"log": true, "show": true, "diff": true, "blame": true,
+}
+
+// pagerFor returns the pager the output of command should go through, or
+// "" for none. Output is only ever paged to a terminal: for the commands
+// git pages by default, for any command with --paginate, and as
+// pager.<command> says, which is either a boolean or the pager to use. The
+// pager is $GIT_PAGER, core.pager or $PAGER, whichever is set first, or
+// less; "cat" and "" mean no pager at all.
+func pagerFor(command string, paginate bool, stdout io.Writer) string {
+	if !isTerminal(stdout) {
+		return ""
+	}
+	cfg, err := repository.Config()
+	if err != nil {
+		return ""
+	}
+	paginate = paginate || pagedCommands[command]
+	pager, ok := os.LookupEnv("GIT_PAGER")
+	if !ok {
+		if pager, ok = cfg.Get("core.pager"); !ok {
+			if pager, ok = os.LookupEnv("PAGER"); !ok {
+				pager = "less"
+			}
+		}
+	}
+	if value, ok := cfg.Get("pager." + command); ok {
+		switch strings.ToLower(value) {
+		case "true", "yes", "on", "1":
+			paginate = true
+		case "false", "no", "off", "0":
+			paginate = false
+		default:
+			paginate, pager = true, value
+		}
+	}
+	if !paginate || pager == "cat" {
+		return ""
+	}
+	return pager
+}
+
+// startPager runs pager through the shell with output going to stdout and
+// returns the writer that feeds it. The returned function closes that
+// writer and waits for the pager to finish, which it must before the
+// command exits. less is given git's LESS=FRX, and lv its -c, unless the
+// environment already sets them.
+func startPager(pager string, stdout io.Writer, stderr io.Writer) (io.Writer, func(), error) {
+	command := exec.Command("sh", "-c", pager)
+	command.Stdout, command.Stderr = stdout, stderr
+	command.Env = os.Environ()
+	for variable, value := range map[string]string{"LESS": "FRX", "LV": "-c"} {
+		if _, ok := os.LookupEnv(variable); !ok {
+			command.Env = append(command.Env, variable+"="+value)
+		}
+	}
+	input, err := command.StdinPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := command.Start(); err != nil {
+		return nil, nil, err
+	}
+	return input, func() {
+		input.Close()
+		command.Wait()
+	}, nil
+}
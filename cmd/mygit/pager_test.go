@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+// openTerminal opens a pseudo-terminal and returns its secondary side, for
+// output that should look like it goes to a terminal.
+func openTerminal(t *testing.T) *os.File {
+	t.Helper()
+	primary, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		t.Skip("no pseudo-terminals:", err)
+	}
+	t.Cleanup(func() { primary.Close() })
+	unlock, number := int32(0), uint32(0)
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, primary.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); errno != 0 {
+		t.Skip("no pseudo-terminals:", errno)
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, primary.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&number))); errno != 0 {
+		t.Skip("no pseudo-terminals:", errno)
+	}
+	secondary, err := os.OpenFile("/dev/pts/"+strconv.Itoa(int(number)), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skip("no pseudo-terminals:", err)
+	}
+	t.Cleanup(func() { secondary.Close() })
+	return secondary
+}
+
+func TestPagerOnTerminal(t *testing.T) {
+	dir := setupTest(t)
+	for _, name := range []string{"GIT_PAGER", "PAGER"} {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+	mygit(t, dir, "init")
+	captured := filepath.Join(t.TempDir(), "paged")
+	writeFile(t, dir, ".git/config", "[core]\n\tpager = \"cat > '"+captured+"'\"\n")
+	commitFile(t, dir, "a.txt", "one\n", "first")
+	terminal := openTerminal(t)
+
+	page := func(args ...string) string {
+		t.Helper()
+		os.Remove(captured)
+		if err := os.Chdir(dir); err != nil {
+			t.Fatal(err)
+		}
+		if code := run(args, strings.NewReader(""), terminal, os.Stderr); code != 0 {
+			t.Fatalf("mygit %v: exit %v", strings.Join(args, " "), code)
+		}
+		data, _ := os.ReadFile(captured)
+		return string(data)
+	}
+	if paged := page("log", "--oneline"); !strings.HasSuffix(paged, " first\n") {
+		t.Errorf("log through core.pager: got %q", paged)
+	}
+	if paged := page("--no-pager", "log", "--oneline"); paged != "" {
+		t.Errorf("--no-pager still paged %q", paged)
+	}
+	if paged := page("rev-parse", "HEAD"); paged != "" {
+		t.Errorf("rev-parse paged %q", paged)
+	}
+	if paged := page("--paginate", "rev-parse", "HEAD"); !strings.HasPrefix(paged, mygit(t, dir, "rev-parse", "HEAD")) {
+		t.Errorf("--paginate rev-parse: got %q", paged)
+	}
+	t.Setenv("GIT_PAGER", "cat")
+	if paged := page("log", "--oneline"); paged != "" {
+		t.Errorf("GIT_PAGER=cat still used core.pager: %q", paged)
+	}
+
+	// Output that is not a terminal is never paged.
+	os.Unsetenv("GIT_PAGER")
+	os.Remove(captured)
+	mygit(t, dir, "--paginate", "log")
+	if _, err := os.Stat(captured); err == nil {
+		t.Error("output to a pipe went through the pager")
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// progress is a meter like git's, redrawn in place on a terminal:
+// "Receiving objects:  45% (9/20), 1.50 MiB | 1.02 MiB/s". It is redrawn
+// when its percentage moves or a second has gone by, and stop finishes the
+// line with ", done.". Every method of a nil meter does nothing, so callers
+// showing no progress need not check.
+type progress struct {
+	w       io.Writer
+	title   string
+	total   int
+	done    int
+	size    int64
+	start   time.Time
+	drawn   time.Time
+	percent int
+	// width is how long the line last drawn was, so a shorter one can wipe
+	// it out.
+	width int
+}
+
+// startProgress starts a meter titled title on w that counts to total, or
+// just counts when total is 0. With no w there is no meter.
+func startProgress(w io.Writer, title string, total int) *progress {
+	if w == nil {
+		return nil
+	}
+	now := time.Now()
+	return &progress{w: w, title: title, total: total, start: now, drawn: now, percent: -1}
+}
+
+// update records that done things, and size bytes, are through. Bytes
+// counted add the amount and rate to the meter once half a second has
+// gone by, and to the finished line in any case.
+func (meter *progress) update(done int, size int64) {
+	if meter == nil {
+		return
+	}
+	meter.done, meter.size = done, size
+	percent := -1
+	if meter.total > 0 {
+		percent = done * 100 / meter.total
+	}
+	if percent != meter.percent || time.Since(meter.drawn) >= time.Second {
+		meter.percent = percent
+		meter.draw(time.Since(meter.start) >= 500*time.Millisecond, "", '\r')
+	}
+}
+
+// stop draws the meter a last time, done.
+func (meter *progress) stop() {
+	if meter == nil {
+		return
+	}
+	meter.draw(true, ", done.", '\n')
+}
+
+func (meter *progress) draw(throughput bool, suffix string, end byte) {
+	line := fmt.Sprintf("%v: %v", meter.title, meter.done)
+	if meter.total > 0 {
+		line = fmt.Sprintf("%v: %3d%% (%v/%v)", meter.title, meter.done*100/meter.total, meter.done, meter.total)
+	}
+	if throughput && meter.size > 0 {
+		rate := float64(meter.size) / max(time.Since(meter.start).Seconds(), 0.001)
+		line += ", " + humanizeBytes(uint64(meter.size), "") + " | " + humanizeBytes(uint64(rate), "/s")
+	}
+	line += suffix
+	padding := strings.Repeat(" ", max(meter.width-len(line), 0))
+	fmt.Fprintf(meter.w, "%v%v%c", line, padding, end)
+	meter.width, meter.drawn = len(line), time.Now()
+}
+
+// humanizeBytes shows a number of bytes in GiB, MiB or KiB to
+// two places once it is more than one of them.
+func humanizeBytes(size uint64, suffix string) string {
+	switch {
+	case size > 1<<30:
+		return fmt.Sprintf("%d.%02d GiB%v", size>>30, (size&(1<<30-1))/10737419, suffix)
+	case size > 1<<20:
+		rounded := size + 5243
+		return fmt.Sprintf("%d.%02d MiB%v", rounded>>20, (rounded&(1<<20-1))*100>>20, suffix)
+	case size > 1<<10:
+		rounded := size + 5
+		return fmt.Sprintf("%d.%02d KiB%v", rounded>>10, (rounded&(1<<10-1))*100>>10, suffix)
+	}
+	return fmt.Sprintf("%d %v%v", size, plural(int(size), "byte"), suffix)
+}
+
+// progressOutput returns where a command's progress goes: to stderr when
+// that is a terminal or --progress asks for it anyway, and nowhere, nil,
+// when it is not or the command is to be quiet.
+func progressOutput(stderr io.Writer, quiet bool, forced bool) io.Writer {
+	if quiet || !forced && !isTerminal(stderr) {
+		return nil
+	}
+	return stderr
+}
+
+// isTerminal reports whether w is a terminal, as git's progress and
+// sideband messages ask of stderr.
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	// /dev/null is a character device too.
+	null, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(info, null)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCloneProgressAndQuiet(t *testing.T) {
+	requireGit(t)
+	base := setupTest(t)
+	source := filepath.Join(base, "source")
+	runGit(t, base, "init", "-q", "-b", "main", source)
+	commitFile(t, source, "a", "a\n", "one")
+	commitFile(t, source, "b", "b\n", "two")
+	fakeSSH(t, base)
+
+	// git's upload-pack reports on the progress band, and we on our own
+	// receiving, but only when asked to on a stderr that is no terminal.
+	_, stderr, code := runIn(t, base, "", "clone", "--progress", "host:"+source, "progress")
+	if code != 0 {
+		t.Fatalf("clone --progress: exit %v\n%v", code, stderr)
+	}
+	for _, want := range []string{"Cloning into 'progress'...\n", "remote: Enumerating objects: 6, done.", "remote: Total 6 ", "\rReceiving objects: 100% (6/6), ", ", done.\n"} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("clone --progress printed no %q:\n%q", want, stderr)
+		}
+	}
+	if _, stderr, _ := runIn(t, base, "", "clone", "host:"+source, "plain"); stderr != "Cloning into 'plain'...\n" {
+		t.Errorf("clone to a stderr that is no terminal printed:\n%q", stderr)
+	}
+	if _, stderr, code := runIn(t, base, "", "clone", "-q", "--progress", "host:"+source, "quiet"); code != 0 || stderr != "" {
+		t.Errorf("clone -q: exit %v\n%q", code, stderr)
+	}
+}
+
+func TestInterruptedCloneRemovesItsDirectory(t *testing.T) {
+	base := setupTest(t)
+	// An ssh that says nothing, leaving the clone waiting.
+	started := filepath.Join(base, "started")
+	writeFile(t, base, "ssh", "#!/bin/sh\necho $$ >"+started+".tmp && mv "+started+".tmp "+started+"\nexec sleep 60\n")
+	if err := os.Chmod(filepath.Join(base, "ssh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GIT_SSH", filepath.Join(base, "ssh"))
+	program, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clone := exec.Command(program, "clone", "host:repo.git", "clone")
+	clone.Dir = base
+	if err := clone.Start(); err != nil {
+		t.Fatal(err)
+	}
+	var pid []byte
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if pid, err = os.ReadFile(started); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			clone.Process.Kill()
+			t.Fatal("ssh was never run")
+		}
+	}
+	if err := clone.Process.Signal(os.Interrupt); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- clone.Wait() }()
+	select {
+	case err = <-done:
+	case <-time.After(10 * time.Second):
+		clone.Process.Kill()
+		t.Fatal("the interrupted clone kept waiting")
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 130 {
+		t.Errorf("the interrupted clone ended with %v, want exit 130", err)
+	}
+	if _, err := os.Stat(filepath.Join(base, "clone")); !os.IsNotExist(err) {
+		t.Errorf("the interrupted clone left its directory: %v", err)
+	}
+	sshPID, err := strconv.Atoi(strings.TrimSpace(string(pid)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ssh, err := os.FindProcess(sshPID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ssh.Signal(syscall.Signal(0)) == nil; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			ssh.Kill()
+			t.Errorf("ssh outlived the interrupted clone")
+			break
+		}
+	}
+}
@@ -0,0 +1,616 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+	"github.com/codecrafters-io/git-starter-go/internal/pack"
+	"github.com/codecrafters-io/git-starter-go/pkg/objects"
+)
+
+// advertisedRef is a ref a remote lists. symref is the ref it points at, as
+// advertised for HEAD, and peeled what an annotated tag points at.
+type advertisedRef struct {
+	name   string
+	sha    string
+	symref string
+	peeled string
+}
+
+// uploadPack is a connection to a remote's git-upload-pack service. It speaks
+// protocol v2 when the server offers it and the original protocol otherwise.
+type uploadPack struct {
+	connection   transport
+	version      int
+	refs         []advertisedRef
+	capabilities []string
+	// algorithm is the hash the remote names its objects with.
+	algorithm objects.Algorithm
+	// unbornHead is the branch an empty remote's HEAD points at, when the
+	// server says.
+	unbornHead string
+}
+
+// openUploadPack lists the remote's refs. Under protocol v2 only refs
+// starting with one of prefixes are requested, or all of them when there
+// are none; the original protocol always advertises everything.
+func openUploadPack(ctx context.Context, repoURL string, prefixes []string, stderr io.Writer) (*uploadPack, error) {
+	connection, lines, err := connect(ctx, repoURL, "git-upload-pack", "version=2", stderr)
+	if err != nil {
+		return nil, err
+	}
+	remote := &uploadPack{connection: connection, version: 0}
+	if len(lines) == 0 || string(lines[0]) != "version 2\n" {
+		if remote.refs, remote.capabilities, err = parseRefAdvertisement(lines); err != nil {
+			connection.close()
+			return nil, err
+		}
+		remote.algorithm, _ = advertisedObjectFormat(remote.capabilities)
+		remote.dropBrokenRefs()
+		return remote, nil
+	}
+
+	remote.version = 2
+	for _, line := range lines[1:] {
+		if line != nil {
+			remote.capabilities = append(remote.capabilities, strings.TrimSuffix(string(line), "\n"))
+		}
+	}
+	if remote.algorithm, err = advertisedObjectFormat(remote.capabilities); err != nil {
+		connection.close()
+		return nil, err
+	}
+	if err := remote.listRefs(prefixes); err != nil {
+		connection.close()
+		return nil, err
+	}
+	remote.dropBrokenRefs()
+	return remote, nil
+}
+
+// dropBrokenRefs forgets the advertised refs whose names no repository
+// could hold, such as refs/heads/../../x, along with symbolic ref targets
+// like them, so a remote cannot have a ref written anywhere but under refs/.
+func (remote *uploadPack) dropBrokenRefs() {
+	usable := func(name string) bool {
+		return strings.HasPrefix(name, "refs/") && validRefName(name)
+	}
+	remote.refs = slices.DeleteFunc(remote.refs, func(ref advertisedRef) bool {
+		return ref.name != "HEAD" && !usable(ref.name)
+	})
+	for index := range remote.refs {
+		if ref := &remote.refs[index]; ref.symref != "" && !usable(ref.symref) {
+			ref.symref = ""
+		}
+	}
+	if remote.unbornHead != "" && !usable(remote.unbornHead) {
+		remote.unbornHead = ""
+	}
+}
+
+// close ends the connection.
+func (remote *uploadPack) close() error {
+	return remote.connection.close()
+}
+
+// capability returns the value of a protocol v2 capability such as
+// "ls-refs=unborn", and whether the server has it at all.
+func (remote *uploadPack) capability(name string) (string, bool) {
+	for _, capability := range remote.capabilities {
+		if key, value, _ := strings.Cut(capability, "="); key == name {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// listRefs runs the v2 ls-refs command. Each line is "<oid> <name>" with
+// "symref-target:<ref>" for symbolic refs and "peeled:<oid>" for annotated
+// tags, or "unborn HEAD ..." for an empty remote.
+func (remote *uploadPack) listRefs(prefixes []string) error {
+	arguments := []string{"symrefs", "peel"}
+	if features, _ := remote.capability("ls-refs"); slices.Contains(strings.Fields(features), "unborn") {
+		arguments = append(arguments, "unborn")
+	}
+	for _, prefix := range prefixes {
+		arguments = append(arguments, "ref-prefix "+prefix)
+	}
+	body, err := remote.command("ls-refs", arguments)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	reader := bufio.NewReader(body)
+	for {
+		line, length, err := readPkt(reader)
+		if err != nil {
+			return err
+		}
+		if length < 4 {
+			return nil
+		}
+		fields := strings.Fields(string(line))
+		if len(fields) < 2 {
+			return fmt.Errorf("Malformed ls-refs line %q", line)
+		}
+		ref := advertisedRef{name: fields[1], sha: fields[0]}
+		for _, attribute := range fields[2:] {
+			if target, ok := strings.CutPrefix(attribute, "symref-target:"); ok {
+				ref.symref = target
+			} else if peeled, ok := strings.CutPrefix(attribute, "peeled:"); ok {
+				ref.peeled = peeled
+			}
+		}
+		if ref.sha == "unborn" {
+			if ref.name == "HEAD" {
+				remote.unbornHead = ref.symref
+			}
+			continue
+		}
+		if len(ref.sha) != 2*remote.algorithm.Size() {
+			return fmt.Errorf("Malformed ls-refs line %q", line)
+		}
+		remote.refs = append(remote.refs, ref)
+	}
+}
+
+// fetchRequest is what a fetch asks upload-pack for. haves name commits we
+// already have, so the server can leave out everything reachable from them.
+// depth, when set, cuts the history sent that many commits below the wants;
+// shallow lists the commits our own history is already cut at. Without
+// progress the server is asked to keep its progress to itself, and none of
+// ours is shown.
+type fetchRequest struct {
+	wants    []string
+	haves    []string
+	depth    int
+	shallow  []string
+	progress bool
+}
+
+// fetchResponse is the raw packfile a fetch received, with the commits the
+// server says are now shallow boundaries and those that no longer are.
+type fetchResponse struct {
+	pack      []byte
+	shallow   []string
+	unshallow []string
+}
+
+// fetch runs the negotiation for request and returns what the server sent.
+// The server's messages are shown on stderr, as is our progress when
+// request asks for it.
+func (remote *uploadPack) fetch(request fetchRequest, stderr io.Writer) (*fetchResponse, error) {
+	if remote.version != 2 {
+		return fetchPack(remote, request, stderr)
+	}
+	arguments := []string{"ofs-delta", "include-tag"}
+	if !request.progress {
+		arguments = append(arguments, "no-progress")
+	}
+	for _, want := range request.wants {
+		arguments = append(arguments, "want "+want)
+	}
+	if request.depth > 0 || len(request.shallow) > 0 {
+		if features, _ := remote.capability("fetch"); !slices.Contains(strings.Fields(features), "shallow") {
+			return nil, failure.Fatal("fatal: Server does not support shallow clients")
+		}
+		for _, sha := range request.shallow {
+			arguments = append(arguments, "shallow "+sha)
+		}
+		if request.depth > 0 {
+			arguments = append(arguments, fmt.Sprintf("deepen %v", request.depth))
+		}
+	}
+	for _, have := range request.haves {
+		arguments = append(arguments, "have "+have)
+	}
+	arguments = append(arguments, "done")
+	body, err := remote.command("fetch", arguments)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	// Sections before the packfile, such as shallow-info, end with a delim
+	// packet. Having sent "done", there is no acknowledgments section.
+	response := &fetchResponse{}
+	reader := bufio.NewReader(body)
+	for {
+		line, length, err := readPkt(reader)
+		if err != nil {
+			return nil, err
+		}
+		if length < 4 {
+			continue
+		}
+		text := strings.TrimSuffix(string(line), "\n")
+		if text == "packfile" {
+			break
+		}
+		if message, ok := strings.CutPrefix(text, "ERR "); ok {
+			return nil, fmt.Errorf("remote error: %v", message)
+		}
+		response.readShallowLine(text)
+	}
+	if response.pack, err = readFetchedPack(remote.algorithm, newSidebandReader(reader, stderr), request.progress, stderr); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// readFetchedPack reads the pack a fetch is sent, with a "Receiving objects"
+// meter on stderr when progress is wanted. What follows the pack, such as
+// the rest of a sideband stream and the messages in it, is read too.
+func readFetchedPack(algorithm objects.Algorithm, r io.Reader, show bool, stderr io.Writer) ([]byte, error) {
+	output := io.Writer(nil)
+	if show {
+		output = stderr
+	}
+	var meter *progress
+	reader := bufio.NewReader(r)
+	data, err := pack.ReadStream(algorithm, reader, func(done int, total int, size int64) {
+		if meter == nil {
+			meter = startProgress(output, "Receiving objects", total)
+		}
+		if done > 0 {
+			meter.update(done, size)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		return nil, err
+	}
+	meter.stop()
+	return data, nil
+}
+
+// readShallowLine records a "shallow <oid>" or "unshallow <oid>" line, which
+// both protocols send ahead of the pack when the history is cut.
+func (response *fetchResponse) readShallowLine(line string) {
+	if sha, ok := strings.CutPrefix(line, "shallow "); ok {
+		response.shallow = append(response.shallow, sha)
+	} else if sha, ok := strings.CutPrefix(line, "unshallow "); ok {
+		response.unshallow = append(response.unshallow, sha)
+	}
+}
+
+// command sends a v2 command request: the command and its capabilities, a
+// delim packet, the arguments and a flush.
+func (remote *uploadPack) command(name string, arguments []string) (io.ReadCloser, error) {
+	var request bytes.Buffer
+	request.WriteString(pktLine("command=" + name + "\n"))
+	if format, ok := remote.capability("object-format"); ok {
+		request.WriteString(pktLine("object-format=" + format + "\n"))
+	}
+	request.WriteString("0001")
+	for _, argument := range arguments {
+		request.WriteString(pktLine(argument + "\n"))
+	}
+	request.WriteString("0000")
+	return remote.connection.request(request.Bytes())
+}
+
+// sidebandReader yields the data sent on band 1 of a side-band-64k stream,
+// showing the messages on band 2 and failing on a band 3 error. The flush
+// packet that ends the stream ends the data.
+type sidebandReader struct {
+	r       *bufio.Reader
+	pending []byte
+	done    bool
+	// messages is where band 2 is shown, suffix what ends each of its
+	// lines, and line the start of one still to come.
+	messages io.Writer
+	suffix   string
+	line     []byte
+}
+
+// newSidebandReader demultiplexes the stream on r, showing the remote's
+// messages on messages. Each line of them starts with "remote: "
+// and is padded out to wipe whatever a progress meter left on the line,
+// with an escape sequence on a terminal and spaces elsewhere.
+func newSidebandReader(r *bufio.Reader, messages io.Writer) *sidebandReader {
+	suffix := "        "
+	if isTerminal(messages) && os.Getenv("TERM") != "dumb" {
+		suffix = "\033[K"
+	}
+	return &sidebandReader{r: r, messages: messages, suffix: suffix}
+}
+
+func (reader *sidebandReader) Read(p []byte) (int, error) {
+	for len(reader.pending) == 0 {
+		if reader.done {
+			return 0, io.EOF
+		}
+		line, length, err := readPkt(reader.r)
+		if err != nil {
+			return 0, err
+		}
+		if length < 4 {
+			if len(reader.line) > 0 {
+				reader.messages.Write(append(reader.line, '\n'))
+				reader.line = nil
+			}
+			reader.done = true
+			continue
+		}
+		if len(line) == 0 {
+			continue
+		}
+		switch line[0] {
+		case 1:
+			reader.pending = line[1:]
+		case 2:
+			reader.showMessages(line[1:])
+		case 3:
+			return 0, fmt.Errorf("remote error: %v", strings.TrimSpace(string(line[1:])))
+		default:
+			return 0, fmt.Errorf("Invalid side-band channel %v", line[0])
+		}
+	}
+	n := copy(p, reader.pending)
+	reader.pending = reader.pending[n:]
+	return n, nil
+}
+
+// showMessages shows each line of a band 2 packet, ended by "\n" or by the
+// "\r" of a progress meter. A line cut off by the end of the packet is held
+// back until the rest comes.
+func (reader *sidebandReader) showMessages(data []byte) {
+	for len(data) > 0 {
+		end := bytes.IndexAny(data, "\r\n")
+		if end < 0 {
+			if len(reader.line) == 0 {
+				reader.line = append(reader.line, "remote: "...)
+			}
+			reader.line = append(reader.line, data...)
+			return
+		}
+		if len(reader.line) == 0 {
+			reader.line = append(reader.line, "remote: "...)
+		}
+		if end > 0 {
+			reader.line = append(append(reader.line, data[:end]...), reader.suffix...)
+		}
+		reader.messages.Write(append(reader.line, data[end]))
+		reader.line, data = nil, data[end+1:]
+	}
+}
+
+// sidebandWriter sends what is written to it on one band of a side-band-64k
+// stream, in packets no longer than 65520 bytes.
+type sidebandWriter struct {
+	w    io.Writer
+	band byte
+}
+
+func (writer sidebandWriter) Write(p []byte) (int, error) {
+	for sent := 0; sent < len(p); {
+		chunk := p[sent:min(len(p), sent+65515)]
+		if _, err := fmt.Fprintf(writer.w, "%04x%c", len(chunk)+5, writer.band); err != nil {
+			return sent, err
+		}
+		if _, err := writer.w.Write(chunk); err != nil {
+			return sent, err
+		}
+		sent += len(chunk)
+	}
+	return len(p), nil
+}
+
+// parseRefAdvertisement reads "<sha> <name>" lines, the first carrying the
+// capabilities after a NUL, and "<sha> <tag>^{}" lines peeling the tag just
+// before. HEAD's symref capability is recorded on the ref.
+func parseRefAdvertisement(lines [][]byte) ([]advertisedRef, []string, error) {
+	refs := make([]advertisedRef, 0)
+	var capabilities []string
+	algorithm := objects.SHA1
+	for _, line := range lines {
+		if line == nil {
+			continue
+		}
+		text := strings.TrimSuffix(string(line), "\n")
+		if refPart, capabilityPart, found := strings.Cut(text, "\x00"); found {
+			capabilities = strings.Fields(capabilityPart)
+			text = refPart
+			var err error
+			if algorithm, err = advertisedObjectFormat(capabilities); err != nil {
+				return nil, nil, err
+			}
+		}
+		sha, name, found := strings.Cut(text, " ")
+		if !found || len(sha) != 2*algorithm.Size() {
+			return nil, nil, fmt.Errorf("Malformed ref advertisement line %q", text)
+		}
+		if name == "capabilities^{}" {
+			continue
+		}
+		if tag, ok := strings.CutSuffix(name, "^{}"); ok {
+			// A peeled tag follows the tag itself.
+			if len(refs) > 0 && refs[len(refs)-1].name == tag {
+				refs[len(refs)-1].peeled = sha
+			}
+			continue
+		}
+		refs = append(refs, advertisedRef{name: name, sha: sha})
+	}
+	for _, capability := range capabilities {
+		if symref, ok := strings.CutPrefix(capability, "symref="); ok {
+			name, target, _ := strings.Cut(symref, ":")
+			for index := range refs {
+				if refs[index].name == name {
+					refs[index].symref = target
+				}
+			}
+		}
+	}
+	return refs, capabilities, nil
+}
+
+// advertisedObjectFormat returns the hash a server's object-format
+// capability names, SHA-1 for a server that has none.
+func advertisedObjectFormat(capabilities []string) (objects.Algorithm, error) {
+	for _, capability := range capabilities {
+		if name, ok := strings.CutPrefix(capability, "object-format="); ok {
+			algorithm, err := objects.AlgorithmNamed(name)
+			if err != nil {
+				return nil, failure.Fatalf("fatal: unknown object format '%v' specified by server", name)
+			}
+			return algorithm, nil
+		}
+	}
+	return objects.SHA1, nil
+}
+
+// checkObjectFormat fails when a remote names its objects with another hash
+// than the repository does.
+func checkObjectFormat(server objects.Algorithm) error {
+	if server != repository.Algorithm {
+		return failure.Fatalf("fatal: mismatched algorithms: client %v; server %v", repository.Algorithm.Name(), server.Name())
+	}
+	return nil
+}
+
+// readPktLines splits pkt-line framed data. Flush packets are returned as nil.
+func readPktLines(data []byte) ([][]byte, error) {
+	lines := make([][]byte, 0)
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, errors.New("Truncated pkt-line")
+		}
+		length, err := strconv.ParseUint(string(data[:4]), 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid pkt-line length %q", data[:4])
+		}
+		if length == 0 {
+			lines = append(lines, nil)
+			data = data[4:]
+			continue
+		}
+		if length < 4 || int(length) > len(data) {
+			return nil, fmt.Errorf("Invalid pkt-line length %v", length)
+		}
+		lines = append(lines, data[4:length])
+		data = data[length:]
+	}
+	return lines, nil
+}
+
+// readPkt reads one pkt-line from a stream. It returns the length field with
+// the payload, so callers can tell the flush (0), delim (1) and response-end
+// (2) packets, which carry none.
+func readPkt(r *bufio.Reader) ([]byte, int, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, 0, failure.Fatal("fatal: the remote end hung up unexpectedly")
+	}
+	length, err := strconv.ParseUint(string(header), 16, 16)
+	if err != nil || length == 3 {
+		return nil, 0, fmt.Errorf("Invalid pkt-line length %q", header)
+	}
+	if length < 4 {
+		return nil, int(length), nil
+	}
+	line := make([]byte, length-4)
+	if _, err := io.ReadFull(r, line); err != nil {
+		return nil, 0, failure.Fatal("fatal: the remote end hung up unexpectedly")
+	}
+	return line, int(length), nil
+}
+
+func pktLine(line string) string {
+	return fmt.Sprintf("%04x%s", len(line)+4, line)
+}
+
+// fetchPack runs request against git-upload-pack in the original protocol.
+// The pack comes multiplexed with the server's messages when it offers
+// side-band-64k.
+func fetchPack(remote *uploadPack, request fetchRequest, stderr io.Writer) (*fetchResponse, error) {
+	requested := []string{"ofs-delta"}
+	sideband := slices.Contains(remote.capabilities, "side-band-64k")
+	if sideband {
+		requested = append(requested, "side-band-64k")
+	}
+	if !request.progress {
+		requested = append(requested, "no-progress")
+	}
+	if slices.Contains(remote.capabilities, "include-tag") {
+		requested = append(requested, "include-tag")
+	}
+	deepen := request.depth > 0 || len(request.shallow) > 0
+	if deepen {
+		if !slices.Contains(remote.capabilities, "shallow") {
+			return nil, failure.Fatal("fatal: Server does not support shallow clients")
+		}
+		requested = append(requested, "shallow")
+	}
+	var body bytes.Buffer
+	for index, want := range request.wants {
+		if index == 0 {
+			body.WriteString(pktLine(fmt.Sprintf("want %v %v\n", want, strings.Join(requested, " "))))
+		} else {
+			body.WriteString(pktLine(fmt.Sprintf("want %v\n", want)))
+		}
+	}
+	for _, sha := range request.shallow {
+		body.WriteString(pktLine(fmt.Sprintf("shallow %v\n", sha)))
+	}
+	if request.depth > 0 {
+		body.WriteString(pktLine(fmt.Sprintf("deepen %v\n", request.depth)))
+	}
+	body.WriteString("0000")
+	for _, have := range request.haves {
+		body.WriteString(pktLine(fmt.Sprintf("have %v\n", have)))
+	}
+	body.WriteString(pktLine("done\n"))
+
+	// The service exits once the pack is sent.
+	reply, err := remote.connection.request(body.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	defer reply.Close()
+
+	// The shallow-info comes first, then, having sent "done" without
+	// multi_ack, the one NAK or ACK that precedes the pack.
+	response := &fetchResponse{}
+	reader := bufio.NewReader(reply)
+	for {
+		line, length, err := readPkt(reader)
+		if err != nil {
+			return nil, err
+		}
+		if length < 4 {
+			continue
+		}
+		text := strings.TrimSuffix(string(line), "\n")
+		if text == "NAK" || strings.HasPrefix(text, "ACK ") {
+			break
+		}
+		if message, ok := strings.CutPrefix(text, "ERR "); ok {
+			return nil, failure.Fatalf("fatal: remote error: %v", message)
+		}
+		if deepen {
+			response.readShallowLine(text)
+		}
+	}
+	packStream := io.Reader(reader)
+	if sideband {
+		packStream = newSidebandReader(reader, stderr)
+	}
+	if response.pack, err = readFetchedPack(remote.algorithm, packStream, request.progress, stderr); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeSSH points GIT_SSH_COMMAND at a script that runs the command it is
+// given on this machine, with the environment ssh would have sent, and logs
+// its arguments and the packets git's side of the conversation saw.
+func fakeSSH(t *testing.T, dir string) (args, packets string) {
+	t.Helper()
+	args, packets = filepath.Join(dir, "ssh.args"), filepath.Join(dir, "ssh.packets")
+	script := "#!/bin/sh\n" +
+		"echo \"$GIT_PROTOCOL $*\" >>" + args + "\n" +
+		"while [ $# -gt 1 ]; do shift; done\n" +
+		"GIT_TRACE_PACKET=" + packets + " exec sh -c \"$1\"\n"
+	writeFile(t, dir, "ssh", script)
+	if err := os.Chmod(filepath.Join(dir, "ssh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GIT_SSH_COMMAND", filepath.Join(dir, "ssh"))
+	return args, packets
+}
+
+func TestCloneAndFetchOverProtocolV2(t *testing.T) {
+	requireGit(t)
+	base := setupTest(t)
+	source := filepath.Join(base, "source")
+	runGit(t, base, "init", "-q", "-b", "main", source)
+	first := commitFile(t, source, "a", "a\n", "one")
+	runGit(t, source, "tag", "-a", "-m", "tag", "v1")
+	args, packets := fakeSSH(t, base)
+
+	if _, stderr, code := runIn(t, base, "", "clone", "host:"+source, "clone"); code != 0 {
+		t.Fatalf("clone exited %v:\n%v", code, stderr)
+	}
+	clone := filepath.Join(base, "clone")
+	for revision, want := range map[string]string{"HEAD": first, "origin/main": first, "v1^{commit}": first} {
+		if got := strings.TrimSpace(mygit(t, clone, "rev-parse", revision)); got != want {
+			t.Errorf("rev-parse %v = %v, want %v", revision, got, want)
+		}
+	}
+
+	second := commitFile(t, source, "a", "b\n", "two")
+	if _, stderr, code := runIn(t, clone, "", "fetch"); code != 0 || !strings.Contains(stderr, first[:7]+".."+second[:7]+"  main       -> origin/main\n") {
+		t.Errorf("fetch: exit %v\n%v", code, stderr)
+	}
+	if got := runGit(t, clone, "fsck", "--strict"); got != "" {
+		t.Errorf("git fsck of the clone:\n%v", got)
+	}
+
+	// Both conversations asked for version 2, and git's upload-pack answered
+	// ls-refs and fetch commands rather than advertising its refs.
+	logged, err := os.ReadFile(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(logged)), "\n"); len(lines) != 2 || !strings.HasPrefix(lines[0], "version=2 -o SendEnv=GIT_PROTOCOL host git-upload-pack ") {
+		t.Errorf("ssh was run as:\n%s", logged)
+	}
+	trace, err := os.ReadFile(packets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"upload-pack> version 2", "upload-pack< command=ls-refs", "upload-pack< command=fetch", "upload-pack> packfile"} {
+		if !strings.Contains(string(trace), want) {
+			t.Errorf("upload-pack never saw %q", want)
+		}
+	}
+}
@@ -0,0 +1,681 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+	"github.com/codecrafters-io/git-starter-go/internal/pack"
+	"github.com/codecrafters-io/git-starter-go/pkg/config"
+	"github.com/codecrafters-io/git-starter-go/pkg/objects"
+	"github.com/codecrafters-io/git-starter-go/pkg/refs"
+)
+
+// zeroSHA is the all-zero object name that stands for no object, as long
+// as the repository's object names.
+func zeroSHA() string {
+	return strings.Repeat("0", 2*repository.Algorithm.Size())
+}
+
+// pushUpdate is one remote ref a push creates, moves or deletes. src is the
+// local side as the user named it and dst the full remote ref name; new is
+// zeroSHA for a deletion and old is zeroSHA for a ref the remote lacks.
+type pushUpdate struct {
+	src    string
+	dst    string
+	old    string
+	new    string
+	force  bool
+	flag   byte
+	status string
+	reason string
+}
+
+// push sends local refs to a remote over the receive-pack protocol: every
+// object the remote is missing goes in one pack, and the remote refs are
+// then moved. Updates that are not fast-forwards are refused unless forced,
+// and the pre-push hook can call off the push unless --no-verify is given.
+// Progress is shown on a terminal, or with --progress, unless -q quiets
+// the push. Once ctx is canceled no tracking ref is touched.
+func push(ctx context.Context, args []string, stdout io.Writer, stderr io.Writer) error {
+	force, quiet, setUpstream, noVerify, forceProgress := false, false, false, false, false
+	positional := make([]string, 0, 2)
+	for _, arg := range args {
+		switch arg {
+		case "-f", "--force":
+			force = true
+		case "-q", "--quiet":
+			quiet = true
+		case "-u", "--set-upstream":
+			setUpstream = true
+		case "--no-verify":
+			noVerify = true
+		case "--progress":
+			forceProgress = true
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return failure.Usagef("error: unknown option `%v'", strings.TrimLeft(arg, "-"))
+			}
+			positional = append(positional, arg)
+		}
+	}
+
+	cfg, err := repository.Config()
+	if err != nil {
+		return err
+	}
+	branchName := ""
+	if headRef, isSymref, err := readHeadSymref(); err == nil && isSymref {
+		branchName = strings.TrimPrefix(headRef, "refs/heads/")
+	}
+	remote := ""
+	if len(positional) > 0 {
+		remote = positional[0]
+	} else {
+		remote = pushRemote(cfg, branchName)
+	}
+	repoURL, ok := cfg.Get("remote." + remote + ".pushurl")
+	if !ok {
+		repoURL, ok = cfg.Get("remote." + remote + ".url")
+	}
+	if !ok {
+		if !isRemoteURL(remote) {
+			return failure.Fatalf("fatal: '%v' does not appear to be a git repository", remote)
+		}
+		repoURL = remote
+	}
+	specs := positional[min(len(positional), 1):]
+	if len(specs) == 0 {
+		if specs = cfg.GetAll("remote." + remote + ".push"); len(specs) == 0 {
+			spec, err := defaultPushRefspec(cfg, remote, branchName, setUpstream)
+			if err != nil {
+				return err
+			}
+			specs = []string{spec}
+		}
+	}
+	failed := fmt.Errorf("error: failed to push some refs to '%v'", anonymizeURL(repoURL))
+	baseURL := strings.TrimSuffix(repoURL, "/")
+
+	connection, lines, err := connect(ctx, baseURL, "git-receive-pack", "", stderr)
+	if err != nil {
+		return err
+	}
+	defer connection.close()
+	advertised, capabilities, err := parseRefAdvertisement(lines)
+	if err != nil {
+		return err
+	}
+	if algorithm, err := advertisedObjectFormat(capabilities); err != nil {
+		return err
+	} else if err := checkObjectFormat(algorithm); err != nil {
+		return err
+	}
+	remoteRefs := make(map[string]string, len(advertised))
+	for _, ref := range advertised {
+		remoteRefs[ref.name] = ref.sha
+	}
+	updates, err := expandPushRefspecs(specs, remoteRefs, force, stderr)
+	if errors.Is(err, errSilentFailure) {
+		return failed
+	} else if err != nil {
+		return err
+	}
+
+	pending := make([]*pushUpdate, 0, len(updates))
+	for _, update := range updates {
+		update.old = zeroSHA()
+		if sha, ok := remoteRefs[update.dst]; ok {
+			update.old = sha
+		}
+		checkPushUpdate(update)
+		if update.status == "" {
+			pending = append(pending, update)
+		}
+	}
+	if !noVerify {
+		if err := runPrePushHook(remote, repoURL, pending, stderr); err != nil {
+			if errors.Is(err, errSilentFailure) {
+				return failed
+			}
+			return err
+		}
+	}
+	if len(pending) > 0 {
+		if err := sendPack(connection, pending, advertised, capabilities, progressOutput(stderr, quiet, forceProgress), stderr); err != nil {
+			return err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	rejected, upToDate := false, true
+	for _, update := range updates {
+		rejected = rejected || update.flag == '!'
+		upToDate = upToDate && update.status == "up to date"
+	}
+	switch {
+	case upToDate && !quiet:
+		fmt.Fprintln(stderr, "Everything up-to-date")
+	case !upToDate && (!quiet || rejected):
+		fmt.Fprintf(stderr, "To %v\n", anonymizeURL(repoURL))
+		for _, update := range updates {
+			if update.status != "up to date" {
+				printPushStatus(update, stderr)
+			}
+		}
+	}
+
+	for _, update := range updates {
+		if update.flag == '!' {
+			continue
+		}
+		if err := updateTrackingRef(cfg, remote, update); err != nil {
+			return err
+		}
+		if setUpstream && strings.HasPrefix(update.src, "refs/heads/") && strings.HasPrefix(update.dst, "refs/heads/") {
+			if err := setBranchUpstream(strings.TrimPrefix(update.src, "refs/heads/"), remote, update.dst, stdout); err != nil {
+				return err
+			}
+		}
+	}
+	if rejected {
+		return errors.New(failed.Error() + pushHints(updates, branchName))
+	}
+	return nil
+}
+
+// runPrePushHook gives the pre-push hook the remote's name and URL, and a
+// line on stdin for each ref about to be updated:
+// "<local ref> <local sha> <remote ref> <remote sha>", the local ref being
+// "(delete)" for a deletion.
+func runPrePushHook(remote string, repoURL string, updates []*pushUpdate, stderr io.Writer) error {
+	var input bytes.Buffer
+	for _, update := range updates {
+		src := update.src
+		if update.new == zeroSHA() {
+			src = "(delete)"
+		}
+		fmt.Fprintf(&input, "%v %v %v %v\n", src, update.new, update.dst, update.old)
+	}
+	return runHook("pre-push", []string{remote, repoURL}, input.Bytes(), nil, stderr)
+}
+
+// pushRemote picks the remote for a push that names none, preferring the
+// current branch's pushRemote, then remote.pushDefault, then its upstream.
+func pushRemote(cfg *config.Config, branchName string) string {
+	if branchName != "" {
+		if remote, ok := cfg.Get("branch." + branchName + ".pushRemote"); ok {
+			return remote
+		}
+	}
+	if remote, ok := cfg.Get("remote.pushDefault"); ok {
+		return remote
+	}
+	if branchName != "" {
+		if remote, ok := cfg.Get("branch." + branchName + ".remote"); ok {
+			return remote
+		}
+	}
+	return "origin"
+}
+
+// defaultPushRefspec applies push.default=simple: the current branch goes to
+// its upstream, which must share its name. Pushing to a remote other than
+// the upstream one sends the branch under the same name.
+func defaultPushRefspec(cfg *config.Config, remote string, branchName string, setUpstream bool) (string, error) {
+	if branchName == "" {
+		return "", failure.Fatal("fatal: You are not currently on a branch.\nTo push the history leading to the current (detached HEAD)\nstate now, use\n\n    git push " + remote + " HEAD:<name-of-remote-branch>\n")
+	}
+	branchRef := "refs/heads/" + branchName
+	upstreamRemote, ok := cfg.Get("branch." + branchName + ".remote")
+	if !ok {
+		upstreamRemote = "origin"
+	}
+	merge, hasMerge := cfg.Get("branch." + branchName + ".merge")
+	switch {
+	case setUpstream || remote != upstreamRemote:
+	case !hasMerge:
+		return "", failure.Fatalf("fatal: The current branch %v has no upstream branch.\nTo push the current branch and set the remote as upstream, use\n\n    git push --set-upstream %v %v\n", branchName, remote, branchName)
+	case merge != branchRef:
+		return "", failure.Fatalf("fatal: The upstream branch of your current branch does not match\nthe name of your current branch.  To push to the upstream branch\non the remote, use\n\n    git push %v HEAD:%v\n\nTo push to the branch of the same name on the remote, use\n\n    git push %v HEAD\n", remote, strings.TrimPrefix(merge, "refs/heads/"), remote)
+	}
+	return branchRef + ":" + branchRef, nil
+}
+
+// expandPushRefspecs turns refspecs into updates. A source is a local ref or
+// any revision; a destination that is not a full ref name is matched against
+// the remote's refs or given the source's refs/heads or refs/tags prefix.
+// Problems are reported on stderr and fail the whole push.
+func expandPushRefspecs(specs []string, remoteRefs map[string]string, force bool, stderr io.Writer) ([]*pushUpdate, error) {
+	updates := make([]*pushUpdate, 0, len(specs))
+	failed := false
+	for _, spec := range specs {
+		refspec, err := refs.ParseRefspec(spec)
+		if err != nil {
+			return nil, err
+		}
+		update := &pushUpdate{force: force || refspec.Force}
+
+		if refspec.IsGlob() {
+			list, err := repository.Refs.List("refs/")
+			if err != nil {
+				return nil, err
+			}
+			for _, ref := range list {
+				if dst, ok := refspec.Map(ref.Name); ok && dst != "" {
+					updates = append(updates, &pushUpdate{src: ref.Name, dst: dst, new: ref.SHA, force: update.force})
+				}
+			}
+			continue
+		}
+
+		if refspec.Src == "" {
+			update.new = zeroSHA()
+			update.dst = remoteRefName(refspec.Dst, remoteRefs)
+			if update.dst == "" {
+				fmt.Fprintf(stderr, "error: unable to delete '%v': remote ref does not exist\n", refspec.Dst)
+				failed = true
+				continue
+			}
+			updates = append(updates, update)
+			continue
+		}
+
+		update.src = localRefName(refspec.Src)
+		if update.src == "" {
+			update.src = refspec.Src
+		}
+		update.new, err = resolveRevision(refspec.Src)
+		if err != nil {
+			fmt.Fprintf(stderr, "error: src refspec %v does not match any\n", refspec.Src)
+			failed = true
+			continue
+		}
+		srcRef := update.src
+		if srcRef == "HEAD" {
+			srcRef, _, _ = readHeadSymref()
+		}
+		update.dst = refspec.Dst
+		switch {
+		case update.dst == "" && strings.HasPrefix(srcRef, "refs/"):
+			update.dst = srcRef
+		case update.dst != "" && strings.HasPrefix(update.dst, "refs/"):
+		case update.dst != "" && remoteRefName(update.dst, remoteRefs) != "":
+			update.dst = remoteRefName(update.dst, remoteRefs)
+		case update.dst != "" && (strings.HasPrefix(srcRef, "refs/heads/") || strings.HasPrefix(srcRef, "refs/tags/")):
+			update.dst = srcRef[:strings.IndexByte(srcRef[len("refs/"):], '/')+len("refs/")+1] + update.dst
+		default:
+			fmt.Fprintf(stderr, "error: The destination you provided is not a full refname (i.e.,\nstarting with \"refs/\"). You must fully qualify the ref.\n")
+			failed = true
+			continue
+		}
+		updates = append(updates, update)
+	}
+	if failed {
+		return nil, errSilentFailure
+	}
+	return updates, nil
+}
+
+// localRefName returns the full name of the local ref name abbreviates, or
+// "" when it is not a ref.
+func localRefName(name string) string {
+	candidates := []string{"refs/" + name, "refs/tags/" + name, "refs/heads/" + name, "refs/remotes/" + name}
+	if name == "HEAD" || strings.HasPrefix(name, "refs/") {
+		candidates = []string{name}
+	}
+	for _, candidate := range candidates {
+		if _, _, err := repository.Refs.Resolve(candidate); err == nil {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// remoteRefName finds the advertised ref that name abbreviates.
+func remoteRefName(name string, remoteRefs map[string]string) string {
+	for _, candidate := range []string{name, "refs/" + name, "refs/tags/" + name, "refs/heads/" + name} {
+		if _, ok := remoteRefs[candidate]; ok && strings.HasPrefix(candidate, "refs/") {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// checkPushUpdate fills in the remote's current value and rejects updates the
+// remote would lose history from, before anything is sent.
+func checkPushUpdate(update *pushUpdate) {
+	reject := func(reason string) {
+		update.flag, update.status, update.reason = '!', "[rejected]", reason
+	}
+	switch {
+	case update.old == update.new:
+		update.status = "up to date"
+	case update.new == zeroSHA(), update.old == zeroSHA(), update.force:
+	case strings.HasPrefix(update.dst, "refs/tags/"):
+		reject("already exists")
+	case !repository.HasObject(update.old):
+		reject("fetch first")
+	default:
+		if fastForward, err := isAncestor(update.old, update.new); err != nil || !fastForward {
+			reject("non-fast-forward")
+		}
+	}
+}
+
+// sendPack sends git-receive-pack the ref update commands and a pack of
+// every object the remote lacks, then records the remote's verdict on each
+// update. Packing is shown on progress when there is one; without it a
+// server that can is asked to be quiet too. Whatever it says on the side
+// goes to stderr.
+func sendPack(connection transport, updates []*pushUpdate, advertised []advertisedRef, capabilities []string, progress io.Writer, stderr io.Writer) error {
+	requested := []string{"report-status"}
+	sideband := slices.Contains(capabilities, "side-band-64k")
+	if sideband {
+		requested = append(requested, "side-band-64k")
+	}
+	if progress == nil && slices.Contains(capabilities, "quiet") {
+		requested = append(requested, "quiet")
+	}
+	deleting := slices.ContainsFunc(updates, func(update *pushUpdate) bool { return update.new == zeroSHA() })
+	if deleting {
+		if !slices.Contains(capabilities, "delete-refs") {
+			for _, update := range updates {
+				if update.new == zeroSHA() {
+					update.flag, update.status, update.reason = '!', "[remote rejected]", "remote does not support deleting refs"
+				}
+			}
+			updates = slices.DeleteFunc(updates, func(update *pushUpdate) bool { return update.new == zeroSHA() })
+			if len(updates) == 0 {
+				return nil
+			}
+		}
+		requested = append(requested, "delete-refs")
+	}
+	if slices.ContainsFunc(capabilities, func(capability string) bool { return strings.HasPrefix(capability, "object-format=") }) {
+		requested = append(requested, "object-format="+repository.Algorithm.Name())
+	}
+
+	var request bytes.Buffer
+	tips := make([]string, 0, len(updates))
+	for index, update := range updates {
+		command := fmt.Sprintf("%v %v %v", update.old, update.new, update.dst)
+		if index == 0 {
+			command += "\x00" + strings.Join(requested, " ")
+		}
+		request.WriteString(pktLine(command + "\n"))
+		if update.new != zeroSHA() {
+			tips = append(tips, update.new)
+		}
+	}
+	request.WriteString("0000")
+	// A pack is sent unless every command is a deletion.
+	if len(tips) > 0 {
+		have := make([]string, 0, len(advertised))
+		for _, ref := range advertised {
+			if repository.HasObject(ref.sha) {
+				have = append(have, ref.sha)
+			}
+		}
+		missing, err := missingObjects(tips, have)
+		if err != nil {
+			return err
+		}
+		enumerating := startProgress(progress, "Enumerating objects", 0)
+		enumerating.update(len(missing), 0)
+		enumerating.stop()
+		if err := writePushPack(&request, missing, progress); err != nil {
+			return err
+		}
+	}
+
+	response, err := connection.request(request.Bytes())
+	if err != nil {
+		return err
+	}
+	defer response.Close()
+	reply := io.Reader(response)
+	if sideband {
+		reply = newSidebandReader(bufio.NewReader(response), stderr)
+	}
+	body, err := io.ReadAll(reply)
+	if err != nil {
+		return err
+	}
+	lines, err := readPktLines(body)
+	if err != nil {
+		return err
+	}
+	return readPushReport(lines, updates)
+}
+
+// writePushPack appends a pack of objects to request, showing on progress,
+// when there is one, how the writing goes and what it came to. Every
+// object is stored whole.
+func writePushPack(request *bytes.Buffer, packed []*pack.Object, progress io.Writer) error {
+	meter := startProgress(progress, "Writing objects", len(packed))
+	start := request.Len()
+	writer, err := pack.NewWriter(repository.Algorithm, request, len(packed))
+	if err != nil {
+		return err
+	}
+	for index, object := range packed {
+		if err := writer.Add(object); err != nil {
+			return err
+		}
+		meter.update(index+1, int64(request.Len()-start))
+	}
+	if _, err := writer.Close(); err != nil {
+		return err
+	}
+	meter.update(len(packed), int64(request.Len()-start))
+	meter.stop()
+	if progress != nil {
+		fmt.Fprintf(progress, "Total %v (delta 0), reused 0 (delta 0), pack-reused 0\n", len(packed))
+	}
+	return nil
+}
+
+// readPushReport applies a report-status response: "unpack ok" and then an
+// "ok <ref>" or "ng <ref> <reason>" line per command.
+func readPushReport(lines [][]byte, updates []*pushUpdate) error {
+	if len(lines) == 0 || !strings.HasPrefix(string(lines[0]), "unpack ") {
+		return failure.Fatal("fatal: the remote end hung up unexpectedly")
+	}
+	if unpack := strings.TrimSpace(strings.TrimPrefix(string(lines[0]), "unpack ")); unpack != "ok" {
+		for _, update := range updates {
+			update.flag, update.status, update.reason = '!', "[remote rejected]", "unpacker error"
+		}
+		return fmt.Errorf("error: remote unpack failed: %v", unpack)
+	}
+	for _, line := range lines[1:] {
+		text := strings.TrimSuffix(string(line), "\n")
+		verdict, rest, _ := strings.Cut(text, " ")
+		name, reason, _ := strings.Cut(rest, " ")
+		for _, update := range updates {
+			if update.dst != name {
+				continue
+			}
+			if verdict == "ng" {
+				update.flag, update.status, update.reason = '!', "[remote rejected]", reason
+			}
+		}
+	}
+	for _, update := range updates {
+		if update.status != "" {
+			continue
+		}
+		switch {
+		case update.new == zeroSHA():
+			update.flag, update.status = '-', "[deleted]"
+		case update.old == zeroSHA() && strings.HasPrefix(update.dst, "refs/tags/"):
+			update.flag, update.status = '*', "[new tag]"
+		case update.old == zeroSHA() && strings.HasPrefix(update.dst, "refs/heads/"):
+			update.flag, update.status = '*', "[new branch]"
+		case update.old == zeroSHA():
+			update.flag, update.status = '*', "[new reference]"
+		case update.force:
+			if fastForward, err := isAncestor(update.old, update.new); err != nil || !fastForward {
+				update.flag, update.status, update.reason = '+', abbreviate(update.old)+"..."+abbreviate(update.new), "forced update"
+				continue
+			}
+			fallthrough
+		default:
+			update.flag, update.status = ' ', abbreviate(update.old)+".."+abbreviate(update.new)
+		}
+	}
+	return nil
+}
+
+func printPushStatus(update *pushUpdate, stderr io.Writer) {
+	line := fmt.Sprintf(" %c %-17s ", update.flag, update.status)
+	if update.new == zeroSHA() {
+		line += shortRefName(update.dst)
+	} else {
+		line += shortRefName(update.src) + " -> " + shortRefName(update.dst)
+	}
+	if update.reason != "" {
+		line += " (" + update.reason + ")"
+	}
+	fmt.Fprintln(stderr, line)
+}
+
+// pushHints explains the first kind of rejection the way git's advice does.
+func pushHints(updates []*pushUpdate, branchName string) string {
+	for _, update := range updates {
+		if update.status != "[rejected]" {
+			continue
+		}
+		var hint string
+		switch update.reason {
+		case "non-fast-forward":
+			if update.src == "refs/heads/"+branchName || update.src == "HEAD" {
+				hint = "Updates were rejected because the tip of your current branch is behind\nits remote counterpart. Integrate the remote changes (e.g.\n'git pull ...') before pushing again."
+			} else {
+				hint = "Updates were rejected because a pushed branch tip is behind its remote\ncounterpart. Check out this branch and integrate the remote changes\n(e.g. 'git pull ...') before pushing again."
+			}
+		case "fetch first":
+			hint = "Updates were rejected because the remote contains work that you do\nnot have locally. This is usually caused by another repository pushing\nto the same ref. You may want to first integrate the remote changes\n(e.g., 'git pull ...') before pushing again."
+		case "already exists":
+			return "\nhint: Updates were rejected because the tag already exists in the remote."
+		}
+		hint += "\nSee the 'Note about fast-forwards' in 'git push --help' for details."
+		return "\nhint: " + strings.ReplaceAll(hint, "\n", "\nhint: ")
+	}
+	return ""
+}
+
+// updateTrackingRef moves the remote-tracking ref that the remote's fetch
+// refspecs map a pushed ref to, so it reflects the push without a fetch.
+func updateTrackingRef(cfg *config.Config, remote string, update *pushUpdate) error {
+	for _, spec := range cfg.GetAll("remote." + remote + ".fetch") {
+		refspec, err := refs.ParseRefspec(spec)
+		if err != nil {
+			return err
+		}
+		local, ok := refspec.Map(update.dst)
+		if !ok || local == "" {
+			continue
+		}
+		if update.new == zeroSHA() {
+			return repository.Refs.Delete(local)
+		}
+		return writeRef(local, update.new, "update by push")
+	}
+	return nil
+}
+
+func setBranchUpstream(branchName string, remote string, merge string, stdout io.Writer) error {
+	configPath := repository.Path("config")
+	if err := config.Set(configPath, "branch."+branchName+".remote", remote); err != nil {
+		return err
+	}
+	if err := config.Set(configPath, "branch."+branchName+".merge", merge); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "branch '%v' set up to track '%v/%v'.\n", branchName, remote, strings.TrimPrefix(merge, "refs/heads/"))
+	return nil
+}
+
+// missingObjects lists the objects reachable from tips but not from have,
+// in the order a walk from the tips first meets them.
+func missingObjects(tips []string, have []string) ([]*pack.Object, error) {
+	defer storedObjects()()
+	seen := make(map[string]bool)
+	if err := walkObjects(have, seen, nil); err != nil {
+		return nil, err
+	}
+	missing := make([]*pack.Object, 0)
+	err := walkObjects(tips, seen, func(sha string, objectType string, content []byte) {
+		missing = append(missing, &pack.Object{Type: objectType, Content: content})
+	})
+	return missing, err
+}
+
+// walkObjects visits every object reachable from roots that is not already
+// in seen, marking each one. Submodule commits, and parents below a shallow
+// boundary, are not followed.
+func walkObjects(roots []string, seen map[string]bool, visit func(sha string, objectType string, content []byte)) error {
+	shallow, err := repository.Shallow()
+	if err != nil {
+		return err
+	}
+	return walkObjectsUntil(roots, seen, shallow, visit)
+}
+
+// walkObjectsUntil is walkObjects with the history cut at the commits in
+// shallow rather than at the repository's own shallow boundary.
+func walkObjectsUntil(roots []string, seen map[string]bool, shallow map[string]bool, visit func(sha string, objectType string, content []byte)) error {
+	stack := slices.Clone(roots)
+	for len(stack) > 0 {
+		sha := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[sha] {
+			continue
+		}
+		seen[sha] = true
+		objectType, content, err := repository.ReadObject(sha)
+		if err != nil {
+			return err
+		}
+		if visit != nil {
+			visit(sha, objectType, content)
+		}
+		switch objectType {
+		case "commit":
+			commit, err := objects.ParseCommit(content)
+			if err != nil {
+				return err
+			}
+			if !shallow[sha] {
+				stack = append(stack, commit.Parents...)
+			}
+			stack = append(stack, commit.Tree)
+		case "tree":
+			tree, err := objects.ParseTree(repository.Algorithm, content)
+			if err != nil {
+				return err
+			}
+			for index := len(tree.Entries) - 1; index >= 0; index-- {
+				if entry := tree.Entries[index]; entry.Mode != "160000" {
+					stack = append(stack, fmt.Sprintf("%x", entry.Hash))
+				}
+			}
+		case "tag":
+			tag, err := objects.ParseTag(content)
+			if err != nil {
+				return err
+			}
+			stack = append(stack, tag.Object)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPushUpdatesAndRejects(t *testing.T) {
+	base := setupTest(t)
+	bare, work := filepath.Join(base, "bare.git"), filepath.Join(base, "work")
+	mygit(t, base, "init", "--bare", bare)
+	mygit(t, base, "init", work)
+	first := commitFile(t, work, "a", "a\n", "one")
+
+	push := func(args ...string) (string, int) {
+		t.Helper()
+		stdout, stderr, code := runIn(t, work, "", append([]string{"push", bare}, args...)...)
+		return stdout + stderr, code
+	}
+	remoteRef := func(name string) string {
+		t.Helper()
+		stdout, _, _ := runIn(t, bare, "", "rev-parse", "--verify", "-q", name)
+		return strings.TrimSpace(stdout)
+	}
+
+	if stderr, code := push("main"); code != 0 || stderr != "To "+bare+"\n * [new branch]      main -> main\n" {
+		t.Errorf("push of a new branch: exit %v\n%v", code, stderr)
+	}
+	second := commitFile(t, work, "a", "b\n", "two")
+	if stderr, code := push("main"); code != 0 || !strings.Contains(stderr, "   "+first[:7]+".."+second[:7]+"  main -> main\n") {
+		t.Errorf("fast-forward push: exit %v\n%v", code, stderr)
+	}
+	if got := remoteRef("refs/heads/main"); got != second {
+		t.Errorf("remote main = %v, want %v", got, second)
+	}
+	if got := mygit(t, bare, "cat-file", "-p", "main:a"); got != "b\n" {
+		t.Errorf("the pushed tree has a = %q", got)
+	}
+
+	mygit(t, work, "reset", "--hard", "HEAD~1")
+	if stderr, code := push("main"); code != 1 || !strings.Contains(stderr, " ! [rejected]        main -> main (non-fast-forward)\n") {
+		t.Errorf("non-fast-forward push: exit %v\n%v", code, stderr)
+	}
+	if got := remoteRef("refs/heads/main"); got != second {
+		t.Errorf("the rejected push moved remote main to %v", got)
+	}
+	if stderr, code := push("-f", "main"); code != 0 || !strings.Contains(stderr, " + "+second[:7]+"..."+first[:7]+" main -> main (forced update)\n") {
+		t.Errorf("forced push: exit %v\n%v", code, stderr)
+	}
+
+	push("main:refs/heads/other")
+	if got := remoteRef("refs/heads/other"); got != first {
+		t.Errorf("push main:refs/heads/other made other %v", got)
+	}
+	if stderr, code := push(":other"); code != 0 || !strings.Contains(stderr, " - [deleted]         other\n") {
+		t.Errorf("push :other: exit %v\n%v", code, stderr)
+	}
+	if got := remoteRef("refs/heads/other"); got != "" {
+		t.Errorf("other survived its deletion at %v", got)
+	}
+	if stderr, code := push(":main"); code != 1 || !strings.Contains(stderr, "deletion of the current branch prohibited") {
+		t.Errorf("push deleting the remote's current branch: exit %v\n%v", code, stderr)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+	"github.com/codecrafters-io/git-starter-go/internal/pack"
+	"github.com/codecrafters-io/git-starter-go/pkg/config"
+)
+
+// receiveCommand is one ref update a client asks receive-pack for, with
+// why it was refused when it was.
+type receiveCommand struct {
+	old    string
+	new    string
+	name   string
+	reason string
+}
+
+// receivePackServer is git-receive-pack in the original protocol. It lists
+// the repository's refs, reads the client's ref updates and the pack with
+// the objects they need, then makes each update the repository allows and,
+// when asked, reports how each one went.
+func receivePackServer(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	if len(args) != 1 || strings.HasPrefix(args[0], "-") {
+		return failure.Usage("usage: git receive-pack <git-dir>")
+	}
+	if err := enterRepository(args[0]); err != nil {
+		return err
+	}
+	output := bufio.NewWriter(stdout)
+	defer output.Flush()
+
+	list, err := repository.Refs.List("refs/")
+	if err != nil {
+		return err
+	}
+	refs := make([]advertisedRef, 0, len(list))
+	for _, ref := range list {
+		refs = append(refs, advertisedRef{name: ref.Name, sha: ref.SHA})
+	}
+	writeRefAdvertisement(output, refs, []string{"report-status", "delete-refs", "ofs-delta", "object-format=" + repository.Algorithm.Name()})
+	if err := output.Flush(); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(stdin)
+	commands, requested := make([]*receiveCommand, 0), []string(nil)
+	for {
+		line, length, err := readPkt(reader)
+		if err != nil {
+			return nil
+		}
+		if length < 4 {
+			break
+		}
+		text := strings.TrimSuffix(string(line), "\n")
+		if len(commands) == 0 {
+			var capabilities string
+			text, capabilities, _ = strings.Cut(text, "\x00")
+			requested = strings.Fields(capabilities)
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 3 || len(fields[0]) != len(zeroSHA()) || len(fields[1]) != len(zeroSHA()) {
+			return failure.Fatalf("fatal: protocol error: expected old/new/ref, got '%v'", text)
+		}
+		commands = append(commands, &receiveCommand{old: fields[0], new: fields[1], name: fields[2]})
+	}
+	if len(commands) == 0 {
+		return nil
+	}
+
+	unpackStatus := "ok"
+	if slices.ContainsFunc(commands, func(command *receiveCommand) bool { return command.new != zeroSHA() }) {
+		if err := receivePack(reader); err != nil {
+			unpackStatus = err.Error()
+			fmt.Fprintf(stderr, "error: unpack failed: %v\n", err)
+		}
+	}
+	cfg, err := repository.Config()
+	if err != nil {
+		return err
+	}
+	for _, command := range commands {
+		if unpackStatus != "ok" {
+			command.reason = "unpacker error"
+			continue
+		}
+		command.reason = applyReceiveCommand(cfg, command, stderr)
+	}
+
+	if !slices.Contains(requested, "report-status") {
+		return nil
+	}
+	io.WriteString(output, pktLine("unpack "+unpackStatus+"\n"))
+	for _, command := range commands {
+		if command.reason == "" {
+			io.WriteString(output, pktLine("ok "+command.name+"\n"))
+		} else {
+			io.WriteString(output, pktLine("ng "+command.name+" "+command.reason+"\n"))
+		}
+	}
+	io.WriteString(output, "0000")
+	return nil
+}
+
+// receivePack reads the pack that follows the commands and stores its
+// objects. Delta bases outside a thin pack are taken from the repository.
+func receivePack(reader *bufio.Reader) error {
+	data, err := pack.ReadStream(repository.Algorithm, reader, nil)
+	if err != nil {
+		return err
+	}
+	lookup := func(sha string) (*pack.Object, error) {
+		objectType, content, err := repository.ReadObject(sha)
+		if err != nil {
+			return nil, err
+		}
+		return &pack.Object{Type: objectType, Content: content}, nil
+	}
+	objects, err := pack.Unpack(repository.Algorithm, data, lookup)
+	if err != nil {
+		return err
+	}
+	for _, object := range objects {
+		if _, err := repository.WriteObject(object.Type, object.Content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyReceiveCommand makes one update unless the repository refuses it,
+// returning the reason it was refused or "". The checked-out
+// branch of a repository with a worktree is never moved unless
+// receive.denyCurrentBranch allows it, and the branch HEAD names is never
+// deleted unless receive.denyDeleteCurrent does.
+func applyReceiveCommand(cfg *config.Config, command *receiveCommand, stderr io.Writer) string {
+	if !strings.HasPrefix(command.name, "refs/") || checkRefName(command.name) != nil {
+		fmt.Fprintf(stderr, "error: refusing to create funny ref '%v' remotely\n", command.name)
+		return "funny refname"
+	}
+	headRef, _, _ := readHeadSymref()
+	if command.new != zeroSHA() {
+		if repository.WorkTree != "" && command.name == headRef {
+			switch deny, _ := cfg.Get("receive.denyCurrentBranch"); deny {
+			case "ignore", "false":
+			case "warn":
+				fmt.Fprintf(stderr, "warning: updating the current branch\n")
+			default:
+				fmt.Fprintf(stderr, "error: refusing to update checked out branch: %v\n", command.name)
+				return "branch is currently checked out"
+			}
+		}
+		if !repository.HasObject(command.new) {
+			fmt.Fprintf(stderr, "error: unpack should have generated %v, but I can't find it!\n", command.new)
+			return "bad pack"
+		}
+	} else {
+		if deny, _ := cfg.Get("receive.denyDeletes"); deny == "true" {
+			fmt.Fprintf(stderr, "error: denying ref deletion for %v\n", command.name)
+			return "deletion prohibited"
+		}
+		if deny, _ := cfg.Get("receive.denyDeleteCurrent"); command.name == headRef && deny != "ignore" && deny != "false" && deny != "warn" {
+			fmt.Fprintf(stderr, "error: refusing to delete the current branch: %v\n", command.name)
+			return "deletion of the current branch prohibited"
+		}
+	}
+	if deny, _ := cfg.Get("receive.denyNonFastForwards"); deny == "true" && command.old != zeroSHA() && command.new != zeroSHA() {
+		if fastForward, err := isAncestor(command.old, command.new); err != nil || !fastForward {
+			fmt.Fprintf(stderr, "error: denying non-fast-forward %v (you should pull first)\n", command.name)
+			return "non-fast-forward"
+		}
+	}
+
+	_, current, err := repository.Refs.Resolve(command.name)
+	if err != nil {
+		current = zeroSHA()
+	}
+	if current != command.old {
+		fmt.Fprintf(stderr, "error: cannot lock ref '%v': is at %v but expected %v\n", command.name, current, command.old)
+		return "failed to update ref"
+	}
+	if command.new == zeroSHA() {
+		err = repository.Refs.Delete(command.name)
+	} else {
+		err = writeRef(command.name, command.new, "push")
+	}
+	if err != nil {
+		// Failing one ref does not stop the others being updated.
+		fmt.Fprintf(stderr, "error: %v\n", strings.TrimPrefix(err.Error(), "fatal: "))
+		return "failed to update ref"
+	}
+	return ""
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestBareRepositoryServesGit(t *testing.T) {
+	requireGit(t)
+	base := setupTest(t)
+	bare := filepath.Join(base, "bare.git")
+	mygit(t, base, "init", "--bare", bare)
+	for _, name := range []string{"HEAD", "config", "objects", "refs"} {
+		if _, err := os.Stat(filepath.Join(bare, name)); err != nil {
+			t.Errorf("the bare repository has no %v: %v", name, err)
+		}
+	}
+	if got := runGit(t, bare, "rev-parse", "--is-bare-repository"); got != "true\n" {
+		t.Errorf("git rev-parse --is-bare-repository = %q", got)
+	}
+	program, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// git's client against our upload-pack and receive-pack.
+	work := filepath.Join(base, "work")
+	runGit(t, base, "init", "-q", "-b", "main", work)
+	writeFile(t, work, "a", "a\n")
+	runGit(t, work, "add", "a")
+	runGit(t, work, "commit", "-q", "-m", "one")
+	runGit(t, work, "push", "-q", "--receive-pack="+program+" receive-pack", "file://"+bare, "main")
+	if got, want := mygit(t, bare, "rev-parse", "main"), runGit(t, work, "rev-parse", "main"); got != want {
+		t.Errorf("main after git pushed = %v, want %v", got, want)
+	}
+	runGit(t, base, "clone", "-q", "--upload-pack="+program+" upload-pack", "file://"+bare, "clone")
+	if got, err := os.ReadFile(filepath.Join(base, "clone", "a")); err != nil || string(got) != "a\n" {
+		t.Errorf("a in git's clone = %q, %v", got, err)
+	}
+	if got := runGit(t, bare, "fsck", "--strict"); got != "" {
+		t.Errorf("git fsck after the push:\n%v", got)
+	}
+
+	// And over git:// from our daemon.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+	listener.Close()
+	daemon := exec.Command(program, "daemon", "--listen=127.0.0.1", "--port="+port, "--base-path="+base, "--export-all", "--enable=receive-pack")
+	if err := daemon.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		daemon.Process.Kill()
+		daemon.Wait()
+	})
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		conn, err := net.Dial("tcp", "127.0.0.1:"+port)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the daemon never listened: %v", err)
+		}
+	}
+	url := "git://127.0.0.1:" + port + "/bare.git"
+	runGit(t, base, "clone", "-q", url, "daemon-clone")
+	clone := filepath.Join(base, "daemon-clone")
+	writeFile(t, clone, "b", "b\n")
+	runGit(t, clone, "add", "b")
+	runGit(t, clone, "commit", "-q", "-m", "two")
+	runGit(t, clone, "push", "-q", "origin", "main")
+	if got, want := mygit(t, bare, "rev-parse", "main"), runGit(t, clone, "rev-parse", "main"); got != want {
+		t.Errorf("main after pushing over git:// = %v, want %v", got, want)
+	}
+	if got := mygit(t, bare, "cat-file", "-p", "main:b"); got != "b\n" {
+		t.Errorf("main:b = %q", got)
+	}
+}
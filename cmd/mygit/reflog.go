@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+	"github.com/codecrafters-io/git-starter-go/pkg/refs"
+)
+
+// writeRef points name at sha and records the move in its reflog. Moving
+// the checked-out branch is logged for HEAD as well.
+func writeRef(name string, sha string, message string) error {
+	_, oldSHA, err := repository.Refs.Resolve(name)
+	if err != nil {
+		oldSHA = ""
+	}
+	if err := repository.Refs.Write(name, sha); err != nil {
+		return err
+	}
+	if err := logRefUpdate(name, oldSHA, sha, message); err != nil {
+		return err
+	}
+	if headRef, isSymref, err := readHeadSymref(); err == nil && isSymref && headRef == name {
+		return logRefUpdate("HEAD", oldSHA, sha, message)
+	}
+	return nil
+}
+
+// logRefUpdate appends an entry to the reflog of name when the ref keeps
+// one: it already has a log, or core.logAllRefUpdates asks for it, which by
+// default in a repository with a work tree covers HEAD, branches,
+// remote-tracking branches and notes.
+func logRefUpdate(name string, oldSHA string, newSHA string, message string) error {
+	if !repository.Refs.HasLog(name) {
+		cfg, err := repository.Config()
+		if err != nil {
+			return err
+		}
+		logAll, ok := cfg.Get("core.logAllRefUpdates")
+		if !ok && repository.WorkTree != "" {
+			logAll = "true"
+		}
+		switch logAll {
+		case "always":
+		case "true":
+			if name != "HEAD" && !hasAnyPrefix(name, []string{"refs/heads/", "refs/remotes/", "refs/notes/"}) {
+				return nil
+			}
+		default:
+			return nil
+		}
+	}
+	identity, err := committerIdentity()
+	if err != nil {
+		return err
+	}
+	if oldSHA == "" {
+		oldSHA = zeroSHA()
+	}
+	if newSHA == "" {
+		newSHA = zeroSHA()
+	}
+	return repository.Refs.AppendLog(name, refs.LogEntry{Old: oldSHA, New: newSHA, Identity: identity, Message: message})
+}
+
+// reflog lists the entries of a reflog newest first as
+// "<sha> <ref>@{<n>}: <message>", by default those of HEAD. "exists" checks
+// whether a ref has a reflog.
+func reflog(args []string, stdout io.Writer) error {
+	if len(args) > 0 && args[0] == "exists" {
+		if len(args) != 2 {
+			return failure.Usage("usage: git reflog exists <ref>")
+		}
+		if !repository.Refs.HasLog(args[1]) {
+			return errSilentFailure
+		}
+		return nil
+	}
+	if len(args) > 0 && args[0] == "show" {
+		args = args[1:]
+	}
+	if len(args) > 1 || len(args) == 1 && strings.HasPrefix(args[0], "-") {
+		return failure.Usage("usage: git reflog [show] [<ref>]\n   or: git reflog exists <ref>")
+	}
+	name := "HEAD"
+	if len(args) == 1 {
+		name = args[0]
+	}
+
+	display, logName, ok := findReflog(name)
+	if !ok {
+		if _, err := resolveRevision(name); err != nil {
+			return failure.Fatalf("fatal: ambiguous argument '%v': unknown revision or path not in the working tree.\nUse '--' to separate paths from revisions, like this:\n'git <command> [<revision>...] -- [<file>...]'", name)
+		}
+		return nil
+	}
+	entries, err := repository.Refs.ReadLog(logName)
+	if err != nil {
+		return err
+	}
+	output := bufio.NewWriter(stdout)
+	defer output.Flush()
+	for index := len(entries) - 1; index >= 0; index-- {
+		short, err := abbreviateSHA(entries[index].New, 7)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(output, "%v %v@{%v}: %v\n", short, display, len(entries)-1-index, entries[index].Message)
+	}
+	return nil
+}
+
+// findReflog finds the reflog a ref name refers to. A name that
+// names a log directly or as refs/<name> or refs/heads/<name> is shown as
+// given, and any other ref whose log is found is shown by its full name.
+func findReflog(name string) (string, string, bool) {
+	if name == "@" {
+		name = "HEAD"
+	}
+	for _, candidate := range []string{name, "refs/" + name, "refs/heads/" + name} {
+		if repository.Refs.HasLog(candidate) {
+			return name, candidate, true
+		}
+	}
+	for _, candidate := range []string{"refs/tags/" + name, "refs/remotes/" + name, "refs/remotes/" + name + "/HEAD"} {
+		if repository.Refs.HasLog(candidate) {
+			return candidate, candidate, true
+		}
+	}
+	return "", "", false
+}
+
+// resolveReflogRevision resolves "<ref>@{<n>}", the value ref had n moves
+// ago, or "<ref>@{<date>}", the value it had then. Without a ref it means
+// the checked-out branch.
+func resolveReflogRevision(name string, selector string) (string, error) {
+	count, err := strconv.Atoi(selector)
+	var date time.Time
+	if err != nil {
+		if date, err = parseExpiry(selector, time.Now()); err != nil || date.IsZero() {
+			return "", fmt.Errorf("Not a valid object name %v@{%v}", name, selector)
+		}
+	} else if count < 0 {
+		return "", fmt.Errorf("Not a valid object name %v@{%v}", name, selector)
+	}
+	if name == "" {
+		headRef, isSymref, err := readHeadSymref()
+		if err != nil {
+			return "", err
+		}
+		name = "HEAD"
+		if isSymref {
+			name = headRef
+		}
+	}
+	_, logName, ok := findReflog(name)
+	if !ok {
+		return "", fmt.Errorf("Not a valid object name %v@{%v}", name, selector)
+	}
+	entries, err := repository.Refs.ReadLog(logName)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case len(entries) == 0:
+		return "", failure.Fatalf("fatal: log for %v is empty", name)
+	case !date.IsZero():
+		for index := len(entries) - 1; index >= 0; index-- {
+			if !parseSignature(entries[index].Identity).when.After(date) {
+				return entries[index].New, nil
+			}
+		}
+		// Before the log began the ref held what its first entry moved from.
+		if entries[0].Old != zeroSHA() {
+			return entries[0].Old, nil
+		}
+		return entries[0].New, nil
+	case count < len(entries):
+		return entries[len(entries)-1-count].New, nil
+	case count == len(entries) && entries[0].Old != zeroSHA():
+		// One step past the oldest entry is where that entry moved from.
+		return entries[0].Old, nil
+	default:
+		return "", failure.Fatalf("fatal: log for '%v' only has %v entries", strings.TrimPrefix(name, "refs/heads/"), len(entries))
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReflogMatchesGit(t *testing.T) {
+	requireGit(t)
+	base := setupTest(t)
+	ours, theirs := filepath.Join(base, "ours"), filepath.Join(base, "theirs")
+	mygit(t, base, "init", ours)
+	runGit(t, base, "init", "-q", "-b", "main", theirs)
+
+	// The same history made by each, so that the commits are the same.
+	for _, step := range [][]string{
+		{"add", "f"},
+		{"commit", "-m", "one"},
+		{"branch", "side"},
+		{"checkout", "side"},
+		{"add", "g"},
+		{"commit", "-m", "two"},
+		{"checkout", "main"},
+		{"merge", "side"},
+		{"reset", "--hard", "HEAD~1"},
+		{"add", "h"},
+		{"commit", "-m", "three"},
+		{"merge", "-m", "merged", "side"},
+		{"checkout", "HEAD~1"},
+		{"checkout", "main"},
+	} {
+		if step[0] == "add" {
+			writeFile(t, ours, step[1], step[1]+"\n")
+			writeFile(t, theirs, step[1], step[1]+"\n")
+		}
+		mygit(t, ours, step...)
+		runGit(t, theirs, step...)
+	}
+
+	for _, args := range [][]string{
+		{"reflog"},
+		{"reflog", "show", "main"},
+		{"reflog", "show", "side"},
+		{"rev-parse", "HEAD@{0}", "HEAD@{3}", "main@{1}", "@{2}"},
+	} {
+		if got, want := mygit(t, ours, args...), runGit(t, theirs, args...); got != want {
+			t.Errorf("mygit %v:\n%v\ngit:\n%v", strings.Join(args, " "), got, want)
+		}
+	}
+	// And git reads what mygit logged as mygit does.
+	if got, want := mygit(t, ours, "reflog"), runGit(t, ours, "reflog"); got != want {
+		t.Errorf("mygit reflog:\n%v\ngit reflog of mygit's logs:\n%v", got, want)
+	}
+	if _, stderr, code := runIn(t, ours, "", "rev-parse", "side@{5}"); code != 128 || !strings.Contains(stderr, "log for 'side' only has 2 entries") {
+		t.Errorf("rev-parse past the end of the log: exit %v\n%v", code, stderr)
+	}
+	if _, err := os.Stat(filepath.Join(ours, ".git", "logs", "refs", "heads", "side")); err != nil {
+		t.Errorf("no log for side: %v", err)
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+)
+
+// readHeadSymref returns the ref HEAD points at, or false when HEAD is detached.
+func readHeadSymref() (string, bool, error) {
+	head, err := repository.Refs.Read("HEAD")
+	if err != nil {
+		return "", false, fmt.Errorf("Error reading file .git/HEAD: %w", err)
+	}
+	if !strings.HasPrefix(head, "ref: ") {
+		return "", false, nil
+	}
+	return strings.TrimPrefix(head, "ref: "), true, nil
+}
+
+// resolveHead returns the commit HEAD points at, or "" on an unborn branch.
+func resolveHead() (string, error) {
+	if _, err := repository.Refs.Read("HEAD"); err != nil {
+		return "", fmt.Errorf("Error reading file .git/HEAD: %w", err)
+	}
+	_, sha, err := repository.Refs.Resolve("HEAD")
+	if err != nil {
+		return "", nil
+	}
+	return sha, nil
+}
+
+// checkRefName applies the main git check-ref-format rules to a ref or branch name.
+func checkRefName(name string) error {
+	if !validRefName(name) {
+		return failure.Fatalf("fatal: '%v' is not a valid branch name", name)
+	}
+	return nil
+}
+
+// validRefName reports whether name passes the check-ref-format rules.
+func validRefName(name string) bool {
+	invalid := name == "" || name == "@" || strings.HasPrefix(name, "-") || strings.HasPrefix(name, "/") ||
+		strings.HasSuffix(name, "/") || strings.HasSuffix(name, ".") || strings.HasSuffix(name, ".lock") ||
+		strings.Contains(name, "..") || strings.Contains(name, "//") || strings.Contains(name, "@{") ||
+		strings.ContainsAny(name, " ~^:?*[\\\x7f")
+	for _, component := range strings.Split(name, "/") {
+		if strings.HasPrefix(component, ".") {
+			invalid = true
+		}
+	}
+	for _, c := range name {
+		if c < 0x20 {
+			invalid = true
+		}
+	}
+	return !invalid
+}
+
+// isAncestor reports whether ancestor is reachable from descendant.
+func isAncestor(ancestor string, descendant string) (bool, error) {
+	found := false
+	err := walkParents([]string{descendant}, func(sha string) bool {
+		found = sha == ancestor
+		return !found
+	})
+	return found, err
+}
+
+func branch(args []string, stdout io.Writer) error {
+	deleteMode, forceDelete := false, false
+	names := make([]string, 0, 2)
+	for _, arg := range args {
+		switch arg {
+		case "-d", "--delete":
+			deleteMode = true
+		case "-D":
+			deleteMode, forceDelete = true, true
+		case "-l", "--list":
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return failure.Usage("usage: branch [-d | -D] [<name> [<start-point>]]")
+			}
+			names = append(names, arg)
+		}
+	}
+
+	currentRef, isSymref, err := readHeadSymref()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case deleteMode:
+		if len(names) == 0 {
+			return failure.Fatal("fatal: branch name required")
+		}
+		headSHA, err := resolveHead()
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			refName := "refs/heads/" + name
+			if isSymref && currentRef == refName {
+				return fmt.Errorf("error: Cannot delete branch '%v' checked out at '%v'", name, repository.WorkTree)
+			}
+			sha, err := repository.Refs.Read(refName)
+			if err != nil {
+				return fmt.Errorf("error: branch '%v' not found.", name)
+			}
+			if !forceDelete && headSHA != "" {
+				merged, err := isAncestor(sha, headSHA)
+				if err != nil {
+					return err
+				}
+				if !merged {
+					return fmt.Errorf("error: The branch '%v' is not fully merged.\nIf you are sure you want to delete it, run 'git branch -D %v'.", name, name)
+				}
+			}
+			if err := repository.Refs.Delete(refName); err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "Deleted branch %v (was %v).\n", name, sha[:7])
+		}
+		return nil
+
+	case len(names) == 0:
+		branches, err := repository.Refs.List("refs/heads/")
+		if err != nil {
+			return err
+		}
+		if !isSymref {
+			headSHA, err := resolveHead()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "* (HEAD detached at %v)\n", headSHA[:7])
+		}
+		for _, ref := range branches {
+			marker := " "
+			if isSymref && ref.Name == currentRef {
+				marker = "*"
+			}
+			fmt.Fprintf(stdout, "%v %v\n", marker, strings.TrimPrefix(ref.Name, "refs/heads/"))
+		}
+		return nil
+
+	case len(names) <= 2:
+		name := names[0]
+		if err := checkRefName(name); err != nil {
+			return err
+		}
+		refName := "refs/heads/" + name
+		if _, err := repository.Refs.Read(refName); err == nil {
+			return failure.Fatalf("fatal: a branch named '%v' already exists", name)
+		}
+		startSHA, err := resolveHead()
+		if err != nil {
+			return err
+		}
+		startName := "HEAD"
+		if isSymref {
+			startName = strings.TrimPrefix(currentRef, "refs/heads/")
+		}
+		if len(names) == 2 {
+			startName = names[1]
+			if startSHA, err = resolveRevision(names[1]); err == nil {
+				startSHA, err = peelObject(startSHA, "commit")
+			}
+			if err != nil {
+				return failure.Fatalf("fatal: not a valid object name: '%v'", names[1])
+			}
+		}
+		if startSHA == "" {
+			return failure.Fatalf("fatal: not a valid object name: '%v'", strings.TrimPrefix(currentRef, "refs/heads/"))
+		}
+		return writeRef(refName, startSHA, "branch: Created from "+startName)
+
+	default:
+		return failure.Usage("usage: branch [-d | -D] [<name> [<start-point>]]")
+	}
+}
+
+func updateRef(args []string) error {
+	deleteMode, noDeref := false, false
+	message := ""
+	positional := make([]string, 0, 3)
+	for index := 0; index < len(args); index++ {
+		switch arg := args[index]; {
+		case arg == "-d":
+			deleteMode = true
+		case arg == "--no-deref":
+			noDeref = true
+		case arg == "-m" && index+1 < len(args):
+			index++
+			message = args[index]
+		default:
+			positional = append(positional, arg)
+		}
+	}
+	if (deleteMode && (len(positional) < 1 || len(positional) > 2)) || (!deleteMode && (len(positional) < 2 || len(positional) > 3)) {
+		return failure.Usage("usage: update-ref [-m <reason>] [--no-deref] (-d <ref> [<old-value>] | <ref> <new-value> [<old-value>])")
+	}
+
+	name := positional[0]
+	if !noDeref {
+		if target, ok := repository.Refs.ReadSymbolic(name); ok {
+			name, _, _ = repository.Refs.Resolve(target)
+		}
+	}
+	current, _ := repository.Refs.Read(name)
+	oldValueIndex := 2
+	if deleteMode {
+		oldValueIndex = 1
+	}
+	if len(positional) > oldValueIndex {
+		expected := positional[oldValueIndex]
+		if strings.Trim(expected, "0") == "" {
+			expected = ""
+		} else if sha, err := resolveRevision(expected); err == nil {
+			expected = sha
+		}
+		switch {
+		case current == expected:
+		case current == "":
+			return failure.Fatalf("fatal: cannot lock ref '%v': unable to resolve reference '%v'", name, name)
+		case expected == "":
+			return failure.Fatalf("fatal: cannot lock ref '%v': reference already exists", name)
+		default:
+			return failure.Fatalf("fatal: cannot lock ref '%v': is at %v but expected %v", name, current, expected)
+		}
+	}
+
+	if deleteMode {
+		return repository.Refs.Delete(name)
+	}
+	newValue, err := resolveRevision(positional[1])
+	if err != nil {
+		return failure.Fatalf("fatal: %v: not a valid SHA1", positional[1])
+	}
+	return writeRef(name, newValue, message)
+}
+
+func symbolicRef(args []string, stdout io.Writer) error {
+	short, deleteMode := false, false
+	positional := make([]string, 0, 2)
+	for _, arg := range args {
+		switch arg {
+		case "--short":
+			short = true
+		case "-d", "--delete":
+			deleteMode = true
+		case "-q", "--quiet":
+		default:
+			positional = append(positional, arg)
+		}
+	}
+
+	switch {
+	case deleteMode && len(positional) == 1:
+		if _, ok := repository.Refs.ReadSymbolic(positional[0]); !ok {
+			return failure.Fatalf("fatal: Cannot delete %v, not a symbolic ref", positional[0])
+		}
+		return os.Remove(repository.Path(positional[0]))
+	case len(positional) == 1:
+		target, ok := repository.Refs.ReadSymbolic(positional[0])
+		if !ok {
+			return failure.Fatalf("fatal: ref %v is not a symbolic ref", positional[0])
+		}
+		if short {
+			target = shortRefName(target)
+		}
+		fmt.Fprintln(stdout, target)
+		return nil
+	case len(positional) == 2:
+		if !strings.HasPrefix(positional[1], "refs/") {
+			return failure.Fatalf("fatal: Refusing to point %v outside of refs/", positional[0])
+		}
+		return repository.Refs.Write(positional[0], "ref: "+positional[1])
+	default:
+		return failure.Usage("usage: symbolic-ref [--short] <name> [<ref>] | symbolic-ref -d <name>")
+	}
+}
+
+func shortRefName(name string) string {
+	for _, prefix := range []string{"refs/heads/", "refs/tags/", "refs/remotes/", "refs/"} {
+		if strings.HasPrefix(name, prefix) {
+			return strings.TrimPrefix(name, prefix)
+		}
+	}
+	return name
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBranchCreatesListsAndDeletes(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	first := commitFile(t, dir, "a", "a\n", "one")
+	mygit(t, dir, "branch", "topic")
+	mygit(t, dir, "checkout", "topic")
+	commitFile(t, dir, "a", "b\n", "two")
+	mygit(t, dir, "checkout", "main")
+	mygit(t, dir, "branch", "old", first)
+
+	if got := mygit(t, dir, "branch"); got != "* main\n  old\n  topic\n" {
+		t.Errorf("branch:\n%v", got)
+	}
+	if _, stderr, code := runIn(t, dir, "", "branch", "topic"); code != 128 || !strings.Contains(stderr, "a branch named 'topic' already exists") {
+		t.Errorf("branch of an existing name: exit %v\n%v", code, stderr)
+	}
+	if _, stderr, code := runIn(t, dir, "", "branch", "-d", "topic"); code != 1 || !strings.Contains(stderr, "The branch 'topic' is not fully merged.") {
+		t.Errorf("branch -d of an unmerged branch: exit %v\n%v", code, stderr)
+	}
+	if got := mygit(t, dir, "branch", "-d", "old"); got != "Deleted branch old (was "+first[:7]+").\n" {
+		t.Errorf("branch -d old printed %q", got)
+	}
+	mygit(t, dir, "branch", "-D", "topic")
+	if got := mygit(t, dir, "branch"); got != "* main\n" {
+		t.Errorf("branch after deleting:\n%v", got)
+	}
+}
+
+func TestUpdateRefChecksTheOldValue(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	first := commitFile(t, dir, "a", "a\n", "one")
+	second := commitFile(t, dir, "a", "b\n", "two")
+	zero := strings.Repeat("0", len(first))
+
+	if _, stderr, code := runIn(t, dir, "", "update-ref", "refs/heads/x", first, second); code != 128 || !strings.Contains(stderr, "unable to resolve reference 'refs/heads/x'") {
+		t.Errorf("update-ref expecting a missing ref to have a value: exit %v\n%v", code, stderr)
+	}
+	mygit(t, dir, "update-ref", "refs/heads/x", first, zero)
+	if _, stderr, code := runIn(t, dir, "", "update-ref", "refs/heads/x", second, zero); code != 128 || !strings.Contains(stderr, "reference already exists") {
+		t.Errorf("update-ref expecting an existing ref to be missing: exit %v\n%v", code, stderr)
+	}
+	if _, stderr, code := runIn(t, dir, "", "update-ref", "refs/heads/x", second, second); code != 128 || !strings.Contains(stderr, "is at "+first+" but expected "+second) {
+		t.Errorf("update-ref with the wrong old value: exit %v\n%v", code, stderr)
+	}
+	// The old value may be any revision.
+	mygit(t, dir, "update-ref", "refs/heads/x", second, "main~1")
+	if got := strings.TrimSpace(mygit(t, dir, "rev-parse", "x")); got != second {
+		t.Errorf("x = %v, want %v", got, second)
+	}
+
+	// Through a symbolic ref the update lands on its target.
+	mygit(t, dir, "symbolic-ref", "refs/heads/sym", "refs/heads/x")
+	if got := mygit(t, dir, "symbolic-ref", "refs/heads/sym"); got != "refs/heads/x\n" {
+		t.Errorf("symbolic-ref refs/heads/sym = %q", got)
+	}
+	mygit(t, dir, "update-ref", "refs/heads/sym", first)
+	if got := strings.TrimSpace(mygit(t, dir, "rev-parse", "x")); got != first {
+		t.Errorf("x after updating sym = %v, want %v", got, first)
+	}
+
+	mygit(t, dir, "update-ref", "-d", "refs/heads/x", first)
+	if _, _, code := runIn(t, dir, "", "rev-parse", "--verify", "-q", "refs/heads/x"); code == 0 {
+		t.Error("refs/heads/x survived update-ref -d")
+	}
+}
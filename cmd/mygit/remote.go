@@ -0,0 +1,688 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+	"github.com/codecrafters-io/git-starter-go/pkg/config"
+	"github.com/codecrafters-io/git-starter-go/pkg/refs"
+)
+
+const remoteUsage = "usage: git remote [-v | --verbose]\n   or: git remote add [-t <branch>] [-m <master>] [-f] <name> <url>\n   or: git remote rename <old> <new>\n   or: git remote remove <name>\n   or: git remote show [-n] <name>"
+
+// remoteCommand manages the remotes recorded in .git/config. Without a
+// subcommand it lists their names, with -v their fetch and push URLs.
+func remoteCommand(ctx context.Context, args []string, stdout io.Writer, stderr io.Writer) error {
+	verbose := false
+	for len(args) > 0 && (args[0] == "-v" || args[0] == "--verbose") {
+		verbose, args = true, args[1:]
+	}
+	if len(args) == 0 {
+		return listRemotes(verbose, stdout)
+	}
+	switch args[0] {
+	case "add":
+		return remoteAdd(ctx, args[1:], stdout, stderr)
+	case "remove", "rm":
+		if len(args) != 2 {
+			return failure.Usage("usage: git remote remove <name>")
+		}
+		return remoteRemove(args[1])
+	case "rename":
+		if len(args) != 3 {
+			return failure.Usage("usage: git remote rename <old> <new>")
+		}
+		return remoteRename(args[1], args[2], stderr)
+	case "show":
+		noQuery := false
+		names := make([]string, 0, len(args)-1)
+		for _, arg := range args[1:] {
+			if arg == "-n" {
+				noQuery = true
+			} else {
+				names = append(names, arg)
+			}
+		}
+		if len(names) == 0 {
+			return listRemotes(verbose, stdout)
+		}
+		return remoteShow(ctx, names, noQuery, stdout, stderr)
+	default:
+		return failure.Usage(remoteUsage)
+	}
+}
+
+// remoteNames returns the names of the configured remotes, sorted.
+func remoteNames(cfg *config.Config) []string {
+	names := make([]string, 0)
+	for _, entry := range cfg.Entries {
+		if entry.Section == "remote" && entry.Subsection != "" && !slices.Contains(names, entry.Subsection) {
+			names = append(names, entry.Subsection)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+func listRemotes(verbose bool, stdout io.Writer) error {
+	cfg, err := repository.Config()
+	if err != nil {
+		return err
+	}
+	output := bufio.NewWriter(stdout)
+	defer output.Flush()
+	for _, name := range remoteNames(cfg) {
+		if !verbose {
+			fmt.Fprintln(output, name)
+			continue
+		}
+		for _, url := range cfg.GetAll("remote." + name + ".url") {
+			fmt.Fprintf(output, "%v\t%v (fetch)\n", name, url)
+		}
+		pushURLs := cfg.GetAll("remote." + name + ".pushurl")
+		if len(pushURLs) == 0 {
+			pushURLs = cfg.GetAll("remote." + name + ".url")
+		}
+		for _, url := range pushURLs {
+			fmt.Fprintf(output, "%v\t%v (push)\n", name, url)
+		}
+	}
+	return nil
+}
+
+// remoteAdd records a remote's URL and a refspec fetching its branches, all
+// of them or those named with -t, into refs/remotes/<name>/. -m points
+// refs/remotes/<name>/HEAD at a branch and -f fetches straight away.
+func remoteAdd(ctx context.Context, args []string, stdout io.Writer, stderr io.Writer) error {
+	fetchNow, master := false, ""
+	branches := make([]string, 0)
+	positional := make([]string, 0, 2)
+	for index := 0; index < len(args); index++ {
+		switch arg := args[index]; {
+		case arg == "-f" || arg == "--fetch":
+			fetchNow = true
+		case (arg == "-t" || arg == "--track") && index+1 < len(args):
+			index++
+			branches = append(branches, args[index])
+		case (arg == "-m" || arg == "--master") && index+1 < len(args):
+			index++
+			master = args[index]
+		case strings.HasPrefix(arg, "-"):
+			return failure.Usage("usage: git remote add [<options>] <name> <url>")
+		default:
+			positional = append(positional, arg)
+		}
+	}
+	if len(positional) != 2 {
+		return failure.Usage("usage: git remote add [<options>] <name> <url>")
+	}
+	name, url := positional[0], positional[1]
+	if checkRefName("refs/remotes/"+name+"/test") != nil {
+		return failure.Fatalf("fatal: '%v' is not a valid remote name", name)
+	}
+	cfg, err := repository.Config()
+	if err != nil {
+		return err
+	}
+	if slices.Contains(remoteNames(cfg), name) {
+		return fmt.Errorf("error: remote %v already exists.", name)
+	}
+
+	configPath := repository.Path("config")
+	if err := config.Set(configPath, "remote."+name+".url", url); err != nil {
+		return err
+	}
+	if len(branches) == 0 {
+		branches = append(branches, "*")
+	}
+	for _, branch := range branches {
+		spec := fmt.Sprintf("+refs/heads/%v:refs/remotes/%v/%v", branch, name, branch)
+		if err := config.Add(configPath, "remote."+name+".fetch", spec); err != nil {
+			return err
+		}
+	}
+	if fetchNow {
+		fmt.Fprintf(stdout, "Updating %v\n", name)
+		if err := fetch(ctx, []string{name}, stderr); err != nil {
+			return err
+		}
+	}
+	if master != "" {
+		if err := repository.Refs.Write("refs/remotes/"+name+"/HEAD", "ref: refs/remotes/"+name+"/"+master); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remoteRemove forgets a remote: its config section, its remote-tracking
+// refs and the branch settings that pull from or push to it.
+func remoteRemove(name string) error {
+	cfg, err := repository.Config()
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(remoteNames(cfg), name) {
+		return fmt.Errorf("error: No such remote: '%v'", name)
+	}
+	refspecs, err := fetchRefspecs(cfg, name)
+	if err != nil {
+		return err
+	}
+	tracking, err := trackingRefs(refspecs, true)
+	if err != nil {
+		return err
+	}
+
+	configPath := repository.Path("config")
+	for _, entry := range cfg.Entries {
+		if entry.Section != "branch" || entry.Value != name || entry.Key != "remote" && entry.Key != "pushremote" {
+			continue
+		}
+		keys := []string{"pushremote"}
+		if entry.Key == "remote" {
+			keys = []string{"remote", "merge"}
+		}
+		for _, key := range keys {
+			if err := config.Unset(configPath, "branch."+entry.Subsection+"."+key, true); err != nil && !errors.Is(err, config.ErrNotSet) {
+				return err
+			}
+		}
+	}
+	if pushDefault, _ := cfg.Get("remote.pushDefault"); pushDefault == name {
+		if err := config.Unset(configPath, "remote.pushDefault", true); err != nil && !errors.Is(err, config.ErrNotSet) {
+			return err
+		}
+	}
+	for _, ref := range tracking {
+		if err := repository.Refs.Delete(ref); err != nil {
+			return err
+		}
+	}
+	if err := config.RemoveSection(configPath, "remote."+name); err != nil && !errors.Is(err, config.ErrNoSection) {
+		return err
+	}
+	return nil
+}
+
+// remoteRename moves a remote's config section, its default fetch refspecs
+// and remote-tracking refs, and the branches that use it, to a new name.
+func remoteRename(oldName string, newName string, stderr io.Writer) error {
+	cfg, err := repository.Config()
+	if err != nil {
+		return err
+	}
+	names := remoteNames(cfg)
+	if !slices.Contains(names, oldName) {
+		return fmt.Errorf("error: No such remote: '%v'", oldName)
+	}
+	if oldName == newName {
+		return nil
+	}
+	if checkRefName("refs/remotes/"+newName+"/test") != nil {
+		return failure.Fatalf("fatal: '%v' is not a valid remote name", newName)
+	}
+	if slices.Contains(names, newName) {
+		return fmt.Errorf("error: remote %v already exists.", newName)
+	}
+	refspecs, err := fetchRefspecs(cfg, oldName)
+	if err != nil {
+		return err
+	}
+	tracking, err := trackingRefs(refspecs, true)
+	if err != nil {
+		return err
+	}
+
+	configPath := repository.Path("config")
+	if err := config.RenameSection(configPath, "remote."+oldName, "remote."+newName); err != nil {
+		return err
+	}
+	// Only refspecs storing into refs/remotes/<old>/ follow the rename.
+	specs := cfg.GetAll("remote." + oldName + ".fetch")
+	if len(specs) > 0 {
+		if err := config.Unset(configPath, "remote."+newName+".fetch", true); err != nil {
+			return err
+		}
+		for _, spec := range specs {
+			renamed := strings.Replace(spec, ":refs/remotes/"+oldName+"/", ":refs/remotes/"+newName+"/", 1)
+			if renamed == spec {
+				fmt.Fprintf(stderr, "warning: Not updating non-default fetch refspec\n\t%v\n\tPlease update the configuration manually if necessary.\n", spec)
+			}
+			if err := config.Add(configPath, "remote."+newName+".fetch", renamed); err != nil {
+				return err
+			}
+		}
+	}
+	for _, entry := range cfg.Entries {
+		if entry.Section == "branch" && entry.Value == oldName && (entry.Key == "remote" || entry.Key == "pushremote") {
+			if err := config.Set(configPath, "branch."+entry.Subsection+"."+entry.Key, newName); err != nil {
+				return err
+			}
+		}
+	}
+	if pushDefault, _ := cfg.Get("remote.pushDefault"); pushDefault == oldName {
+		if err := config.Set(configPath, "remote.pushDefault", newName); err != nil {
+			return err
+		}
+	}
+
+	oldPrefix, newPrefix := "refs/remotes/"+oldName+"/", "refs/remotes/"+newName+"/"
+	for _, ref := range tracking {
+		renamed, ok := strings.CutPrefix(ref, oldPrefix)
+		if !ok {
+			continue
+		}
+		value, err := repository.Refs.Read(ref)
+		if err != nil {
+			return err
+		}
+		if target, isSymref := strings.CutPrefix(value, "ref: "+oldPrefix); isSymref {
+			value = "ref: " + newPrefix + target
+		}
+		// Branches keep their history under the new name, as with git.
+		symbolic := strings.HasPrefix(value, "ref: ")
+		if !symbolic {
+			if err := repository.Refs.RenameLog(ref, newPrefix+renamed); err != nil {
+				return err
+			}
+		}
+		if err := repository.Refs.Delete(ref); err != nil {
+			return err
+		}
+		if err := repository.Refs.Write(newPrefix+renamed, value); err != nil {
+			return err
+		}
+		if !symbolic && repository.Refs.HasLog(newPrefix+renamed) {
+			if err := logRefUpdate(newPrefix+renamed, value, value, "remote: renamed "+ref+" to "+newPrefix+renamed); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func fetchRefspecs(cfg *config.Config, name string) ([]refs.Refspec, error) {
+	specs := cfg.GetAll("remote." + name + ".fetch")
+	refspecs := make([]refs.Refspec, 0, len(specs))
+	for _, spec := range specs {
+		refspec, err := refs.ParseRefspec(spec)
+		if err != nil {
+			return nil, err
+		}
+		refspecs = append(refspecs, refspec)
+	}
+	return refspecs, nil
+}
+
+// branchUpstream returns the ref a branch's upstream is tracked in: the
+// remote-tracking ref branch.<name>.merge is fetched into from
+// branch.<name>.remote, or the local branch itself for a remote of ".".
+func branchUpstream(cfg *config.Config, branch string) (string, bool) {
+	remote, hasRemote := cfg.Get("branch." + branch + ".remote")
+	merge, hasMerge := cfg.Get("branch." + branch + ".merge")
+	if !hasRemote || !hasMerge {
+		return "", false
+	}
+	if remote == "." {
+		return merge, true
+	}
+	refspecs, err := fetchRefspecs(cfg, remote)
+	if err != nil {
+		return "", false
+	}
+	for _, refspec := range refspecs {
+		if tracking, ok := refspec.Map(merge); ok && tracking != "" {
+			return tracking, true
+		}
+	}
+	return "", false
+}
+
+// trackingRefs lists the local refs the refspecs fetch into, including
+// symbolic ones such as refs/remotes/origin/HEAD when withSymrefs is set.
+func trackingRefs(refspecs []refs.Refspec, withSymrefs bool) ([]string, error) {
+	list, err := repository.Refs.List("refs/")
+	if err != nil {
+		return nil, err
+	}
+	tracking := make([]string, 0)
+	for _, ref := range list {
+		if _, isSymref := repository.Refs.ReadSymbolic(ref.Name); isSymref && !withSymrefs {
+			continue
+		}
+		if _, ok := remoteSource(refspecs, ref.Name); ok {
+			tracking = append(tracking, ref.Name)
+		}
+	}
+	return tracking, nil
+}
+
+// remoteSource maps a local ref back to the remote ref a refspec fetches
+// into it.
+func remoteSource(refspecs []refs.Refspec, local string) (string, bool) {
+	for _, refspec := range refspecs {
+		if refspec.Dst == "" {
+			continue
+		}
+		if source, ok := (refs.Refspec{Src: refspec.Dst, Dst: refspec.Src}).Map(local); ok {
+			return source, true
+		}
+	}
+	return "", false
+}
+
+// remoteShow describes each remote: its URLs, its HEAD branch and branches
+// and how they relate to the remote-tracking refs, and which local branches
+// pull from and push to it. -n skips asking the remote.
+func remoteShow(ctx context.Context, names []string, noQuery bool, stdout io.Writer, stderr io.Writer) error {
+	cfg, err := repository.Config()
+	if err != nil {
+		return err
+	}
+	output := bufio.NewWriter(stdout)
+	defer output.Flush()
+	for _, name := range names {
+		fetchURL, ok := cfg.Get("remote." + name + ".url")
+		if !ok {
+			fetchURL = "(no URL)"
+		}
+		fmt.Fprintf(output, "* remote %v\n", name)
+		fmt.Fprintf(output, "  Fetch URL: %v\n", fetchURL)
+		pushURLs := cfg.GetAll("remote." + name + ".pushurl")
+		if len(pushURLs) == 0 {
+			pushURLs = []string{fetchURL}
+		}
+		for _, url := range pushURLs {
+			fmt.Fprintf(output, "  Push  URL: %v\n", url)
+		}
+
+		refspecs, err := fetchRefspecs(cfg, name)
+		if err != nil {
+			return err
+		}
+		tracking, err := trackingRefs(refspecs, false)
+		if err != nil {
+			return err
+		}
+		var advertised []advertisedRef
+		if noQuery {
+			fmt.Fprintln(output, "  HEAD branch: (not queried)")
+		} else {
+			output.Flush()
+			connection, err := openUploadPack(ctx, strings.TrimSuffix(fetchURL, "/"), []string{"HEAD", "refs/heads/"}, stderr)
+			if err != nil {
+				return err
+			}
+			advertised = connection.refs
+			connection.close()
+			printRemoteHeads(advertised, output)
+		}
+		printRemoteBranches(name, refspecs, tracking, advertised, noQuery, output)
+		printPullBranches(cfg, name, output)
+		if err := printPushRefs(cfg, name, advertised, noQuery, output); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printRemoteHeads names the branch the remote's HEAD points at, or the
+// branches it might be when the remote does not say.
+func printRemoteHeads(advertised []advertisedRef, output io.Writer) {
+	heads := make([]string, 0, 1)
+	for _, ref := range advertised {
+		if ref.name == "HEAD" && strings.HasPrefix(ref.symref, "refs/heads/") {
+			heads = []string{strings.TrimPrefix(ref.symref, "refs/heads/")}
+			break
+		}
+		if ref.name == "HEAD" {
+			for _, branch := range advertised {
+				if strings.HasPrefix(branch.name, "refs/heads/") && branch.sha == ref.sha {
+					heads = append(heads, strings.TrimPrefix(branch.name, "refs/heads/"))
+				}
+			}
+		}
+	}
+	switch len(heads) {
+	case 0:
+		fmt.Fprintln(output, "  HEAD branch: (unknown)")
+	case 1:
+		fmt.Fprintf(output, "  HEAD branch: %v\n", heads[0])
+	default:
+		fmt.Fprintln(output, "  HEAD branch (remote HEAD is ambiguous, may be one of the following):")
+		for _, head := range heads {
+			fmt.Fprintf(output, "    %v\n", head)
+		}
+	}
+}
+
+// printRemoteBranches lists the remote's branches as tracked, new or, for
+// remote-tracking refs whose branch is gone, stale. Unqueried, it lists the
+// branches the remote-tracking refs stand for.
+func printRemoteBranches(name string, refspecs []refs.Refspec, tracking []string, advertised []advertisedRef, noQuery bool, output io.Writer) {
+	states := make(map[string]string)
+	if noQuery {
+		for _, local := range tracking {
+			source, _ := remoteSource(refspecs, local)
+			states[strings.TrimPrefix(source, "refs/heads/")] = ""
+		}
+	} else {
+		fetched := make(map[string]bool)
+		for _, ref := range advertised {
+			if ref.name == "HEAD" {
+				continue
+			}
+			for _, refspec := range refspecs {
+				local, ok := refspec.Map(ref.name)
+				if !ok {
+					continue
+				}
+				fetched[local] = true
+				state := " tracked"
+				if _, err := repository.Refs.Read(local); err != nil {
+					state = fmt.Sprintf(" new (next fetch will store in remotes/%v)", name)
+				}
+				states[strings.TrimPrefix(ref.name, "refs/heads/")] = state
+				break
+			}
+		}
+		for _, local := range tracking {
+			if !fetched[local] {
+				states[local] = " stale (use 'git remote prune' to remove)"
+			}
+		}
+	}
+	if len(states) == 0 {
+		return
+	}
+
+	branches := make([]string, 0, len(states))
+	width := 0
+	for branch := range states {
+		branches = append(branches, branch)
+		width = max(width, len(branch))
+	}
+	slices.Sort(branches)
+	header := "  Remote branch:"
+	if len(branches) > 1 {
+		header = "  Remote branches:"
+	}
+	if noQuery {
+		header += " (status not queried)"
+	}
+	fmt.Fprintln(output, header)
+	for _, branch := range branches {
+		if noQuery {
+			fmt.Fprintf(output, "    %v\n", branch)
+		} else {
+			fmt.Fprintf(output, "    %-*v%v\n", width, branch, states[branch])
+		}
+	}
+}
+
+// printPullBranches lists the local branches configured to merge from, or
+// rebase onto, a branch of the remote.
+func printPullBranches(cfg *config.Config, name string, output io.Writer) {
+	branches := make([]string, 0)
+	width, anyRebase := 0, false
+	for _, entry := range cfg.Entries {
+		if entry.Section != "branch" || entry.Key != "remote" || entry.Value != name || slices.Contains(branches, entry.Subsection) {
+			continue
+		}
+		if _, ok := cfg.Get("branch." + entry.Subsection + ".merge"); !ok {
+			continue
+		}
+		branches = append(branches, entry.Subsection)
+		width = max(width, len(entry.Subsection))
+		anyRebase = anyRebase || configRebase(cfg, entry.Subsection)
+	}
+	if len(branches) == 0 {
+		return
+	}
+	slices.Sort(branches)
+	if len(branches) == 1 {
+		fmt.Fprintln(output, "  Local branch configured for 'git pull':")
+	} else {
+		fmt.Fprintln(output, "  Local branches configured for 'git pull':")
+	}
+	for _, branch := range branches {
+		merge, _ := cfg.Get("branch." + branch + ".merge")
+		merge = strings.TrimPrefix(merge, "refs/heads/")
+		fmt.Fprintf(output, "    %-*v ", width, branch)
+		switch {
+		case configRebase(cfg, branch):
+			fmt.Fprintf(output, "rebases onto remote %v\n", merge)
+		case anyRebase:
+			fmt.Fprintf(output, " merges with remote %v\n", merge)
+		default:
+			fmt.Fprintf(output, "merges with remote %v\n", merge)
+		}
+	}
+}
+
+func configRebase(cfg *config.Config, branch string) bool {
+	rebase, _ := cfg.Get("branch." + branch + ".rebase")
+	return rebase == "true" || rebase == "merges" || rebase == "interactive"
+}
+
+// printPushRefs lists which local branches a plain push to the remote
+// updates, by its push refspecs or else by matching names, and how each
+// compares with the remote's copy.
+func printPushRefs(cfg *config.Config, name string, advertised []advertisedRef, noQuery bool, output io.Writer) error {
+	specs := cfg.GetAll("remote." + name + ".push")
+	if noQuery {
+		if len(specs) == 0 {
+			specs = []string{":"}
+		}
+		if len(specs) == 1 {
+			fmt.Fprintln(output, "  Local ref configured for 'git push' (status not queried):")
+		} else {
+			fmt.Fprintln(output, "  Local refs configured for 'git push' (status not queried):")
+		}
+		for _, spec := range specs {
+			refspec, err := refs.ParseRefspec(spec)
+			if err != nil {
+				return err
+			}
+			src, dst := shortRefName(refspec.Src), shortRefName(refspec.Dst)
+			if spec == ":" {
+				src, dst = "(matching)", "(matching)"
+			} else if dst == "" {
+				dst = src
+			}
+			if refspec.Force {
+				fmt.Fprintf(output, "    %v forces to %v\n", src, dst)
+			} else {
+				fmt.Fprintf(output, "    %v pushes to %v\n", src, dst)
+			}
+		}
+		return nil
+	}
+
+	remoteRefs := make(map[string]string, len(advertised))
+	for _, ref := range advertised {
+		remoteRefs[ref.name] = ref.sha
+	}
+	local, err := repository.Refs.List("refs/heads/")
+	if err != nil {
+		return err
+	}
+	type pushRef struct {
+		src, dst, status string
+		force            bool
+	}
+	pushes := make([]pushRef, 0)
+	for _, ref := range local {
+		if len(specs) == 0 {
+			// Matching: branches the remote has under the same name.
+			if _, ok := remoteRefs[ref.Name]; ok {
+				pushes = append(pushes, pushRef{src: ref.Name, dst: ref.Name})
+			}
+			continue
+		}
+		for _, spec := range specs {
+			refspec, err := refs.ParseRefspec(spec)
+			if err != nil {
+				return err
+			}
+			if dst, ok := refspec.Map(ref.Name); ok {
+				if dst == "" {
+					dst = ref.Name
+				}
+				pushes = append(pushes, pushRef{src: ref.Name, dst: dst, force: refspec.Force})
+				break
+			}
+		}
+	}
+	if len(pushes) == 0 {
+		return nil
+	}
+
+	width, width2 := 0, 0
+	for index := range pushes {
+		push := &pushes[index]
+		_, sha, _ := repository.Refs.Resolve(push.src)
+		remoteSHA, ok := remoteRefs[push.dst]
+		switch {
+		case !ok:
+			push.status = "create"
+		case remoteSHA == sha:
+			push.status = "up to date"
+		default:
+			push.status = "local out of date"
+			if repository.HasObject(remoteSHA) {
+				if fastForward, err := isAncestor(remoteSHA, sha); err == nil && fastForward {
+					push.status = "fast-forwardable"
+				}
+			}
+		}
+		push.src, push.dst = shortRefName(push.src), shortRefName(push.dst)
+		width, width2 = max(width, len(push.src)), max(width2, len(push.dst))
+	}
+	slices.SortFunc(pushes, func(a, b pushRef) int {
+		if a.src != b.src {
+			return strings.Compare(a.src, b.src)
+		}
+		return strings.Compare(a.dst, b.dst)
+	})
+	if len(pushes) == 1 {
+		fmt.Fprintln(output, "  Local ref configured for 'git push':")
+	} else {
+		fmt.Fprintln(output, "  Local refs configured for 'git push':")
+	}
+	for _, push := range pushes {
+		verb := "pushes to"
+		if push.force {
+			verb = "forces to"
+		}
+		fmt.Fprintf(output, "    %-*v %v %-*v (%v)\n", width, push.src, verb, width2, push.dst, push.status)
+	}
+	return nil
+}
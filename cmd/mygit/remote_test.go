@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRemoteAddRenameAndRemove(t *testing.T) {
+	base := setupTest(t)
+	source := filepath.Join(base, "source")
+	mygit(t, base, "init", source)
+	commit := commitFile(t, source, "a", "a\n", "one")
+	mygit(t, source, "branch", "dev")
+	mygit(t, base, "clone", source, "clone")
+	clone := filepath.Join(base, "clone")
+	config := func(key string) string {
+		t.Helper()
+		stdout, _, _ := runIn(t, clone, "", "config", key)
+		return strings.TrimSpace(stdout)
+	}
+
+	// A remote added by name is fetched by name with its refspec.
+	mygit(t, clone, "remote", "add", "other", source)
+	if got := config("remote.other.fetch"); got != "+refs/heads/*:refs/remotes/other/*" {
+		t.Errorf("remote.other.fetch = %q", got)
+	}
+	mygit(t, clone, "fetch", "other")
+	if got := strings.TrimSpace(mygit(t, clone, "rev-parse", "other/dev")); got != commit {
+		t.Errorf("other/dev after fetch other = %v, want %v", got, commit)
+	}
+	if got := mygit(t, clone, "remote"); got != "origin\nother\n" {
+		t.Errorf("remote:\n%v", got)
+	}
+	if got, want := mygit(t, clone, "remote", "-v"), "origin\t"+source+" (fetch)\norigin\t"+source+" (push)\nother\t"+source+" (fetch)\nother\t"+source+" (push)\n"; got != want {
+		t.Errorf("remote -v:\n%v\nwant:\n%v", got, want)
+	}
+	if _, stderr, code := runIn(t, clone, "", "remote", "add", "other", source); code == 0 || !strings.Contains(stderr, "error: remote other already exists.") {
+		t.Errorf("adding other twice: exit %v\n%v", code, stderr)
+	}
+
+	// Renaming moves the refspec, the tracking refs and the branches that
+	// follow the remote.
+	mygit(t, clone, "remote", "rename", "origin", "upstream")
+	for key, want := range map[string]string{
+		"remote.upstream.url":   source,
+		"remote.upstream.fetch": "+refs/heads/*:refs/remotes/upstream/*",
+		"branch.main.remote":    "upstream",
+		"remote.origin.url":     "",
+	} {
+		if got := config(key); got != want {
+			t.Errorf("%v after the rename = %q, want %q", key, got, want)
+		}
+	}
+	if got := strings.TrimSpace(mygit(t, clone, "rev-parse", "upstream/dev")); got != commit {
+		t.Errorf("upstream/dev after the rename = %v", got)
+	}
+	if _, err := os.Stat(filepath.Join(clone, ".git", "refs", "remotes", "origin")); err == nil {
+		t.Errorf("refs/remotes/origin survived the rename")
+	}
+	show := mygit(t, clone, "remote", "show", "upstream")
+	for _, want := range []string{"* remote upstream\n", "  HEAD branch: main\n", "    dev  tracked\n", "    main merges with remote main\n"} {
+		if !strings.Contains(show, want) {
+			t.Errorf("remote show upstream has no %q:\n%v", want, show)
+		}
+	}
+
+	mygit(t, clone, "remote", "remove", "upstream")
+	if got := config("branch.main.remote") + config("remote.upstream.url"); got != "" {
+		t.Errorf("the removed remote is still configured: %q", got)
+	}
+	if _, _, code := runIn(t, clone, "", "rev-parse", "--verify", "-q", "refs/remotes/upstream/dev"); code == 0 {
+		t.Errorf("the removed remote's tracking refs survived")
+	}
+	if _, stderr, code := runIn(t, clone, "", "remote", "remove", "upstream"); code == 0 || !strings.Contains(stderr, "error: No such remote: 'upstream'") {
+		t.Errorf("removing upstream twice: exit %v\n%v", code, stderr)
+	}
+}
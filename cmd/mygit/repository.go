@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+	"github.com/codecrafters-io/git-starter-go/pkg/repo"
+)
+
+// repository is the repository the current command operates on. Once
+// setupRepository has run, the working directory is its worktree (when there
+// is one) and workTreePrefix is the original working directory relative to
+// it, so path arguments can be mapped onto worktree paths.
+var (
+	repository     = repo.Open(".git", "")
+	workTreePrefix = ""
+)
+
+func absoluteGitDir() string {
+	dir, err := filepath.Abs(repository.GitDir)
+	if err != nil {
+		return repository.GitDir
+	}
+	return dir
+}
+
+// setupRepository locates the repository from GIT_DIR and GIT_WORK_TREE or
+// by walking up from the working directory, then moves to the top of the
+// worktree. When GIT_DIR is set without GIT_WORK_TREE the working directory
+// is taken as the top of the worktree.
+func setupRepository() error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	if envGitDir := os.Getenv("GIT_DIR"); envGitDir != "" {
+		gitDir, err := filepath.Abs(envGitDir)
+		if err != nil {
+			return err
+		}
+		if !repo.IsGitDir(gitDir) {
+			return failure.Fatalf("fatal: not a git repository: '%v'", envGitDir)
+		}
+		repository = repo.Open(gitDir, cwd)
+	} else if repository, err = repo.Discover(cwd); err != nil {
+		return err
+	}
+	workTree := repository.WorkTree
+	if envWorkTree := os.Getenv("GIT_WORK_TREE"); envWorkTree != "" {
+		if workTree, err = filepath.Abs(envWorkTree); err != nil {
+			return err
+		}
+	}
+
+	if workTree == "" {
+		return nil
+	}
+	relative, err := filepath.Rel(workTree, cwd)
+	if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		relative = "."
+	}
+	workTreePrefix = filepath.ToSlash(relative)
+	if workTreePrefix == "." {
+		workTreePrefix = ""
+	}
+	if err := os.Chdir(workTree); err != nil {
+		return err
+	}
+	gitDir := repository.GitDir
+	if gitDir == filepath.Join(workTree, ".git") {
+		gitDir = ".git"
+	}
+	repository = repo.Open(gitDir, workTree)
+	return nil
+}
+
+// worktreePath maps a path argument given relative to the original working
+// directory onto a slash-separated path relative to the top of the worktree.
+func worktreePath(arg string) (string, error) {
+	path := arg
+	if filepath.IsAbs(path) {
+		relative, err := filepath.Rel(repository.WorkTree, path)
+		if err != nil {
+			return "", err
+		}
+		path = relative
+	} else {
+		path = filepath.Join(workTreePrefix, path)
+	}
+	path = filepath.ToSlash(filepath.Clean(path))
+	if path == ".." || strings.HasPrefix(path, "../") {
+		return "", failure.Fatalf("fatal: %v: '%v' is outside repository at '%v'", arg, arg, repository.WorkTree)
+	}
+	return path, nil
+}
+
+// displayPath turns a worktree path back into one relative to the original
+// working directory, the way git prints paths in porcelain output.
+func displayPath(path string) string {
+	if workTreePrefix == "" {
+		return path
+	}
+	relative, err := filepath.Rel(workTreePrefix, path)
+	if err != nil {
+		return path
+	}
+	relative = filepath.ToSlash(relative)
+	if strings.HasSuffix(path, "/") {
+		relative += "/"
+	}
+	return relative
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/objects"
+	"github.com/codecrafters-io/git-starter-go/pkg/repo"
+)
+
+func TestCommandsRunFromSubdirectories(t *testing.T) {
+	base := setupTest(t)
+	work := filepath.Join(base, "work")
+	deep := filepath.Join(work, "sub", "deep")
+	if err := os.MkdirAll(deep, 0755); err != nil {
+		t.Fatal(err)
+	}
+	mygit(t, work, "init")
+	writeFile(t, work, "top", "top\n")
+	writeFile(t, work, "sub/s", "s\n")
+
+	sub := filepath.Join(work, "sub")
+	mygit(t, sub, "add", "s")
+	if got := mygit(t, sub, "status", "-s"); got != "A  s\n?? ../top\n" {
+		t.Errorf("status -s in sub:\n%v", got)
+	}
+	mygit(t, deep, "commit", "-m", "from deep")
+	if got := mygit(t, deep, "cat-file", "-p", "HEAD:sub/s"); got != "s\n" {
+		t.Errorf("HEAD:sub/s = %q", got)
+	}
+	if got := mygit(t, deep, "rev-parse", "--show-toplevel"); strings.TrimSpace(got) != work {
+		if resolved, _ := filepath.EvalSymlinks(work); strings.TrimSpace(got) != resolved {
+			t.Errorf("--show-toplevel in sub/deep = %q, want %v", got, work)
+		}
+	}
+}
+
+func TestGitDirAndWorkTreeEnvironment(t *testing.T) {
+	base := setupTest(t)
+	work, other := filepath.Join(base, "work"), filepath.Join(base, "other")
+	for _, dir := range []string{work, other} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mygit(t, work, "init")
+	commit := commitFile(t, work, "f", "f\n", "one")
+	writeFile(t, other, "o", "o\n")
+
+	// GIT_DIR alone makes the current directory the worktree.
+	t.Setenv("GIT_DIR", filepath.Join(work, ".git"))
+	if got := strings.TrimSpace(mygit(t, other, "rev-parse", "HEAD")); got != commit {
+		t.Errorf("rev-parse HEAD with GIT_DIR = %v, want %v", got, commit)
+	}
+	if got := mygit(t, other, "status", "-s"); got != " D f\n?? o\n" {
+		t.Errorf("status -s in other with GIT_DIR:\n%v", got)
+	}
+	t.Setenv("GIT_WORK_TREE", work)
+	if got := mygit(t, other, "status", "-s"); got != "" {
+		t.Errorf("status -s with GIT_WORK_TREE naming the worktree:\n%v", got)
+	}
+}
+
+func TestLibraryBuildsRepositoriesMygitReads(t *testing.T) {
+	work := filepath.Join(setupTest(t), "work")
+	writeFile(t, work, "a", "a\n")
+	writeFile(t, work, "d/b", "b\n")
+
+	// What a program embedding the packages does, with no command run.
+	repository, err := repo.Init(filepath.Join(work, ".git"), work, objects.SHA1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := repository.WriteTree(work, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity := "A U Thor <author@example.com> 1700000000 +0000"
+	commit := &objects.Commit{Tree: hex.EncodeToString(tree), Author: identity, Committer: identity, Message: "from the library\n"}
+	hash, err := repository.WriteObject("commit", commit.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sha := hex.EncodeToString(hash)
+	if err := repository.Refs.Write("refs/heads/main", sha); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := mygit(t, work, "log", "--oneline"); got != sha[:7]+" from the library\n" {
+		t.Errorf("log --oneline = %q", got)
+	}
+	if got := mygit(t, work, "cat-file", "-p", "HEAD:d/b"); got != "b\n" {
+		t.Errorf("HEAD:d/b = %q", got)
+	}
+	read, err := repo.Open(filepath.Join(work, ".git"), work).ReadCommit(sha)
+	if err != nil || read.Message != commit.Message || read.Tree != commit.Tree {
+		t.Errorf("ReadCommit = %+v, %v", read, err)
+	}
+	entries, err := repository.ReadTree(commit.Tree)
+	if err != nil || len(entries.Entries) != 2 || entries.Entries[0].Name != "a" || !entries.Entries[1].IsTree() {
+		t.Errorf("ReadTree = %+v, %v", entries, err)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+)
+
+// reset points the current branch, or a detached HEAD, at a commit. --soft
+// only moves the ref, --mixed (the default) also rewrites the index from the
+// commit's tree and --hard the working tree too. Given paths it leaves HEAD
+// alone and resets just their index entries, unstaging them.
+func reset(args []string, stdout io.Writer) error {
+	mode := "mixed"
+	revision := ""
+	pathspecs := make([]string, 0)
+	for index := 0; index < len(args); index++ {
+		switch arg := args[index]; {
+		case arg == "--":
+			pathspecs = append(pathspecs, args[index+1:]...)
+			index = len(args)
+		case arg == "--soft" || arg == "--mixed" || arg == "--hard":
+			mode = strings.TrimPrefix(arg, "--")
+		case arg == "-q" || arg == "--quiet":
+			stdout = io.Discard
+		case strings.HasPrefix(arg, "-"):
+			return failure.Usage("usage: reset [--soft | --mixed | --hard] [<commit>]\n   or: reset [<commit>] [--] <paths>...")
+		case revision == "" && len(pathspecs) == 0:
+			if _, err := resolveRevision(arg); err == nil {
+				revision = arg
+				continue
+			}
+			fallthrough
+		default:
+			if path, err := worktreePath(arg); err != nil || !fileExists(path) {
+				return failure.Fatalf("fatal: ambiguous argument '%v': unknown revision or path not in the working tree.\nUse '--' to separate paths from revisions, like this:\n'git <command> [<revision>...] -- [<file>...]'", arg)
+			}
+			pathspecs = append(pathspecs, arg)
+		}
+	}
+	if len(pathspecs) > 0 && mode != "mixed" {
+		return failure.Fatalf("fatal: Cannot do %v reset with paths.", mode)
+	}
+	if mode != "soft" && repository.WorkTree == "" {
+		return failure.Fatalf("fatal: %v reset is not allowed in a bare repository", mode)
+	}
+
+	headSHA, err := resolveHead()
+	if err != nil {
+		return err
+	}
+	targetSHA := headSHA
+	if revision != "" {
+		if targetSHA, err = resolveRevision(revision); err == nil {
+			targetSHA, err = peelObject(targetSHA, "commit")
+		}
+		if err != nil {
+			return failure.Fatalf("fatal: Could not parse object '%v'.", revision)
+		}
+	}
+	targetTreeSHA := ""
+	if targetSHA != "" {
+		if targetTreeSHA, err = commitTreeSHA(targetSHA); err != nil {
+			return err
+		}
+	}
+	targetFiles, err := flattenTree(targetTreeSHA)
+	if err != nil {
+		return err
+	}
+
+	if len(pathspecs) > 0 {
+		for index, path := range pathspecs {
+			if pathspecs[index], err = worktreePath(path); err != nil {
+				return err
+			}
+		}
+		if err := resetIndex(targetFiles, pathspecs); err != nil {
+			return err
+		}
+		return printUnstagedChanges(stdout)
+	}
+
+	if _, err := repository.Refs.Read("MERGE_HEAD"); err == nil && mode == "soft" {
+		return failure.Fatal("fatal: Cannot do a soft reset in the middle of a merge.")
+	}
+	switch mode {
+	case "mixed":
+		err = resetIndex(targetFiles, nil)
+	case "hard":
+		err = switchWorktree(targetTreeSHA, true, "reset")
+	}
+	if err != nil {
+		return err
+	}
+
+	if targetSHA != "" {
+		if headSHA != "" {
+			if err := repository.Refs.Write("ORIG_HEAD", headSHA); err != nil {
+				return err
+			}
+		}
+		headRef, isSymref, err := readHeadSymref()
+		if err != nil {
+			return err
+		}
+		if !isSymref {
+			headRef = "HEAD"
+		}
+		if revision == "" {
+			revision = "HEAD"
+		}
+		if err := writeRef(headRef, targetSHA, "reset: moving to "+revision); err != nil {
+			return err
+		}
+	}
+	if err := clearMergeState(); err != nil {
+		return err
+	}
+
+	switch mode {
+	case "mixed":
+		return printUnstagedChanges(stdout)
+	case "hard":
+		if targetSHA == "" {
+			return nil
+		}
+		commit, err := readCommit(targetSHA)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "HEAD is now at %v %v\n", targetSHA[:7], commit.subject())
+	}
+	return nil
+}
+
+// resetIndex replaces the index entries matching pathspecs, or all of them,
+// with the files of a tree. Entries already holding the tree's version keep
+// their stat data, and new ones take it from working tree files that match,
+// so unchanged files are not rehashed later.
+func resetIndex(targetFiles map[string]TreeFile, pathspecs []string) error {
+	entries, err := readIndex()
+	if err != nil {
+		return err
+	}
+	indexed := make(map[string]IndexEntry, len(entries))
+	updated := make([]IndexEntry, 0, len(entries))
+	for _, entry := range entries {
+		if !matchesPathspecs(entry.path, pathspecs) {
+			updated = append(updated, entry)
+		} else if entry.stage() == 0 {
+			indexed[entry.path] = entry
+		}
+	}
+	for path, file := range targetFiles {
+		if !matchesPathspecs(path, pathspecs) {
+			continue
+		}
+		if entry, ok := indexed[path]; ok && sameTreeFile(treeFileFromIndex(entry), file) {
+			updated = append(updated, entry)
+			continue
+		}
+		mode, err := strconv.ParseUint(file.mode, 8, 32)
+		if err != nil {
+			return fmt.Errorf("Invalid mode %v for %v", file.mode, path)
+		}
+		entry := IndexEntry{mode: uint32(mode), hash: file.hash, path: path}
+		if info, err := os.Lstat(path); err == nil {
+			if current, err := worktreeFile(path, info); err == nil && sameTreeFile(current, file) {
+				entry = indexEntryFromStat(path, info, entry.mode, file.hash)
+			}
+		}
+		updated = append(updated, entry)
+	}
+	return writeIndex(updated)
+}
+
+// printUnstagedChanges lists the tracked files whose working tree copies
+// differ from the index, as a mixed reset reports them.
+func printUnstagedChanges(stdout io.Writer) error {
+	report, err := collectStatus()
+	if err != nil {
+		return err
+	}
+	if len(report.unstaged) == 0 {
+		return nil
+	}
+	paths := make([]string, 0, len(report.unstaged))
+	for path := range report.unstaged {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	fmt.Fprintln(stdout, "Unstaged changes after reset:")
+	for _, path := range paths {
+		fmt.Fprintf(stdout, "%c\t%v\n", report.unstaged[path], quotePath(displayPath(path), false))
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResetModes(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	first := commitFile(t, dir, "f", "1\n", "one")
+	writeFile(t, dir, "g", "g\n")
+	mygit(t, dir, "add", "g")
+	second := commitFile(t, dir, "f", "2\n", "two")
+	head := func() string {
+		t.Helper()
+		return strings.TrimSpace(mygit(t, dir, "rev-parse", "HEAD"))
+	}
+	status := func() string {
+		t.Helper()
+		return mygit(t, dir, "status", "-s")
+	}
+
+	// --soft moves only the branch, so the undone commit is left staged.
+	writeFile(t, dir, "f", "3\n")
+	if stdout, stderr, code := runIn(t, dir, "", "reset", "--soft", "HEAD~1"); code != 0 || stdout+stderr != "" {
+		t.Fatalf("reset --soft: exit %v\n%v%v", code, stdout, stderr)
+	}
+	if got := head(); got != first {
+		t.Errorf("HEAD after reset --soft = %v, want %v", got, first)
+	}
+	if got := status(); got != "MM f\nA  g\n" {
+		t.Errorf("status after reset --soft:\n%v", got)
+	}
+	if got := strings.TrimSpace(mygit(t, dir, "rev-parse", "ORIG_HEAD")); got != second {
+		t.Errorf("ORIG_HEAD = %v, want %v", got, second)
+	}
+
+	// --mixed resets the index too and lists what is left in the worktree.
+	if got := mygit(t, dir, "reset", "--mixed"); got != "Unstaged changes after reset:\nM\tf\n" {
+		t.Errorf("reset --mixed printed:\n%v", got)
+	}
+	if got := status(); got != " M f\n?? g\n" {
+		t.Errorf("status after reset --mixed:\n%v", got)
+	}
+
+	// --hard resets the worktree, and leaves untracked files alone.
+	mygit(t, dir, "add", "g")
+	writeFile(t, dir, "u", "u\n")
+	if got, want := mygit(t, dir, "reset", "--hard", second), "HEAD is now at "+second[:7]+" two\n"; got != want {
+		t.Errorf("reset --hard printed %q, want %q", got, want)
+	}
+	if got := status(); got != "?? u\n" {
+		t.Errorf("status after reset --hard:\n%v", got)
+	}
+	for name, want := range map[string]string{"f": "2\n", "g": "g\n", "u": "u\n"} {
+		if got, err := os.ReadFile(filepath.Join(dir, name)); err != nil || string(got) != want {
+			t.Errorf("%v after reset --hard = %q, %v", name, got, err)
+		}
+	}
+	mygit(t, dir, "reset", "--hard", first)
+	if _, err := os.Stat(filepath.Join(dir, "g")); !os.IsNotExist(err) {
+		t.Errorf("g, tracked only in the commit reset away from, survived: %v", err)
+	}
+
+	// With paths the index entries are reset and HEAD stays.
+	mygit(t, dir, "reset", "--hard", second)
+	writeFile(t, dir, "f", "4\n")
+	writeFile(t, dir, "g", "5\n")
+	mygit(t, dir, "add", "f", "g")
+	mygit(t, dir, "reset", first, "--", "f")
+	if got := head(); got != second {
+		t.Errorf("reset with a path moved HEAD to %v", got)
+	}
+	if got := mygit(t, dir, "diff", "--cached", "--name-status"); got != "M\tf\nM\tg\n" {
+		t.Errorf("staged after resetting f to the first commit:\n%v", got)
+	}
+	if got := mygit(t, dir, "cat-file", "-p", ":f"); got != "1\n" {
+		t.Errorf("f in the index = %q", got)
+	}
+	if _, stderr, code := runIn(t, dir, "", "reset", "--hard", "--", "f"); code != 128 || !strings.Contains(stderr, "Cannot do hard reset with paths.") {
+		t.Errorf("reset --hard with a path: exit %v\n%v", code, stderr)
+	}
+}
@@ -0,0 +1,456 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+	"github.com/codecrafters-io/git-starter-go/pkg/objects"
+)
+
+// resolveRevision turns a revision expression into a full object name. The
+// base is a ref, branch or tag name, "@", a reflog entry such as HEAD@{2}, or
+// a full or abbreviated SHA, and it may be followed by any number of ~<n>,
+// ^<n> and ^{<type>} suffixes. <revision>:<path> names the blob or tree at
+// path in the revision's tree, and :<path> or :<stage>:<path> the blob the
+// index holds for it.
+func resolveRevision(revision string) (string, error) {
+	if treeish, path, ok := cutTreePath(revision); ok {
+		if treeish == "" {
+			return resolveIndexPath(path)
+		}
+		return resolveTreePath(treeish, path)
+	}
+	// The base ends at the first ~ or ^ outside a reflog selector.
+	baseEnd, depth := len(revision), 0
+	for index := 0; index < len(revision) && baseEnd == len(revision); index++ {
+		switch revision[index] {
+		case '{':
+			depth++
+		case '}':
+			depth = max(depth-1, 0)
+		case '~', '^':
+			if depth == 0 {
+				baseEnd = index
+			}
+		}
+	}
+	sha, err := resolveRevisionBase(revision[:baseEnd])
+	if err != nil {
+		return "", err
+	}
+
+	suffixes := revision[baseEnd:]
+	for len(suffixes) > 0 {
+		operator := suffixes[0]
+		suffixes = suffixes[1:]
+
+		if operator == '^' && strings.HasPrefix(suffixes, "{") {
+			closing := strings.IndexByte(suffixes, '}')
+			if closing < 0 {
+				return "", fmt.Errorf("Not a valid object name %v", revision)
+			}
+			objectType := suffixes[1:closing]
+			suffixes = suffixes[closing+1:]
+			if objectType == "" {
+				if sha, err = peelTags(sha); err != nil {
+					return "", err
+				}
+				continue
+			}
+			if sha, err = peelObject(sha, objectType); err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		digits := len(suffixes) - len(strings.TrimLeft(suffixes, "0123456789"))
+		count := 1
+		if digits > 0 {
+			if count, err = strconv.Atoi(suffixes[:digits]); err != nil {
+				return "", fmt.Errorf("Not a valid object name %v", revision)
+			}
+			suffixes = suffixes[digits:]
+		}
+		if sha, err = peelObject(sha, "commit"); err != nil {
+			return "", err
+		}
+
+		if operator == '~' {
+			for ; count > 0; count-- {
+				commit, err := readCommit(sha)
+				if err != nil {
+					return "", err
+				}
+				if len(commit.Parents) == 0 {
+					return "", fmt.Errorf("Not a valid object name %v", revision)
+				}
+				sha = commit.Parents[0]
+			}
+			continue
+		}
+		if count == 0 {
+			continue
+		}
+		commit, err := readCommit(sha)
+		if err != nil {
+			return "", err
+		}
+		if count > len(commit.Parents) {
+			return "", fmt.Errorf("Not a valid object name %v", revision)
+		}
+		sha = commit.Parents[count-1]
+	}
+	return sha, nil
+}
+
+// cutTreePath splits <revision>:<path> at the first colon outside braces,
+// so that reflog entries such as HEAD@{2 hours ago} and ^{type} suffixes
+// may themselves hold one.
+func cutTreePath(revision string) (treeish string, path string, ok bool) {
+	depth := 0
+	for index := 0; index < len(revision); index++ {
+		switch revision[index] {
+		case '{':
+			depth++
+		case '}':
+			depth = max(depth-1, 0)
+		case ':':
+			if depth == 0 {
+				return revision[:index], revision[index+1:], true
+			}
+		}
+	}
+	return revision, "", false
+}
+
+// resolveTreePath finds the object at path, taken from the top of the tree,
+// in the tree treeish names. An empty path names the tree itself.
+func resolveTreePath(treeish string, path string) (string, error) {
+	sha, err := resolveRevision(treeish)
+	if err != nil {
+		return "", err
+	}
+	if sha, err = peelObject(sha, "tree"); err != nil {
+		return "", err
+	}
+	for _, name := range strings.Split(path, "/") {
+		if name == "" {
+			continue
+		}
+		tree, err := repository.ReadTree(sha)
+		if err != nil {
+			return "", failure.Fatalf("fatal: path '%v' does not exist in '%v'", path, treeish)
+		}
+		found := false
+		for _, entry := range tree.Entries {
+			if entry.Name == name {
+				sha, found = hex.EncodeToString(entry.Hash), true
+				break
+			}
+		}
+		if !found {
+			return "", failure.Fatalf("fatal: path '%v' does not exist in '%v'", path, treeish)
+		}
+	}
+	return sha, nil
+}
+
+// resolveIndexPath finds the blob the index holds for path at stage 0, or at
+// the stage a leading "<n>:" names for a conflicted path.
+func resolveIndexPath(path string) (string, error) {
+	stage := 0
+	if len(path) > 1 && path[0] >= '0' && path[0] <= '3' && path[1] == ':' {
+		stage, path = int(path[0]-'0'), path[2:]
+	}
+	entries, err := readIndex()
+	if err != nil {
+		return "", err
+	}
+	inIndex := false
+	for _, entry := range entries {
+		if entry.path != path {
+			continue
+		}
+		if entry.stage() == stage {
+			return hex.EncodeToString(entry.hash), nil
+		}
+		inIndex = true
+	}
+	if inIndex {
+		return "", failure.Fatalf("fatal: path '%v' is in the index, but not at stage %v", path, stage)
+	}
+	if repository.WorkTree != "" {
+		if _, err := os.Lstat(filepath.Join(repository.WorkTree, path)); err == nil {
+			return "", failure.Fatalf("fatal: path '%v' exists on disk, but not in the index", path)
+		}
+	}
+	return "", failure.Fatalf("fatal: path '%v' does not exist (neither on disk nor in the index)", path)
+}
+
+// followedPath is where following a path through a tree's symlinks leads:
+// the object at the end, or a status saying why there is none. A link out
+// of the tree gives status "symlink" and, in link, where it points.
+type followedPath struct {
+	sha    string
+	status string
+	link   string
+}
+
+// maxSymlinkHops is how many symlinks a path may pass through, as in git,
+// before it is taken to loop.
+const maxSymlinkHops = 40
+
+// followTreePath is resolveTreePath for cat-file --follow-symlinks: a
+// symlink on the way, or at the end, is replaced by its target, taken
+// relative to the directory holding it. Besides "symlink", the status is
+// "missing" for a path that is not there, "dangling" when one reached
+// through a symlink is not, "loop" after too many symlinks and "notdir"
+// when a file stands where a directory should.
+func followTreePath(treeish string, path string) (followedPath, error) {
+	sha, err := resolveRevision(treeish)
+	if err != nil {
+		return followedPath{}, err
+	}
+	if sha, err = peelObject(sha, "tree"); err != nil {
+		return followedPath{}, err
+	}
+	dirs := []string{sha}
+	remaining := strings.Split(path, "/")
+	hops := 0
+	for len(remaining) > 0 {
+		name := remaining[0]
+		remaining = remaining[1:]
+		switch name {
+		case "", ".":
+			continue
+		case "..":
+			if len(dirs) == 1 {
+				return followedPath{status: "symlink", link: strings.Join(append([]string{".."}, remaining...), "/")}, nil
+			}
+			dirs = dirs[:len(dirs)-1]
+			continue
+		}
+		tree, err := repository.ReadTree(dirs[len(dirs)-1])
+		if err != nil {
+			return followedPath{}, err
+		}
+		index := slices.IndexFunc(tree.Entries, func(entry objects.TreeEntry) bool { return entry.Name == name })
+		if index < 0 {
+			if hops > 0 {
+				return followedPath{status: "dangling"}, nil
+			}
+			return followedPath{status: "missing"}, nil
+		}
+		entry := tree.Entries[index]
+		entrySHA := hex.EncodeToString(entry.Hash)
+		switch {
+		case entry.Mode == "120000":
+			if hops++; hops > maxSymlinkHops {
+				return followedPath{status: "loop"}, nil
+			}
+			blob, err := repository.ReadBlob(entrySHA)
+			if err != nil {
+				return followedPath{}, err
+			}
+			target := string(blob.Data)
+			if strings.HasPrefix(target, "/") {
+				return followedPath{status: "symlink", link: strings.Join(append([]string{target}, remaining...), "/")}, nil
+			}
+			remaining = append(strings.Split(target, "/"), remaining...)
+		case entry.IsTree():
+			dirs = append(dirs, entrySHA)
+		case slices.ContainsFunc(remaining, func(name string) bool { return name != "" && name != "." }):
+			return followedPath{status: "notdir"}, nil
+		default:
+			return followedPath{sha: entrySHA}, nil
+		}
+	}
+	return followedPath{sha: dirs[len(dirs)-1]}, nil
+}
+
+// resolveRevisionBase resolves a revision without suffixes, trying refs in
+// git's lookup order before treating the name as a hex SHA prefix.
+func resolveRevisionBase(name string) (string, error) {
+	if start := strings.LastIndex(name, "@{"); start >= 0 && strings.HasSuffix(name, "}") {
+		return resolveReflogRevision(name[:start], name[start+2:len(name)-1])
+	}
+	if name == "" || name == "@" {
+		name = "HEAD"
+	}
+	candidates := []string{"refs/" + name, "refs/tags/" + name, "refs/heads/" + name, "refs/remotes/" + name, "refs/remotes/" + name + "/HEAD"}
+	if strings.HasPrefix(name, "refs/") || strings.Trim(name, "ABCDEFGHIJKLMNOPQRSTUVWXYZ_") == "" {
+		candidates = append([]string{name}, candidates...)
+	}
+	for _, candidate := range candidates {
+		if _, sha, err := repository.Refs.Resolve(candidate); err == nil {
+			return sha, nil
+		}
+	}
+
+	if len(name) < 4 || len(name) > len(zeroSHA()) || strings.Trim(strings.ToLower(name), "0123456789abcdef") != "" {
+		return "", fmt.Errorf("Not a valid object name %v", name)
+	}
+	prefix := strings.ToLower(name)
+	if len(prefix) == len(zeroSHA()) {
+		return prefix, nil
+	}
+	matches, err := repository.FindObjects(prefix)
+	if err != nil {
+		return "", err
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("Not a valid object name %v", name)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", &ambiguousNameError{name: name, candidates: matches}
+	}
+}
+
+// ambiguousNameError is a SHA prefix that names more than one object.
+type ambiguousNameError struct {
+	name       string
+	candidates []string
+}
+
+func (err *ambiguousNameError) Error() string {
+	return fmt.Sprintf("short object ID %v is ambiguous", err.name)
+}
+
+// hint lists the objects the prefix could name, as git does after saying
+// it is ambiguous.
+func (err *ambiguousNameError) hint() string {
+	var hint strings.Builder
+	hint.WriteString("hint: The candidates are:\n")
+	for _, sha := range err.candidates {
+		short, abbrevErr := abbreviateSHA(sha, 7)
+		if abbrevErr != nil {
+			short = sha
+		}
+		objectType, _ := objectType(sha)
+		fmt.Fprintf(&hint, "hint:   %v %v\n", short, objectType)
+	}
+	return hint.String()
+}
+
+// abbreviateSHA returns the shortest prefix of sha, at least minLength long,
+// that names no other object.
+func abbreviateSHA(sha string, minLength int) (string, error) {
+	for length := minLength; length < len(sha); length++ {
+		matches, err := repository.FindObjects(sha[:length])
+		if err != nil {
+			return "", err
+		}
+		if len(matches) <= 1 {
+			return sha[:length], nil
+		}
+	}
+	return sha, nil
+}
+
+func objectType(sha string) (string, error) {
+	objectType, _, reader, err := repository.OpenObject(sha)
+	if err != nil {
+		return "", err
+	}
+	reader.Close()
+	return objectType, nil
+}
+
+// peelTags follows annotated tags until it reaches a non-tag object.
+func peelTags(sha string) (string, error) {
+	for {
+		currentType, err := objectType(sha)
+		if err != nil {
+			return "", err
+		}
+		if currentType != "tag" {
+			return sha, nil
+		}
+		if sha, err = tagTarget(sha); err != nil {
+			return "", err
+		}
+	}
+}
+
+// tagTarget returns the object named by the "object" header of a tag.
+func tagTarget(tagSHA string) (string, error) {
+	tag, err := repository.ReadTag(tagSHA)
+	if err != nil {
+		return "", err
+	}
+	return tag.Object, nil
+}
+
+// peelObject dereferences tags, and commits when a tree is wanted, until it
+// reaches an object of the wanted type.
+func peelObject(sha string, wantType string) (string, error) {
+	original := sha
+	for {
+		currentType, err := objectType(sha)
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case currentType == wantType:
+			return sha, nil
+		case currentType == "tag":
+			if sha, err = tagTarget(sha); err != nil {
+				return "", err
+			}
+		case currentType == "commit" && wantType == "tree":
+			return commitTreeSHA(sha)
+		default:
+			return "", fmt.Errorf("%v is not a %v", original, wantType)
+		}
+	}
+}
+
+// revParseRevisions prints the object name of each revision, abbreviated when
+// short is non-zero. With verify and quiet a revision that does not resolve
+// fails without a word.
+func revParseRevisions(revisions []string, verify bool, quiet bool, short int, stdout io.Writer) error {
+	if verify && len(revisions) != 1 {
+		return failure.Fatal("fatal: Needed a single revision")
+	}
+	for _, revision := range revisions {
+		sha, err := resolveRevision(revision)
+		if err != nil && verify && quiet {
+			return errSilentFailure
+		}
+		if err != nil {
+			var fatal *failure.FatalError
+			if errors.As(err, &fatal) {
+				return err
+			}
+			var ambiguous *ambiguousNameError
+			if errors.As(err, &ambiguous) {
+				prefix := "error: " + ambiguous.Error() + "\n" + ambiguous.hint()
+				if verify {
+					return failure.Fatal(prefix + "fatal: Needed a single revision")
+				}
+				return failure.Fatalf("%vfatal: ambiguous argument '%v': unknown revision or path not in the working tree.", prefix, revision)
+			}
+			if verify {
+				return failure.Fatal("fatal: Needed a single revision")
+			}
+			return failure.Fatalf("fatal: ambiguous argument '%v': unknown revision or path not in the working tree.", revision)
+		}
+		if short > 0 {
+			if sha, err = abbreviateSHA(sha, short); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintln(stdout, sha)
+	}
+	return nil
+}
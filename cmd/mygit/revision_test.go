@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRevisionSuffixes(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	first := commitFile(t, dir, "a", "a\n", "one")
+	second := commitFile(t, dir, "a", "b\n", "two")
+	side := strings.TrimSpace(mygit(t, dir, "commit-tree", strings.TrimSpace(mygit(t, dir, "rev-parse", "HEAD^{tree}")), "-p", first, "-m", "side"))
+	merge := strings.TrimSpace(mygit(t, dir, "commit-tree", strings.TrimSpace(mygit(t, dir, "rev-parse", "HEAD^{tree}")), "-p", second, "-p", side, "-m", "merge"))
+	mygit(t, dir, "update-ref", "refs/heads/main", merge)
+	tree := strings.TrimSpace(mygit(t, dir, "write-tree"))
+
+	for revision, want := range map[string]string{
+		"HEAD":          merge,
+		"@":             merge,
+		"HEAD^":         second,
+		"HEAD^2":        side,
+		"HEAD^0":        merge,
+		"HEAD~2":        first,
+		"HEAD^2~1":      first,
+		"main^{tree}":   tree,
+		"HEAD^{commit}": merge,
+		merge[:7]:       merge,
+	} {
+		if got := strings.TrimSpace(mygit(t, dir, "rev-parse", revision)); got != want {
+			t.Errorf("rev-parse %v = %v, want %v", revision, got, want)
+		}
+	}
+	for _, revision := range []string{"HEAD^3", "HEAD~3", "nope"} {
+		if stdout, stderr, code := runIn(t, dir, "", "rev-parse", "--verify", "-q", revision); code != 1 || stdout+stderr != "" {
+			t.Errorf("rev-parse --verify -q %v: exit %v\n%v%v", revision, code, stdout, stderr)
+		}
+	}
+}
+
+func TestShortNamesDisambiguate(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	// Store blobs until two share their first four hex digits.
+	seen := make(map[string]string)
+	var shas [2]string
+	for index := 0; shas[0] == ""; index++ {
+		sha := strings.TrimSpace(mygitInput(t, dir, fmt.Sprintf("%v\n", index), "hash-object", "-w", "--stdin"))
+		if other, ok := seen[sha[:4]]; ok {
+			shas = [2]string{other, sha}
+		}
+		seen[sha[:4]] = sha
+	}
+
+	if _, stderr, code := runIn(t, dir, "", "rev-parse", shas[0][:4]); code != 128 || !strings.HasPrefix(stderr, "error: short object ID "+shas[0][:4]+" is ambiguous\nhint: The candidates are:\n") {
+		t.Errorf("rev-parse of an ambiguous prefix: exit %v\n%v", code, stderr)
+	}
+	length := 4
+	for shas[0][:length] == shas[1][:length] {
+		length++
+	}
+	for _, sha := range shas {
+		if got := strings.TrimSpace(mygit(t, dir, "rev-parse", sha[:length])); got != sha {
+			t.Errorf("rev-parse %v = %v, want %v", sha[:length], got, sha)
+		}
+		if got := strings.TrimSpace(mygit(t, dir, "rev-parse", "--short=4", sha)); got != sha[:length] {
+			t.Errorf("rev-parse --short=4 %v = %v, want the unambiguous %v", sha, got, sha[:length])
+		}
+	}
+}
+
+func TestIndexPathRevisions(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	commitFile(t, dir, "f", "base\n", "base")
+	mygit(t, dir, "branch", "side")
+	commitFile(t, dir, "f", "main\n", "main")
+	mygit(t, dir, "checkout", "side")
+	commitFile(t, dir, "f", "side\n", "side")
+	writeFile(t, dir, "g", "staged\n")
+	mygit(t, dir, "add", "g")
+	writeFile(t, dir, "untracked", "u\n")
+
+	// :<path> is the staged blob, not the one in HEAD.
+	if got := mygit(t, dir, "cat-file", "-p", ":g"); got != "staged\n" {
+		t.Errorf(":g = %q", got)
+	}
+	mygit(t, dir, "commit", "-m", "g")
+	runIn(t, dir, "", "merge", "main")
+	for revision, want := range map[string]string{":1:f": "base\n", ":2:f": "side\n", ":3:f": "main\n", ":0:g": "staged\n"} {
+		if got := mygit(t, dir, "cat-file", "-p", revision); got != want {
+			t.Errorf("%v = %q, want %q", revision, got, want)
+		}
+	}
+	for revision, want := range map[string]string{
+		":f":         "fatal: path 'f' is in the index, but not at stage 0",
+		":untracked": "fatal: path 'untracked' exists on disk, but not in the index",
+		":nope":      "fatal: path 'nope' does not exist (neither on disk nor in the index)",
+	} {
+		if _, stderr, code := runIn(t, dir, "", "rev-parse", revision); code != 128 || !strings.Contains(stderr, want) {
+			t.Errorf("rev-parse %v: exit %v\n%v", revision, code, stderr)
+		}
+	}
+}
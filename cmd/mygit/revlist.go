@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+)
+
+// revisionTip is a revision a walk starts from, with the name it was given.
+type revisionTip struct {
+	name string
+	sha  string
+}
+
+// revList prints the commits reachable from the revisions given but not
+// from the excluded ones, newest first by committer date, or with
+// --topo-order and --date-order never a parent before its children. With
+// --objects the trees, blobs and tags those commits need follow, each with
+// its path, in the form pack-objects reads.
+func revList(args []string, stdout io.Writer) error {
+	order, maxCount, skip := "", -1, 0
+	all, reverse, count, parents, listObjects := false, false, false, false, false
+	revisions := make([]string, 0, 1)
+	for index := 0; index < len(args); index++ {
+		arg := args[index]
+		switch {
+		case arg == "--all":
+			all = true
+		case arg == "--topo-order" || arg == "--date-order":
+			order = strings.TrimSuffix(strings.TrimPrefix(arg, "--"), "-order")
+		case arg == "--reverse":
+			reverse = true
+		case arg == "--count":
+			count = true
+		case arg == "--parents":
+			parents = true
+		case arg == "--objects":
+			listObjects = true
+		case arg == "--not" || strings.HasPrefix(arg, "^") || !strings.HasPrefix(arg, "-"):
+			revisions = append(revisions, arg)
+		case arg == "-n" && index+1 < len(args):
+			index++
+			value, err := strconv.Atoi(args[index])
+			if err != nil {
+				return failure.Fatalf("fatal: '%v': not an integer", args[index])
+			}
+			maxCount = value
+		case strings.HasPrefix(arg, "--max-count="), strings.HasPrefix(arg, "-n"), len(arg) > 1 && arg[1] >= '0' && arg[1] <= '9':
+			value := strings.TrimPrefix(strings.TrimPrefix(strings.TrimPrefix(arg, "--max-count="), "-n"), "-")
+			number, err := strconv.Atoi(value)
+			if err != nil {
+				return failure.Fatalf("fatal: '%v': not an integer", value)
+			}
+			maxCount = number
+		case strings.HasPrefix(arg, "--skip="):
+			value, err := strconv.Atoi(strings.TrimPrefix(arg, "--skip="))
+			if err != nil {
+				return failure.Fatalf("fatal: '%v': not an integer", strings.TrimPrefix(arg, "--skip="))
+			}
+			skip = value
+		default:
+			return failure.Usage("usage: git rev-list [<options>] <commit>...")
+		}
+	}
+
+	include, exclude, err := resolveRevisionArgs(revisions)
+	if err != nil {
+		return err
+	}
+	if all {
+		tips, err := allRefTips()
+		if err != nil {
+			return err
+		}
+		include = append(include, tips...)
+	}
+	if len(include) == 0 && len(exclude) == 0 {
+		return failure.Usage("usage: git rev-list [<options>] <commit>...")
+	}
+	// Tags name the commits they lead to; --objects also lists the tags,
+	// and anything else they lead to.
+	starts, others := make([]string, 0, len(include)), make([]revisionTip, 0)
+	for _, tip := range include {
+		sha, err := peelTags(tip.sha)
+		if err != nil {
+			return err
+		}
+		if currentType, err := objectType(sha); err != nil {
+			return err
+		} else if currentType == "commit" {
+			starts = append(starts, sha)
+		} else if !listObjects {
+			return failure.Fatalf("fatal: object %v is a %v, not a commit", sha, currentType)
+		}
+		if sha != tip.sha || !slices.Contains(starts, sha) {
+			others = append(others, tip)
+		}
+	}
+
+	commits, err := listCommits(starts, exclude, order)
+	if err != nil {
+		return err
+	}
+	commits = commits[min(skip, len(commits)):]
+	if maxCount >= 0 && maxCount < len(commits) {
+		commits = commits[:maxCount]
+	}
+	if reverse {
+		slices.Reverse(commits)
+	}
+
+	output := bufio.NewWriter(stdout)
+	defer output.Flush()
+	if count {
+		fmt.Fprintln(output, len(commits))
+		return nil
+	}
+	for _, commit := range commits {
+		line := commit.sha
+		if parents {
+			line = strings.Join(append([]string{line}, commit.Parents...), " ")
+		}
+		fmt.Fprintln(output, line)
+	}
+	if !listObjects {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	if err := walkObjects(exclude, seen, nil); err != nil {
+		return err
+	}
+	for _, commit := range commits {
+		seen[commit.sha] = true
+	}
+	// A tag is listed by its own name, and a tree or blob by the
+	// path it was named with, when it was named as <revision>:<path>.
+	for _, tip := range others {
+		_, path, _ := strings.Cut(tip.name, ":")
+		for sha := tip.sha; !seen[sha]; {
+			currentType, err := objectType(sha)
+			if err != nil {
+				return err
+			}
+			if currentType == "commit" {
+				break
+			}
+			if currentType != "tag" {
+				if err := writeObjectPaths(sha, path, seen, output); err != nil {
+					return err
+				}
+				break
+			}
+			tag, err := repository.ReadTag(sha)
+			if err != nil {
+				return err
+			}
+			seen[sha] = true
+			fmt.Fprintf(output, "%v %v\n", sha, tag.Name)
+			sha, path = tag.Object, ""
+		}
+	}
+	for _, commit := range commits {
+		if err := writeObjectPaths(commit.Tree, "", seen, output); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeObjectPaths prints a tree or blob not yet seen, and then everything
+// new under a tree, depth first, as "<sha> <path>" lines.
+func writeObjectPaths(sha string, path string, seen map[string]bool, w io.Writer) error {
+	if seen[sha] {
+		return nil
+	}
+	seen[sha] = true
+	if _, err := fmt.Fprintf(w, "%v %v\n", sha, path); err != nil {
+		return err
+	}
+	if currentType, err := objectType(sha); err != nil || currentType != "tree" {
+		return err
+	}
+	tree, err := repository.ReadTree(sha)
+	if err != nil {
+		return err
+	}
+	for _, entry := range tree.Entries {
+		if entry.Mode == "160000" {
+			continue
+		}
+		entryPath := entry.Name
+		if path != "" {
+			entryPath = path + "/" + entry.Name
+		}
+		if err := writeObjectPaths(hex.EncodeToString(entry.Hash), entryPath, seen, w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveRevisionArgs turns revision arguments into the tips to walk from
+// and the commits whose history is left out: ^A and anything after --not
+// exclude A, A..B stands for ^A B and A...B for both sides without their
+// merge bases. A side left empty is HEAD.
+func resolveRevisionArgs(args []string) ([]revisionTip, []string, error) {
+	include, exclude := make([]revisionTip, 0, len(args)), make([]string, 0)
+	resolve := func(revision string) (string, error) {
+		if revision == "" {
+			revision = "HEAD"
+		}
+		sha, err := resolveRevision(revision)
+		if err != nil {
+			return "", failure.Fatalf("fatal: ambiguous argument '%v': unknown revision or path not in the working tree.\nUse '--' to separate paths from revisions, like this:\n'git <command> [<revision>...] -- [<file>...]'", revision)
+		}
+		return sha, nil
+	}
+	resolveCommit := func(revision string) (string, error) {
+		sha, err := resolve(revision)
+		if err != nil {
+			return "", err
+		}
+		return peelObject(sha, "commit")
+	}
+	not := false
+	for _, arg := range args {
+		if arg == "--not" {
+			not = !not
+			continue
+		}
+		if left, right, ok := strings.Cut(arg, "..."); ok {
+			one, err := resolveCommit(left)
+			if err != nil {
+				return nil, nil, err
+			}
+			other, err := resolveCommit(right)
+			if err != nil {
+				return nil, nil, err
+			}
+			bases, err := mergeBases(one, other)
+			if err != nil {
+				return nil, nil, err
+			}
+			include = append(include, revisionTip{name: left, sha: one}, revisionTip{name: right, sha: other})
+			exclude = append(exclude, bases...)
+			continue
+		}
+		if left, right, ok := strings.Cut(arg, ".."); ok {
+			excluded, err := resolveCommit(left)
+			if err != nil {
+				return nil, nil, err
+			}
+			included, err := resolve(right)
+			if err != nil {
+				return nil, nil, err
+			}
+			exclude = append(exclude, excluded)
+			include = append(include, revisionTip{name: right, sha: included})
+			continue
+		}
+		revision, negated := strings.CutPrefix(arg, "^")
+		if negated != not {
+			sha, err := resolveCommit(revision)
+			if err != nil {
+				return nil, nil, err
+			}
+			exclude = append(exclude, sha)
+			continue
+		}
+		sha, err := resolve(revision)
+		if err != nil {
+			return nil, nil, err
+		}
+		include = append(include, revisionTip{name: revision, sha: sha})
+	}
+	return include, exclude, nil
+}
+
+// allRefTips lists what --all starts from: every ref, by its short name,
+// then HEAD.
+func allRefTips() ([]revisionTip, error) {
+	list, err := repository.Refs.List("refs/")
+	if err != nil {
+		return nil, err
+	}
+	tips := make([]revisionTip, 0, len(list)+1)
+	for _, ref := range list {
+		if repository.HasObject(ref.SHA) {
+			tips = append(tips, revisionTip{name: shortRefName(ref.Name), sha: ref.SHA})
+		}
+	}
+	if headSHA, err := resolveHead(); err != nil {
+		return nil, err
+	} else if headSHA != "" {
+		tips = append(tips, revisionTip{name: "HEAD", sha: headSHA})
+	}
+	return tips, nil
+}
+
+// listCommits returns the commits reachable from include and not from
+// exclude. They come in walk order, newest first by committer date, unless
+// order is "topo" or "date": then no commit comes before all of its
+// children have, and "topo" also keeps each line of history together.
+func listCommits(include []string, exclude []string, order string) ([]*Commit, error) {
+	excluded := make(map[string]bool)
+	err := walkParents(exclude, func(sha string) bool {
+		excluded[sha] = true
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	commits := make([]*Commit, 0)
+	err = walkCommits(include, func(commit *Commit) bool {
+		if !excluded[commit.sha] {
+			commits = append(commits, commit)
+		}
+		return true
+	})
+	if err != nil || order == "" {
+		return commits, err
+	}
+	return sortTopologically(commits, order == "date"), nil
+}
+
+// sortTopologically orders commits so each follows all of its children
+// among them. A commit is ready once its last child is out, and
+// ready commits are taken newest first with byDate, or otherwise the most
+// recently readied first, which follows one line of history down before
+// turning to the next.
+func sortTopologically(commits []*Commit, byDate bool) []*Commit {
+	children := make(map[string]int, len(commits))
+	for _, commit := range commits {
+		children[commit.sha] = 0
+	}
+	for _, commit := range commits {
+		for _, parent := range commit.Parents {
+			if _, ok := children[parent]; ok {
+				children[parent]++
+			}
+		}
+	}
+	bySHA := make(map[string]*Commit, len(commits))
+	ready := make([]*Commit, 0)
+	for _, commit := range commits {
+		bySHA[commit.sha] = commit
+		if children[commit.sha] == 0 {
+			ready = append(ready, commit)
+		}
+	}
+	if !byDate {
+		slices.Reverse(ready)
+	}
+
+	sorted := make([]*Commit, 0, len(commits))
+	for len(ready) > 0 {
+		var commit *Commit
+		if byDate {
+			sort.SliceStable(ready, func(i, j int) bool {
+				return parseSignature(ready[i].Committer).when.After(parseSignature(ready[j].Committer).when)
+			})
+			commit, ready = ready[0], ready[1:]
+		} else {
+			commit, ready = ready[len(ready)-1], ready[:len(ready)-1]
+		}
+		sorted = append(sorted, commit)
+		for _, parent := range commit.Parents {
+			if _, ok := children[parent]; !ok {
+				continue
+			}
+			if children[parent]--; children[parent] == 0 {
+				ready = append(ready, bySHA[parent])
+			}
+		}
+	}
+	return sorted
+}
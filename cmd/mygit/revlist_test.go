@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRevListMatchesGit(t *testing.T) {
+	requireGit(t)
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	date := 1700000000
+	commit := func(file string, parents ...string) string {
+		t.Helper()
+		writeFile(t, dir, file+".txt", file+"\n")
+		mygit(t, dir, "add", file+".txt")
+		args := []string{"commit-tree", strings.TrimSpace(mygit(t, dir, "write-tree")), "-m", file}
+		for _, parent := range parents {
+			args = append(args, "-p", parent)
+		}
+		return strings.TrimSpace(mygit(t, dir, args...))
+	}
+	at := func(seconds int) {
+		date = seconds
+		t.Setenv("GIT_COMMITTER_DATE", strconv.Itoa(date)+" +0000")
+	}
+
+	// Two branches off a root, one committed with a clock running behind,
+	// so that date and topological orders disagree.
+	at(1700000000)
+	root := commit("root")
+	at(1700000100)
+	a1 := commit("a1", root)
+	at(1700000050)
+	b1 := commit("b1", root)
+	at(1700000010)
+	b2 := commit("b2", b1)
+	at(1700000200)
+	a2 := commit("a2", a1)
+	merge := commit("merge", a2, b2)
+	at(1700000300)
+	side := commit("side", a1)
+	mygit(t, dir, "update-ref", "refs/heads/main", merge)
+	mygit(t, dir, "update-ref", "refs/heads/side", side)
+	mygit(t, dir, "tag", "-a", "-m", "tag", "v1", b1)
+
+	for _, args := range [][]string{
+		{"main"},
+		{"--all"},
+		{"--topo-order", "main"},
+		{"--date-order", "--all"},
+		{"--reverse", "main"},
+		{"--max-count=2", "main"},
+		{"-n", "3", "--all"},
+		{"-2", "--topo-order", "main"},
+		{"--skip=2", "main"},
+		{"--count", "--all"},
+		{"--parents", "main"},
+		{"side..main"},
+		{"main..side"},
+		{"main", "^" + b1},
+		{"main", "--not", "side"},
+		{"main...side"},
+		{"v1..main"},
+		{"--objects", "main"},
+		{"--objects", "v1", "side"},
+	} {
+		args = append([]string{"rev-list"}, args...)
+		if got, want := mygit(t, dir, args...), runGit(t, dir, args...); got != want {
+			t.Errorf("mygit %v:\n%v\ngit:\n%v", strings.Join(args, " "), got, want)
+		}
+	}
+
+	// git lists some of the objects an excluded commit also reaches; mygit
+	// leaves out every one of them, as a pack for a remote that has side
+	// would.
+	excluded := make(map[string]bool)
+	for _, line := range strings.Split(strings.TrimSpace(runGit(t, dir, "rev-list", "--objects", "side")), "\n") {
+		excluded[strings.Fields(line)[0]] = true
+	}
+	listed := make(map[string]bool)
+	for _, line := range strings.Split(strings.TrimSpace(mygit(t, dir, "rev-list", "--objects", "side..main")), "\n") {
+		listed[line] = true
+	}
+	for _, line := range strings.Split(strings.TrimSpace(runGit(t, dir, "rev-list", "--objects", "side..main")), "\n") {
+		sha := strings.Fields(line)[0]
+		if !listed[line] && !excluded[sha] {
+			t.Errorf("rev-list --objects side..main left out %v", line)
+		}
+		delete(listed, line)
+	}
+	for line := range listed {
+		t.Errorf("rev-list --objects side..main listed %v, which git doesn't", line)
+	}
+}
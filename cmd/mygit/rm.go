@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+)
+
+// rm removes paths from the index and, unless --cached, from the worktree
+// too. It refuses without -f to lose anything that cannot be got
+// back: content staged that HEAD does not have, or worktree changes that
+// were never staged. With --cached only content found in neither the file
+// nor HEAD stops it.
+func rm(args []string, stdout io.Writer) error {
+	cached, force, recursive, dryRun, ignoreUnmatch := false, false, false, false, false
+	pathspecs := make([]string, 0, len(args))
+	for index := 0; index < len(args); index++ {
+		switch arg := args[index]; {
+		case arg == "--":
+			pathspecs = append(pathspecs, args[index+1:]...)
+			index = len(args)
+		case arg == "--cached":
+			cached = true
+		case arg == "-f" || arg == "--force":
+			force = true
+		case arg == "-r":
+			recursive = true
+		case arg == "-n" || arg == "--dry-run":
+			dryRun = true
+		case arg == "-q" || arg == "--quiet":
+			stdout = io.Discard
+		case arg == "--ignore-unmatch":
+			ignoreUnmatch = true
+		case strings.HasPrefix(arg, "-"):
+			return failure.Usage("usage: git rm [-f | --force] [-n] [-r] [--cached] [--ignore-unmatch] [--quiet] [--] <pathspec>...")
+		default:
+			pathspecs = append(pathspecs, arg)
+		}
+	}
+	if len(pathspecs) == 0 {
+		return failure.Fatal("fatal: No pathspec was given. Which files should I remove?")
+	}
+
+	entries, err := readIndex()
+	if err != nil {
+		return err
+	}
+	removing := make(map[string]bool)
+	for _, arg := range pathspecs {
+		pathspec, err := worktreePath(arg)
+		if err != nil {
+			return err
+		}
+		matched := false
+		for _, entry := range entries {
+			if entry.path == pathspec {
+				removing[entry.path], matched = true, true
+				continue
+			}
+			if pathspec == "." || strings.HasPrefix(entry.path, pathspec+"/") {
+				if !recursive {
+					return failure.Fatalf("fatal: not removing '%v' recursively without -r", arg)
+				}
+				removing[entry.path], matched = true, true
+			}
+		}
+		if !matched && !ignoreUnmatch {
+			return failure.Fatalf("fatal: pathspec '%v' did not match any files", arg)
+		}
+	}
+
+	if !force {
+		headFiles, err := headTreeFiles()
+		if err != nil {
+			return err
+		}
+		bothChanged, stagedChanged, locallyChanged := make([]string, 0), make([]string, 0), make([]string, 0)
+		for _, entry := range entries {
+			// Conflicted entries hold nothing that is not also elsewhere.
+			if !removing[entry.path] || entry.stage() != 0 {
+				continue
+			}
+			// A file already gone from the worktree has nothing left to lose.
+			if _, err := os.Lstat(entry.path); err != nil {
+				continue
+			}
+			local, err := worktreeModified(entry)
+			if err != nil {
+				return err
+			}
+			headFile, inHead := headFiles[entry.path]
+			staged := !inHead || !sameTreeFile(headFile, treeFileFromIndex(entry))
+			switch {
+			case local && staged:
+				bothChanged = append(bothChanged, entry.path)
+			case cached:
+			case staged:
+				stagedChanged = append(stagedChanged, entry.path)
+			case local:
+				locallyChanged = append(locallyChanged, entry.path)
+			}
+		}
+		messages := make([]string, 0, 3)
+		refuse := func(paths []string, one string, many string, advice string) {
+			if len(paths) == 0 {
+				return
+			}
+			message := one
+			if len(paths) > 1 {
+				message = many
+			}
+			messages = append(messages, fmt.Sprintf("error: %v\n    %v\n%v", message, strings.Join(paths, "\n    "), advice))
+		}
+		refuse(bothChanged, "the following file has staged content different from both the\nfile and the HEAD:",
+			"the following files have staged content different from both the\nfile and the HEAD:", "(use -f to force removal)")
+		refuse(stagedChanged, "the following file has changes staged in the index:",
+			"the following files have changes staged in the index:", "(use --cached to keep the file, or -f to force removal)")
+		refuse(locallyChanged, "the following file has local modifications:",
+			"the following files have local modifications:", "(use --cached to keep the file, or -f to force removal)")
+		if len(messages) > 0 {
+			return errors.New(strings.Join(messages, "\n"))
+		}
+	}
+
+	kept := make([]IndexEntry, 0, len(entries))
+	removed := make([]string, 0, len(removing))
+	for _, entry := range entries {
+		if !removing[entry.path] {
+			kept = append(kept, entry)
+		} else if len(removed) == 0 || removed[len(removed)-1] != entry.path {
+			removed = append(removed, entry.path)
+			fmt.Fprintf(stdout, "rm '%v'\n", entry.path)
+		}
+	}
+	if dryRun {
+		return nil
+	}
+	if err := writeIndex(kept); err != nil {
+		return err
+	}
+	if cached {
+		return nil
+	}
+	for _, path := range removed {
+		if err := removeWorktreeFile(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRmAndMvMatchGit(t *testing.T) {
+	requireGit(t)
+	base := setupTest(t)
+	ours, theirs := filepath.Join(base, "ours"), filepath.Join(base, "theirs")
+	mygit(t, base, "init", ours)
+	runGit(t, base, "init", "-q", "-b", "main", theirs)
+	for _, dir := range []string{ours, theirs} {
+		for _, name := range []string{"a", "b", "c", "modified", "staged", "dir/x", "dir/sub/y", "keep"} {
+			writeFile(t, dir, name, name+"\n")
+		}
+		runGit(t, dir, "add", ".")
+		runGit(t, dir, "commit", "-q", "-m", "one")
+		writeFile(t, dir, "modified", "changed\n")
+		writeFile(t, dir, "staged", "changed\n")
+		runGit(t, dir, "add", "staged")
+		writeFile(t, dir, "untracked", "u\n")
+	}
+	git := func(args ...string) (string, int) {
+		t.Helper()
+		var output bytes.Buffer
+		command := exec.Command("git", args...)
+		command.Dir, command.Stdout, command.Stderr = theirs, &output, &output
+		var exitErr *exec.ExitError
+		if err := command.Run(); errors.As(err, &exitErr) {
+			return output.String(), exitErr.ExitCode()
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		return output.String(), 0
+	}
+
+	for _, args := range [][]string{
+		{"rm", "a"},
+		{"rm", "modified"},
+		{"rm", "staged"},
+		{"rm", "--cached", "staged"},
+		{"rm", "dir"},
+		{"rm", "-r", "--cached", "dir/sub"},
+		{"rm", "-q", "-f", "modified"},
+		{"rm", "untracked"},
+		{"rm", "nope"},
+		{"mv", "b", "renamed"},
+		{"mv", "renamed", "c"},
+		{"mv", "-f", "renamed", "c"},
+		{"mv", "c", "dir"},
+		{"mv", "dir", "moved"},
+		{"mv", "untracked", "elsewhere"},
+		{"mv", "-n", "keep", "kept"},
+		{"mv", "-v", "keep", "kept"},
+	} {
+		stdout, stderr, code := runIn(t, ours, "", args...)
+		want, wantCode := git(args...)
+		if stdout+stderr != want || code != wantCode {
+			t.Errorf("mygit %v: exit %v\n%v%v\ngit: exit %v\n%v", strings.Join(args, " "), code, stdout, stderr, wantCode, want)
+		}
+	}
+	if got, want := runGit(t, ours, "ls-files", "-s"), runGit(t, theirs, "ls-files", "-s"); got != want {
+		t.Errorf("the index after rm and mv:\n%v\nwant:\n%v", got, want)
+	}
+}
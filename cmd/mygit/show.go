@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+)
+
+// show prints objects the way git show does: a commit with its diff
+// against its first parent, an annotated tag's header and message followed
+// by the object it points at, a tree's entries and a blob's contents. -s
+// leaves the diffs out; --stat, --name-only and --name-status summarize
+// them instead.
+func show(args []string, stdout io.Writer) error {
+	options := diffOptions{context: 3}
+	noPatch, stat := false, false
+	revisions := make([]string, 0, 1)
+	for index := 0; index < len(args); index++ {
+		arg := args[index]
+		switch {
+		case arg == "--":
+			options.pathspecs = append(options.pathspecs, args[index+1:]...)
+			index = len(args)
+		case arg == "-s" || arg == "--no-patch":
+			noPatch = true
+		case arg == "--stat":
+			stat = true
+		case arg == "--name-only":
+			options.nameOnly = true
+		case arg == "--name-status":
+			options.nameStatus = true
+		case strings.HasPrefix(arg, "-U") || strings.HasPrefix(arg, "--unified="):
+			value := strings.TrimPrefix(strings.TrimPrefix(arg, "-U"), "--unified=")
+			context, err := strconv.Atoi(value)
+			if err != nil || context < 0 {
+				return failure.Usagef("error: %v expects a non-negative integer value", arg)
+			}
+			options.context = context
+		case strings.HasPrefix(arg, "-"):
+			return failure.Usagef("error: invalid option: %v", arg)
+		default:
+			revisions = append(revisions, arg)
+		}
+	}
+	for index, path := range options.pathspecs {
+		pathspec, err := worktreePath(path)
+		if err != nil {
+			return err
+		}
+		options.pathspecs[index] = pathspec
+	}
+	if len(revisions) == 0 {
+		revisions = append(revisions, "HEAD")
+	}
+
+	output := bufio.NewWriter(stdout)
+	defer output.Flush()
+	// Commits, tags and trees are set apart from whatever was
+	// shown before them by a blank line; blobs are copied out as they are.
+	shownOne := false
+	var showObject func(name string, sha string) error
+	showObject = func(name string, sha string) error {
+		currentType, err := objectType(sha)
+		if err != nil {
+			return err
+		}
+		switch currentType {
+		case "blob":
+			_, content, err := repository.ReadObject(sha)
+			if err != nil {
+				return err
+			}
+			_, err = output.Write(content)
+			return err
+		case "tree":
+			tree, err := repository.ReadTree(sha)
+			if err != nil {
+				return err
+			}
+			if shownOne {
+				output.WriteString("\n")
+			}
+			shownOne = true
+			fmt.Fprintf(output, "tree %v\n\n", name)
+			for _, entry := range tree.Entries {
+				entryName := entry.Name
+				if entry.IsTree() {
+					entryName += "/"
+				}
+				fmt.Fprintln(output, quotePath(entryName, false))
+			}
+			return nil
+		case "tag":
+			tag, err := repository.ReadTag(sha)
+			if err != nil {
+				return err
+			}
+			if shownOne {
+				output.WriteString("\n")
+			}
+			shownOne = true
+			fmt.Fprintf(output, "tag %v\n", tag.Name)
+			if tag.Tagger != "" {
+				tagger := parseSignature(tag.Tagger)
+				fmt.Fprintf(output, "Tagger: %v <%v>\nDate:   %v\n", tagger.name, tagger.email, tagger.when.Format(gitDateLayout))
+			}
+			if message := strings.TrimRight(tag.Message, "\n"); message != "" {
+				fmt.Fprintf(output, "\n%v\n", message)
+			}
+			// What the tag points at goes by the name it was asked for.
+			return showObject(name, tag.Object)
+		default:
+			commit, err := readCommit(sha)
+			if err != nil {
+				return err
+			}
+			if err := printCommit(commit, shownOne, output); err != nil {
+				return err
+			}
+			shownOne = true
+			if noPatch {
+				return nil
+			}
+			return showCommitDiff(commit, options, stat, output)
+		}
+	}
+	for _, revision := range revisions {
+		sha, err := resolveRevision(revision)
+		var fatal *failure.FatalError
+		if errors.As(err, &fatal) {
+			return err
+		}
+		if err != nil {
+			return failure.Fatalf("fatal: ambiguous argument '%v': unknown revision or path not in the working tree.\nUse '--' to separate paths from revisions, like this:\n'git <command> [<revision>...] -- [<file>...]'", revision)
+		}
+		if err := showObject(revision, sha); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// showCommitDiff prints what a commit changed from its first parent, or
+// from nothing for a root commit, after a blank line when there is any.
+func showCommitDiff(commit *Commit, options diffOptions, stat bool, stdout io.Writer) error {
+	oldFiles := make(map[string]DiffFile)
+	if len(commit.Parents) > 0 {
+		files, err := revisionFiles(commit.Parents[0])
+		if err != nil {
+			return err
+		}
+		oldFiles = files
+	}
+	newFiles, err := revisionFiles(commit.sha)
+	if err != nil {
+		return err
+	}
+	var changes bytes.Buffer
+	if stat {
+		err = writeDiffStat(oldFiles, newFiles, &changes)
+	} else {
+		_, err = writeDiff(oldFiles, newFiles, options, &changes)
+	}
+	if err != nil || changes.Len() == 0 {
+		return err
+	}
+	if _, err := io.WriteString(stdout, "\n"); err != nil {
+		return err
+	}
+	_, err = changes.WriteTo(stdout)
+	return err
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestShowMatchesGit(t *testing.T) {
+	requireGit(t)
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	writeFile(t, dir, "d/b", "b\n")
+	mygit(t, dir, "add", "d/b")
+	commitFile(t, dir, "a", "a\n", "one")
+	writeFile(t, dir, "a", "a\nc\n")
+	mygit(t, dir, "add", "a")
+	mygit(t, dir, "commit", "-m", "two\n\nWith a body.")
+	mygit(t, dir, "tag", "-a", "-m", "tag message", "v1")
+	mygit(t, dir, "tag", "-a", "-m", "tree tag", "treetag", "HEAD^{tree}")
+
+	for _, args := range [][]string{
+		{"show"},
+		{"show", "HEAD~1"},
+		{"show", "-s", "HEAD"},
+		{"show", "--stat", "HEAD"},
+		{"show", "--name-only", "HEAD"},
+		{"show", "--name-status", "HEAD"},
+		{"show", "HEAD^{tree}"},
+		{"show", "HEAD:d"},
+		{"show", "HEAD:a"},
+		{"show", "v1"},
+		{"show", "treetag"},
+		{"show", "HEAD:a", "HEAD~1:a"},
+	} {
+		if got, want := mygit(t, dir, args...), runGit(t, dir, args...); got != want {
+			t.Errorf("mygit %v:\n%v\ngit:\n%v", strings.Join(args, " "), got, want)
+		}
+	}
+	if _, stderr, code := runIn(t, dir, "", "show", "nope"); code != 128 || !strings.Contains(stderr, "fatal: ambiguous argument 'nope'") {
+		t.Errorf("show of an unknown revision: exit %v\n%v", code, stderr)
+	}
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+	"github.com/codecrafters-io/git-starter-go/pkg/config"
+	"github.com/codecrafters-io/git-starter-go/pkg/objects"
+)
+
+// signingPrograms are the programs each gpg.format signs and verifies with
+// unless gpg.<format>.program names another.
+var signingPrograms = map[string]string{"openpgp": "gpg", "x509": "gpgsm", "ssh": "ssh-keygen"}
+
+// signingFormat returns gpg.format, openpgp unless set, and the program
+// that handles it.
+func signingFormat(cfg *config.Config) (string, string, error) {
+	format, ok := cfg.Get("gpg.format")
+	if !ok {
+		format = "openpgp"
+	}
+	if _, known := signingPrograms[format]; !known {
+		return "", "", fmt.Errorf("error: unsupported value for gpg.format: %v", format)
+	}
+	return format, signingProgram(cfg, format), nil
+}
+
+// signingProgram returns the program for format, honoring gpg.program as
+// the older name of gpg.openpgp.program.
+func signingProgram(cfg *config.Config, format string) string {
+	if program, ok := cfg.Get("gpg." + format + ".program"); ok {
+		return program
+	}
+	if program, ok := cfg.Get("gpg.program"); ok && format == "openpgp" {
+		return program
+	}
+	return signingPrograms[format]
+}
+
+// signingKey returns the key a new signature is made with: the one asked
+// for, else user.signingKey. Without either, gpg signs as the committer and
+// ssh-keygen with the first key gpg.ssh.defaultKeyCommand prints.
+func signingKey(requested string) (string, error) {
+	if requested != "" {
+		return requested, nil
+	}
+	cfg, err := repository.Config()
+	if err != nil {
+		return "", err
+	}
+	if key, ok := cfg.Get("user.signingkey"); ok && key != "" {
+		return key, nil
+	}
+	if format, _, err := signingFormat(cfg); err != nil {
+		return "", err
+	} else if format != "ssh" {
+		committer, err := committerIdentity()
+		if err != nil {
+			return "", err
+		}
+		return committer[:strings.LastIndex(committer, ">")+1], nil
+	}
+	if keyCommand, ok := cfg.Get("gpg.ssh.defaultkeycommand"); ok {
+		output, err := exec.Command("sh", "-c", keyCommand).Output()
+		if err != nil {
+			return "", failure.Fatalf("fatal: gpg.ssh.defaultKeyCommand failed: %v", strings.TrimSpace(keyCommand))
+		}
+		for _, line := range strings.Split(string(output), "\n") {
+			if strings.HasPrefix(line, "ssh-") || strings.HasPrefix(line, "key::") {
+				return line, nil
+			}
+		}
+	}
+	return "", failure.Fatal("fatal: either user.signingkey or gpg.ssh.defaultKeyCommand needs to be configured")
+}
+
+// signPayload signs payload with key in the format gpg.format names,
+// returning the armored signature.
+func signPayload(payload []byte, key string) ([]byte, error) {
+	cfg, err := repository.Config()
+	if err != nil {
+		return nil, err
+	}
+	format, program, err := signingFormat(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if format == "ssh" {
+		return signWithSSH(program, payload, key)
+	}
+	// gpg reports through its status lines whether it signed.
+	var signature, status bytes.Buffer
+	command := exec.Command(program, "--status-fd=2", "-bsau", key)
+	command.Stdin, command.Stdout, command.Stderr = bytes.NewReader(payload), &signature, &status
+	if err := command.Run(); err != nil || signature.Len() == 0 || !strings.Contains("\n"+status.String(), "\n[GNUPG:] SIG_CREATED ") {
+		return nil, errors.New("error: gpg failed to sign the data")
+	}
+	return bytes.ReplaceAll(signature.Bytes(), []byte("\r\n"), []byte("\n")), nil
+}
+
+// signWithSSH signs payload with ssh-keygen -Y sign. key is a private key
+// file, or a public key written out as "key::<key>" or plainly as
+// "ssh-<type> <key>" whose private half ssh-agent holds.
+func signWithSSH(program string, payload []byte, key string) ([]byte, error) {
+	args := []string{"-Y", "sign", "-n", "git"}
+	literal, isLiteral := strings.CutPrefix(key, "key::")
+	if isLiteral || strings.HasPrefix(key, "ssh-") {
+		if !isLiteral {
+			literal = key
+		}
+		keyFile, err := writeTempFile(".git_signing_key_tmp", []byte(literal+"\n"))
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(keyFile)
+		args = append(args, "-f", keyFile, "-U")
+	} else {
+		args = append(args, "-f", expandHome(key))
+	}
+	bufferFile, err := writeTempFile(".git_signing_buffer_tmp", payload)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(bufferFile)
+	defer os.Remove(bufferFile + ".sig")
+
+	var stderr bytes.Buffer
+	command := exec.Command(program, append(args, bufferFile)...)
+	command.Stderr = &stderr
+	if err := command.Run(); err != nil {
+		if strings.Contains(stderr.String(), "usage:") {
+			return nil, errors.New("error: ssh-keygen -Y sign is needed for ssh signing (available in openssh version 8.2p1+)")
+		}
+		return nil, fmt.Errorf("error: %v", stderr.String())
+	}
+	signature, err := os.ReadFile(bufferFile + ".sig")
+	if err != nil {
+		return nil, fmt.Errorf("error: failed reading ssh signing data buffer from '%v'", bufferFile+".sig")
+	}
+	return bytes.ReplaceAll(signature, []byte("\r\n"), []byte("\n")), nil
+}
+
+// signatureCheck is what verifying a signature found: the program's
+// human-readable report, its machine-readable status, which ssh-keygen
+// does not separate, and whether the signature is good.
+type signatureCheck struct {
+	output string
+	status string
+	good   bool
+}
+
+// verifySignature checks signature over payload with the program for the
+// format the signature is in, whatever gpg.format says. signed is when the
+// object claims to have been made, which ssh-keygen checks the key was
+// valid at.
+func verifySignature(payload []byte, signature []byte, signed time.Time) (*signatureCheck, error) {
+	cfg, err := repository.Config()
+	if err != nil {
+		return nil, err
+	}
+	format := "openpgp"
+	switch {
+	case bytes.HasPrefix(signature, []byte("-----BEGIN SSH SIGNATURE-----")):
+		format = "ssh"
+	case bytes.HasPrefix(signature, []byte("-----BEGIN SIGNED MESSAGE-----")):
+		format = "x509"
+	}
+	program := signingProgram(cfg, format)
+	signatureFile, err := writeTempFile(".git_vtag_tmp", signature)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(signatureFile)
+	if format == "ssh" {
+		return verifyWithSSH(cfg, program, payload, signatureFile, signed)
+	}
+
+	var status, output bytes.Buffer
+	command := exec.Command(program, "--keyid-format=long", "--status-fd=1", "--verify", signatureFile, "-")
+	command.Stdin, command.Stdout, command.Stderr = bytes.NewReader(payload), &status, &output
+	if err := command.Run(); err != nil && output.Len() == 0 {
+		return nil, fmt.Errorf("error: could not run %v", program)
+	}
+	good := strings.Contains("\n"+status.String(), "\n[GNUPG:] GOODSIG ")
+	return &signatureCheck{output: output.String(), status: status.String(), good: good}, nil
+}
+
+// verifyWithSSH checks an ssh signature against gpg.ssh.allowedSignersFile.
+// ssh-keygen first finds the principals allowed to sign with the
+// key; a key none of them has is reported, but never good.
+func verifyWithSSH(cfg *config.Config, program string, payload []byte, signatureFile string, signed time.Time) (*signatureCheck, error) {
+	allowedSigners, ok := cfg.Get("gpg.ssh.allowedsignersfile")
+	if !ok {
+		return nil, errors.New("error: gpg.ssh.allowedSignersFile needs to be configured and exist for ssh signature verification")
+	}
+	allowedSigners = expandHome(allowedSigners)
+	timeArgs := make([]string, 0, 1)
+	if !signed.IsZero() {
+		timeArgs = append(timeArgs, "-Overify-time="+signed.UTC().Format("20060102150405"))
+	}
+
+	var principals, output, messages bytes.Buffer
+	command := exec.Command(program, append([]string{"-Y", "find-principals", "-f", allowedSigners, "-s", signatureFile}, timeArgs...)...)
+	command.Stdout, command.Stderr = &principals, &messages
+	err := command.Run()
+	if err != nil && strings.Contains(messages.String(), "usage:") {
+		return nil, errors.New("error: ssh-keygen -Y find-principals/verify is needed for ssh signature verification (available in openssh version 8.2p1+)")
+	}
+	good := false
+	if err != nil || principals.Len() == 0 {
+		command := exec.Command(program, append([]string{"-Y", "check-novalidate", "-n", "git", "-s", signatureFile}, timeArgs...)...)
+		command.Stdin, command.Stdout, command.Stderr = bytes.NewReader(payload), &output, &messages
+		command.Run()
+	} else {
+		for _, principal := range strings.Fields(principals.String()) {
+			args := append([]string{"-Y", "verify", "-n", "git", "-f", allowedSigners, "-I", principal, "-s", signatureFile}, timeArgs...)
+			if revocations, ok := cfg.Get("gpg.ssh.revocationfile"); ok {
+				args = append(args, "-r", expandHome(revocations))
+			}
+			output.Reset()
+			command := exec.Command(program, args...)
+			command.Stdin, command.Stdout, command.Stderr = bytes.NewReader(payload), &output, &messages
+			if good = command.Run() == nil; good {
+				break
+			}
+		}
+	}
+	output.Write(messages.Bytes())
+	return &signatureCheck{output: output.String(), status: output.String(), good: good}, nil
+}
+
+// writeTempFile stores content in a new temporary file named after prefix
+// and returns its path.
+func writeTempFile(prefix string, content []byte) (string, error) {
+	file, err := os.CreateTemp("", prefix)
+	if err != nil {
+		return "", fmt.Errorf("error: could not create temporary file: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(content); err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("error: failed writing temporary file '%v': %w", file.Name(), err)
+	}
+	return file.Name(), nil
+}
+
+// expandHome expands a leading "~/" in a configured path.
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
+
+// commitSigning is what a command's options ask of the commits it makes:
+// -S, with a key attached or not, and --gpg-sign[=<key>] sign them,
+// --no-gpg-sign does not, and otherwise commit.gpgSign decides.
+type commitSigning struct {
+	requested bool
+	disabled  bool
+	key       string
+}
+
+// option takes up arg when it is one of the signing options.
+func (signing *commitSigning) option(arg string) bool {
+	switch {
+	case arg == "--no-gpg-sign":
+		signing.requested, signing.disabled, signing.key = false, true, ""
+	case strings.HasPrefix(arg, "-S"):
+		signing.requested, signing.disabled, signing.key = true, false, strings.TrimPrefix(arg, "-S")
+	case arg == "--gpg-sign" || strings.HasPrefix(arg, "--gpg-sign="):
+		signing.requested, signing.disabled, signing.key = true, false, strings.TrimPrefix(strings.TrimPrefix(arg, "--gpg-sign"), "=")
+	default:
+		return false
+	}
+	return true
+}
+
+// commitKey returns the key to sign with, or "" when the commit is not
+// to be signed.
+func (signing *commitSigning) commitKey() (string, error) {
+	if !signing.requested && !signing.disabled {
+		cfg, err := repository.Config()
+		if err != nil {
+			return "", err
+		}
+		if sign, _ := cfg.Get("commit.gpgsign"); sign == "true" {
+			return signingKey("")
+		}
+	}
+	if !signing.requested {
+		return "", nil
+	}
+	return signingKey(signing.key)
+}
+
+// signCommitObject adds a signature made with key to a commit object, in
+// the header for the repository's hash.
+func signCommitObject(content []byte, key string) ([]byte, error) {
+	signature, err := signPayload(content, key)
+	if err != nil {
+		return nil, err
+	}
+	return objects.AddCommitSignature(content, objects.SignatureHeader(repository.Algorithm), signature), nil
+}
+
+// verifyCommit checks the signatures of commits, printing what the signing
+// program reports to stderr, or its raw status lines with --raw. -v first
+// prints each commit without its signature.
+func verifyCommit(args []string, stdout io.Writer, stderr io.Writer) error {
+	return verifyObjects(args, "commit", stdout, stderr)
+}
+
+// verifyTag checks the signatures of annotated tags as verifyCommit does
+// commits.
+func verifyTag(args []string, stdout io.Writer, stderr io.Writer) error {
+	return verifyObjects(args, "tag", stdout, stderr)
+}
+
+// verifyObjects verifies each object named in args, all of objectType,
+// and fails silently, after the reports, unless every signature is good.
+func verifyObjects(args []string, objectType string, stdout io.Writer, stderr io.Writer) error {
+	verbose, raw := false, false
+	names := make([]string, 0, len(args))
+	for _, arg := range args {
+		switch {
+		case arg == "-v" || arg == "--verbose":
+			verbose = true
+		case arg == "--raw":
+			raw = true
+		case strings.HasPrefix(arg, "-"):
+			return failure.Usagef("usage: git verify-%v [-v | --verbose] [--raw] <%v>...", objectType, objectType)
+		default:
+			names = append(names, arg)
+		}
+	}
+	if len(names) == 0 {
+		return failure.Usagef("usage: git verify-%v [-v | --verbose] [--raw] <%v>...", objectType, objectType)
+	}
+
+	failed := false
+	for _, name := range names {
+		sha, err := resolveRevision(name)
+		if err != nil {
+			fmt.Fprintf(stderr, "error: %v '%v' not found.\n", objectType, name)
+			failed = true
+			continue
+		}
+		currentType, content, err := repository.ReadObject(sha)
+		if err != nil {
+			return err
+		}
+		if currentType != objectType {
+			fmt.Fprintf(stderr, "error: %v: cannot verify a non-%v object of type %v.\n", name, objectType, currentType)
+			failed = true
+			continue
+		}
+
+		var payload, signature []byte
+		var signed time.Time
+		if objectType == "commit" {
+			payload, signature = objects.SplitCommitSignature(content, objects.SignatureHeader(repository.Algorithm))
+			if commit, err := objects.ParseCommit(content); err == nil {
+				signed = parseSignature(commit.Committer).when
+			}
+		} else {
+			payload, signature = objects.SplitTagSignature(content)
+			if tag, err := objects.ParseTag(content); err == nil {
+				signed = parseSignature(tag.Tagger).when
+			}
+		}
+		if verbose {
+			stdout.Write(payload)
+		}
+		if signature == nil {
+			// Only an unsigned tag is worth a word.
+			if objectType == "tag" {
+				fmt.Fprintln(stderr, "error: no signature found")
+			}
+			failed = true
+			continue
+		}
+		check, err := verifySignature(payload, signature, signed)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			failed = true
+			continue
+		}
+		if raw {
+			io.WriteString(stderr, check.status)
+		} else {
+			io.WriteString(stderr, check.output)
+		}
+		failed = failed || !check.good
+	}
+	if failed {
+		return errSilentFailure
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSSHSignedCommitsAndTagsVerify(t *testing.T) {
+	requireGit(t)
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen is not installed")
+	}
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	key := filepath.Join(t.TempDir(), "key")
+	if out, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", "test", "-f", key).CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen: %v\n%s", err, out)
+	}
+	public, err := os.ReadFile(key + ".pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, dir, "allowed", "author@example.com "+string(public))
+	mygit(t, dir, "config", "gpg.format", "ssh")
+	mygit(t, dir, "config", "user.signingKey", key)
+	mygit(t, dir, "config", "gpg.ssh.allowedSignersFile", filepath.Join(dir, "allowed"))
+
+	writeFile(t, dir, "f", "f\n")
+	mygit(t, dir, "add", "f")
+	mygit(t, dir, "commit", "-S", "-m", "signed")
+	mygit(t, dir, "tag", "-s", "-m", "signed tag", "v1")
+	if raw := mygit(t, dir, "cat-file", "commit", "HEAD"); !strings.Contains(raw, "\ngpgsig -----BEGIN SSH SIGNATURE-----\n") {
+		t.Errorf("the signed commit:\n%v", raw)
+	}
+
+	// git accepts the signatures, and mygit accepts them as git does.
+	for _, args := range [][]string{{"verify-commit", "HEAD"}, {"verify-tag", "v1"}} {
+		runGit(t, dir, args...)
+		_, stderr, code := runIn(t, dir, "", args...)
+		if code != 0 || !strings.Contains(stderr, `Good "git" signature for author@example.com with ED25519 key`) {
+			t.Errorf("mygit %v: exit %v\n%v", strings.Join(args, " "), code, stderr)
+		}
+	}
+
+	commitFile(t, dir, "f", "g\n", "unsigned")
+	if _, _, code := runIn(t, dir, "", "verify-commit", "HEAD"); code != 1 {
+		t.Errorf("verify-commit of an unsigned commit exited %v", code)
+	}
+	// Signed, but by a key the allowed signers don't list.
+	other := filepath.Join(t.TempDir(), "other")
+	if out, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", "test", "-f", other).CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen: %v\n%s", err, out)
+	}
+	if public, err = os.ReadFile(other + ".pub"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, dir, "allowed", "author@example.com "+string(public))
+	if _, stderr, code := runIn(t, dir, "", "verify-commit", "HEAD~1"); code != 1 || !strings.Contains(stderr, "No principal matched.") {
+		t.Errorf("verify-commit of a commit signed by an unknown key: exit %v\n%v", code, stderr)
+	}
+}
+
+func TestGPGSignedCommitsVerify(t *testing.T) {
+	requireGit(t)
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg is not installed")
+	}
+	dir := setupTest(t)
+	// gpg-agent's socket lives in the home, and a test directory's path
+	// can be too long for one.
+	home, err := os.MkdirTemp("", "gnupg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		exec.Command("gpgconf", "--homedir", home, "--kill", "all").Run()
+		os.RemoveAll(home)
+	})
+	t.Setenv("GNUPGHOME", home)
+	if out, err := exec.Command("gpg", "--batch", "--passphrase", "", "--quick-gen-key", "A U Thor <author@example.com>", "ed25519", "sign", "never").CombinedOutput(); err != nil {
+		t.Skipf("gpg cannot make a key here: %v\n%s", err, out)
+	}
+	mygit(t, dir, "init")
+	writeFile(t, dir, "f", "f\n")
+	mygit(t, dir, "add", "f")
+	mygit(t, dir, "commit", "-S", "-m", "signed")
+	if raw := mygit(t, dir, "cat-file", "commit", "HEAD"); !strings.Contains(raw, "\ngpgsig -----BEGIN PGP SIGNATURE-----\n") {
+		t.Errorf("the signed commit:\n%v", raw)
+	}
+	runGit(t, dir, "verify-commit", "HEAD")
+	if _, stderr, code := runIn(t, dir, "", "verify-commit", "HEAD"); code != 0 || !strings.Contains(stderr, `Good signature from "A U Thor <author@example.com>"`) {
+		t.Errorf("mygit verify-commit: exit %v\n%v", code, stderr)
+	}
+}
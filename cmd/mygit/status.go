@@ -0,0 +1,602 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+	"github.com/codecrafters-io/git-starter-go/pkg/ignore"
+	"github.com/codecrafters-io/git-starter-go/pkg/objects"
+	"github.com/codecrafters-io/git-starter-go/pkg/repo"
+)
+
+// TreeFile is a blob (or gitlink) reached by flattening a tree.
+type TreeFile struct {
+	mode string
+	hash []byte
+}
+
+// flattenTree maps every non-tree path under treeSHA to its mode and hash.
+// A tree holding a name that cannot be checked out, such as .git or .., is
+// refused, so no caller ever writes it into the worktree or the index.
+func flattenTree(treeSHA string) (map[string]TreeFile, error) {
+	files := make(map[string]TreeFile)
+	if treeSHA == "" {
+		return files, nil
+	}
+	var walk func(treeSHA string, prefix string) error
+	walk = func(treeSHA string, prefix string) error {
+		tree, err := repository.ReadTree(treeSHA)
+		if err != nil {
+			return err
+		}
+		for _, entry := range tree.Entries {
+			if objects.CheckEntryName(entry.Name) != nil {
+				return failure.Fatalf("error: invalid path '%v'", prefix+entry.Name)
+			}
+			if entry.IsTree() {
+				if err := walk(hex.EncodeToString(entry.Hash), prefix+entry.Name+"/"); err != nil {
+					return err
+				}
+				continue
+			}
+			files[prefix+entry.Name] = TreeFile{mode: entry.Mode, hash: entry.Hash}
+		}
+		return nil
+	}
+	return files, walk(treeSHA, "")
+}
+
+// headTreeFiles flattens the tree of the HEAD commit; an unborn HEAD is empty.
+func headTreeFiles() (map[string]TreeFile, error) {
+	headSHA, err := resolveHead()
+	if err != nil {
+		return nil, err
+	}
+	if headSHA == "" {
+		return flattenTree("")
+	}
+	treeSHA, err := commitTreeSHA(headSHA)
+	if err != nil {
+		return nil, err
+	}
+	return flattenTree(treeSHA)
+}
+
+// worktreeFile hashes a working tree path the way add would stage it, without
+// writing the blob. A nested repository is the gitlink to the commit it has
+// checked out.
+func worktreeFile(path string, info fs.FileInfo) (TreeFile, error) {
+	if info.IsDir() {
+		if !repo.IsSubmodule(path) {
+			return TreeFile{}, fmt.Errorf("error: '%v/' does not have a commit checked out", path)
+		}
+		hash, err := repo.SubmoduleHead(path)
+		if err != nil {
+			return TreeFile{}, err
+		}
+		return TreeFile{mode: "160000", hash: hash}, nil
+	}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return TreeFile{}, fmt.Errorf("Error reading symlink %v: %w", path, err)
+		}
+		return TreeFile{mode: "120000", hash: objects.Hash(repository.Algorithm, "blob", []byte(target))}, nil
+	}
+	hash, err := hashFileBlob(path)
+	if err != nil {
+		return TreeFile{}, err
+	}
+	mode := "100644"
+	if info.Mode()&0111 != 0 {
+		mode = "100755"
+	}
+	return TreeFile{mode: mode, hash: hash}, nil
+}
+
+// worktreeEntryFile is worktreeFile for the path of an index entry. A
+// gitlink whose submodule was never cloned, leaving an empty directory, has
+// no commit to compare, so it is taken to hold the one recorded.
+func worktreeEntryFile(entry IndexEntry, info fs.FileInfo) (TreeFile, error) {
+	if entry.mode == 0160000 && info.IsDir() && !repo.IsSubmodule(entry.path) {
+		return treeFileFromIndex(entry), nil
+	}
+	return worktreeFile(entry.path, info)
+}
+
+// hashFileBlob returns the blob name of a file without storing it, with
+// its line endings converted as add would.
+func hashFileBlob(path string) ([]byte, error) {
+	if repository.ConvertsLineEndings() {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading file %v: %w", path, err)
+		}
+		return objects.Hash(repository.Algorithm, objects.TypeBlob, repository.CleanContent(content)), nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading file %v: %w", path, err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("Error reading file %v: %w", path, err)
+	}
+	return objects.HashReader(repository.Algorithm, objects.TypeBlob, info.Size(), file)
+}
+
+// indexEntryMatchesStat reports whether the cached stat data still describes
+// the file, letting callers skip rehashing it.
+func indexEntryMatchesStat(entry IndexEntry, info fs.FileInfo) bool {
+	mtime := info.ModTime()
+	return entry.mtimeSeconds == uint32(mtime.Unix()) &&
+		entry.mtimeNanos == uint32(mtime.Nanosecond()) &&
+		entry.size == uint32(info.Size())
+}
+
+type statusReport struct {
+	branch    string
+	detached  string
+	unborn    bool
+	staged    map[string]byte
+	unstaged  map[string]byte
+	untracked []string
+	// unmerged holds the two-letter short status of each conflicted path,
+	// and merging is set while MERGE_HEAD records a merge to conclude.
+	unmerged map[string]string
+	merging  bool
+	// newCommits holds the submodules whose checked-out commit is not the
+	// one staged.
+	newCommits map[string]bool
+}
+
+// unmergedCodes maps the index stages a conflicted path has, as a bit set of
+// stages 1 to 3, to its short status.
+var unmergedCodes = map[int]string{
+	1: "DD", 2: "AU", 3: "UD", 4: "UA", 5: "DU", 6: "AA", 7: "UU",
+}
+
+func collectStatus() (*statusReport, error) {
+	report := &statusReport{staged: map[string]byte{}, unstaged: map[string]byte{}, unmerged: map[string]string{}, newCommits: map[string]bool{}}
+	headRef, isSymref, err := readHeadSymref()
+	if err != nil {
+		return nil, err
+	}
+	headSHA, err := resolveHead()
+	if err != nil {
+		return nil, err
+	}
+	if isSymref {
+		report.branch = strings.TrimPrefix(headRef, "refs/heads/")
+	} else {
+		report.detached = headSHA
+	}
+	report.unborn = headSHA == ""
+
+	headFiles, err := headTreeFiles()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := readIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = repository.Refs.Read("MERGE_HEAD")
+	report.merging = err == nil
+
+	indexed := make(map[string]IndexEntry, len(entries))
+	stages := make(map[string]int)
+	for _, entry := range entries {
+		indexed[entry.path] = entry
+		if entry.stage() != 0 {
+			stages[entry.path] |= 1 << (entry.stage() - 1)
+			continue
+		}
+		headFile, inHead := headFiles[entry.path]
+		switch {
+		case !inHead:
+			report.staged[entry.path] = 'A'
+		case headFile.mode != fmt.Sprintf("%o", entry.mode) || !bytes.Equal(headFile.hash, entry.hash):
+			report.staged[entry.path] = 'M'
+		}
+
+		info, err := os.Lstat(entry.path)
+		if err != nil {
+			report.unstaged[entry.path] = 'D'
+			continue
+		}
+		// A gitlink's directory says nothing of the commit checked out in it.
+		if entry.mode != 0160000 && indexEntryMatchesStat(entry, info) && fs.FileMode(entry.mode)&0111 == info.Mode()&0111 {
+			continue
+		}
+		file, err := worktreeEntryFile(entry, info)
+		if err != nil {
+			return nil, err
+		}
+		if file.mode != fmt.Sprintf("%o", entry.mode) || !bytes.Equal(file.hash, entry.hash) {
+			report.unstaged[entry.path] = 'M'
+			report.newCommits[entry.path] = entry.mode == 0160000 && file.mode == "160000"
+		}
+	}
+	for path, mask := range stages {
+		report.unmerged[path] = unmergedCodes[mask]
+	}
+	for path := range headFiles {
+		if _, ok := indexed[path]; !ok {
+			report.staged[path] = 'D'
+		}
+	}
+
+	report.untracked, err = untrackedPaths(".", indexed)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// untrackedPaths lists files under dir that are neither in the index nor
+// ignored, collapsing directories that contain no tracked files to "dir/".
+func untrackedPaths(dir string, indexed map[string]IndexEntry) ([]string, error) {
+	ignores, err := repository.Ignores()
+	if err != nil {
+		return nil, err
+	}
+	trackedDirs := make(map[string]bool)
+	for path := range indexed {
+		for parent := filepath.Dir(path); parent != "."; parent = filepath.Dir(parent) {
+			trackedDirs[parent] = true
+		}
+	}
+
+	untracked := make([]string, 0)
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		path = filepath.ToSlash(path)
+		if d.IsDir() {
+			if path == "." {
+				return nil
+			}
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			if _, ok := indexed[path]; ok {
+				// A gitlink's files belong to its own repository.
+				return filepath.SkipDir
+			}
+			if !trackedDirs[path] {
+				if !ignores.Ignored(path, true) && hasUnignoredFiles(path, ignores) {
+					untracked = append(untracked, path+"/")
+				}
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if _, ok := indexed[path]; !ok && !ignores.Ignored(path, false) {
+			untracked = append(untracked, path)
+		}
+		return nil
+	})
+	sort.Strings(untracked)
+	return untracked, err
+}
+
+func hasUnignoredFiles(dir string, ignores *ignore.Matcher) bool {
+	found := errors.New("found")
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if path == dir {
+			return nil
+		}
+		if d.IsDir() && (d.Name() == ".git" || ignores.Ignored(filepath.ToSlash(path), true)) {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() && !ignores.Ignored(filepath.ToSlash(path), false) {
+			return found
+		}
+		return nil
+	})
+	return err == found
+}
+
+func status(args []string, stdout io.Writer) error {
+	short, branch := false, false
+	for _, arg := range args {
+		switch arg {
+		case "-s", "--short":
+			short = true
+		case "-b", "--branch":
+			branch = true
+		case "-sb", "-bs":
+			short, branch = true, true
+		default:
+			return failure.Usage("usage: status [-s] [-b]")
+		}
+	}
+	report, err := collectStatus()
+	if err != nil {
+		return err
+	}
+	if short {
+		if branch {
+			if err := printShortBranch(report, stdout); err != nil {
+				return err
+			}
+		}
+		printShortStatus(report, stdout)
+	} else {
+		printLongStatus(report, stdout)
+	}
+	return nil
+}
+
+// printShortBranch writes the "## " header of status -sb: the branch, the
+// upstream it tracks and how far the two have moved apart.
+func printShortBranch(report *statusReport, stdout io.Writer) error {
+	switch {
+	case report.branch == "":
+		fmt.Fprintln(stdout, "## HEAD (no branch)")
+		return nil
+	case report.unborn:
+		fmt.Fprintf(stdout, "## No commits yet on %v\n", report.branch)
+		return nil
+	}
+	header := "## " + report.branch
+	cfg, err := repository.Config()
+	if err != nil {
+		return err
+	}
+	upstream, ok := branchUpstream(cfg, report.branch)
+	if !ok {
+		fmt.Fprintln(stdout, header)
+		return nil
+	}
+	header += "..." + shortRefName(upstream)
+	upstreamSHA, err := repository.Refs.Read(upstream)
+	if err != nil {
+		fmt.Fprintln(stdout, header+" [gone]")
+		return nil
+	}
+	if _, resolved, err := repository.Refs.Resolve(upstream); err == nil {
+		upstreamSHA = resolved
+	}
+	headSHA, err := resolveHead()
+	if err != nil {
+		return err
+	}
+	ahead, behind, err := aheadBehind(headSHA, upstreamSHA)
+	if err != nil {
+		return err
+	}
+	counts := make([]string, 0, 2)
+	if ahead > 0 {
+		counts = append(counts, fmt.Sprintf("ahead %v", ahead))
+	}
+	if behind > 0 {
+		counts = append(counts, fmt.Sprintf("behind %v", behind))
+	}
+	if len(counts) > 0 {
+		header += " [" + strings.Join(counts, ", ") + "]"
+	}
+	fmt.Fprintln(stdout, header)
+	return nil
+}
+
+// aheadBehind counts the commits reachable from ours but not theirs, and
+// from theirs but not ours.
+func aheadBehind(ours string, theirs string) (int, int, error) {
+	reachable := func(start string) (map[string]bool, error) {
+		seen := make(map[string]bool)
+		err := walkParents([]string{start}, func(sha string) bool {
+			seen[sha] = true
+			return true
+		})
+		return seen, err
+	}
+	fromOurs, err := reachable(ours)
+	if err != nil {
+		return 0, 0, err
+	}
+	fromTheirs, err := reachable(theirs)
+	if err != nil {
+		return 0, 0, err
+	}
+	ahead, behind := 0, 0
+	for sha := range fromOurs {
+		if !fromTheirs[sha] {
+			ahead++
+		}
+	}
+	for sha := range fromTheirs {
+		if !fromOurs[sha] {
+			behind++
+		}
+	}
+	return ahead, behind, nil
+}
+
+func printShortStatus(report *statusReport, stdout io.Writer) {
+	paths := make(map[string]bool)
+	for path := range report.staged {
+		paths[path] = true
+	}
+	for path := range report.unstaged {
+		paths[path] = true
+	}
+	for path := range report.unmerged {
+		paths[path] = true
+	}
+	sorted := make([]string, 0, len(paths))
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+
+	for _, path := range sorted {
+		if code, ok := report.unmerged[path]; ok {
+			fmt.Fprintf(stdout, "%v %v\n", code, quotePath(displayPath(path), true))
+			continue
+		}
+		x, y := report.staged[path], report.unstaged[path]
+		if x == 0 {
+			x = ' '
+		}
+		if y == 0 {
+			y = ' '
+		}
+		fmt.Fprintf(stdout, "%c%c %v\n", x, y, quotePath(displayPath(path), true))
+	}
+	for _, path := range report.untracked {
+		fmt.Fprintf(stdout, "?? %v\n", quotePath(displayPath(path), true))
+	}
+}
+
+var statusLabels = map[byte]string{
+	'A': "new file:   ",
+	'M': "modified:   ",
+	'D': "deleted:    ",
+}
+
+var unmergedLabels = map[string]string{
+	"DD": "both deleted:    ",
+	"AU": "added by us:     ",
+	"UD": "deleted by them: ",
+	"UA": "added by them:   ",
+	"DU": "deleted by us:   ",
+	"AA": "both added:      ",
+	"UU": "both modified:   ",
+}
+
+func printLongStatus(report *statusReport, stdout io.Writer) {
+	if report.branch != "" {
+		fmt.Fprintf(stdout, "On branch %v\n", report.branch)
+	} else {
+		fmt.Fprintf(stdout, "HEAD detached at %v\n", report.detached[:7])
+	}
+	if report.unborn {
+		fmt.Fprint(stdout, "\nNo commits yet\n\n")
+	}
+	switch {
+	case report.merging && len(report.unmerged) > 0:
+		fmt.Fprint(stdout, "You have unmerged paths.\n  (fix conflicts and run \"git commit\")\n  (use \"git merge --abort\" to abort the merge)\n\n")
+	case report.merging:
+		fmt.Fprint(stdout, "All conflicts fixed but you are still merging.\n  (use \"git commit\" to conclude merge)\n\n")
+	}
+
+	printSection := func(title string, hints []string, changes map[string]byte, notes map[string]bool) {
+		if len(changes) == 0 {
+			return
+		}
+		fmt.Fprintf(stdout, "%v:\n", title)
+		for _, hint := range hints {
+			fmt.Fprintf(stdout, "  (%v)\n", hint)
+		}
+		paths := make([]string, 0, len(changes))
+		for path := range changes {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			note := ""
+			if notes[path] {
+				note = " (new commits)"
+			}
+			fmt.Fprintf(stdout, "\t%v%v%v\n", statusLabels[changes[path]], quotePath(displayPath(path), false), note)
+		}
+		fmt.Fprintln(stdout)
+	}
+
+	unstagedHints := []string{`use "git add <file>..." to update what will be committed`, `use "git restore <file>..." to discard changes in working directory`}
+	for _, change := range report.unstaged {
+		if change == 'D' {
+			unstagedHints[0] = `use "git add/rm <file>..." to update what will be committed`
+		}
+	}
+	stagedHint := `use "git restore --staged <file>..." to unstage`
+	if report.unborn {
+		stagedHint = `use "git rm --cached <file>..." to unstage`
+	}
+
+	printSection("Changes to be committed", []string{stagedHint}, report.staged, nil)
+	if len(report.unmerged) > 0 {
+		fmt.Fprint(stdout, "Unmerged paths:\n  (use \"git add/rm <file>...\" as appropriate to mark resolution)\n")
+		paths := make([]string, 0, len(report.unmerged))
+		for path := range report.unmerged {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			fmt.Fprintf(stdout, "\t%v%v\n", unmergedLabels[report.unmerged[path]], quotePath(displayPath(path), false))
+		}
+		fmt.Fprintln(stdout)
+	}
+	printSection("Changes not staged for commit", unstagedHints, report.unstaged, report.newCommits)
+	if len(report.untracked) > 0 {
+		fmt.Fprint(stdout, "Untracked files:\n")
+		fmt.Fprintln(stdout, `  (use "git add <file>..." to include in what will be committed)`)
+		for _, path := range report.untracked {
+			fmt.Fprintf(stdout, "\t%v\n", quotePath(displayPath(path), false))
+		}
+		fmt.Fprintln(stdout)
+	}
+
+	switch {
+	case len(report.staged) > 0:
+	case len(report.unstaged) > 0 || len(report.unmerged) > 0:
+		fmt.Fprintln(stdout, `no changes added to commit (use "git add" and/or "git commit -a")`)
+	case len(report.untracked) > 0:
+		fmt.Fprintln(stdout, `nothing added to commit but untracked files present (use "git add" to track)`)
+	case report.unborn:
+		fmt.Fprintln(stdout, `nothing to commit (create/copy files and use "git add" to track)`)
+	default:
+		fmt.Fprintln(stdout, "nothing to commit, working tree clean")
+	}
+}
+
+// quotePath applies git's core.quotePath rules. Short status output also
+// quotes paths containing spaces, which quoteSpaces selects.
+func quotePath(path string, quoteSpaces bool) string {
+	needsQuoting := false
+	for i := 0; i < len(path); i++ {
+		if c := path[i]; c < 0x20 || c >= 0x7f || c == '"' || c == '\\' || c == ' ' && quoteSpaces {
+			needsQuoting = true
+			break
+		}
+	}
+	if !needsQuoting {
+		return path
+	}
+	var quoted strings.Builder
+	quoted.WriteByte('"')
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; {
+		case c == '"' || c == '\\':
+			quoted.WriteByte('\\')
+			quoted.WriteByte(c)
+		case c == '\t':
+			quoted.WriteString(`\t`)
+		case c == '\n':
+			quoted.WriteString(`\n`)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&quoted, `\%03o`, c)
+		default:
+			quoted.WriteByte(c)
+		}
+	}
+	quoted.WriteByte('"')
+	return quoted.String()
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStatusComparesGitlinksWithSubmoduleHead(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	writeFile(t, dir, "a", "a\n")
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	mygit(t, sub, "init")
+	commitFile(t, sub, "s", "s\n", "s")
+	mygit(t, dir, "add", ".")
+	mygit(t, dir, "commit", "-m", "outer")
+
+	// The submodule's own files are neither untracked nor modified.
+	writeFile(t, sub, "loose", "loose\n")
+	if got := mygit(t, dir, "status", "--short"); got != "" {
+		t.Errorf("status --short with the recorded commit checked out:\n%v", got)
+	}
+
+	commitFile(t, sub, "s", "t\n", "t")
+	if got := mygit(t, dir, "status", "--short"); got != " M sub\n" {
+		t.Errorf("status --short after a commit in the submodule = %q", got)
+	}
+	if got := mygit(t, dir, "status"); !strings.Contains(got, "\tmodified:   sub (new commits)\n") {
+		t.Errorf("status does not report the new commits:\n%v", got)
+	}
+	if got := mygit(t, dir, "diff"); !strings.Contains(got, "index ") || !strings.Contains(got, " 160000\n") {
+		t.Errorf("diff does not show the gitlink change:\n%v", got)
+	}
+
+	// A submodule that was never cloned is an empty directory, which holds
+	// whatever commit is recorded.
+	if err := os.RemoveAll(sub); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if got := mygit(t, dir, "status", "--short"); got != "" {
+		t.Errorf("status --short with the submodule not cloned:\n%v", got)
+	}
+}
+
+func TestStatusShortBranch(t *testing.T) {
+	base := setupTest(t)
+	source := filepath.Join(base, "source")
+	if err := os.Mkdir(source, 0755); err != nil {
+		t.Fatal(err)
+	}
+	mygit(t, source, "init")
+	if got := mygit(t, source, "status", "-sb"); got != "## No commits yet on main\n" {
+		t.Errorf("status -sb on an unborn branch = %q", got)
+	}
+	commitFile(t, source, "a", "a\n", "first")
+	if got := mygit(t, source, "status", "--short", "--branch"); got != "## main\n" {
+		t.Errorf("status -sb without an upstream = %q", got)
+	}
+
+	mygit(t, base, "clone", "source", "clone")
+	work := filepath.Join(base, "clone")
+	if got := mygit(t, work, "status", "-sb"); got != "## main...origin/main\n" {
+		t.Errorf("status -sb after clone = %q", got)
+	}
+	commitFile(t, work, "b", "b\n", "ours")
+	commitFile(t, work, "c", "c\n", "ours too")
+	commitFile(t, source, "d", "d\n", "theirs")
+	mygit(t, work, "fetch")
+	writeFile(t, work, "b", "changed\n")
+	if got, want := mygit(t, work, "status", "-s", "-b"), "## main...origin/main [ahead 2, behind 1]\n M b\n"; got != want {
+		t.Errorf("status -sb after diverging = %q, want %q", got, want)
+	}
+
+	writeFile(t, work, ".git/config", "[branch \"main\"]\n\tremote = origin\n\tmerge = refs/heads/gone\n[remote \"origin\"]\n\tfetch = +refs/heads/*:refs/remotes/origin/*\n")
+	if got := mygit(t, work, "status", "-sb"); !strings.HasPrefix(got, "## main...origin/gone [gone]\n") {
+		t.Errorf("status -sb with the upstream gone = %q", got)
+	}
+	mygit(t, work, "checkout", "--detach", "main")
+	if got := mygit(t, work, "status", "-sb"); !strings.HasPrefix(got, "## HEAD (no branch)\n") {
+		t.Errorf("status -sb detached = %q", got)
+	}
+}
+
+func TestStatusNormalizesLineEndingsUnderAutoCRLF(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	writeFile(t, dir, ".git/config", "[core]\n\tautocrlf = true\n")
+	commitFile(t, dir, "a.txt", "one\ntwo\n", "first")
+	writeFile(t, dir, "a.txt", "one\r\ntwo\r\n")
+	if got := mygit(t, dir, "status", "--short"); got != "" {
+		t.Errorf("status of a CRLF copy of an LF blob: got %q, want it clean", got)
+	}
+	if got := mygit(t, dir, "diff"); got != "" {
+		t.Errorf("diff of a CRLF copy of an LF blob: got %q", got)
+	}
+
+	writeFile(t, dir, "b.txt", "three\r\n")
+	mygit(t, dir, "add", "b.txt")
+	mygit(t, dir, "commit", "-m", "second")
+	if got := mygit(t, dir, "cat-file", "-p", "HEAD:b.txt"); got != "three\n" {
+		t.Errorf("add stored %q, want LF line endings", got)
+	}
+	writeFile(t, dir, "b.txt", "three\r\nfour\r\n")
+	if got := mygit(t, dir, "status", "--short"); got != " M b.txt\n" {
+		t.Errorf("status after a real change: got %q", got)
+	}
+}
+
+func TestStatusListsStagedUnstagedAndUntracked(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	for _, name := range []string{"a", "b", "c"} {
+		writeFile(t, dir, name, name+"\n")
+	}
+	writeFile(t, dir, ".gitignore", "*.log\n")
+	mygit(t, dir, "add", ".")
+	mygit(t, dir, "commit", "-m", "one")
+
+	writeFile(t, dir, "a", "staged\n")
+	mygit(t, dir, "add", "a")
+	writeFile(t, dir, "a", "and then changed\n")
+	writeFile(t, dir, "b", "changed\n")
+	if err := os.Remove(filepath.Join(dir, "c")); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, dir, "new", "new\n")
+	mygit(t, dir, "add", "new")
+	writeFile(t, dir, "untracked", "u\n")
+	writeFile(t, dir, "dir/z", "z\n")
+	writeFile(t, dir, "x.log", "ignored\n")
+
+	if got, want := mygit(t, dir, "status", "-s"), "MM a\n M b\n D c\nA  new\n?? dir/\n?? untracked\n"; got != want {
+		t.Errorf("status -s:\n%v\nwant:\n%v", got, want)
+	}
+	want := "On branch main\n" +
+		"Changes to be committed:\n" +
+		"  (use \"git restore --staged <file>...\" to unstage)\n" +
+		"\tmodified:   a\n" +
+		"\tnew file:   new\n" +
+		"\n" +
+		"Changes not staged for commit:\n" +
+		"  (use \"git add/rm <file>...\" to update what will be committed)\n" +
+		"  (use \"git restore <file>...\" to discard changes in working directory)\n" +
+		"\tmodified:   a\n" +
+		"\tmodified:   b\n" +
+		"\tdeleted:    c\n" +
+		"\n" +
+		"Untracked files:\n" +
+		"  (use \"git add <file>...\" to include in what will be committed)\n" +
+		"\tdir/\n" +
+		"\tuntracked\n" +
+		"\n"
+	if got := mygit(t, dir, "status"); got != want {
+		t.Errorf("status:\n%v\nwant:\n%v", got, want)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"cmp"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+	"github.com/codecrafters-io/git-starter-go/pkg/objects"
+	"github.com/codecrafters-io/git-starter-go/pkg/refs"
+)
+
+func tag(args []string, stdout io.Writer) error {
+	annotate, deleteMode, listMode, force := false, false, false, false
+	sign, noSign, signKey := false, false, ""
+	sortKey := ""
+	messages := make([]string, 0, 1)
+	positional := make([]string, 0, 2)
+	for index := 0; index < len(args); index++ {
+		switch arg := args[index]; {
+		case arg == "-a" || arg == "--annotate":
+			annotate = true
+		case arg == "-d" || arg == "--delete":
+			deleteMode = true
+		case arg == "-l" || arg == "--list":
+			listMode = true
+		case arg == "-f" || arg == "--force":
+			force = true
+		case arg == "-s" || arg == "--sign":
+			sign, noSign = true, false
+		case arg == "--no-sign":
+			sign, noSign = false, true
+		case arg == "-u" && index+1 < len(args):
+			index++
+			sign, noSign, signKey = true, false, args[index]
+		case strings.HasPrefix(arg, "--local-user="):
+			sign, noSign, signKey = true, false, strings.TrimPrefix(arg, "--local-user=")
+		case arg == "-m" && index+1 < len(args):
+			index++
+			messages = append(messages, args[index])
+		case strings.HasPrefix(arg, "--message="):
+			messages = append(messages, strings.TrimPrefix(arg, "--message="))
+		case strings.HasPrefix(arg, "--sort="):
+			sortKey, listMode = strings.TrimPrefix(arg, "--sort="), true
+		case strings.HasPrefix(arg, "-"):
+			return failure.Usage("usage: tag [-a | -s | -u <key-id>] [-f] [-m <msg>] <tagname> [<object>] | tag -d <tagname>... | tag [-l] [--sort=<key>] [<pattern>...]")
+		default:
+			positional = append(positional, arg)
+		}
+	}
+
+	switch {
+	case deleteMode:
+		if len(positional) == 0 {
+			return failure.Usage("usage: tag -d <tagname>...")
+		}
+		for _, name := range positional {
+			refName := "refs/tags/" + name
+			sha, err := repository.Refs.Read(refName)
+			if err != nil {
+				return fmt.Errorf("error: tag '%v' not found.", name)
+			}
+			if err := repository.Refs.Delete(refName); err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "Deleted tag '%v' (was %v)\n", name, sha[:7])
+		}
+		return nil
+
+	case listMode || len(positional) == 0:
+		return listTags(positional, sortKey, stdout)
+
+	case len(positional) > 2:
+		return failure.Usage("usage: tag [-a | -s | -u <key-id>] [-f] [-m <msg>] <tagname> [<object>]")
+	}
+
+	name := positional[0]
+	if err := checkRefName(name); err != nil {
+		return failure.Fatalf("fatal: '%v' is not a valid tag name.", name)
+	}
+	refName := "refs/tags/" + name
+	if _, err := repository.Refs.Read(refName); err == nil && !force {
+		return failure.Fatalf("fatal: tag '%v' already exists", name)
+	}
+
+	targetSHA, err := resolveHead()
+	if err != nil {
+		return err
+	}
+	if len(positional) == 2 {
+		if targetSHA, err = resolveRevision(positional[1]); err != nil {
+			return failure.Fatalf("fatal: Failed to resolve '%v' as a valid ref.", positional[1])
+		}
+	}
+	if targetSHA == "" {
+		return failure.Fatal("fatal: Failed to resolve 'HEAD' as a valid ref.")
+	}
+
+	// tag.gpgSign signs every annotated tag; -s and -u imply one.
+	if annotate || sign || len(messages) > 0 {
+		if len(messages) == 0 {
+			return failure.Fatal("fatal: no tag message given; use -m <msg>")
+		}
+		if !sign && !noSign {
+			cfg, err := repository.Config()
+			if err != nil {
+				return err
+			}
+			configured, _ := cfg.Get("tag.gpgsign")
+			sign = configured == "true"
+		}
+		if sign {
+			if signKey, err = signingKey(signKey); err != nil {
+				return err
+			}
+		}
+		message := strings.TrimRight(strings.Join(messages, "\n\n"), "\n")
+		hash, err := createTagObject(targetSHA, name, message, signKey)
+		if err != nil {
+			return err
+		}
+		targetSHA = hex.EncodeToString(hash)
+	}
+	return repository.Refs.Write(refName, targetSHA)
+}
+
+// listTags prints the tags matching any of patterns, or all of them, in
+// the order sortKey asks for: refname, the default, or version:refname,
+// which compares runs of digits as numbers so v1.10 follows v1.9. A
+// leading "-" reverses it. Without --sort, tag.sort sets the key.
+func listTags(patterns []string, sortKey string, stdout io.Writer) error {
+	if sortKey == "" {
+		cfg, err := repository.Config()
+		if err != nil {
+			return err
+		}
+		sortKey, _ = cfg.Get("tag.sort")
+	}
+	tags, err := repository.Refs.List("refs/tags/")
+	if err != nil {
+		return err
+	}
+	key, reverse := strings.CutPrefix(sortKey, "-")
+	switch key {
+	case "", "refname":
+	case "version:refname", "v:refname":
+		slices.SortStableFunc(tags, func(a, b refs.Ref) int { return compareVersions(a.Name, b.Name) })
+	default:
+		return failure.Fatalf("fatal: unsupported sort specification '%v'", sortKey)
+	}
+	if reverse {
+		slices.Reverse(tags)
+	}
+	for _, ref := range tags {
+		name := strings.TrimPrefix(ref.Name, "refs/tags/")
+		matched := len(patterns) == 0
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, name); ok {
+				matched = true
+			}
+		}
+		if matched {
+			fmt.Fprintln(stdout, name)
+		}
+	}
+	return nil
+}
+
+// compareVersions orders two names as version numbers: runs of digits
+// compare by their value and everything else byte by byte.
+func compareVersions(a string, b string) int {
+	isDigit := func(c byte) bool { return c >= '0' && c <= '9' }
+	for len(a) > 0 && len(b) > 0 {
+		if !isDigit(a[0]) || !isDigit(b[0]) {
+			if a[0] != b[0] {
+				return cmp.Compare(a[0], b[0])
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+		aEnd, bEnd := 0, 0
+		for aEnd < len(a) && isDigit(a[aEnd]) {
+			aEnd++
+		}
+		for bEnd < len(b) && isDigit(b[bEnd]) {
+			bEnd++
+		}
+		aNumber, bNumber := strings.TrimLeft(a[:aEnd], "0"), strings.TrimLeft(b[:bEnd], "0")
+		if order := cmp.Compare(len(aNumber), len(bNumber)); order != 0 {
+			return order
+		}
+		if order := strings.Compare(aNumber, bNumber); order != 0 {
+			return order
+		}
+		a, b = a[aEnd:], b[bEnd:]
+	}
+	return cmp.Compare(len(a), len(b))
+}
+
+// createTagObject writes an annotated tag object pointing at targetSHA,
+// signed with signKey unless it is empty. The signature follows the
+// message, covering everything before it.
+func createTagObject(targetSHA string, name string, message string, signKey string) ([]byte, error) {
+	targetType, err := objectType(targetSHA)
+	if err != nil {
+		return nil, err
+	}
+	tagger, err := committerIdentity()
+	if err != nil {
+		return nil, err
+	}
+	tag := &objects.Tag{
+		Object:  targetSHA,
+		Type:    targetType,
+		Name:    name,
+		Tagger:  tagger,
+		Message: message + "\n",
+	}
+	content := tag.Encode()
+	if signKey != "" {
+		signature, err := signPayload(content, signKey)
+		if err != nil {
+			return nil, fmt.Errorf("%w\nerror: unable to sign the tag", err)
+		}
+		content = append(content, signature...)
+	}
+	return repository.WriteObject(objects.TypeTag, content)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTagSortVersion(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	commitFile(t, dir, "a", "a\n", "first")
+	for _, name := range []string{"v1.10", "v2.0", "v1.2", "v1.9"} {
+		mygit(t, dir, "tag", name)
+	}
+
+	for _, test := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"tag"}, "v1.10\nv1.2\nv1.9\nv2.0\n"},
+		{[]string{"tag", "--sort=refname"}, "v1.10\nv1.2\nv1.9\nv2.0\n"},
+		{[]string{"tag", "--sort=-refname"}, "v2.0\nv1.9\nv1.2\nv1.10\n"},
+		{[]string{"tag", "--sort=version:refname"}, "v1.2\nv1.9\nv1.10\nv2.0\n"},
+		{[]string{"tag", "-l", "--sort=-v:refname", "v1.*"}, "v1.10\nv1.9\nv1.2\n"},
+	} {
+		if got := mygit(t, dir, test.args...); got != test.want {
+			t.Errorf("%v:\n%v\nwant:\n%v", test.args, got, test.want)
+		}
+	}
+
+	writeFile(t, dir, ".git/config", "[tag]\n\tsort = version:refname\n")
+	if got, want := mygit(t, dir, "tag"), "v1.2\nv1.9\nv1.10\nv2.0\n"; got != want {
+		t.Errorf("tag with tag.sort set:\n%v\nwant:\n%v", got, want)
+	}
+	if _, _, code := runIn(t, dir, "", "tag", "--sort=bogus"); code != 128 {
+		t.Errorf("tag --sort=bogus exited %v", code)
+	}
+}
+
+func TestTagAnnotatedAndLightweight(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	commit := commitFile(t, dir, "a", "a\n", "first")
+	mygit(t, dir, "tag", "light")
+	mygit(t, dir, "tag", "-a", "-m", "release one", "v1")
+
+	if got := strings.TrimSpace(mygit(t, dir, "rev-parse", "light")); got != commit {
+		t.Errorf("light = %v, want the commit %v", got, commit)
+	}
+	if got := mygit(t, dir, "cat-file", "-t", "v1"); got != "tag\n" {
+		t.Errorf("v1 is a %v", got)
+	}
+	want := "object " + commit + "\ntype commit\ntag v1\ntagger A U Thor <author@example.com> 1700000000 +0000\n\nrelease one\n"
+	if got := mygit(t, dir, "cat-file", "-p", "v1"); got != want {
+		t.Errorf("cat-file -p v1:\n%v\nwant:\n%v", got, want)
+	}
+	if got := strings.TrimSpace(mygit(t, dir, "rev-parse", "v1^{commit}")); got != commit {
+		t.Errorf("v1^{commit} = %v", got)
+	}
+
+	second := commitFile(t, dir, "a", "b\n", "second")
+	if _, stderr, code := runIn(t, dir, "", "tag", "light"); code != 128 || !strings.Contains(stderr, "tag 'light' already exists") {
+		t.Errorf("tag of an existing name: exit %v\n%v", code, stderr)
+	}
+	mygit(t, dir, "tag", "-f", "light")
+	if got := strings.TrimSpace(mygit(t, dir, "rev-parse", "light")); got != second {
+		t.Errorf("light after tag -f = %v, want %v", got, second)
+	}
+	tag := strings.TrimSpace(mygit(t, dir, "rev-parse", "v1"))
+	if got := mygit(t, dir, "tag", "-d", "v1"); got != "Deleted tag 'v1' (was "+tag[:7]+")\n" {
+		t.Errorf("tag -d v1 printed %q", got)
+	}
+	if got := mygit(t, dir, "tag"); got != "light\n" {
+		t.Errorf("tag after deleting v1:\n%v", got)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	for _, test := range []struct {
+		a, b string
+		want int
+	}{
+		{"v1.2", "v1.10", -1},
+		{"v1.10", "v1.9", 1},
+		{"v2.0", "v1.10", 1},
+		{"v1.02", "v1.2", 0},
+		{"v1.2", "v1.2.1", -1},
+		{"v1.2-rc1", "v1.2-rc2", -1},
+		{"a", "b", -1},
+	} {
+		if got := compareVersions(test.a, test.b); got != test.want {
+			t.Errorf("compareVersions(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+)
+
+// transport carries the pkt-line protocol between us and one service on a
+// remote, git-upload-pack or git-receive-pack. Over smart HTTP every request
+// is a separate POST; over SSH, git:// and to a local repository they share
+// the one connection, whose service reads each request in turn.
+type transport interface {
+	// request sends body, a complete request, and returns the response.
+	// Closing it does not end the connection.
+	request(body []byte) (io.ReadCloser, error)
+	// close ends the connection.
+	close() error
+}
+
+// connect starts service on the remote at repoURL and returns the transport
+// with the pkt-lines the service opens with, flush packets as nil. protocol,
+// such as "version=2", asks for a protocol version the server may ignore.
+// Canceling ctx ends the connection: the command running the service is
+// killed, and a request or read in progress fails. What that command and
+// any credential helper print goes to stderr.
+func connect(ctx context.Context, repoURL string, service string, protocol string, stderr io.Writer) (transport, [][]byte, error) {
+	if host, port, path, ok := parseSSHURL(repoURL); ok {
+		return connectSSH(ctx, host, port, path, service, protocol, stderr)
+	}
+	if strings.HasPrefix(repoURL, "http://") || strings.HasPrefix(repoURL, "https://") {
+		return connectHTTP(ctx, repoURL, service, protocol, stderr)
+	}
+	if strings.HasPrefix(repoURL, "git://") {
+		return connectDaemon(ctx, repoURL, service, protocol)
+	}
+	if path, ok := localRepositoryPath(repoURL); ok {
+		return connectLocal(ctx, path, service, stderr)
+	}
+	if scheme, _, found := strings.Cut(repoURL, "://"); found {
+		return nil, nil, failure.Fatalf("fatal: Unable to find remote helper for '%v'", scheme)
+	}
+	return nil, nil, failure.Fatalf("fatal: '%v' does not appear to be a git repository", repoURL)
+}
+
+// isRemoteURL reports whether name is a URL, an scp-like address or the
+// path of a directory rather than the name of a configured remote.
+func isRemoteURL(name string) bool {
+	_, _, _, isSSH := parseSSHURL(name)
+	if isSSH || strings.Contains(name, "://") {
+		return true
+	}
+	info, err := os.Stat(name)
+	return err == nil && info.IsDir()
+}
+
+// localRepositoryPath returns the path a file:// URL or a plain path names.
+// Anything with a ":" before its first "/" is not a path.
+func localRepositoryPath(repoURL string) (string, bool) {
+	if path, ok := strings.CutPrefix(repoURL, "file://"); ok {
+		return path, path != ""
+	}
+	if _, _, _, isSSH := parseSSHURL(repoURL); isSSH || strings.Contains(repoURL, "://") {
+		return "", false
+	}
+	return repoURL, repoURL != ""
+}
+
+// anonymizeURL drops the user name, and any password, from a URL or
+// scp-like address so it can be shown.
+func anonymizeURL(repoURL string) string {
+	prefix, rest := "", repoURL
+	end := -1
+	if scheme, after, found := strings.Cut(repoURL, "://"); found {
+		prefix, rest = scheme+"://", after
+		end = strings.Index(rest, "/")
+	} else if _, _, _, ok := parseSSHURL(repoURL); ok {
+		end = strings.Index(rest, ":")
+	}
+	if end < 0 {
+		end = len(rest)
+	}
+	if at := strings.LastIndex(rest[:end], "@"); at >= 0 {
+		rest = rest[at+1:]
+	}
+	return prefix + rest
+}
+
+// httpTransport speaks the smart HTTP protocol: the advertisement comes from
+// GET info/refs and each request is POSTed to the service. A user name and
+// password in the URL are sent as basic auth; otherwise they are asked for
+// when the server answers 401.
+type httpTransport struct {
+	ctx        context.Context
+	url        string
+	service    string
+	protocol   string
+	credential *credential
+}
+
+func connectHTTP(ctx context.Context, repoURL string, service string, protocol string, stderr io.Writer) (transport, [][]byte, error) {
+	remoteURL, err := url.Parse(repoURL)
+	if err != nil {
+		return nil, nil, failure.Fatalf("fatal: unable to parse URL '%v'", anonymizeURL(repoURL))
+	}
+	connection := &httpTransport{ctx: ctx, service: service, protocol: protocol, credential: newCredential(remoteURL, stderr)}
+	remoteURL.User = nil
+	connection.url = remoteURL.String()
+
+	response, err := connection.do(http.MethodGet, connection.url+"/info/refs?service="+service, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("Failed to fetch refs from %v: %v", connection.url, response.Status)
+	}
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lines, err := readPktLines(body)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case len(lines) > 0 && strings.HasPrefix(string(lines[0]), "# service="+service):
+		// The header is followed by a flush packet.
+		return connection, lines[min(2, len(lines)):], nil
+	case protocol != "" && len(lines) > 0 && string(lines[0]) == "version 2\n":
+		// Protocol v2 servers may leave the header out.
+		return connection, lines, nil
+	default:
+		return nil, nil, fmt.Errorf("%v is not a smart HTTP git server", connection.url)
+	}
+}
+
+func (connection *httpTransport) request(body []byte) (io.ReadCloser, error) {
+	response, err := connection.do(http.MethodPost, connection.url+"/"+connection.service, body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return nil, fmt.Errorf("Failed to run %v on %v: %v", connection.service, connection.url, response.Status)
+	}
+	return response.Body, nil
+}
+
+// do sends one request, filling in the credential and sending it again when
+// the server asks for authentication. A credential that works is passed to
+// the helpers to store; one that is refused is erased and the request fails.
+func (connection *httpTransport) do(method string, target string, body []byte) (*http.Response, error) {
+	credential := connection.credential
+	for {
+		request, err := http.NewRequestWithContext(connection.ctx, method, target, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		if method == http.MethodPost {
+			request.Header.Set("Content-Type", "application/x-"+connection.service+"-request")
+		}
+		if connection.protocol != "" {
+			request.Header.Set("Git-Protocol", connection.protocol)
+		}
+		if credential.password != "" {
+			request.SetBasicAuth(credential.username, credential.password)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			return nil, failure.Fatalf("fatal: unable to access '%v/': %w", connection.url, err)
+		}
+		if response.StatusCode != http.StatusUnauthorized {
+			if response.StatusCode == http.StatusOK {
+				credential.approve()
+			}
+			return response, nil
+		}
+		response.Body.Close()
+		if credential.password != "" {
+			credential.reject()
+			return nil, failure.Fatalf("fatal: Authentication failed for '%v/'", connection.url)
+		}
+		if err := credential.fill(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (connection *httpTransport) close() error {
+	return nil
+}
+
+// streamTransport talks to the service over one two-way stream: the stdin
+// and stdout of ssh or of a local mygit, or a git:// connection. The
+// command's own messages go straight to our stderr, as with git.
+type streamTransport struct {
+	w io.WriteCloser
+	r *bufio.Reader
+	// wait waits for the command to exit, or closes the connection.
+	wait func() error
+}
+
+// parseSSHURL splits ssh://[user@]host[:port]/path URLs and scp-like
+// [user@]host:path addresses. A "/~" at the start of a URL path makes it
+// relative to a home directory, as the scp-like form always is.
+func parseSSHURL(repoURL string) (string, string, string, bool) {
+	for _, scheme := range []string{"ssh://", "git+ssh://", "ssh+git://"} {
+		rest, ok := strings.CutPrefix(repoURL, scheme)
+		if !ok {
+			continue
+		}
+		authority, path, _ := strings.Cut(rest, "/")
+		path = "/" + path
+		if strings.HasPrefix(path, "/~") {
+			path = path[1:]
+		}
+		user, hostPort := "", authority
+		if at := strings.LastIndex(authority, "@"); at >= 0 {
+			user, hostPort = authority[:at+1], authority[at+1:]
+		}
+		hostname, port, _ := strings.Cut(hostPort, ":")
+		host := user + hostname
+		return host, port, path, hostname != ""
+	}
+	if strings.Contains(repoURL, "://") {
+		return "", "", "", false
+	}
+	host, path, found := strings.Cut(repoURL, ":")
+	if !found || host == "" || strings.Contains(host, "/") {
+		return "", "", "", false
+	}
+	return host, "", path, true
+}
+
+func connectSSH(ctx context.Context, host string, port string, path string, service string, protocol string, stderr io.Writer) (transport, [][]byte, error) {
+	args := make([]string, 0, 6)
+	if protocol != "" {
+		args = append(args, "-o", "SendEnv=GIT_PROTOCOL")
+	}
+	if port != "" {
+		args = append(args, "-p", port)
+	}
+	args = append(args, host, service+" "+shellQuote(path))
+
+	// GIT_SSH_COMMAND and core.sshCommand are run by the shell
+	// and GIT_SSH names the program itself.
+	program, shell := os.Getenv("GIT_SSH_COMMAND"), true
+	if program == "" {
+		if cfg, err := repository.Config(); err == nil {
+			program, _ = cfg.Get("core.sshCommand")
+		}
+	}
+	if program == "" {
+		program, shell = os.Getenv("GIT_SSH"), false
+	}
+	if program == "" {
+		program = "ssh"
+	}
+	command := exec.CommandContext(ctx, program, args...)
+	if shell {
+		command = exec.CommandContext(ctx, "sh", append([]string{"-c", program + ` "$@"`, program}, args...)...)
+	}
+	if protocol != "" {
+		command.Env = append(os.Environ(), "GIT_PROTOCOL="+protocol)
+	}
+	return startCommand(ctx, command, program, stderr)
+}
+
+// connectLocal runs the service of this mygit on a repository on disk, with
+// the caller's repository hidden from it.
+func connectLocal(ctx context.Context, path string, service string, stderr io.Writer) (transport, [][]byte, error) {
+	program, err := os.Executable()
+	if err != nil {
+		return nil, nil, err
+	}
+	command := exec.CommandContext(ctx, program, strings.TrimPrefix(service, "git-"), path)
+	command.Env = slices.DeleteFunc(os.Environ(), func(variable string) bool {
+		return strings.HasPrefix(variable, "GIT_DIR=") || strings.HasPrefix(variable, "GIT_WORK_TREE=")
+	})
+	return startCommand(ctx, command, program, stderr)
+}
+
+// startCommand starts a command that runs the service and reads its
+// advertisement, passing on what it prints to stderr. Canceling ctx kills
+// the command and closes our end of its stdout, which whatever the command
+// started may still hold open.
+func startCommand(ctx context.Context, command *exec.Cmd, program string, stderr io.Writer) (transport, [][]byte, error) {
+	command.Stderr = stderr
+	stdin, err := command.StdinPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	stdout, err := command.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := command.Start(); err != nil {
+		return nil, nil, failure.Fatalf("fatal: cannot run %v: %w", program, err)
+	}
+	stop := context.AfterFunc(ctx, func() { stdout.Close() })
+	wait := func() error {
+		stop()
+		return command.Wait()
+	}
+	return readAdvertisement(&streamTransport{w: stdin, r: bufio.NewReader(stdout), wait: wait})
+}
+
+// connectDaemon asks a git daemon for the service on the repository a
+// git://host[:port]/path URL names. The request carries the host the URL
+// names and, after an empty field, the protocol version we would like.
+func connectDaemon(ctx context.Context, repoURL string, service string, protocol string) (transport, [][]byte, error) {
+	remoteURL, err := url.Parse(repoURL)
+	if err != nil || remoteURL.Hostname() == "" {
+		return nil, nil, failure.Fatalf("fatal: unable to parse URL '%v'", repoURL)
+	}
+	address := remoteURL.Host
+	if remoteURL.Port() == "" {
+		address = net.JoinHostPort(remoteURL.Hostname(), "9418")
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, nil, failure.Fatalf("fatal: unable to connect to %v:\n%w", remoteURL.Hostname(), err)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	request := service + " " + remoteURL.Path + "\x00host=" + remoteURL.Host + "\x00"
+	if protocol != "" {
+		request += "\x00" + protocol + "\x00"
+	}
+	if _, err := io.WriteString(conn, pktLine(request)); err != nil {
+		stop()
+		conn.Close()
+		return nil, nil, failure.Fatalf("fatal: unable to connect to %v:\n%w", remoteURL.Hostname(), err)
+	}
+	wait := func() error {
+		stop()
+		return conn.Close()
+	}
+	return readAdvertisement(&streamTransport{w: halfCloser{conn.(*net.TCPConn)}, r: bufio.NewReader(conn), wait: wait})
+}
+
+// halfCloser closes only our side of a TCP connection, so what the service
+// still has to send can be read.
+type halfCloser struct {
+	*net.TCPConn
+}
+
+func (conn halfCloser) Close() error {
+	return conn.CloseWrite()
+}
+
+// readAdvertisement reads what the service opens with, which in either
+// protocol ends with a flush packet.
+func readAdvertisement(connection *streamTransport) (transport, [][]byte, error) {
+	lines := make([][]byte, 0)
+	for {
+		line, length, err := readPkt(connection.r)
+		if err != nil {
+			connection.close()
+			return nil, nil, failure.Fatal("fatal: Could not read from remote repository.\n\nPlease make sure you have the correct access rights\nand the repository exists.")
+		}
+		if length == 0 {
+			lines = append(lines, nil)
+			return connection, lines, nil
+		}
+		if length >= 4 {
+			if message, ok := strings.CutPrefix(string(line), "ERR "); ok {
+				connection.close()
+				return nil, nil, failure.Fatalf("fatal: remote error: %v", strings.TrimSpace(message))
+			}
+			lines = append(lines, line)
+		}
+	}
+}
+
+func (connection *streamTransport) request(body []byte) (io.ReadCloser, error) {
+	if _, err := connection.w.Write(body); err != nil {
+		return nil, failure.Fatal("fatal: the remote end hung up unexpectedly")
+	}
+	return io.NopCloser(connection.r), nil
+}
+
+// close tells the service we are done with a flush packet, which it may no
+// longer be reading, and waits for it to finish.
+func (connection *streamTransport) close() error {
+	io.WriteString(connection.w, "0000")
+	connection.w.Close()
+	io.Copy(io.Discard, connection.r)
+	return connection.wait()
+}
+
+// shellQuote quotes s for the remote shell the way git does, inside single
+// quotes with ' and ! escaped.
+func shellQuote(s string) string {
+	var quoted strings.Builder
+	quoted.WriteByte('\'')
+	for _, r := range s {
+		if r == '\'' || r == '!' {
+			quoted.WriteString(`'\` + string(r) + `'`)
+			continue
+		}
+		quoted.WriteRune(r)
+	}
+	quoted.WriteByte('\'')
+	return quoted.String()
+}
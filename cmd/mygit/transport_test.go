@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCloneAndPushOverSSH(t *testing.T) {
+	requireGit(t)
+	base := setupTest(t)
+	bare := filepath.Join(base, "bare.git")
+	runGit(t, base, "init", "-q", "--bare", "-b", "main", bare)
+	work := filepath.Join(base, "work")
+	mygit(t, base, "init", work)
+	first := commitFile(t, work, "a", "a\n", "one")
+	args, _ := fakeSSH(t, base)
+
+	// The scp-like form and ssh:// URLs with a user, port and ~ path.
+	if _, stderr, code := runIn(t, work, "", "push", "host:"+bare, "main"); code != 0 || !strings.Contains(stderr, " * [new branch]      main -> main\n") {
+		t.Fatalf("push over ssh: exit %v\n%v", code, stderr)
+	}
+	if got := strings.TrimSpace(runGit(t, bare, "rev-parse", "main")); got != first {
+		t.Errorf("git-receive-pack set main to %v, want %v", got, first)
+	}
+	t.Setenv("HOME", base)
+	if _, stderr, code := runIn(t, base, "", "clone", "ssh://user@host:2222/~/bare.git", "clone"); code != 0 {
+		t.Fatalf("clone over ssh: exit %v\n%v", code, stderr)
+	}
+	if got, err := os.ReadFile(filepath.Join(base, "clone", "a")); err != nil || string(got) != "a\n" {
+		t.Errorf("a in the clone = %q, %v", got, err)
+	}
+
+	second := commitFile(t, filepath.Join(base, "clone"), "a", "b\n", "two")
+	if _, stderr, code := runIn(t, filepath.Join(base, "clone"), "", "push"); code != 0 {
+		t.Fatalf("push to origin over ssh: exit %v\n%v", code, stderr)
+	}
+	if got := strings.TrimSpace(runGit(t, bare, "rev-parse", "main")); got != second {
+		t.Errorf("main after pushing from the clone = %v, want %v", got, second)
+	}
+	if got := runGit(t, bare, "fsck", "--strict"); got != "" {
+		t.Errorf("git fsck of the pushed repository:\n%v", got)
+	}
+
+	logged, err := os.ReadFile(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		" host git-receive-pack '" + bare + "'",
+		"version=2 -o SendEnv=GIT_PROTOCOL -p 2222 user@host git-upload-pack '~/bare.git'",
+		" -p 2222 user@host git-receive-pack '~/bare.git'",
+	}
+	if got := strings.Split(strings.TrimSuffix(string(logged), "\n"), "\n"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("ssh was run as:\n%v\nwant:\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
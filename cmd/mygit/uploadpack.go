@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+	"github.com/codecrafters-io/git-starter-go/internal/pack"
+	"github.com/codecrafters-io/git-starter-go/pkg/repo"
+)
+
+// enterRepository opens the repository a server is asked for.
+func enterRepository(path string) error {
+	gitDir, workTree, err := findRepository(path)
+	if err != nil {
+		return err
+	}
+	repository, workTreePrefix = repo.Open(gitDir, workTree), ""
+	return nil
+}
+
+// findRepository returns the git directory and worktree of the repository
+// at path. A path may leave out a trailing /.git or .git, and ~/
+// starts at our home.
+func findRepository(path string) (string, string, error) {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, rest)
+		}
+	}
+	for _, suffix := range []string{"/.git", "", ".git/.git", ".git"} {
+		if !repo.IsGitDir(path + suffix) {
+			continue
+		}
+		gitDir, err := filepath.Abs(path + suffix)
+		if err != nil {
+			return "", "", err
+		}
+		if strings.HasSuffix(suffix, "/.git") {
+			return gitDir, filepath.Dir(gitDir), nil
+		}
+		return gitDir, "", nil
+	}
+	return "", "", failure.Fatalf("fatal: '%v' does not appear to be a git repository", path)
+}
+
+// writeRefAdvertisement opens the original protocol the way both services
+// do: a "<sha> <name>" line per ref, the first carrying the capabilities
+// after a NUL, and the peeled value after each annotated tag. Without refs
+// the capabilities go on a capabilities^{} line.
+func writeRefAdvertisement(w io.Writer, refs []advertisedRef, capabilities []string) {
+	if len(refs) == 0 {
+		refs = []advertisedRef{{name: "capabilities^{}", sha: zeroSHA()}}
+	}
+	for index, ref := range refs {
+		line := ref.sha + " " + ref.name
+		if index == 0 {
+			line += "\x00" + strings.Join(capabilities, " ")
+		}
+		io.WriteString(w, pktLine(line+"\n"))
+		if ref.peeled != "" {
+			io.WriteString(w, pktLine(ref.peeled+" "+ref.name+"^{}\n"))
+		}
+	}
+	io.WriteString(w, "0000")
+}
+
+// uploadPackServer is git-upload-pack in the original protocol. It lists
+// the repository's refs, reads the objects a client wants and the commits
+// it has, and sends a pack of everything reachable from the wants but not
+// from what the two have in common. Asked for a depth, it cuts the history
+// that many commits down and first names the commits it is cut at. Asked
+// for side-band-64k, it sends the pack multiplexed with its progress.
+func uploadPackServer(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) != 1 || strings.HasPrefix(args[0], "-") {
+		return failure.Usage("usage: git upload-pack <directory>")
+	}
+	if err := enterRepository(args[0]); err != nil {
+		return err
+	}
+	output := bufio.NewWriter(stdout)
+	defer output.Flush()
+
+	refs, capabilities, err := uploadPackRefs()
+	if err != nil {
+		return err
+	}
+	writeRefAdvertisement(output, refs, capabilities)
+	if err := output.Flush(); err != nil {
+		return err
+	}
+	ours := make(map[string]bool, len(refs))
+	for _, ref := range refs {
+		ours[ref.sha] = true
+	}
+
+	reader := bufio.NewReader(stdin)
+	wants, requested := make([]string, 0), []string(nil)
+	clientShallow := make(map[string]bool)
+	depth := 0
+	for {
+		line, length, err := readPkt(reader)
+		if err != nil {
+			// Clients that only wanted the refs, like ls-remote, may hang
+			// up without a word.
+			return nil
+		}
+		if length < 4 {
+			break
+		}
+		text := strings.TrimSuffix(string(line), "\n")
+		switch {
+		case strings.HasPrefix(text, "want "):
+			fields := strings.Fields(strings.TrimPrefix(text, "want "))
+			if len(fields) == 0 {
+				return failure.Fatalf("fatal: git upload-pack: protocol error, expected to get object ID, not '%v'", text)
+			}
+			if len(wants) == 0 {
+				requested = fields[1:]
+			}
+			if !ours[fields[0]] {
+				io.WriteString(output, pktLine("ERR upload-pack: not our ref "+fields[0]+"\n"))
+				return failure.Fatalf("fatal: git upload-pack: not our ref %v", fields[0])
+			}
+			wants = append(wants, fields[0])
+		case strings.HasPrefix(text, "shallow "):
+			clientShallow[strings.TrimPrefix(text, "shallow ")] = true
+		case strings.HasPrefix(text, "deepen "):
+			if depth, err = strconv.Atoi(strings.TrimPrefix(text, "deepen ")); err != nil || depth < 1 {
+				return failure.Fatalf("fatal: git upload-pack: invalid deepen: %v", strings.TrimPrefix(text, "deepen "))
+			}
+		default:
+			return failure.Fatalf("fatal: git upload-pack: protocol error, expected to get object ID, not '%v'", text)
+		}
+	}
+	if len(wants) == 0 {
+		return nil
+	}
+
+	// What the client has stops at its shallow commits; what it gets stops
+	// there too, unless the new depth reaches below them.
+	ownShallow, err := repository.Shallow()
+	if err != nil {
+		return err
+	}
+	haveShallow := maps.Clone(ownShallow)
+	for sha := range clientShallow {
+		haveShallow[sha] = true
+	}
+	shallow := maps.Clone(haveShallow)
+	if depth > 0 || len(clientShallow) > 0 {
+		if depth > 0 {
+			cuts, err := shallowCuts(wants, depth)
+			if err != nil {
+				return err
+			}
+			shas := make([]string, 0, len(cuts))
+			for sha := range cuts {
+				shas = append(shas, sha)
+			}
+			sort.Strings(shas)
+			for _, sha := range shas {
+				switch {
+				case cuts[sha] && !clientShallow[sha]:
+					io.WriteString(output, pktLine("shallow "+sha+"\n"))
+					shallow[sha] = true
+				case !cuts[sha] && clientShallow[sha]:
+					// The client has this commit but none of its parents,
+					// which it now gets as if it wanted them.
+					io.WriteString(output, pktLine("unshallow "+sha+"\n"))
+					delete(shallow, sha)
+					commit, err := repository.ReadCommit(sha)
+					if err != nil {
+						return err
+					}
+					wants = append(wants, commit.Parents...)
+				}
+			}
+		}
+		io.WriteString(output, "0000")
+		if err := output.Flush(); err != nil {
+			return err
+		}
+	}
+
+	// Without multi_ack the first common commit is acknowledged at once,
+	// and each flush or the final done is answered with NAK until one is.
+	common, isCommon := make([]string, 0), make(map[string]bool)
+	for {
+		line, length, err := readPkt(reader)
+		if err != nil {
+			return nil
+		}
+		text := strings.TrimSuffix(string(line), "\n")
+		if length < 4 || text == "done" {
+			if len(common) == 0 {
+				io.WriteString(output, pktLine("NAK\n"))
+			}
+			if err := output.Flush(); err != nil {
+				return err
+			}
+			if length < 4 {
+				continue
+			}
+			break
+		}
+		sha, ok := strings.CutPrefix(text, "have ")
+		if !ok {
+			return failure.Fatalf("fatal: git upload-pack: expected SHA1 list, got '%v'", text)
+		}
+		if !isCommon[sha] && repository.HasObject(sha) {
+			isCommon[sha] = true
+			common = append(common, sha)
+			if len(common) == 1 {
+				io.WriteString(output, pktLine("ACK "+sha+"\n"))
+			}
+		}
+	}
+
+	defer storedObjects()()
+	seen := make(map[string]bool)
+	if err := walkObjectsUntil(common, seen, haveShallow, nil); err != nil {
+		return err
+	}
+	objects := make([]*pack.Object, 0)
+	sent := make(map[string]bool)
+	collect := func(sha string, objectType string, content []byte) {
+		objects = append(objects, &pack.Object{Type: objectType, Content: content})
+		sent[sha] = true
+	}
+	if err := walkObjectsUntil(wants, seen, shallow, collect); err != nil {
+		return err
+	}
+	if slices.Contains(requested, "include-tag") {
+		// Annotated tags come along with whatever they point at.
+		for _, ref := range refs {
+			if strings.HasPrefix(ref.name, "refs/tags/") && ref.peeled != "" && sent[ref.peeled] && !seen[ref.sha] {
+				if err := walkObjectsUntil([]string{ref.sha}, seen, shallow, collect); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if !slices.Contains(requested, "side-band-64k") {
+		_, err = pack.Write(repository.Algorithm, output, objects)
+		return err
+	}
+
+	// Multiplexed, the pack goes on band 1 and what we have to say about it
+	// on band 2, unless the client would rather not hear.
+	messages := io.Writer(sidebandWriter{w: output, band: 2})
+	if slices.Contains(requested, "no-progress") {
+		messages = io.Discard
+	}
+	fmt.Fprintf(messages, "Enumerating objects: %v, done.\n", len(objects))
+	data := bufio.NewWriterSize(sidebandWriter{w: output, band: 1}, 65515)
+	if _, err := pack.Write(repository.Algorithm, data, objects); err != nil {
+		return err
+	}
+	if err := data.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(messages, "Total %v (delta 0), reused 0 (delta 0), pack-reused 0\n", len(objects))
+	_, err = io.WriteString(output, "0000")
+	return err
+}
+
+// uploadPackRefs lists what upload-pack advertises: HEAD when it resolves,
+// then every ref with annotated tags peeled, and the capabilities we offer.
+func uploadPackRefs() ([]advertisedRef, []string, error) {
+	capabilities := []string{"include-tag", "no-progress", "ofs-delta", "shallow", "side-band-64k", "object-format=" + repository.Algorithm.Name()}
+	refs := make([]advertisedRef, 0)
+	if headSHA, err := resolveHead(); err != nil {
+		return nil, nil, err
+	} else if headSHA != "" {
+		refs = append(refs, advertisedRef{name: "HEAD", sha: headSHA})
+		if headRef, isSymref, err := readHeadSymref(); err == nil && isSymref {
+			capabilities = append(capabilities, "symref=HEAD:"+headRef)
+		}
+	}
+	list, err := repository.Refs.List("refs/")
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, ref := range list {
+		advertised := advertisedRef{name: ref.Name, sha: ref.SHA}
+		for sha := ref.SHA; ; {
+			currentType, err := objectType(sha)
+			if err != nil || currentType != "tag" {
+				break
+			}
+			if sha, err = tagTarget(sha); err != nil {
+				return nil, nil, err
+			}
+			advertised.peeled = sha
+		}
+		refs = append(refs, advertised)
+	}
+	return refs, capabilities, nil
+}
+
+// shallowCuts walks the history below tips breadth first, depth commits
+// down, and returns every commit it meets with whether the history is cut
+// there: at the last commit down, or where our own history already stops.
+func shallowCuts(tips []string, depth int) (map[string]bool, error) {
+	ownShallow, err := repository.Shallow()
+	if err != nil {
+		return nil, err
+	}
+	cuts := make(map[string]bool)
+	level := make([]string, 0, len(tips))
+	for _, tip := range tips {
+		if sha, err := peelObject(tip, "commit"); err == nil {
+			level = append(level, sha)
+		}
+	}
+	for current := 1; len(level) > 0; current++ {
+		next := make([]string, 0)
+		for _, sha := range level {
+			if _, ok := cuts[sha]; ok {
+				continue
+			}
+			commit, err := repository.ReadCommit(sha)
+			if err != nil {
+				return nil, err
+			}
+			cut := len(commit.Parents) > 0 && (current == depth || ownShallow[sha])
+			cuts[sha] = cut
+			if !cut {
+				next = append(next, commit.Parents...)
+			}
+		}
+		level = next
+	}
+	return cuts, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWritesLeaveNoTemporaryFiles(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	commitFile(t, dir, "a", "a\n", "one")
+	mygit(t, dir, "branch", "side")
+	mygit(t, dir, "tag", "-a", "-m", "tag", "v1")
+	mygit(t, dir, "config", "x.y", "z")
+	commitFile(t, dir, "a", "b\n", "two")
+	mygit(t, dir, "gc")
+	commitFile(t, dir, "a", "c\n", "three")
+
+	err := filepath.WalkDir(filepath.Join(dir, ".git"), func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := entry.Name()
+		if strings.HasSuffix(name, ".lock") || strings.HasPrefix(name, "tmp") {
+			t.Errorf("left behind: %v", path)
+		}
+		// Loose objects, packs and their indexes are never changed in
+		// place, so nothing may write to them.
+		if !entry.IsDir() && strings.Contains(path, string(filepath.Separator)+"objects"+string(filepath.Separator)) {
+			if info, err := entry.Info(); err != nil {
+				return err
+			} else if info.Mode().Perm()&0222 != 0 {
+				t.Errorf("%v is writable: %v", path, info.Mode())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHeldLocksStopWrites(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	first := commitFile(t, dir, "a", "a\n", "one")
+
+	// Another writer holds the branch: the commit fails whole.
+	lock := filepath.Join(dir, ".git", "refs", "heads", "main.lock")
+	writeFile(t, dir, ".git/refs/heads/main.lock", "")
+	writeFile(t, dir, "a", "b\n")
+	mygit(t, dir, "add", "a")
+	if _, stderr, code := runIn(t, dir, "", "commit", "-m", "two"); code != 128 || !strings.Contains(stderr, "Unable to create '"+lock+"': File exists.") {
+		t.Errorf("commit with the branch locked: exit %v\n%v", code, stderr)
+	}
+	if got := strings.TrimSpace(mygit(t, dir, "rev-parse", "HEAD")); got != first {
+		t.Errorf("the failed commit moved HEAD to %v", got)
+	}
+	if _, err := os.Stat(lock); err != nil {
+		t.Errorf("another writer's lock was taken away: %v", err)
+	}
+	os.Remove(lock)
+
+	writeFile(t, dir, ".git/index.lock", "")
+	writeFile(t, dir, "c", "c\n")
+	if _, stderr, code := runIn(t, dir, "", "add", "c"); code != 128 || !strings.Contains(stderr, "index.lock': File exists.") {
+		t.Errorf("add with the index locked: exit %v\n%v", code, stderr)
+	}
+	if got := mygit(t, dir, "status", "-s"); got != "M  a\n?? c\n" {
+		t.Errorf("status after add failed on the lock:\n%v", got)
+	}
+}
+
+func TestExitCodesByFailureClass(t *testing.T) {
+	dir := setupTest(t)
+	mygit(t, dir, "init")
+	commitFile(t, dir, "a", "a\n", "one")
+	for _, test := range []struct {
+		args []string
+		code int
+	}{
+		// Usage errors, fatal errors and plain failures.
+		{[]string{"cat-file", "--bogus"}, 129},
+		{[]string{"commit"}, 129},
+		{[]string{"cat-file", "-p", "0000000000000000000000000000000000000001"}, 128},
+		{[]string{"checkout", "nope"}, 1},
+		{[]string{"rev-parse", "--verify", "-q", "nope"}, 1},
+		{[]string{"nope"}, 1},
+	} {
+		if _, stderr, code := runIn(t, dir, "", test.args...); code != test.code {
+			t.Errorf("%v: exit %v, want %v\n%v", strings.Join(test.args, " "), code, test.code, stderr)
+		}
+	}
+	if _, _, code := runIn(t, filepath.Dir(dir), "", "log"); code != 128 {
+		t.Errorf("log outside a repository exited %v", code)
+	}
+}
@@ -0,0 +1,122 @@
+// Package atomicfile replaces files in a git directory whole or not at all.
+// New contents are written beside the file, flushed to disk and renamed
+// over it, so a crash or a full disk leaves the old file rather than half a
+// new one; the rename is flushed with the directory that holds it.
+package atomicfile
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// File is new contents being written beside the file they will replace.
+type File struct {
+	*os.File
+	done bool
+}
+
+// LockedError is returned by Lock when the lock file is already there,
+// another writer holding it or one having crashed with it held. Its
+// message is git's.
+type LockedError struct {
+	Path string
+}
+
+func (err *LockedError) Error() string {
+	return fmt.Sprintf("Unable to create '%v': File exists.\n\n"+
+		"Another git process seems to be running in this repository, e.g.\n"+
+		"an editor opened by 'git commit'. Please make sure all processes\n"+
+		"are terminated then try again. If it still fails, a git process\n"+
+		"may have crashed in this repository earlier:\n"+
+		"remove the file manually to continue.", err.Path)
+}
+
+func (err *LockedError) Unwrap() error {
+	return fs.ErrExist
+}
+
+// Lock starts new contents for path in path.lock. The lock
+// file is only created when it is not there already, so two writers of
+// path never both go ahead.
+func Lock(path string) (*File, error) {
+	lockPath := path + ".lock"
+	file, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	if errors.Is(err, fs.ErrExist) {
+		if absolute, absErr := filepath.Abs(lockPath); absErr == nil {
+			lockPath = absolute
+		}
+		return nil, &LockedError{Path: lockPath}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &File{File: file}, nil
+}
+
+// CreateTemp starts new contents in dir under a unique name made from
+// pattern, for files such as objects and packs whose names are only known
+// once they are written.
+func CreateTemp(dir string, pattern string) (*File, error) {
+	file, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &File{File: file}, nil
+}
+
+// Commit flushes the file to disk and renames it over path with mode perm.
+// Once the rename is done the file is committed even if flushing the
+// directory fails, which some filesystems do not support.
+func (file *File) Commit(path string, perm os.FileMode) error {
+	if file.done {
+		return fs.ErrClosed
+	}
+	err := file.Sync()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(file.Name(), perm)
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		file.Abort()
+		return err
+	}
+	file.done = true
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+// Abort throws the new contents away, leaving the file they were to
+// replace as it was. It does nothing once the file is committed, so it can
+// be deferred.
+func (file *File) Abort() {
+	if file.done {
+		return
+	}
+	file.done = true
+	file.Close()
+	os.Remove(file.Name())
+}
+
+// WriteFile replaces path with data through path.lock.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	file, err := Lock(path)
+	if err != nil {
+		return err
+	}
+	defer file.Abort()
+	if _, err := file.Write(data); err != nil {
+		return err
+	}
+	return file.Commit(path, perm)
+}
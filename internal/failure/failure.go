@@ -0,0 +1,76 @@
+// Package failure sorts the errors commands fail with into git's classes of
+// failure, each with its own exit status: a command line that makes no
+// sense exits 129, a fatal error, one git would die of, exits 128, and
+// anything else a command reports exits 1.
+package failure
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// UsageError is an error in how a command was invoked, such as an unknown
+// option or a missing argument.
+type UsageError struct {
+	Err error
+}
+
+func (err *UsageError) Error() string {
+	return err.Err.Error()
+}
+
+func (err *UsageError) Unwrap() error {
+	return err.Err
+}
+
+// FatalError is an error the command cannot go on from.
+type FatalError struct {
+	Err error
+}
+
+func (err *FatalError) Error() string {
+	return err.Err.Error()
+}
+
+func (err *FatalError) Unwrap() error {
+	return err.Err
+}
+
+// Usage returns a usage error with message.
+func Usage(message string) error {
+	return &UsageError{errors.New(message)}
+}
+
+// Usagef formats a usage error as fmt.Errorf does.
+func Usagef(format string, args ...any) error {
+	return &UsageError{fmt.Errorf(format, args...)}
+}
+
+// Fatal returns a fatal error with message.
+func Fatal(message string) error {
+	return &FatalError{errors.New(message)}
+}
+
+// Fatalf formats a fatal error as fmt.Errorf does.
+func Fatalf(format string, args ...any) error {
+	return &FatalError{fmt.Errorf(format, args...)}
+}
+
+// ExitCode returns the status a command failing with err exits with. A
+// failure to read or write a file is fatal however it was reported, since
+// the repository cannot be trusted to be as the command left it.
+func ExitCode(err error) int {
+	var usage *UsageError
+	var fatal *FatalError
+	var pathErr *fs.PathError
+	var linkErr *os.LinkError
+	switch {
+	case errors.As(err, &usage):
+		return 129
+	case errors.As(err, &fatal), errors.As(err, &pathErr), errors.As(err, &linkErr):
+		return 128
+	}
+	return 1
+}
@@ -0,0 +1,62 @@
+package pack
+
+import (
+	"container/list"
+	"sync"
+)
+
+// deltaBaseCacheLimit bounds the bytes of content a pack keeps in its
+// delta base cache.
+const deltaBaseCacheLimit = 32 << 20
+
+// deltaBaseCache keeps the objects most recently used as delta bases, by
+// their offset in the pack, so reading many deltas against one base, or
+// each object down one chain, does not rebuild the base every time. The
+// least recently used are dropped once the cache holds more than
+// deltaBaseCacheLimit bytes.
+type deltaBaseCache struct {
+	lock    sync.Mutex
+	entries map[int64]*list.Element
+	// order has the most recently used entry at the front.
+	order *list.List
+	size  int
+}
+
+type cachedBase struct {
+	offset int64
+	object *Object
+}
+
+func newDeltaBaseCache() *deltaBaseCache {
+	return &deltaBaseCache{entries: make(map[int64]*list.Element), order: list.New()}
+}
+
+func (cache *deltaBaseCache) get(offset int64) (*Object, bool) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	element, ok := cache.entries[offset]
+	if !ok {
+		return nil, false
+	}
+	cache.order.MoveToFront(element)
+	return element.Value.(*cachedBase).object, true
+}
+
+func (cache *deltaBaseCache) add(offset int64, object *Object) {
+	if len(object.Content) > deltaBaseCacheLimit {
+		return
+	}
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	if _, ok := cache.entries[offset]; ok {
+		return
+	}
+	cache.entries[offset] = cache.order.PushFront(&cachedBase{offset: offset, object: object})
+	cache.size += len(object.Content)
+	for cache.size > deltaBaseCacheLimit {
+		oldest := cache.order.Back()
+		evicted := cache.order.Remove(oldest).(*cachedBase)
+		delete(cache.entries, evicted.offset)
+		cache.size -= len(evicted.object.Content)
+	}
+}
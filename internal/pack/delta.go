@@ -0,0 +1,87 @@
+package pack
+
+import "errors"
+
+// ApplyDelta rebuilds an object from its base and a git delta instruction
+// stream. The result size the delta declares is not trusted for more than
+// the base and the delta could plausibly make, so a damaged or hostile
+// delta cannot have a huge buffer allocated up front, and the result is
+// refused as soon as it outgrows that size.
+func ApplyDelta(base []byte, delta []byte) ([]byte, error) {
+	baseSize, delta := readDeltaSize(delta)
+	if baseSize != len(base) {
+		return nil, errors.New("Delta base size mismatch")
+	}
+	resultSize, delta := readDeltaSize(delta)
+	if resultSize < 0 {
+		return nil, errors.New("Invalid delta result size")
+	}
+
+	result := make([]byte, 0, min(resultSize, len(base)+len(delta)))
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+		switch {
+		case op&0x80 != 0:
+			var copyOffset, copySize int
+			for bit := 0; bit < 7; bit++ {
+				if op&(1<<bit) == 0 {
+					continue
+				}
+				if len(delta) == 0 {
+					return nil, errors.New("Truncated delta copy instruction")
+				}
+				if bit < 4 {
+					copyOffset |= int(delta[0]) << (8 * bit)
+				} else {
+					copySize |= int(delta[0]) << (8 * (bit - 4))
+				}
+				delta = delta[1:]
+			}
+			if copySize == 0 {
+				copySize = 0x10000
+			}
+			if copyOffset+copySize > len(base) {
+				return nil, errors.New("Delta copy out of range")
+			}
+			if len(result)+copySize > resultSize {
+				return nil, errors.New("Delta result size mismatch")
+			}
+			result = append(result, base[copyOffset:copyOffset+copySize]...)
+		case op != 0:
+			if int(op) > len(delta) {
+				return nil, errors.New("Truncated delta insert instruction")
+			}
+			if len(result)+int(op) > resultSize {
+				return nil, errors.New("Delta result size mismatch")
+			}
+			result = append(result, delta[:op]...)
+			delta = delta[op:]
+		default:
+			return nil, errors.New("Invalid delta instruction 0")
+		}
+	}
+	if len(result) != resultSize {
+		return nil, errors.New("Delta result size mismatch")
+	}
+	return result, nil
+}
+
+// readDeltaSize reads a size in a delta header, or -1 for one too large to
+// be an int.
+func readDeltaSize(delta []byte) (int, []byte) {
+	size, shift := 0, 0
+	for len(delta) > 0 {
+		b := delta[0]
+		delta = delta[1:]
+		if shift > 56 || int(b&0x7f)<<shift < 0 {
+			return -1, delta
+		}
+		size |= int(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	return size, delta
+}
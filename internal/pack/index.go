@@ -0,0 +1,125 @@
+package pack
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/objects"
+)
+
+var indexMagic = []byte{0xff, 't', 'O', 'c'}
+
+// Index maps object SHAs to their offsets in the companion .pack file.
+type Index struct {
+	offsets map[string]int64
+}
+
+// ReadIndex loads a version 2 .idx file whose objects are named with
+// algorithm.
+func ReadIndex(algorithm objects.Algorithm, indexPath string) (*Index, error) {
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading file %v: %w", indexPath, err)
+	}
+	index, err := ParseIndex(algorithm, data)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", indexPath, err)
+	}
+	return index, nil
+}
+
+// ParseIndex decodes the contents of a version 2 .idx file. Its object
+// names, and the checksums that end it, are as long as algorithm makes them.
+func ParseIndex(algorithm objects.Algorithm, data []byte) (*Index, error) {
+	size := algorithm.Size()
+	if len(data) < 8+256*4+2*size || !bytes.Equal(data[:4], indexMagic) {
+		return nil, errors.New("Invalid pack index signature")
+	}
+	if version := binary.BigEndian.Uint32(data[4:8]); version != 2 {
+		return nil, fmt.Errorf("Unsupported pack index version %v", version)
+	}
+	fanout := data[8 : 8+256*4]
+	count := int(binary.BigEndian.Uint32(fanout[255*4:]))
+
+	shaTable := 8 + 256*4
+	crcTable := shaTable + count*size
+	offsetTable := crcTable + count*4
+	largeOffsetTable := offsetTable + count*4
+	if len(data) < largeOffsetTable+2*size {
+		return nil, errors.New("Truncated pack index")
+	}
+
+	index := &Index{offsets: make(map[string]int64, count)}
+	for i := 0; i < count; i++ {
+		sha := hex.EncodeToString(data[shaTable+i*size : shaTable+(i+1)*size])
+		offset := int64(binary.BigEndian.Uint32(data[offsetTable+i*4:]))
+		if offset&0x80000000 != 0 {
+			largeIndex := int(offset & 0x7fffffff)
+			position := largeOffsetTable + largeIndex*8
+			if position+8 > len(data)-2*size {
+				return nil, errors.New("Pack index large offset out of range")
+			}
+			offset = int64(binary.BigEndian.Uint64(data[position:]))
+		}
+		index.offsets[sha] = offset
+	}
+	return index, nil
+}
+
+// Offset returns the pack offset of sha, if the index contains it.
+func (index *Index) Offset(sha string) (int64, bool) {
+	offset, ok := index.offsets[sha]
+	return offset, ok
+}
+
+// SHAs returns every object name in the index in sorted order.
+func (index *Index) SHAs() []string {
+	shas := make([]string, 0, len(index.offsets))
+	for sha := range index.offsets {
+		shas = append(shas, sha)
+	}
+	sort.Strings(shas)
+	return shas
+}
+
+// Verify checks a pack against its .idx: both trailing checksums, and that
+// the index lists exactly the pack's objects with their offsets and CRCs. It
+// returns the pack's entries.
+func Verify(algorithm objects.Algorithm, packData []byte, indexData []byte) ([]*Entry, error) {
+	if _, err := ParseIndex(algorithm, indexData); err != nil {
+		return nil, err
+	}
+	size := algorithm.Size()
+	hash := algorithm.New()
+	hash.Write(indexData[:len(indexData)-size])
+	if !bytes.Equal(hash.Sum(nil), indexData[len(indexData)-size:]) {
+		return nil, errors.New("Pack index checksum mismatch")
+	}
+	entries, err := ReadEntries(context.Background(), algorithm, packData, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	packChecksum := packData[len(packData)-size:]
+	if !bytes.Equal(packChecksum, indexData[len(indexData)-2*size:len(indexData)-size]) {
+		return nil, errors.New("Pack index is for a different pack")
+	}
+
+	indexEntries := make([]IndexEntry, 0, len(entries))
+	for _, e := range entries {
+		indexEntries = append(indexEntries, e.IndexEntry())
+	}
+	var rebuilt bytes.Buffer
+	if err := WriteIndex(algorithm, &rebuilt, indexEntries, packChecksum); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(rebuilt.Bytes(), indexData) {
+		return nil, errors.New("Pack index does not match the pack's objects")
+	}
+	return entries, nil
+}
@@ -0,0 +1,457 @@
+// Package pack reads and writes git packfiles: both raw pack streams sent over the
+// wire and .pack/.idx pairs stored under .git/objects/pack.
+package pack
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/objects"
+)
+
+const (
+	ObjectCommit   = 1
+	ObjectTree     = 2
+	ObjectBlob     = 3
+	ObjectTag      = 4
+	ObjectOfsDelta = 6
+	ObjectRefDelta = 7
+)
+
+var objectTypeNames = map[int]string{
+	ObjectCommit: "commit",
+	ObjectTree:   "tree",
+	ObjectBlob:   "blob",
+	ObjectTag:    "tag",
+}
+
+// Object is a fully resolved (non-delta) object read from a pack.
+type Object struct {
+	Type    string
+	Content []byte
+}
+
+// SHA returns the hex object name of the object under algorithm.
+func (object *Object) SHA(algorithm objects.Algorithm) string {
+	hash := algorithm.New()
+	fmt.Fprintf(hash, "%s %d\x00", object.Type, len(object.Content))
+	hash.Write(object.Content)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// ErrDeltaBaseMissing is returned when a ref-delta names a base object that is
+// neither in the pack nor available through the external lookup.
+var ErrDeltaBaseMissing = errors.New("Delta base object missing from pack")
+
+// Lookup resolves ref-delta bases that live outside the pack, as in thin packs.
+type Lookup func(sha string) (*Object, error)
+
+type entry struct {
+	objectType int
+	data       []byte
+	baseOffset int64
+	baseSHA    string
+}
+
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// readEntry reads the entry at offset, whose ref-delta base, if it has one,
+// is named in hashSize bytes.
+func readEntry(reader byteReader, offset int64, hashSize int) (*entry, error) {
+	header, err := reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	e := &entry{objectType: int(header>>4) & 0x7}
+	size := uint64(header & 0x0f)
+	for shift := 4; header&0x80 != 0; shift += 7 {
+		if header, err = reader.ReadByte(); err != nil {
+			return nil, err
+		}
+		size |= uint64(header&0x7f) << shift
+	}
+
+	switch e.objectType {
+	case ObjectOfsDelta:
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		distance := int64(b & 0x7f)
+		for b&0x80 != 0 {
+			if b, err = reader.ReadByte(); err != nil {
+				return nil, err
+			}
+			distance = ((distance + 1) << 7) | int64(b&0x7f)
+		}
+		e.baseOffset = offset - distance
+	case ObjectRefDelta:
+		baseHash := make([]byte, hashSize)
+		if _, err := io.ReadFull(reader, baseHash); err != nil {
+			return nil, err
+		}
+		e.baseSHA = hex.EncodeToString(baseHash)
+	case ObjectCommit, ObjectTree, ObjectBlob, ObjectTag:
+	default:
+		return nil, fmt.Errorf("Unknown pack object type %v", e.objectType)
+	}
+
+	zlibReader, err := zlib.NewReader(reader)
+	if err != nil {
+		return nil, err
+	}
+	defer zlibReader.Close()
+	if e.data, err = io.ReadAll(zlibReader); err != nil {
+		return nil, err
+	}
+	if uint64(len(e.data)) != size {
+		return nil, fmt.Errorf("Pack entry size mismatch: expected %v, got %v", size, len(e.data))
+	}
+	return e, nil
+}
+
+// checkHeader validates the "PACK" signature and version and returns the object count.
+func checkHeader(header []byte) (int, error) {
+	if len(header) < 12 || string(header[:4]) != "PACK" {
+		return 0, errors.New("Invalid packfile signature")
+	}
+	if version := binary.BigEndian.Uint32(header[4:8]); version != 2 && version != 3 {
+		return 0, fmt.Errorf("Unsupported packfile version %v", version)
+	}
+	return int(binary.BigEndian.Uint32(header[8:12])), nil
+}
+
+// Entry describes how one object is stored in a pack.
+type Entry struct {
+	Object *Object
+	SHA    string
+	Offset int64
+	// PackedSize is the number of bytes the entry occupies in the pack,
+	// header included, and CRC32 their checksum.
+	PackedSize int64
+	CRC32      uint32
+	// StoredSize is the length of the data as stored: the object itself, or
+	// the delta that rebuilds it.
+	StoredSize int
+	// Depth is the length of the delta chain behind the object, zero when it
+	// is stored whole, and Base names the object its delta applies to.
+	Depth int
+	Base  string
+}
+
+// Unpack decodes every entry of a complete packfile whose objects are named
+// with algorithm, resolving ofs-delta and ref-delta chains, and returns the
+// objects in pack order.
+func Unpack(algorithm objects.Algorithm, data []byte, external Lookup) ([]*Object, error) {
+	entries, err := ReadEntries(context.Background(), algorithm, data, external, nil)
+	if err != nil {
+		return nil, err
+	}
+	unpacked := make([]*Object, 0, len(entries))
+	for _, e := range entries {
+		unpacked = append(unpacked, e.Object)
+	}
+	return unpacked, nil
+}
+
+// ReadEntries decodes a complete packfile like Unpack and reports how each
+// object is stored, in pack order. Once the pack is parsed, progress, if
+// not nil, hears how many of its deltas are resolved out of how many. The
+// work stops early with ctx's error when ctx is done.
+func ReadEntries(ctx context.Context, algorithm objects.Algorithm, data []byte, external Lookup, progress Progress) ([]*Entry, error) {
+	trailer := algorithm.Size()
+	if len(data) < 12+trailer {
+		return nil, errors.New("Truncated packfile")
+	}
+	objectCount, err := checkHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	hash := algorithm.New()
+	hash.Write(data[:len(data)-trailer])
+	if !bytes.Equal(hash.Sum(nil), data[len(data)-trailer:]) {
+		return nil, errors.New("Packfile checksum mismatch")
+	}
+
+	raw := make(map[int64]*entry, objectCount)
+	entries := make(map[int64]*Entry, objectCount)
+	offsets := make([]int64, 0, objectCount)
+	reader := bytes.NewReader(data[:len(data)-trailer])
+	reader.Seek(12, io.SeekStart)
+	deltas := 0
+	for i := 0; i < objectCount; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		offset := reader.Size() - int64(reader.Len())
+		e, err := readEntry(reader, offset, trailer)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read pack entry at offset %v: %w", offset, err)
+		}
+		end := reader.Size() - int64(reader.Len())
+		raw[offset] = e
+		entries[offset] = &Entry{Offset: offset, PackedSize: end - offset, CRC32: crc32.ChecksumIEEE(data[offset:end]), StoredSize: len(e.data)}
+		offsets = append(offsets, offset)
+		if e.objectType == ObjectOfsDelta || e.objectType == ObjectRefDelta {
+			deltas++
+		}
+	}
+	if reader.Len() != 0 {
+		return nil, errors.New("Pack has junk at the end")
+	}
+	resolvedDeltas := 0
+	if progress != nil && deltas > 0 {
+		progress(0, deltas, 0)
+	}
+
+	offsetsBySHA := make(map[string]int64, objectCount)
+	var resolve func(offset int64, depth int) (*Entry, error)
+	resolve = func(offset int64, depth int) (*Entry, error) {
+		resolved, ok := entries[offset]
+		if !ok {
+			return nil, fmt.Errorf("No pack entry at offset %v", offset)
+		}
+		if resolved.Object != nil {
+			return resolved, nil
+		}
+		if depth > objectCount {
+			return nil, errors.New("Delta chain cycle")
+		}
+		e := raw[offset]
+		if e.objectType != ObjectOfsDelta && e.objectType != ObjectRefDelta {
+			resolved.Object = &Object{Type: objectTypeNames[e.objectType], Content: e.data}
+			resolved.SHA = resolved.Object.SHA(algorithm)
+			return resolved, nil
+		}
+
+		var base *Object
+		baseDepth := 0
+		if e.objectType == ObjectOfsDelta {
+			baseEntry, err := resolve(e.baseOffset, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			base, baseDepth, resolved.Base = baseEntry.Object, baseEntry.Depth, baseEntry.SHA
+		} else if baseOffset, found := offsetsBySHA[e.baseSHA]; found {
+			baseEntry, err := resolve(baseOffset, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			base, baseDepth, resolved.Base = baseEntry.Object, baseEntry.Depth, baseEntry.SHA
+		} else if external != nil {
+			if base, err = external(e.baseSHA); err != nil || base == nil {
+				return nil, ErrDeltaBaseMissing
+			}
+			resolved.Base = e.baseSHA
+		} else {
+			return nil, ErrDeltaBaseMissing
+		}
+		content, err := ApplyDelta(base.Content, e.data)
+		if err != nil {
+			return nil, err
+		}
+		resolved.Object = &Object{Type: base.Type, Content: content}
+		resolved.SHA = resolved.Object.SHA(algorithm)
+		resolved.Depth = baseDepth + 1
+		resolvedDeltas++
+		if progress != nil {
+			progress(resolvedDeltas, deltas, 0)
+		}
+		return resolved, nil
+	}
+
+	// Ref-deltas may name bases that appear later in the pack, so keep sweeping
+	// until every entry resolves or a sweep makes no progress.
+	pending := offsets
+	for len(pending) > 0 {
+		stillPending := make([]int64, 0)
+		for _, offset := range pending {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			resolved, err := resolve(offset, 0)
+			if errors.Is(err, ErrDeltaBaseMissing) {
+				stillPending = append(stillPending, offset)
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			offsetsBySHA[resolved.SHA] = offset
+		}
+		if len(stillPending) == len(pending) {
+			return nil, ErrDeltaBaseMissing
+		}
+		pending = stillPending
+	}
+
+	ordered := make([]*Entry, 0, objectCount)
+	for _, offset := range offsets {
+		ordered = append(ordered, entries[offset])
+	}
+	return ordered, nil
+}
+
+// recordingReader keeps a copy of every byte read through it. It is a
+// ByteReader, so zlib reads no further than the end of each stream.
+type recordingReader struct {
+	r    *bufio.Reader
+	data []byte
+}
+
+func (reader *recordingReader) Read(p []byte) (int, error) {
+	n, err := reader.r.Read(p)
+	reader.data = append(reader.data, p[:n]...)
+	return n, err
+}
+
+func (reader *recordingReader) ReadByte() (byte, error) {
+	b, err := reader.r.ReadByte()
+	if err == nil {
+		reader.data = append(reader.data, b)
+	}
+	return b, err
+}
+
+// Progress hears how a pack being read is coming along: how many of its
+// objects are in, out of how many, and how many bytes that has taken.
+type Progress func(done int, total int, size int64)
+
+// ReadStream reads one packfile from a stream that may go on after it, as
+// a push sends it, and returns the pack's bytes. Entries are only inflated
+// to find where they end; the pack is checked when it is decoded. Its
+// trailer is a checksum under algorithm. progress, when not nil, is called
+// once the header is in and after each entry.
+func ReadStream(algorithm objects.Algorithm, r *bufio.Reader, progress Progress) ([]byte, error) {
+	reader := &recordingReader{r: r}
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, errors.New("Truncated packfile")
+	}
+	objectCount, err := checkHeader(header)
+	if err != nil {
+		return nil, err
+	}
+	if progress != nil {
+		progress(0, objectCount, int64(len(reader.data)))
+	}
+	for i := 0; i < objectCount; i++ {
+		offset := int64(len(reader.data))
+		if _, err := readEntry(reader, offset, algorithm.Size()); err != nil {
+			return nil, fmt.Errorf("Failed to read pack entry at offset %v: %w", offset, err)
+		}
+		if progress != nil {
+			progress(i+1, objectCount, int64(len(reader.data)))
+		}
+	}
+	if _, err := io.ReadFull(reader, make([]byte, algorithm.Size())); err != nil {
+		return nil, errors.New("Truncated packfile")
+	}
+	return reader.data, nil
+}
+
+// Pack is an on-disk .pack file opened together with its .idx.
+type Pack struct {
+	file      *os.File
+	index     *Index
+	algorithm objects.Algorithm
+	bases     *deltaBaseCache
+}
+
+// Open opens a .pack file and the .idx file next to it, both naming their
+// objects with algorithm.
+func Open(algorithm objects.Algorithm, packPath string) (*Pack, error) {
+	index, err := ReadIndex(algorithm, strings.TrimSuffix(packPath, ".pack")+".idx")
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(packPath)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening file %v: %w", packPath, err)
+	}
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(file, header); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%v: %w", packPath, err)
+	}
+	if _, err := checkHeader(header); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%v: %w", packPath, err)
+	}
+	return &Pack{file: file, index: index, algorithm: algorithm, bases: newDeltaBaseCache()}, nil
+}
+
+// Close releases the underlying pack file.
+func (p *Pack) Close() error {
+	return p.file.Close()
+}
+
+// Index returns the parsed .idx of the pack.
+func (p *Pack) Index() *Index {
+	return p.index
+}
+
+// Contains reports whether the pack holds sha.
+func (p *Pack) Contains(sha string) bool {
+	_, ok := p.index.Offset(sha)
+	return ok
+}
+
+// Object reads and fully resolves sha from the pack.
+func (p *Pack) Object(sha string) (*Object, error) {
+	offset, ok := p.index.Offset(sha)
+	if !ok {
+		return nil, fmt.Errorf("Object %v not found in pack", sha)
+	}
+	return p.objectAt(offset, 0)
+}
+
+func (p *Pack) objectAt(offset int64, depth int) (*Object, error) {
+	if depth > 4096 {
+		return nil, errors.New("Delta chain too deep")
+	}
+	reader := bufio.NewReader(io.NewSectionReader(p.file, offset, math.MaxInt64-offset))
+	e, err := readEntry(reader, offset, p.algorithm.Size())
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read pack entry at offset %v: %w", offset, err)
+	}
+
+	switch e.objectType {
+	case ObjectOfsDelta, ObjectRefDelta:
+		baseOffset := e.baseOffset
+		if e.objectType == ObjectRefDelta {
+			var ok bool
+			if baseOffset, ok = p.index.Offset(e.baseSHA); !ok {
+				return nil, ErrDeltaBaseMissing
+			}
+		}
+		base, cached := p.bases.get(baseOffset)
+		if !cached {
+			if base, err = p.objectAt(baseOffset, depth+1); err != nil {
+				return nil, err
+			}
+			p.bases.add(baseOffset, base)
+		}
+		content, err := ApplyDelta(base.Content, e.data)
+		if err != nil {
+			return nil, err
+		}
+		return &Object{Type: base.Type, Content: content}, nil
+	default:
+		return &Object{Type: objectTypeNames[e.objectType], Content: e.data}, nil
+	}
+}
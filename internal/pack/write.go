@@ -0,0 +1,177 @@
+package pack
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"sort"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/objects"
+)
+
+var objectTypeCodes = map[string]int{
+	"commit": ObjectCommit,
+	"tree":   ObjectTree,
+	"blob":   ObjectBlob,
+	"tag":    ObjectTag,
+}
+
+// IndexEntry records where an object was written in a pack, as its .idx
+// entry needs.
+type IndexEntry struct {
+	SHA    string
+	Offset int64
+	CRC32  uint32
+}
+
+// IndexEntry returns what the .idx records for the entry.
+func (e *Entry) IndexEntry() IndexEntry {
+	return IndexEntry{SHA: e.SHA, Offset: e.Offset, CRC32: e.CRC32}
+}
+
+// Writer streams objects into a version 2 packfile, each stored whole.
+type Writer struct {
+	w         io.Writer
+	algorithm objects.Algorithm
+	hash      hash.Hash
+	offset    int64
+	count     int
+	entries   []IndexEntry
+}
+
+// NewWriter writes the header of a pack that will hold count objects,
+// named and checksummed with algorithm.
+func NewWriter(algorithm objects.Algorithm, w io.Writer, count int) (*Writer, error) {
+	writer := &Writer{algorithm: algorithm, hash: algorithm.New(), count: count, entries: make([]IndexEntry, 0, count)}
+	writer.w = io.MultiWriter(w, writer.hash)
+	header := make([]byte, 12)
+	copy(header, "PACK")
+	binary.BigEndian.PutUint32(header[4:8], 2)
+	binary.BigEndian.PutUint32(header[8:12], uint32(count))
+	if _, err := writer.w.Write(header); err != nil {
+		return nil, err
+	}
+	writer.offset = int64(len(header))
+	return writer, nil
+}
+
+// Add appends one object to the pack.
+func (writer *Writer) Add(object *Object) error {
+	if len(writer.entries) == writer.count {
+		return fmt.Errorf("Pack already holds the %v objects it was created for", writer.count)
+	}
+	objectType, ok := objectTypeCodes[object.Type]
+	if !ok {
+		return fmt.Errorf("Cannot pack object of type %q", object.Type)
+	}
+	// The type and size share a little-endian base-128 header whose first
+	// byte holds the type and the low four bits of the size.
+	size := uint64(len(object.Content))
+	data := []byte{byte(objectType<<4) | byte(size&0x0f)}
+	for size >>= 4; size != 0; size >>= 7 {
+		data[len(data)-1] |= 0x80
+		data = append(data, byte(size&0x7f))
+	}
+
+	compressed := bytes.NewBuffer(data)
+	zlibWriter := zlib.NewWriter(compressed)
+	if _, err := zlibWriter.Write(object.Content); err != nil {
+		return err
+	}
+	if err := zlibWriter.Close(); err != nil {
+		return err
+	}
+	if _, err := writer.w.Write(compressed.Bytes()); err != nil {
+		return err
+	}
+	writer.entries = append(writer.entries, IndexEntry{SHA: object.SHA(writer.algorithm), Offset: writer.offset, CRC32: crc32.ChecksumIEEE(compressed.Bytes())})
+	writer.offset += int64(compressed.Len())
+	return nil
+}
+
+// Close writes the trailer and returns the pack's checksum, which
+// also names it. Every promised object must have been added.
+func (writer *Writer) Close() ([]byte, error) {
+	if len(writer.entries) != writer.count {
+		return nil, fmt.Errorf("Pack was created for %v objects but holds %v", writer.count, len(writer.entries))
+	}
+	checksum := writer.hash.Sum(nil)
+	if _, err := writer.w.Write(checksum); err != nil {
+		return nil, err
+	}
+	return checksum, nil
+}
+
+// Entries returns the index entries of the objects added so far, in pack
+// order.
+func (writer *Writer) Entries() []IndexEntry {
+	return writer.entries
+}
+
+// Write encodes objects as a complete packfile and returns its checksum.
+func Write(algorithm objects.Algorithm, w io.Writer, packed []*Object) ([]byte, error) {
+	writer, err := NewWriter(algorithm, w, len(packed))
+	if err != nil {
+		return nil, err
+	}
+	for _, object := range packed {
+		if err := writer.Add(object); err != nil {
+			return nil, err
+		}
+	}
+	return writer.Close()
+}
+
+// WriteIndex writes the version 2 .idx for a pack with the given entries
+// and checksum. Offsets that do not fit in 31 bits go in the large offset
+// table. Object names and the checksum are those of algorithm.
+func WriteIndex(algorithm objects.Algorithm, w io.Writer, entries []IndexEntry, packChecksum []byte) error {
+	sorted := make([]IndexEntry, len(entries))
+	copy(sorted, entries)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].SHA < sorted[j].SHA })
+
+	var index bytes.Buffer
+	index.Write(indexMagic)
+	binary.Write(&index, binary.BigEndian, uint32(2))
+	var fanout [256]uint32
+	names := make([][]byte, len(sorted))
+	for position, entry := range sorted {
+		name, err := hex.DecodeString(entry.SHA)
+		if err != nil || len(name) != algorithm.Size() {
+			return fmt.Errorf("Invalid object name %q", entry.SHA)
+		}
+		names[position] = name
+		for bucket := int(name[0]); bucket < 256; bucket++ {
+			fanout[bucket]++
+		}
+	}
+	binary.Write(&index, binary.BigEndian, fanout)
+	for _, name := range names {
+		index.Write(name)
+	}
+	for _, entry := range sorted {
+		binary.Write(&index, binary.BigEndian, entry.CRC32)
+	}
+	largeOffsets := make([]uint64, 0)
+	for _, entry := range sorted {
+		if entry.Offset < 0x80000000 {
+			binary.Write(&index, binary.BigEndian, uint32(entry.Offset))
+			continue
+		}
+		binary.Write(&index, binary.BigEndian, uint32(0x80000000|len(largeOffsets)))
+		largeOffsets = append(largeOffsets, uint64(entry.Offset))
+	}
+	binary.Write(&index, binary.BigEndian, largeOffsets)
+	index.Write(packChecksum)
+	checksum := algorithm.New()
+	checksum.Write(index.Bytes())
+	index.Write(checksum.Sum(nil))
+
+	_, err := w.Write(index.Bytes())
+	return err
+}
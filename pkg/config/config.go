@@ -0,0 +1,167 @@
+// Package config reads and edits git's INI-style configuration files.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+)
+
+// Entry is one "key = value" line. Section and Key are lower-cased;
+// Subsection keeps its case.
+type Entry struct {
+	Section    string
+	Subsection string
+	Key        string
+	Value      string
+}
+
+// Name returns the entry's fully qualified name, "section[.subsection].key".
+func (entry Entry) Name() string {
+	if entry.Subsection == "" {
+		return entry.Section + "." + entry.Key
+	}
+	return entry.Section + "." + entry.Subsection + "." + entry.Key
+}
+
+// Config is the merged view of one or more config files, in the order they
+// were loaded. Later entries override earlier ones.
+type Config struct {
+	Entries []Entry
+}
+
+// Load reads each existing file in turn; missing files are skipped.
+// include.path entries pull in further files at the point they appear,
+// relative paths being taken from the including file's directory.
+func Load(paths ...string) (*Config, error) {
+	config := &Config{}
+	for _, path := range paths {
+		if err := config.load(path, 0); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+// maxIncludeDepth bounds include chains, which also stops include cycles.
+const maxIncludeDepth = 10
+
+func (config *Config) load(path string, depth int) error {
+	if depth > maxIncludeDepth {
+		return failure.Fatalf("fatal: exceeded maximum include depth (%v) while including %v", maxIncludeDepth, path)
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Error reading file %v: %w", path, err)
+	}
+	entries, err := Parse(string(content))
+	if err != nil {
+		return failure.Fatalf("fatal: bad config file %v: %w", path, err)
+	}
+	for _, entry := range entries {
+		config.Entries = append(config.Entries, entry)
+		if entry.Section == "include" && entry.Subsection == "" && entry.Key == "path" {
+			if err := config.load(includePath(entry.Value, path), depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func includePath(value string, from string) string {
+	if rest, ok := strings.CutPrefix(value, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	if filepath.IsAbs(value) {
+		return value
+	}
+	return filepath.Join(filepath.Dir(from), value)
+}
+
+// Get returns the last value set for name, such as "user.email" or
+// "remote.origin.url".
+func (config *Config) Get(name string) (string, bool) {
+	values := config.GetAll(name)
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[len(values)-1], true
+}
+
+// GetAll returns every value of a multi-valued name, in file order.
+func (config *Config) GetAll(name string) []string {
+	section, subsection, key, ok := SplitName(name)
+	if !ok {
+		return nil
+	}
+	values := make([]string, 0)
+	for _, entry := range config.Entries {
+		if entry.Section == section && entry.Subsection == subsection && entry.Key == key {
+			values = append(values, entry.Value)
+		}
+	}
+	return values
+}
+
+// SplitName splits "section.subsection.key" into its parts, lower-casing the
+// section and key. The subsection, which may itself contain dots, is empty
+// for two-part names.
+func SplitName(name string) (string, string, string, bool) {
+	first := strings.IndexByte(name, '.')
+	last := strings.LastIndexByte(name, '.')
+	if first <= 0 || last == len(name)-1 {
+		return "", "", "", false
+	}
+	section := strings.ToLower(name[:first])
+	key := strings.ToLower(name[last+1:])
+	subsection := ""
+	if first != last {
+		subsection = name[first+1 : last]
+	}
+	return section, subsection, key, true
+}
+
+// SystemPath returns the system-wide config file, or "" when
+// GIT_CONFIG_NOSYSTEM disables it.
+func SystemPath() string {
+	if noSystem := os.Getenv("GIT_CONFIG_NOSYSTEM"); noSystem != "" && noSystem != "0" && noSystem != "false" {
+		return ""
+	}
+	if path := os.Getenv("GIT_CONFIG_SYSTEM"); path != "" {
+		return path
+	}
+	return "/etc/gitconfig"
+}
+
+// GlobalPaths returns the per-user config files in load order:
+// $XDG_CONFIG_HOME/git/config, then ~/.gitconfig. GIT_CONFIG_GLOBAL
+// replaces both.
+func GlobalPaths() []string {
+	if path := os.Getenv("GIT_CONFIG_GLOBAL"); path != "" {
+		return []string{path}
+	}
+	paths := make([]string, 0, 2)
+	home, _ := os.UserHomeDir()
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	if xdg == "" && home != "" {
+		xdg = filepath.Join(home, ".config")
+	}
+	if xdg != "" {
+		paths = append(paths, filepath.Join(xdg, "git", "config"))
+	}
+	if home != "" {
+		paths = append(paths, filepath.Join(home, ".gitconfig"))
+	}
+	return paths
+}
@@ -0,0 +1,217 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Parse decodes config file content. A key with no "=" is a boolean true and
+// is reported with the value "true".
+func Parse(content string) ([]Entry, error) {
+	parsed, err := parseLines(splitLines(content))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(parsed.entries))
+	for _, entry := range parsed.entries {
+		entries = append(entries, entry.Entry)
+	}
+	return entries, nil
+}
+
+// lineEntry is an entry together with the lines it spans, first to last, so
+// the file can be edited in place.
+type lineEntry struct {
+	Entry
+	first, last int
+}
+
+// sectionHeader is a "[section]" line.
+type sectionHeader struct {
+	section, subsection string
+	line                int
+}
+
+type parsedFile struct {
+	entries []lineEntry
+	headers []sectionHeader
+}
+
+func splitLines(content string) []string {
+	content = strings.TrimSuffix(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	if content == "" {
+		return nil
+	}
+	return strings.Split(content, "\n")
+}
+
+func parseLines(lines []string) (*parsedFile, error) {
+	parsed := &parsedFile{}
+	section, subsection := "", ""
+	for number := 0; number < len(lines); number++ {
+		first := number
+		line := strings.TrimSpace(lines[number])
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' {
+			var rest string
+			var err error
+			section, subsection, rest, err = parseSectionHeader(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %v: %w", number+1, err)
+			}
+			parsed.headers = append(parsed.headers, sectionHeader{section: section, subsection: subsection, line: number})
+			// Entries may follow the header on the same line.
+			if line = strings.TrimSpace(rest); line == "" || line[0] == '#' || line[0] == ';' {
+				continue
+			}
+		}
+		if section == "" {
+			return nil, fmt.Errorf("line %v: key outside of any section", number+1)
+		}
+
+		key, rawValue, hasValue := strings.Cut(line, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		if !validKey(key) {
+			return nil, fmt.Errorf("line %v: invalid key %q", number+1, key)
+		}
+		value := "true"
+		if hasValue {
+			// A trailing backslash outside quotes continues the value on the
+			// next line.
+			for continuesLine(rawValue) && number+1 < len(lines) {
+				rawValue = rawValue[:len(rawValue)-1] + lines[number+1]
+				number++
+			}
+			var err error
+			if value, err = parseValue(rawValue); err != nil {
+				return nil, fmt.Errorf("line %v: %w", number+1, err)
+			}
+		}
+		parsed.entries = append(parsed.entries, lineEntry{
+			Entry: Entry{Section: section, Subsection: subsection, Key: key, Value: value},
+			first: first,
+			last:  number,
+		})
+	}
+	return parsed, nil
+}
+
+// parseSectionHeader reads `[section]`, `[section "subsection"]` or the
+// legacy `[section.subsection]`, returning whatever follows the "]".
+func parseSectionHeader(line string) (string, string, string, error) {
+	if quote := strings.IndexByte(line, '"'); quote >= 0 {
+		section := strings.TrimSpace(line[1:quote])
+		var subsection strings.Builder
+		for index := quote + 1; index < len(line); index++ {
+			switch c := line[index]; {
+			case c == '\\' && index+1 < len(line):
+				index++
+				subsection.WriteByte(line[index])
+			case c == '"':
+				rest := strings.TrimSpace(line[index+1:])
+				if !strings.HasPrefix(rest, "]") || !validSection(section) {
+					return "", "", "", errors.New("invalid section header")
+				}
+				return strings.ToLower(section), subsection.String(), rest[1:], nil
+			default:
+				subsection.WriteByte(c)
+			}
+		}
+		return "", "", "", errors.New("unterminated section header")
+	}
+	closing := strings.IndexByte(line, ']')
+	if closing < 0 {
+		return "", "", "", errors.New("unterminated section header")
+	}
+	name := line[1:closing]
+	section, subsection, _ := strings.Cut(name, ".")
+	if !validSection(section) {
+		return "", "", "", errors.New("invalid section header")
+	}
+	return strings.ToLower(section), strings.ToLower(subsection), line[closing+1:], nil
+}
+
+// parseValue strips surrounding whitespace and comments and resolves quotes
+// and escapes. Whitespace inside quotes is kept.
+func parseValue(raw string) (string, error) {
+	var value strings.Builder
+	inQuotes := false
+	pendingSpace := ""
+	for index := 0; index < len(raw); index++ {
+		c := raw[index]
+		switch {
+		case c == '"':
+			inQuotes = !inQuotes
+		case c == '\\':
+			if index+1 >= len(raw) {
+				return "", errors.New("bad escape at end of value")
+			}
+			index++
+			switch raw[index] {
+			case 'n':
+				c = '\n'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case '\\', '"':
+				c = raw[index]
+			default:
+				return "", fmt.Errorf("bad escape sequence \\%c", raw[index])
+			}
+			value.WriteString(pendingSpace)
+			pendingSpace = ""
+			value.WriteByte(c)
+		case !inQuotes && (c == '#' || c == ';'):
+			index = len(raw)
+		case !inQuotes && (c == ' ' || c == '\t'):
+			if value.Len() > 0 {
+				pendingSpace += string(c)
+			}
+		default:
+			value.WriteString(pendingSpace)
+			pendingSpace = ""
+			value.WriteByte(c)
+		}
+	}
+	if inQuotes {
+		return "", errors.New("unterminated quoted value")
+	}
+	return value.String(), nil
+}
+
+func continuesLine(raw string) bool {
+	trimmed := strings.TrimRight(raw, " \t")
+	if !strings.HasSuffix(trimmed, "\\") {
+		return false
+	}
+	backslashes := len(trimmed) - len(strings.TrimRight(trimmed, "\\"))
+	return backslashes%2 == 1 && len(trimmed) == len(raw)
+}
+
+func validSection(section string) bool {
+	if section == "" {
+		return false
+	}
+	for _, c := range section {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func validKey(key string) bool {
+	if key == "" || !(key[0] >= 'a' && key[0] <= 'z') {
+		return false
+	}
+	for _, c := range key {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,253 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/atomicfile"
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+)
+
+// Set gives name a single value in the file at path. An existing value is
+// replaced in place; otherwise the entry is added at the end of the last
+// matching section, or in a new section at the end of the file.
+func Set(path string, name string, value string) error {
+	return edit(path, name, func(lines []string, parsed *parsedFile, matches []lineEntry, key string) ([]string, error) {
+		switch len(matches) {
+		case 0:
+			return insertEntry(lines, parsed, name, key, value), nil
+		case 1:
+			match := matches[0]
+			if isHeaderLine(lines[match.first]) {
+				header, _, _ := strings.Cut(lines[match.first], "]")
+				return splice(lines, match.first, match.last+1, header+"]", formatEntry(key, value)), nil
+			}
+			return splice(lines, match.first, match.last+1, formatEntry(key, value)), nil
+		default:
+			return nil, fmt.Errorf("warning: %v has multiple values\nerror: cannot overwrite multiple values with a single value\n       Use a regexp, --add or --replace-all to change %v.", name, name)
+		}
+	})
+}
+
+// Add appends another value for name, keeping the existing ones.
+func Add(path string, name string, value string) error {
+	return edit(path, name, func(lines []string, parsed *parsedFile, matches []lineEntry, key string) ([]string, error) {
+		if len(matches) > 0 {
+			last := matches[len(matches)-1]
+			return splice(lines, last.last+1, last.last+1, formatEntry(key, value)), nil
+		}
+		return insertEntry(lines, parsed, name, key, value), nil
+	})
+}
+
+// ErrNotSet is returned by Unset when the file has no value for the name.
+var ErrNotSet = errors.New("config value not set")
+
+// Unset removes name from the file at path. Unless all is set, a name with
+// several values is left alone and reported as an error.
+func Unset(path string, name string, all bool) error {
+	return edit(path, name, func(lines []string, parsed *parsedFile, matches []lineEntry, key string) ([]string, error) {
+		if len(matches) == 0 {
+			return nil, ErrNotSet
+		}
+		if len(matches) > 1 && !all {
+			return nil, fmt.Errorf("warning: %v has multiple values", name)
+		}
+		for index := len(matches) - 1; index >= 0; index-- {
+			match := matches[index]
+			if isHeaderLine(lines[match.first]) {
+				// Keep a header that shares its line with the entry.
+				header, _, _ := strings.Cut(lines[match.first], "]")
+				lines = splice(lines, match.first, match.last+1, header+"]")
+				continue
+			}
+			lines = splice(lines, match.first, match.last+1)
+		}
+		return lines, nil
+	})
+}
+
+// ErrNoSection is returned by RemoveSection and RenameSection when the file
+// has no section of that name.
+var ErrNoSection = errors.New("no such section")
+
+// RemoveSection deletes every section called name, "section" or
+// "section.subsection", with all of its entries.
+func RemoveSection(path string, name string) error {
+	return editSections(path, name, func(lines []string, header sectionHeader, end int) []string {
+		return splice(lines, header.line, end)
+	})
+}
+
+// RenameSection gives every section called oldName the name newName, keeping
+// its entries.
+func RenameSection(path string, oldName string, newName string) error {
+	section, subsection, _ := strings.Cut(newName, ".")
+	if !validSection(section) || strings.Contains(subsection, "\n") {
+		return fmt.Errorf("error: invalid section name: %v", newName)
+	}
+	return editSections(path, oldName, func(lines []string, header sectionHeader, end int) []string {
+		// Keep any entry that shares the header's line.
+		_, _, rest, _ := parseSectionHeader(strings.TrimSpace(lines[header.line]))
+		return splice(lines, header.line, header.line+1, formatHeader(section, subsection)+rest)
+	})
+}
+
+// editSections applies change to each section called name, last first so
+// earlier line numbers stay valid. end is the line after the section.
+func editSections(path string, name string, change func(lines []string, header sectionHeader, end int) []string) error {
+	section, subsection, _ := strings.Cut(name, ".")
+	section = strings.ToLower(section)
+	content, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("Error reading file %v: %w", path, err)
+	}
+	lines := splitLines(string(content))
+	parsed, err := parseLines(lines)
+	if err != nil {
+		return failure.Fatalf("fatal: bad config file %v: %w", path, err)
+	}
+	found := false
+	for index := len(parsed.headers) - 1; index >= 0; index-- {
+		header := parsed.headers[index]
+		if header.section != section || header.subsection != subsection {
+			continue
+		}
+		end := len(lines)
+		if index+1 < len(parsed.headers) {
+			end = parsed.headers[index+1].line
+		}
+		lines = change(lines, header, end)
+		found = true
+	}
+	if !found {
+		return ErrNoSection
+	}
+	return writeLocked(path, strings.Join(lines, "\n")+"\n")
+}
+
+type editFunc func(lines []string, parsed *parsedFile, matches []lineEntry, key string) ([]string, error)
+
+// edit applies change to the entries of name in the file at path and writes
+// the result through a config.lock file.
+func edit(path string, name string, change editFunc) error {
+	section, subsection, key, err := checkName(name)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("Error reading file %v: %w", path, err)
+	}
+	lines := splitLines(string(content))
+	parsed, err := parseLines(lines)
+	if err != nil {
+		return failure.Fatalf("fatal: bad config file %v: %w", path, err)
+	}
+	matches := make([]lineEntry, 0)
+	for _, entry := range parsed.entries {
+		if entry.Section == section && entry.Subsection == subsection && entry.Key == key {
+			matches = append(matches, entry)
+		}
+	}
+	// New lines spell the key as given; git matches keys without case.
+	lines, err = change(lines, parsed, matches, name[strings.LastIndexByte(name, '.')+1:])
+	if err != nil {
+		return err
+	}
+	return writeLocked(path, strings.Join(lines, "\n")+"\n")
+}
+
+// checkName validates a name for writing and splits it like SplitName.
+func checkName(name string) (string, string, string, error) {
+	section, subsection, key, ok := SplitName(name)
+	if !ok {
+		return "", "", "", fmt.Errorf("error: key does not contain a section: %v", name)
+	}
+	if !validSection(section) || strings.Contains(section, ".") || !validKey(key) || strings.Contains(subsection, "\n") {
+		return "", "", "", fmt.Errorf("error: invalid key: %v", name)
+	}
+	return section, subsection, key, nil
+}
+
+// insertEntry adds a new entry after the last line of the last section named
+// like name, or starts that section at the end of the file.
+func insertEntry(lines []string, parsed *parsedFile, name string, key string, value string) []string {
+	section, subsection, _, _ := SplitName(name)
+	for index := len(parsed.headers) - 1; index >= 0; index-- {
+		header := parsed.headers[index]
+		if header.section != section || header.subsection != subsection {
+			continue
+		}
+		end := header.line
+		for _, entry := range parsed.entries {
+			if entry.first >= header.line && (index+1 == len(parsed.headers) || entry.first < parsed.headers[index+1].line) {
+				end = entry.last
+			}
+		}
+		return splice(lines, end+1, end+1, formatEntry(key, value))
+	}
+
+	lines = append(lines, formatHeader(name[:strings.IndexByte(name, '.')], subsection))
+	return append(lines, formatEntry(key, value))
+}
+
+func formatHeader(section string, subsection string) string {
+	if subsection == "" {
+		return "[" + section + "]"
+	}
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(subsection)
+	return fmt.Sprintf("[%v \"%v\"]", section, escaped)
+}
+
+func formatEntry(key string, value string) string {
+	return "\t" + key + " = " + formatValue(value)
+}
+
+// formatValue escapes a value and quotes it when leading or trailing
+// whitespace or a comment character would otherwise be lost.
+func formatValue(value string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`, "\b", `\b`).Replace(value)
+	if value != strings.TrimSpace(value) || strings.ContainsAny(value, "#;") {
+		return `"` + escaped + `"`
+	}
+	return escaped
+}
+
+func splice(lines []string, start int, end int, replacement ...string) []string {
+	spliced := make([]string, 0, len(lines)-(end-start)+len(replacement))
+	spliced = append(spliced, lines[:start]...)
+	spliced = append(spliced, replacement...)
+	return append(spliced, lines[end:]...)
+}
+
+func isHeaderLine(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), "[")
+}
+
+func writeLocked(path string, content string) error {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("Failed to create directory %v: %w", dir, err)
+		}
+	}
+	lock, err := atomicfile.Lock(path)
+	var locked *atomicfile.LockedError
+	if errors.As(err, &locked) {
+		return fmt.Errorf("error: could not lock config file %v: File exists", path)
+	} else if err != nil {
+		return fmt.Errorf("error: could not lock config file %v: %w", path, err)
+	}
+	defer lock.Abort()
+	if _, err := lock.WriteString(content); err != nil {
+		return fmt.Errorf("Failed to write %v: %w", lock.Name(), err)
+	}
+	if err := lock.Commit(path, 0644); err != nil {
+		return fmt.Errorf("Failed to write %v: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,369 @@
+// Package diff computes line diffs with the Myers algorithm and formats them
+// as unified diff hunks.
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// OpKind says whether a line is kept, removed from the old side or added on
+// the new side.
+type OpKind int
+
+const (
+	Equal OpKind = iota
+	Delete
+	Insert
+)
+
+// Op is one line of an edit script. OldLine and NewLine are 0-based indexes
+// into the two inputs; only the side(s) the op touches are meaningful.
+type Op struct {
+	Kind    OpKind
+	OldLine int
+	NewLine int
+}
+
+// SplitLines splits content into lines that keep their "\n" terminator, so
+// a final line without one never compares equal to the same text with one.
+func SplitLines(content []byte) []string {
+	lines := make([]string, 0, bytes.Count(content, []byte("\n"))+1)
+	for len(content) > 0 {
+		end := bytes.IndexByte(content, '\n')
+		if end < 0 {
+			end = len(content) - 1
+		}
+		lines = append(lines, string(content[:end+1]))
+		content = content[end+1:]
+	}
+	return lines
+}
+
+// IsBinary applies git's test: content is binary when its first 8000 bytes
+// contain a NUL.
+func IsBinary(content []byte) bool {
+	if len(content) > 8000 {
+		content = content[:8000]
+	}
+	return bytes.IndexByte(content, 0) >= 0
+}
+
+// Lines returns a shortest edit script turning a into b, found with Myers'
+// O(ND) algorithm in linear space. Runs of changes are then slid as far down as they can go,
+// so ambiguous edits come out the way git shows them.
+func Lines(a []string, b []string) []Op {
+	// Common prefixes and suffixes are cheap to strip and keep the search
+	// small for typical edits.
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	script := &editScript{a: a, b: b, ops: make([]Op, 0, len(a)+len(b))}
+	for index := 0; index < prefix; index++ {
+		script.equal(index, index)
+	}
+	script.compare(prefix, len(a)-suffix, prefix, len(b)-suffix)
+	for index := 0; index < suffix; index++ {
+		script.equal(len(a)-suffix+index, len(b)-suffix+index)
+	}
+	return deletionsFirst(slideDown(deletionsFirst(script.ops), a, b))
+}
+
+// deletionsFirst orders each run of changes so its deletions come before its
+// insertions, the way unified diffs present a replaced block.
+func deletionsFirst(ops []Op) []Op {
+	for start := 0; start < len(ops); start++ {
+		if ops[start].Kind == Equal {
+			continue
+		}
+		end := start
+		for end < len(ops) && ops[end].Kind != Equal {
+			end++
+		}
+		run := ops[start:end]
+		oldStart, newStart := run[0].OldLine, run[0].NewLine
+		sort.SliceStable(run, func(i, j int) bool { return run[i].Kind == Delete && run[j].Kind == Insert })
+		deletions := 0
+		for index := range run {
+			if run[index].Kind == Delete {
+				run[index].NewLine = newStart
+				deletions++
+			} else {
+				run[index].OldLine = oldStart + deletions
+			}
+		}
+		start = end
+	}
+	return ops
+}
+
+type editScript struct {
+	a, b []string
+	ops  []Op
+}
+
+func (script *editScript) equal(oldLine int, newLine int) {
+	script.ops = append(script.ops, Op{Kind: Equal, OldLine: oldLine, NewLine: newLine})
+}
+
+// compare appends the edits turning a[aLow:aHigh] into b[bLow:bHigh], using
+// the linear-space variant of Myers: find the middle snake of an optimal
+// path, then solve the halves on either side of it.
+func (script *editScript) compare(aLow, aHigh, bLow, bHigh int) {
+	for aLow < aHigh && bLow < bHigh && script.a[aLow] == script.b[bLow] {
+		script.equal(aLow, bLow)
+		aLow++
+		bLow++
+	}
+	suffix := 0
+	for aLow < aHigh-suffix && bLow < bHigh-suffix && script.a[aHigh-1-suffix] == script.b[bHigh-1-suffix] {
+		suffix++
+	}
+	aHigh, bHigh = aHigh-suffix, bHigh-suffix
+
+	switch {
+	case aLow == aHigh:
+		for line := bLow; line < bHigh; line++ {
+			script.ops = append(script.ops, Op{Kind: Insert, OldLine: aLow, NewLine: line})
+		}
+	case bLow == bHigh:
+		for line := aLow; line < aHigh; line++ {
+			script.ops = append(script.ops, Op{Kind: Delete, OldLine: line, NewLine: bLow})
+		}
+	default:
+		x, y, u, v := script.middleSnake(aLow, aHigh, bLow, bHigh)
+		script.compare(aLow, x, bLow, y)
+		for ; x < u; x, y = x+1, y+1 {
+			script.equal(x, y)
+		}
+		script.compare(u, aHigh, v, bHigh)
+	}
+	for index := 0; index < suffix; index++ {
+		script.equal(aHigh+index, bHigh+index)
+	}
+}
+
+// middleSnake runs the search from both ends at once until the paths meet
+// and returns the snake where they do, from (x, y) to (u, v).
+func (script *editScript) middleSnake(aLow, aHigh, bLow, bHigh int) (int, int, int, int) {
+	a, b := script.a[aLow:aHigh], script.b[bLow:bHigh]
+	n, m := len(a), len(b)
+	delta := n - m
+	odd := delta%2 != 0
+	maxD := (n + m + 1) / 2
+	offset := maxD + 1
+	forward := make([]int, 2*maxD+3)
+	backward := make([]int, 2*maxD+3)
+
+	for d := 0; d <= maxD; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+			if reverse := delta - k; odd && reverse >= -(d-1) && reverse <= d-1 && x+backward[offset+reverse] >= n {
+				return aLow + startX, bLow + startY, aLow + x, bLow + y
+			}
+		}
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && a[n-1-x] == b[m-1-y] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+			if front := delta - k; !odd && front >= -d && front <= d && x+forward[offset+front] >= n {
+				return aLow + n - x, bLow + m - y, aLow + n - startX, bLow + m - startY
+			}
+		}
+	}
+	// Unreachable: the searches always meet by maxD.
+	return aLow, bLow, aLow, bLow
+}
+
+// slideDown moves each run of deletions or insertions past following lines
+// equal to the run's first line. The script stays equivalent, but a change
+// is placed last among its possible positions, as git places it.
+func slideDown(ops []Op, a []string, b []string) []Op {
+	for start := 0; start < len(ops); {
+		kind := ops[start].Kind
+		if kind == Equal {
+			start++
+			continue
+		}
+		end := start
+		for end < len(ops) && ops[end].Kind == kind {
+			end++
+		}
+		for end < len(ops) && ops[end].Kind == Equal {
+			first, equal := ops[start], ops[end]
+			if kind == Delete && a[first.OldLine] != a[equal.OldLine] || kind == Insert && b[first.NewLine] != b[equal.NewLine] {
+				break
+			}
+			// The first changed line becomes the kept one and the kept line
+			// joins the end of the run.
+			ops[start] = Op{Kind: Equal, OldLine: first.OldLine, NewLine: first.NewLine}
+			if kind == Delete {
+				ops[start].NewLine = equal.NewLine
+				for index := start + 1; index <= end; index++ {
+					ops[index] = Op{Kind: Delete, OldLine: first.OldLine + index - start, NewLine: equal.NewLine + 1}
+				}
+			} else {
+				ops[start].OldLine = equal.OldLine
+				for index := start + 1; index <= end; index++ {
+					ops[index] = Op{Kind: Insert, OldLine: equal.OldLine + 1, NewLine: first.NewLine + index - start}
+				}
+			}
+			start++
+			end++
+		}
+		start = end
+	}
+	return ops
+}
+
+// Hunk is a group of changes with surrounding context, in the "@@ -a,b +c,d @@"
+// form. Starts are 1-based, or the line before an empty range.
+type Hunk struct {
+	OldStart, OldCount int
+	NewStart, NewCount int
+	Ops                []Op
+}
+
+// Hunks groups an edit script into hunks with context lines on each side.
+// Changes separated by at most 2*context equal lines share a hunk.
+func Hunks(ops []Op, context int) []Hunk {
+	hunks := make([]Hunk, 0)
+	for index := 0; index < len(ops); {
+		if ops[index].Kind == Equal {
+			index++
+			continue
+		}
+		start := index - context
+		if start < 0 {
+			start = 0
+		}
+		end := index
+		for end < len(ops) {
+			if ops[end].Kind != Equal {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].Kind == Equal {
+				run++
+			}
+			if run == len(ops) || run-end > 2*context {
+				end += min(context, run-end)
+				break
+			}
+			end = run
+		}
+		hunks = append(hunks, newHunk(ops[start:end]))
+		index = end
+	}
+	return hunks
+}
+
+func newHunk(ops []Op) Hunk {
+	hunk := Hunk{Ops: ops}
+	hunk.OldStart, hunk.NewStart = ops[0].OldLine+1, ops[0].NewLine+1
+	for _, op := range ops {
+		if op.Kind != Insert {
+			hunk.OldCount++
+		}
+		if op.Kind != Delete {
+			hunk.NewCount++
+		}
+	}
+	if hunk.OldCount == 0 {
+		hunk.OldStart--
+	}
+	if hunk.NewCount == 0 {
+		hunk.NewStart--
+	}
+	return hunk
+}
+
+// WriteUnified writes the hunks of a diff from a to b. Each hunk header
+// carries the nearest preceding line of a that looks like a function
+// heading, as git's default funcname rule picks it.
+func WriteUnified(w io.Writer, a []string, b []string, context int) error {
+	for _, hunk := range Hunks(Lines(a, b), context) {
+		header := fmt.Sprintf("@@ -%v +%v @@", rangeSpec(hunk.OldStart, hunk.OldCount), rangeSpec(hunk.NewStart, hunk.NewCount))
+		if heading := functionHeading(a, hunk.Ops[0].OldLine); heading != "" {
+			header += " " + heading
+		}
+		if _, err := fmt.Fprintln(w, header); err != nil {
+			return err
+		}
+		for _, op := range hunk.Ops {
+			var marker, line string
+			switch op.Kind {
+			case Equal:
+				marker, line = " ", a[op.OldLine]
+			case Delete:
+				marker, line = "-", a[op.OldLine]
+			case Insert:
+				marker, line = "+", b[op.NewLine]
+			}
+			if !strings.HasSuffix(line, "\n") {
+				line += "\n\\ No newline at end of file\n"
+			}
+			if _, err := io.WriteString(w, marker+line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func rangeSpec(start int, count int) string {
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%v,%v", start, count)
+}
+
+// functionHeading searches backwards from the line before hunkStart for a
+// line starting with a letter, "_" or "$", trimmed to 80 bytes.
+func functionHeading(lines []string, hunkStart int) string {
+	for index := hunkStart - 1; index >= 0; index-- {
+		line := lines[index]
+		if line == "" {
+			continue
+		}
+		if c := line[0]; c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == '$' {
+			if len(line) > 80 {
+				line = line[:80]
+			}
+			return strings.TrimRight(line, " \t\r\n")
+		}
+	}
+	return ""
+}
@@ -0,0 +1,205 @@
+package diff
+
+import "bytes"
+
+// change is a run of edits from one side of a merge, covering base lines
+// [baseStart, baseEnd) and side lines [sideStart, sideEnd).
+type change struct {
+	baseStart, baseEnd int
+	sideStart, sideEnd int
+}
+
+// changes groups an edit script into its runs of deletions and insertions.
+func changes(ops []Op) []change {
+	grouped := make([]change, 0)
+	for index := 0; index < len(ops); {
+		if ops[index].Kind == Equal {
+			index++
+			continue
+		}
+		run := change{baseStart: ops[index].OldLine, sideStart: ops[index].NewLine}
+		run.baseEnd, run.sideEnd = run.baseStart, run.sideStart
+		for ; index < len(ops) && ops[index].Kind != Equal; index++ {
+			if ops[index].Kind == Delete {
+				run.baseEnd++
+			} else {
+				run.sideEnd++
+			}
+		}
+		grouped = append(grouped, run)
+	}
+	return grouped
+}
+
+type chunkKind int
+
+const (
+	unchanged chunkKind = iota
+	resolved
+	conflicted
+)
+
+// chunk is a stretch of merge output: lines both sides agree on, or the two
+// versions of a conflict.
+type chunk struct {
+	kind   chunkKind
+	lines  []string
+	theirs []string
+}
+
+// Merge combines the edits ours and theirs each made to base, git's
+// three-way file merge. Overlapping or abutting edits that differ conflict;
+// like git's default "zealous" level, lines the two versions share are
+// taken out of a conflict and conflicts at most three lines apart are
+// joined. Conflicts are written between "<<<<<<< ", "=======" and ">>>>>>> "
+// markers carrying the labels, and the number of them is returned.
+func Merge(base []string, ours []string, theirs []string, oursLabel string, theirsLabel string) ([]byte, int) {
+	oursChanges, theirsChanges := changes(Lines(base, ours)), changes(Lines(base, theirs))
+	chunks := make([]chunk, 0)
+	basePos, oursDelta, theirsDelta := 0, 0, 0
+	for i, j := 0, 0; i < len(oursChanges) || j < len(theirsChanges); {
+		var regionStart, regionEnd int
+		if j >= len(theirsChanges) || i < len(oursChanges) && oursChanges[i].baseStart <= theirsChanges[j].baseStart {
+			regionStart, regionEnd = oursChanges[i].baseStart, oursChanges[i].baseEnd
+		} else {
+			regionStart, regionEnd = theirsChanges[j].baseStart, theirsChanges[j].baseEnd
+		}
+
+		// Take in every edit from either side that reaches the region; a
+		// run of one side's edits is separated by unchanged lines, so it only
+		// grows through the other side.
+		oursFrom, theirsFrom := i, j
+		for extending := true; extending; {
+			switch {
+			case i < len(oursChanges) && oursChanges[i].baseStart <= regionEnd:
+				regionEnd = max(regionEnd, oursChanges[i].baseEnd)
+				i++
+			case j < len(theirsChanges) && theirsChanges[j].baseStart <= regionEnd:
+				regionEnd = max(regionEnd, theirsChanges[j].baseEnd)
+				j++
+			default:
+				extending = false
+			}
+		}
+		chunks = append(chunks, chunk{kind: unchanged, lines: base[basePos:regionStart]})
+		basePos = regionEnd
+
+		sideLines := func(side []string, sideChanges []change, delta *int) []string {
+			start := regionStart + *delta
+			for _, run := range sideChanges {
+				*delta += (run.sideEnd - run.sideStart) - (run.baseEnd - run.baseStart)
+			}
+			return side[start : regionEnd+*delta]
+		}
+		oursLines := sideLines(ours, oursChanges[oursFrom:i], &oursDelta)
+		theirsLines := sideLines(theirs, theirsChanges[theirsFrom:j], &theirsDelta)
+		switch {
+		case oursFrom == i:
+			chunks = append(chunks, chunk{kind: resolved, lines: theirsLines})
+		case i-oursFrom == 1 && j-theirsFrom == 1 && oursChanges[oursFrom].baseStart == theirsChanges[theirsFrom].baseStart &&
+			oursChanges[oursFrom].baseEnd == theirsChanges[theirsFrom].baseEnd && equalLines(oursLines, theirsLines):
+			// The same edit made on both sides counts as
+			// unchanged, so it does not keep conflicts around it apart.
+			chunks = append(chunks, chunk{kind: unchanged, lines: oursLines})
+		case theirsFrom == j || equalLines(oursLines, theirsLines):
+			chunks = append(chunks, chunk{kind: resolved, lines: oursLines})
+		default:
+			chunks = append(chunks, refineConflict(oursLines, theirsLines)...)
+		}
+	}
+	chunks = append(chunks, chunk{kind: unchanged, lines: base[basePos:]})
+	chunks = joinConflicts(chunks)
+
+	var merged bytes.Buffer
+	conflicts := 0
+	writeLines := func(lines []string) {
+		for _, line := range lines {
+			merged.WriteString(line)
+		}
+		if len(lines) > 0 && lines[len(lines)-1][len(lines[len(lines)-1])-1] != '\n' {
+			merged.WriteByte('\n')
+		}
+	}
+	for _, piece := range chunks {
+		if piece.kind != conflicted {
+			for _, line := range piece.lines {
+				merged.WriteString(line)
+			}
+			continue
+		}
+		conflicts++
+		merged.WriteString("<<<<<<< " + oursLabel + "\n")
+		writeLines(piece.lines)
+		merged.WriteString("=======\n")
+		writeLines(piece.theirs)
+		merged.WriteString(">>>>>>> " + theirsLabel + "\n")
+	}
+	return merged.Bytes(), conflicts
+}
+
+// refineConflict splits a conflict around the lines both versions share.
+func refineConflict(ours []string, theirs []string) []chunk {
+	chunks := make([]chunk, 0)
+	ops := Lines(ours, theirs)
+	for index := 0; index < len(ops); {
+		if ops[index].Kind == Equal {
+			chunks = append(chunks, chunk{kind: unchanged, lines: ours[ops[index].OldLine : ops[index].OldLine+1]})
+			index++
+			continue
+		}
+		piece := chunk{kind: conflicted}
+		for ; index < len(ops) && ops[index].Kind != Equal; index++ {
+			if ops[index].Kind == Delete {
+				piece.lines = append(piece.lines, ours[ops[index].OldLine])
+			} else {
+				piece.theirs = append(piece.theirs, theirs[ops[index].NewLine])
+			}
+		}
+		chunks = append(chunks, piece)
+	}
+	return chunks
+}
+
+// joinConflicts merges consecutive unchanged chunks, then folds two conflicts
+// separated by no more than three unchanged lines into one.
+func joinConflicts(chunks []chunk) []chunk {
+	joined := make([]chunk, 0, len(chunks))
+	for _, piece := range chunks {
+		last := len(joined) - 1
+		if last >= 0 && piece.kind == unchanged && joined[last].kind == unchanged {
+			joined[last].lines = append(append([]string(nil), joined[last].lines...), piece.lines...)
+			continue
+		}
+		if piece.kind == unchanged && len(piece.lines) == 0 {
+			continue
+		}
+		joined = append(joined, piece)
+	}
+
+	folded := make([]chunk, 0, len(joined))
+	for _, piece := range joined {
+		last := len(folded) - 1
+		if piece.kind == conflicted && last >= 1 && folded[last].kind == unchanged && len(folded[last].lines) <= 3 && folded[last-1].kind == conflicted {
+			gap := folded[last].lines
+			previous := &folded[last-1]
+			previous.lines = append(append(append([]string(nil), previous.lines...), gap...), piece.lines...)
+			previous.theirs = append(append(append([]string(nil), previous.theirs...), gap...), piece.theirs...)
+			folded = folded[:last]
+			continue
+		}
+		folded = append(folded, piece)
+	}
+	return folded
+}
+
+func equalLines(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for index := range a {
+		if a[index] != b[index] {
+			return false
+		}
+	}
+	return true
+}
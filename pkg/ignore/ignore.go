@@ -0,0 +1,243 @@
+// Package ignore matches worktree paths against gitignore rules.
+package ignore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Pattern is one rule from a .gitignore or exclude file.
+type Pattern struct {
+	// Source is the file the rule came from, relative to the worktree, and
+	// Line its 1-based line number.
+	Source string
+	Line   int
+	// Text is the rule as written, used when reporting matches.
+	Text string
+
+	negate   bool
+	dirOnly  bool
+	anchored bool
+	base     string
+	regexp   *regexp.Regexp
+}
+
+// Negated reports whether the rule re-includes paths ("!pattern").
+func (pattern *Pattern) Negated() bool {
+	return pattern.negate
+}
+
+// Matcher answers ignore queries for one worktree. .gitignore files are read
+// lazily as directories are queried and cached for the Matcher's lifetime.
+type Matcher struct {
+	root     string
+	excludes []*Pattern
+	perDir   map[string][]*Pattern
+}
+
+// New returns a Matcher for the worktree at root. excludeFile, typically
+// .git/info/exclude, holds the lowest-precedence rules and may be missing.
+func New(root string, excludeFile string) (*Matcher, error) {
+	matcher := &Matcher{root: root, perDir: make(map[string][]*Pattern)}
+	if excludeFile != "" {
+		source := excludeFile
+		if relative, err := filepath.Rel(root, excludeFile); err == nil {
+			source = filepath.ToSlash(relative)
+		}
+		patterns, err := readPatterns(excludeFile, source, "")
+		if err != nil {
+			return nil, err
+		}
+		matcher.excludes = patterns
+	}
+	return matcher, nil
+}
+
+// Ignored reports whether path, slash-separated and relative to the
+// worktree, is excluded.
+func (matcher *Matcher) Ignored(path string, isDir bool) bool {
+	pattern := matcher.Match(path, isDir)
+	return pattern != nil && !pattern.negate
+}
+
+// Match returns the rule that decides path, or nil when no rule applies. A
+// negated rule means the path is explicitly not ignored. Nothing
+// below an excluded directory can be re-included, so an excluded parent
+// decides for all of its contents.
+func (matcher *Matcher) Match(path string, isDir bool) *Pattern {
+	path = strings.Trim(path, "/")
+	components := strings.Split(path, "/")
+	for depth := 1; depth < len(components); depth++ {
+		parent := strings.Join(components[:depth], "/")
+		if pattern := matcher.matchOne(parent, true); pattern != nil && !pattern.negate {
+			return pattern
+		}
+	}
+	return matcher.matchOne(path, isDir)
+}
+
+// matchOne applies the rules visible from path's directory, the last
+// matching rule winning, with deeper .gitignore files read last.
+func (matcher *Matcher) matchOne(path string, isDir bool) *Pattern {
+	dirs := []string{""}
+	if dir := filepath.ToSlash(filepath.Dir(path)); dir != "." {
+		components := strings.Split(dir, "/")
+		for depth := 1; depth <= len(components); depth++ {
+			dirs = append(dirs, strings.Join(components[:depth], "/"))
+		}
+	}
+
+	var matched *Pattern
+	check := func(patterns []*Pattern) {
+		for _, pattern := range patterns {
+			if pattern.matches(path, isDir) {
+				matched = pattern
+			}
+		}
+	}
+	check(matcher.excludes)
+	for _, dir := range dirs {
+		check(matcher.dirPatterns(dir))
+	}
+	return matched
+}
+
+func (matcher *Matcher) dirPatterns(dir string) []*Pattern {
+	if patterns, ok := matcher.perDir[dir]; ok {
+		return patterns
+	}
+	source := path.Join(dir, ".gitignore")
+	patterns, err := readPatterns(filepath.Join(matcher.root, filepath.FromSlash(source)), source, dir)
+	if err != nil {
+		// An unreadable .gitignore contributes no rules.
+		patterns = nil
+	}
+	matcher.perDir[dir] = patterns
+	return patterns
+}
+
+func readPatterns(filePath string, source string, base string) ([]*Pattern, error) {
+	content, err := os.ReadFile(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading file %v: %w", filePath, err)
+	}
+	return ParsePatterns(string(content), source, base), nil
+}
+
+// ParsePatterns parses gitignore content. base is the directory, relative to
+// the worktree, that the file lives in; source names it in Pattern.Source.
+func ParsePatterns(content string, source string, base string) []*Pattern {
+	patterns := make([]*Pattern, 0)
+	for index, line := range strings.Split(content, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if pattern := parsePattern(line, base); pattern != nil {
+			pattern.Source = source
+			pattern.Line = index + 1
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+func parsePattern(line string, base string) *Pattern {
+	// Trailing spaces are dropped unless escaped with a backslash.
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+	pattern := &Pattern{Text: line, base: base}
+	if strings.HasPrefix(line, "!") {
+		pattern.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		pattern.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return nil
+	}
+	if strings.Contains(line, "/") {
+		pattern.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	expression, err := regexp.Compile("^" + globToRegexp(line) + "$")
+	if err != nil {
+		return nil
+	}
+	pattern.regexp = expression
+	return pattern
+}
+
+func (pattern *Pattern) matches(path string, isDir bool) bool {
+	if pattern.dirOnly && !isDir {
+		return false
+	}
+	if pattern.base != "" {
+		if !strings.HasPrefix(path, pattern.base+"/") {
+			return false
+		}
+		path = strings.TrimPrefix(path, pattern.base+"/")
+	}
+	if !pattern.anchored {
+		path = path[strings.LastIndex(path, "/")+1:]
+	}
+	return pattern.regexp.MatchString(path)
+}
+
+// globToRegexp translates gitignore wildcards, including the "**" forms,
+// into a regular expression over slash-separated paths.
+func globToRegexp(glob string) string {
+	var expression strings.Builder
+	for index := 0; index < len(glob); index++ {
+		c := glob[index]
+		switch {
+		case strings.HasPrefix(glob[index:], "**/"):
+			if index == 0 || glob[index-1] == '/' {
+				expression.WriteString("(?:.*/)?")
+				index += 2
+				continue
+			}
+			expression.WriteString("[^/]*")
+			index++
+		case strings.HasPrefix(glob[index:], "**") && index+2 == len(glob) && (index == 0 || glob[index-1] == '/'):
+			expression.WriteString(".*")
+			index++
+		case c == '*':
+			expression.WriteString("[^/]*")
+		case c == '?':
+			expression.WriteString("[^/]")
+		case c == '[':
+			closing := strings.IndexByte(glob[index+1:], ']')
+			if closing < 0 {
+				expression.WriteString(`\[`)
+				continue
+			}
+			class := glob[index+1 : index+1+closing]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expression.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			index += closing + 1
+		case c == '\\' && index+1 < len(glob):
+			index++
+			expression.WriteString(regexp.QuoteMeta(string(glob[index])))
+		default:
+			expression.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return expression.String()
+}
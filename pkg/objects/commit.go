@@ -0,0 +1,66 @@
+package objects
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Commit is a parsed commit object. Identities are kept in their raw
+// "Name <email> <unix-seconds> <+hhmm>" form.
+type Commit struct {
+	Tree      string
+	Parents   []string
+	Author    string
+	Committer string
+	Encoding  string
+	Message   string
+}
+
+// ParseCommit decodes a commit object, skipping headers it does not model
+// such as gpgsig.
+func ParseCommit(data []byte) (*Commit, error) {
+	commit := &Commit{}
+	headers, message, _ := strings.Cut(string(data), "\n\n")
+	commit.Message = message
+	for _, line := range strings.Split(headers, "\n") {
+		if strings.HasPrefix(line, " ") {
+			// Continuation of a multi-line header such as gpgsig.
+			continue
+		}
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "tree":
+			commit.Tree = value
+		case "parent":
+			commit.Parents = append(commit.Parents, value)
+		case "author":
+			commit.Author = value
+		case "committer":
+			commit.Committer = value
+		case "encoding":
+			commit.Encoding = value
+		}
+	}
+	if commit.Tree == "" {
+		return nil, errors.New("Malformed commit object: missing tree")
+	}
+	return commit, nil
+}
+
+// Encode returns the commit in object form. Message is written verbatim, so
+// it should carry its own trailing newline.
+func (commit *Commit) Encode() []byte {
+	var content strings.Builder
+	fmt.Fprintf(&content, "tree %v\n", commit.Tree)
+	for _, parent := range commit.Parents {
+		fmt.Fprintf(&content, "parent %v\n", parent)
+	}
+	fmt.Fprintf(&content, "author %v\n", commit.Author)
+	fmt.Fprintf(&content, "committer %v\n", commit.Committer)
+	if commit.Encoding != "" {
+		fmt.Fprintf(&content, "encoding %v\n", commit.Encoding)
+	}
+	content.WriteString("\n" + commit.Message)
+	return []byte(content.String())
+}
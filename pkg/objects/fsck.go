@@ -0,0 +1,379 @@
+package objects
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Problem is one finding of Check, named by the camel-case message ID git
+// uses so the two report the same things the same way.
+type Problem struct {
+	ID      string
+	Message string
+	Warning bool
+}
+
+// checker collects the problems found in one object.
+type checker struct {
+	problems []Problem
+	strict   bool
+	size     int
+}
+
+// report records an error and returns true so the caller can stop.
+func (c *checker) report(id string, message string) bool {
+	c.problems = append(c.problems, Problem{ID: id, Message: message})
+	return true
+}
+
+// warn records a warning, an error when checking strictly, and reports
+// whether it was an error.
+func (c *checker) warn(id string, message string) bool {
+	c.problems = append(c.problems, Problem{ID: id, Message: message, Warning: !c.strict})
+	return c.strict
+}
+
+// info records a warning that strict checking leaves a warning.
+func (c *checker) info(id string, message string) {
+	c.problems = append(c.problems, Problem{ID: id, Message: message, Warning: true})
+}
+
+// Check validates the syntax of an object's content the way git fsck does:
+// tree entries must have sane names and modes and be sorted without
+// duplicates, and commits and tags must carry their headers in order with
+// well-formed names and identities. Strict checking turns warnings into
+// errors, other than the few git only ever warns about, and also flags the
+// group-writable 100664 mode old gits wrote.
+func Check(algorithm Algorithm, objectType string, data []byte, strict bool) []Problem {
+	c := &checker{strict: strict, size: algorithm.Size()}
+	switch objectType {
+	case TypeTree:
+		c.checkTree(data)
+	case TypeCommit:
+		c.checkCommit(data)
+	case TypeTag:
+		c.checkTag(data)
+	}
+	return c.problems
+}
+
+// The names CheckEntryName rejects, with fsck's messages for them.
+var (
+	ErrFullPathname = errors.New("contains full pathnames")
+	ErrHasDot       = errors.New("contains '.'")
+	ErrHasDotdot    = errors.New("contains '..'")
+	ErrHasDotgit    = errors.New("contains '.git'")
+	ErrEmptyName    = errors.New("contains empty pathname")
+)
+
+// CheckEntryName returns an error when a tree entry called name cannot be
+// written into a worktree: a name holding a slash or NUL, "." or "..", or
+// .git in any case would let a tree write outside the directory it is
+// checked out into, or into the repository itself.
+func CheckEntryName(name string) error {
+	switch {
+	case name == "":
+		return ErrEmptyName
+	case strings.ContainsAny(name, "/\x00"):
+		return ErrFullPathname
+	case name == ".":
+		return ErrHasDot
+	case name == "..":
+		return ErrHasDotdot
+	case strings.EqualFold(name, ".git"):
+		return ErrHasDotgit
+	}
+	return nil
+}
+
+func (c *checker) checkTree(data []byte) {
+	var nullHash, fullPath, dot, dotdot, dotgit, zeroPadded, badModes, duplicates, unsorted, unparsable bool
+	seen := make(map[string]bool)
+	previous := ""
+	for len(data) > 0 {
+		spaceIndex := bytes.IndexByte(data, ' ')
+		nulIndex := bytes.IndexByte(data, 0)
+		// An entry without a name cannot be read at all.
+		if spaceIndex < 0 || nulIndex < spaceIndex+2 || nulIndex+1+c.size > len(data) {
+			unparsable = true
+			break
+		}
+		modeText, name, hash := string(data[:spaceIndex]), string(data[spaceIndex+1:nulIndex]), data[nulIndex+1:nulIndex+1+c.size]
+		data = data[nulIndex+1+c.size:]
+		mode, err := strconv.ParseUint("0"+modeText, 8, 32)
+		if err != nil {
+			unparsable = true
+			break
+		}
+
+		nullHash = nullHash || bytes.Equal(hash, make([]byte, c.size))
+		switch CheckEntryName(name) {
+		case ErrFullPathname:
+			fullPath = true
+		case ErrHasDot:
+			dot = true
+		case ErrHasDotdot:
+			dotdot = true
+		case ErrHasDotgit:
+			dotgit = true
+		}
+		zeroPadded = zeroPadded || strings.HasPrefix(modeText, "0")
+		switch mode {
+		case 0100755, 0100644, 0120000, 040000, 0160000:
+		case 0100664:
+			badModes = badModes || c.strict
+		default:
+			badModes = true
+		}
+
+		entry := TreeEntry{Mode: strconv.FormatUint(mode, 8), Name: name}
+		if seen[name] {
+			duplicates = true
+		} else if previous != "" && entry.sortKey() < previous {
+			unsorted = true
+		}
+		seen[name] = true
+		previous = entry.sortKey()
+	}
+
+	if nullHash {
+		c.warn("nullSha1", "contains entries pointing to null sha1")
+	}
+	if fullPath {
+		c.warn("fullPathname", ErrFullPathname.Error())
+	}
+	if dot {
+		c.warn("hasDot", ErrHasDot.Error())
+	}
+	if dotdot {
+		c.warn("hasDotdot", ErrHasDotdot.Error())
+	}
+	if dotgit {
+		c.warn("hasDotgit", ErrHasDotgit.Error())
+	}
+	if zeroPadded {
+		c.warn("zeroPaddedFilemode", "contains zero-padded file modes")
+	}
+	if badModes {
+		c.info("badFilemode", "contains bad file modes")
+	}
+	if duplicates {
+		c.report("duplicateEntries", "contains duplicate file entries")
+	}
+	if unsorted {
+		c.report("treeNotSorted", "not properly sorted")
+	}
+	if unparsable {
+		c.report("badTree", "cannot be parsed as a tree")
+	}
+}
+
+// checkHeaders makes sure the headers end, in a blank line or at the end of
+// the object, before any NUL byte.
+func (c *checker) checkHeaders(data []byte) bool {
+	for index, char := range data {
+		switch {
+		case char == 0:
+			return c.report("nulInHeader", fmt.Sprintf("unterminated header: NUL at offset %v", index))
+		case char == '\n' && index+1 < len(data) && data[index+1] == '\n':
+			return false
+		}
+	}
+	if len(data) > 0 && data[len(data)-1] == '\n' {
+		return false
+	}
+	return c.report("unterminatedHeader", "unterminated header")
+}
+
+// hashLine consumes a line holding an object name in lowercase hex,
+// reporting whether it was one.
+func (c *checker) hashLine(data []byte) ([]byte, bool) {
+	length := 2 * c.size
+	if len(data) < length+1 || data[length] != '\n' {
+		return data, false
+	}
+	if _, err := hex.DecodeString(string(data[:length])); err != nil || strings.ToLower(string(data[:length])) != string(data[:length]) {
+		return data, false
+	}
+	return data[length+1:], true
+}
+
+func (c *checker) checkCommit(data []byte) {
+	if c.checkHeaders(data) {
+		return
+	}
+	content := data
+	rest, found := bytes.CutPrefix(data, []byte("tree "))
+	if !found {
+		c.report("missingTree", "invalid format - expected 'tree' line")
+		return
+	}
+	if data, found = c.hashLine(rest); !found {
+		c.report("badTreeSha1", "invalid 'tree' line format - bad sha1")
+		return
+	}
+	for {
+		if rest, found = bytes.CutPrefix(data, []byte("parent ")); !found {
+			break
+		}
+		if data, found = c.hashLine(rest); !found {
+			c.report("badParentSha1", "invalid 'parent' line format - bad sha1")
+			return
+		}
+	}
+	authors := 0
+	for {
+		if rest, found = bytes.CutPrefix(data, []byte("author ")); !found {
+			break
+		}
+		authors++
+		if data, found = c.checkIdent(rest); found {
+			return
+		}
+	}
+	if authors == 0 {
+		c.report("missingAuthor", "invalid format - expected 'author' line")
+		return
+	}
+	if authors > 1 {
+		c.report("multipleAuthors", "invalid format - multiple 'author' lines")
+		return
+	}
+	if rest, found = bytes.CutPrefix(data, []byte("committer ")); !found {
+		c.report("missingCommitter", "invalid format - expected 'committer' line")
+		return
+	}
+	if _, found = c.checkIdent(rest); found {
+		return
+	}
+	if bytes.IndexByte(content, 0) >= 0 {
+		c.warn("nulInCommit", "NUL byte in the commit object body")
+	}
+}
+
+// checkIdent validates a "Name <email> <seconds> <+hhmm>" line, returning
+// what follows it and whether an error was found.
+func (c *checker) checkIdent(data []byte) ([]byte, bool) {
+	line, rest, _ := bytes.Cut(data, []byte("\n"))
+	// The time zone check looks for the newline, so keep it when present.
+	if len(line) < len(data) {
+		line = data[:len(line)+1]
+	}
+	at := func(index int) byte {
+		if index < 0 || index >= len(line) {
+			return 0
+		}
+		return line[index]
+	}
+	const prefix = "invalid author/committer line - "
+	if at(0) == '<' {
+		return rest, c.report("missingNameBeforeEmail", prefix+"missing space before email")
+	}
+	position := bytes.IndexAny(line, "<>\n")
+	if position < 0 {
+		position = len(line)
+	}
+	if at(position) == '>' {
+		return rest, c.report("badName", prefix+"bad name")
+	}
+	if at(position) != '<' {
+		return rest, c.report("missingEmail", prefix+"missing email")
+	}
+	if at(position-1) != ' ' {
+		return rest, c.report("missingSpaceBeforeEmail", prefix+"missing space before email")
+	}
+	position++
+	if end := bytes.IndexAny(line[position:], "<>\n"); end >= 0 {
+		position += end
+	} else {
+		position = len(line)
+	}
+	if at(position) != '>' {
+		return rest, c.report("badEmail", prefix+"bad email")
+	}
+	position++
+	if at(position) != ' ' {
+		return rest, c.report("missingSpaceBeforeDate", prefix+"missing space before date")
+	}
+	position++
+	if at(position) == '0' && at(position+1) != ' ' {
+		return rest, c.report("zeroPaddedDate", prefix+"zero-padded date")
+	}
+	end := position
+	for at(end) >= '0' && at(end) <= '9' {
+		end++
+	}
+	if end > position {
+		if _, err := strconv.ParseInt(string(line[position:end]), 10, 64); err != nil {
+			return rest, c.report("badDateOverflow", prefix+"date causes integer overflow")
+		}
+	}
+	if end == position || at(end) != ' ' {
+		return rest, c.report("badDate", prefix+"bad date")
+	}
+	position = end + 1
+	if sign := at(position); sign != '+' && sign != '-' || !isDigits(line, position+1, 4) || at(position+5) != '\n' {
+		return rest, c.report("badTimezone", prefix+"bad time zone")
+	}
+	return rest, false
+}
+
+func isDigits(data []byte, start int, count int) bool {
+	if start+count > len(data) {
+		return false
+	}
+	for _, char := range data[start : start+count] {
+		if char < '0' || char > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *checker) checkTag(data []byte) {
+	if c.checkHeaders(data) {
+		return
+	}
+	rest, found := bytes.CutPrefix(data, []byte("object "))
+	if !found {
+		c.report("missingObject", "invalid format - expected 'object' line")
+		return
+	}
+	if data, found = c.hashLine(rest); !found {
+		c.report("badObjectSha1", "invalid 'object' line format - bad sha1")
+		return
+	}
+	if data, found = bytes.CutPrefix(data, []byte("type ")); !found {
+		c.report("missingTypeEntry", "invalid format - expected 'type' line")
+		return
+	}
+	objectType, data, found := bytes.Cut(data, []byte("\n"))
+	if !found {
+		c.report("missingType", "invalid format - unexpected end after 'type' line")
+		return
+	}
+	switch string(objectType) {
+	case TypeBlob, TypeTree, TypeCommit, TypeTag:
+	default:
+		c.report("badType", "invalid 'type' value")
+		return
+	}
+	if data, found = bytes.CutPrefix(data, []byte("tag ")); !found {
+		c.report("missingTagEntry", "invalid format - expected 'tag' line")
+		return
+	}
+	if _, data, found = bytes.Cut(data, []byte("\n")); !found {
+		c.report("missingTag", "invalid format - unexpected end after 'type' line")
+		return
+	}
+	if rest, found = bytes.CutPrefix(data, []byte("tagger ")); !found {
+		// Early tags carry no tagger, so this is only worth a warning.
+		c.info("missingTaggerEntry", "invalid format - expected 'tagger' line")
+		return
+	}
+	c.checkIdent(rest)
+}
@@ -0,0 +1,48 @@
+package objects
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+)
+
+// Algorithm is the hash function a repository names its objects with, as
+// its extensions.objectFormat setting records.
+type Algorithm interface {
+	// Name is the algorithm's name in config and on the wire.
+	Name() string
+	// New starts a new hash.
+	New() hash.Hash
+	// Size is the length in bytes of an object name, twice that in hex.
+	Size() int
+}
+
+type hashAlgorithm struct {
+	name string
+	new  func() hash.Hash
+	size int
+}
+
+func (algorithm *hashAlgorithm) Name() string   { return algorithm.name }
+func (algorithm *hashAlgorithm) New() hash.Hash { return algorithm.new() }
+func (algorithm *hashAlgorithm) Size() int      { return algorithm.size }
+
+var (
+	// SHA1 is the original object format, and the default.
+	SHA1 Algorithm = &hashAlgorithm{name: "sha1", new: sha1.New, size: sha1.Size}
+	// SHA256 is the object format of repositories made with
+	// --object-format=sha256.
+	SHA256 Algorithm = &hashAlgorithm{name: "sha256", new: sha256.New, size: sha256.Size}
+)
+
+// AlgorithmNamed returns the algorithm called name, as in
+// extensions.objectFormat.
+func AlgorithmNamed(name string) (Algorithm, error) {
+	for _, algorithm := range []Algorithm{SHA1, SHA256} {
+		if algorithm.Name() == name {
+			return algorithm, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown object format '%v'", name)
+}
@@ -0,0 +1,44 @@
+// Package objects defines git's object types and their canonical encodings,
+// independent of where the objects are stored.
+package objects
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+const (
+	TypeBlob   = "blob"
+	TypeTree   = "tree"
+	TypeCommit = "commit"
+	TypeTag    = "tag"
+)
+
+// Header returns the "<type> <size>\x00" prefix that is hashed and stored in
+// front of an object's content.
+func Header(objectType string, size int64) string {
+	return fmt.Sprintf("%s %d\x00", objectType, size)
+}
+
+// Hash returns the object name data would have as an object of objectType,
+// under algorithm.
+func Hash(algorithm Algorithm, objectType string, data []byte) []byte {
+	hash, _ := HashReader(algorithm, objectType, int64(len(data)), bytes.NewReader(data))
+	return hash
+}
+
+// HashReader hashes size bytes read from r as an object of objectType.
+func HashReader(algorithm Algorithm, objectType string, size int64, r io.Reader) ([]byte, error) {
+	hash := algorithm.New()
+	io.WriteString(hash, Header(objectType, size))
+	if _, err := io.CopyN(hash, r, size); err != nil {
+		return nil, fmt.Errorf("Error reading object content: %w", err)
+	}
+	return hash.Sum(nil), nil
+}
+
+// Blob is file content.
+type Blob struct {
+	Data []byte
+}
@@ -0,0 +1,106 @@
+package objects
+
+import (
+	"bytes"
+	"strings"
+)
+
+// signatureStarts are the armor lines that begin the signature a tag's
+// message ends with, one for each signing format.
+var signatureStarts = []string{
+	"-----BEGIN PGP SIGNATURE-----",
+	"-----BEGIN PGP MESSAGE-----",
+	"-----BEGIN SIGNED MESSAGE-----",
+	"-----BEGIN SSH SIGNATURE-----",
+}
+
+// SignatureHeader is the commit header a signature is carried in:
+// gpgsig in SHA-1 repositories and gpgsig-sha256 in SHA-256 ones, so a
+// commit can hold one for each.
+func SignatureHeader(algorithm Algorithm) string {
+	if algorithm == SHA1 {
+		return "gpgsig"
+	}
+	return "gpgsig-" + algorithm.Name()
+}
+
+// AddCommitSignature returns a commit object with signature in a header
+// after its others, each line after the first indented by a space.
+func AddCommitSignature(data []byte, header string, signature []byte) []byte {
+	end := bytes.Index(data, []byte("\n\n"))
+	if end < 0 {
+		end = len(data) - 1
+	}
+	var signed bytes.Buffer
+	signed.Write(data[:end+1])
+	lines := strings.Split(strings.TrimSuffix(string(signature), "\n"), "\n")
+	signed.WriteString(header + " " + lines[0] + "\n")
+	for _, line := range lines[1:] {
+		signed.WriteString(" " + line + "\n")
+	}
+	signed.Write(data[end+1:])
+	return signed.Bytes()
+}
+
+// SplitCommitSignature separates a commit object into the payload its
+// signatures cover, the object with every signature header left out, and
+// the signature found in header, nil when there is none.
+func SplitCommitSignature(data []byte, header string) ([]byte, []byte) {
+	var payload, signature bytes.Buffer
+	found, inSignature := false, false
+	for len(data) > 0 {
+		line := data
+		if index := bytes.IndexByte(data, '\n'); index >= 0 {
+			line = data[:index+1]
+		}
+		data = data[len(line):]
+		if line[0] == '\n' {
+			payload.Write(line)
+			payload.Write(data)
+			break
+		}
+		if inSignature && line[0] == ' ' {
+			if found {
+				signature.Write(line[1:])
+			}
+			continue
+		}
+		inSignature = false
+		if name, value, ok := bytes.Cut(line, []byte(" ")); ok && bytes.HasPrefix(name, []byte("gpgsig")) {
+			inSignature = true
+			if string(name) == header && !found {
+				found = true
+				signature.Write(value)
+			}
+			continue
+		}
+		payload.Write(line)
+	}
+	if !found {
+		return payload.Bytes(), nil
+	}
+	return payload.Bytes(), signature.Bytes()
+}
+
+// SplitTagSignature separates a tag object into the payload that was
+// signed and the signature appended to its message, nil when there is
+// none. The signature starts at the last line that begins one.
+func SplitTagSignature(data []byte) ([]byte, []byte) {
+	start := -1
+	for offset := 0; offset < len(data); {
+		for _, armor := range signatureStarts {
+			if bytes.HasPrefix(data[offset:], []byte(armor)) {
+				start = offset
+			}
+		}
+		index := bytes.IndexByte(data[offset:], '\n')
+		if index < 0 {
+			break
+		}
+		offset += index + 1
+	}
+	if start < 0 {
+		return data, nil
+	}
+	return data[:start], data[start:]
+}
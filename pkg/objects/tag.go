@@ -0,0 +1,54 @@
+package objects
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Tag is a parsed annotated tag object.
+type Tag struct {
+	Object  string
+	Type    string
+	Name    string
+	Tagger  string
+	Message string
+}
+
+// ParseTag decodes an annotated tag object.
+func ParseTag(data []byte) (*Tag, error) {
+	tag := &Tag{}
+	headers, message, _ := strings.Cut(string(data), "\n\n")
+	tag.Message = message
+	for _, line := range strings.Split(headers, "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "object":
+			tag.Object = value
+		case "type":
+			tag.Type = value
+		case "tag":
+			tag.Name = value
+		case "tagger":
+			tag.Tagger = value
+		}
+	}
+	if (len(tag.Object) != 2*SHA1.Size() && len(tag.Object) != 2*SHA256.Size()) || tag.Type == "" {
+		return nil, errors.New("Malformed tag object")
+	}
+	return tag, nil
+}
+
+// Encode returns the tag in object form. Message is written verbatim, so it
+// should carry its own trailing newline.
+func (tag *Tag) Encode() []byte {
+	var content strings.Builder
+	fmt.Fprintf(&content, "object %v\n", tag.Object)
+	fmt.Fprintf(&content, "type %v\n", tag.Type)
+	fmt.Fprintf(&content, "tag %v\n", tag.Name)
+	if tag.Tagger != "" {
+		fmt.Fprintf(&content, "tagger %v\n", tag.Tagger)
+	}
+	content.WriteString("\n" + tag.Message)
+	return []byte(content.String())
+}
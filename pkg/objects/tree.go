@@ -0,0 +1,73 @@
+package objects
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// TreeEntry is one "<mode> <name>\x00<hash>" record of a tree, the hash
+// binary and as long as the repository's algorithm makes it.
+type TreeEntry struct {
+	Mode string
+	Name string
+	Hash []byte
+}
+
+// IsTree reports whether the entry names a subtree.
+func (entry TreeEntry) IsTree() bool {
+	return entry.Mode == "40000"
+}
+
+// Tree is a directory listing in stored order.
+type Tree struct {
+	Entries []TreeEntry
+}
+
+// ParseTree decodes the binary entries of a tree object whose entries are
+// named with algorithm.
+func ParseTree(algorithm Algorithm, data []byte) (*Tree, error) {
+	size := algorithm.Size()
+	tree := &Tree{Entries: make([]TreeEntry, 0)}
+	for len(data) > 0 {
+		spaceIndex := bytes.IndexByte(data, ' ')
+		nulIndex := bytes.IndexByte(data, 0)
+		if spaceIndex < 0 || nulIndex < spaceIndex || nulIndex+1+size > len(data) {
+			return nil, errors.New("Malformed tree object")
+		}
+		tree.Entries = append(tree.Entries, TreeEntry{
+			Mode: string(data[:spaceIndex]),
+			Name: string(data[spaceIndex+1 : nulIndex]),
+			Hash: data[nulIndex+1 : nulIndex+1+size],
+		})
+		data = data[nulIndex+1+size:]
+	}
+	return tree, nil
+}
+
+// Sort puts the entries in git's canonical order: byte-wise by name, with
+// subtrees compared as if their names ended in "/".
+func (tree *Tree) Sort() {
+	sort.SliceStable(tree.Entries, func(i, j int) bool {
+		return tree.Entries[i].sortKey() < tree.Entries[j].sortKey()
+	})
+}
+
+func (entry TreeEntry) sortKey() string {
+	if entry.IsTree() {
+		return entry.Name + "/"
+	}
+	return entry.Name
+}
+
+// Encode returns the tree in object form. Entries are written in the order
+// given; callers are responsible for sorting them, typically with Sort.
+func (tree *Tree) Encode() []byte {
+	var buffer bytes.Buffer
+	for _, entry := range tree.Entries {
+		fmt.Fprintf(&buffer, "%v %v\x00", entry.Mode, entry.Name)
+		buffer.Write(entry.Hash)
+	}
+	return buffer.Bytes()
+}
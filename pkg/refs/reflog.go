@@ -0,0 +1,196 @@
+package refs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/atomicfile"
+)
+
+// LogEntry is one line of a reflog: the ref moving from Old to New, who moved
+// it and when in "Name <email> <unix-seconds> <+hhmm>" form, and why.
+type LogEntry struct {
+	Old      string
+	New      string
+	Identity string
+	Message  string
+}
+
+// logPath returns where the reflog of name is kept, refusing the names
+// path does.
+func (store *Store) logPath(name string) (string, error) {
+	return store.path("logs/" + name)
+}
+
+// HasLog reports whether name has a reflog.
+func (store *Store) HasLog(name string) bool {
+	logPath, err := store.logPath(name)
+	if err == nil {
+		_, err = os.Stat(logPath)
+	}
+	return err == nil
+}
+
+// AppendLog adds an entry to the reflog of name, creating the log if needed.
+// Whitespace in the message is collapsed onto one line.
+func (store *Store) AppendLog(name string, entry LogEntry) error {
+	logPath, err := store.logPath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		return fmt.Errorf("Failed to create directory %v: %w", filepath.Dir(logPath), err)
+	}
+	file, err := os.OpenFile(logPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("Failed to create file %v: %w", logPath, err)
+	}
+	_, err = file.WriteString(entry.line())
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to write file %v: %w", logPath, err)
+	}
+	return nil
+}
+
+// line formats the entry as it is stored, one line ending in a newline.
+func (entry LogEntry) line() string {
+	line := entry.Old + " " + entry.New + " " + entry.Identity
+	if message := strings.Join(strings.Fields(entry.Message), " "); message != "" {
+		line += "\t" + message
+	}
+	return line + "\n"
+}
+
+// WriteLog replaces the reflog of name with entries, as reflog expiry
+// leaves it, keeping the file even when no entries are left.
+func (store *Store) WriteLog(name string, entries []LogEntry) error {
+	logPath, err := store.logPath(name)
+	if err != nil {
+		return err
+	}
+	var content strings.Builder
+	for _, entry := range entries {
+		content.WriteString(entry.line())
+	}
+	if err := atomicfile.WriteFile(logPath, []byte(content.String()), 0644); err != nil {
+		return fmt.Errorf("Failed to write file %v: %w", logPath, err)
+	}
+	return nil
+}
+
+// ReadLog returns the reflog of name, oldest entry first. A ref without a
+// reflog has no entries.
+func (store *Store) ReadLog(name string) ([]LogEntry, error) {
+	logPath, err := store.logPath(name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(logPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []LogEntry{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading file %v: %w", logPath, err)
+	}
+	defer file.Close()
+
+	entries := make([]LogEntry, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, message, _ := strings.Cut(scanner.Text(), "\t")
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 || !isObjectName(fields[0]) || len(fields[1]) != len(fields[0]) {
+			// Corrupt lines are skipped.
+			continue
+		}
+		entries = append(entries, LogEntry{Old: fields[0], New: fields[1], Identity: fields[2], Message: message})
+	}
+	return entries, scanner.Err()
+}
+
+// isObjectName reports whether name is as long as a SHA-1 or SHA-256 object
+// name in hex.
+func isObjectName(name string) bool {
+	return len(name) == 40 || len(name) == 64
+}
+
+// ListLogs returns the names of all refs with a reflog, sorted.
+func (store *Store) ListLogs() ([]string, error) {
+	root := filepath.Join(store.GitDir, "logs")
+	names := make([]string, 0)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			names = append(names, filepath.ToSlash(strings.TrimPrefix(path, root+string(filepath.Separator))))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// RenameLog moves the reflog of oldName to newName, if it has one.
+func (store *Store) RenameLog(oldName string, newName string) error {
+	if !store.HasLog(oldName) {
+		return nil
+	}
+	oldPath, _ := store.logPath(oldName)
+	newPath, err := store.logPath(newName)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(newPath), 0755); err != nil {
+		return fmt.Errorf("Failed to create directory %v: %w", filepath.Dir(newPath), err)
+	}
+	if err := os.Rename(oldPath, newPath); err != nil {
+		return fmt.Errorf("Failed to rename %v: %w", oldPath, err)
+	}
+	store.removeEmptyDirs(filepath.Dir(oldPath), filepath.Join(store.GitDir, "logs"))
+	return nil
+}
+
+// DeleteLog removes the reflog of name, if it has one.
+func (store *Store) DeleteLog(name string) error {
+	logPath, err := store.logPath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(logPath); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("Failed to remove %v: %w", logPath, err)
+	}
+	store.removeEmptyDirs(filepath.Dir(logPath), filepath.Join(store.GitDir, "logs"))
+	return nil
+}
+
+// removeEmptyDirs prunes dir and its parents up to, but not including, stop
+// while they are empty.
+func (store *Store) removeEmptyDirs(dir string, stop string) {
+	for ; dir != stop && dir != store.GitDir && strings.HasPrefix(dir, stop); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+}
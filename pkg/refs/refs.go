@@ -0,0 +1,345 @@
+// Package refs reads and writes the loose and packed refs of a git directory.
+package refs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/atomicfile"
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+)
+
+// Ref is a named ref and the object it ultimately points at.
+type Ref struct {
+	Name string
+	SHA  string
+}
+
+// Store is the ref namespace of one git directory.
+type Store struct {
+	GitDir string
+}
+
+// New returns a Store for the refs under gitDir.
+func New(gitDir string) *Store {
+	return &Store{GitDir: gitDir}
+}
+
+// ErrBadName is returned for a ref name that could lead out of the git
+// directory, such as refs/heads/../../config.
+var ErrBadName = errors.New("bad ref name")
+
+// path returns where the loose ref name is stored. A name with an empty,
+// "." or ".." component is refused rather than joined, so no ref is ever
+// read or written outside the git directory's refs.
+func (store *Store) path(name string) (string, error) {
+	for _, component := range strings.Split(strings.TrimSuffix(name, "/"), "/") {
+		if component == "" || component == "." || component == ".." {
+			return "", fmt.Errorf("%w '%v'", ErrBadName, name)
+		}
+	}
+	return filepath.Join(store.GitDir, name), nil
+}
+
+// Read returns the contents of a ref file with surrounding whitespace
+// trimmed, so refs with or without a trailing newline, or with CRLF line
+// endings, read the same. Refs missing on disk are looked up in packed-refs.
+func (store *Store) Read(name string) (string, error) {
+	refPath, err := store.path(name)
+	if err != nil {
+		return "", err
+	}
+	refBytes, err := os.ReadFile(refPath)
+	if err == nil {
+		return strings.TrimSpace(string(refBytes)), nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	packed, packedErr := store.ReadPacked()
+	if packedErr != nil {
+		return "", packedErr
+	}
+	if sha, ok := packed[name]; ok {
+		return sha, nil
+	}
+	return "", err
+}
+
+// Write stores value in the ref file as "<value>\n". The ref is locked
+// while it is written and replaced whole, so readers see the old value or
+// the new one and two writers cannot both update it.
+func (store *Store) Write(name string, value string) error {
+	refPath, err := store.path(name)
+	if err != nil {
+		return failure.Fatalf("fatal: refusing to update ref with bad name '%v'", name)
+	}
+	if err := os.MkdirAll(filepath.Dir(refPath), 0755); err != nil {
+		return fmt.Errorf("Failed to create directory %v: %w", filepath.Dir(refPath), err)
+	}
+	err = atomicfile.WriteFile(refPath, []byte(value+"\n"), 0644)
+	var locked *atomicfile.LockedError
+	if errors.As(err, &locked) {
+		return failure.Fatalf("fatal: cannot lock ref '%v': %w", name, err)
+	} else if err != nil {
+		return fmt.Errorf("Failed to create file %v: %w", refPath, err)
+	}
+	return nil
+}
+
+// ReadSymbolic returns the target of a symbolic ref, or false when name holds
+// an object name (or does not exist).
+func (store *Store) ReadSymbolic(name string) (string, bool) {
+	value, err := store.Read(name)
+	if err != nil || !strings.HasPrefix(value, "ref: ") {
+		return "", false
+	}
+	return strings.TrimPrefix(value, "ref: "), true
+}
+
+// Resolve follows symbolic refs from name down to an object name. It returns
+// the final ref name alongside the SHA.
+func (store *Store) Resolve(name string) (string, string, error) {
+	for depth := 0; depth < 5; depth++ {
+		value, err := store.Read(name)
+		if err != nil {
+			return name, "", err
+		}
+		if !strings.HasPrefix(value, "ref: ") {
+			return name, value, nil
+		}
+		name = strings.TrimPrefix(value, "ref: ")
+	}
+	return name, "", fmt.Errorf("Symbolic ref loop at %v", name)
+}
+
+// ReadPacked parses packed-refs into a name-to-SHA map, skipping peeled "^"
+// lines. A missing file yields an empty map.
+func (store *Store) ReadPacked() (map[string]string, error) {
+	packed := make(map[string]string)
+	packedRefsPath := filepath.Join(store.GitDir, "packed-refs")
+	file, err := os.Open(packedRefsPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return packed, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading file %v: %w", packedRefsPath, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "^") {
+			continue
+		}
+		sha, name, found := strings.Cut(line, " ")
+		if !found {
+			return nil, fmt.Errorf("Malformed packed-refs line %q", line)
+		}
+		packed[name] = sha
+	}
+	return packed, scanner.Err()
+}
+
+// WritePacked replaces packed-refs with the given refs, sorted by name. No
+// peeled values are written, so the header claims none.
+func (store *Store) WritePacked(packed map[string]string) error {
+	names := make([]string, 0, len(packed))
+	for name := range packed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var content strings.Builder
+	content.WriteString("# pack-refs with: sorted \n")
+	for _, name := range names {
+		fmt.Fprintf(&content, "%v %v\n", packed[name], name)
+	}
+	packedRefsPath := filepath.Join(store.GitDir, "packed-refs")
+	err := atomicfile.WriteFile(packedRefsPath, []byte(content.String()), 0644)
+	var locked *atomicfile.LockedError
+	if errors.As(err, &locked) {
+		return failure.Fatalf("fatal: %w", err)
+	} else if err != nil {
+		return fmt.Errorf("Failed to create file %v: %w", packedRefsPath, err)
+	}
+	return nil
+}
+
+// List returns every loose and packed ref under prefix (e.g. "refs/heads/"),
+// sorted by name, with loose refs taking precedence. Symbolic refs are resolved.
+func (store *Store) List(prefix string) ([]Ref, error) {
+	shas, err := store.ReadPacked()
+	if err != nil {
+		return nil, err
+	}
+	for name := range shas {
+		if !strings.HasPrefix(name, prefix) {
+			delete(shas, name)
+		}
+	}
+
+	root, err := store.path(prefix)
+	if err != nil {
+		return nil, err
+	}
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		name := prefix + filepath.ToSlash(strings.TrimPrefix(path, root+string(filepath.Separator)))
+		_, sha, err := store.Resolve(name)
+		if err != nil {
+			return nil
+		}
+		shas[name] = sha
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	refs := make([]Ref, 0, len(shas))
+	for name, sha := range shas {
+		refs = append(refs, Ref{Name: name, SHA: sha})
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Name < refs[j].Name })
+	return refs, nil
+}
+
+// Delete removes a ref both as a loose file and from packed-refs, along with
+// its reflog.
+func (store *Store) Delete(name string) error {
+	refPath, err := store.path(name)
+	if err != nil {
+		return failure.Fatalf("fatal: refusing to delete ref with bad name '%v'", name)
+	}
+	existed := false
+	if err := os.Remove(refPath); err == nil {
+		existed = true
+		store.removeEmptyRefDirs(refPath)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("Failed to remove %v: %w", refPath, err)
+	}
+
+	removed, err := store.removePacked(name)
+	if err != nil {
+		return err
+	}
+	if !existed && !removed {
+		return fmt.Errorf("error: ref %v not found", name)
+	}
+	return store.DeleteLog(name)
+}
+
+// removeEmptyRefDirs takes away the directories a removed loose ref leaves
+// empty, but not the ones refs are kept in.
+func (store *Store) removeEmptyRefDirs(refPath string) {
+	keptDirs := make(map[string]bool)
+	for _, dir := range []string{"refs", "refs/heads", "refs/tags", "refs/remotes"} {
+		keptDirs[filepath.Join(store.GitDir, dir)] = true
+	}
+	for dir := filepath.Dir(refPath); !keptDirs[dir] && dir != store.GitDir; dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+}
+
+// PackAll moves every loose ref under refs/ into packed-refs and removes
+// the loose files, as git pack-refs --all does. Symbolic refs stay loose,
+// and so does a ref that changes while it is being packed.
+func (store *Store) PackAll() error {
+	packed, err := store.ReadPacked()
+	if err != nil {
+		return err
+	}
+	root := filepath.Join(store.GitDir, "refs")
+	loose := make(map[string]string)
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		name := "refs/" + filepath.ToSlash(strings.TrimPrefix(path, root+string(filepath.Separator)))
+		value, err := store.Read(name)
+		if err != nil || strings.HasPrefix(value, "ref: ") || !isObjectName(value) {
+			return nil
+		}
+		loose[name], packed[name] = value, value
+		return nil
+	})
+	if err != nil || len(loose) == 0 {
+		return err
+	}
+	if err := store.WritePacked(packed); err != nil {
+		return err
+	}
+	for name, value := range loose {
+		refPath, _ := store.path(name)
+		if current, err := store.Read(name); err != nil || current != value {
+			continue
+		}
+		if err := os.Remove(refPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("Failed to remove %v: %w", refPath, err)
+		}
+		store.removeEmptyRefDirs(refPath)
+	}
+	return nil
+}
+
+// removePacked takes name out of packed-refs, if it is there, along with
+// the peeled value that follows it. Every other line is kept as it was, so
+// the header's promise about peeled values still holds.
+func (store *Store) removePacked(name string) (bool, error) {
+	packedRefsPath := filepath.Join(store.GitDir, "packed-refs")
+	content, err := os.ReadFile(packedRefsPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("Error reading file %v: %w", packedRefsPath, err)
+	}
+	lines := strings.SplitAfter(string(content), "\n")
+	kept := make([]string, 0, len(lines))
+	removed := false
+	for index := 0; index < len(lines); index++ {
+		_, lineName, _ := strings.Cut(strings.TrimSpace(lines[index]), " ")
+		if strings.HasPrefix(lines[index], "#") || lineName != name {
+			kept = append(kept, lines[index])
+			continue
+		}
+		removed = true
+		if index+1 < len(lines) && strings.HasPrefix(lines[index+1], "^") {
+			index++
+		}
+	}
+	if !removed {
+		return false, nil
+	}
+	err = atomicfile.WriteFile(packedRefsPath, []byte(strings.Join(kept, "")), 0644)
+	var locked *atomicfile.LockedError
+	if errors.As(err, &locked) {
+		return false, failure.Fatalf("fatal: %w", err)
+	} else if err != nil {
+		return false, fmt.Errorf("Failed to create file %v: %w", packedRefsPath, err)
+	}
+	return true, nil
+}
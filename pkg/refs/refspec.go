@@ -0,0 +1,65 @@
+package refs
+
+import (
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+)
+
+// Refspec maps refs on one side of a fetch or push to refs on the other,
+// as in "+refs/heads/*:refs/remotes/origin/*".
+type Refspec struct {
+	Force bool
+	Src   string
+	Dst   string
+}
+
+// ParseRefspec parses "[+]<src>[:<dst>]". A "*" may appear once on each side,
+// and only on both sides together.
+func ParseRefspec(spec string) (Refspec, error) {
+	refspec := Refspec{}
+	if rest, ok := strings.CutPrefix(spec, "+"); ok {
+		refspec.Force = true
+		spec = rest
+	}
+	refspec.Src, refspec.Dst, _ = strings.Cut(spec, ":")
+	srcGlobs, dstGlobs := strings.Count(refspec.Src, "*"), strings.Count(refspec.Dst, "*")
+	if srcGlobs > 1 || dstGlobs > 1 || (refspec.Dst != "" && srcGlobs != dstGlobs) {
+		return Refspec{}, failure.Fatalf("fatal: invalid refspec '%v'", spec)
+	}
+	return refspec, nil
+}
+
+// String formats the refspec the way it is written in config.
+func (refspec Refspec) String() string {
+	spec := refspec.Src
+	if refspec.Dst != "" {
+		spec += ":" + refspec.Dst
+	}
+	if refspec.Force {
+		spec = "+" + spec
+	}
+	return spec
+}
+
+// IsGlob reports whether the refspec maps a namespace rather than one ref.
+func (refspec Refspec) IsGlob() bool {
+	return strings.Contains(refspec.Src, "*")
+}
+
+// Map returns the destination for the ref name when the source side matches
+// it. A refspec without a destination matches but maps to "".
+func (refspec Refspec) Map(name string) (string, bool) {
+	if !refspec.IsGlob() {
+		if name != refspec.Src {
+			return "", false
+		}
+		return refspec.Dst, true
+	}
+	prefix, suffix, _ := strings.Cut(refspec.Src, "*")
+	if len(name) < len(prefix)+len(suffix) || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+		return "", false
+	}
+	matched := name[len(prefix) : len(name)-len(suffix)]
+	return strings.Replace(refspec.Dst, "*", matched, 1), true
+}
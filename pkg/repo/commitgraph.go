@@ -0,0 +1,219 @@
+package repo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/objects"
+)
+
+var commitGraphSignature = []byte("CGPH")
+
+const (
+	graphNoParent    = 0x70000000
+	graphEdgeList    = 0x80000000
+	graphLastEdge    = 0x80000000
+	graphChunkHeader = 12
+)
+
+// commitGraph is a parsed objects/info/commit-graph file: the commits it
+// lists, sorted by name, and the parents of each.
+type commitGraph struct {
+	size  int
+	count int
+	// fanout, oids, data and edges are the OIDF, OIDL, CDAT and EDGE
+	// chunks.
+	fanout []byte
+	oids   []byte
+	data   []byte
+	edges  []byte
+}
+
+// parseCommitGraph decodes a commit-graph file whose commits are named
+// with algorithm, checking its header, chunk table and trailing checksum
+// so that nothing stale or damaged is believed.
+func parseCommitGraph(algorithm objects.Algorithm, data []byte) (*commitGraph, error) {
+	size := algorithm.Size()
+	if len(data) < 8+graphChunkHeader+size || !bytes.Equal(data[:4], commitGraphSignature) {
+		return nil, errors.New("commit-graph signature does not match")
+	}
+	if version := data[4]; version != 1 {
+		return nil, fmt.Errorf("commit-graph version %v does not match version 1", version)
+	}
+	hashVersion := byte(1)
+	if algorithm == objects.SHA256 {
+		hashVersion = 2
+	}
+	if data[5] != hashVersion {
+		return nil, fmt.Errorf("commit-graph hash version %v does not match version %v", data[5], hashVersion)
+	}
+	if data[7] != 0 {
+		return nil, errors.New("commit-graph has base graphs")
+	}
+	body := data[:len(data)-size]
+	summer := algorithm.New()
+	summer.Write(body)
+	if !bytes.Equal(summer.Sum(nil), data[len(body):]) {
+		return nil, errors.New("commit-graph checksum mismatch")
+	}
+
+	chunks := make(map[string][]byte)
+	chunkCount := int(data[6])
+	if 8+(chunkCount+1)*graphChunkHeader > len(body) {
+		return nil, errors.New("commit-graph chunk lookup table is truncated")
+	}
+	for index := 0; index < chunkCount; index++ {
+		entry := data[8+index*graphChunkHeader:]
+		start := binary.BigEndian.Uint64(entry[4:12])
+		end := binary.BigEndian.Uint64(entry[4+graphChunkHeader : 12+graphChunkHeader])
+		if start > end || end > uint64(len(body)) {
+			return nil, fmt.Errorf("commit-graph chunk %q is out of bounds", entry[:4])
+		}
+		chunks[string(entry[:4])] = body[start:end]
+	}
+
+	graph := &commitGraph{size: size, fanout: chunks["OIDF"], oids: chunks["OIDL"], data: chunks["CDAT"], edges: chunks["EDGE"]}
+	if len(graph.fanout) != 256*4 {
+		return nil, errors.New("commit-graph OID fanout chunk is missing or the wrong size")
+	}
+	previous := uint32(0)
+	for index := 0; index < 256; index++ {
+		count := binary.BigEndian.Uint32(graph.fanout[index*4:])
+		if count < previous {
+			return nil, errors.New("commit-graph OID fanout is not in order")
+		}
+		previous = count
+	}
+	graph.count = int(previous)
+	if len(graph.oids) != graph.count*size || len(graph.data) != graph.count*(size+16) {
+		return nil, errors.New("commit-graph OID lookup or commit data chunk is the wrong size")
+	}
+	return graph, nil
+}
+
+// parents returns the parents the graph records for the commit named hash,
+// and false when it does not list the commit or its entry points outside
+// the graph.
+func (graph *commitGraph) parents(hash []byte) ([]string, bool) {
+	low := 0
+	if hash[0] > 0 {
+		low = int(binary.BigEndian.Uint32(graph.fanout[(int(hash[0])-1)*4:]))
+	}
+	high := int(binary.BigEndian.Uint32(graph.fanout[int(hash[0])*4:]))
+	for low < high {
+		middle := (low + high) / 2
+		switch bytes.Compare(graph.oids[middle*graph.size:(middle+1)*graph.size], hash) {
+		case 0:
+			return graph.entryParents(middle)
+		case -1:
+			low = middle + 1
+		default:
+			high = middle
+		}
+	}
+	return nil, false
+}
+
+func (graph *commitGraph) entryParents(position int) ([]string, bool) {
+	entry := graph.data[position*(graph.size+16)+graph.size:]
+	name := func(index uint32) (string, bool) {
+		if int(index) >= graph.count {
+			return "", false
+		}
+		return hex.EncodeToString(graph.oids[int(index)*graph.size : (int(index)+1)*graph.size]), true
+	}
+	parents := make([]string, 0, 2)
+	for _, index := range []uint32{binary.BigEndian.Uint32(entry[0:4]), binary.BigEndian.Uint32(entry[4:8])} {
+		switch {
+		case index == graphNoParent:
+		case index&graphEdgeList != 0 && len(parents) == 1:
+			// An octopus merge lists its second and later parents in EDGE.
+			for edge := int(index &^ graphEdgeList); ; edge++ {
+				if (edge+1)*4 > len(graph.edges) {
+					return nil, false
+				}
+				value := binary.BigEndian.Uint32(graph.edges[edge*4:])
+				parent, ok := name(value &^ graphLastEdge)
+				if !ok {
+					return nil, false
+				}
+				parents = append(parents, parent)
+				if value&graphLastEdge != 0 {
+					break
+				}
+			}
+		default:
+			parent, ok := name(index)
+			if !ok {
+				return nil, false
+			}
+			parents = append(parents, parent)
+		}
+	}
+	return parents, true
+}
+
+// loadCommitGraph reads objects/info/commit-graph once. There is none to
+// use when core.commitGraph is off, or when grafts, a shallow boundary or
+// replacements may give commits other parents than the graph records. A
+// graph that fails its checks is ignored with a warning, so traversals
+// read the commits themselves.
+func (repository *Repository) loadCommitGraph() *commitGraph {
+	repository.commitGraphOnce.Do(func() {
+		if cfg, err := repository.Config(); err == nil {
+			value, _ := cfg.Get("core.commitGraph")
+			switch strings.ToLower(value) {
+			case "false", "no", "off", "0":
+				return
+			}
+		}
+		grafts, err := repository.Grafts()
+		if err != nil || len(grafts) > 0 {
+			return
+		}
+		shallow, err := repository.Shallow()
+		if err != nil || len(shallow) > 0 {
+			return
+		}
+		if repository.ReplaceObjects && len(repository.Replacements()) > 0 {
+			return
+		}
+		path := repository.Path("objects", "info", "commit-graph")
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return
+		}
+		graph, err := parseCommitGraph(repository.Algorithm, data)
+		if err != nil {
+			if repository.Warnings != nil {
+				fmt.Fprintf(repository.Warnings, "warning: ignoring %v: %v\n", path, err)
+			}
+			return
+		}
+		repository.commitGraph = graph
+	})
+	return repository.commitGraph
+}
+
+// CommitParents returns the parents of the commit named sha, from the
+// commit-graph when it lists the commit, and otherwise from the commit
+// itself.
+func (repository *Repository) CommitParents(sha string) ([]string, error) {
+	if graph := repository.loadCommitGraph(); graph != nil {
+		if hash, err := hex.DecodeString(sha); err == nil && len(hash) == graph.size {
+			if parents, ok := graph.parents(hash); ok {
+				return parents, nil
+			}
+		}
+	}
+	commit, err := repository.ReadCommit(sha)
+	if err != nil {
+		return nil, err
+	}
+	return commit.Parents, nil
+}
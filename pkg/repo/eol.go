@@ -0,0 +1,61 @@
+package repo
+
+import (
+	"bytes"
+	"strings"
+)
+
+// autoCRLF returns core.autocrlf, read once: "true" to store text with LF
+// line endings and check it out with CRLF ones, "input" to only store it
+// with LF, and "" for no conversion.
+func (repository *Repository) autoCRLF() string {
+	repository.autoCRLFOnce.Do(func() {
+		cfg, err := repository.Config()
+		if err != nil {
+			return
+		}
+		value, _ := cfg.Get("core.autocrlf")
+		switch strings.ToLower(value) {
+		case "true", "yes", "on", "1":
+			repository.autoCRLFValue = "true"
+		case "input":
+			repository.autoCRLFValue = "input"
+		}
+	})
+	return repository.autoCRLFValue
+}
+
+// convertsLineEndings reports whether content is text whose line endings
+// autocrlf may change: no NUL and no carriage return outside a CRLF, as
+// git tells text from binary.
+func convertsLineEndings(content []byte) bool {
+	if bytes.IndexByte(content, 0) >= 0 {
+		return false
+	}
+	return bytes.Count(content, []byte("\r")) == bytes.Count(content, []byte("\r\n"))
+}
+
+// CleanContent turns worktree content into what is stored in a blob: under
+// core.autocrlf, text has its CRLF line endings made LF.
+func (repository *Repository) CleanContent(content []byte) []byte {
+	if repository.autoCRLF() == "" || !bytes.Contains(content, []byte("\r\n")) || !convertsLineEndings(content) {
+		return content
+	}
+	return bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+}
+
+// SmudgeContent turns blob content into what is checked out: with
+// core.autocrlf true, text has its LF line endings made CRLF.
+func (repository *Repository) SmudgeContent(content []byte) []byte {
+	if repository.autoCRLF() != "true" || !bytes.Contains(content, []byte("\n")) || !convertsLineEndings(content) || bytes.Contains(content, []byte("\r\n")) {
+		return content
+	}
+	return bytes.ReplaceAll(content, []byte("\n"), []byte("\r\n"))
+}
+
+// ConvertsLineEndings reports whether files are converted on their way
+// into and out of the object store, so they cannot be streamed as they
+// are.
+func (repository *Repository) ConvertsLineEndings() bool {
+	return repository.autoCRLF() != ""
+}
@@ -0,0 +1,489 @@
+package repo
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/atomicfile"
+	"github.com/codecrafters-io/git-starter-go/internal/pack"
+	"github.com/codecrafters-io/git-starter-go/pkg/objects"
+)
+
+// OpenObject returns the type and size of an object along with a reader over
+// its content, substituting the replacement recorded in refs/replace if any.
+// Loose objects are decompressed as the reader is consumed; packed objects
+// are resolved in memory.
+func (repository *Repository) OpenObject(sha string) (string, int64, io.ReadCloser, error) {
+	if repository.ReplaceObjects {
+		if replacement, ok := repository.Replacements()[sha]; ok {
+			sha = replacement
+		}
+	}
+	if len(sha) < 4 {
+		return "", 0, nil, fmt.Errorf("Not a valid object name %v", sha)
+	}
+	looseObjectPath := repository.Path("objects", sha[:2], sha[2:])
+	if file, err := os.Open(looseObjectPath); err == nil {
+		objectType, size, reader, err := openLooseObject(file)
+		if err != nil {
+			file.Close()
+			return "", 0, nil, fmt.Errorf("Error reading object %v: %w", sha, err)
+		}
+		return objectType, size, reader, nil
+	}
+	object, err := repository.readPackedObject(sha)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	if object == nil {
+		return "", 0, nil, fmt.Errorf("Not a valid object name %v", sha)
+	}
+	return object.Type, int64(len(object.Content)), io.NopCloser(bytes.NewReader(object.Content)), nil
+}
+
+// Replacements returns the objects refs/replace substitutes others with,
+// keyed by the name of the object each replaces. The refs, loose or packed,
+// are read once, so object reads need not look for them every time; an
+// unreadable refs/replace replaces nothing.
+func (repository *Repository) Replacements() map[string]string {
+	repository.replacementsOnce.Do(func() {
+		repository.replacements = make(map[string]string)
+		replaceRefs, err := repository.Refs.List("refs/replace/")
+		if err != nil {
+			return
+		}
+		for _, ref := range replaceRefs {
+			repository.replacements[strings.TrimPrefix(ref.Name, "refs/replace/")] = ref.SHA
+		}
+	})
+	return repository.replacements
+}
+
+// ReadObject returns the type and full content of an object.
+func (repository *Repository) ReadObject(sha string) (string, []byte, error) {
+	objectType, size, reader, err := repository.OpenObject(sha)
+	if err != nil {
+		return "", nil, err
+	}
+	defer reader.Close()
+	content := bytes.NewBuffer(make([]byte, 0, size))
+	if _, err := io.Copy(content, reader); err != nil {
+		return "", nil, fmt.Errorf("Error decompressing object %v: %w", sha, err)
+	}
+	return objectType, content.Bytes(), nil
+}
+
+// ReadLooseObject reads the loose object file for sha as it is stored,
+// without looking in packs or at replacements, so its content can be checked
+// against the name.
+func (repository *Repository) ReadLooseObject(sha string) (string, []byte, error) {
+	file, err := os.Open(repository.Path("objects", sha[:2], sha[2:]))
+	if err != nil {
+		return "", nil, err
+	}
+	objectType, size, reader, err := openLooseObject(file)
+	if err != nil {
+		file.Close()
+		return "", nil, err
+	}
+	defer reader.Close()
+	content := bytes.NewBuffer(make([]byte, 0, size))
+	if _, err := io.Copy(content, reader); err != nil {
+		return "", nil, fmt.Errorf("Error decompressing object %v: %w", sha, err)
+	}
+	if int64(content.Len()) != size {
+		return "", nil, fmt.Errorf("Object %v is truncated", sha)
+	}
+	return objectType, content.Bytes(), nil
+}
+
+// HasObject reports whether sha names a loose or packed object.
+func (repository *Repository) HasObject(sha string) bool {
+	_, _, reader, err := repository.OpenObject(sha)
+	if err != nil {
+		return false
+	}
+	reader.Close()
+	return true
+}
+
+func (repository *Repository) readTyped(sha string, wantType string) ([]byte, error) {
+	objectType, content, err := repository.ReadObject(sha)
+	if err != nil {
+		return nil, err
+	}
+	if objectType != wantType {
+		return nil, fmt.Errorf("%v is not a %v", sha, wantType)
+	}
+	return content, nil
+}
+
+// ReadBlob reads the blob named sha.
+func (repository *Repository) ReadBlob(sha string) (*objects.Blob, error) {
+	content, err := repository.readTyped(sha, objects.TypeBlob)
+	if err != nil {
+		return nil, err
+	}
+	return &objects.Blob{Data: content}, nil
+}
+
+// ReadTree reads and parses the tree named sha.
+func (repository *Repository) ReadTree(sha string) (*objects.Tree, error) {
+	content, err := repository.readTyped(sha, objects.TypeTree)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := objects.ParseTree(repository.Algorithm, content)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", sha, err)
+	}
+	return tree, nil
+}
+
+// ReadCommit reads and parses the commit named sha. A commit at the
+// boundary of a shallow clone is given no parents, since they are not here,
+// and a grafted one the parents its graft lists.
+func (repository *Repository) ReadCommit(sha string) (*objects.Commit, error) {
+	content, err := repository.readTyped(sha, objects.TypeCommit)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := objects.ParseCommit(content)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", sha, err)
+	}
+	shallow, err := repository.Shallow()
+	if err != nil {
+		return nil, err
+	}
+	grafts, err := repository.Grafts()
+	if err != nil {
+		return nil, err
+	}
+	if parents, ok := grafts[sha]; ok {
+		commit.Parents = parents
+	}
+	if shallow[sha] {
+		commit.Parents = nil
+	}
+	return commit, nil
+}
+
+// ReadTag reads and parses the annotated tag named sha.
+func (repository *Repository) ReadTag(sha string) (*objects.Tag, error) {
+	content, err := repository.readTyped(sha, objects.TypeTag)
+	if err != nil {
+		return nil, err
+	}
+	tag, err := objects.ParseTag(content)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", sha, err)
+	}
+	return tag, nil
+}
+
+// objectExists reports whether the object named hash is stored, loose or
+// packed, without reading it. Objects found are remembered: nothing is
+// deleted while a command is writing objects.
+func (repository *Repository) objectExists(hash []byte) bool {
+	sha := hex.EncodeToString(hash)
+	if _, ok := repository.known.Load(sha); ok {
+		return true
+	}
+	found := false
+	if _, err := os.Stat(repository.Path("objects", sha[:2], sha[2:])); err == nil {
+		found = true
+	} else if packs, err := repository.openPacks(false); err == nil {
+		found = slices.ContainsFunc(packs, func(p packFile) bool { return p.pack.Contains(sha) })
+	}
+	if found {
+		repository.known.Store(sha, true)
+	}
+	return found
+}
+
+// WriteObject stores content as a loose object and returns its hash. An
+// object already stored is not written again.
+func (repository *Repository) WriteObject(objectType string, content []byte) ([]byte, error) {
+	if hash := objects.Hash(repository.Algorithm, objectType, content); repository.objectExists(hash) {
+		return hash, nil
+	}
+	return repository.WriteObjectFromReader(objectType, int64(len(content)), bytes.NewReader(content))
+}
+
+// WriteObjectFromReader stores size bytes read from r as a loose object,
+// hashing and compressing in a single pass. The object goes to a temporary
+// file first, flushed to disk, and is renamed into place once its name is
+// known, so a crash never leaves half an object under its name.
+func (repository *Repository) WriteObjectFromReader(objectType string, size int64, r io.Reader) ([]byte, error) {
+	objectsDir := repository.Path("objects")
+	if err := os.MkdirAll(objectsDir, 0755); err != nil {
+		return nil, fmt.Errorf("Failed to create directory %v: %w", objectsDir, err)
+	}
+	tempFile, err := atomicfile.CreateTemp(objectsDir, "tmp_obj_")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create temporary object in %v: %w", objectsDir, err)
+	}
+	defer tempFile.Abort()
+
+	hash := repository.Algorithm.New()
+	zlibWriter := zlib.NewWriter(tempFile)
+	writer := io.MultiWriter(hash, zlibWriter)
+	_, writeErr := io.WriteString(writer, objects.Header(objectType, size))
+	if writeErr == nil {
+		_, writeErr = io.CopyN(writer, r, size)
+	}
+	closeErr := zlibWriter.Close()
+	if writeErr != nil {
+		return nil, fmt.Errorf("Error reading object content: %w", writeErr)
+	}
+	if closeErr != nil {
+		return nil, fmt.Errorf("Failed to write object: %w", closeErr)
+	}
+
+	sum := hash.Sum(nil)
+	if err := repository.moveObject(sum, tempFile); err != nil {
+		return nil, err
+	}
+	repository.known.Store(hex.EncodeToString(sum), true)
+	return sum, nil
+}
+
+// WriteBlobFile streams a file into a blob without reading it whole. The
+// file is hashed first, and only compressed and written when that blob is
+// not already stored. Under core.autocrlf the file is read whole instead,
+// to store it with its line endings converted.
+func (repository *Repository) WriteBlobFile(path string) ([]byte, error) {
+	if repository.ConvertsLineEndings() {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading file %v: %w", path, err)
+		}
+		return repository.WriteObject(objects.TypeBlob, repository.CleanContent(content))
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading file %v: %w", path, err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("Error reading file %v: %w", path, err)
+	}
+	hash, err := objects.HashReader(repository.Algorithm, objects.TypeBlob, info.Size(), file)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading file %v: %w", path, err)
+	}
+	if repository.objectExists(hash) {
+		return hash, nil
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("Error reading file %v: %w", path, err)
+	}
+	return repository.WriteObjectFromReader(objects.TypeBlob, info.Size(), file)
+}
+
+// moveObject commits a compressed object in tempFile to its loose object
+// path, read-only as git leaves objects, and leaves an existing copy
+// untouched.
+func (repository *Repository) moveObject(hash []byte, tempFile *atomicfile.File) error {
+	hashString := hex.EncodeToString(hash)
+	objectFileDir := repository.Path("objects", hashString[:2])
+	objectFilePath := filepath.Join(objectFileDir, hashString[2:])
+
+	if _, err := os.Stat(objectFilePath); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(objectFileDir, 0755); err != nil {
+		return fmt.Errorf("Failed to create directory %v: %w", objectFileDir, err)
+	}
+	if err := tempFile.Commit(objectFilePath, 0444); err != nil {
+		return fmt.Errorf("Failed to create file %v: %w", objectFilePath, err)
+	}
+	return nil
+}
+
+// looseObjectReader reads decompressed object content and closes the
+// underlying object file.
+type looseObjectReader struct {
+	io.Reader
+	file *os.File
+}
+
+func (reader *looseObjectReader) Close() error {
+	return reader.file.Close()
+}
+
+func openLooseObject(file *os.File) (string, int64, io.ReadCloser, error) {
+	zlibReader, err := zlib.NewReader(file)
+	if err != nil {
+		return "", 0, nil, fmt.Errorf("Error creating new zlib reader: %w", err)
+	}
+	bufferedReader := bufio.NewReader(zlibReader)
+	header, err := bufferedReader.ReadString(0)
+	if err != nil {
+		return "", 0, nil, errors.New("Malformed object header")
+	}
+	objectType, sizeField, found := strings.Cut(strings.TrimSuffix(header, "\x00"), " ")
+	size, err := strconv.ParseInt(sizeField, 10, 64)
+	if !found || err != nil {
+		return "", 0, nil, errors.New("Malformed object header")
+	}
+	return objectType, size, &looseObjectReader{Reader: io.LimitReader(bufferedReader, size), file: file}, nil
+}
+
+// readPackedObject looks sha up in every pack under objects/pack and returns
+// nil when none of them contain it. A miss rescans the directory in case a
+// pack has arrived since the packs were opened.
+func (repository *Repository) readPackedObject(sha string) (*pack.Object, error) {
+	for _, rescan := range []bool{false, true} {
+		packs, err := repository.openPacks(rescan)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range packs {
+			if p.pack.Contains(sha) {
+				return p.pack.Object(sha)
+			}
+		}
+	}
+	return nil, nil
+}
+
+// packFile is a pack under objects/pack, kept open between reads.
+type packFile struct {
+	path string
+	pack *pack.Pack
+}
+
+// openPacks returns the repository's packs, opening them on first use. With
+// rescan set, packs added or removed since then are picked up.
+func (repository *Repository) openPacks(rescan bool) ([]packFile, error) {
+	repository.packsLock.Lock()
+	defer repository.packsLock.Unlock()
+	if repository.packs != nil && !rescan {
+		return repository.packs, nil
+	}
+	packPaths, _ := filepath.Glob(repository.Path("objects/pack/*.pack"))
+	packs := make([]packFile, 0, len(packPaths))
+	for _, packPath := range packPaths {
+		index := slices.IndexFunc(repository.packs, func(p packFile) bool { return p.path == packPath })
+		if index >= 0 {
+			packs = append(packs, repository.packs[index])
+			continue
+		}
+		p, err := pack.Open(repository.Algorithm, packPath)
+		if err != nil {
+			return nil, err
+		}
+		packs = append(packs, packFile{path: packPath, pack: p})
+	}
+	for _, old := range repository.packs {
+		if !slices.Contains(packPaths, old.path) {
+			old.pack.Close()
+		}
+	}
+	repository.packs = packs
+	return packs, nil
+}
+
+// PackedObjects returns the names of all objects in the repository's packs.
+func (repository *Repository) PackedObjects() ([]string, error) {
+	packs, err := repository.openPacks(true)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]bool)
+	for _, p := range packs {
+		for _, sha := range p.pack.Index().SHAs() {
+			found[sha] = true
+		}
+	}
+	return sortedNames(found), nil
+}
+
+// LooseObjects returns the names of all loose objects.
+func (repository *Repository) LooseObjects() ([]string, error) {
+	found := make(map[string]bool)
+	dirs, err := os.ReadDir(repository.Path("objects"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	for _, dir := range dirs {
+		if len(dir.Name()) != 2 || !dir.IsDir() || !isHex(dir.Name()) {
+			continue
+		}
+		entries, err := os.ReadDir(repository.Path("objects", dir.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if sha := dir.Name() + entry.Name(); len(sha) == 2*repository.Algorithm.Size() && isHex(sha) {
+				found[sha] = true
+			}
+		}
+	}
+	return sortedNames(found), nil
+}
+
+// ClosePacks closes every open pack, as before the files are removed.
+func (repository *Repository) ClosePacks() {
+	repository.packsLock.Lock()
+	defer repository.packsLock.Unlock()
+	for _, p := range repository.packs {
+		p.pack.Close()
+	}
+	repository.packs = nil
+}
+
+func isHex(name string) bool {
+	return strings.Trim(name, "0123456789abcdef") == ""
+}
+
+func sortedNames(found map[string]bool) []string {
+	names := make([]string, 0, len(found))
+	for sha := range found {
+		names = append(names, sha)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FindObjects returns the sorted names of all loose and packed objects
+// starting with the lowercase hex prefix, which must be at least two digits.
+func (repository *Repository) FindObjects(prefix string) ([]string, error) {
+	found := make(map[string]bool)
+	entries, err := os.ReadDir(repository.Path("objects", prefix[:2]))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if sha := prefix[:2] + entry.Name(); len(sha) == 2*repository.Algorithm.Size() && strings.HasPrefix(sha, prefix) {
+			found[sha] = true
+		}
+	}
+
+	packs, err := repository.openPacks(true)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range packs {
+		for _, sha := range p.pack.Index().SHAs() {
+			if strings.HasPrefix(sha, prefix) {
+				found[sha] = true
+			}
+		}
+	}
+	return sortedNames(found), nil
+}
@@ -0,0 +1,187 @@
+// Package repo opens git repositories and reads and writes their objects.
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/codecrafters-io/git-starter-go/internal/atomicfile"
+	"github.com/codecrafters-io/git-starter-go/internal/failure"
+	"github.com/codecrafters-io/git-starter-go/pkg/config"
+	"github.com/codecrafters-io/git-starter-go/pkg/ignore"
+	"github.com/codecrafters-io/git-starter-go/pkg/objects"
+	"github.com/codecrafters-io/git-starter-go/pkg/refs"
+)
+
+// Repository is a git directory and, unless bare, the worktree it belongs to.
+type Repository struct {
+	GitDir   string
+	WorkTree string
+	Refs     *refs.Store
+	// Algorithm names the repository's objects: SHA-1 unless its config
+	// sets extensions.objectFormat.
+	Algorithm objects.Algorithm
+
+	// ReplaceObjects makes object reads honor refs/replace, which is the
+	// default.
+	ReplaceObjects bool
+	// Warnings, when set, is told about repository data that is ignored,
+	// such as a damaged commit-graph.
+	Warnings io.Writer
+
+	packs     []packFile
+	packsLock sync.Mutex
+	shallow   map[string]bool
+	grafts    map[string][]string
+	// commitGraph holds objects/info/commit-graph, if it is there and may
+	// be used, read once on the first parents lookup.
+	commitGraph     *commitGraph
+	commitGraphOnce sync.Once
+	// autoCRLFValue is core.autocrlf, read once on the first conversion.
+	autoCRLFValue string
+	autoCRLFOnce  sync.Once
+	// replacements maps objects to what refs/replace substitutes for them,
+	// read once on the first object read.
+	replacements     map[string]string
+	replacementsOnce sync.Once
+	// known holds the names of objects found to be stored, so writers can
+	// skip them without looking again.
+	known sync.Map
+}
+
+// Open returns the repository with the given git directory and worktree. An
+// empty workTree denotes a bare repository.
+func Open(gitDir string, workTree string) *Repository {
+	return &Repository{GitDir: gitDir, WorkTree: workTree, Refs: refs.New(gitDir), Algorithm: objectFormat(gitDir), ReplaceObjects: true}
+}
+
+// objectFormat returns the algorithm the config in gitDir names with
+// extensions.objectFormat, which only counts from repository format
+// version 1 on. Anything else is SHA-1.
+func objectFormat(gitDir string) objects.Algorithm {
+	settings, err := config.Load(filepath.Join(gitDir, "config"))
+	if err != nil {
+		return objects.SHA1
+	}
+	if version, _ := settings.Get("core.repositoryformatversion"); version != "1" {
+		return objects.SHA1
+	}
+	name, _ := settings.Get("extensions.objectformat")
+	algorithm, err := objects.AlgorithmNamed(strings.ToLower(name))
+	if err != nil {
+		return objects.SHA1
+	}
+	return algorithm
+}
+
+// Init creates an empty repository whose git directory is gitDir, with HEAD
+// on an unborn main branch, naming its objects with algorithm. A bare
+// repository, with no workTree, records core.bare in a new config, and one
+// that is not SHA-1 records its object format with repository format
+// version 1, as git needs to read it. An existing repository keeps its
+// config, and with it its object format.
+func Init(gitDir string, workTree string, algorithm objects.Algorithm) (*Repository, error) {
+	for _, dir := range []string{gitDir, filepath.Join(gitDir, "objects"), filepath.Join(gitDir, "refs")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("Error creating directory: %w", err)
+		}
+	}
+	repository := Open(gitDir, workTree)
+	if err := repository.Refs.Write("HEAD", "ref: refs/heads/main"); err != nil {
+		return nil, err
+	}
+	configPath := repository.Path("config")
+	if _, err := os.Stat(configPath); errors.Is(err, os.ErrNotExist) && (workTree == "" || algorithm != objects.SHA1) {
+		version := 0
+		if algorithm != objects.SHA1 {
+			version = 1
+		}
+		config := fmt.Sprintf("[core]\n\trepositoryformatversion = %v\n\tfilemode = true\n\tbare = %v\n", version, workTree == "")
+		if algorithm != objects.SHA1 {
+			config += fmt.Sprintf("[extensions]\n\tobjectformat = %v\n", algorithm.Name())
+		}
+		if err := atomicfile.WriteFile(configPath, []byte(config), 0644); err != nil {
+			return nil, fmt.Errorf("Failed to create file %v: %w", configPath, err)
+		}
+	}
+	repository.Algorithm = objectFormat(gitDir)
+	return repository, nil
+}
+
+// Discover walks up from dir looking for a .git entry or a directory that is
+// itself a git dir. The worktree is empty when dir is inside a bare
+// repository or inside a .git directory.
+func Discover(dir string) (*Repository, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		dotGit := filepath.Join(dir, ".git")
+		if info, err := os.Stat(dotGit); err == nil {
+			if info.IsDir() {
+				return Open(dotGit, dir), nil
+			}
+			// A .git file ("gitdir: <path>") links a worktree to its repository.
+			content, err := os.ReadFile(dotGit)
+			if err != nil {
+				return nil, err
+			}
+			linked, found := strings.CutPrefix(strings.TrimSpace(string(content)), "gitdir: ")
+			if !found {
+				return nil, failure.Fatalf("fatal: invalid gitfile format: %v", dotGit)
+			}
+			if !filepath.IsAbs(linked) {
+				linked = filepath.Join(dir, linked)
+			}
+			return Open(linked, dir), nil
+		}
+		if IsGitDir(dir) {
+			return Open(dir, ""), nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, failure.Fatal("fatal: not a git repository (or any of the parent directories): .git")
+		}
+		dir = parent
+	}
+}
+
+// IsGitDir reports whether dir has the HEAD, objects and refs of a git directory.
+func IsGitDir(dir string) bool {
+	for _, name := range []string{"HEAD", "objects", "refs"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Path joins elements onto the git directory.
+func (repository *Repository) Path(elements ...string) string {
+	return filepath.Join(append([]string{repository.GitDir}, elements...)...)
+}
+
+// Config loads the system, global and repository config files, the
+// repository's own settings taking precedence.
+func (repository *Repository) Config() (*config.Config, error) {
+	paths := make([]string, 0, 4)
+	if system := config.SystemPath(); system != "" {
+		paths = append(paths, system)
+	}
+	paths = append(paths, config.GlobalPaths()...)
+	paths = append(paths, repository.Path("config"))
+	return config.Load(paths...)
+}
+
+// Ignores returns the ignore rules of the worktree, read from its .gitignore
+// files and info/exclude. Paths passed to the Matcher are relative to the
+// top of the worktree.
+func (repository *Repository) Ignores() (*ignore.Matcher, error) {
+	return ignore.New(repository.WorkTree, repository.Path("info", "exclude"))
+}
@@ -0,0 +1,80 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/atomicfile"
+)
+
+// Shallow returns the commits listed in the shallow file, those whose
+// parents were left out of a shallow clone. The set is empty for a complete
+// repository.
+func (repository *Repository) Shallow() (map[string]bool, error) {
+	if repository.shallow != nil {
+		return repository.shallow, nil
+	}
+	shallow := make(map[string]bool)
+	content, err := os.ReadFile(repository.Path("shallow"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("Error reading file %v: %w", repository.Path("shallow"), err)
+	}
+	for _, line := range strings.Fields(string(content)) {
+		shallow[line] = true
+	}
+	repository.shallow = shallow
+	return shallow, nil
+}
+
+// Grafts returns the parents info/grafts, or the file GIT_GRAFT_FILE
+// names, gives commits in place of their own. Each line lists a commit and
+// its new parents, none making it a root; blank lines and comments are
+// skipped.
+func (repository *Repository) Grafts() (map[string][]string, error) {
+	if repository.grafts != nil {
+		return repository.grafts, nil
+	}
+	path := os.Getenv("GIT_GRAFT_FILE")
+	if path == "" {
+		path = repository.Path("info", "grafts")
+	}
+	grafts := make(map[string][]string)
+	content, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("Error reading file %v: %w", path, err)
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		grafts[fields[0]] = fields[1:]
+	}
+	repository.grafts = grafts
+	return grafts, nil
+}
+
+// WriteShallow replaces the shallow file with the given commits, removing
+// it when there are none left.
+func (repository *Repository) WriteShallow(shallow map[string]bool) error {
+	path := repository.Path("shallow")
+	repository.shallow = nil
+	if len(shallow) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("Failed to remove %v: %w", path, err)
+		}
+		return nil
+	}
+	shas := make([]string, 0, len(shallow))
+	for sha := range shallow {
+		shas = append(shas, sha)
+	}
+	sort.Strings(shas)
+	if err := atomicfile.WriteFile(path, []byte(strings.Join(shas, "\n")+"\n"), 0644); err != nil {
+		return fmt.Errorf("Failed to create file %v: %w", path, err)
+	}
+	return nil
+}
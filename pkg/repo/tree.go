@@ -0,0 +1,200 @@
+package repo
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/ignore"
+	"github.com/codecrafters-io/git-starter-go/pkg/objects"
+)
+
+// KnownBlob returns the hash a file was last stored under when its stat
+// data shows it has not changed since, or nil when it must be read again.
+type KnownBlob func(relative string, info fs.FileInfo) []byte
+
+// WriteTree stores every file under dir as blobs and trees and returns the
+// hash of the tree for dir itself. The .git directory and paths excluded by
+// .gitignore files or info/exclude are skipped, and so are directories left
+// with nothing to store, since trees cannot record empty directories. Modes
+// follow the filesystem: executables are 100755, symlinks 120000 blobs of
+// their target, and nested repositories 160000 gitlinks to their HEAD.
+//
+// Files are hashed and stored by a pool of workers once the whole of dir has
+// been listed. A file known, which may be nil, vouches for is not read at
+// all as long as its blob is still there.
+func (repository *Repository) WriteTree(dir string, known KnownBlob) ([]byte, error) {
+	ignores, err := ignore.New(dir, repository.Path("info", "exclude"))
+	if err != nil {
+		return nil, err
+	}
+	root := &treeNode{subtrees: make(map[int]*treeNode)}
+	blobs := make([]pendingBlob, 0)
+	if err := repository.scanTree(dir, "", ignores, root, &blobs); err != nil {
+		return nil, err
+	}
+	if err := repository.writeBlobs(blobs, known); err != nil {
+		return nil, err
+	}
+	return repository.writeTreeNode(root)
+}
+
+// treeNode is a directory being written: its entries in directory order,
+// the hashes of files filled in as their blobs are stored, and the
+// directories among them, by entry index, until their own trees are.
+type treeNode struct {
+	entries  []objects.TreeEntry
+	subtrees map[int]*treeNode
+}
+
+// pendingBlob is a file whose blob is still to be stored, for the entry at
+// index in node.
+type pendingBlob struct {
+	path     string
+	relative string
+	info     fs.FileInfo
+	node     *treeNode
+	index    int
+}
+
+// scanTree lists dir into node, leaving each file to blobs and recursing
+// into directories.
+func (repository *Repository) scanTree(dir string, relative string, ignores *ignore.Matcher, node *treeNode, blobs *[]pendingBlob) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("Error reading directory %v: %w", dir, err)
+	}
+	for _, entry := range entries {
+		entryPath := filepath.Join(dir, entry.Name())
+		entryRelative := path.Join(relative, entry.Name())
+		if entry.Name() == ".git" || ignores.Ignored(entryRelative, entry.IsDir()) {
+			continue
+		}
+		switch {
+		case entry.IsDir() && IsSubmodule(entryPath):
+			hash, err := SubmoduleHead(entryPath)
+			if err != nil {
+				return err
+			}
+			node.entries = append(node.entries, objects.TreeEntry{Mode: "160000", Name: entry.Name(), Hash: hash})
+		case entry.IsDir():
+			subtree := &treeNode{subtrees: make(map[int]*treeNode)}
+			if err := repository.scanTree(entryPath, entryRelative, ignores, subtree, blobs); err != nil {
+				return err
+			}
+			node.subtrees[len(node.entries)] = subtree
+			node.entries = append(node.entries, objects.TreeEntry{Mode: "40000", Name: entry.Name()})
+		case entry.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(entryPath)
+			if err != nil {
+				return fmt.Errorf("Error reading symlink %v: %w", entryPath, err)
+			}
+			hash, err := repository.WriteObject(objects.TypeBlob, []byte(target))
+			if err != nil {
+				return err
+			}
+			node.entries = append(node.entries, objects.TreeEntry{Mode: "120000", Name: entry.Name(), Hash: hash})
+		default:
+			info, err := entry.Info()
+			if err != nil {
+				return fmt.Errorf("Error reading file %v: %w", entryPath, err)
+			}
+			mode := "100644"
+			if info.Mode()&0111 != 0 {
+				mode = "100755"
+			}
+			*blobs = append(*blobs, pendingBlob{path: entryPath, relative: entryRelative, info: info, node: node, index: len(node.entries)})
+			node.entries = append(node.entries, objects.TreeEntry{Mode: mode, Name: entry.Name()})
+		}
+	}
+	return nil
+}
+
+// writeBlobs stores the pending files on as many workers as there are CPUs.
+// Each worker fills in only its own entries, so the nodes need no locking.
+func (repository *Repository) writeBlobs(blobs []pendingBlob, known KnownBlob) error {
+	jobs := make(chan *pendingBlob)
+	var (
+		wait     sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	for range min(runtime.GOMAXPROCS(0), len(blobs)) {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for blob := range jobs {
+				var hash []byte
+				if known != nil {
+					hash = known(blob.relative, blob.info)
+				}
+				if hash == nil || !repository.objectExists(hash) {
+					var err error
+					if hash, err = repository.WriteBlobFile(blob.path); err != nil {
+						errOnce.Do(func() { firstErr = err })
+						continue
+					}
+				}
+				blob.node.entries[blob.index].Hash = hash
+			}
+		}()
+	}
+	for index := range blobs {
+		jobs <- &blobs[index]
+	}
+	close(jobs)
+	wait.Wait()
+	return firstErr
+}
+
+// writeTreeNode stores the trees below node and then node's own, leaving
+// out directories that turned out empty.
+func (repository *Repository) writeTreeNode(node *treeNode) ([]byte, error) {
+	tree := &objects.Tree{Entries: make([]objects.TreeEntry, 0, len(node.entries))}
+	for index, entry := range node.entries {
+		if subtree, ok := node.subtrees[index]; ok {
+			hash, err := repository.writeTreeNode(subtree)
+			if err != nil {
+				return nil, err
+			}
+			if bytes.Equal(hash, objects.Hash(repository.Algorithm, objects.TypeTree, nil)) {
+				continue
+			}
+			entry.Hash = hash
+		}
+		tree.Entries = append(tree.Entries, entry)
+	}
+	tree.Sort()
+	return repository.WriteObject(objects.TypeTree, tree.Encode())
+}
+
+// IsSubmodule reports whether dir is the worktree of a nested repository,
+// which a tree records as a gitlink rather than descending into it.
+func IsSubmodule(dir string) bool {
+	_, err := os.Lstat(filepath.Join(dir, ".git"))
+	return err == nil
+}
+
+// SubmoduleHead returns the commit checked out in the nested repository at
+// dir, the object a gitlink entry points at.
+func SubmoduleHead(dir string) ([]byte, error) {
+	submodule, err := Discover(dir)
+	if err != nil {
+		return nil, err
+	}
+	_, sha, err := submodule.Refs.Resolve("HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("error: '%v/' does not have a commit checked out", filepath.ToSlash(dir))
+	}
+	hash, err := hex.DecodeString(sha)
+	if err != nil || len(hash) != submodule.Algorithm.Size() {
+		return nil, fmt.Errorf("Malformed HEAD in submodule %v", dir)
+	}
+	return hash, nil
+}